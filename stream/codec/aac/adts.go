@@ -0,0 +1,82 @@
+package aac
+
+import "fmt"
+
+// ADTSHeaderLength 不带CRC的ADTS头长度
+const ADTSHeaderLength = 7
+
+// ADTSHeader 生成长度为payloadLen的AAC帧对应的ADTS头
+func (c *Config) ADTSHeader(payloadLen int) []byte {
+	frameLen := payloadLen + ADTSHeaderLength
+	profile := int(c.ObjectType) - 1
+	if profile < 0 || profile > 3 {
+		profile = int(ObjectTypeAACLC) - 1
+	}
+	index := sampleRateIndex(c.SampleRate)
+	if index == 0x0F {
+		index = 4
+	}
+	channelConfig := c.channelConfig()
+
+	h := make([]byte, ADTSHeaderLength)
+	// syncword(12) ID(1)=0 layer(2)=0 protection_absent(1)=1
+	h[0] = 0xFF
+	h[1] = 0xF1
+	// profile(2) sampling_frequency_index(4) private_bit(1) channel_configuration(3)
+	h[2] = byte(profile<<6) | byte(index<<2) | byte(channelConfig>>2&0x01)
+	// original/copy(1) home(1) copyright_id_bit(1) copyright_id_start(1) frame_length(13)
+	h[3] = byte(channelConfig&0x03)<<6 | byte(frameLen>>11&0x03)
+	h[4] = byte(frameLen >> 3)
+	// adts_buffer_fullness(11)=0x7FF number_of_raw_data_blocks_in_frame(2)=0
+	h[5] = byte(frameLen&0x07)<<5 | 0x1F
+	h[6] = 0xFC
+	return h
+}
+
+// ADTS 为AAC帧加上ADTS头
+func (c *Config) ADTS(frame []byte) []byte {
+	b := make([]byte, 0, ADTSHeaderLength+len(frame))
+	b = append(b, c.ADTSHeader(len(frame))...)
+	return append(b, frame...)
+}
+
+// IsADTS 数据是否以ADTS同步字开头
+func IsADTS(b []byte) bool {
+	return len(b) >= ADTSHeaderLength && b[0] == 0xFF && b[1]&0xF6 == 0xF0
+}
+
+// SplitADTS 拆分ADTS流，返回去掉ADTS头的AAC帧以及第一个ADTS头中的配置
+func SplitADTS(b []byte) ([][]byte, *Config, error) {
+	var frames [][]byte
+	var config *Config
+	for len(b) > 0 {
+		if !IsADTS(b) {
+			return nil, nil, fmt.Errorf("invalid adts syncword")
+		}
+		protectionAbsent := b[1]&0x01 == 1
+		headerLen := ADTSHeaderLength
+		if !protectionAbsent {
+			headerLen += 2
+		}
+		frameLen := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+		if frameLen < headerLen || frameLen > len(b) {
+			return nil, nil, fmt.Errorf("invalid adts frame length %d", frameLen)
+		}
+		if config == nil {
+			index := int(b[2] >> 2 & 0x0F)
+			if index >= len(SampleRates) {
+				return nil, nil, fmt.Errorf("invalid adts sample rate index %d", index)
+			}
+			channelConfig := int(b[2]&0x01)<<2 | int(b[3]>>6)
+			config = &Config{
+				ObjectType:    ObjectType(b[2]>>6) + 1,
+				SampleRate:    SampleRates[index],
+				ChannelConfig: channelConfig,
+				ChannelCount:  channelCounts[channelConfig],
+			}
+		}
+		frames = append(frames, b[headerLen:frameLen])
+		b = b[frameLen:]
+	}
+	return frames, config, nil
+}
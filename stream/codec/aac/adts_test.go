@@ -0,0 +1,43 @@
+package aac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestADTS(t *testing.T) {
+	config := &Config{ObjectType: ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2}
+	frames := [][]byte{{0x21, 0x10, 0x05}, bytes.Repeat([]byte{0xAB}, 300)}
+	header := config.ADTSHeader(3)
+	if want := []byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x5F, 0xFC}; !bytes.Equal(header, want) {
+		t.Fatalf("ADTSHeader = %x, want %x", header, want)
+	}
+
+	var stream []byte
+	for _, frame := range frames {
+		stream = append(stream, config.ADTS(frame)...)
+	}
+	if !IsADTS(stream) {
+		t.Fatal("IsADTS = false")
+	}
+	got, parsed, err := SplitADTS(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(frames) || !bytes.Equal(got[0], frames[0]) || !bytes.Equal(got[1], frames[1]) {
+		t.Fatalf("SplitADTS frames = %x", got)
+	}
+	if parsed.ObjectType != ObjectTypeAACLC || parsed.SampleRate != 44100 || parsed.ChannelCount != 2 {
+		t.Fatalf("SplitADTS config = %+v", parsed)
+	}
+
+	for _, b := range [][]byte{
+		{0xFF, 0xF1, 0x50, 0x80, 0x10, 0x1F, 0xFC},
+		{0x12, 0x10, 0, 0, 0, 0, 0},
+		stream[:len(stream)-1],
+	} {
+		if _, _, err := SplitADTS(b); err == nil {
+			t.Errorf("SplitADTS(%x): expected error", b)
+		}
+	}
+}
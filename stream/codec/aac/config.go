@@ -0,0 +1,236 @@
+package aac
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// ObjectType 音频对象类型
+type ObjectType int
+
+// 常用的音频对象类型
+const (
+	ObjectTypeAACMain ObjectType = 1
+	ObjectTypeAACLC   ObjectType = 2
+	ObjectTypeAACSSR  ObjectType = 3
+	ObjectTypeAACLTP  ObjectType = 4
+	ObjectTypeSBR     ObjectType = 5
+	ObjectTypeER      ObjectType = 17
+	ObjectTypeAACLD   ObjectType = 23
+	ObjectTypePS      ObjectType = 29
+)
+
+// SampleRates 采样率索引表
+var SampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000,
+	24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// channelCounts 声道配置对应的声道数
+var channelCounts = []int{0, 1, 2, 3, 4, 5, 6, 8}
+
+// Config AudioSpecificConfig(ISO 14496-3 1.6.2.1)
+type Config struct {
+	ObjectType   ObjectType
+	SampleRate   int
+	ChannelCount int
+	// 声道配置，0表示在PCE中定义
+	ChannelConfig int
+	// 为true时每帧960个采样，否则1024个
+	FrameLengthFlag bool
+	// SBR/PS扩展的采样率，未使用时为0
+	ExtensionSampleRate int
+}
+
+// ParseConfig 解析AudioSpecificConfig
+func ParseConfig(b []byte) (*Config, error) {
+	return ReadConfig(codec.NewBitReader(b))
+}
+
+// ReadConfig 从按位读取器中解析AudioSpecificConfig，LATM中的配置不按字节对齐
+func ReadConfig(br *codec.BitReader) (*Config, error) {
+	c := &Config{}
+
+	objectType, err := readObjectType(br)
+	if err != nil {
+		return nil, err
+	}
+	c.ObjectType = objectType
+
+	if c.SampleRate, err = readSampleRate(br); err != nil {
+		return nil, err
+	}
+
+	channelConfig, err := br.ReadBits(4)
+	if err != nil {
+		return nil, err
+	}
+	c.ChannelConfig = int(channelConfig)
+	if c.ChannelConfig < len(channelCounts) {
+		c.ChannelCount = channelCounts[c.ChannelConfig]
+	}
+
+	if c.ObjectType == ObjectTypeSBR || c.ObjectType == ObjectTypePS {
+		if c.ExtensionSampleRate, err = readSampleRate(br); err != nil {
+			return nil, err
+		}
+		if c.ObjectType, err = readObjectType(br); err != nil {
+			return nil, err
+		}
+	}
+
+	switch c.ObjectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		if err = c.readGASpecificConfig(br, int(channelConfig)); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// readGASpecificConfig GASpecificConfig(ISO 14496-3 4.4.1)，channelConfig为0时不解析其后的PCE
+func (c *Config) readGASpecificConfig(br *codec.BitReader, channelConfig int) error {
+	var err error
+	if c.FrameLengthFlag, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	dependsOnCoreCoder, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if dependsOnCoreCoder {
+		// coreCoderDelay
+		if err = br.Skip(14); err != nil {
+			return err
+		}
+	}
+	extensionFlag, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if channelConfig == 0 {
+		return nil
+	}
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		// layerNr
+		if err = br.Skip(3); err != nil {
+			return err
+		}
+	}
+	if extensionFlag {
+		switch c.ObjectType {
+		case 22:
+			// numOfSubFrame(5) layer_length(11)
+			err = br.Skip(16)
+		case 17, 19, 20, 23:
+			// aacSectionDataResilienceFlag aacScalefactorDataResilienceFlag aacSpectralDataResilienceFlag
+			err = br.Skip(3)
+		}
+		if err != nil {
+			return err
+		}
+		// extensionFlag3
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readObjectType(br *codec.BitReader) (ObjectType, error) {
+	v, err := br.ReadBits(5)
+	if err != nil {
+		return 0, err
+	}
+	if v == 31 {
+		ext, err := br.ReadBits(6)
+		if err != nil {
+			return 0, err
+		}
+		v = 32 + ext
+	}
+	return ObjectType(v), nil
+}
+
+func readSampleRate(br *codec.BitReader) (int, error) {
+	index, err := br.ReadBits(4)
+	if err != nil {
+		return 0, err
+	}
+	if index == 0x0F {
+		rate, err := br.ReadBits(24)
+		return int(rate), err
+	}
+	if int(index) >= len(SampleRates) {
+		return 0, fmt.Errorf("invalid aac sample rate index %d", index)
+	}
+	return SampleRates[index], nil
+}
+
+// sampleRateIndex 采样率对应的索引，不在表中时返回0x0F
+func sampleRateIndex(rate int) int {
+	for i, r := range SampleRates {
+		if r == rate {
+			return i
+		}
+	}
+	return 0x0F
+}
+
+// Marshal 编码为AudioSpecificConfig
+func (c *Config) Marshal() []byte {
+	w := &codec.BitWriter{}
+	c.write(w)
+	return w.Bytes()
+}
+
+func (c *Config) write(w *codec.BitWriter) {
+	if c.ObjectType >= 32 {
+		w.WriteBits(31, 5)
+		w.WriteBits(uint64(c.ObjectType-32), 6)
+	} else {
+		w.WriteBits(uint64(c.ObjectType), 5)
+	}
+	index := sampleRateIndex(c.SampleRate)
+	w.WriteBits(uint64(index), 4)
+	if index == 0x0F {
+		w.WriteBits(uint64(c.SampleRate), 24)
+	}
+	w.WriteBits(uint64(c.channelConfig()), 4)
+	w.WriteFlag(c.FrameLengthFlag)
+	// dependsOnCoreCoder, extensionFlag
+	w.WriteBits(0, 2)
+}
+
+// channelConfig 未设置声道配置时按声道数推算
+func (c *Config) channelConfig() int {
+	if c.ChannelConfig > 0 {
+		return c.ChannelConfig
+	}
+	for i, n := range channelCounts {
+		if n == c.ChannelCount && i > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// FrameLength 每帧的采样数
+func (c *Config) FrameLength() int {
+	if c.ObjectType == ObjectTypeAACLD {
+		if c.FrameLengthFlag {
+			return 480
+		}
+		return 512
+	}
+	if c.FrameLengthFlag {
+		return 960
+	}
+	return 1024
+}
+
+// String 编码字符串，例如 mp4a.40.2
+func (c *Config) String() string {
+	return fmt.Sprintf("mp4a.40.%d", c.ObjectType)
+}
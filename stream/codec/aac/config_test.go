@@ -0,0 +1,62 @@
+package aac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		hex     string
+		want    Config
+		marshal bool
+	}{
+		{"1210", Config{ObjectType: ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2, ChannelConfig: 2}, true},
+		{"1190", Config{ObjectType: ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2, ChannelConfig: 2}, true},
+		{"1408", Config{ObjectType: ObjectTypeAACLC, SampleRate: 16000, ChannelCount: 1, ChannelConfig: 1}, true},
+		{"1214", Config{ObjectType: ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2, ChannelConfig: 2, FrameLengthFlag: true}, true},
+		// HE-AAC: SBR，扩展采样率44100
+		{"2b920800", Config{ObjectType: ObjectTypeAACLC, SampleRate: 22050, ChannelCount: 2, ChannelConfig: 2, ExtensionSampleRate: 44100}, false},
+		// 采样率不在表中
+		{"17800fa008", Config{ObjectType: ObjectTypeAACLC, SampleRate: 8000, ChannelCount: 1, ChannelConfig: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.hex)
+			c, err := ParseConfig(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *c != tt.want {
+				t.Fatalf("got %+v, want %+v", *c, tt.want)
+			}
+			if tt.marshal && !bytes.Equal(c.Marshal(), b) {
+				t.Errorf("Marshal = %x", c.Marshal())
+			}
+		})
+	}
+	for _, s := range []string{"", "12", "17"} {
+		b, _ := hex.DecodeString(s)
+		if _, err := ParseConfig(b); err == nil {
+			t.Errorf("ParseConfig(%q): expected error", s)
+		}
+	}
+}
+
+func TestConfigFrameLength(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   int
+	}{
+		{Config{ObjectType: ObjectTypeAACLC}, 1024},
+		{Config{ObjectType: ObjectTypeAACLC, FrameLengthFlag: true}, 960},
+		{Config{ObjectType: ObjectTypeAACLD}, 512},
+		{Config{ObjectType: ObjectTypeAACLD, FrameLengthFlag: true}, 480},
+	}
+	for _, tt := range tests {
+		if got := tt.config.FrameLength(); got != tt.want {
+			t.Errorf("%+v: FrameLength = %d, want %d", tt.config, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package aac
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// StreamMuxConfig LATM的StreamMuxConfig(ISO 14496-3 1.7.3)，仅支持单节目单层
+type StreamMuxConfig struct {
+	AudioMuxVersion int
+	// 每个AudioMuxElement中的子帧数
+	NumSubFrames int
+	Config       *Config
+	// 为0时帧长度由PayloadLengthInfo给出
+	FrameLengthType    int
+	LatmBufferFullness int
+	OtherDataPresent   bool
+	OtherDataLenBits   int
+	CRCCheckPresent    bool
+}
+
+// ParseStreamMuxConfig 解析带外(sdp config)的StreamMuxConfig
+func ParseStreamMuxConfig(b []byte) (*StreamMuxConfig, error) {
+	return ReadStreamMuxConfig(codec.NewBitReader(b))
+}
+
+// latmGetValue LatmGetValue()
+func latmGetValue(br *codec.BitReader) (int, error) {
+	bytesForValue, err := br.ReadBits(2)
+	if err != nil {
+		return 0, err
+	}
+	v, err := br.ReadBits(8 * int(bytesForValue+1))
+	return int(v), err
+}
+
+// ReadStreamMuxConfig 从按位读取器中解析StreamMuxConfig
+func ReadStreamMuxConfig(br *codec.BitReader) (*StreamMuxConfig, error) {
+	c := &StreamMuxConfig{}
+	v, err := br.ReadBits(1)
+	if err != nil {
+		return nil, err
+	}
+	c.AudioMuxVersion = int(v)
+	if c.AudioMuxVersion == 1 {
+		if v, err = br.ReadBits(1); err != nil {
+			return nil, err
+		}
+		if v != 0 {
+			return nil, fmt.Errorf("latm audioMuxVersionA %d not supported", v)
+		}
+		// taraBufferFullness
+		if _, err = latmGetValue(br); err != nil {
+			return nil, err
+		}
+	}
+
+	// allStreamsSameTimeFraming(1) numSubFrames(6) numProgram(4) numLayer(3)
+	if _, err = br.ReadBits(1); err != nil {
+		return nil, err
+	}
+	if v, err = br.ReadBits(6); err != nil {
+		return nil, err
+	}
+	c.NumSubFrames = int(v)
+	numProgram, err := br.ReadBits(4)
+	if err != nil {
+		return nil, err
+	}
+	numLayer, err := br.ReadBits(3)
+	if err != nil {
+		return nil, err
+	}
+	if numProgram != 0 || numLayer != 0 {
+		return nil, fmt.Errorf("latm with multiple programs or layers not supported")
+	}
+
+	if c.AudioMuxVersion == 0 {
+		if c.Config, err = ReadConfig(br); err != nil {
+			return nil, err
+		}
+	} else {
+		ascLen, err := latmGetValue(br)
+		if err != nil {
+			return nil, err
+		}
+		start := br.Pos()
+		if c.Config, err = ReadConfig(br); err != nil {
+			return nil, err
+		}
+		// 跳过ASC中未解析的部分
+		if used := br.Pos() - start; used < ascLen {
+			if err = br.Skip(ascLen - used); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if v, err = br.ReadBits(3); err != nil {
+		return nil, err
+	}
+	c.FrameLengthType = int(v)
+	switch c.FrameLengthType {
+	case 0:
+		if v, err = br.ReadBits(8); err != nil {
+			return nil, err
+		}
+		c.LatmBufferFullness = int(v)
+	default:
+		return nil, fmt.Errorf("latm frameLengthType %d not supported", c.FrameLengthType)
+	}
+
+	if c.OtherDataPresent, err = br.ReadFlag(); err != nil {
+		return nil, err
+	}
+	if c.OtherDataPresent {
+		if c.AudioMuxVersion == 1 {
+			if c.OtherDataLenBits, err = latmGetValue(br); err != nil {
+				return nil, err
+			}
+		} else {
+			for {
+				escape, err := br.ReadFlag()
+				if err != nil {
+					return nil, err
+				}
+				b, err := br.ReadBits(8)
+				if err != nil {
+					return nil, err
+				}
+				c.OtherDataLenBits = c.OtherDataLenBits<<8 | int(b)
+				if !escape {
+					break
+				}
+			}
+		}
+	}
+
+	if c.CRCCheckPresent, err = br.ReadFlag(); err != nil {
+		return nil, err
+	}
+	if c.CRCCheckPresent {
+		if _, err = br.ReadBits(8); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Marshal 编码为StreamMuxConfig(audioMuxVersion=0)，用于sdp的config参数
+func (c *StreamMuxConfig) Marshal() []byte {
+	w := &codec.BitWriter{}
+	// audioMuxVersion(1)=0 allStreamsSameTimeFraming(1)=1
+	w.WriteBits(0, 1)
+	w.WriteBits(1, 1)
+	w.WriteBits(uint64(c.NumSubFrames), 6)
+	// numProgram(4)=0 numLayer(3)=0
+	w.WriteBits(0, 7)
+	c.Config.write(w)
+	// frameLengthType(3)=0 latmBufferFullness(8)=0xFF
+	w.WriteBits(0, 3)
+	w.WriteBits(0xFF, 8)
+	// otherDataPresent(1)=0 crcCheckPresent(1)=0
+	w.WriteBits(0, 2)
+	return w.Bytes()
+}
+
+// ReadPayloadLengthInfo 读取PayloadLengthInfo()，frameLengthType为0时有效
+func ReadPayloadLengthInfo(br *codec.BitReader) (int, error) {
+	size := 0
+	for {
+		v, err := br.ReadBits(8)
+		if err != nil {
+			return 0, err
+		}
+		size += int(v)
+		if v != 0xFF {
+			return size, nil
+		}
+	}
+}
+
+// PayloadLengthInfo 编码PayloadLengthInfo()
+func PayloadLengthInfo(size int) []byte {
+	b := make([]byte, 0, size/255+1)
+	for ; size >= 255; size -= 255 {
+		b = append(b, 0xFF)
+	}
+	return append(b, byte(size))
+}
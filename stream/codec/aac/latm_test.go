@@ -0,0 +1,54 @@
+package aac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+func TestStreamMuxConfig(t *testing.T) {
+	config := &Config{ObjectType: ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2}
+	b := (&StreamMuxConfig{Config: config}).Marshal()
+	if got := hex.EncodeToString(b); got != "400024203fc0" {
+		t.Fatalf("Marshal = %s", got)
+	}
+	c, err := ParseStreamMuxConfig(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AudioMuxVersion != 0 || c.NumSubFrames != 0 || c.FrameLengthType != 0 || c.LatmBufferFullness != 0xFF ||
+		c.Config.SampleRate != 44100 || c.Config.ChannelCount != 2 {
+		t.Fatalf("ParseStreamMuxConfig = %+v %+v", c, c.Config)
+	}
+
+	// 多节目、frameLengthType不为0、数据不完整
+	for _, s := range []string{"4010", "400024213fc0", "40"} {
+		b, _ := hex.DecodeString(s)
+		if _, err := ParseStreamMuxConfig(b); err == nil {
+			t.Errorf("ParseStreamMuxConfig(%s): expected error", s)
+		}
+	}
+}
+
+func TestPayloadLengthInfo(t *testing.T) {
+	tests := []struct {
+		size int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{254, []byte{0xFE}},
+		{255, []byte{0xFF, 0x00}},
+		{600, []byte{0xFF, 0xFF, 0x5A}},
+	}
+	for _, tt := range tests {
+		b := PayloadLengthInfo(tt.size)
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("PayloadLengthInfo(%d) = %x, want %x", tt.size, b, tt.want)
+		}
+		if size, err := ReadPayloadLengthInfo(codec.NewBitReader(b)); err != nil || size != tt.size {
+			t.Errorf("ReadPayloadLengthInfo(%x) = %d, %v", b, size, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// 起始码
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// JoinAnnexB 以起始码 00 00 00 01 拼接NALU
+func JoinAnnexB(nalus [][]byte) []byte {
+	size := 0
+	for _, nalu := range nalus {
+		size += len(startCode) + len(nalu)
+	}
+	b := make([]byte, 0, size)
+	for _, nalu := range nalus {
+		b = append(b, startCode...)
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// SplitAnnexB 按起始码(3字节或4字节)拆分出NALU，返回的NALU与b共享内存
+func SplitAnnexB(b []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); {
+		if b[i] == 0 && b[i+1] == 0 && b[i+2] == 1 {
+			if start >= 0 {
+				end := i
+				// 4字节起始码前导的0属于起始码
+				for end > start && b[end-1] == 0 {
+					end--
+				}
+				if end > start {
+					nalus = append(nalus, b[start:end])
+				}
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 && start < len(b) {
+		nalus = append(nalus, b[start:])
+	}
+	return nalus
+}
+
+// JoinAVCC 以4字节大端长度前缀拼接NALU
+func JoinAVCC(nalus [][]byte) []byte {
+	size := 0
+	for _, nalu := range nalus {
+		size += 4 + len(nalu)
+	}
+	b := make([]byte, 0, size)
+	for _, nalu := range nalus {
+		b = append(b, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// SplitAVCC 按4字节大端长度前缀拆分出NALU，返回的NALU与b共享内存
+func SplitAVCC(b []byte) ([][]byte, error) {
+	var nalus [][]byte
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("avcc length prefix truncated")
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		if size > len(b) {
+			return nil, fmt.Errorf("avcc nalu size %d exceeds remaining %d", size, len(b))
+		}
+		if size > 0 {
+			nalus = append(nalus, b[:size])
+		}
+		b = b[size:]
+	}
+	return nalus, nil
+}
+
+// IsAnnexB 判断数据是否以起始码开头
+func IsAnnexB(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0 && b[1] == 0 && (b[2] == 1 || len(b) >= 4 && b[2] == 0 && b[3] == 1)
+}
+
+// RemoveEmulationPrevention 去掉NALU中的防竞争字节(00 00 03 中的03)，得到RBSP
+func RemoveEmulationPrevention(nalu []byte) []byte {
+	b := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, c := range nalu {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// AddEmulationPrevention 在RBSP中插入防竞争字节，00 00 之后为00~03时插入03
+func AddEmulationPrevention(rbsp []byte) []byte {
+	b := make([]byte, 0, len(rbsp)+len(rbsp)/64)
+	zeros := 0
+	for _, c := range rbsp {
+		if zeros >= 2 && c <= 0x03 {
+			b = append(b, 0x03)
+			zeros = 0
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		b = append(b, c)
+	}
+	return b
+}
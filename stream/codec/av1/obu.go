@@ -0,0 +1,221 @@
+package av1
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// OBUType av1 OBU类型
+type OBUType uint8
+
+// OBU类型(AV1 Bitstream Specification 6.2.2)
+const (
+	OBUTypeSequenceHeader       OBUType = 1
+	OBUTypeTemporalDelimiter    OBUType = 2
+	OBUTypeFrameHeader          OBUType = 3
+	OBUTypeTileGroup            OBUType = 4
+	OBUTypeMetadata             OBUType = 5
+	OBUTypeFrame                OBUType = 6
+	OBUTypeRedundantFrameHeader OBUType = 7
+	OBUTypeTileList             OBUType = 8
+	OBUTypePadding              OBUType = 15
+)
+
+func (t OBUType) String() string {
+	switch t {
+	case OBUTypeSequenceHeader:
+		return "sequence header"
+	case OBUTypeTemporalDelimiter:
+		return "temporal delimiter"
+	case OBUTypeFrameHeader:
+		return "frame header"
+	case OBUTypeTileGroup:
+		return "tile group"
+	case OBUTypeMetadata:
+		return "metadata"
+	case OBUTypeFrame:
+		return "frame"
+	case OBUTypeRedundantFrameHeader:
+		return "redundant frame header"
+	case OBUTypeTileList:
+		return "tile list"
+	case OBUTypePadding:
+		return "padding"
+	}
+	return "unknow"
+}
+
+// Type OBU类型，obu为空时返回0
+func Type(obu []byte) OBUType {
+	if len(obu) == 0 {
+		return 0
+	}
+	return OBUType(obu[0] >> 3 & 0x0F)
+}
+
+// headerLength OBU头长度，带扩展头时为2
+func headerLength(obu []byte) int {
+	if len(obu) > 0 && obu[0]&0x04 != 0 {
+		return 2
+	}
+	return 1
+}
+
+// hasSizeField OBU头中obu_has_size_field是否为1
+func hasSizeField(obu []byte) bool {
+	return len(obu) > 0 && obu[0]&0x02 != 0
+}
+
+// ReadLEB128 读取leb128编码的数值，返回数值和占用的字节数
+func ReadLEB128(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0, fmt.Errorf("av1 leb128 truncated")
+		}
+		v |= uint64(b[i]&0x7F) << uint(7*i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("av1 leb128 too long")
+}
+
+// AppendLEB128 以leb128编码追加数值
+func AppendLEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// Payload OBU中去掉头和长度字段后的数据
+func Payload(obu []byte) ([]byte, error) {
+	n := headerLength(obu)
+	if len(obu) < n {
+		return nil, fmt.Errorf("av1 obu header truncated")
+	}
+	if !hasSizeField(obu) {
+		return obu[n:], nil
+	}
+	size, m, err := ReadLEB128(obu[n:])
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(obu)-n-m) < size {
+		return nil, fmt.Errorf("av1 obu size %d exceeds data", size)
+	}
+	return obu[n+m : n+m+int(size)], nil
+}
+
+// SplitOBUs 拆分低开销格式(Section 5)的时间单元，没有长度字段的OBU视为延续到数据末尾
+func SplitOBUs(data []byte) ([][]byte, error) {
+	var obus [][]byte
+	for len(data) > 0 {
+		n := headerLength(data)
+		if len(data) < n {
+			return nil, fmt.Errorf("av1 obu header truncated")
+		}
+		if data[0]&0x80 != 0 {
+			return nil, fmt.Errorf("av1 obu forbidden bit set")
+		}
+		if !hasSizeField(data) {
+			obus = append(obus, data)
+			break
+		}
+		size, m, err := ReadLEB128(data[n:])
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(data)-n-m) < size {
+			return nil, fmt.Errorf("av1 obu size %d exceeds data", size)
+		}
+		end := n + m + int(size)
+		obus = append(obus, data[:end])
+		data = data[end:]
+	}
+	return obus, nil
+}
+
+// WithSizeField 转换为带长度字段的OBU
+func WithSizeField(obu []byte) ([]byte, error) {
+	if hasSizeField(obu) {
+		return obu, nil
+	}
+	n := headerLength(obu)
+	if len(obu) < n {
+		return nil, fmt.Errorf("av1 obu header truncated")
+	}
+	b := make([]byte, 0, len(obu)+8)
+	b = append(b, obu[0]|0x02)
+	b = append(b, obu[1:n]...)
+	b = AppendLEB128(b, uint64(len(obu)-n))
+	return append(b, obu[n:]...), nil
+}
+
+// WithoutSizeField 转换为不带长度字段的OBU，rtp封装时使用
+func WithoutSizeField(obu []byte) ([]byte, error) {
+	if !hasSizeField(obu) {
+		return obu, nil
+	}
+	payload, err := Payload(obu)
+	if err != nil {
+		return nil, err
+	}
+	n := headerLength(obu)
+	b := make([]byte, 0, n+len(payload))
+	b = append(b, obu[0]&^0x02)
+	b = append(b, obu[1:n]...)
+	return append(b, payload...), nil
+}
+
+// JoinOBUs 将OBU以低开销格式拼接
+func JoinOBUs(obus [][]byte) ([]byte, error) {
+	var b []byte
+	for _, obu := range obus {
+		obu, err := WithSizeField(obu)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, obu...)
+	}
+	return b, nil
+}
+
+// IsKeyframe 时间单元中第一个帧头的frame_type是否为KEY_FRAME
+func IsKeyframe(obus [][]byte) bool {
+	reducedStillPicture := false
+	for _, obu := range obus {
+		switch Type(obu) {
+		case OBUTypeSequenceHeader:
+			payload, err := Payload(obu)
+			if err != nil || len(payload) == 0 {
+				return false
+			}
+			// seq_profile(3) still_picture(1) reduced_still_picture_header(1)
+			reducedStillPicture = payload[0]&0x08 != 0
+		case OBUTypeFrameHeader, OBUTypeFrame:
+			if reducedStillPicture {
+				return true
+			}
+			payload, err := Payload(obu)
+			if err != nil {
+				return false
+			}
+			// show_existing_frame(1) frame_type(2)
+			br := codec.NewBitReader(payload)
+			showExisting, err := br.ReadFlag()
+			if err != nil || showExisting {
+				return false
+			}
+			frameType, err := br.ReadBits(2)
+			return err == nil && frameType == 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package av1
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLEB128(t *testing.T) {
+	tests := []struct {
+		v uint64
+		b []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xac, 0x02}},
+		{1 << 28, []byte{0x80, 0x80, 0x80, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		if b := AppendLEB128(nil, tt.v); !bytes.Equal(b, tt.b) {
+			t.Errorf("AppendLEB128(%d) = %x, want %x", tt.v, b, tt.b)
+		}
+		if v, n, err := ReadLEB128(tt.b); err != nil || v != tt.v || n != len(tt.b) {
+			t.Errorf("ReadLEB128(%x) = %d, %d, %v", tt.b, v, n, err)
+		}
+	}
+	for _, b := range [][]byte{{0x80}, bytes.Repeat([]byte{0x80}, 9)} {
+		if _, _, err := ReadLEB128(b); err == nil {
+			t.Errorf("ReadLEB128(%x): expected error", b)
+		}
+	}
+}
+
+func TestOBUs(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	// reduced_still_picture_header=0
+	seq := []byte{0x0a, 0x03, 0x00, 0x00, 0x00}
+	keyframe := []byte{0x32, 0x02, 0x10, 0xaa}
+	interframe := []byte{0x32, 0x02, 0x30, 0xbb}
+	// 带扩展头，不带长度字段
+	frameNoSize := []byte{0x34, 0x00, 0x10, 0xcc}
+
+	data := bytes.Join([][]byte{td, seq, keyframe}, nil)
+	obus, err := SplitOBUs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obus) != 3 || Type(obus[0]) != OBUTypeTemporalDelimiter || Type(obus[1]) != OBUTypeSequenceHeader || Type(obus[2]) != OBUTypeFrame {
+		t.Fatalf("SplitOBUs = %x", obus)
+	}
+	if !IsKeyframe(obus) || IsKeyframe([][]byte{interframe}) {
+		t.Error("IsKeyframe mismatch")
+	}
+	if joined, err := JoinOBUs(obus); err != nil || !bytes.Equal(joined, data) {
+		t.Errorf("JoinOBUs = %x, %v", joined, err)
+	}
+
+	withSize, err := WithSizeField(frameNoSize)
+	if err != nil || !bytes.Equal(withSize, []byte{0x36, 0x00, 0x02, 0x10, 0xcc}) {
+		t.Fatalf("WithSizeField = %x, %v", withSize, err)
+	}
+	if without, err := WithoutSizeField(withSize); err != nil || !bytes.Equal(without, frameNoSize) {
+		t.Errorf("WithoutSizeField = %x, %v", without, err)
+	}
+	if payload, err := Payload(withSize); err != nil || !bytes.Equal(payload, []byte{0x10, 0xcc}) {
+		t.Errorf("Payload = %x, %v", payload, err)
+	}
+	if !IsKeyframe([][]byte{frameNoSize}) {
+		t.Error("frame without size field not detected as keyframe")
+	}
+	// 最后一个OBU不带长度字段时延续到末尾
+	if obus, err := SplitOBUs(append(append([]byte(nil), td...), frameNoSize...)); err != nil || len(obus) != 2 || !bytes.Equal(obus[1], frameNoSize) {
+		t.Errorf("SplitOBUs without size field = %x, %v", obus, err)
+	}
+	// reduced_still_picture_header 时都是关键帧
+	if !IsKeyframe([][]byte{{0x0a, 0x01, 0x18}, interframe}) {
+		t.Error("reduced still picture not detected as keyframe")
+	}
+
+	for _, b := range [][]byte{{0x92, 0x00}, {0x32, 0x05, 0x10}, {0x36}} {
+		if _, err := SplitOBUs(b); err == nil {
+			t.Errorf("SplitOBUs(%x): expected error", b)
+		}
+	}
+	if Type(nil) != 0 || OBUTypeFrame.String() != "frame" {
+		t.Error("unexpected obu type")
+	}
+}
@@ -0,0 +1,136 @@
+package codec
+
+import "fmt"
+
+// BitReader 按位读取数据，高位在前
+type BitReader struct {
+	buf []byte
+	pos int
+}
+
+// NewBitReader 创建按位读取器
+func NewBitReader(buf []byte) *BitReader {
+	return &BitReader{buf: buf}
+}
+
+// ReadBits 读取n位(n<=64)
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		return 0, fmt.Errorf("invalid bit count %d", n)
+	}
+	if r.Remaining() < n {
+		return 0, fmt.Errorf("not enough bits, need %d, remaining %d", n, r.Remaining())
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		v = v<<1 | uint64(r.buf[r.pos>>3]>>(7-uint(r.pos&7))&1)
+		r.pos++
+	}
+	return v, nil
+}
+
+// ReadFlag 读取1位并作为布尔值返回
+func (r *BitReader) ReadFlag() (bool, error) {
+	v, err := r.ReadBits(1)
+	return v == 1, err
+}
+
+// ReadUE 读取无符号指数哥伦布编码ue(v)
+func (r *BitReader) ReadUE() (uint64, error) {
+	zeros := 0
+	for {
+		b, err := r.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 32 {
+			return 0, fmt.Errorf("exp-golomb code too long")
+		}
+	}
+	v, err := r.ReadBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return 1<<uint(zeros) - 1 + v, nil
+}
+
+// ReadSE 读取有符号指数哥伦布编码se(v)
+func (r *BitReader) ReadSE() (int64, error) {
+	v, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if v&1 == 1 {
+		return int64(v+1) / 2, nil
+	}
+	return -int64(v / 2), nil
+}
+
+// Skip 跳过n位
+func (r *BitReader) Skip(n int) error {
+	if n < 0 || r.Remaining() < n {
+		return fmt.Errorf("not enough bits to skip %d", n)
+	}
+	r.pos += n
+	return nil
+}
+
+// ByteAlign 跳到下一个字节边界
+func (r *BitReader) ByteAlign() {
+	r.pos = (r.pos + 7) &^ 7
+	if r.pos > len(r.buf)*8 {
+		r.pos = len(r.buf) * 8
+	}
+}
+
+// Pos 当前已读取的位数
+func (r *BitReader) Pos() int {
+	return r.pos
+}
+
+// Remaining 剩余的位数
+func (r *BitReader) Remaining() int {
+	return len(r.buf)*8 - r.pos
+}
+
+// BitWriter 按位写入数据，高位在前
+type BitWriter struct {
+	buf []byte
+	pos int
+}
+
+// WriteBits 写入v的低n位(n<=64)
+func (w *BitWriter) WriteBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos&7 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 1 << (7 - uint(w.pos&7))
+		}
+		w.pos++
+	}
+}
+
+// WriteFlag 写入1位
+func (w *BitWriter) WriteFlag(b bool) {
+	if b {
+		w.WriteBits(1, 1)
+	} else {
+		w.WriteBits(0, 1)
+	}
+}
+
+// Bytes 已写入的数据，不足一个字节的部分以0补齐
+func (w *BitWriter) Bytes() []byte {
+	return w.buf
+}
+
+// Len 已写入的位数
+func (w *BitWriter) Len() int {
+	return w.pos
+}
@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitReader(t *testing.T) {
+	// 101 | ue 00111=6 | se 00101=-2 | se 010=1 | ue 1=0
+	r := NewBitReader([]byte{0xA7, 0x2A, 0x80})
+	if v, err := r.ReadBits(3); err != nil || v != 5 {
+		t.Fatalf("ReadBits = %d, %v", v, err)
+	}
+	if v, err := r.ReadUE(); err != nil || v != 6 {
+		t.Fatalf("ReadUE = %d, %v", v, err)
+	}
+	if v, err := r.ReadSE(); err != nil || v != -2 {
+		t.Fatalf("ReadSE = %d, %v", v, err)
+	}
+	if v, err := r.ReadSE(); err != nil || v != 1 {
+		t.Fatalf("ReadSE = %d, %v", v, err)
+	}
+	if v, err := r.ReadUE(); err != nil || v != 0 {
+		t.Fatalf("ReadUE = %d, %v", v, err)
+	}
+	if r.Pos() != 17 || r.Remaining() != 7 {
+		t.Fatalf("pos=%d remaining=%d", r.Pos(), r.Remaining())
+	}
+	r.ByteAlign()
+	if r.Pos() != 24 {
+		t.Fatalf("ByteAlign pos=%d", r.Pos())
+	}
+	if _, err := r.ReadBits(1); err == nil {
+		t.Fatal("expected error reading past end")
+	}
+	if err := NewBitReader([]byte{0}).Skip(9); err == nil {
+		t.Fatal("expected error skipping past end")
+	}
+	if _, err := NewBitReader(make([]byte, 8)).ReadUE(); err == nil {
+		t.Fatal("expected error for overlong exp-golomb code")
+	}
+}
+
+func TestBitWriter(t *testing.T) {
+	w := &BitWriter{}
+	w.WriteBits(5, 3)
+	w.WriteFlag(false)
+	w.WriteFlag(true)
+	w.WriteBits(0x1FF, 9)
+	if w.Len() != 14 || !bytes.Equal(w.Bytes(), []byte{0xAF, 0xFC}) {
+		t.Fatalf("got %x (%d bits)", w.Bytes(), w.Len())
+	}
+	r := NewBitReader(w.Bytes())
+	if v, _ := r.ReadBits(5); v != 0x15 {
+		t.Fatalf("read back %x", v)
+	}
+}
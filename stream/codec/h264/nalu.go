@@ -0,0 +1,77 @@
+package h264
+
+// NALUType h264 NALU类型
+type NALUType uint8
+
+// NALU类型，24~29为rtp封装使用的类型(RFC 6184)
+const (
+	NALUTypeNonIDR NALUType = 1
+	NALUTypeIDR    NALUType = 5
+	NALUTypeSEI    NALUType = 6
+	NALUTypeSPS    NALUType = 7
+	NALUTypePPS    NALUType = 8
+	NALUTypeAUD    NALUType = 9
+	NALUTypeEOS    NALUType = 10
+	NALUTypeEOB    NALUType = 11
+	NALUTypeFiller NALUType = 12
+	NALUTypeSTAPA  NALUType = 24
+	NALUTypeSTAPB  NALUType = 25
+	NALUTypeMTAP16 NALUType = 26
+	NALUTypeMTAP24 NALUType = 27
+	NALUTypeFUA    NALUType = 28
+	NALUTypeFUB    NALUType = 29
+)
+
+func (t NALUType) String() string {
+	switch t {
+	case NALUTypeNonIDR:
+		return "non-IDR"
+	case NALUTypeIDR:
+		return "IDR"
+	case NALUTypeSEI:
+		return "SEI"
+	case NALUTypeSPS:
+		return "SPS"
+	case NALUTypePPS:
+		return "PPS"
+	case NALUTypeAUD:
+		return "AUD"
+	case NALUTypeEOS:
+		return "EOS"
+	case NALUTypeEOB:
+		return "EOB"
+	case NALUTypeFiller:
+		return "filler"
+	case NALUTypeSTAPA:
+		return "STAP-A"
+	case NALUTypeSTAPB:
+		return "STAP-B"
+	case NALUTypeMTAP16:
+		return "MTAP16"
+	case NALUTypeMTAP24:
+		return "MTAP24"
+	case NALUTypeFUA:
+		return "FU-A"
+	case NALUTypeFUB:
+		return "FU-B"
+	}
+	return "unknow"
+}
+
+// Type 获取NALU类型
+func Type(nalu []byte) NALUType {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return NALUType(nalu[0] & 0x1F)
+}
+
+// IsKeyframe NALU列表中是否包含IDR
+func IsKeyframe(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		if Type(nalu) == NALUTypeIDR {
+			return true
+		}
+	}
+	return false
+}
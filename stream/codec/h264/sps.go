@@ -0,0 +1,481 @@
+package h264
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// SPS h264序列参数集中常用的字段(ITU-T H.264 7.3.2.1.1)
+type SPS struct {
+	ProfileIdc      int
+	ConstraintFlags int
+	LevelIdc        int
+	ID              int
+	ChromaFormatIdc int
+	BitDepthLuma    int
+	BitDepthChroma  int
+	FrameMbsOnly    bool
+	// 裁剪后的宽高
+	Width  int
+	Height int
+
+	// VUI timing_info，TimingInfoPresent为false时无效
+	TimingInfoPresent bool
+	NumUnitsInTick    uint32
+	TimeScale         uint32
+	FixedFrameRate    bool
+
+	// VUI bitstream_restriction，BitstreamRestriction为false时MaxNumReorderFrames无效
+	BitstreamRestriction bool
+	MaxNumReorderFrames  int
+}
+
+// 带chroma_format_idc等扩展字段的profile
+var highProfiles = map[int]bool{
+	100: true, 110: true, 122: true, 244: true, 44: true, 83: true,
+	86: true, 118: true, 128: true, 138: true, 139: true, 134: true, 135: true,
+}
+
+// constraint_set3_flag为1时只有I帧的profile
+var intraProfiles = map[int]bool{44: true, 100: true, 110: true, 122: true, 244: true}
+
+// ParseSPS 解析SPS，nalu 包含NALU header
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if Type(nalu) != NALUTypeSPS {
+		return nil, fmt.Errorf("h264 nalu type %v is not SPS", Type(nalu))
+	}
+	br := codec.NewBitReader(codec.RemoveEmulationPrevention(nalu[1:]))
+	s := &SPS{ChromaFormatIdc: 1, BitDepthLuma: 8, BitDepthChroma: 8}
+
+	v, err := br.ReadBits(24)
+	if err != nil {
+		return nil, err
+	}
+	s.ProfileIdc = int(v >> 16)
+	s.ConstraintFlags = int(v >> 8 & 0xFF)
+	s.LevelIdc = int(v & 0xFF)
+	if s.ID, err = readUE(br); err != nil {
+		return nil, err
+	}
+
+	separateColourPlane := false
+	if highProfiles[s.ProfileIdc] {
+		if s.ChromaFormatIdc, err = readUE(br); err != nil {
+			return nil, err
+		}
+		if s.ChromaFormatIdc == 3 {
+			if separateColourPlane, err = br.ReadFlag(); err != nil {
+				return nil, err
+			}
+		}
+		depth, err := readUE(br)
+		if err != nil {
+			return nil, err
+		}
+		s.BitDepthLuma = depth + 8
+		if depth, err = readUE(br); err != nil {
+			return nil, err
+		}
+		s.BitDepthChroma = depth + 8
+		// qpprime_y_zero_transform_bypass_flag
+		if err = br.Skip(1); err != nil {
+			return nil, err
+		}
+		scalingMatrixPresent, err := br.ReadFlag()
+		if err != nil {
+			return nil, err
+		}
+		if scalingMatrixPresent {
+			count := 8
+			if s.ChromaFormatIdc == 3 {
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				present, err := br.ReadFlag()
+				if err != nil {
+					return nil, err
+				}
+				if !present {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err = skipScalingList(br, size); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// log2_max_frame_num_minus4
+	if _, err = br.ReadUE(); err != nil {
+		return nil, err
+	}
+	pocType, err := br.ReadUE()
+	if err != nil {
+		return nil, err
+	}
+	switch pocType {
+	case 0:
+		// log2_max_pic_order_cnt_lsb_minus4
+		if _, err = br.ReadUE(); err != nil {
+			return nil, err
+		}
+	case 1:
+		// delta_pic_order_always_zero_flag offset_for_non_ref_pic offset_for_top_to_bottom_field
+		if err = br.Skip(1); err != nil {
+			return nil, err
+		}
+		if _, err = br.ReadSE(); err != nil {
+			return nil, err
+		}
+		if _, err = br.ReadSE(); err != nil {
+			return nil, err
+		}
+		cycle, err := br.ReadUE()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < cycle; i++ {
+			if _, err = br.ReadSE(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// max_num_ref_frames gaps_in_frame_num_value_allowed_flag
+	if _, err = br.ReadUE(); err != nil {
+		return nil, err
+	}
+	if err = br.Skip(1); err != nil {
+		return nil, err
+	}
+
+	widthMbs, err := readUE(br)
+	if err != nil {
+		return nil, err
+	}
+	heightMapUnits, err := readUE(br)
+	if err != nil {
+		return nil, err
+	}
+	if s.FrameMbsOnly, err = br.ReadFlag(); err != nil {
+		return nil, err
+	}
+	if !s.FrameMbsOnly {
+		// mb_adaptive_frame_field_flag
+		if err = br.Skip(1); err != nil {
+			return nil, err
+		}
+	}
+	// direct_8x8_inference_flag
+	if err = br.Skip(1); err != nil {
+		return nil, err
+	}
+
+	fieldFactor := 2
+	if s.FrameMbsOnly {
+		fieldFactor = 1
+	}
+	s.Width = (widthMbs + 1) * 16
+	s.Height = (heightMapUnits + 1) * 16 * fieldFactor
+
+	cropping, err := br.ReadFlag()
+	if err != nil {
+		return nil, err
+	}
+	if cropping {
+		var crop [4]int
+		for i := range crop {
+			if crop[i], err = readUE(br); err != nil {
+				return nil, err
+			}
+		}
+		// 裁剪单位由色度采样格式决定
+		cropUnitX, cropUnitY := 1, fieldFactor
+		if !separateColourPlane && s.ChromaFormatIdc != 0 {
+			subWidthC, subHeightC := 2, 2
+			switch s.ChromaFormatIdc {
+			case 2:
+				subHeightC = 1
+			case 3:
+				subWidthC, subHeightC = 1, 1
+			}
+			cropUnitX, cropUnitY = subWidthC, subHeightC*fieldFactor
+		}
+		s.Width -= cropUnitX * (crop[0] + crop[1])
+		s.Height -= cropUnitY * (crop[2] + crop[3])
+	}
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil, fmt.Errorf("h264 sps invalid size %dx%d", s.Width, s.Height)
+	}
+
+	vuiPresent, err := br.ReadFlag()
+	if err != nil {
+		return nil, err
+	}
+	if vuiPresent {
+		// VUI截断时保留已解析的结果
+		_ = s.readVUI(br)
+	}
+	return s, nil
+}
+
+// readVUI 解析VUI中的timing_info和bitstream_restriction(E.1.1)
+func (s *SPS) readVUI(br *codec.BitReader) error {
+	present, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if present {
+		// aspect_ratio_idc，255时为Extended_SAR
+		idc, err := br.ReadBits(8)
+		if err != nil {
+			return err
+		}
+		if idc == 255 {
+			if err = br.Skip(32); err != nil {
+				return err
+			}
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// overscan_appropriate_flag
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// video_format(3) video_full_range_flag(1)
+		if err = br.Skip(4); err != nil {
+			return err
+		}
+		colourDescription, err := br.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if colourDescription {
+			// colour_primaries transfer_characteristics matrix_coefficients
+			if err = br.Skip(24); err != nil {
+				return err
+			}
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// chroma_sample_loc_type_top_field chroma_sample_loc_type_bottom_field
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		units, err := br.ReadBits(32)
+		if err != nil {
+			return err
+		}
+		scale, err := br.ReadBits(32)
+		if err != nil {
+			return err
+		}
+		fixed, err := br.ReadFlag()
+		if err != nil {
+			return err
+		}
+		s.TimingInfoPresent = true
+		s.NumUnitsInTick = uint32(units)
+		s.TimeScale = uint32(scale)
+		s.FixedFrameRate = fixed
+	}
+
+	// nal_hrd_parameters vcl_hrd_parameters
+	hrd := false
+	for i := 0; i < 2; i++ {
+		if present, err = br.ReadFlag(); err != nil {
+			return err
+		}
+		if present {
+			hrd = true
+			if err = skipHRDParameters(br); err != nil {
+				return err
+			}
+		}
+	}
+	if hrd {
+		// low_delay_hrd_flag
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+	// pic_struct_present_flag
+	if err = br.Skip(1); err != nil {
+		return err
+	}
+	if present, err = br.ReadFlag(); err != nil || !present {
+		return err
+	}
+	// motion_vectors_over_pic_boundaries_flag
+	if err = br.Skip(1); err != nil {
+		return err
+	}
+	// max_bytes_per_pic_denom max_bits_per_mb_denom log2_max_mv_length_horizontal log2_max_mv_length_vertical
+	for i := 0; i < 4; i++ {
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+	}
+	reorder, err := readUE(br)
+	if err != nil {
+		return err
+	}
+	s.BitstreamRestriction = true
+	s.MaxNumReorderFrames = reorder
+	return nil
+}
+
+// skipHRDParameters 跳过hrd_parameters(E.1.2)
+func skipHRDParameters(br *codec.BitReader) error {
+	count, err := readUE(br)
+	if err != nil {
+		return err
+	}
+	if count > 31 {
+		return fmt.Errorf("h264 hrd cpb_cnt_minus1 %d out of range", count)
+	}
+	// bit_rate_scale cpb_size_scale
+	if err = br.Skip(8); err != nil {
+		return err
+	}
+	for i := 0; i <= count; i++ {
+		// bit_rate_value_minus1 cpb_size_value_minus1 cbr_flag
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+	// initial_cpb_removal_delay_length_minus1 cpb_removal_delay_length_minus1
+	// dpb_output_delay_length_minus1 time_offset_length
+	return br.Skip(20)
+}
+
+// ReorderFrames 解码顺序和显示顺序最多相差的帧数，ok 为false时SPS中没有给出
+func (s *SPS) ReorderFrames() (n int, ok bool) {
+	if s.BitstreamRestriction {
+		return s.MaxNumReorderFrames, true
+	}
+	// baseline没有B帧，intra profile(constraint_set3)只有I帧(A.2)
+	if s.ProfileIdc == 66 || (s.ConstraintFlags&0x10 != 0 && intraProfiles[s.ProfileIdc]) {
+		return 0, true
+	}
+	return 0, false
+}
+
+// FrameRate 由VUI timing_info得到的标称帧率，没有时返回0
+func (s *SPS) FrameRate() float64 {
+	if !s.TimingInfoPresent || s.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// ProfileName profile名称
+func (s *SPS) ProfileName() string {
+	switch s.ProfileIdc {
+	case 66:
+		if s.ConstraintFlags&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4 Predictive"
+	case 44:
+		return "CAVLC 4:4:4 Intra"
+	case 83:
+		return "Scalable Baseline"
+	case 86:
+		return "Scalable High"
+	case 118:
+		return "Multiview High"
+	case 128:
+		return "Stereo High"
+	}
+	return fmt.Sprintf("Profile %d", s.ProfileIdc)
+}
+
+// LevelName level名称，例如 4.1
+func (s *SPS) LevelName() string {
+	// level_idc为11且constraint_set3_flag为1时是1b(Baseline/Main/Extended)
+	if s.LevelIdc == 9 || (s.LevelIdc == 11 && s.ConstraintFlags&0x10 != 0 &&
+		(s.ProfileIdc == 66 || s.ProfileIdc == 77 || s.ProfileIdc == 88)) {
+		return "1b"
+	}
+	if s.LevelIdc%10 == 0 {
+		return fmt.Sprintf("%d", s.LevelIdc/10)
+	}
+	return fmt.Sprintf("%d.%d", s.LevelIdc/10, s.LevelIdc%10)
+}
+
+// Codec RFC 6381 编码字符串，例如 avc1.64001F
+func (s *SPS) Codec() string {
+	return fmt.Sprintf("avc1.%02X%02X%02X", s.ProfileIdc, s.ConstraintFlags, s.LevelIdc)
+}
+
+// skipScalingList 跳过scaling_list(7.3.2.1.1.1)
+func skipScalingList(br *codec.BitReader, size int) error {
+	lastScale, nextScale := int64(8), int64(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			delta, err := br.ReadSE()
+			if err != nil {
+				return err
+			}
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return nil
+}
+
+// readUE 读取ue(v)并转换为int，限制取值范围避免溢出
+func readUE(br *codec.BitReader) (int, error) {
+	v, err := br.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if v > 1<<20 {
+		return 0, fmt.Errorf("h264 sps value %d out of range", v)
+	}
+	return int(v), nil
+}
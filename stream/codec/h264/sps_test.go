@@ -0,0 +1,124 @@
+package h264
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name    string
+		sps     string
+		want    SPS
+		rate    float64
+		profile string
+		level   string
+		codec   string
+	}{
+		{
+			name: "constrained baseline 1080p",
+			sps:  "6742c01fd900780227e5c044000003000400000300f03c60c920",
+			want: SPS{ProfileIdc: 66, ConstraintFlags: 0xc0, LevelIdc: 31, ChromaFormatIdc: 1,
+				BitDepthLuma: 8, BitDepthChroma: 8, FrameMbsOnly: true, Width: 1920, Height: 1080,
+				TimingInfoPresent: true, NumUnitsInTick: 1, TimeScale: 60,
+				BitstreamRestriction: true},
+			rate:    30,
+			profile: "Constrained Baseline",
+			level:   "3.1",
+			codec:   "avc1.42C01F",
+		},
+		{
+			name: "high 720p",
+			sps:  "6764001facd9405005bb011000000300100000030320f1831960",
+			want: SPS{ProfileIdc: 100, LevelIdc: 31, ChromaFormatIdc: 1,
+				BitDepthLuma: 8, BitDepthChroma: 8, FrameMbsOnly: true, Width: 1280, Height: 720,
+				TimingInfoPresent: true, NumUnitsInTick: 1, TimeScale: 50,
+				BitstreamRestriction: true, MaxNumReorderFrames: 2},
+			rate:    25,
+			profile: "High",
+			level:   "3.1",
+			codec:   "avc1.64001F",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.sps)
+			sps, err := ParseSPS(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *sps != tt.want {
+				t.Errorf("got %+v, want %+v", *sps, tt.want)
+			}
+			if r := sps.FrameRate(); r != tt.rate {
+				t.Errorf("frame rate %v, want %v", r, tt.rate)
+			}
+			if p := sps.ProfileName(); p != tt.profile {
+				t.Errorf("profile %q, want %q", p, tt.profile)
+			}
+			if l := sps.LevelName(); l != tt.level {
+				t.Errorf("level %q, want %q", l, tt.level)
+			}
+			if c := sps.Codec(); c != tt.codec {
+				t.Errorf("codec %q, want %q", c, tt.codec)
+			}
+		})
+	}
+}
+
+func TestSPSLevelName(t *testing.T) {
+	tests := []struct {
+		sps  SPS
+		want string
+	}{
+		{SPS{ProfileIdc: 66, LevelIdc: 11, ConstraintFlags: 0x10}, "1b"},
+		{SPS{ProfileIdc: 100, LevelIdc: 9}, "1b"},
+		{SPS{ProfileIdc: 100, LevelIdc: 11, ConstraintFlags: 0x10}, "1.1"},
+		{SPS{ProfileIdc: 100, LevelIdc: 40}, "4"},
+		{SPS{ProfileIdc: 100, LevelIdc: 51}, "5.1"},
+	}
+	for _, tt := range tests {
+		if got := tt.sps.LevelName(); got != tt.want {
+			t.Errorf("profile %d level %d: got %q, want %q", tt.sps.ProfileIdc, tt.sps.LevelIdc, got, tt.want)
+		}
+	}
+}
+
+func TestSPSReorderFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		sps  SPS
+		want int
+		ok   bool
+	}{
+		{"bitstream restriction", SPS{ProfileIdc: 100, BitstreamRestriction: true, MaxNumReorderFrames: 2}, 2, true},
+		{"baseline", SPS{ProfileIdc: 66}, 0, true},
+		{"high intra", SPS{ProfileIdc: 100, ConstraintFlags: 0x10}, 0, true},
+		{"main unknown", SPS{ProfileIdc: 77}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := tt.sps.ReorderFrames(); got != tt.want || ok != tt.ok {
+				t.Errorf("got %d %v, want %d %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseSPSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sps  []byte
+	}{
+		{"empty", nil},
+		{"not sps", []byte{0x68, 0xce, 0x38, 0x80}},
+		{"truncated", []byte{0x67, 0x64, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSPS(tt.sps); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
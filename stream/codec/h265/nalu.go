@@ -0,0 +1,102 @@
+package h265
+
+// NALUType h265 NALU类型
+type NALUType uint8
+
+// NALU类型，48~50为rtp封装使用的类型(RFC 7798)
+const (
+	NALUTypeTrailN    NALUType = 0
+	NALUTypeTrailR    NALUType = 1
+	NALUTypeBLAWLP    NALUType = 16
+	NALUTypeBLAWRADL  NALUType = 17
+	NALUTypeBLANLP    NALUType = 18
+	NALUTypeIDRWRADL  NALUType = 19
+	NALUTypeIDRNLP    NALUType = 20
+	NALUTypeCRA       NALUType = 21
+	NALUTypeVPS       NALUType = 32
+	NALUTypeSPS       NALUType = 33
+	NALUTypePPS       NALUType = 34
+	NALUTypeAUD       NALUType = 35
+	NALUTypeEOS       NALUType = 36
+	NALUTypeEOB       NALUType = 37
+	NALUTypeFD        NALUType = 38
+	NALUTypePrefixSEI NALUType = 39
+	NALUTypeSuffixSEI NALUType = 40
+	NALUTypeAP        NALUType = 48
+	NALUTypeFU        NALUType = 49
+	NALUTypePACI      NALUType = 50
+)
+
+func (t NALUType) String() string {
+	switch t {
+	case NALUTypeTrailN:
+		return "TRAIL_N"
+	case NALUTypeTrailR:
+		return "TRAIL_R"
+	case NALUTypeBLAWLP:
+		return "BLA_W_LP"
+	case NALUTypeBLAWRADL:
+		return "BLA_W_RADL"
+	case NALUTypeBLANLP:
+		return "BLA_N_LP"
+	case NALUTypeIDRWRADL:
+		return "IDR_W_RADL"
+	case NALUTypeIDRNLP:
+		return "IDR_N_LP"
+	case NALUTypeCRA:
+		return "CRA"
+	case NALUTypeVPS:
+		return "VPS"
+	case NALUTypeSPS:
+		return "SPS"
+	case NALUTypePPS:
+		return "PPS"
+	case NALUTypeAUD:
+		return "AUD"
+	case NALUTypeEOS:
+		return "EOS"
+	case NALUTypeEOB:
+		return "EOB"
+	case NALUTypeFD:
+		return "FD"
+	case NALUTypePrefixSEI:
+		return "prefix SEI"
+	case NALUTypeSuffixSEI:
+		return "suffix SEI"
+	case NALUTypeAP:
+		return "AP"
+	case NALUTypeFU:
+		return "FU"
+	case NALUTypePACI:
+		return "PACI"
+	}
+	return "unknow"
+}
+
+// IsIRAP 是否为IRAP(BLA/IDR/CRA)
+func (t NALUType) IsIRAP() bool {
+	return t >= NALUTypeBLAWLP && t <= NALUTypeCRA
+}
+
+// IsParameterSet 是否为VPS/SPS/PPS
+func (t NALUType) IsParameterSet() bool {
+	return t == NALUTypeVPS || t == NALUTypeSPS || t == NALUTypePPS
+}
+
+// Type 获取NALU类型，NALU header为2字节，类型为第一个字节的第2~7位
+func Type(nalu []byte) NALUType {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return NALUType((nalu[0] >> 1) & 0x3F)
+}
+
+// IsKeyframe NALU列表中是否包含IRAP
+func IsKeyframe(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		if Type(nalu).IsIRAP() {
+			return true
+		}
+	}
+	return false
+}
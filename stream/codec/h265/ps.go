@@ -0,0 +1,650 @@
+package h265
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// ProfileTierLevel profile_tier_level中general部分的字段(ITU-T H.265 7.3.3)
+type ProfileTierLevel struct {
+	ProfileSpace       int
+	Tier               bool
+	ProfileIdc         int
+	CompatibilityFlags uint32
+	// general_progressive_source_flag 开始的48位
+	ConstraintFlags uint64
+	LevelIdc        int
+}
+
+// VPS h265视频参数集中常用的字段(7.3.2.1)
+type VPS struct {
+	ID               int
+	MaxSubLayers     int
+	ProfileTierLevel ProfileTierLevel
+
+	// vps_timing_info，TimingInfoPresent为false时无效
+	TimingInfoPresent bool
+	NumUnitsInTick    uint32
+	TimeScale         uint32
+}
+
+// SPS h265序列参数集中常用的字段(7.3.2.2)
+type SPS struct {
+	VPSID            int
+	MaxSubLayers     int
+	ProfileTierLevel ProfileTierLevel
+	ID               int
+	ChromaFormatIdc  int
+	// 按conformance window裁剪后的宽高
+	Width          int
+	Height         int
+	BitDepthLuma   int
+	BitDepthChroma int
+	// 最高时域层的sps_max_num_reorder_pics，解码顺序和显示顺序最多相差的帧数
+	MaxNumReorderPics int
+
+	// VUI timing_info，TimingInfoPresent为false时无效
+	TimingInfoPresent bool
+	NumUnitsInTick    uint32
+	TimeScale         uint32
+}
+
+// ParseVPS 解析VPS，nalu 包含NALU header
+func ParseVPS(nalu []byte) (*VPS, error) {
+	if Type(nalu) != NALUTypeVPS || len(nalu) < 2 {
+		return nil, fmt.Errorf("h265 nalu type %v is not VPS", Type(nalu))
+	}
+	br := codec.NewBitReader(codec.RemoveEmulationPrevention(nalu[2:]))
+	v := &VPS{}
+
+	// vps_video_parameter_set_id(4) base_layer_internal(1) base_layer_available(1) max_layers_minus1(6)
+	id, err := br.ReadBits(4)
+	if err != nil {
+		return nil, err
+	}
+	v.ID = int(id)
+	if err = br.Skip(8); err != nil {
+		return nil, err
+	}
+	subLayers, err := br.ReadBits(3)
+	if err != nil {
+		return nil, err
+	}
+	v.MaxSubLayers = int(subLayers) + 1
+	// temporal_id_nesting_flag(1) reserved_0xffff_16bits(16)
+	if err = br.Skip(17); err != nil {
+		return nil, err
+	}
+	if err = v.ProfileTierLevel.read(br, v.MaxSubLayers-1); err != nil {
+		return nil, err
+	}
+	if _, err = readSubLayerOrderingInfo(br, v.MaxSubLayers-1); err != nil {
+		return nil, err
+	}
+
+	maxLayerID, err := br.ReadBits(6)
+	if err != nil {
+		return nil, err
+	}
+	numLayerSets, err := readUE(br)
+	if err != nil {
+		return nil, err
+	}
+	// layer_id_included_flag
+	if err = br.Skip(numLayerSets * (int(maxLayerID) + 1)); err != nil {
+		return nil, err
+	}
+	present, err := br.ReadFlag()
+	if err != nil {
+		return nil, err
+	}
+	if present {
+		units, err := br.ReadBits(32)
+		if err != nil {
+			return nil, err
+		}
+		scale, err := br.ReadBits(32)
+		if err != nil {
+			return nil, err
+		}
+		v.TimingInfoPresent = true
+		v.NumUnitsInTick = uint32(units)
+		v.TimeScale = uint32(scale)
+	}
+	return v, nil
+}
+
+// FrameRate 由vps_timing_info得到的标称帧率，没有时返回0
+func (v *VPS) FrameRate() float64 {
+	if !v.TimingInfoPresent || v.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(v.TimeScale) / float64(v.NumUnitsInTick)
+}
+
+// ParseSPS 解析SPS，nalu 包含NALU header
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if Type(nalu) != NALUTypeSPS || len(nalu) < 2 {
+		return nil, fmt.Errorf("h265 nalu type %v is not SPS", Type(nalu))
+	}
+	br := codec.NewBitReader(codec.RemoveEmulationPrevention(nalu[2:]))
+	s := &SPS{}
+
+	id, err := br.ReadBits(4)
+	if err != nil {
+		return nil, err
+	}
+	s.VPSID = int(id)
+	subLayers, err := br.ReadBits(3)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxSubLayers = int(subLayers) + 1
+	// sps_temporal_id_nesting_flag
+	if err = br.Skip(1); err != nil {
+		return nil, err
+	}
+	if err = s.ProfileTierLevel.read(br, s.MaxSubLayers-1); err != nil {
+		return nil, err
+	}
+	if s.ID, err = readUE(br); err != nil {
+		return nil, err
+	}
+	if s.ChromaFormatIdc, err = readUE(br); err != nil {
+		return nil, err
+	}
+	if s.ChromaFormatIdc == 3 {
+		// separate_colour_plane_flag
+		if err = br.Skip(1); err != nil {
+			return nil, err
+		}
+	}
+	if s.Width, err = readUE(br); err != nil {
+		return nil, err
+	}
+	if s.Height, err = readUE(br); err != nil {
+		return nil, err
+	}
+	conformanceWindow, err := br.ReadFlag()
+	if err != nil {
+		return nil, err
+	}
+	if conformanceWindow {
+		var win [4]int
+		for i := range win {
+			if win[i], err = readUE(br); err != nil {
+				return nil, err
+			}
+		}
+		subWidthC, subHeightC := 1, 1
+		switch s.ChromaFormatIdc {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+		s.Width -= subWidthC * (win[0] + win[1])
+		s.Height -= subHeightC * (win[2] + win[3])
+	}
+	if s.Width <= 0 || s.Height <= 0 {
+		return nil, fmt.Errorf("h265 sps invalid size %dx%d", s.Width, s.Height)
+	}
+
+	depth, err := readUE(br)
+	if err != nil {
+		return nil, err
+	}
+	s.BitDepthLuma = depth + 8
+	if depth, err = readUE(br); err != nil {
+		return nil, err
+	}
+	s.BitDepthChroma = depth + 8
+
+	// VUI在SPS较后的位置，之前的字段解析失败时保留已得到的结果
+	_ = s.readToVUI(br)
+	return s, nil
+}
+
+// readToVUI 跳过VUI之前的字段并解析VUI
+func (s *SPS) readToVUI(br *codec.BitReader) error {
+	log2MaxPocLsb, err := readUE(br)
+	if err != nil {
+		return err
+	}
+	log2MaxPocLsb += 4
+	if s.MaxNumReorderPics, err = readSubLayerOrderingInfo(br, s.MaxSubLayers-1); err != nil {
+		return err
+	}
+	// log2_min_luma_coding_block_size_minus3 log2_diff_max_min_luma_coding_block_size
+	// log2_min_luma_transform_block_size_minus2 log2_diff_max_min_luma_transform_block_size
+	// max_transform_hierarchy_depth_inter max_transform_hierarchy_depth_intra
+	for i := 0; i < 6; i++ {
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+	}
+	scalingListEnabled, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if scalingListEnabled {
+		present, err := br.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if present {
+			if err = skipScalingListData(br); err != nil {
+				return err
+			}
+		}
+	}
+	// amp_enabled_flag sample_adaptive_offset_enabled_flag
+	if err = br.Skip(2); err != nil {
+		return err
+	}
+	pcm, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if pcm {
+		// pcm_sample_bit_depth_luma_minus1(4) pcm_sample_bit_depth_chroma_minus1(4)
+		if err = br.Skip(8); err != nil {
+			return err
+		}
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		// pcm_loop_filter_disabled_flag
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+
+	numSets, err := readUE(br)
+	if err != nil {
+		return err
+	}
+	if numSets > 64 {
+		return fmt.Errorf("h265 sps num_short_term_ref_pic_sets %d out of range", numSets)
+	}
+	numDeltaPocs := make([]int, numSets)
+	for i := 0; i < numSets; i++ {
+		if numDeltaPocs[i], err = readShortTermRefPicSet(br, i, numDeltaPocs); err != nil {
+			return err
+		}
+	}
+
+	longTerm, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if longTerm {
+		num, err := readUE(br)
+		if err != nil {
+			return err
+		}
+		// lt_ref_pic_poc_lsb_sps used_by_curr_pic_lt_sps_flag
+		if err = br.Skip(num * (log2MaxPocLsb + 1)); err != nil {
+			return err
+		}
+	}
+	// sps_temporal_mvp_enabled_flag strong_intra_smoothing_enabled_flag
+	if err = br.Skip(2); err != nil {
+		return err
+	}
+	vuiPresent, err := br.ReadFlag()
+	if err != nil || !vuiPresent {
+		return err
+	}
+	return s.readVUI(br)
+}
+
+// readVUI 解析VUI中timing_info及之前的字段(E.2.1)
+func (s *SPS) readVUI(br *codec.BitReader) error {
+	present, err := br.ReadFlag()
+	if err != nil {
+		return err
+	}
+	if present {
+		idc, err := br.ReadBits(8)
+		if err != nil {
+			return err
+		}
+		if idc == 255 {
+			// sar_width sar_height
+			if err = br.Skip(32); err != nil {
+				return err
+			}
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// overscan_appropriate_flag
+		if err = br.Skip(1); err != nil {
+			return err
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// video_format(3) video_full_range_flag(1)
+		if err = br.Skip(4); err != nil {
+			return err
+		}
+		colourDescription, err := br.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if colourDescription {
+			if err = br.Skip(24); err != nil {
+				return err
+			}
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// chroma_sample_loc_type_top_field chroma_sample_loc_type_bottom_field
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+		if _, err = br.ReadUE(); err != nil {
+			return err
+		}
+	}
+	// neutral_chroma_indication_flag field_seq_flag frame_field_info_present_flag
+	if err = br.Skip(3); err != nil {
+		return err
+	}
+	if present, err = br.ReadFlag(); err != nil {
+		return err
+	}
+	if present {
+		// default display window
+		for i := 0; i < 4; i++ {
+			if _, err = br.ReadUE(); err != nil {
+				return err
+			}
+		}
+	}
+	if present, err = br.ReadFlag(); err != nil || !present {
+		return err
+	}
+	units, err := br.ReadBits(32)
+	if err != nil {
+		return err
+	}
+	scale, err := br.ReadBits(32)
+	if err != nil {
+		return err
+	}
+	s.TimingInfoPresent = true
+	s.NumUnitsInTick = uint32(units)
+	s.TimeScale = uint32(scale)
+	return nil
+}
+
+// FrameRate 由VUI timing_info得到的标称帧率，没有时返回0
+func (s *SPS) FrameRate() float64 {
+	if !s.TimingInfoPresent || s.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.TimeScale) / float64(s.NumUnitsInTick)
+}
+
+// read 解析profile_tier_level(1, maxSubLayersMinus1)
+func (p *ProfileTierLevel) read(br *codec.BitReader, maxSubLayersMinus1 int) error {
+	v, err := br.ReadBits(8)
+	if err != nil {
+		return err
+	}
+	p.ProfileSpace = int(v >> 6)
+	p.Tier = v&0x20 != 0
+	p.ProfileIdc = int(v & 0x1F)
+	if v, err = br.ReadBits(32); err != nil {
+		return err
+	}
+	p.CompatibilityFlags = uint32(v)
+	if p.ConstraintFlags, err = br.ReadBits(48); err != nil {
+		return err
+	}
+	if v, err = br.ReadBits(8); err != nil {
+		return err
+	}
+	p.LevelIdc = int(v)
+
+	// sub_layer_profile_present_flag sub_layer_level_present_flag
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i], err = br.ReadFlag(); err != nil {
+			return err
+		}
+		if levelPresent[i], err = br.ReadFlag(); err != nil {
+			return err
+		}
+	}
+	if maxSubLayersMinus1 > 0 {
+		// reserved_zero_2bits
+		if err = br.Skip(2 * (8 - maxSubLayersMinus1)); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			if err = br.Skip(88); err != nil {
+				return err
+			}
+		}
+		if levelPresent[i] {
+			if err = br.Skip(8); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ProfileName profile名称
+func (p *ProfileTierLevel) ProfileName() string {
+	switch p.ProfileIdc {
+	case 1:
+		return "Main"
+	case 2:
+		return "Main 10"
+	case 3:
+		return "Main Still Picture"
+	case 4:
+		return "Range Extensions"
+	case 5:
+		return "High Throughput"
+	case 9:
+		return "Screen Content Coding"
+	}
+	return fmt.Sprintf("Profile %d", p.ProfileIdc)
+}
+
+// LevelName level名称，例如 4.1
+func (p *ProfileTierLevel) LevelName() string {
+	level := p.LevelIdc / 30
+	if sub := p.LevelIdc % 30 / 3; sub != 0 {
+		return fmt.Sprintf("%d.%d", level, sub)
+	}
+	return fmt.Sprintf("%d", level)
+}
+
+// Codec ISO 14496-15 编码字符串，例如 hvc1.1.6.L93.B0
+func (p *ProfileTierLevel) Codec() string {
+	var b strings.Builder
+	b.WriteString("hvc1.")
+	if p.ProfileSpace > 0 {
+		b.WriteByte(byte('A' + p.ProfileSpace - 1))
+	}
+	// 兼容标志按位反序
+	var compat uint32
+	for i := uint(0); i < 32; i++ {
+		if p.CompatibilityFlags&(1<<i) != 0 {
+			compat |= 1 << (31 - i)
+		}
+	}
+	tier := 'L'
+	if p.Tier {
+		tier = 'H'
+	}
+	fmt.Fprintf(&b, "%d.%X.%c%d", p.ProfileIdc, compat, tier, p.LevelIdc)
+	// 约束标志按字节输出，省略末尾为0的字节
+	constraints := make([]byte, 6)
+	for i := range constraints {
+		constraints[i] = byte(p.ConstraintFlags >> uint(40-8*i))
+	}
+	n := len(constraints)
+	for n > 0 && constraints[n-1] == 0 {
+		n--
+	}
+	for _, c := range constraints[:n] {
+		fmt.Fprintf(&b, ".%X", c)
+	}
+	return b.String()
+}
+
+// readSubLayerOrderingInfo 解析sub_layer_ordering_info，返回最高时域层的max_num_reorder_pics
+func readSubLayerOrderingInfo(br *codec.BitReader, maxSubLayersMinus1 int) (int, error) {
+	present, err := br.ReadFlag()
+	if err != nil {
+		return 0, err
+	}
+	count := 1
+	if present {
+		count = maxSubLayersMinus1 + 1
+	}
+	// max_dec_pic_buffering_minus1 max_num_reorder_pics max_latency_increase_plus1
+	reorder := 0
+	for i := 0; i < count*3; i++ {
+		v, err := readUE(br)
+		if err != nil {
+			return 0, err
+		}
+		if i%3 == 1 {
+			reorder = v
+		}
+	}
+	return reorder, nil
+}
+
+// skipScalingListData 跳过scaling_list_data(7.3.4)
+func skipScalingListData(br *codec.BitReader) error {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			predMode, err := br.ReadFlag()
+			if err != nil {
+				return err
+			}
+			if !predMode {
+				// scaling_list_pred_matrix_id_delta
+				if _, err = br.ReadUE(); err != nil {
+					return err
+				}
+				continue
+			}
+			coefNum := 1 << uint(4+sizeID<<1)
+			if coefNum > 64 {
+				coefNum = 64
+			}
+			if sizeID > 1 {
+				// scaling_list_dc_coef_minus8
+				coefNum++
+			}
+			for i := 0; i < coefNum; i++ {
+				if _, err = br.ReadSE(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readShortTermRefPicSet 解析st_ref_pic_set(idx)(7.3.7)，返回NumDeltaPocs[idx]
+func readShortTermRefPicSet(br *codec.BitReader, idx int, numDeltaPocs []int) (int, error) {
+	interPrediction := false
+	if idx != 0 {
+		var err error
+		if interPrediction, err = br.ReadFlag(); err != nil {
+			return 0, err
+		}
+	}
+	if interPrediction {
+		// SPS中delta_idx_minus1不出现，参考前一个集合
+		// delta_rps_sign abs_delta_rps_minus1
+		if err := br.Skip(1); err != nil {
+			return 0, err
+		}
+		if _, err := br.ReadUE(); err != nil {
+			return 0, err
+		}
+		count := 0
+		for j := 0; j <= numDeltaPocs[idx-1]; j++ {
+			used, err := br.ReadFlag()
+			if err != nil {
+				return 0, err
+			}
+			useDelta := true
+			if !used {
+				if useDelta, err = br.ReadFlag(); err != nil {
+					return 0, err
+				}
+			}
+			if used || useDelta {
+				count++
+			}
+		}
+		return count, nil
+	}
+
+	negative, err := readUE(br)
+	if err != nil {
+		return 0, err
+	}
+	positive, err := readUE(br)
+	if err != nil {
+		return 0, err
+	}
+	if negative > 16 || positive > 16 {
+		return 0, fmt.Errorf("h265 st_ref_pic_set too many pictures")
+	}
+	// delta_poc_sX_minus1 used_by_curr_pic_sX_flag
+	for i := 0; i < negative+positive; i++ {
+		if _, err = br.ReadUE(); err != nil {
+			return 0, err
+		}
+		if err = br.Skip(1); err != nil {
+			return 0, err
+		}
+	}
+	return negative + positive, nil
+}
+
+// readUE 读取ue(v)并转换为int，限制取值范围避免溢出
+func readUE(br *codec.BitReader) (int, error) {
+	v, err := br.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if v > 1<<20 {
+		return 0, fmt.Errorf("h265 parameter set value %d out of range", v)
+	}
+	return int(v), nil
+}
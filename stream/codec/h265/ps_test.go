@@ -0,0 +1,87 @@
+package h265
+
+import (
+	"testing"
+)
+
+// 1920x1080 Main@L4 30fps
+var (
+	testVPS = []byte{0x40, 0x01, 0x0c, 0x01, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00,
+		0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x78, 0x99, 0x98, 0x09}
+	testSPS = []byte{0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00,
+		0x00, 0x03, 0x00, 0x78, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5, 0x96, 0x66, 0x69, 0x24, 0xca, 0xe0,
+		0x10, 0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x01, 0xe0, 0x80}
+	testPTL = ProfileTierLevel{ProfileIdc: 1, CompatibilityFlags: 0x60000000,
+		ConstraintFlags: 0x900000000000, LevelIdc: 120}
+)
+
+func TestParseVPS(t *testing.T) {
+	vps, err := ParseVPS(testVPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := VPS{MaxSubLayers: 1, ProfileTierLevel: testPTL}
+	if *vps != want {
+		t.Errorf("got %+v, want %+v", *vps, want)
+	}
+	if r := vps.FrameRate(); r != 0 {
+		t.Errorf("frame rate %v, want 0", r)
+	}
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(testSPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SPS{MaxSubLayers: 1, ProfileTierLevel: testPTL, ChromaFormatIdc: 1, Width: 1920, Height: 1080,
+		BitDepthLuma: 8, BitDepthChroma: 8, MaxNumReorderPics: 2, TimingInfoPresent: true, NumUnitsInTick: 1, TimeScale: 30}
+	if *sps != want {
+		t.Errorf("got %+v, want %+v", *sps, want)
+	}
+	if r := sps.FrameRate(); r != 30 {
+		t.Errorf("frame rate %v, want 30", r)
+	}
+}
+
+func TestProfileTierLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		ptl     ProfileTierLevel
+		profile string
+		level   string
+		codec   string
+	}{
+		{"main l4", testPTL, "Main", "4", "hvc1.1.6.L120.90"},
+		{"main l3.1", ProfileTierLevel{ProfileIdc: 1, CompatibilityFlags: 0x60000000,
+			ConstraintFlags: 0xb00000000000, LevelIdc: 93}, "Main", "3.1", "hvc1.1.6.L93.B0"},
+		{"main10 high tier", ProfileTierLevel{ProfileIdc: 2, Tier: true, CompatibilityFlags: 0x20000000,
+			LevelIdc: 153}, "Main 10", "5.1", "hvc1.2.4.H153"},
+		{"profile space", ProfileTierLevel{ProfileSpace: 1, ProfileIdc: 7, LevelIdc: 90}, "Profile 7", "3", "hvc1.A7.0.L90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p := tt.ptl.ProfileName(); p != tt.profile {
+				t.Errorf("profile %q, want %q", p, tt.profile)
+			}
+			if l := tt.ptl.LevelName(); l != tt.level {
+				t.Errorf("level %q, want %q", l, tt.level)
+			}
+			if c := tt.ptl.Codec(); c != tt.codec {
+				t.Errorf("codec %q, want %q", c, tt.codec)
+			}
+		})
+	}
+}
+
+func TestParsePSErrors(t *testing.T) {
+	if _, err := ParseVPS(testSPS); err == nil {
+		t.Errorf("vps: expected error for sps input")
+	}
+	if _, err := ParseSPS(testVPS); err == nil {
+		t.Errorf("sps: expected error for vps input")
+	}
+	if _, err := ParseSPS(testSPS[:10]); err == nil {
+		t.Errorf("sps: expected error for truncated input")
+	}
+}
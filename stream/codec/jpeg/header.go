@@ -0,0 +1,217 @@
+package jpeg
+
+import "fmt"
+
+// 标记
+const (
+	MarkerSOI  = 0xD8
+	MarkerEOI  = 0xD9
+	MarkerSOF0 = 0xC0
+	MarkerDHT  = 0xC4
+	MarkerDQT  = 0xDB
+	MarkerDRI  = 0xDD
+	MarkerSOS  = 0xDA
+)
+
+// Header 重建JPEG头所需的参数，对应RTP/JPEG头(RFC 2435)
+type Header struct {
+	// Type 0为YUV 4:2:2，1为YUV 4:2:0，不含重同步标记位(64~127)
+	Type   int
+	Width  int
+	Height int
+	// RestartInterval 重同步间隔(MCU数)，0表示不使用
+	RestartInterval int
+	// QuantTables 按zigzag顺序的量化表，8位精度时每个64字节，16位精度时每个128字节
+	QuantTables [][]byte
+}
+
+// luma/chroma 量化表(zigzag顺序)，RFC 2435 Appendix A
+var (
+	lumaQuantizer = []int{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	}
+	chromaQuantizer = []int{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// 标准huffman表(ISO 10918-1 K.3)，RFC 2435 Appendix B
+var (
+	lumaDCCodeLens = []byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0}
+	lumaDCSymbols  = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	lumaACCodeLens = []byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 0x7d}
+	lumaACSymbols  = []byte{
+		0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+		0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+		0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+		0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+		0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+		0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+		0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+		0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+		0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+		0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+		0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+		0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+		0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+		0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+		0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+		0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+		0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+		0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+		0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+		0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+		0xf9, 0xfa,
+	}
+	chromaDCCodeLens = []byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0}
+	chromaDCSymbols  = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	chromaACCodeLens = []byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 0x77}
+	chromaACSymbols  = []byte{
+		0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+		0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+		0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+		0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+		0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+		0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+		0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+		0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+		0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+		0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+		0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+		0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+		0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+		0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+		0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+		0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+		0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+		0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+		0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+		0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+		0xf9, 0xfa,
+	}
+)
+
+// MakeQuantTables 根据Q(1~99)生成亮度和色度量化表，RFC 2435 Appendix A
+func MakeQuantTables(q int) [][]byte {
+	factor := q
+	if factor < 1 {
+		factor = 1
+	}
+	if factor > 99 {
+		factor = 99
+	}
+	if q < 50 {
+		q = 5000 / factor
+	} else {
+		q = 200 - factor*2
+	}
+	luma := make([]byte, 64)
+	chroma := make([]byte, 64)
+	for i := 0; i < 64; i++ {
+		luma[i] = clampQuant((lumaQuantizer[i]*q + 50) / 100)
+		chroma[i] = clampQuant((chromaQuantizer[i]*q + 50) / 100)
+	}
+	return [][]byte{luma, chroma}
+}
+
+func clampQuant(v int) byte {
+	if v < 1 {
+		return 1
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
+
+// Marshal 生成从SOI到SOS的JPEG头，其后为熵编码数据和EOI
+func (h *Header) Marshal() ([]byte, error) {
+	if h.Width <= 0 || h.Width > 0xFFFF || h.Height <= 0 || h.Height > 0xFFFF {
+		return nil, fmt.Errorf("invalid jpeg size %dx%d", h.Width, h.Height)
+	}
+	var lumaSampling byte
+	switch h.Type {
+	case 0:
+		lumaSampling = 0x21
+	case 1:
+		lumaSampling = 0x22
+	default:
+		return nil, fmt.Errorf("unsupported jpeg type %d", h.Type)
+	}
+	if len(h.QuantTables) == 0 || len(h.QuantTables) > 4 {
+		return nil, fmt.Errorf("invalid jpeg quant table count %d", len(h.QuantTables))
+	}
+
+	b := []byte{0xFF, MarkerSOI}
+	for i, table := range h.QuantTables {
+		var precision byte
+		switch len(table) {
+		case 64:
+		case 128:
+			precision = 1
+		default:
+			return nil, fmt.Errorf("invalid jpeg quant table size %d", len(table))
+		}
+		b = appendSegment(b, MarkerDQT, append([]byte{precision<<4 | byte(i)}, table...))
+	}
+	if h.RestartInterval > 0 {
+		b = appendSegment(b, MarkerDRI, []byte{byte(h.RestartInterval >> 8), byte(h.RestartInterval)})
+	}
+
+	// 色度分量使用第二个量化表，只有一个时共用
+	chromaTable := byte(0)
+	if len(h.QuantTables) > 1 {
+		chromaTable = 1
+	}
+	b = appendSegment(b, MarkerSOF0, []byte{
+		8, byte(h.Height >> 8), byte(h.Height), byte(h.Width >> 8), byte(h.Width),
+		3,
+		0, lumaSampling, 0,
+		1, 0x11, chromaTable,
+		2, 0x11, chromaTable,
+	})
+
+	b = appendHuffmanTable(b, 0x00, lumaDCCodeLens, lumaDCSymbols)
+	b = appendHuffmanTable(b, 0x10, lumaACCodeLens, lumaACSymbols)
+	b = appendHuffmanTable(b, 0x01, chromaDCCodeLens, chromaDCSymbols)
+	b = appendHuffmanTable(b, 0x11, chromaACCodeLens, chromaACSymbols)
+
+	b = appendSegment(b, MarkerSOS, []byte{
+		3,
+		0, 0x00,
+		1, 0x11,
+		2, 0x11,
+		0, 63, 0,
+	})
+	return b, nil
+}
+
+// appendHuffmanTable 写入一个DHT，class 高4位为表类型(0为DC，1为AC)，低4位为表号
+func appendHuffmanTable(b []byte, class byte, codeLens, symbols []byte) []byte {
+	data := make([]byte, 0, 1+len(codeLens)+len(symbols))
+	data = append(data, class)
+	data = append(data, codeLens...)
+	data = append(data, symbols...)
+	return appendSegment(b, MarkerDHT, data)
+}
+
+// appendSegment 写入标记和带长度的数据段
+func appendSegment(b []byte, marker byte, data []byte) []byte {
+	length := len(data) + 2
+	b = append(b, 0xFF, marker, byte(length>>8), byte(length))
+	return append(b, data...)
+}
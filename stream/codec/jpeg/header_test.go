@@ -0,0 +1,88 @@
+package jpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// encodeTestImage 用标准库编码一张4:2:0的图片，返回DQT中的量化表和熵编码数据
+func encodeTestImage(t *testing.T, width, height, quality int) ([][]byte, []byte) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x + y), 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()[2:]
+	var tables [][]byte
+	for len(b) >= 4 {
+		marker, length := b[1], int(b[2])<<8|int(b[3])
+		segment := b[4 : 2+length]
+		b = b[2+length:]
+		switch marker {
+		case MarkerDQT:
+			for len(segment) >= 65 {
+				tables = append(tables, segment[1:65])
+				segment = segment[65:]
+			}
+		case MarkerSOS:
+			return tables, b
+		}
+	}
+	t.Fatal("sos not found")
+	return nil, nil
+}
+
+func TestMakeQuantTables(t *testing.T) {
+	for _, q := range []int{10, 50, 75, 99} {
+		want, _ := encodeTestImage(t, 16, 16, q)
+		got := MakeQuantTables(q)
+		if len(got) != 2 || !bytes.Equal(got[0], want[0]) || !bytes.Equal(got[1], want[1]) {
+			t.Errorf("q=%d: quant tables differ from the standard library", q)
+		}
+	}
+}
+
+func TestHeaderMarshal(t *testing.T) {
+	tables, scan := encodeTestImage(t, 64, 48, 50)
+	header := &Header{Type: 1, Width: 64, Height: 48, QuantTables: tables}
+	b, err := header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(append(b, scan...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("decoded size %v", img.Bounds())
+	}
+	if ycbcr, ok := img.(*image.YCbCr); !ok || ycbcr.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		t.Errorf("decoded image is not 4:2:0")
+	}
+
+	header.RestartInterval = 4
+	b, _ = header.Marshal()
+	if !bytes.Contains(b, []byte{0xFF, MarkerDRI, 0x00, 0x04, 0x00, 0x04}) {
+		t.Error("DRI segment missing")
+	}
+
+	for _, h := range []*Header{
+		{Type: 0, Width: 0, Height: 48, QuantTables: tables},
+		{Type: 2, Width: 64, Height: 48, QuantTables: tables},
+		{Type: 0, Width: 64, Height: 48},
+		{Type: 0, Width: 64, Height: 48, QuantTables: [][]byte{make([]byte, 10)}},
+	} {
+		if _, err := h.Marshal(); err == nil {
+			t.Errorf("%+v: expected error", h)
+		}
+	}
+}
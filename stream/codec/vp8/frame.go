@@ -0,0 +1,25 @@
+package vp8
+
+import "fmt"
+
+// IsKeyframe frame tag 第0位为0表示关键帧(RFC 6386 9.1)
+func IsKeyframe(frame []byte) bool {
+	return len(frame) >= 3 && frame[0]&0x01 == 0
+}
+
+// FrameSize 关键帧中的宽高，非关键帧不携带
+func FrameSize(frame []byte) (width, height int, err error) {
+	if !IsKeyframe(frame) {
+		return 0, 0, fmt.Errorf("vp8 frame is not a keyframe")
+	}
+	// frame tag(3) start code(3) width(2) height(2)，宽高低14位有效
+	if len(frame) < 10 {
+		return 0, 0, fmt.Errorf("vp8 keyframe header too short")
+	}
+	if frame[3] != 0x9D || frame[4] != 0x01 || frame[5] != 0x2A {
+		return 0, 0, fmt.Errorf("vp8 keyframe start code mismatch")
+	}
+	width = (int(frame[6]) | int(frame[7])<<8) & 0x3FFF
+	height = (int(frame[8]) | int(frame[9])<<8) & 0x3FFF
+	return width, height, nil
+}
@@ -0,0 +1,30 @@
+package vp8
+
+import "testing"
+
+func TestFrameSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		frame         []byte
+		keyframe      bool
+		width, height int
+		err           bool
+	}{
+		{"keyframe", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00}, true, 320, 240, false},
+		{"scaling bits ignored", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x47, 0x38, 0x44}, true, 1920, 1080, false},
+		{"interframe", []byte{0x31, 0x02, 0x00, 0x00}, false, 0, 0, true},
+		{"start code mismatch", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2b, 0x40, 0x01, 0xf0, 0x00}, true, 0, 0, true},
+		{"truncated", []byte{0x10, 0x02, 0x00, 0x9d}, true, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if IsKeyframe(tt.frame) != tt.keyframe {
+				t.Errorf("IsKeyframe = %v", !tt.keyframe)
+			}
+			width, height, err := FrameSize(tt.frame)
+			if (err != nil) != tt.err || width != tt.width || height != tt.height {
+				t.Errorf("FrameSize = %dx%d, %v", width, height, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package vp9
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// Header vp9 uncompressed header 中的部分字段
+type Header struct {
+	Profile           int
+	ShowExistingFrame bool
+	Keyframe          bool
+	ShowFrame         bool
+	// Width Height 只在关键帧中解析
+	Width  int
+	Height int
+}
+
+// ParseHeader 解析一帧的uncompressed header(VP9 Bitstream Specification 6.2)
+func ParseHeader(frame []byte) (*Header, error) {
+	br := codec.NewBitReader(frame)
+	h := &Header{}
+
+	marker, err := br.ReadBits(2)
+	if err != nil {
+		return nil, err
+	}
+	if marker != 2 {
+		return nil, fmt.Errorf("vp9 frame marker mismatch")
+	}
+	low, err := br.ReadBits(1)
+	if err != nil {
+		return nil, err
+	}
+	high, err := br.ReadBits(1)
+	if err != nil {
+		return nil, err
+	}
+	h.Profile = int(high<<1 | low)
+	if h.Profile == 3 {
+		if err = br.Skip(1); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.ShowExistingFrame, err = br.ReadFlag(); err != nil {
+		return nil, err
+	}
+	if h.ShowExistingFrame {
+		return h, nil
+	}
+	// frame_type 0为KEY_FRAME
+	frameType, err := br.ReadBits(1)
+	if err != nil {
+		return nil, err
+	}
+	h.Keyframe = frameType == 0
+	if h.ShowFrame, err = br.ReadFlag(); err != nil {
+		return nil, err
+	}
+	// error_resilient_mode
+	if err = br.Skip(1); err != nil {
+		return nil, err
+	}
+	if !h.Keyframe {
+		return h, nil
+	}
+
+	syncCode, err := br.ReadBits(24)
+	if err != nil {
+		return nil, err
+	}
+	if syncCode != 0x498342 {
+		return nil, fmt.Errorf("vp9 frame sync code mismatch")
+	}
+	if err = h.skipColorConfig(br); err != nil {
+		return nil, err
+	}
+	width, err := br.ReadBits(16)
+	if err != nil {
+		return nil, err
+	}
+	height, err := br.ReadBits(16)
+	if err != nil {
+		return nil, err
+	}
+	h.Width = int(width) + 1
+	h.Height = int(height) + 1
+	return h, nil
+}
+
+// skipColorConfig 跳过color_config
+func (h *Header) skipColorConfig(br *codec.BitReader) error {
+	if h.Profile >= 2 {
+		// ten_or_twelve_bit
+		if err := br.Skip(1); err != nil {
+			return err
+		}
+	}
+	colorSpace, err := br.ReadBits(3)
+	if err != nil {
+		return err
+	}
+	// 7为CS_RGB
+	if colorSpace != 7 {
+		// color_range [subsampling_x subsampling_y reserved_zero]
+		n := 1
+		if h.Profile == 1 || h.Profile == 3 {
+			n += 3
+		}
+		return br.Skip(n)
+	}
+	if h.Profile == 1 || h.Profile == 3 {
+		// reserved_zero
+		return br.Skip(1)
+	}
+	return nil
+}
+
+// IsKeyframe 帧或超帧中的第一帧是否为关键帧
+func IsKeyframe(frame []byte) bool {
+	frames := SplitSuperframe(frame)
+	if len(frames) == 0 {
+		return false
+	}
+	h, err := ParseHeader(frames[0])
+	return err == nil && h.Keyframe
+}
+
+// SplitSuperframe 按超帧索引(Annex B)拆分为多帧，不是超帧时原样返回
+func SplitSuperframe(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	// 超帧索引: marker(0b110 bytes_per_framesize_minus_1(2) frames_in_superframe_minus_1(3)) sizes marker
+	last := data[len(data)-1]
+	if last&0xE0 != 0xC0 {
+		return [][]byte{data}
+	}
+	count := int(last&0x07) + 1
+	mag := int(last>>3&0x03) + 1
+	indexSize := 2 + mag*count
+	if len(data) < indexSize || data[len(data)-indexSize] != last {
+		return [][]byte{data}
+	}
+
+	index := data[len(data)-indexSize+1:]
+	payload := data[:len(data)-indexSize]
+	frames := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		size := 0
+		for j := 0; j < mag; j++ {
+			size |= int(index[i*mag+j]) << uint(8*j)
+		}
+		if size > len(payload) {
+			return [][]byte{data}
+		}
+		frames = append(frames, payload[:size])
+		payload = payload[size:]
+	}
+	return frames
+}
+
+// JoinSuperframe 将多帧(最多8帧)合并为超帧，只有一帧时原样返回
+func JoinSuperframe(frames [][]byte) []byte {
+	if len(frames) == 0 || len(frames) > 8 {
+		return nil
+	}
+	if len(frames) == 1 {
+		return frames[0]
+	}
+	maxSize := 0
+	total := 0
+	for _, frame := range frames {
+		if len(frame) > maxSize {
+			maxSize = len(frame)
+		}
+		total += len(frame)
+	}
+	mag := 1
+	for ; mag < 4 && maxSize >= 1<<uint(8*mag); mag++ {
+	}
+	marker := byte(0xC0 | (mag-1)<<3 | (len(frames) - 1))
+
+	b := make([]byte, 0, total+2+mag*len(frames))
+	for _, frame := range frames {
+		b = append(b, frame...)
+	}
+	b = append(b, marker)
+	for _, frame := range frames {
+		for j := 0; j < mag; j++ {
+			b = append(b, byte(len(frame)>>uint(8*j)))
+		}
+	}
+	return append(b, marker)
+}
@@ -0,0 +1,93 @@
+package vp9
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// testKeyframe profile 0的关键帧头，宽高为 width x height
+func testKeyframe(width, height int) []byte {
+	w := &codec.BitWriter{}
+	// frame_marker profile_low profile_high show_existing_frame frame_type show_frame error_resilient_mode
+	w.WriteBits(0x82, 8)
+	w.WriteBits(0x498342, 24)
+	// color_space=BT.601 color_range
+	w.WriteBits(1, 3)
+	w.WriteBits(0, 1)
+	w.WriteBits(uint64(width-1), 16)
+	w.WriteBits(uint64(height-1), 16)
+	return append(w.Bytes(), 0xAA, 0xBB)
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  Header
+		err   bool
+	}{
+		{"keyframe", testKeyframe(1280, 720), Header{Keyframe: true, ShowFrame: true, Width: 1280, Height: 720}, false},
+		{"interframe", []byte{0x86, 0x00}, Header{ShowFrame: true}, false},
+		{"profile 1 interframe", []byte{0xa6, 0x00}, Header{Profile: 1, ShowFrame: true}, false},
+		{"show existing frame", []byte{0x88}, Header{ShowExistingFrame: true}, false},
+		{"frame marker mismatch", []byte{0x42, 0x00}, Header{}, true},
+		{"sync code mismatch", []byte{0x82, 0x49, 0x83, 0x43, 0x00, 0x00, 0x00, 0x00, 0x00}, Header{}, true},
+		{"truncated keyframe", testKeyframe(1280, 720)[:5], Header{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ParseHeader(tt.frame)
+			if tt.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *h != tt.want {
+				t.Errorf("got %+v, want %+v", *h, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuperframe(t *testing.T) {
+	key := testKeyframe(640, 360)
+	large := append([]byte{0x86}, make([]byte, 300)...)
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"single", [][]byte{key}},
+		{"two frames", [][]byte{key, {0x86, 0x01}}},
+		{"two byte sizes", [][]byte{{0x86, 0x02}, large}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := JoinSuperframe(tt.frames)
+			frames := SplitSuperframe(data)
+			if len(frames) != len(tt.frames) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(tt.frames))
+			}
+			for i := range frames {
+				if !bytes.Equal(frames[i], tt.frames[i]) {
+					t.Errorf("frame %d mismatch", i)
+				}
+			}
+			if IsKeyframe(data) != bytes.Equal(tt.frames[0], key) {
+				t.Errorf("IsKeyframe = %v", IsKeyframe(data))
+			}
+		})
+	}
+	if JoinSuperframe(make([][]byte, 9)) != nil {
+		t.Error("more than 8 frames should not be joined")
+	}
+	// 索引中的长度超出数据时原样返回
+	if frames := SplitSuperframe([]byte{0x86, 0x00, 0xc1, 0x05, 0x01, 0xc1}); len(frames) != 1 {
+		t.Errorf("invalid index split into %d frames", len(frames))
+	}
+}
@@ -0,0 +1,138 @@
+package flv
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// tag类型
+const (
+	TagTypeAudio  = 8
+	TagTypeVideo  = 9
+	TagTypeScript = 18
+)
+
+// VideoCodec flv中的视频编码
+type VideoCodec int
+
+const (
+	// VideoCodecH264 使用传统的AVC封装，CodecID为7
+	VideoCodecH264 VideoCodec = iota
+	// VideoCodecH265 使用Enhanced RTMP的扩展视频头，FourCC为hvc1
+	VideoCodecH265
+)
+
+// Enhanced RTMP 的 PacketType
+const (
+	exPacketTypeSequenceStart = 0
+	exPacketTypeCodedFrames   = 1
+)
+
+// Header 文件头和第一个PreviousTagSize
+func Header(hasVideo, hasAudio bool) []byte {
+	var flags byte
+	if hasAudio {
+		flags |= 0x04
+	}
+	if hasVideo {
+		flags |= 0x01
+	}
+	return []byte{'F', 'L', 'V', 0x01, flags, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}
+}
+
+// Tag 一个tag及其后的PreviousTagSize，timestamp 为毫秒
+func Tag(typ uint8, timestamp uint32, data []byte) []byte {
+	b := make([]byte, 11, 11+len(data)+4)
+	b[0] = typ
+	b[1], b[2], b[3] = byte(len(data)>>16), byte(len(data)>>8), byte(len(data))
+	b[4], b[5], b[6] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	// TimestampExtended 为高8位
+	b[7] = byte(timestamp >> 24)
+	b = append(b, data...)
+	return appendUint32(b, uint32(11+len(data)))
+}
+
+// VideoSequenceHeader 视频序列头，config 为AVC或HEVC的DecoderConfigurationRecord
+func VideoSequenceHeader(codec VideoCodec, config []byte) []byte {
+	if codec == VideoCodecH265 {
+		b := []byte{0x80 | 1<<4 | exPacketTypeSequenceStart, 'h', 'v', 'c', '1'}
+		return append(b, config...)
+	}
+	b := []byte{1<<4 | 7, 0, 0, 0, 0}
+	return append(b, config...)
+}
+
+// VideoFrame 视频帧，data 为4字节长度前缀的NALU，cts 为PTS与DTS的差(毫秒)
+func VideoFrame(codec VideoCodec, keyframe bool, cts int32, data []byte) []byte {
+	frameType := byte(2)
+	if keyframe {
+		frameType = 1
+	}
+	var b []byte
+	if codec == VideoCodecH265 {
+		b = []byte{0x80 | frameType<<4 | exPacketTypeCodedFrames, 'h', 'v', 'c', '1', byte(cts >> 16), byte(cts >> 8), byte(cts)}
+	} else {
+		b = []byte{frameType<<4 | 7, 1, byte(cts >> 16), byte(cts >> 8), byte(cts)}
+	}
+	return append(b, data...)
+}
+
+// aacSoundHeader SoundFormat为10(AAC)，44kHz、16位、立体声，aac的实际参数由序列头决定
+const aacSoundHeader = 0xAF
+
+// AudioSequenceHeader aac的序列头，config 为AudioSpecificConfig
+func AudioSequenceHeader(config []byte) []byte {
+	return append([]byte{aacSoundHeader, 0}, config...)
+}
+
+// AudioFrame 不带ADTS头的aac帧
+func AudioFrame(data []byte) []byte {
+	return append([]byte{aacSoundHeader, 1}, data...)
+}
+
+// Property onMetaData中的一项，Value 为 float64、bool 或 string
+type Property struct {
+	Name  string
+	Value interface{}
+}
+
+// MetaData onMetaData脚本数据，AMF0编码
+func MetaData(properties []Property) []byte {
+	b := []byte{0x02}
+	b = appendString(b, "onMetaData")
+	// ECMA array
+	b = append(b, 0x08)
+	b = appendUint32(b, uint32(len(properties)))
+	for _, p := range properties {
+		b = appendString(b, p.Name)
+		switch v := p.Value.(type) {
+		case float64:
+			b = append(b, 0x00, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+		case bool:
+			if v {
+				b = append(b, 0x01, 1)
+			} else {
+				b = append(b, 0x01, 0)
+			}
+		case string:
+			b = append(b, 0x02)
+			b = appendString(b, v)
+		default:
+			// 不支持的类型写为null
+			b = append(b, 0x05)
+		}
+	}
+	// object end
+	return append(b, 0x00, 0x00, 0x09)
+}
+
+// appendString AMF0字符串，不含类型标记
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
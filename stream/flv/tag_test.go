@@ -0,0 +1,101 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		video    bool
+		audio    bool
+		expected string
+	}{
+		{"video and audio", true, true, "464c56010500000009" + "00000000"},
+		{"video", true, false, "464c56010100000009" + "00000000"},
+		{"audio", false, true, "464c56010400000009" + "00000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(Header(tt.video, tt.audio)); got != tt.expected {
+				t.Errorf("header %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTag(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       uint8
+		timestamp uint32
+		data      []byte
+		expected  string
+	}{
+		{"video", TagTypeVideo, 40, []byte{0x17, 0x01}, "0900000200002800000000" + "1701" + "0000000d"},
+		// 超过24位的时间戳高8位写在 TimestampExtended
+		{"extended timestamp", TagTypeAudio, 0x12345678, []byte{0xAF}, "0800000134567812000000" + "af" + "0000000c"},
+		{"empty", TagTypeScript, 0, nil, "1200000000000000000000" + "0000000b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// tag头11字节，之后为数据和PreviousTagSize
+			if got := hex.EncodeToString(Tag(tt.typ, tt.timestamp, tt.data)); got != tt.expected {
+				t.Errorf("tag %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVideoTags(t *testing.T) {
+	config := []byte{0x01, 0x42, 0xC0, 0x1F}
+	nalu := []byte{0x00, 0x00, 0x00, 0x02, 0x65, 0x88}
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"avc sequence header", VideoSequenceHeader(VideoCodecH264, config), "1700000000" + "0142c01f"},
+		{"hevc sequence header", VideoSequenceHeader(VideoCodecH265, config), "9068766331" + "0142c01f"},
+		{"avc keyframe", VideoFrame(VideoCodecH264, true, 80, nalu), "1701000050" + "000000026588"},
+		{"avc inter frame negative cts", VideoFrame(VideoCodecH264, false, -40, nalu), "2701ffffd8" + "000000026588"},
+		{"hevc keyframe", VideoFrame(VideoCodecH265, true, 0, nalu), "9168766331000000" + "000000026588"},
+		{"hevc inter frame", VideoFrame(VideoCodecH265, false, 40, nalu), "a168766331000028" + "000000026588"},
+		{"aac sequence header", AudioSequenceHeader([]byte{0x12, 0x10}), "af00" + "1210"},
+		{"aac frame", AudioFrame([]byte{0x21, 0x00}), "af01" + "2100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(tt.data); got != tt.expected {
+				t.Errorf("data %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMetaData(t *testing.T) {
+	b := MetaData([]Property{
+		{Name: "width", Value: float64(1920)},
+		{Name: "stereo", Value: true},
+		{Name: "mono", Value: false},
+		{Name: "encoder", Value: "go"},
+		{Name: "x", Value: 1},
+	})
+	want := "02000a" + hex.EncodeToString([]byte("onMetaData")) +
+		"0800000005" +
+		"0005" + hex.EncodeToString([]byte("width")) + "00409e000000000000" +
+		"0006" + hex.EncodeToString([]byte("stereo")) + "0101" +
+		"0004" + hex.EncodeToString([]byte("mono")) + "0100" +
+		"0007" + hex.EncodeToString([]byte("encoder")) + "020002" + hex.EncodeToString([]byte("go")) +
+		// 不支持的类型写为null
+		"0001" + hex.EncodeToString([]byte("x")) + "05" +
+		"000009"
+	if got := hex.EncodeToString(b); got != want {
+		t.Errorf("metadata %s, want %s", got, want)
+	}
+	if empty := MetaData(nil); !bytes.HasSuffix(empty, []byte{0x08, 0, 0, 0, 0, 0, 0, 9}) {
+		t.Errorf("empty metadata %x", empty)
+	}
+}
@@ -0,0 +1,84 @@
+package fmp4
+
+// TrackBuffer 缓存一个轨道的样本，每个样本的时长由下一个样本的解码时间确定
+// 解码时间的单位为轨道的 TimeScale
+type TrackBuffer struct {
+	ID int
+
+	// pending 尚未确定时长的最后一个样本
+	pending      *Sample
+	pendingDTS   int64
+	lastDuration uint32
+	samples      []*Sample
+	baseTime     int64
+	endTime      int64
+	hasEnd       bool
+}
+
+// NewTrackBuffer id为轨道ID
+func NewTrackBuffer(id int) *TrackBuffer {
+	return &TrackBuffer{ID: id}
+}
+
+// Push 加入一个解码时间为dts的样本，同时确定上一个样本的时长，dts不大于上一个样本时顺延
+func (b *TrackBuffer) Push(dts int64, sample *Sample) {
+	if b.pending != nil && dts <= b.pendingDTS {
+		sample.PTSOffset -= int32(b.pendingDTS + 1 - dts)
+		dts = b.pendingDTS + 1
+	}
+	b.End(dts)
+	b.pending, b.pendingDTS = sample, dts
+}
+
+// End 已知下一个样本的解码时间，确定最后一个样本的时长，如分段在此结束
+func (b *TrackBuffer) End(dts int64) {
+	if b.pending == nil {
+		return
+	}
+	b.pending.Duration = uint32(dts - b.pendingDTS)
+	b.lastDuration = b.pending.Duration
+	b.appendPending()
+}
+
+// Close 最后一个样本的时长沿用上一个样本
+func (b *TrackBuffer) Close() {
+	if b.pending == nil {
+		return
+	}
+	b.pending.Duration = b.lastDuration
+	b.appendPending()
+}
+
+func (b *TrackBuffer) appendPending() {
+	if len(b.samples) == 0 {
+		b.baseTime = b.pendingDTS
+	}
+	b.samples = append(b.samples, b.pending)
+	b.endTime, b.hasEnd = b.pendingDTS+int64(b.pending.Duration), true
+	b.pending = nil
+}
+
+// Pending 是否有尚未确定时长的样本
+func (b *TrackBuffer) Pending() bool {
+	return b.pending != nil
+}
+
+// Len 已确定时长的样本数
+func (b *TrackBuffer) Len() int {
+	return len(b.samples)
+}
+
+// EndTime 已确定时长的最后一个样本的结束时间，还没有样本时返回false
+func (b *TrackBuffer) EndTime() (int64, bool) {
+	return b.endTime, b.hasEnd
+}
+
+// Fragment 取出已确定时长的样本，没有时返回nil
+func (b *TrackBuffer) Fragment() *TrackFragment {
+	if len(b.samples) == 0 {
+		return nil
+	}
+	fragment := &TrackFragment{ID: b.ID, BaseTime: uint64(b.baseTime), Samples: b.samples}
+	b.samples = nil
+	return fragment
+}
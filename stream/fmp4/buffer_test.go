@@ -0,0 +1,86 @@
+package fmp4
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrackBuffer(t *testing.T) {
+	type push struct {
+		dts       int64
+		ptsOffset int32
+	}
+	tests := []struct {
+		name       string
+		pushes     []push
+		end        int64
+		close      bool
+		baseTime   uint64
+		durations  []uint32
+		ptsOffsets []int32
+		endTime    int64
+	}{
+		{"end", []push{{1000, 0}, {4000, 0}, {7000, 0}}, 9000, false, 1000, []uint32{3000, 3000, 2000}, []int32{0, 0, 0}, 9000},
+		{"close", []push{{0, 0}, {3000, 0}, {6000, 0}}, -1, true, 0, []uint32{3000, 3000, 3000}, []int32{0, 0, 0}, 9000},
+		{"pending", []push{{0, 0}, {3000, 0}}, -1, false, 0, []uint32{3000}, []int32{0}, 3000},
+		// 解码时间不增加时顺延，展示时间不变
+		{"same dts", []push{{0, 0}, {0, 3000}, {3000, 0}}, 6000, false, 0, []uint32{1, 2999, 3000}, []int32{0, 2999, 0}, 6000},
+		{"backwards dts", []push{{1000, 0}, {500, 0}}, 2000, false, 1000, []uint32{1, 999}, []int32{0, -501}, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTrackBuffer(5)
+			if _, ok := b.EndTime(); ok || b.Fragment() != nil {
+				t.Fatal("empty buffer has samples")
+			}
+			for _, p := range tt.pushes {
+				b.Push(p.dts, &Sample{PTSOffset: p.ptsOffset})
+			}
+			if tt.end >= 0 {
+				b.End(tt.end)
+			}
+			if tt.close {
+				b.Close()
+			}
+			if b.Len() != len(tt.durations) {
+				t.Errorf("len %d, want %d", b.Len(), len(tt.durations))
+			}
+			if end, ok := b.EndTime(); !ok || end != tt.endTime {
+				t.Errorf("end time %d %v, want %d", end, ok, tt.endTime)
+			}
+			fragment := b.Fragment()
+			if fragment.ID != 5 || fragment.BaseTime != tt.baseTime {
+				t.Errorf("fragment id %d base %d", fragment.ID, fragment.BaseTime)
+			}
+			var durations []uint32
+			var offsets []int32
+			for _, sample := range fragment.Samples {
+				durations = append(durations, sample.Duration)
+				offsets = append(offsets, sample.PTSOffset)
+			}
+			if !reflect.DeepEqual(durations, tt.durations) || !reflect.DeepEqual(offsets, tt.ptsOffsets) {
+				t.Errorf("durations %v offsets %v, want %v %v", durations, offsets, tt.durations, tt.ptsOffsets)
+			}
+			if b.Len() != 0 || b.Fragment() != nil {
+				t.Errorf("samples left after fragment")
+			}
+			if b.Pending() != (!tt.close && tt.end < 0) {
+				t.Errorf("pending %v", b.Pending())
+			}
+		})
+	}
+}
+
+func TestTrackBufferNextFragment(t *testing.T) {
+	b := NewTrackBuffer(1)
+	b.Push(0, &Sample{})
+	b.Push(3000, &Sample{})
+	first := b.Fragment()
+	b.Push(6000, &Sample{})
+	b.End(9000)
+	// 下一个分片从上一个分片的待定样本开始
+	second := b.Fragment()
+	if first.BaseTime != 0 || first.Duration() != 3000 || second.BaseTime != 3000 || second.Duration() != 6000 {
+		t.Errorf("first %d+%d second %d+%d", first.BaseTime, first.Duration(), second.BaseTime, second.Duration())
+	}
+}
@@ -0,0 +1,323 @@
+package fmp4
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/codec/h264"
+	"github.com/mrHChen/goutils/stream/codec/h265"
+)
+
+// Codec 轨道的编码参数，生成stsd中的sample entry
+type Codec interface {
+	// IsVideo 是否为视频
+	IsVideo() bool
+	// CodecString RFC 6381 编码字符串，例如 avc1.64001F、mp4a.40.2
+	CodecString() string
+
+	// dimensions 视频的宽高，音频为0
+	dimensions() (int, int)
+	writeSampleEntry(w *writer, trackID int) error
+}
+
+// CodecH264 h264编码参数，参数集不带起始码
+type CodecH264 struct {
+	SPS []byte
+	PPS []byte
+}
+
+// IsVideo 视频
+func (c *CodecH264) IsVideo() bool {
+	return true
+}
+
+// CodecString 例如 avc1.64001F
+func (c *CodecH264) CodecString() string {
+	if len(c.SPS) < 4 {
+		return "avc1"
+	}
+	return fmt.Sprintf("avc1.%02X%02X%02X", c.SPS[1], c.SPS[2], c.SPS[3])
+}
+
+func (c *CodecH264) dimensions() (int, int) {
+	sps, err := h264.ParseSPS(c.SPS)
+	if err != nil {
+		return 0, 0
+	}
+	return sps.Width, sps.Height
+}
+
+// DecoderConfig AVCDecoderConfigurationRecord(ISO 14496-15 5.3.3.1)，即avcC的内容，也用作flv的序列头
+func (c *CodecH264) DecoderConfig() ([]byte, error) {
+	sps, err := h264.ParseSPS(c.SPS)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.PPS) == 0 {
+		return nil, fmt.Errorf("h264 pps is missing")
+	}
+	w := &writer{}
+	w.u8(1)
+	w.bytes(c.SPS[1:4])
+	// lengthSizeMinusOne 为3，NALU以4字节长度前缀
+	w.u8(0xFF)
+	w.u8(0xE1)
+	w.u16(uint16(len(c.SPS)))
+	w.bytes(c.SPS)
+	w.u8(1)
+	w.u16(uint16(len(c.PPS)))
+	w.bytes(c.PPS)
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 144:
+		w.u8(0xFC | uint8(sps.ChromaFormatIdc))
+		w.u8(0xF8 | uint8(sps.BitDepthLuma-8))
+		w.u8(0xF8 | uint8(sps.BitDepthChroma-8))
+		w.u8(0)
+	}
+	return w.buf, nil
+}
+
+func (c *CodecH264) writeSampleEntry(w *writer, trackID int) error {
+	config, err := c.DecoderConfig()
+	if err != nil {
+		return err
+	}
+	width, height := c.dimensions()
+	writeVisualSampleEntry(w, "avc1", width, height, func() {
+		w.box("avcC", func() {
+			w.bytes(config)
+		})
+	})
+	return nil
+}
+
+// CodecH265 h265编码参数，参数集不带起始码
+type CodecH265 struct {
+	VPS []byte
+	SPS []byte
+	PPS []byte
+}
+
+// IsVideo 视频
+func (c *CodecH265) IsVideo() bool {
+	return true
+}
+
+// CodecString 例如 hvc1.1.6.L93.B0
+func (c *CodecH265) CodecString() string {
+	sps, err := h265.ParseSPS(c.SPS)
+	if err != nil {
+		return "hvc1"
+	}
+	return sps.ProfileTierLevel.Codec()
+}
+
+func (c *CodecH265) dimensions() (int, int) {
+	sps, err := h265.ParseSPS(c.SPS)
+	if err != nil {
+		return 0, 0
+	}
+	return sps.Width, sps.Height
+}
+
+// DecoderConfig HEVCDecoderConfigurationRecord(ISO 14496-15 8.3.3.1)，即hvcC的内容，也用作flv的序列头
+func (c *CodecH265) DecoderConfig() ([]byte, error) {
+	sps, err := h265.ParseSPS(c.SPS)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.VPS) == 0 || len(c.PPS) == 0 {
+		return nil, fmt.Errorf("h265 vps or pps is missing")
+	}
+	ptl := sps.ProfileTierLevel
+	w := &writer{}
+	w.u8(1)
+	tier := uint8(0)
+	if ptl.Tier {
+		tier = 1
+	}
+	w.u8(uint8(ptl.ProfileSpace)<<6 | tier<<5 | uint8(ptl.ProfileIdc))
+	w.u32(ptl.CompatibilityFlags)
+	w.u16(uint16(ptl.ConstraintFlags >> 32))
+	w.u32(uint32(ptl.ConstraintFlags))
+	w.u8(uint8(ptl.LevelIdc))
+	// min_spatial_segmentation_idc, parallelismType
+	w.u16(0xF000)
+	w.u8(0xFC)
+	w.u8(0xFC | uint8(sps.ChromaFormatIdc))
+	w.u8(0xF8 | uint8(sps.BitDepthLuma-8))
+	w.u8(0xF8 | uint8(sps.BitDepthChroma-8))
+	// avgFrameRate
+	w.u16(0)
+	// 只有一个时间层时 temporalIdNested 必须为1，lengthSizeMinusOne 为3
+	nested := uint8(0)
+	if sps.MaxSubLayers <= 1 {
+		nested = 1
+	}
+	w.u8(uint8(sps.MaxSubLayers&0x07)<<3 | nested<<2 | 0x03)
+	w.u8(3)
+	for _, ps := range [][]byte{c.VPS, c.SPS, c.PPS} {
+		// array_completeness 为1，参数集只在sample entry中
+		w.u8(0x80 | uint8(h265.Type(ps)))
+		w.u16(1)
+		w.u16(uint16(len(ps)))
+		w.bytes(ps)
+	}
+	return w.buf, nil
+}
+
+func (c *CodecH265) writeSampleEntry(w *writer, trackID int) error {
+	config, err := c.DecoderConfig()
+	if err != nil {
+		return err
+	}
+	width, height := c.dimensions()
+	writeVisualSampleEntry(w, "hvc1", width, height, func() {
+		w.box("hvcC", func() {
+			w.bytes(config)
+		})
+	})
+	return nil
+}
+
+// writeVisualSampleEntry VisualSampleEntry(ISO 14496-12 12.1.3)
+func writeVisualSampleEntry(w *writer, typ string, width, height int, config func()) {
+	w.box(typ, func() {
+		w.zeros(6)
+		// data_reference_index
+		w.u16(1)
+		w.zeros(16)
+		w.u16(uint16(width))
+		w.u16(uint16(height))
+		// 72 dpi
+		w.u32(0x00480000)
+		w.u32(0x00480000)
+		w.u32(0)
+		// frame_count
+		w.u16(1)
+		// compressorname
+		w.zeros(32)
+		w.u16(0x0018)
+		w.u16(0xFFFF)
+		config()
+	})
+}
+
+// CodecAAC aac编码参数
+type CodecAAC struct {
+	// Config AudioSpecificConfig
+	Config []byte
+}
+
+// IsVideo 音频
+func (c *CodecAAC) IsVideo() bool {
+	return false
+}
+
+// CodecString 例如 mp4a.40.2
+func (c *CodecAAC) CodecString() string {
+	config, err := aac.ParseConfig(c.Config)
+	if err != nil {
+		return "mp4a.40.2"
+	}
+	return config.String()
+}
+
+func (c *CodecAAC) dimensions() (int, int) {
+	return 0, 0
+}
+
+func (c *CodecAAC) writeSampleEntry(w *writer, trackID int) error {
+	config, err := aac.ParseConfig(c.Config)
+	if err != nil {
+		return err
+	}
+	writeAudioSampleEntry(w, "mp4a", config.ChannelCount, config.SampleRate, func() {
+		// ES_Descriptor(ISO 14496-1 7.2.6.5)
+		w.fullBox("esds", 0, 0, func() {
+			w.descriptor(0x03, func() {
+				w.u16(uint16(trackID))
+				w.u8(0)
+				// DecoderConfigDescriptor，objectTypeIndication 0x40为MPEG-4音频，streamType为音频
+				w.descriptor(0x04, func() {
+					w.u8(0x40)
+					w.u8(0x15)
+					w.u24(0)
+					w.u32(0)
+					w.u32(0)
+					w.descriptor(0x05, func() {
+						w.bytes(c.Config)
+					})
+				})
+				// SLConfigDescriptor predefined 为2
+				w.descriptor(0x06, func() {
+					w.u8(0x02)
+				})
+			})
+		})
+	})
+	return nil
+}
+
+// CodecOpus opus编码参数，时钟频率固定为48000
+type CodecOpus struct {
+	ChannelCount int
+}
+
+// IsVideo 音频
+func (c *CodecOpus) IsVideo() bool {
+	return false
+}
+
+// CodecString opus
+func (c *CodecOpus) CodecString() string {
+	return "opus"
+}
+
+func (c *CodecOpus) dimensions() (int, int) {
+	return 0, 0
+}
+
+func (c *CodecOpus) writeSampleEntry(w *writer, trackID int) error {
+	channels := c.ChannelCount
+	if channels <= 0 {
+		channels = 2
+	}
+	if channels > 2 {
+		return fmt.Errorf("opus channel count %d not supported", channels)
+	}
+	writeAudioSampleEntry(w, "Opus", channels, 48000, func() {
+		// OpusSpecificBox，rtp中没有pre-skip，填0
+		w.box("dOps", func() {
+			w.u8(0)
+			w.u8(uint8(channels))
+			w.u16(0)
+			w.u32(48000)
+			w.u16(0)
+			w.u8(0)
+		})
+	})
+	return nil
+}
+
+// writeAudioSampleEntry AudioSampleEntry(ISO 14496-12 12.2.3)
+func writeAudioSampleEntry(w *writer, typ string, channels, sampleRate int, config func()) {
+	if channels <= 0 {
+		channels = 2
+	}
+	if sampleRate > 0xFFFF {
+		sampleRate = 0
+	}
+	w.box(typ, func() {
+		w.zeros(6)
+		// data_reference_index
+		w.u16(1)
+		w.zeros(8)
+		w.u16(uint16(channels))
+		// samplesize
+		w.u16(16)
+		w.zeros(4)
+		w.u32(uint32(sampleRate) << 16)
+		config()
+	})
+}
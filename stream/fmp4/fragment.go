@@ -0,0 +1,115 @@
+package fmp4
+
+import (
+	"encoding/binary"
+)
+
+// trun的标志
+const (
+	trunDataOffset        = 0x000001
+	trunSampleDuration    = 0x000100
+	trunSampleSize        = 0x000200
+	trunSampleFlags       = 0x000400
+	trunSampleCTSOffset   = 0x000800
+	tfhdDefaultBaseIsMoof = 0x020000
+
+	// sample_depends_on 为2，不依赖其他样本
+	sampleFlagsSync = 0x02000000
+	// sample_depends_on 为1，sample_is_non_sync_sample 为1
+	sampleFlagsNonSync = 0x01010000
+)
+
+// Sample 一个样本，视频为4字节长度前缀的NALU，音频为一帧原始数据
+type Sample struct {
+	// Duration 时长，单位为轨道的 TimeScale
+	Duration uint32
+	// PTSOffset 展示时间与解码时间的差值，可以为负
+	PTSOffset int32
+	// IsNonSyncSample 非关键帧，音频都为关键帧
+	IsNonSyncSample bool
+	Payload         []byte
+}
+
+// TrackFragment 一个轨道在分片中的样本
+type TrackFragment struct {
+	ID int
+	// BaseTime 第一个样本的解码时间
+	BaseTime uint64
+	Samples  []*Sample
+}
+
+// Duration 样本的总时长
+func (t *TrackFragment) Duration() uint64 {
+	var d uint64
+	for _, sample := range t.Samples {
+		d += uint64(sample.Duration)
+	}
+	return d
+}
+
+// Fragment 分片(moof+mdat)，SequenceNumber 从1开始递增
+type Fragment struct {
+	SequenceNumber uint32
+	Tracks         []*TrackFragment
+}
+
+// Marshal 生成分片，没有样本的轨道不写入
+func (f *Fragment) Marshal() []byte {
+	w := &writer{}
+	// 各trun中data_offset的位置，moof写完后回填
+	var offsets []int
+	var tracks []*TrackFragment
+	w.box("moof", func() {
+		w.fullBox("mfhd", 0, 0, func() {
+			w.u32(f.SequenceNumber)
+		})
+		for _, track := range f.Tracks {
+			if len(track.Samples) == 0 {
+				continue
+			}
+			tracks = append(tracks, track)
+			w.box("traf", func() {
+				w.fullBox("tfhd", 0, tfhdDefaultBaseIsMoof, func() {
+					w.u32(uint32(track.ID))
+				})
+				w.fullBox("tfdt", 1, 0, func() {
+					w.u64(track.BaseTime)
+				})
+				flags := uint32(trunDataOffset | trunSampleDuration | trunSampleSize | trunSampleFlags | trunSampleCTSOffset)
+				// version 1 的composition offset为有符号数
+				w.fullBox("trun", 1, flags, func() {
+					w.u32(uint32(len(track.Samples)))
+					offsets = append(offsets, len(w.buf))
+					w.u32(0)
+					for _, sample := range track.Samples {
+						w.u32(sample.Duration)
+						w.u32(uint32(len(sample.Payload)))
+						if sample.IsNonSyncSample {
+							w.u32(sampleFlagsNonSync)
+						} else {
+							w.u32(sampleFlagsSync)
+						}
+						w.u32(uint32(sample.PTSOffset))
+					}
+				})
+			})
+		}
+	})
+
+	// data_offset 相对moof的起始位置
+	dataOffset := len(w.buf) + 8
+	for i, track := range tracks {
+		binary.BigEndian.PutUint32(w.buf[offsets[i]:], uint32(dataOffset))
+		for _, sample := range track.Samples {
+			dataOffset += len(sample.Payload)
+		}
+	}
+	w.box("mdat", func() {
+		for _, track := range tracks {
+			for _, sample := range track.Samples {
+				w.bytes(sample.Payload)
+			}
+		}
+	})
+	return w.buf
+}
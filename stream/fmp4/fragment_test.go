@@ -0,0 +1,94 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testTrun trun中的一个样本
+type testTrun struct {
+	duration  uint32
+	size      uint32
+	flags     uint32
+	ptsOffset int32
+}
+
+// parseTrun 解析trun，返回data_offset和样本
+func parseTrun(t *testing.T, trun []byte) (int, []testTrun) {
+	t.Helper()
+	if trun[0] != 1 || binary.BigEndian.Uint32(trun)&0xFFFFFF != 0xF01 {
+		t.Fatalf("trun version/flags %x", trun[:4])
+	}
+	count := int(binary.BigEndian.Uint32(trun[4:]))
+	if len(trun) != 12+count*16 {
+		t.Fatalf("trun size %d, count %d", len(trun), count)
+	}
+	samples := make([]testTrun, count)
+	for i := range samples {
+		b := trun[12+i*16:]
+		samples[i] = testTrun{binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:]), binary.BigEndian.Uint32(b[8:]), int32(binary.BigEndian.Uint32(b[12:]))}
+	}
+	return int(binary.BigEndian.Uint32(trun[8:])), samples
+}
+
+func TestFragmentMarshal(t *testing.T) {
+	video := &TrackFragment{ID: 1, BaseTime: 1 << 33, Samples: []*Sample{
+		{Duration: 3000, PTSOffset: 6000, Payload: bytes.Repeat([]byte{0x65}, 100)},
+		{Duration: 3000, PTSOffset: -3000, IsNonSyncSample: true, Payload: bytes.Repeat([]byte{0x41}, 30)},
+	}}
+	audio := &TrackFragment{ID: 2, BaseTime: 48000, Samples: []*Sample{
+		{Duration: 1024, Payload: bytes.Repeat([]byte{0xA1}, 10)},
+	}}
+	empty := &TrackFragment{ID: 3}
+	if video.Duration() != 6000 || empty.Duration() != 0 {
+		t.Errorf("durations %d %d", video.Duration(), empty.Duration())
+	}
+	b := (&Fragment{SequenceNumber: 7, Tracks: []*TrackFragment{video, empty, audio}}).Marshal()
+	if types := boxTypes(b); !reflect.DeepEqual(types, []string{"moof", "mdat"}) {
+		t.Fatalf("boxes %v", types)
+	}
+	moof := findBox(b, "moof")
+	if types := boxTypes(moof); !reflect.DeepEqual(types, []string{"mfhd", "traf", "traf"}) {
+		t.Fatalf("moof %v", types)
+	}
+	if mfhd := findBox(moof, "mfhd"); binary.BigEndian.Uint32(mfhd[4:]) != 7 {
+		t.Errorf("sequence number %d", binary.BigEndian.Uint32(mfhd[4:]))
+	}
+
+	tests := []struct {
+		name    string
+		track   *TrackFragment
+		samples []testTrun
+	}{
+		{"video", video, []testTrun{{3000, 100, sampleFlagsSync, 6000}, {3000, 30, sampleFlagsNonSync, -3000}}},
+		{"audio", audio, []testTrun{{1024, 10, sampleFlagsSync, 0}}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traf := findNthBox(moof, i, "traf")
+			tfhd := findBox(traf, "tfhd")
+			if binary.BigEndian.Uint32(tfhd)&0xFFFFFF != tfhdDefaultBaseIsMoof || binary.BigEndian.Uint32(tfhd[4:]) != uint32(tt.track.ID) {
+				t.Errorf("tfhd %x", tfhd)
+			}
+			if tfdt := findBox(traf, "tfdt"); tfdt[0] != 1 || binary.BigEndian.Uint64(tfdt[4:]) != tt.track.BaseTime {
+				t.Errorf("tfdt %x", tfdt)
+			}
+			offset, samples := parseTrun(t, findBox(traf, "trun"))
+			if !reflect.DeepEqual(samples, tt.samples) {
+				t.Errorf("samples %v, want %v", samples, tt.samples)
+			}
+			// data_offset 相对moof的起始位置，指向mdat中该轨道的第一个样本
+			for _, sample := range tt.track.Samples {
+				if offset+len(sample.Payload) > len(b) || !bytes.Equal(b[offset:offset+len(sample.Payload)], sample.Payload) {
+					t.Fatalf("payload at %d mismatch", offset)
+				}
+				offset += len(sample.Payload)
+			}
+		})
+	}
+	if mdat := findBox(b, "mdat"); len(mdat) != 140 {
+		t.Errorf("mdat size %d", len(mdat))
+	}
+}
@@ -0,0 +1,176 @@
+package fmp4
+
+import (
+	"fmt"
+)
+
+// Track 轨道，ID从1开始，TimeScale 为采样的时间单位，通常与rtp时钟频率一致
+type Track struct {
+	ID        int
+	TimeScale uint32
+	Codec     Codec
+}
+
+// Init 初始化段(ftyp+moov)，样本在后续的分片中
+type Init struct {
+	Tracks []*Track
+}
+
+// matrix 单位矩阵
+var matrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// Marshal 生成初始化段
+func (i *Init) Marshal() ([]byte, error) {
+	if len(i.Tracks) == 0 {
+		return nil, fmt.Errorf("fmp4 init has no track")
+	}
+	w := &writer{}
+	w.box("ftyp", func() {
+		w.bytes([]byte("iso5"))
+		w.u32(512)
+		for _, brand := range []string{"iso5", "iso6", "mp41"} {
+			w.bytes([]byte(brand))
+		}
+	})
+
+	var err error
+	w.box("moov", func() {
+		nextTrackID := 1
+		for _, track := range i.Tracks {
+			if track.ID >= nextTrackID {
+				nextTrackID = track.ID + 1
+			}
+		}
+		w.fullBox("mvhd", 0, 0, func() {
+			w.u32(0)
+			w.u32(0)
+			w.u32(1000)
+			w.u32(0)
+			// rate 1.0, volume 1.0
+			w.u32(0x00010000)
+			w.u16(0x0100)
+			w.zeros(10)
+			for _, v := range matrix {
+				w.u32(v)
+			}
+			w.zeros(24)
+			w.u32(uint32(nextTrackID))
+		})
+		for _, track := range i.Tracks {
+			if e := track.write(w); e != nil && err == nil {
+				err = e
+			}
+		}
+		w.box("mvex", func() {
+			for _, track := range i.Tracks {
+				w.fullBox("trex", 0, 0, func() {
+					w.u32(uint32(track.ID))
+					// default_sample_description_index
+					w.u32(1)
+					w.u32(0)
+					w.u32(0)
+					w.u32(0)
+				})
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+// write 写入trak
+func (t *Track) write(w *writer) error {
+	if t.Codec == nil {
+		return fmt.Errorf("fmp4 track %d codec is nil", t.ID)
+	}
+	handler, handlerName := "soun", "SoundHandler"
+	if t.Codec.IsVideo() {
+		handler, handlerName = "vide", "VideoHandler"
+	}
+	var err error
+	w.box("trak", func() {
+		width, height := t.Codec.dimensions()
+		// flags: track_enabled | track_in_movie
+		w.fullBox("tkhd", 0, 3, func() {
+			w.u32(0)
+			w.u32(0)
+			w.u32(uint32(t.ID))
+			w.u32(0)
+			w.u32(0)
+			w.zeros(8)
+			// layer, alternate_group
+			w.u16(0)
+			w.u16(0)
+			if t.Codec.IsVideo() {
+				w.u16(0)
+			} else {
+				w.u16(0x0100)
+			}
+			w.u16(0)
+			for _, v := range matrix {
+				w.u32(v)
+			}
+			w.u32(uint32(width) << 16)
+			w.u32(uint32(height) << 16)
+		})
+		w.box("mdia", func() {
+			w.fullBox("mdhd", 0, 0, func() {
+				w.u32(0)
+				w.u32(0)
+				w.u32(t.TimeScale)
+				w.u32(0)
+				// language und
+				w.u16(0x55C4)
+				w.u16(0)
+			})
+			w.fullBox("hdlr", 0, 0, func() {
+				w.u32(0)
+				w.bytes([]byte(handler))
+				w.zeros(12)
+				w.bytes([]byte(handlerName))
+				w.u8(0)
+			})
+			w.box("minf", func() {
+				if t.Codec.IsVideo() {
+					w.fullBox("vmhd", 0, 1, func() {
+						w.zeros(8)
+					})
+				} else {
+					w.fullBox("smhd", 0, 0, func() {
+						w.zeros(4)
+					})
+				}
+				w.box("dinf", func() {
+					w.fullBox("dref", 0, 0, func() {
+						w.u32(1)
+						// 媒体数据在同一文件中
+						w.fullBox("url ", 0, 1, nil)
+					})
+				})
+				w.box("stbl", func() {
+					w.fullBox("stsd", 0, 0, func() {
+						w.u32(1)
+						err = t.Codec.writeSampleEntry(w, t.ID)
+					})
+					// 样本都在分片中，样本表为空
+					w.fullBox("stts", 0, 0, func() {
+						w.u32(0)
+					})
+					w.fullBox("stsc", 0, 0, func() {
+						w.u32(0)
+					})
+					w.fullBox("stsz", 0, 0, func() {
+						w.u32(0)
+						w.u32(0)
+					})
+					w.fullBox("stco", 0, 0, func() {
+						w.u32(0)
+					})
+				})
+			})
+		})
+	})
+	return err
+}
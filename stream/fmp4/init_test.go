@@ -0,0 +1,216 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// testContainers 包含子box的box
+var testContainers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "dinf": true,
+	"mvex": true, "moof": true, "traf": true,
+}
+
+// findBox 按路径查找box，返回内容(不含头部)，同名的box取第index个，没有时返回nil
+func findBox(b []byte, path ...string) []byte {
+	return findNthBox(b, 0, path...)
+}
+
+func findNthBox(b []byte, index int, path ...string) []byte {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return nil
+		}
+		if string(b[4:8]) == path[0] {
+			if len(path) == 1 {
+				if index == 0 {
+					return b[8:size]
+				}
+				index--
+			} else if testContainers[path[0]] {
+				if index == 0 {
+					return findNthBox(b[8:size], 0, path[1:]...)
+				}
+				index--
+			}
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+// boxTypes 同一层的box类型
+func boxTypes(b []byte) []string {
+	var types []string
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return append(types, "invalid")
+		}
+		types = append(types, string(b[4:8]))
+		b = b[size:]
+	}
+	return types
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+var (
+	testH264SPS = "6742c01fd900780227e5c044000003000400000300f03c60c920"
+	testH264PPS = "68cb83cb20"
+	testH265VPS = "40010c01ffff016000000300900000030000030078999809"
+	testH265SPS = "420101016000000300900000030000030078a003c08010e596666924cae010000003001000000301e080"
+	testH265PPS = "4401c172b46240"
+	// AAC-LC 44100Hz 双声道
+	testAACConfig = "1210"
+)
+
+func TestInit(t *testing.T) {
+	h264Codec := &CodecH264{SPS: mustHex(t, testH264SPS), PPS: mustHex(t, testH264PPS)}
+	h265Codec := &CodecH265{VPS: mustHex(t, testH265VPS), SPS: mustHex(t, testH265SPS), PPS: mustHex(t, testH265PPS)}
+	tests := []struct {
+		name       string
+		video      Codec
+		audio      Codec
+		entry      string
+		config     string
+		codec      string
+		audioEntry string
+		audioCodec string
+		sampleRate int
+		channels   int
+	}{
+		{"h264 aac", h264Codec, &CodecAAC{Config: mustHex(t, testAACConfig)}, "avc1", "avcC", "avc1.42C01F", "mp4a", "mp4a.40.2", 44100, 2},
+		{"h265 opus", h265Codec, &CodecOpus{ChannelCount: 1}, "hvc1", "hvcC", "hvc1.1.6.L120.90", "Opus", "opus", 48000, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.video.CodecString() != tt.codec || tt.audio.CodecString() != tt.audioCodec {
+				t.Errorf("codec strings %s %s", tt.video.CodecString(), tt.audio.CodecString())
+			}
+			b, err := (&Init{Tracks: []*Track{
+				{ID: 1, TimeScale: 90000, Codec: tt.video},
+				{ID: 2, TimeScale: uint32(tt.sampleRate), Codec: tt.audio},
+			}}).Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if types := boxTypes(b); len(types) != 2 || types[0] != "ftyp" || types[1] != "moov" {
+				t.Fatalf("boxes %v", types)
+			}
+			if ftyp := findBox(b, "ftyp"); string(ftyp[:4]) != "iso5" {
+				t.Errorf("major brand %s", ftyp[:4])
+			}
+			moov := findBox(b, "moov")
+			if types := boxTypes(moov); len(types) != 4 || types[0] != "mvhd" || types[3] != "mvex" {
+				t.Errorf("moov %v", types)
+			}
+			// next_track_ID
+			if mvhd := findBox(moov, "mvhd"); binary.BigEndian.Uint32(mvhd[len(mvhd)-4:]) != 3 {
+				t.Errorf("next track id %d", binary.BigEndian.Uint32(mvhd[len(mvhd)-4:]))
+			}
+
+			video := findNthBox(moov, 0, "trak")
+			tkhd := findBox(video, "tkhd")
+			if width, height := binary.BigEndian.Uint32(tkhd[len(tkhd)-8:])>>16, binary.BigEndian.Uint32(tkhd[len(tkhd)-4:])>>16; width != 1920 || height != 1080 {
+				t.Errorf("tkhd %dx%d", width, height)
+			}
+			if mdhd := findBox(video, "mdia", "mdhd"); binary.BigEndian.Uint32(mdhd[12:]) != 90000 {
+				t.Errorf("timescale %d", binary.BigEndian.Uint32(mdhd[12:]))
+			}
+			if hdlr := findBox(video, "mdia", "hdlr"); string(hdlr[8:12]) != "vide" {
+				t.Errorf("handler %s", hdlr[8:12])
+			}
+			stsd := findBox(video, "mdia", "minf", "stbl", "stsd")
+			entry := findBox(stsd[8:], tt.entry)
+			if entry == nil {
+				t.Fatalf("sample entry %s missing", tt.entry)
+			}
+			if width, height := binary.BigEndian.Uint16(entry[24:]), binary.BigEndian.Uint16(entry[26:]); width != 1920 || height != 1080 {
+				t.Errorf("sample entry %dx%d", width, height)
+			}
+			want, _ := tt.video.(interface{ DecoderConfig() ([]byte, error) }).DecoderConfig()
+			if config := findBox(entry[78:], tt.config); !bytes.Equal(config, want) {
+				t.Errorf("%s %x, want %x", tt.config, config, want)
+			}
+
+			audio := findNthBox(moov, 1, "trak")
+			if hdlr := findBox(audio, "mdia", "hdlr"); string(hdlr[8:12]) != "soun" {
+				t.Errorf("handler %s", hdlr[8:12])
+			}
+			stsd = findBox(audio, "mdia", "minf", "stbl", "stsd")
+			entry = findBox(stsd[8:], tt.audioEntry)
+			if entry == nil {
+				t.Fatalf("sample entry %s missing", tt.audioEntry)
+			}
+			if channels, rate := binary.BigEndian.Uint16(entry[16:]), binary.BigEndian.Uint32(entry[24:])>>16; int(channels) != tt.channels || int(rate) != tt.sampleRate {
+				t.Errorf("audio entry channels %d rate %d", channels, rate)
+			}
+			for i := 0; i < 2; i++ {
+				if trex := findNthBox(findBox(moov, "mvex"), i, "trex"); binary.BigEndian.Uint32(trex[4:]) != uint32(i+1) {
+					t.Errorf("trex %d track id %d", i, binary.BigEndian.Uint32(trex[4:]))
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderConfig(t *testing.T) {
+	avcC, err := (&CodecH264{SPS: mustHex(t, testH264SPS), PPS: mustHex(t, testH264PPS)}).DecoderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustHex(t, "0142c01fffe1001a"+testH264SPS+"010005"+testH264PPS)
+	if !bytes.Equal(avcC, want) {
+		t.Errorf("avcC %x, want %x", avcC, want)
+	}
+	// High profile 带色度和位深扩展
+	high, err := (&CodecH264{SPS: mustHex(t, "6764001facd9405005bb011000000300100000030320f1831960"), PPS: mustHex(t, testH264PPS)}).DecoderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tail := high[len(high)-4:]; !bytes.Equal(tail, []byte{0xFD, 0xF8, 0xF8, 0x00}) {
+		t.Errorf("high profile extension %x", tail)
+	}
+
+	hvcC, err := (&CodecH265{VPS: mustHex(t, testH265VPS), SPS: mustHex(t, testH265SPS), PPS: mustHex(t, testH265PPS)}).DecoderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 版本、profile、兼容标志、约束标志、level
+	if header := hvcC[:13]; !bytes.Equal(header, mustHex(t, "010160000000900000000000"+"78")) {
+		t.Errorf("hvcC header %x", header)
+	}
+	if hvcC[21]&0x03 != 3 || hvcC[22] != 3 || hvcC[23] != 0x80|32 {
+		t.Errorf("hvcC arrays %x", hvcC[21:24])
+	}
+
+	invalid := []Codec{
+		&CodecH264{SPS: mustHex(t, testH264SPS)},
+		&CodecH264{SPS: []byte{0x67}, PPS: mustHex(t, testH264PPS)},
+		&CodecH265{SPS: mustHex(t, testH265SPS), PPS: mustHex(t, testH265PPS)},
+		&CodecAAC{Config: []byte{0xFF}},
+		&CodecOpus{ChannelCount: 6},
+	}
+	for i, codec := range invalid {
+		if _, err := (&Init{Tracks: []*Track{{ID: 1, TimeScale: 90000, Codec: codec}}}).Marshal(); err == nil {
+			t.Errorf("codec %d accepted", i)
+		}
+	}
+	if _, err := (&Init{}).Marshal(); err == nil {
+		t.Errorf("init without tracks accepted")
+	}
+	if _, err := (&Init{Tracks: []*Track{{ID: 1}}}).Marshal(); err == nil {
+		t.Errorf("track without codec accepted")
+	}
+}
@@ -0,0 +1,76 @@
+package fmp4
+
+import (
+	"encoding/binary"
+)
+
+// writer 按大端写入box，box的长度在写完内容后回填
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) u8(v uint8) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *writer) u16(v uint16) {
+	w.buf = append(w.buf, byte(v>>8), byte(v))
+}
+
+func (w *writer) u24(v uint32) {
+	w.buf = append(w.buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *writer) u32(v uint32) {
+	w.buf = append(w.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *writer) u64(v uint64) {
+	w.u32(uint32(v >> 32))
+	w.u32(uint32(v))
+}
+
+func (w *writer) bytes(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+func (w *writer) zeros(n int) {
+	for i := 0; i < n; i++ {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// box 写入一个box，body 写入box的内容
+func (w *writer) box(typ string, body func()) {
+	start := len(w.buf)
+	w.u32(0)
+	w.bytes([]byte(typ))
+	if body != nil {
+		body()
+	}
+	binary.BigEndian.PutUint32(w.buf[start:], uint32(len(w.buf)-start))
+}
+
+// fullBox 写入带版本和标志的box
+func (w *writer) fullBox(typ string, version uint8, flags uint32, body func()) {
+	w.box(typ, func() {
+		w.u8(version)
+		w.u24(flags)
+		if body != nil {
+			body()
+		}
+	})
+}
+
+// descriptor 写入MPEG-4描述符，长度固定以4字节可变长编码，便于回填
+func (w *writer) descriptor(tag uint8, body func()) {
+	w.u8(tag)
+	start := len(w.buf)
+	w.zeros(4)
+	body()
+	size := len(w.buf) - start - 4
+	w.buf[start] = 0x80 | byte(size>>21&0x7F)
+	w.buf[start+1] = 0x80 | byte(size>>14&0x7F)
+	w.buf[start+2] = 0x80 | byte(size>>7&0x7F)
+	w.buf[start+3] = byte(size & 0x7F)
+}
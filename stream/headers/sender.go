@@ -119,7 +119,8 @@ func (se *Sender) AddAuthorization(req *base.Request) {
 	req.Header["Authorization"] = h.Write()
 }
 
-func (se *Sender) CheckAuth(url *url.URL) error {
+// CheckAuth 校验请求中的digest响应，method 为请求的方法
+func (se *Sender) CheckAuth(method base.Method, url *url.URL) error {
 
 	urStr := url.String()
 
@@ -127,7 +128,7 @@ func (se *Sender) CheckAuth(url *url.URL) error {
 		":" +
 		*se.auth.Nonce +
 		":" +
-		utils.Md5Hex(string(se.method)+
+		utils.Md5Hex(string(method)+
 			":"+
 			urStr))
 
@@ -0,0 +1,31 @@
+package mpegts
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestCRC32(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		crc  uint32
+	}{
+		{"check", hex.EncodeToString([]byte("123456789")), 0x0376E6E7},
+		{"empty", "", 0xFFFFFFFF},
+		// 节目1、PMT PID 0x1000的PAT
+		{"pat", "00b00d0001c100000001f000", 0x2AB104B2},
+		{"pat with crc", "00b00d0001c100000001f0002ab104b2", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if crc := crc32(b); crc != tt.crc {
+				t.Errorf("crc %08x, want %08x", crc, tt.crc)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package mpegts
+
+import (
+	"fmt"
+	"io"
+)
+
+// PacketSize TS包长度
+const PacketSize = 188
+
+// 节目相关的PID
+const (
+	pidPAT = 0x0000
+	pidPMT = 0x1000
+	// programNumber 只有一个节目
+	programNumber = 1
+	// pcrDelay PCR比DTS提前700ms，给解码端留出缓冲
+	pcrDelay = 63000
+)
+
+// StreamType PMT中的流类型(ISO 13818-1 2.4.4.9)
+type StreamType uint8
+
+const (
+	// StreamTypeAAC ADTS封装的aac
+	StreamTypeAAC  StreamType = 0x0F
+	StreamTypeH264 StreamType = 0x1B
+	StreamTypeH265 StreamType = 0x24
+)
+
+// IsVideo 是否为视频流
+func (t StreamType) IsVideo() bool {
+	return t == StreamTypeH264 || t == StreamTypeH265
+}
+
+// Track 节目中的一路流
+type Track struct {
+	PID        uint16
+	StreamType StreamType
+}
+
+// Writer 将PES封装为TS包，第一个视频流携带PCR，没有视频时由第一个流携带
+type Writer struct {
+	w      io.Writer
+	tracks []*Track
+	pcrPID uint16
+	// 各PID的连续计数
+	cc map[uint16]uint8
+}
+
+// NewWriter 创建TS写入器
+func NewWriter(w io.Writer, tracks []*Track) *Writer {
+	writer := &Writer{w: w, tracks: tracks, cc: make(map[uint16]uint8)}
+	for _, track := range tracks {
+		if track.StreamType.IsVideo() {
+			writer.pcrPID = track.PID
+			break
+		}
+	}
+	if writer.pcrPID == 0 && len(tracks) > 0 {
+		writer.pcrPID = tracks[0].PID
+	}
+	return writer
+}
+
+// SetWriter 切换输出，如开始新的分段，连续计数保持不变
+func (w *Writer) SetWriter(out io.Writer) {
+	w.w = out
+}
+
+// WriteTables 写入PAT和PMT，每个分段开始时写入
+func (w *Writer) WriteTables() error {
+	pat := []byte{
+		0x00, 0xB0, 0x00,
+		// transport_stream_id
+		0x00, 0x01,
+		// version 0, current_next_indicator 1
+		0xC1, 0x00, 0x00,
+		byte(programNumber >> 8), byte(programNumber), 0xE0 | byte(pidPMT>>8), byte(pidPMT & 0xFF),
+	}
+	if err := w.writeSection(pidPAT, pat); err != nil {
+		return err
+	}
+
+	pmt := []byte{
+		0x02, 0xB0, 0x00,
+		byte(programNumber >> 8), byte(programNumber),
+		0xC1, 0x00, 0x00,
+		0xE0 | byte(w.pcrPID>>8), byte(w.pcrPID),
+		// program_info_length
+		0xF0, 0x00,
+	}
+	for _, track := range w.tracks {
+		pmt = append(pmt, byte(track.StreamType), 0xE0|byte(track.PID>>8), byte(track.PID), 0xF0, 0x00)
+	}
+	return w.writeSection(pidPMT, pmt)
+}
+
+// writeSection 填写section_length和CRC后写入一个TS包
+func (w *Writer) writeSection(pid uint16, section []byte) error {
+	// section_length 从其后到CRC结束
+	length := len(section) - 3 + 4
+	section[1] = section[1]&0xF0 | byte(length>>8)
+	section[2] = byte(length)
+	crc := crc32(section)
+	section = append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	pkt := make([]byte, PacketSize)
+	pkt[0] = 0x47
+	pkt[1] = 0x40 | byte(pid>>8)
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10 | w.nextCC(pid)
+	// pointer_field
+	pkt[4] = 0
+	n := copy(pkt[5:], section)
+	for i := 5 + n; i < PacketSize; i++ {
+		pkt[i] = 0xFF
+	}
+	_, err := w.w.Write(pkt)
+	return err
+}
+
+func (w *Writer) nextCC(pid uint16) uint8 {
+	cc := w.cc[pid]
+	w.cc[pid] = (cc + 1) & 0x0F
+	return cc
+}
+
+// WritePES 写入一个访问单元，pts dts 为90kHz时钟，dts等于pts时只写pts
+// 视频为Annex-B格式，aac为带ADTS头的帧；randomAccess 为true时标记随机访问点
+func (w *Writer) WritePES(pid uint16, pts, dts int64, randomAccess bool, data []byte) error {
+	var track *Track
+	for _, t := range w.tracks {
+		if t.PID == pid {
+			track = t
+		}
+	}
+	if track == nil {
+		return fmt.Errorf("mpegts pid %d not found", pid)
+	}
+	streamID := byte(0xC0)
+	if track.StreamType.IsVideo() {
+		streamID = 0xE0
+	}
+
+	header := make([]byte, 0, 19)
+	header = append(header, 0x00, 0x00, 0x01, streamID, 0x00, 0x00)
+	if pts == dts {
+		// data_alignment_indicator, PTS
+		header = append(header, 0x84, 0x80, 5)
+		header = appendTimestamp(header, 0x2, pts)
+	} else {
+		header = append(header, 0x84, 0xC0, 10)
+		header = appendTimestamp(header, 0x3, pts)
+		header = appendTimestamp(header, 0x1, dts)
+	}
+	// PES_packet_length 超出范围时为0，只允许用于视频
+	if length := len(header) - 6 + len(data); length <= 0xFFFF {
+		header[4], header[5] = byte(length>>8), byte(length)
+	}
+
+	pes := append(header, data...)
+	first := true
+	for len(pes) > 0 {
+		// 自适应字段，不含长度字节
+		var af []byte
+		if first {
+			var flags byte
+			if randomAccess {
+				flags |= 0x40
+			}
+			if pid == w.pcrPID {
+				flags |= 0x10
+			}
+			if flags != 0 {
+				af = append(af, flags)
+				if pid == w.pcrPID {
+					af = appendPCR(af, dts-pcrDelay)
+				}
+			}
+		}
+		space := PacketSize - 4
+		if af != nil {
+			space -= 1 + len(af)
+		}
+		hasAF := af != nil
+		if stuffing := space - len(pes); stuffing > 0 {
+			// 最后一个包以自适应字段填充
+			if !hasAF {
+				hasAF = true
+				stuffing--
+				if stuffing > 0 {
+					af = append(af, 0x00)
+					stuffing--
+				}
+			}
+			for i := 0; i < stuffing; i++ {
+				af = append(af, 0xFF)
+			}
+			space = len(pes)
+		}
+
+		pkt := make([]byte, 4, PacketSize)
+		pkt[0] = 0x47
+		pkt[1] = byte(pid >> 8)
+		if first {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10 | w.nextCC(pid)
+		if hasAF {
+			pkt[3] |= 0x20
+			pkt = append(pkt, byte(len(af)))
+			pkt = append(pkt, af...)
+		}
+		pkt = append(pkt, pes[:space]...)
+		if _, err := w.w.Write(pkt); err != nil {
+			return err
+		}
+		pes = pes[space:]
+		first = false
+	}
+	return nil
+}
+
+// appendTimestamp PES头中的33位PTS/DTS
+func appendTimestamp(b []byte, prefix byte, ts int64) []byte {
+	ts &= 0x1FFFFFFFF
+	return append(b,
+		prefix<<4|byte(ts>>29)&0x0E|1,
+		byte(ts>>22),
+		byte(ts>>14)|1,
+		byte(ts>>7),
+		byte(ts<<1)|1,
+	)
+}
+
+// appendPCR PCR，base为90kHz时钟，extension为0
+func appendPCR(b []byte, base int64) []byte {
+	if base < 0 {
+		base = 0
+	}
+	base &= 0x1FFFFFFFF
+	return append(b,
+		byte(base>>25),
+		byte(base>>17),
+		byte(base>>9),
+		byte(base>>1),
+		byte(base<<7)|0x7E,
+		0x00,
+	)
+}
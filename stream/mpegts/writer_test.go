@@ -0,0 +1,216 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// testPacket 解析后的TS包
+type testPacket struct {
+	pid          uint16
+	start        bool
+	cc           uint8
+	randomAccess bool
+	pcr          int64
+	hasPCR       bool
+	payload      []byte
+}
+
+// parsePackets 按188字节拆分并解析TS包头和自适应字段
+func parsePackets(t *testing.T, b []byte) []*testPacket {
+	t.Helper()
+	if len(b)%PacketSize != 0 {
+		t.Fatalf("length %d not multiple of %d", len(b), PacketSize)
+	}
+	var packets []*testPacket
+	for ; len(b) > 0; b = b[PacketSize:] {
+		pkt := b[:PacketSize]
+		if pkt[0] != 0x47 {
+			t.Fatalf("sync byte %x", pkt[0])
+		}
+		p := &testPacket{pid: uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2]), start: pkt[1]&0x40 != 0, cc: pkt[3] & 0x0F}
+		if pkt[3]&0x10 == 0 {
+			t.Fatalf("packet without payload")
+		}
+		payload := pkt[4:]
+		if pkt[3]&0x20 != 0 {
+			length := int(payload[0])
+			af := payload[1 : 1+length]
+			payload = payload[1+length:]
+			if length > 0 {
+				p.randomAccess = af[0]&0x40 != 0
+				if af[0]&0x10 != 0 {
+					p.hasPCR = true
+					p.pcr = int64(af[1])<<25 | int64(af[2])<<17 | int64(af[3])<<9 | int64(af[4])<<1 | int64(af[5])>>7
+				}
+			}
+		}
+		p.payload = payload
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// parseTimestamp PES头中的33位时间戳
+func parseTimestamp(b []byte) int64 {
+	return int64(b[0]&0x0E)<<29 | int64(b[1])<<22 | int64(b[2]&0xFE)<<14 | int64(b[3])<<7 | int64(b[4])>>1
+}
+
+func TestWriteTables(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks []*Track
+		pcrPID uint16
+	}{
+		{"video and audio", []*Track{{PID: 0x101, StreamType: StreamTypeAAC}, {PID: 0x100, StreamType: StreamTypeH264}}, 0x100},
+		{"h265", []*Track{{PID: 0x100, StreamType: StreamTypeH265}}, 0x100},
+		{"audio only", []*Track{{PID: 0x101, StreamType: StreamTypeAAC}}, 0x101},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, tt.tracks)
+			if err := w.WriteTables(); err != nil {
+				t.Fatal(err)
+			}
+			packets := parsePackets(t, buf.Bytes())
+			if len(packets) != 2 || packets[0].pid != pidPAT || packets[1].pid != pidPMT || !packets[0].start || !packets[1].start {
+				t.Fatalf("packets %v", packets)
+			}
+			pat := packets[0].payload
+			if want := "0000b00d0001c100000001f0002ab104b2ffff"; hex.EncodeToString(pat[:19]) != want {
+				t.Errorf("pat %x, want %s", pat[:19], want)
+			}
+			pmt := packets[1].payload[1:]
+			length := int(pmt[1]&0x0F)<<8 | int(pmt[2])
+			if crc32(pmt[:3+length]) != 0 {
+				t.Errorf("pmt crc mismatch")
+			}
+			if pcrPID := uint16(pmt[8]&0x1F)<<8 | uint16(pmt[9]); pcrPID != tt.pcrPID {
+				t.Errorf("pcr pid %x, want %x", pcrPID, tt.pcrPID)
+			}
+			if streams := pmt[12 : 3+length-4]; len(streams) != 5*len(tt.tracks) {
+				t.Fatalf("pmt streams %x", streams)
+			} else {
+				for i, track := range tt.tracks {
+					s := streams[i*5:]
+					if StreamType(s[0]) != track.StreamType || uint16(s[1]&0x1F)<<8|uint16(s[2]) != track.PID {
+						t.Errorf("stream %d %x", i, s[:5])
+					}
+				}
+			}
+			// 连续计数递增
+			w.WriteTables()
+			if packets := parsePackets(t, buf.Bytes()); packets[2].cc != 1 || packets[3].cc != 1 {
+				t.Errorf("cc %d %d", packets[2].cc, packets[3].cc)
+			}
+		})
+	}
+}
+
+func TestWritePES(t *testing.T) {
+	tracks := []*Track{{PID: 0x100, StreamType: StreamTypeH264}, {PID: 0x101, StreamType: StreamTypeAAC}}
+	tests := []struct {
+		name         string
+		pid          uint16
+		pts, dts     int64
+		randomAccess bool
+		size         int
+		packets      int
+	}{
+		{"audio small", 0x101, 90000, 90000, false, 100, 1},
+		// 负载正好填满一个包
+		{"audio exact", 0x101, 90000, 90000, false, 184 - 14, 1},
+		// 只剩1字节时自适应字段长度为0
+		{"audio one byte stuffing", 0x101, 90000, 90000, false, 184 - 15, 1},
+		{"audio two packets", 0x101, 1 << 33, 1 << 33, false, 184 - 13, 2},
+		{"video keyframe", 0x100, 93000, 90000, true, 1000, 6},
+		{"video pts only", 0x100, 90000, 90000, false, 5000, 28},
+		// PES_packet_length 超出范围时为0
+		{"video large", 0x100, 183000, 180000, true, 70000, 381},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, tracks)
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			if err := w.WritePES(tt.pid, tt.pts, tt.dts, tt.randomAccess, data); err != nil {
+				t.Fatal(err)
+			}
+			packets := parsePackets(t, buf.Bytes())
+			if len(packets) != tt.packets {
+				t.Errorf("packets %d, want %d", len(packets), tt.packets)
+			}
+			var pes []byte
+			for i, p := range packets {
+				if p.pid != tt.pid || p.start != (i == 0) || p.cc != uint8(i)&0x0F {
+					t.Errorf("packet %d pid %x start %v cc %d", i, p.pid, p.start, p.cc)
+				}
+				if i > 0 && (p.hasPCR || p.randomAccess) {
+					t.Errorf("packet %d has pcr or random access", i)
+				}
+				pes = append(pes, p.payload...)
+			}
+			first := packets[0]
+			if first.randomAccess != tt.randomAccess {
+				t.Errorf("random access %v", first.randomAccess)
+			}
+			if isPCR := tt.pid == 0x100; first.hasPCR != isPCR || isPCR && first.pcr != tt.dts-pcrDelay {
+				t.Errorf("pcr %v %d", first.hasPCR, first.pcr)
+			}
+
+			streamID := byte(0xC0)
+			if tt.pid == 0x100 {
+				streamID = 0xE0
+			}
+			if !bytes.Equal(pes[:4], []byte{0, 0, 1, streamID}) {
+				t.Fatalf("pes start %x", pes[:4])
+			}
+			headerLength := 9 + int(pes[8])
+			length := int(pes[4])<<8 | int(pes[5])
+			if want := headerLength - 6 + tt.size; want > 0xFFFF && length != 0 || want <= 0xFFFF && length != want {
+				t.Errorf("pes length %d", length)
+			}
+			if pts := parseTimestamp(pes[9:]); pts != tt.pts&0x1FFFFFFFF {
+				t.Errorf("pts %d, want %d", pts, tt.pts)
+			}
+			if hasDTS := pes[7]&0x40 != 0; hasDTS != (tt.pts != tt.dts) {
+				t.Errorf("dts flag %v", hasDTS)
+			} else if hasDTS && parseTimestamp(pes[14:]) != tt.dts {
+				t.Errorf("dts %d, want %d", parseTimestamp(pes[14:]), tt.dts)
+			}
+			if !bytes.Equal(pes[headerLength:], data) {
+				t.Errorf("pes payload mismatch, %d bytes", len(pes)-headerLength)
+			}
+		})
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{}, []*Track{{PID: 0x100, StreamType: StreamTypeH264}})
+	if err := w.WritePES(0x200, 0, 0, false, []byte{1}); err == nil {
+		t.Errorf("unknown pid accepted")
+	}
+	fail := errors.New("write failed")
+	w.SetWriter(failWriter{fail})
+	if err := w.WriteTables(); err != fail {
+		t.Errorf("tables error %v", err)
+	}
+	if err := w.WritePES(0x100, 0, 0, true, make([]byte, 1000)); err != fail {
+		t.Errorf("pes error %v", err)
+	}
+}
+
+// failWriter 写入总是失败
+type failWriter struct {
+	err error
+}
+
+func (w failWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,54 @@
+package nalcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+)
+
+// Algorithm NALU的加密算法，都使用16字节密钥的计数器模式
+type Algorithm uint8
+
+const (
+	AlgorithmAES128CTR Algorithm = iota + 1
+	AlgorithmSM4CTR
+)
+
+// KeyLength 密钥长度
+const KeyLength = 16
+
+// String 为sdp中的名称
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmAES128CTR:
+		return "AES-128-CTR"
+	case AlgorithmSM4CTR:
+		return "SM4-CTR"
+	}
+	return fmt.Sprintf("algorithm(%d)", uint8(a))
+}
+
+// ParseAlgorithm 由sdp中的名称解析
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for _, a := range []Algorithm{AlgorithmAES128CTR, AlgorithmSM4CTR} {
+		if strings.EqualFold(name, a.String()) {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("nal encryption algorithm %s not supported", name)
+}
+
+// newBlock 创建分组密码
+func (a Algorithm) newBlock(key []byte) (cipher.Block, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("nal encryption key length %d invalid", len(key))
+	}
+	switch a {
+	case AlgorithmAES128CTR:
+		return aes.NewCipher(key)
+	case AlgorithmSM4CTR:
+		return NewSM4Cipher(key)
+	}
+	return nil, fmt.Errorf("nal encryption algorithm %v not supported", a)
+}
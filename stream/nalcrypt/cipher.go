@@ -0,0 +1,243 @@
+package nalcrypt
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/h264"
+	"github.com/mrHChen/goutils/stream/codec/h265"
+)
+
+// nalCodec h264/h265的NALU差异
+type nalCodec struct {
+	headerLength int
+	// seiHeader 前缀SEI的NALU header
+	seiHeader []byte
+	isVCL     func(nalu []byte) bool
+	isSEI     func(nalu []byte) bool
+}
+
+func newNALCodec(name string) (*nalCodec, error) {
+	switch strings.ToLower(name) {
+	case "h264":
+		return &nalCodec{
+			headerLength: 1,
+			seiHeader:    []byte{byte(h264.NALUTypeSEI)},
+			isVCL: func(nalu []byte) bool {
+				t := h264.Type(nalu)
+				return t >= h264.NALUTypeNonIDR && t <= h264.NALUTypeIDR
+			},
+			isSEI: func(nalu []byte) bool {
+				return h264.Type(nalu) == h264.NALUTypeSEI
+			},
+		}, nil
+	case "h265":
+		return &nalCodec{
+			headerLength: 2,
+			seiHeader:    []byte{byte(h265.NALUTypePrefixSEI) << 1, 1},
+			isVCL: func(nalu []byte) bool {
+				return len(nalu) >= 2 && h265.Type(nalu) < 32
+			},
+			isSEI: func(nalu []byte) bool {
+				return len(nalu) >= 2 && h265.Type(nalu) == h265.NALUTypePrefixSEI
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("nal encryption codec %s not supported", name)
+}
+
+// findParams 查找帧中携带加密参数的SEI，返回参数和SEI的位置
+func (c *nalCodec) findParams(nalus [][]byte) (*frameParams, int, error) {
+	for i, nalu := range nalus {
+		if !c.isSEI(nalu) {
+			continue
+		}
+		p, err := parseSEI(nalu, c.headerLength)
+		if err != nil {
+			return nil, i, err
+		}
+		if p != nil {
+			return p, i, nil
+		}
+	}
+	return nil, -1, nil
+}
+
+// crypt 加密或解密一个VCL NALU的RBSP，NALU header和最后一个字节保持明文
+// 最后一个字节包含rbsp_stop_one_bit，保证密文NALU不以0结尾；处理后重新插入防竞争字节
+func (c *nalCodec) crypt(block cipher.Block, iv [ivLength]byte, index int, nalu []byte) []byte {
+	rbsp := codec.RemoveEmulationPrevention(nalu)
+	if len(rbsp) <= c.headerLength+1 {
+		return nalu
+	}
+	counter := make([]byte, block.BlockSize())
+	copy(counter, iv[:])
+	binary.BigEndian.PutUint32(counter[ivLength:], uint32(index))
+	body := rbsp[c.headerLength : len(rbsp)-1]
+	cipher.NewCTR(block, counter).XORKeyStream(body, body)
+	return codec.AddEmulationPrevention(rbsp)
+}
+
+// Encryptor 加密h264/h265每一帧中的VCL NALU，在第一个VCL NALU前插入携带密钥ID和IV的SEI
+type Encryptor struct {
+	codec     *nalCodec
+	algorithm Algorithm
+	keys      KeyProvider
+
+	lock  sync.Mutex
+	key   *Key
+	block cipher.Block
+}
+
+// NewEncryptor codec为h264或h265
+func NewEncryptor(codecName string, algorithm Algorithm, keys KeyProvider) (*Encryptor, error) {
+	c, err := newNALCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := algorithm.newBlock(make([]byte, KeyLength)); err != nil {
+		return nil, err
+	}
+	return &Encryptor{codec: c, algorithm: algorithm, keys: keys}, nil
+}
+
+// Algorithm 加密算法
+func (e *Encryptor) Algorithm() Algorithm {
+	return e.algorithm
+}
+
+// CurrentKeyID 当前使用的密钥ID
+func (e *Encryptor) CurrentKeyID() (KeyID, error) {
+	key, err := e.keys.CurrentKey()
+	if err != nil {
+		return KeyID{}, err
+	}
+	return key.ID, nil
+}
+
+// Encrypt 加密一帧，返回新的NALU列表，不修改输入
+// 没有VCL NALU或已经携带加密参数的帧原样返回
+func (e *Encryptor) Encrypt(nalus [][]byte) ([][]byte, error) {
+	first := -1
+	for i, nalu := range nalus {
+		if e.codec.isVCL(nalu) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nalus, nil
+	}
+	if p, _, _ := e.codec.findParams(nalus); p != nil {
+		return nalus, nil
+	}
+
+	block, key, err := e.currentBlock()
+	if err != nil {
+		return nil, err
+	}
+	p := &frameParams{algorithm: e.algorithm, keyID: key.ID}
+	if _, err := rand.Read(p.iv[:]); err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(nalus)+1)
+	out = append(out, nalus[:first]...)
+	out = append(out, p.marshalSEI(e.codec.seiHeader))
+	index := 0
+	for _, nalu := range nalus[first:] {
+		if e.codec.isVCL(nalu) {
+			nalu = e.codec.crypt(block, p.iv, index, nalu)
+			index++
+		}
+		out = append(out, nalu)
+	}
+	return out, nil
+}
+
+// currentBlock 当前密钥的分组密码，密钥轮换后重新创建
+func (e *Encryptor) currentBlock() (cipher.Block, *Key, error) {
+	key, err := e.keys.CurrentKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.key != key {
+		block, err := e.algorithm.newBlock(key.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		e.key, e.block = key, block
+	}
+	return e.block, key, nil
+}
+
+// Decryptor 按帧中SEI携带的密钥ID和IV解密VCL NALU，并去掉该SEI
+type Decryptor struct {
+	codec *nalCodec
+	keys  KeyProvider
+
+	lock   sync.Mutex
+	blocks map[KeyID]cipher.Block
+}
+
+// NewDecryptor codec为h264或h265，keys 按密钥ID提供授权的密钥
+func NewDecryptor(codecName string, keys KeyProvider) (*Decryptor, error) {
+	c, err := newNALCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	return &Decryptor{codec: c, keys: keys, blocks: make(map[KeyID]cipher.Block)}, nil
+}
+
+// Decrypt 解密一帧，返回新的NALU列表，不修改输入，没有加密参数的帧原样返回
+func (d *Decryptor) Decrypt(nalus [][]byte) ([][]byte, error) {
+	p, seiIndex, err := d.codec.findParams(nalus)
+	if err != nil || p == nil {
+		return nalus, err
+	}
+	block, err := d.block(p)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(nalus)-1)
+	index := 0
+	for i, nalu := range nalus {
+		if i == seiIndex {
+			continue
+		}
+		if i > seiIndex && d.codec.isVCL(nalu) {
+			nalu = d.codec.crypt(block, p.iv, index, nalu)
+			index++
+		}
+		out = append(out, nalu)
+	}
+	return out, nil
+}
+
+// block 按密钥ID缓存分组密码，只保留最近使用的几个
+func (d *Decryptor) block(p *frameParams) (cipher.Block, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if block, ok := d.blocks[p.keyID]; ok {
+		return block, nil
+	}
+	key, err := d.keys.Key(p.keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := p.algorithm.newBlock(key.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.blocks) >= 4 {
+		d.blocks = make(map[KeyID]cipher.Block)
+	}
+	d.blocks[p.keyID] = block
+	return block, nil
+}
@@ -0,0 +1,165 @@
+package nalcrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// testKey 固定的密钥
+func testKey(b byte) *Key {
+	key := &Key{Value: bytes.Repeat([]byte{b}, KeyLength)}
+	for i := range key.ID {
+		key.ID[i] = b + byte(i)
+	}
+	return key
+}
+
+// testFrames h264和h265的测试帧，VCL NALU中包含需要防竞争字节的数据
+var testFrames = map[string]struct {
+	params [][]byte
+	vcl    [][]byte
+	sei    []byte
+}{
+	"h264": {
+		params: [][]byte{{0x67, 0x42, 0xc0, 0x1f}, {0x68, 0xcb, 0x83}},
+		vcl:    [][]byte{{0x65, 0x88, 0x00, 0x00, 0x03, 0x01, 0x11, 0x22, 0x33, 0x80}, {0x65, 0x00, 0x00, 0x03, 0x00, 0x44, 0x55, 0x66, 0x77, 0x88, 0x80}},
+		sei:    []byte{0x06, 0x05, 0x01, 0x00, 0x80},
+	},
+	"h265": {
+		params: [][]byte{{0x40, 0x01, 0x0c}, {0x42, 0x01, 0x01}, {0x44, 0x01, 0xc1}},
+		vcl:    [][]byte{{0x26, 0x01, 0xaf, 0x00, 0x00, 0x03, 0x02, 0x11, 0x22, 0x80}, {0x02, 0x01, 0xd0, 0x33, 0x44, 0x55, 0x66, 0x80}},
+		sei:    []byte{0x4e, 0x01, 0x05, 0x01, 0x00, 0x80},
+	},
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, codecName := range []string{"h264", "h265"} {
+		for _, algorithm := range []Algorithm{AlgorithmAES128CTR, AlgorithmSM4CTR} {
+			t.Run(codecName+" "+algorithm.String(), func(t *testing.T) {
+				frame := testFrames[codecName]
+				key := testKey(1)
+				encryptor, err := NewEncryptor(codecName, algorithm, NewStaticKeyProvider(key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decryptor, err := NewDecryptor(codecName, NewStaticKeyProvider(key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var nalus [][]byte
+				nalus = append(nalus, frame.params...)
+				nalus = append(nalus, frame.sei)
+				nalus = append(nalus, frame.vcl...)
+				input := codec.JoinAnnexB(nalus)
+
+				encrypted, err := encryptor.Encrypt(nalus)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(codec.JoinAnnexB(nalus), input) {
+					t.Errorf("input modified")
+				}
+				// 加密参数的SEI在第一个VCL NALU前，参数集和原有的SEI不加密
+				n := len(frame.params) + 1
+				if len(encrypted) != len(nalus)+1 || !bytes.Equal(codec.JoinAnnexB(encrypted[:n]), codec.JoinAnnexB(nalus[:n])) {
+					t.Fatalf("encrypted nalus %x", encrypted)
+				}
+				p, i, err := encryptor.codec.findParams(encrypted)
+				if err != nil || i != n || p.algorithm != algorithm || p.keyID != key.ID {
+					t.Fatalf("params %+v at %d: %v", p, i, err)
+				}
+				headerLength := encryptor.codec.headerLength
+				for j, vcl := range encrypted[n+1:] {
+					plain := frame.vcl[j]
+					if bytes.Equal(vcl, plain) || !bytes.Equal(vcl[:headerLength], plain[:headerLength]) || vcl[len(vcl)-1] != 0x80 {
+						t.Errorf("vcl %d encrypted %x", j, vcl)
+					}
+				}
+				// 密文中没有起始码竞争
+				if split := codec.SplitAnnexB(codec.JoinAnnexB(encrypted)); len(split) != len(encrypted) {
+					t.Errorf("start code emulation in ciphertext")
+				}
+				// 已加密的帧不再加密
+				if again, _ := encryptor.Encrypt(encrypted); len(again) != len(encrypted) {
+					t.Errorf("encrypted twice")
+				}
+
+				decrypted, err := decryptor.Decrypt(encrypted)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(codec.JoinAnnexB(decrypted), input) {
+					t.Errorf("decrypted %x, want %x", codec.JoinAnnexB(decrypted), input)
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptPassThrough(t *testing.T) {
+	encryptor, _ := NewEncryptor("h264", AlgorithmAES128CTR, NewStaticKeyProvider(testKey(1)))
+	decryptor, _ := NewDecryptor("h264", NewStaticKeyProvider(testKey(1)))
+	params := testFrames["h264"].params
+	if out, err := encryptor.Encrypt(params); err != nil || len(out) != len(params) {
+		t.Errorf("frame without vcl encrypted")
+	}
+	vcl := testFrames["h264"].vcl
+	if out, err := decryptor.Decrypt(vcl); err != nil || !bytes.Equal(codec.JoinAnnexB(out), codec.JoinAnnexB(vcl)) {
+		t.Errorf("unencrypted frame changed")
+	}
+}
+
+func TestDecryptKeys(t *testing.T) {
+	first, second := testKey(1), testKey(2)
+	keys := NewStaticKeyProvider(first)
+	encryptor, _ := NewEncryptor("h264", AlgorithmSM4CTR, keys)
+	vcl := testFrames["h264"].vcl
+	before, _ := encryptor.Encrypt(vcl)
+	keys.SetCurrentKey(second)
+	if id, _ := encryptor.CurrentKeyID(); id != second.ID {
+		t.Errorf("current key %v", id)
+	}
+	after, _ := encryptor.Encrypt(vcl)
+
+	tests := []struct {
+		name  string
+		keys  []*Key
+		frame [][]byte
+		ok    bool
+	}{
+		{"first key", []*Key{first}, before, true},
+		{"rotated key", []*Key{first, second}, after, true},
+		{"unauthorized key", []*Key{first}, after, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decryptor, _ := NewDecryptor("h264", NewStaticKeyProvider(tt.keys...))
+			out, err := decryptor.Decrypt(tt.frame)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err %v", err)
+			}
+			if tt.ok && !bytes.Equal(codec.JoinAnnexB(out), codec.JoinAnnexB(vcl)) {
+				t.Errorf("decrypted %x", out)
+			}
+		})
+	}
+}
+
+func TestNewEncryptorErrors(t *testing.T) {
+	keys := NewStaticKeyProvider(testKey(1))
+	if _, err := NewEncryptor("vp8", AlgorithmAES128CTR, keys); err == nil {
+		t.Errorf("vp8 accepted")
+	}
+	if _, err := NewEncryptor("h264", Algorithm(9), keys); err == nil {
+		t.Errorf("unknown algorithm accepted")
+	}
+	if _, err := NewDecryptor("av1", keys); err == nil {
+		t.Errorf("av1 accepted")
+	}
+	encryptor, _ := NewEncryptor("h264", AlgorithmAES128CTR, NewStaticKeyProvider())
+	if _, err := encryptor.Encrypt(testFrames["h264"].vcl); err == nil {
+		t.Errorf("encrypted without key")
+	}
+}
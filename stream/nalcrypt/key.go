@@ -0,0 +1,175 @@
+package nalcrypt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyID 密钥ID，随每一帧在SEI中携带
+type KeyID [16]byte
+
+// String 十六进制
+func (id KeyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// ParseKeyID 解析十六进制的密钥ID
+func ParseKeyID(s string) (KeyID, error) {
+	var id KeyID
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(id) {
+		return id, fmt.Errorf("nal encryption key id %q invalid", s)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// Key 内容密钥
+type Key struct {
+	ID    KeyID
+	Value []byte
+}
+
+// NewKey 生成随机的密钥ID和密钥
+func NewKey() (*Key, error) {
+	key := &Key{Value: make([]byte, KeyLength)}
+	if _, err := rand.Read(key.ID[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(key.Value); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyProvider 密钥提供者，加密端取当前密钥，解密端按SEI中的密钥ID取密钥
+type KeyProvider interface {
+	// CurrentKey 当前用于加密的密钥
+	CurrentKey() (*Key, error)
+	// Key 按密钥ID获取密钥，没有时返回错误
+	Key(id KeyID) (*Key, error)
+}
+
+// StaticKeyProvider 固定的密钥集合，解密端可在获取授权后添加密钥
+type StaticKeyProvider struct {
+	lock    sync.RWMutex
+	current *Key
+	keys    map[KeyID]*Key
+}
+
+// NewStaticKeyProvider 第一个密钥用于加密
+func NewStaticKeyProvider(keys ...*Key) *StaticKeyProvider {
+	p := &StaticKeyProvider{keys: make(map[KeyID]*Key)}
+	for _, key := range keys {
+		p.AddKey(key)
+	}
+	return p
+}
+
+// AddKey 添加密钥，没有当前密钥时作为当前密钥
+func (p *StaticKeyProvider) AddKey(key *Key) {
+	p.lock.Lock()
+	p.keys[key.ID] = key
+	if p.current == nil {
+		p.current = key
+	}
+	p.lock.Unlock()
+}
+
+// SetCurrentKey 设置用于加密的密钥
+func (p *StaticKeyProvider) SetCurrentKey(key *Key) {
+	p.lock.Lock()
+	p.keys[key.ID] = key
+	p.current = key
+	p.lock.Unlock()
+}
+
+func (p *StaticKeyProvider) CurrentKey() (*Key, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.current == nil {
+		return nil, fmt.Errorf("nal encryption no current key")
+	}
+	return p.current, nil
+}
+
+func (p *StaticKeyProvider) Key(id KeyID) (*Key, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("nal encryption key %v not found", id)
+}
+
+// RotatingKeyProvider 按周期轮换密钥，保留最近的密钥供解密
+type RotatingKeyProvider struct {
+	// Period 轮换周期
+	Period time.Duration
+	// Retain 保留的历史密钥数，默认为2
+	Retain int
+	// Generate 生成新的密钥，为nil时使用 NewKey
+	Generate func() (*Key, error)
+	// OnRotate 生成新的密钥后调用，用于将密钥分发给授权的解密端
+	OnRotate func(key *Key)
+
+	lock      sync.Mutex
+	current   *Key
+	rotatedAt time.Time
+	keys      []*Key
+}
+
+// NewRotatingKeyProvider 创建按周期轮换的密钥提供者
+func NewRotatingKeyProvider(period time.Duration) *RotatingKeyProvider {
+	return &RotatingKeyProvider{Period: period, Retain: 2}
+}
+
+// CurrentKey 到达轮换周期时生成新的密钥
+func (p *RotatingKeyProvider) CurrentKey() (*Key, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	if p.current != nil && (p.Period <= 0 || now.Sub(p.rotatedAt) < p.Period) {
+		return p.current, nil
+	}
+	generate := p.Generate
+	if generate == nil {
+		generate = NewKey
+	}
+	key, err := generate()
+	if err != nil {
+		if p.current != nil {
+			// 生成失败时继续使用当前密钥
+			return p.current, nil
+		}
+		return nil, err
+	}
+	p.current, p.rotatedAt = key, now
+	retain := p.Retain
+	if retain <= 0 {
+		retain = 2
+	}
+	p.keys = append(p.keys, key)
+	if len(p.keys) > retain+1 {
+		p.keys = p.keys[len(p.keys)-retain-1:]
+	}
+	if p.OnRotate != nil {
+		p.OnRotate(key)
+	}
+	return key, nil
+}
+
+// Key 当前密钥和保留的历史密钥
+func (p *RotatingKeyProvider) Key(id KeyID) (*Key, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, key := range p.keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("nal encryption key %v not found", id)
+}
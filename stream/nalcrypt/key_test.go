@@ -0,0 +1,71 @@
+package nalcrypt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRotatingKeyProvider(t *testing.T) {
+	n := 0
+	var rotated []*Key
+	p := NewRotatingKeyProvider(time.Hour)
+	p.Retain = 1
+	p.Generate = func() (*Key, error) {
+		n++
+		return testKey(byte(n)), nil
+	}
+	p.OnRotate = func(key *Key) { rotated = append(rotated, key) }
+
+	first, err := p.CurrentKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := p.CurrentKey(); again != first {
+		t.Errorf("rotated within period")
+	}
+	// 到达周期后轮换，保留一个历史密钥
+	for i := 0; i < 2; i++ {
+		p.rotatedAt = p.rotatedAt.Add(-time.Hour)
+		p.CurrentKey()
+	}
+	current, _ := p.CurrentKey()
+	if current.ID != testKey(3).ID || len(rotated) != 3 {
+		t.Fatalf("current %v, rotated %d", current.ID, len(rotated))
+	}
+	tests := []struct {
+		id    KeyID
+		found bool
+	}{
+		{testKey(1).ID, false},
+		{testKey(2).ID, true},
+		{testKey(3).ID, true},
+	}
+	for _, tt := range tests {
+		if _, err := p.Key(tt.id); (err == nil) != tt.found {
+			t.Errorf("key %v found %v", tt.id, err == nil)
+		}
+	}
+
+	// 生成失败时继续使用当前密钥
+	p.Generate = func() (*Key, error) { return nil, fmt.Errorf("failed") }
+	p.rotatedAt = p.rotatedAt.Add(-time.Hour)
+	if key, err := p.CurrentKey(); err != nil || key != current {
+		t.Errorf("key %v %v", key, err)
+	}
+}
+
+func TestParseKeyID(t *testing.T) {
+	id := testKey(9).ID
+	if parsed, err := ParseKeyID(id.String()); err != nil || parsed != id {
+		t.Errorf("parsed %v %v", parsed, err)
+	}
+	for _, s := range []string{"", "0102", "zz" + id.String()[2:], id.String() + "00"} {
+		if _, err := ParseKeyID(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+	if _, err := NewStaticKeyProvider().CurrentKey(); err == nil {
+		t.Errorf("empty provider returned a key")
+	}
+}
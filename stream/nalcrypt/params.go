@@ -0,0 +1,46 @@
+package nalcrypt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SDPAttribute sdp中声明加密参数的媒体级属性名称
+const SDPAttribute = "x-nal-encryption"
+
+// Params sdp中声明的加密参数，如 a=x-nal-encryption:alg=SM4-CTR;kid=<十六进制密钥ID>
+// 密钥ID为生成sdp时的密钥，轮换后以每帧SEI中的为准
+type Params struct {
+	Algorithm Algorithm
+	KeyID     KeyID
+}
+
+// ParseParams 解析属性值
+func ParseParams(val string) (*Params, error) {
+	p := &Params{}
+	for _, param := range strings.Split(val, ";") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var err error
+		switch strings.ToLower(kv[0]) {
+		case "alg":
+			p.Algorithm, err = ParseAlgorithm(kv[1])
+		case "kid":
+			p.KeyID, err = ParseKeyID(kv[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.Algorithm == 0 {
+		return nil, fmt.Errorf("nal encryption sdp %q missing alg", val)
+	}
+	return p, nil
+}
+
+// String 属性值
+func (p *Params) String() string {
+	return fmt.Sprintf("alg=%v;kid=%v", p.Algorithm, p.KeyID)
+}
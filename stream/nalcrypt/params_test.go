@@ -0,0 +1,41 @@
+package nalcrypt
+
+import "testing"
+
+func TestParseParams(t *testing.T) {
+	id := testKey(7).ID
+	tests := []struct {
+		name      string
+		val       string
+		algorithm Algorithm
+		keyID     KeyID
+		err       bool
+	}{
+		{"sm4", "alg=SM4-CTR;kid=" + id.String(), AlgorithmSM4CTR, id, false},
+		{"aes lowercase with spaces", "kid=" + id.String() + "; alg=aes-128-ctr", AlgorithmAES128CTR, id, false},
+		{"without kid", "alg=SM4-CTR", AlgorithmSM4CTR, KeyID{}, false},
+		{"missing alg", "kid=" + id.String(), 0, KeyID{}, true},
+		{"unknown alg", "alg=ChaCha20", 0, KeyID{}, true},
+		{"invalid kid", "alg=SM4-CTR;kid=1234", 0, KeyID{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseParams(tt.val)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parsed %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Algorithm != tt.algorithm || p.KeyID != tt.keyID {
+				t.Errorf("params %+v", p)
+			}
+			if again, err := ParseParams(p.String()); err != nil || *again != *p {
+				t.Errorf("round trip %q %v", p.String(), err)
+			}
+		})
+	}
+}
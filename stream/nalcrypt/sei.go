@@ -0,0 +1,93 @@
+package nalcrypt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// seiUUID user_data_unregistered SEI中标识加密参数的UUID
+var seiUUID = [16]byte{0x9a, 0x1f, 0x4c, 0x2e, 0x7b, 0x3d, 0x4e, 0x8a, 0xb5, 0xc6, 0x0d, 0x2e, 0x9f, 0x81, 0x7a, 0x43}
+
+const (
+	// seiVersion 加密参数的版本
+	seiVersion = 1
+	// seiPayloadTypeUserData user_data_unregistered
+	seiPayloadTypeUserData = 5
+	// ivLength 每帧的IV长度，计数器块为 IV(8) || VCL NALU序号(4) || 块计数(4)
+	ivLength = 8
+)
+
+// frameParams 一帧的加密参数，以SEI在第一个VCL NALU前携带
+// UUID(16) | 版本(1) | 算法(1) | 密钥ID(16) | IV(8)
+type frameParams struct {
+	algorithm Algorithm
+	keyID     KeyID
+	iv        [ivLength]byte
+}
+
+// marshalSEI 生成携带加密参数的SEI NALU
+func (p *frameParams) marshalSEI(header []byte) []byte {
+	payload := make([]byte, 0, 16+2+16+ivLength)
+	payload = append(payload, seiUUID[:]...)
+	payload = append(payload, seiVersion, byte(p.algorithm))
+	payload = append(payload, p.keyID[:]...)
+	payload = append(payload, p.iv[:]...)
+
+	rbsp := append([]byte(nil), header...)
+	rbsp = append(rbsp, seiPayloadTypeUserData, byte(len(payload)))
+	rbsp = append(rbsp, payload...)
+	// rbsp_trailing_bits
+	rbsp = append(rbsp, 0x80)
+	return codec.AddEmulationPrevention(rbsp)
+}
+
+// parseSEI 从SEI NALU中查找加密参数，没有时返回nil
+func parseSEI(nalu []byte, headerLength int) (*frameParams, error) {
+	rbsp := codec.RemoveEmulationPrevention(nalu)
+	if len(rbsp) <= headerLength {
+		return nil, nil
+	}
+	b := rbsp[headerLength:]
+	for len(b) > 1 {
+		payloadType, n := readSEIValue(b)
+		b = b[n:]
+		size, n := readSEIValue(b)
+		b = b[n:]
+		if size > len(b) {
+			return nil, fmt.Errorf("sei payload size %d exceeds nalu", size)
+		}
+		payload := b[:size]
+		b = b[size:]
+		if payloadType != seiPayloadTypeUserData || size < len(seiUUID) || !bytes.Equal(payload[:len(seiUUID)], seiUUID[:]) {
+			continue
+		}
+		payload = payload[len(seiUUID):]
+		if len(payload) < 2+len(KeyID{})+ivLength {
+			return nil, fmt.Errorf("nal encryption sei too short: %d", len(payload))
+		}
+		if payload[0] != seiVersion {
+			return nil, fmt.Errorf("nal encryption sei version %d not supported", payload[0])
+		}
+		p := &frameParams{algorithm: Algorithm(payload[1])}
+		copy(p.keyID[:], payload[2:])
+		copy(p.iv[:], payload[2+len(p.keyID):])
+		return p, nil
+	}
+	return nil, nil
+}
+
+// readSEIValue 读取以0xFF累加编码的payloadType或payloadSize，返回值和读取的字节数
+func readSEIValue(b []byte) (int, int) {
+	v, n := 0, 0
+	for n < len(b) {
+		c := b[n]
+		n++
+		v += int(c)
+		if c != 0xFF {
+			break
+		}
+	}
+	return v, n
+}
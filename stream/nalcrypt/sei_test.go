@@ -0,0 +1,83 @@
+package nalcrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameParamsSEI(t *testing.T) {
+	p := &frameParams{algorithm: AlgorithmSM4CTR, keyID: testKey(0).ID, iv: [ivLength]byte{0, 0, 0, 1, 0, 0, 0, 2}}
+	tests := []struct {
+		name         string
+		header       []byte
+		headerLength int
+	}{
+		{"h264", []byte{0x06}, 1},
+		{"h265", []byte{0x4e, 0x01}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sei := p.marshalSEI(tt.header)
+			if !bytes.Equal(sei[:tt.headerLength], tt.header) || sei[len(sei)-1] != 0x80 {
+				t.Errorf("sei %x", sei)
+			}
+			// IV和密钥ID中的0需要防竞争字节
+			if bytes.Contains(sei, []byte{0, 0, 0}) || bytes.Contains(sei, []byte{0, 0, 1}) {
+				t.Errorf("sei without emulation prevention %x", sei)
+			}
+			got, err := parseSEI(sei, tt.headerLength)
+			if err != nil || got == nil || *got != *p {
+				t.Errorf("parsed %+v %v", got, err)
+			}
+		})
+	}
+}
+
+func TestParseSEI(t *testing.T) {
+	p := &frameParams{algorithm: AlgorithmAES128CTR, keyID: testKey(3).ID}
+	sei := p.marshalSEI([]byte{0x06})
+	payload := sei[1 : len(sei)-1]
+	versioned := append([]byte(nil), sei...)
+	versioned[3+len(seiUUID)] = 2
+	tests := []struct {
+		name  string
+		nalu  []byte
+		found bool
+		err   bool
+	}{
+		{"params", sei, true, false},
+		// 前面有其他SEI消息
+		{"after other messages", append([]byte{0x06, 0x01, 0x02, 0xAA, 0xBB, 0x05, 0x03, 0x01, 0x02, 0x03}, append(payload, 0x80)...), true, false},
+		{"other uuid", []byte{0x06, 0x05, 0x10, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 0x80}, false, false},
+		{"header only", []byte{0x06}, false, false},
+		{"truncated", []byte{0x06, 0x05, 0x30, 0x01}, false, true},
+		{"version", versioned, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSEI(tt.nalu, 1)
+			if (err != nil) != tt.err || (got != nil) != tt.found {
+				t.Fatalf("parsed %+v %v", got, err)
+			}
+			if tt.found && *got != *p {
+				t.Errorf("params %+v", got)
+			}
+		})
+	}
+}
+
+func TestReadSEIValue(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		v, n int
+	}{
+		{[]byte{0x05}, 5, 1},
+		{[]byte{0xFF, 0x01}, 256, 2},
+		{[]byte{0xFF, 0xFF, 0x00, 0x07}, 510, 3},
+	}
+	for _, tt := range tests {
+		if v, n := readSEIValue(tt.b); v != tt.v || n != tt.n {
+			t.Errorf("%x: %d %d, want %d %d", tt.b, v, n, tt.v, tt.n)
+		}
+	}
+}
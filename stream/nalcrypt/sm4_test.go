@@ -0,0 +1,47 @@
+package nalcrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestSM4 GB/T 32907-2016 附录A的示例
+func TestSM4(t *testing.T) {
+	key, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+	tests := []struct {
+		name       string
+		iterations int
+		want       string
+	}{
+		{"once", 1, "681edf34d206965e86b3e94f536e4246"},
+		{"1000000 times", 1000000, "595298c7c6fd271f0402f804c33d3f66"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.iterations > 1 && testing.Short() {
+				t.Skip("skipped in short mode")
+			}
+			block, err := NewSM4Cipher(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := append([]byte(nil), key...)
+			for i := 0; i < tt.iterations; i++ {
+				block.Encrypt(b, b)
+			}
+			if got := hex.EncodeToString(b); got != tt.want {
+				t.Fatalf("ciphertext %s, want %s", got, tt.want)
+			}
+			for i := 0; i < tt.iterations; i++ {
+				block.Decrypt(b, b)
+			}
+			if !bytes.Equal(b, key) {
+				t.Errorf("decrypted %x", b)
+			}
+		})
+	}
+	if _, err := NewSM4Cipher(key[:15]); err == nil {
+		t.Errorf("short key accepted")
+	}
+}
@@ -0,0 +1,50 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ApplicationDefined 应用自定义包(APP)
+type ApplicationDefined struct {
+	SubType uint8
+	SSRC    uint32
+	// Name 4个ASCII字符
+	Name string
+	// Data 长度需为4的倍数
+	Data []byte
+}
+
+func (a *ApplicationDefined) Marshal() ([]byte, error) {
+	if a.SubType > maxCount {
+		return nil, fmt.Errorf("rtcp APP subtype %d out of range", a.SubType)
+	}
+	if len(a.Name) != 4 {
+		return nil, fmt.Errorf("rtcp APP name must be 4 characters: %q", a.Name)
+	}
+	if len(a.Data)%4 != 0 {
+		return nil, fmt.Errorf("rtcp APP data not aligned: %d", len(a.Data))
+	}
+	b := make([]byte, HeaderLength+8+len(a.Data))
+	h := Header{Count: a.SubType, Type: TypeApplicationDefined}
+	h.marshalTo(b)
+	binary.BigEndian.PutUint32(b[4:], a.SSRC)
+	copy(b[8:], a.Name)
+	copy(b[12:], a.Data)
+	return b, nil
+}
+
+func (a *ApplicationDefined) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeApplicationDefined)
+	if err != nil {
+		return err
+	}
+	if len(b) < 8 {
+		return fmt.Errorf("rtcp APP too short: %d", len(b))
+	}
+	a.SubType = h.Count
+	a.SSRC = binary.BigEndian.Uint32(b)
+	a.Name = string(b[4:8])
+	a.Data = append([]byte(nil), b[8:]...)
+	return nil
+}
@@ -0,0 +1,62 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Goodbye 源离开(BYE)
+type Goodbye struct {
+	Sources []uint32
+	Reason  string
+}
+
+func (g *Goodbye) Marshal() ([]byte, error) {
+	if len(g.Sources) > maxCount {
+		return nil, fmt.Errorf("rtcp BYE has too many sources: %d", len(g.Sources))
+	}
+	if len(g.Reason) > 255 {
+		return nil, fmt.Errorf("rtcp BYE reason too long: %d", len(g.Reason))
+	}
+	size := HeaderLength + 4*len(g.Sources)
+	if g.Reason != "" {
+		size += (1 + len(g.Reason) + 3) / 4 * 4
+	}
+	b := make([]byte, size)
+	h := Header{Count: uint8(len(g.Sources)), Type: TypeGoodbye}
+	h.marshalTo(b)
+	offset := HeaderLength
+	for _, ssrc := range g.Sources {
+		binary.BigEndian.PutUint32(b[offset:], ssrc)
+		offset += 4
+	}
+	if g.Reason != "" {
+		b[offset] = byte(len(g.Reason))
+		copy(b[offset+1:], g.Reason)
+	}
+	return b, nil
+}
+
+func (g *Goodbye) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeGoodbye)
+	if err != nil {
+		return err
+	}
+	count := int(h.Count)
+	if len(b) < 4*count {
+		return fmt.Errorf("rtcp BYE %d sources exceed data %d", count, len(b))
+	}
+	g.Sources = make([]uint32, count)
+	for i := range g.Sources {
+		g.Sources[i] = binary.BigEndian.Uint32(b[4*i:])
+	}
+	g.Reason = ""
+	if b = b[4*count:]; len(b) > 0 {
+		length := int(b[0])
+		if len(b)-1 < length {
+			return fmt.Errorf("rtcp BYE reason truncated")
+		}
+		g.Reason = string(b[1 : 1+length])
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FormatNack 传输层反馈中通用NACK的FMT值
+const FormatNack = 1
+
+// NackPair 通用NACK的一项，PacketID及其后16个包中丢失的包(RFC 4585 6.2.1)
+type NackPair struct {
+	PacketID uint16
+	// LostPackets 第i位表示PacketID+i+1丢失
+	LostPackets uint16
+}
+
+// PacketList 丢失的包序号
+func (n NackPair) PacketList() []uint16 {
+	seqs := []uint16{n.PacketID}
+	for i := uint16(0); i < 16; i++ {
+		if n.LostPackets&(1<<i) != 0 {
+			seqs = append(seqs, n.PacketID+i+1)
+		}
+	}
+	return seqs
+}
+
+// NackPairsFromSequenceNumbers 将递增的丢失序号合并为NACK项
+func NackPairsFromSequenceNumbers(seqs []uint16) []NackPair {
+	var pairs []NackPair
+	for _, seq := range seqs {
+		if n := len(pairs); n > 0 {
+			if diff := seq - pairs[n-1].PacketID; diff >= 1 && diff <= 16 {
+				pairs[n-1].LostPackets |= 1 << (diff - 1)
+				continue
+			}
+		}
+		pairs = append(pairs, NackPair{PacketID: seq})
+	}
+	return pairs
+}
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |V=2|P| FMT=1   |   PT=RTPFB=205|             length            |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                  SSRC of packet sender                        |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                  SSRC of media source                         |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |            PID                |             BLP               |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// TransportLayerNack 通用NACK，请求重传丢失的rtp包
+type TransportLayerNack struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+	Nacks      []NackPair
+}
+
+// PacketList 请求重传的全部序号
+func (n *TransportLayerNack) PacketList() []uint16 {
+	var seqs []uint16
+	for _, pair := range n.Nacks {
+		seqs = append(seqs, pair.PacketList()...)
+	}
+	return seqs
+}
+
+func (n *TransportLayerNack) Marshal() ([]byte, error) {
+	if len(n.Nacks) == 0 {
+		return nil, fmt.Errorf("rtcp NACK is empty")
+	}
+	b := make([]byte, HeaderLength+8+4*len(n.Nacks))
+	h := Header{Count: FormatNack, Type: TypeTransportSpecificFeedback}
+	h.marshalTo(b)
+	binary.BigEndian.PutUint32(b[4:], n.SenderSSRC)
+	binary.BigEndian.PutUint32(b[8:], n.MediaSSRC)
+	for i, pair := range n.Nacks {
+		binary.BigEndian.PutUint16(b[12+4*i:], pair.PacketID)
+		binary.BigEndian.PutUint16(b[14+4*i:], pair.LostPackets)
+	}
+	return b, nil
+}
+
+func (n *TransportLayerNack) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeTransportSpecificFeedback)
+	if err != nil {
+		return err
+	}
+	if h.Count != FormatNack {
+		return fmt.Errorf("rtcp transport feedback format %d is not NACK", h.Count)
+	}
+	if len(b) < 8 || (len(b)-8)%4 != 0 {
+		return fmt.Errorf("rtcp NACK invalid length: %d", len(b))
+	}
+	n.SenderSSRC = binary.BigEndian.Uint32(b)
+	n.MediaSSRC = binary.BigEndian.Uint32(b[4:])
+	n.Nacks = make([]NackPair, (len(b)-8)/4)
+	for i := range n.Nacks {
+		n.Nacks[i].PacketID = binary.BigEndian.Uint16(b[8+4*i:])
+		n.Nacks[i].LostPackets = binary.BigEndian.Uint16(b[10+4*i:])
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package rtcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNackPairsFromSequenceNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		seqs  []uint16
+		pairs []NackPair
+	}{
+		{"single", []uint16{100}, []NackPair{{100, 0}}},
+		{"bitmask", []uint16{100, 101, 103, 116}, []NackPair{{100, 0x8005}}},
+		{"next pair", []uint16{100, 117}, []NackPair{{100, 0}, {117, 0}}},
+		{"wrap", []uint16{65535, 0, 2}, []NackPair{{65535, 0x0005}}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs := NackPairsFromSequenceNumbers(tt.seqs)
+			if !reflect.DeepEqual(pairs, tt.pairs) {
+				t.Fatalf("pairs %v, want %v", pairs, tt.pairs)
+			}
+			nack := &TransportLayerNack{Nacks: pairs}
+			if got := nack.PacketList(); !reflect.DeepEqual(got, tt.seqs) {
+				t.Errorf("packet list %v, want %v", got, tt.seqs)
+			}
+		})
+	}
+}
+
+func TestTransportLayerNack(t *testing.T) {
+	nack := &TransportLayerNack{SenderSSRC: 0x01020304, MediaSSRC: 0x05060708, Nacks: []NackPair{{100, 0x8005}, {200, 0}}}
+	b, err := nack.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x81, 205, 0x00, 0x04,
+		0x01, 0x02, 0x03, 0x04,
+		0x05, 0x06, 0x07, 0x08,
+		0x00, 0x64, 0x80, 0x05,
+		0x00, 0xC8, 0x00, 0x00,
+	}
+	if !reflect.DeepEqual(b, want) {
+		t.Fatalf("marshal %x, want %x", b, want)
+	}
+	packets, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := packets[0].(*TransportLayerNack); !ok || !reflect.DeepEqual(got, nack) {
+		t.Errorf("unmarshal %v", packets[0])
+	}
+	if _, err := (&TransportLayerNack{}).Marshal(); err == nil {
+		t.Errorf("empty nack marshalled")
+	}
+	b[0] = 0x82
+	if err := (&TransportLayerNack{}).Unmarshal(b); err == nil {
+		t.Errorf("non-NACK feedback accepted")
+	}
+}
@@ -0,0 +1,34 @@
+package rtcp
+
+import "time"
+
+// ntpEpochOffset 1900年到1970年的秒数
+const ntpEpochOffset = 2208988800
+
+// NTPTime 时间转换为NTP 32.32定点数
+func NTPTime(t time.Time) uint64 {
+	nanos := uint64(t.UnixNano()) + ntpEpochOffset*uint64(time.Second)
+	seconds := nanos / uint64(time.Second)
+	fraction := (nanos % uint64(time.Second)) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// TimeFromNTP NTP 32.32定点数转换为时间
+func TimeFromNTP(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanos := int64((ntp & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanos)
+}
+
+// MiddleNTP NTP时间的中间32位，用于接收报告中的LSR
+func MiddleNTP(ntp uint64) uint32 {
+	return uint32(ntp >> 16)
+}
+
+// DelaySince 距离t的间隔，单位为1/65536秒，用于接收报告中的DLSR
+func DelaySince(t time.Time, now time.Time) uint32 {
+	if t.IsZero() || now.Before(t) {
+		return 0
+	}
+	return uint32(now.Sub(t) * 65536 / time.Second)
+}
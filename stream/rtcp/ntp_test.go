@@ -0,0 +1,46 @@
+package rtcp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNTPTime(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		ntp  uint64
+	}{
+		{time.Unix(0, 0), 2208988800 << 32},
+		{time.Unix(1, 500000000), (2208988801 << 32) | 0x80000000},
+		{time.Date(2024, 1, 1, 0, 0, 0, 250000000, time.UTC), (3913056000 << 32) | 0x40000000},
+	}
+	for _, tt := range tests {
+		if got := NTPTime(tt.time); got != tt.ntp {
+			t.Errorf("NTPTime(%v) = %x, want %x", tt.time, got, tt.ntp)
+		}
+		if got := TimeFromNTP(tt.ntp); !got.Equal(tt.time) {
+			t.Errorf("TimeFromNTP(%x) = %v, want %v", tt.ntp, got, tt.time)
+		}
+	}
+	if got := MiddleNTP(0x0123456789abcdef); got != 0x456789ab {
+		t.Errorf("MiddleNTP = %x", got)
+	}
+}
+
+func TestDelaySince(t *testing.T) {
+	now := time.Unix(100, 0)
+	tests := []struct {
+		name string
+		t    time.Time
+		want uint32
+	}{
+		{"zero", time.Time{}, 0},
+		{"future", now.Add(time.Second), 0},
+		{"1.5s", now.Add(-1500 * time.Millisecond), 0x18000},
+	}
+	for _, tt := range tests {
+		if got := DelaySince(tt.t, now); got != tt.want {
+			t.Errorf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
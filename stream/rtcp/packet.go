@@ -0,0 +1,198 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// PacketType rtcp包类型
+type PacketType uint8
+
+const (
+	TypeSenderReport       PacketType = 200
+	TypeReceiverReport     PacketType = 201
+	TypeSourceDescription  PacketType = 202
+	TypeGoodbye            PacketType = 203
+	TypeApplicationDefined PacketType = 204
+	// TypeTransportSpecificFeedback 传输层反馈(RFC 4585)
+	TypeTransportSpecificFeedback PacketType = 205
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case TypeSenderReport:
+		return "SR"
+	case TypeReceiverReport:
+		return "RR"
+	case TypeSourceDescription:
+		return "SDES"
+	case TypeGoodbye:
+		return "BYE"
+	case TypeApplicationDefined:
+		return "APP"
+	case TypeTransportSpecificFeedback:
+		return "RTPFB"
+	}
+	return fmt.Sprintf("PT%d", uint8(t))
+}
+
+const (
+	// HeaderLength rtcp公共头部长度
+	HeaderLength = 4
+	version      = 2
+	// 5位的计数字段最大值
+	maxCount = 31
+)
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |V=2|P|    RC   |   PT          |             length            |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// Header rtcp公共头部(RFC 3550 6.4)
+type Header struct {
+	Padding bool
+	// Count 报告块、源或子类型的数量
+	Count uint8
+	Type  PacketType
+	// Length 包长度，以32位字计数并减1
+	Length uint16
+}
+
+// Unmarshal 解析公共头部
+func (h *Header) Unmarshal(b []byte) error {
+	if len(b) < HeaderLength {
+		return fmt.Errorf("rtcp header too short: %d", len(b))
+	}
+	if v := b[0] >> 6; v != version {
+		return fmt.Errorf("rtcp version %d not supported", v)
+	}
+	h.Padding = b[0]&0x20 != 0
+	h.Count = b[0] & 0x1F
+	h.Type = PacketType(b[1])
+	h.Length = binary.BigEndian.Uint16(b[2:])
+	return nil
+}
+
+// marshalTo 写入公共头部，b的长度需为4的倍数
+func (h *Header) marshalTo(b []byte) {
+	b[0] = version<<6 | h.Count&0x1F
+	if h.Padding {
+		b[0] |= 0x20
+	}
+	b[1] = byte(h.Type)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)/4-1))
+}
+
+// Packet rtcp包
+type Packet interface {
+	Marshal() ([]byte, error)
+	Unmarshal(b []byte) error
+}
+
+// Unmarshal 解析复合包，未识别的类型解析为RawPacket
+func Unmarshal(b []byte) ([]Packet, error) {
+	var packets []Packet
+	for len(b) > 0 {
+		var h Header
+		if err := h.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		size := (int(h.Length) + 1) * 4
+		if len(b) < size {
+			return nil, fmt.Errorf("rtcp %v length %d exceeds data %d", h.Type, size, len(b))
+		}
+		var pkt Packet
+		switch h.Type {
+		case TypeSenderReport:
+			pkt = &SenderReport{}
+		case TypeReceiverReport:
+			pkt = &ReceiverReport{}
+		case TypeSourceDescription:
+			pkt = &SourceDescription{}
+		case TypeGoodbye:
+			pkt = &Goodbye{}
+		case TypeApplicationDefined:
+			pkt = &ApplicationDefined{}
+		case TypeTransportSpecificFeedback:
+			if h.Count == FormatNack {
+				pkt = &TransportLayerNack{}
+			} else {
+				pkt = &RawPacket{}
+			}
+		default:
+			pkt = &RawPacket{}
+		}
+		if err := pkt.Unmarshal(b[:size]); err != nil {
+			return nil, err
+		}
+		packets = append(packets, pkt)
+		b = b[size:]
+	}
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("rtcp packet is empty")
+	}
+	return packets, nil
+}
+
+// Marshal 将多个rtcp包编码为复合包
+func Marshal(packets ...Packet) ([]byte, error) {
+	var out []byte
+	for _, pkt := range packets {
+		b, err := pkt.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// body 校验类型并去掉头部和填充，返回头部和包体
+func body(b []byte, t PacketType) (*Header, []byte, error) {
+	h := &Header{}
+	if err := h.Unmarshal(b); err != nil {
+		return nil, nil, err
+	}
+	if h.Type != t {
+		return nil, nil, fmt.Errorf("rtcp packet type %v is not %v", h.Type, t)
+	}
+	size := (int(h.Length) + 1) * 4
+	if len(b) < size {
+		return nil, nil, fmt.Errorf("rtcp %v length %d exceeds data %d", t, size, len(b))
+	}
+	b = b[HeaderLength:size]
+	if h.Padding {
+		if len(b) == 0 || int(b[len(b)-1]) == 0 || int(b[len(b)-1]) > len(b) {
+			return nil, nil, fmt.Errorf("rtcp %v invalid padding", t)
+		}
+		b = b[:len(b)-int(b[len(b)-1])]
+	}
+	return h, b, nil
+}
+
+// RawPacket 未识别类型的rtcp包，保留原始数据
+type RawPacket []byte
+
+// Header 解析公共头部
+func (p RawPacket) Header() (*Header, error) {
+	h := &Header{}
+	return h, h.Unmarshal(p)
+}
+
+func (p RawPacket) Marshal() ([]byte, error) {
+	return append([]byte(nil), p...), nil
+}
+
+func (p *RawPacket) Unmarshal(b []byte) error {
+	var h Header
+	if err := h.Unmarshal(b); err != nil {
+		return err
+	}
+	*p = append((*p)[:0], b...)
+	return nil
+}
@@ -0,0 +1,183 @@
+package rtcp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		want Packet
+	}{
+		{
+			name: "receiver report",
+			raw: []byte{
+				0x81, 0xc9, 0x00, 0x07,
+				0x90, 0x2f, 0x9e, 0x2e,
+				0xbc, 0x5e, 0x9a, 0x40, 0x40, 0xff, 0xff, 0xfe, 0x00, 0x01, 0x46, 0x09,
+				0x00, 0x00, 0x01, 0x02, 0x9d, 0x8e, 0x4f, 0x26, 0x00, 0x01, 0x80, 0x00,
+			},
+			want: &ReceiverReport{SSRC: 0x902f9e2e, Reports: []ReceptionReport{{
+				SSRC: 0xbc5e9a40, FractionLost: 0x40, TotalLost: -2, LastSequenceNumber: 0x14609,
+				Jitter: 0x102, LastSenderReport: 0x9d8e4f26, Delay: 0x18000,
+			}}},
+		},
+		{
+			name: "sender report with extension",
+			raw: []byte{
+				0x80, 0xc8, 0x00, 0x07,
+				0x00, 0x00, 0x00, 0x01,
+				0xe9, 0x52, 0x6a, 0x80, 0x80, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x0b, 0xb8, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x03, 0xe8,
+				0xde, 0xad, 0xbe, 0xef,
+			},
+			want: &SenderReport{SSRC: 1, NTPTime: 0xe9526a8080000000, RTPTime: 3000, PacketCount: 10,
+				OctetCount: 1000, Reports: []ReceptionReport{}, ProfileExtensions: []byte{0xde, 0xad, 0xbe, 0xef}},
+		},
+		{
+			name: "sdes",
+			raw: []byte{
+				0x81, 0xca, 0x00, 0x04,
+				0x00, 0x00, 0x00, 0x01,
+				0x01, 0x04, 'h', 'o', 's', 't', 0x06, 0x02, 'g', 'o', 0x00, 0x00,
+			},
+			want: &SourceDescription{Chunks: []SDESChunk{{Source: 1, Items: []SDESItem{
+				{Type: SDESCNAME, Text: "host"}, {Type: SDESTool, Text: "go"},
+			}}}},
+		},
+		{
+			name: "bye with reason",
+			raw: []byte{
+				0x82, 0xcb, 0x00, 0x04,
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+				0x04, 'q', 'u', 'i', 't', 0x00, 0x00, 0x00,
+			},
+			want: &Goodbye{Sources: []uint32{1, 2}, Reason: "quit"},
+		},
+		{
+			name: "app",
+			raw: []byte{
+				0x83, 0xcc, 0x00, 0x03,
+				0x00, 0x00, 0x00, 0x01, 'T', 'E', 'S', 'T', 0x01, 0x02, 0x03, 0x04,
+			},
+			want: &ApplicationDefined{SubType: 3, SSRC: 1, Name: "TEST", Data: []byte{1, 2, 3, 4}},
+		},
+		{
+			name: "unknown type",
+			raw:  []byte{0x80, 0xcf, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01},
+			want: &RawPacket{0x80, 0xcf, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, err := Unmarshal(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packets) != 1 || !reflect.DeepEqual(packets[0], tt.want) {
+				t.Fatalf("got %+v, want %+v", packets, tt.want)
+			}
+			b, err := tt.want.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("marshal %x, want %x", b, tt.raw)
+			}
+		})
+	}
+}
+
+func TestCompoundPacket(t *testing.T) {
+	rr := &ReceiverReport{SSRC: 1, Reports: []ReceptionReport{{SSRC: 2, TotalLost: 5, LastSequenceNumber: 100}}}
+	sdes := NewCNAME(1, "receiver")
+	bye := &Goodbye{Sources: []uint32{1}}
+	b, err := Marshal(rr, sdes, bye)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("got %d packets", len(packets))
+	}
+	if !reflect.DeepEqual(packets[0], rr) || !reflect.DeepEqual(packets[2], bye) {
+		t.Errorf("got %+v", packets)
+	}
+	if cname, ok := packets[1].(*SourceDescription).CNAME(1); !ok || cname != "receiver" {
+		t.Errorf("cname %q %v", cname, ok)
+	}
+	if _, ok := packets[1].(*SourceDescription).CNAME(2); ok {
+		t.Errorf("cname for unknown source")
+	}
+}
+
+func TestPadding(t *testing.T) {
+	raw := []byte{
+		0xa1, 0xcb, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x04,
+	}
+	var bye Goodbye
+	if err := bye.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bye, Goodbye{Sources: []uint32{1}}) {
+		t.Errorf("got %+v", bye)
+	}
+	raw[11] = 0x05
+	if err := bye.Unmarshal(raw); err == nil {
+		t.Errorf("padding longer than body: expected error")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"short header", []byte{0x80, 0xc9}},
+		{"version 1", []byte{0x40, 0xc9, 0x00, 0x01, 0, 0, 0, 1}},
+		{"length exceeds data", []byte{0x80, 0xc9, 0x00, 0x02, 0, 0, 0, 1}},
+		{"rr reports exceed data", []byte{0x81, 0xc9, 0x00, 0x01, 0, 0, 0, 1}},
+		{"sr too short", []byte{0x80, 0xc8, 0x00, 0x01, 0, 0, 0, 1}},
+		{"sdes not terminated", []byte{0x81, 0xca, 0x00, 0x02, 0, 0, 0, 1, 0x01, 0x02, 'a', 'b'}},
+		{"bye reason truncated", []byte{0x81, 0xcb, 0x00, 0x02, 0, 0, 0, 1, 0x05, 'a', 'b', 'c'}},
+		{"app too short", []byte{0x80, 0xcc, 0x00, 0x01, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmarshal(tt.raw); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  Packet
+	}{
+		{"rr too many reports", &ReceiverReport{Reports: make([]ReceptionReport, 32)}},
+		{"rr total lost overflow", &ReceiverReport{Reports: []ReceptionReport{{TotalLost: 0x800000}}}},
+		{"sr unaligned extension", &SenderReport{ProfileExtensions: []byte{1}}},
+		{"sdes reserved item", &SourceDescription{Chunks: []SDESChunk{{Items: []SDESItem{{Type: SDESEnd}}}}}},
+		{"bye reason too long", &Goodbye{Reason: string(make([]byte, 256))}},
+		{"app name", &ApplicationDefined{Name: "AB"}},
+		{"app unaligned data", &ApplicationDefined{Name: "ABCD", Data: []byte{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.pkt.Marshal(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	receptionReportLength = 24
+	senderInfoLength      = 20
+)
+
+// ReceptionReport 接收报告块(RFC 3550 6.4.1)
+type ReceptionReport struct {
+	SSRC uint32
+	// FractionLost 上次报告以来的丢包率，以256为分母
+	FractionLost uint8
+	// TotalLost 累计丢包数，24位有符号数，重复包会使其为负
+	TotalLost int32
+	// LastSequenceNumber 扩展的最大序号，高16位为序号回绕次数
+	LastSequenceNumber uint32
+	// Jitter 到达间隔抖动，单位为rtp时间戳
+	Jitter uint32
+	// LastSenderReport 最近收到的SR中NTP时间的中间32位
+	LastSenderReport uint32
+	// Delay 收到最近的SR到发送本报告的间隔，单位为1/65536秒
+	Delay uint32
+}
+
+func (r *ReceptionReport) marshalTo(b []byte) error {
+	if r.TotalLost > 0x7FFFFF || r.TotalLost < -0x800000 {
+		return fmt.Errorf("rtcp total lost %d out of range", r.TotalLost)
+	}
+	binary.BigEndian.PutUint32(b, r.SSRC)
+	binary.BigEndian.PutUint32(b[4:], uint32(r.TotalLost)&0xFFFFFF)
+	b[4] = r.FractionLost
+	binary.BigEndian.PutUint32(b[8:], r.LastSequenceNumber)
+	binary.BigEndian.PutUint32(b[12:], r.Jitter)
+	binary.BigEndian.PutUint32(b[16:], r.LastSenderReport)
+	binary.BigEndian.PutUint32(b[20:], r.Delay)
+	return nil
+}
+
+func (r *ReceptionReport) unmarshal(b []byte) {
+	r.SSRC = binary.BigEndian.Uint32(b)
+	r.FractionLost = b[4]
+	lost := binary.BigEndian.Uint32(b[4:]) & 0xFFFFFF
+	// 符号扩展
+	r.TotalLost = int32(lost<<8) >> 8
+	r.LastSequenceNumber = binary.BigEndian.Uint32(b[8:])
+	r.Jitter = binary.BigEndian.Uint32(b[12:])
+	r.LastSenderReport = binary.BigEndian.Uint32(b[16:])
+	r.Delay = binary.BigEndian.Uint32(b[20:])
+}
+
+// unmarshalReports 解析count个报告块，剩余数据为profile扩展
+func unmarshalReports(b []byte, count int) ([]ReceptionReport, []byte, error) {
+	if len(b) < count*receptionReportLength {
+		return nil, nil, fmt.Errorf("rtcp %d reception reports exceed data %d", count, len(b))
+	}
+	reports := make([]ReceptionReport, count)
+	for i := range reports {
+		reports[i].unmarshal(b[i*receptionReportLength:])
+	}
+	b = b[count*receptionReportLength:]
+	if len(b) == 0 {
+		b = nil
+	}
+	return reports, b, nil
+}
+
+// marshalReports 编码报告块和profile扩展
+func marshalReports(b []byte, reports []ReceptionReport, extensions []byte) error {
+	for i := range reports {
+		if err := reports[i].marshalTo(b[i*receptionReportLength:]); err != nil {
+			return err
+		}
+	}
+	copy(b[len(reports)*receptionReportLength:], extensions)
+	return nil
+}
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |V=2|P|    RC   |   PT=SR=200   |             length            |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                         SSRC of sender                        |
+  +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+  |              NTP timestamp, most significant word             |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |             NTP timestamp, least significant word             |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                         RTP timestamp                         |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                     sender's packet count                     |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                      sender's octet count                     |
+  +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+  |                 report blocks ...                             |
+  +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+*/
+
+// SenderReport 发送端报告(SR)
+type SenderReport struct {
+	SSRC uint32
+	// NTPTime 与RTPTime对应的NTP时间，32.32定点数
+	NTPTime     uint64
+	RTPTime     uint32
+	PacketCount uint32
+	OctetCount  uint32
+	Reports     []ReceptionReport
+	// ProfileExtensions 报告块之后的profile扩展数据
+	ProfileExtensions []byte
+}
+
+func (r *SenderReport) Marshal() ([]byte, error) {
+	if len(r.Reports) > maxCount {
+		return nil, fmt.Errorf("rtcp SR has too many reports: %d", len(r.Reports))
+	}
+	if len(r.ProfileExtensions)%4 != 0 {
+		return nil, fmt.Errorf("rtcp SR profile extensions not aligned")
+	}
+	b := make([]byte, HeaderLength+4+senderInfoLength+len(r.Reports)*receptionReportLength+len(r.ProfileExtensions))
+	h := Header{Count: uint8(len(r.Reports)), Type: TypeSenderReport}
+	h.marshalTo(b)
+	binary.BigEndian.PutUint32(b[4:], r.SSRC)
+	binary.BigEndian.PutUint64(b[8:], r.NTPTime)
+	binary.BigEndian.PutUint32(b[16:], r.RTPTime)
+	binary.BigEndian.PutUint32(b[20:], r.PacketCount)
+	binary.BigEndian.PutUint32(b[24:], r.OctetCount)
+	if err := marshalReports(b[28:], r.Reports, r.ProfileExtensions); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *SenderReport) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeSenderReport)
+	if err != nil {
+		return err
+	}
+	if len(b) < 4+senderInfoLength {
+		return fmt.Errorf("rtcp SR too short: %d", len(b))
+	}
+	r.SSRC = binary.BigEndian.Uint32(b)
+	r.NTPTime = binary.BigEndian.Uint64(b[4:])
+	r.RTPTime = binary.BigEndian.Uint32(b[12:])
+	r.PacketCount = binary.BigEndian.Uint32(b[16:])
+	r.OctetCount = binary.BigEndian.Uint32(b[20:])
+	r.Reports, r.ProfileExtensions, err = unmarshalReports(b[24:], int(h.Count))
+	return err
+}
+
+// ReceiverReport 接收端报告(RR)
+type ReceiverReport struct {
+	SSRC    uint32
+	Reports []ReceptionReport
+	// ProfileExtensions 报告块之后的profile扩展数据
+	ProfileExtensions []byte
+}
+
+func (r *ReceiverReport) Marshal() ([]byte, error) {
+	if len(r.Reports) > maxCount {
+		return nil, fmt.Errorf("rtcp RR has too many reports: %d", len(r.Reports))
+	}
+	if len(r.ProfileExtensions)%4 != 0 {
+		return nil, fmt.Errorf("rtcp RR profile extensions not aligned")
+	}
+	b := make([]byte, HeaderLength+4+len(r.Reports)*receptionReportLength+len(r.ProfileExtensions))
+	h := Header{Count: uint8(len(r.Reports)), Type: TypeReceiverReport}
+	h.marshalTo(b)
+	binary.BigEndian.PutUint32(b[4:], r.SSRC)
+	if err := marshalReports(b[8:], r.Reports, r.ProfileExtensions); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *ReceiverReport) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeReceiverReport)
+	if err != nil {
+		return err
+	}
+	if len(b) < 4 {
+		return fmt.Errorf("rtcp RR too short: %d", len(b))
+	}
+	r.SSRC = binary.BigEndian.Uint32(b)
+	r.Reports, r.ProfileExtensions, err = unmarshalReports(b[4:], int(h.Count))
+	return err
+}
@@ -0,0 +1,124 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SDESType SDES条目类型
+type SDESType uint8
+
+const (
+	SDESEnd      SDESType = 0
+	SDESCNAME    SDESType = 1
+	SDESName     SDESType = 2
+	SDESEmail    SDESType = 3
+	SDESPhone    SDESType = 4
+	SDESLocation SDESType = 5
+	SDESTool     SDESType = 6
+	SDESNote     SDESType = 7
+	SDESPrivate  SDESType = 8
+)
+
+// SDESItem SDES条目
+type SDESItem struct {
+	Type SDESType
+	Text string
+}
+
+// SDESChunk 一个源的SDES条目
+type SDESChunk struct {
+	Source uint32
+	Items  []SDESItem
+}
+
+// SourceDescription 源描述(SDES)
+type SourceDescription struct {
+	Chunks []SDESChunk
+}
+
+// NewCNAME 创建只包含CNAME的SDES
+func NewCNAME(ssrc uint32, cname string) *SourceDescription {
+	return &SourceDescription{Chunks: []SDESChunk{{
+		Source: ssrc,
+		Items:  []SDESItem{{Type: SDESCNAME, Text: cname}},
+	}}}
+}
+
+// CNAME 获取指定源的CNAME
+func (s *SourceDescription) CNAME(ssrc uint32) (string, bool) {
+	for _, chunk := range s.Chunks {
+		if chunk.Source != ssrc {
+			continue
+		}
+		for _, item := range chunk.Items {
+			if item.Type == SDESCNAME {
+				return item.Text, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (s *SourceDescription) Marshal() ([]byte, error) {
+	if len(s.Chunks) > maxCount {
+		return nil, fmt.Errorf("rtcp SDES has too many chunks: %d", len(s.Chunks))
+	}
+	b := make([]byte, HeaderLength)
+	for _, chunk := range s.Chunks {
+		b = append(b, byte(chunk.Source>>24), byte(chunk.Source>>16), byte(chunk.Source>>8), byte(chunk.Source))
+		for _, item := range chunk.Items {
+			if item.Type == SDESEnd {
+				return nil, fmt.Errorf("rtcp SDES item type 0 is reserved")
+			}
+			if len(item.Text) > 255 {
+				return nil, fmt.Errorf("rtcp SDES item %d too long: %d", item.Type, len(item.Text))
+			}
+			b = append(b, byte(item.Type), byte(len(item.Text)))
+			b = append(b, item.Text...)
+		}
+		// 以至少一个空条目结束，并对齐到32位
+		b = append(b, 0)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	h := Header{Count: uint8(len(s.Chunks)), Type: TypeSourceDescription}
+	h.marshalTo(b)
+	return b, nil
+}
+
+func (s *SourceDescription) Unmarshal(b []byte) error {
+	h, b, err := body(b, TypeSourceDescription)
+	if err != nil {
+		return err
+	}
+	s.Chunks = nil
+	offset := 0
+	for i := 0; i < int(h.Count); i++ {
+		if len(b)-offset < 4 {
+			return fmt.Errorf("rtcp SDES chunk truncated")
+		}
+		chunk := SDESChunk{Source: binary.BigEndian.Uint32(b[offset:])}
+		offset += 4
+		for {
+			if offset >= len(b) {
+				return fmt.Errorf("rtcp SDES chunk not terminated")
+			}
+			t := SDESType(b[offset])
+			if t == SDESEnd {
+				// 跳过结束条目和对齐填充
+				offset = (offset/4 + 1) * 4
+				break
+			}
+			if len(b)-offset < 2 || len(b)-offset-2 < int(b[offset+1]) {
+				return fmt.Errorf("rtcp SDES item truncated")
+			}
+			length := int(b[offset+1])
+			chunk.Items = append(chunk.Items, SDESItem{Type: t, Text: string(b[offset+2 : offset+2+length])})
+			offset += 2 + length
+		}
+		s.Chunks = append(s.Chunks, chunk)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+)
+
+// AACDepacketizer mpeg4-generic aac rtp解包器(RFC 3640)
+// 解析AU-header，支持一个rtp包中携带多个AU以及一个AU分片到多个rtp包中
+type AACDepacketizer struct {
+	config        *aac.Config
+	clockRate     int
+	frameDuration int
+
+	sizeLength        int
+	indexLength       int
+	indexDeltaLength  int
+	ctsDeltaLength    int
+	dtsDeltaLength    int
+	randomAccess      bool
+	streamStateLength int
+	auxLength         int
+	constantSize      int
+
+	seq          sequenceTracker
+	fragment     []byte
+	fragmentSize int
+	fragmentTS   uint32
+	fragmenting  bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// auHeader AU-header中解析出的字段
+type auHeader struct {
+	size     int
+	index    int
+	ctsDelta int
+	hasCTS   bool
+}
+
+// NewAACDepacketizer 创建aac解包器，sdp中必须携带config
+func NewAACDepacketizer(info *SDPInfo) (*AACDepacketizer, error) {
+	if info == nil || len(info.Config) == 0 {
+		return nil, fmt.Errorf("aac config is missing in sdp")
+	}
+	config, err := aac.ParseConfig(info.Config)
+	if err != nil {
+		return nil, fmt.Errorf("parse aac config error:%s", err)
+	}
+	d := &AACDepacketizer{
+		config:            config,
+		clockRate:         info.TimeScale,
+		frameDuration:     info.ConstantDuration,
+		sizeLength:        info.SizeLength,
+		indexLength:       info.IndexLength,
+		indexDeltaLength:  info.IndexDeltaLength,
+		ctsDeltaLength:    info.CTSDeltaLength,
+		dtsDeltaLength:    info.DTSDeltaLength,
+		randomAccess:      info.RandomAccessIndication,
+		streamStateLength: info.StreamStateIndication,
+		auxLength:         info.AuxiliaryDataSizeLength,
+		constantSize:      info.ConstantSize,
+	}
+	if d.clockRate <= 0 {
+		d.clockRate = config.SampleRate
+	}
+	if d.frameDuration <= 0 {
+		d.frameDuration = config.FrameLength()
+	}
+	return d, nil
+}
+
+// Config AudioSpecificConfig，可用于生成ADTS头
+func (d *AACDepacketizer) Config() *aac.Config {
+	return d.config
+}
+
+// Decode 输入一个rtp包，返回其中完整的aac帧
+func (d *AACDepacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil {
+		return nil, fmt.Errorf("aac rtp is nil")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+	}
+
+	ts := uint32(rtp.Timestamp)
+	if d.fragmenting && ts != d.fragmentTS {
+		// 分片未结束时间戳已变化，丢弃
+		d.discard()
+	}
+
+	headers, data, err := d.parseHeaders(rtp.Payload)
+	if err != nil {
+		d.discard()
+		return nil, err
+	}
+
+	if d.fragmenting {
+		if len(headers) != 1 {
+			d.discard()
+			return nil, fmt.Errorf("aac fragment carries %d au-headers", len(headers))
+		}
+		d.fragment = append(d.fragment, data...)
+		if len(d.fragment) < d.fragmentSize && !rtp.Marker {
+			return nil, nil
+		}
+		frame, size := d.fragment, d.fragmentSize
+		d.discard()
+		if len(frame) != size {
+			return nil, fmt.Errorf("aac fragmented au size mismatch, expect %d got %d", size, len(frame))
+		}
+		return []*AccessUnit{d.accessUnit(ts, frame)}, nil
+	}
+
+	// 一个AU被分片到多个rtp包中
+	if len(headers) == 1 && headers[0].size > len(data) {
+		if headers[0].size > maxAccessUnitSize {
+			return nil, fmt.Errorf("aac au size %d exceeds %d", headers[0].size, maxAccessUnitSize)
+		}
+		d.fragment = append(d.fragment[:0], data...)
+		d.fragmentSize = headers[0].size
+		d.fragmentTS = ts
+		d.fragmenting = true
+		return nil, nil
+	}
+
+	var aus []*AccessUnit
+	for _, h := range headers {
+		if h.size > len(data) {
+			return aus, fmt.Errorf("aac au size %d exceeds remaining %d", h.size, len(data))
+		}
+		auTS := ts + uint32(h.index*d.frameDuration)
+		if h.hasCTS {
+			auTS = ts + uint32(int32(h.ctsDelta))
+		}
+		aus = append(aus, d.accessUnit(auTS, append([]byte(nil), data[:h.size]...)))
+		data = data[h.size:]
+	}
+	return aus, nil
+}
+
+// parseHeaders 解析AU Header Section和Auxiliary Section，返回AU-header列表和数据部分
+func (d *AACDepacketizer) parseHeaders(payload []byte) ([]auHeader, []byte, error) {
+	noHeaders := d.sizeLength == 0 && d.indexLength == 0 && d.indexDeltaLength == 0 &&
+		d.ctsDeltaLength == 0 && d.dtsDeltaLength == 0 && !d.randomAccess && d.streamStateLength == 0
+
+	var headers []auHeader
+	if noHeaders {
+		// 没有AU-header时，按constantsize拆分或整个负载为一个AU
+		size := d.constantSize
+		if size <= 0 {
+			size = len(payload)
+		}
+		if len(payload) == 0 {
+			return nil, nil, fmt.Errorf("aac payload is empty")
+		}
+		for i := 0; i*size < len(payload); i++ {
+			headers = append(headers, auHeader{size: size, index: i})
+		}
+	} else {
+		if len(payload) < 2 {
+			return nil, nil, fmt.Errorf("aac payload too short")
+		}
+		headersBits := int(payload[0])<<8 | int(payload[1])
+		headersLen := (headersBits + 7) / 8
+		payload = payload[2:]
+		if len(payload) < headersLen {
+			return nil, nil, fmt.Errorf("aac au-headers length %d exceeds payload", headersLen)
+		}
+		br := codec.NewBitReader(payload[:headersLen])
+		payload = payload[headersLen:]
+
+		index := 0
+		for br.Pos() < headersBits {
+			h, err := d.readHeader(br, len(headers) == 0)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(headers) == 0 {
+				index = h.index
+			} else {
+				index += h.index + 1
+			}
+			h.index = index
+			if d.sizeLength == 0 {
+				h.size = d.constantSize
+			}
+			headers = append(headers, h)
+		}
+	}
+
+	if d.auxLength > 0 {
+		if len(payload) < (d.auxLength+7)/8 {
+			return nil, nil, fmt.Errorf("aac auxiliary section truncated")
+		}
+		br := codec.NewBitReader(payload)
+		auxSize, err := br.ReadBits(d.auxLength)
+		if err != nil {
+			return nil, nil, err
+		}
+		auxBytes := (d.auxLength + int(auxSize) + 7) / 8
+		if len(payload) < auxBytes {
+			return nil, nil, fmt.Errorf("aac auxiliary data truncated")
+		}
+		payload = payload[auxBytes:]
+	}
+	return headers, payload, nil
+}
+
+// readHeader 读取一个AU-header，第一个AU-header使用AU-Index，其余使用AU-Index-delta
+func (d *AACDepacketizer) readHeader(br *codec.BitReader, first bool) (auHeader, error) {
+	var h auHeader
+	v, err := br.ReadBits(d.sizeLength)
+	if err != nil {
+		return h, err
+	}
+	h.size = int(v)
+
+	indexLength := d.indexDeltaLength
+	if first {
+		indexLength = d.indexLength
+	}
+	if v, err = br.ReadBits(indexLength); err != nil {
+		return h, err
+	}
+	h.index = int(v)
+
+	if d.ctsDeltaLength > 0 {
+		if h.hasCTS, err = br.ReadFlag(); err != nil {
+			return h, err
+		}
+		if h.hasCTS {
+			if v, err = br.ReadBits(d.ctsDeltaLength); err != nil {
+				return h, err
+			}
+			h.ctsDelta = signExtend(v, d.ctsDeltaLength)
+		}
+	}
+	if d.dtsDeltaLength > 0 {
+		hasDTS, err := br.ReadFlag()
+		if err != nil {
+			return h, err
+		}
+		if hasDTS {
+			if err = br.Skip(d.dtsDeltaLength); err != nil {
+				return h, err
+			}
+		}
+	}
+	if d.randomAccess {
+		if err = br.Skip(1); err != nil {
+			return h, err
+		}
+	}
+	if err = br.Skip(d.streamStateLength); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// signExtend 将n位的二进制补码扩展为int
+func signExtend(v uint64, n int) int {
+	if n > 0 && v&(1<<uint(n-1)) != 0 {
+		return int(int64(v) - int64(1)<<uint(n))
+	}
+	return int(v)
+}
+
+func (d *AACDepacketizer) discard() {
+	d.fragment = nil
+	d.fragmentSize = 0
+	d.fragmenting = false
+}
+
+func (d *AACDepacketizer) accessUnit(ts uint32, frame []byte) *AccessUnit {
+	return &AccessUnit{
+		Timestamp: ts,
+		PTS:       timestampToDuration(d.ts.extend(ts), d.clockRate),
+		Keyframe:  true,
+		Data:      frame,
+	}
+}
+
+// LATMDepacketizer mp4a-latm rtp解包器(RFC 6416)
+// 支持带外(cpresent=0)和带内的StreamMuxConfig，一个AudioMuxElement可分片到多个rtp包中
+type LATMDepacketizer struct {
+	muxConfig *aac.StreamMuxConfig
+	inBand    bool
+	clockRate int
+
+	seq       sequenceTracker
+	buf       []byte
+	bufTS     uint32
+	buffering bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewLATMDepacketizer 创建latm解包器，cpresent=0时sdp中必须携带config
+func NewLATMDepacketizer(info *SDPInfo) (*LATMDepacketizer, error) {
+	if info == nil {
+		return nil, fmt.Errorf("latm sdp info is nil")
+	}
+	d := &LATMDepacketizer{
+		inBand:    info.CPresent,
+		clockRate: info.TimeScale,
+	}
+	if len(info.Config) > 0 {
+		muxConfig, err := aac.ParseStreamMuxConfig(info.Config)
+		if err != nil {
+			return nil, fmt.Errorf("parse latm config error:%s", err)
+		}
+		d.muxConfig = muxConfig
+	} else if !d.inBand {
+		return nil, fmt.Errorf("latm config is missing in sdp")
+	}
+	if d.clockRate <= 0 && d.muxConfig != nil {
+		d.clockRate = d.muxConfig.Config.SampleRate
+	}
+	return d, nil
+}
+
+// Config AudioSpecificConfig，带内配置尚未收到时为nil
+func (d *LATMDepacketizer) Config() *aac.Config {
+	if d.muxConfig == nil {
+		return nil
+	}
+	return d.muxConfig.Config
+}
+
+// Decode 输入一个rtp包，AudioMuxElement完整(marker)时返回其中的aac帧
+func (d *LATMDepacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil {
+		return nil, fmt.Errorf("latm rtp is nil")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	ts := uint32(rtp.Timestamp)
+	if lost > 0 || (d.buffering && ts != d.bufTS) {
+		d.Lost += lost
+		d.buf = nil
+		d.buffering = false
+	}
+
+	if !d.buffering {
+		d.buf = d.buf[:0]
+		d.bufTS = ts
+		d.buffering = true
+	}
+	if len(d.buf)+len(rtp.Payload) > maxAccessUnitSize {
+		d.buf = nil
+		d.buffering = false
+		return nil, fmt.Errorf("latm audio mux element exceeds %d bytes", maxAccessUnitSize)
+	}
+	d.buf = append(d.buf, rtp.Payload...)
+	if !rtp.Marker {
+		return nil, nil
+	}
+
+	element := d.buf
+	d.buf = nil
+	d.buffering = false
+	frames, err := d.parseElement(element)
+	if err != nil {
+		return nil, err
+	}
+
+	aus := make([]*AccessUnit, 0, len(frames))
+	frameLength := d.muxConfig.Config.FrameLength()
+	if d.clockRate <= 0 {
+		d.clockRate = d.muxConfig.Config.SampleRate
+	}
+	for i, frame := range frames {
+		auTS := ts + uint32(i*frameLength)
+		aus = append(aus, &AccessUnit{
+			Timestamp: auTS,
+			PTS:       timestampToDuration(d.ts.extend(auTS), d.clockRate),
+			Keyframe:  true,
+			Data:      frame,
+		})
+	}
+	return aus, nil
+}
+
+// parseElement 解析AudioMuxElement，返回其中各子帧的aac数据
+func (d *LATMDepacketizer) parseElement(element []byte) ([][]byte, error) {
+	br := codec.NewBitReader(element)
+	if d.inBand {
+		useSameStreamMux, err := br.ReadFlag()
+		if err != nil {
+			return nil, err
+		}
+		if !useSameStreamMux {
+			muxConfig, err := aac.ReadStreamMuxConfig(br)
+			if err != nil {
+				return nil, fmt.Errorf("parse in-band latm config error:%s", err)
+			}
+			d.muxConfig = muxConfig
+		}
+	}
+	if d.muxConfig == nil {
+		return nil, fmt.Errorf("latm stream mux config not received yet")
+	}
+
+	var frames [][]byte
+	for i := 0; i <= d.muxConfig.NumSubFrames; i++ {
+		size, err := aac.ReadPayloadLengthInfo(br)
+		if err != nil {
+			return nil, err
+		}
+		if br.Remaining() < size*8 {
+			return nil, fmt.Errorf("latm payload size %d exceeds remaining", size)
+		}
+		frame := make([]byte, size)
+		for j := range frame {
+			v, _ := br.ReadBits(8)
+			frame[j] = byte(v)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
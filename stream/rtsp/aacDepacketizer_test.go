@@ -0,0 +1,193 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+)
+
+// testAACSDP 44100Hz立体声AAC-LC，AAC-hbr模式
+const testAACSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=test\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 0 RTP/AVP 97\r\n" +
+	"a=rtpmap:97 MPEG4-GENERIC/44100/2\r\n" +
+	"a=fmtp:97 streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1210\r\n" +
+	"a=control:streamid=1\r\n"
+
+func TestAACDepacketizer(t *testing.T) {
+	info := ParseSDP(testAACSDP)["audio"]
+	if info == nil || info.SizeLength != 13 || info.IndexLength != 3 || info.IndexDeltaLength != 3 || info.TimeScale != 44100 {
+		t.Fatalf("unexpected sdp info %+v", info)
+	}
+	ctsInfo := *info
+	ctsInfo.CTSDeltaLength = 4
+	constInfo := *info
+	constInfo.SizeLength, constInfo.IndexLength, constInfo.IndexDeltaLength, constInfo.ConstantSize = 0, 0, 0, 2
+
+	tests := []struct {
+		name    string
+		info    *SDPInfo
+		packets []*RTPInfo
+		want    []*AccessUnit
+	}{
+		{
+			name: "multiple aus",
+			info: info,
+			packets: []*RTPInfo{
+				// AU-headers-length=32, AU-size=3 index=0, AU-size=2 delta=0
+				testRTP(1, 1000, true, []byte{0x00, 0x20, 0x00, 0x18, 0x00, 0x10, 0xa1, 0xa2, 0xa3, 0xb1, 0xb2}),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 1000, Keyframe: true, Data: []byte{0xa1, 0xa2, 0xa3}},
+				{Timestamp: 2024, PTS: 23219954, Keyframe: true, Data: []byte{0xb1, 0xb2}},
+			},
+		},
+		{
+			name: "fragmented au",
+			info: info,
+			packets: []*RTPInfo{
+				testRTP(1, 1000, false, []byte{0x00, 0x10, 0x00, 0x28, 0xa1, 0xa2, 0xa3}),
+				testRTP(2, 1000, true, []byte{0x00, 0x10, 0x00, 0x28, 0xa4, 0xa5}),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 1000, Keyframe: true, Data: []byte{0xa1, 0xa2, 0xa3, 0xa4, 0xa5}},
+			},
+		},
+		{
+			name: "lost fragment",
+			info: info,
+			packets: []*RTPInfo{
+				testRTP(1, 1000, false, []byte{0x00, 0x10, 0x00, 0x28, 0xa1, 0xa2, 0xa3}),
+				testRTP(3, 2024, true, []byte{0x00, 0x10, 0x00, 0x10, 0xb1, 0xb2}),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 2024, Keyframe: true, Data: []byte{0xb1, 0xb2}},
+			},
+		},
+		{
+			name: "cts delta",
+			info: &ctsInfo,
+			packets: []*RTPInfo{
+				// AU-size=1 index=0 CTS-flag=1 CTS-delta=-2
+				testRTP(1, 1000, true, []byte{0x00, 0x15, 0x00, 0x08, 0xf0, 0xa1}),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 998, Keyframe: true, Data: []byte{0xa1}},
+			},
+		},
+		{
+			name: "constant size without au-headers",
+			info: &constInfo,
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, []byte{0xa1, 0xa2, 0xb1, 0xb2}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, Data: []byte{0xa1, 0xa2}},
+				{Timestamp: 1024, PTS: 23219954, Keyframe: true, Data: []byte{0xb1, 0xb2}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewAACDepacketizer(tt.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAudioUnits(t, decodeAll(t, d, tt.packets), tt.want)
+		})
+	}
+
+	if _, err := NewAACDepacketizer(&SDPInfo{}); err == nil {
+		t.Error("expected error without config")
+	}
+	d, _ := NewAACDepacketizer(info)
+	if _, err := d.Decode(testRTP(1, 0, true, []byte{0x00, 0x40, 0x00})); err == nil {
+		t.Error("expected error for truncated au-headers")
+	}
+}
+
+// checkAudioUnits 比较时间戳和数据
+func checkAudioUnits(t *testing.T, aus, want []*AccessUnit) {
+	t.Helper()
+	if len(aus) != len(want) {
+		t.Fatalf("got %d access units, want %d", len(aus), len(want))
+	}
+	for i, w := range want {
+		got := aus[i]
+		if got.Timestamp != w.Timestamp || got.PTS != w.PTS || got.Keyframe != w.Keyframe || !bytes.Equal(got.Data, w.Data) {
+			t.Errorf("au %d: got ts=%d pts=%v key=%v data=%x, want ts=%d pts=%v key=%v data=%x", i,
+				got.Timestamp, got.PTS, got.Keyframe, got.Data, w.Timestamp, w.PTS, w.Keyframe, w.Data)
+		}
+	}
+}
+
+func TestLATMDepacketizer(t *testing.T) {
+	config := &aac.Config{ObjectType: aac.ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2}
+	muxConfig := (&aac.StreamMuxConfig{Config: config}).Marshal()
+
+	// 带内配置：useSameStreamMux=0，StreamMuxConfig共44位，之后为PayloadLengthInfo和数据，不按字节对齐
+	w := &codec.BitWriter{}
+	w.WriteBits(0, 1)
+	br := codec.NewBitReader(muxConfig)
+	v, _ := br.ReadBits(44)
+	w.WriteBits(v, 44)
+	for _, b := range []byte{0x02, 0xa1, 0xa2} {
+		w.WriteBits(uint64(b), 8)
+	}
+	inBand := w.Bytes()
+
+	tests := []struct {
+		name    string
+		info    *SDPInfo
+		packets []*RTPInfo
+		want    []*AccessUnit
+	}{
+		{
+			name: "out of band config",
+			info: &SDPInfo{Config: muxConfig},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, []byte{0x02, 0xa1, 0xa2}),
+				testRTP(2, 1024, false, []byte{0x03, 0xb1}),
+				testRTP(3, 1024, true, []byte{0xb2, 0xb3}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, Data: []byte{0xa1, 0xa2}},
+				{Timestamp: 1024, PTS: 23219954, Keyframe: true, Data: []byte{0xb1, 0xb2, 0xb3}},
+			},
+		},
+		{
+			name: "in band config",
+			info: &SDPInfo{CPresent: true},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, inBand),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, Data: []byte{0xa1, 0xa2}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewLATMDepacketizer(tt.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAudioUnits(t, decodeAll(t, d, tt.packets), tt.want)
+			if c := d.Config(); c == nil || c.SampleRate != 44100 {
+				t.Errorf("Config = %+v", c)
+			}
+		})
+	}
+
+	if _, err := NewLATMDepacketizer(&SDPInfo{}); err == nil {
+		t.Error("expected error without out-of-band config")
+	}
+	d, _ := NewLATMDepacketizer(&SDPInfo{CPresent: true})
+	if _, err := d.Decode(testRTP(1, 0, true, []byte{0x80, 0x02, 0xa1, 0xa2})); err == nil {
+		t.Error("expected error before in-band config")
+	}
+}
@@ -0,0 +1,135 @@
+package rtsp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+)
+
+// AACPacketizer mpeg4-generic aac rtp打包器(RFC 3640 AAC-hbr)
+// 每个rtp包携带一个AU，超过MTU时分片，分片的AU-size为整个AU的长度
+type AACPacketizer struct {
+	*rtpPacker
+	config *aac.Config
+}
+
+// NewAACPacketizer 创建aac打包器，时钟频率默认为采样率
+func NewAACPacketizer(config *aac.Config, options PacketizerOptions) *AACPacketizer {
+	return &AACPacketizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_AUDIO, 97, config.SampleRate, options),
+		config:    config,
+	}
+}
+
+// FMTP 对应的sdp fmtp参数
+func (p *AACPacketizer) FMTP() string {
+	return fmt.Sprintf("streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=%s",
+		strings.ToUpper(hex.EncodeToString(p.config.Marshal())))
+}
+
+// Packetize 封装一个aac帧，带ADTS头时自动去掉
+func (p *AACPacketizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一个aac帧，带ADTS头时自动去掉
+func (p *AACPacketizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if aac.IsADTS(frame) {
+		frames, _, err := aac.SplitADTS(frame)
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) != 1 {
+			return nil, fmt.Errorf("aac frame contains %d adts frames", len(frames))
+		}
+		frame = frames[0]
+	}
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("aac frame is empty")
+	}
+	if len(frame) >= 1<<13 {
+		return nil, fmt.Errorf("aac frame size %d exceeds au-size field", len(frame))
+	}
+
+	// AU-headers-length(16) AU-size(13) AU-Index(3)
+	header := []byte{0x00, 0x10, byte(len(frame) >> 5), byte(len(frame)<<3) & 0xF8}
+	chunk := p.maxPayloadSize() - len(header)
+	ts := p.rtpTimestamp(pts)
+
+	var packs []*RTPPack
+	for len(frame) > 0 {
+		n := chunk
+		if n > len(frame) {
+			n = len(frame)
+		}
+		payload := make([]byte, 0, len(header)+n)
+		payload = append(payload, header...)
+		payload = append(payload, frame[:n]...)
+		frame = frame[n:]
+		packs = append(packs, p.pack(payload, ts, len(frame) == 0))
+	}
+	return packs, nil
+}
+
+// LATMPacketizer mp4a-latm rtp打包器(RFC 6416)，StreamMuxConfig通过sdp带外传输(cpresent=0)
+// 每个AudioMuxElement携带一个aac帧，超过MTU时分片
+type LATMPacketizer struct {
+	*rtpPacker
+	config *aac.Config
+}
+
+// NewLATMPacketizer 创建latm打包器，时钟频率默认为采样率
+func NewLATMPacketizer(config *aac.Config, options PacketizerOptions) *LATMPacketizer {
+	return &LATMPacketizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_AUDIO, 97, config.SampleRate, options),
+		config:    config,
+	}
+}
+
+// FMTP 对应的sdp fmtp参数
+func (p *LATMPacketizer) FMTP() string {
+	muxConfig := &aac.StreamMuxConfig{Config: p.config}
+	return fmt.Sprintf("profile-level-id=1;object=%d;cpresent=0;config=%s",
+		p.config.ObjectType, strings.ToUpper(hex.EncodeToString(muxConfig.Marshal())))
+}
+
+// Packetize 封装一个aac帧，带ADTS头时自动去掉
+func (p *LATMPacketizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一个aac帧，带ADTS头时自动去掉
+func (p *LATMPacketizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if aac.IsADTS(frame) {
+		frames, _, err := aac.SplitADTS(frame)
+		if err != nil {
+			return nil, err
+		}
+		if len(frames) != 1 {
+			return nil, fmt.Errorf("aac frame contains %d adts frames", len(frames))
+		}
+		frame = frames[0]
+	}
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("aac frame is empty")
+	}
+
+	element := append(aac.PayloadLengthInfo(len(frame)), frame...)
+	chunk := p.maxPayloadSize()
+	ts := p.rtpTimestamp(pts)
+
+	var packs []*RTPPack
+	for len(element) > 0 {
+		n := chunk
+		if n > len(element) {
+			n = len(element)
+		}
+		payload := element[:n]
+		element = element[n:]
+		packs = append(packs, p.pack(payload, ts, len(element) == 0))
+	}
+	return packs, nil
+}
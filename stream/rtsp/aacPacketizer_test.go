@@ -0,0 +1,83 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+)
+
+func TestAACPacketizerRoundTrip(t *testing.T) {
+	config := &aac.Config{ObjectType: aac.ObjectTypeAACLC, SampleRate: 44100, ChannelCount: 2}
+	small := bytes.Repeat([]byte{0x21}, 200)
+	large := bytes.Repeat([]byte{0x42}, 300)
+
+	tests := []struct {
+		name string
+		// newPacketizer 返回打包器和按其参数创建的解包器
+		newPacketizer func(mtu int) (Packetizer, Depacketizer)
+	}{
+		{
+			name: "mpeg4-generic",
+			newPacketizer: func(mtu int) (Packetizer, Depacketizer) {
+				p := NewAACPacketizer(config, PacketizerOptions{MTU: mtu})
+				sdpRaw := strings.Replace(testAACSDP, "sizelength=13;indexlength=3;indexdeltalength=3;config=1210",
+					strings.TrimPrefix(p.FMTP(), "streamtype=5;profile-level-id=1;mode=AAC-hbr;"), 1)
+				info := ParseSDP(sdpRaw)["audio"]
+				d, err := NewAACDepacketizer(info)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p, d
+			},
+		},
+		{
+			name: "latm",
+			newPacketizer: func(mtu int) (Packetizer, Depacketizer) {
+				p := NewLATMPacketizer(config, PacketizerOptions{MTU: mtu})
+				if want := "profile-level-id=1;object=2;cpresent=0;config=400024203FC0"; p.FMTP() != want {
+					t.Fatalf("FMTP = %s", p.FMTP())
+				}
+				b, _ := hex.DecodeString("400024203FC0")
+				info := &SDPInfo{Config: b, TimeScale: 44100}
+				d, err := NewLATMDepacketizer(info)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p, d
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, d := tt.newPacketizer(256)
+			frames := [][]byte{small, large, config.ADTS(small)}
+			for i, frame := range frames {
+				pts := time.Duration(i) * time.Second * 1024 / 44100
+				packs, err := p.Packetize(&AccessUnit{PTS: pts, Data: frame})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, pack := range packs {
+					if len(pack.Buffer.Bytes()) > 256 {
+						t.Errorf("frame %d: packet of %d bytes exceeds mtu", i, len(pack.Buffer.Bytes()))
+					}
+				}
+				aus := decodeAll(t, d, parsePacks(t, packs))
+				want := frame
+				if aac.IsADTS(frame) {
+					want = small
+				}
+				if len(aus) != 1 || !bytes.Equal(aus[0].Data, want) || aus[0].PTS/time.Millisecond != pts/time.Millisecond {
+					t.Fatalf("frame %d: round trip mismatch, %d access units", i, len(aus))
+				}
+			}
+			if _, err := p.Packetize(&AccessUnit{}); err == nil {
+				t.Error("expected error for empty frame")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frameDepacketizer 每个rtp包携带完整音频帧的解包器，g711、g726、opus共用
+type frameDepacketizer struct {
+	name      string
+	clockRate int
+
+	seq sequenceTracker
+	ts  timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// Decode 输入一个rtp包，返回其中的音频帧
+func (d *frameDepacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil || len(rtp.Payload) == 0 {
+		return nil, fmt.Errorf("%s rtp payload is empty", d.name)
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	d.Lost += lost
+
+	ts := uint32(rtp.Timestamp)
+	return []*AccessUnit{{
+		Timestamp: ts,
+		PTS:       timestampToDuration(d.ts.extend(ts), d.clockRate),
+		Keyframe:  true,
+		Data:      append([]byte(nil), rtp.Payload...),
+	}}, nil
+}
+
+func newFrameDepacketizer(name string, info *SDPInfo, clockRate int) frameDepacketizer {
+	if info != nil && info.TimeScale > 0 {
+		clockRate = info.TimeScale
+	}
+	return frameDepacketizer{name: name, clockRate: clockRate}
+}
+
+// G711Depacketizer g711 rtp解包器(RFC 3551)，每个采样一个字节
+type G711Depacketizer struct {
+	frameDepacketizer
+	// MuLaw 为true时是PCMU，否则是PCMA
+	MuLaw bool
+}
+
+// NewG711Depacketizer 创建g711解包器
+func NewG711Depacketizer(info *SDPInfo) *G711Depacketizer {
+	d := &G711Depacketizer{frameDepacketizer: newFrameDepacketizer("g711", info, 8000)}
+	if info != nil {
+		d.MuLaw = strings.EqualFold(info.Codec, "pcmu")
+	}
+	return d
+}
+
+// G726Depacketizer g726 rtp解包器(RFC 3551)
+type G726Depacketizer struct {
+	frameDepacketizer
+	// BitsPerSample 每个采样的位数，对应16/24/32/40kbps
+	BitsPerSample int
+	// BigEndian 为true时是AAL2打包方式(码字从字节高位开始)，否则从字节低位开始
+	BigEndian bool
+}
+
+// NewG726Depacketizer 创建g726解包器，码率取自编码名称，例如 G726-32
+func NewG726Depacketizer(info *SDPInfo) (*G726Depacketizer, error) {
+	if info == nil {
+		return nil, fmt.Errorf("sdp info is nil")
+	}
+	codec := strings.ToLower(info.Codec)
+	bigEndian := strings.HasPrefix(codec, "aal2-")
+	bitrate, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(codec, "aal2-"), "g726-"))
+	if err != nil || bitrate%8 != 0 || bitrate < 16 || bitrate > 40 {
+		return nil, fmt.Errorf("invalid g726 codec[%s]", info.Codec)
+	}
+	return &G726Depacketizer{
+		frameDepacketizer: newFrameDepacketizer("g726", info, 8000),
+		BitsPerSample:     bitrate / 8,
+		BigEndian:         bigEndian,
+	}, nil
+}
+
+// OpusDepacketizer opus rtp解包器(RFC 7587)，每个rtp包为一个opus包
+type OpusDepacketizer struct {
+	frameDepacketizer
+	// ChannelCount 声道数
+	ChannelCount int
+}
+
+// NewOpusDepacketizer 创建opus解包器
+func NewOpusDepacketizer(info *SDPInfo) *OpusDepacketizer {
+	d := &OpusDepacketizer{
+		frameDepacketizer: newFrameDepacketizer("opus", info, 48000),
+		ChannelCount:      2,
+	}
+	if info != nil && info.ChannelCount > 0 {
+		d.ChannelCount = info.ChannelCount
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+package rtsp
+
+import (
+	"testing"
+)
+
+// testAudioSDP 只有一个音频媒体的sdp
+func testAudioSDP(m string, attributes ...string) string {
+	s := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=test\r\nt=0 0\r\n" + m + "\r\n"
+	for _, a := range attributes {
+		s += a + "\r\n"
+	}
+	return s
+}
+
+func TestAudioSDP(t *testing.T) {
+	tests := []struct {
+		name       string
+		sdp        string
+		codec      string
+		timeScale  int
+		sampleRate int
+		channels   int
+	}{
+		{"static pcmu", testAudioSDP("m=audio 0 RTP/AVP 0"), "pcmu", 8000, 8000, 1},
+		{"static pcma", testAudioSDP("m=audio 0 RTP/AVP 8 101"), "pcma", 8000, 8000, 1},
+		{"static g722", testAudioSDP("m=audio 0 RTP/AVP 9"), "g722", 8000, 16000, 1},
+		{"g722 rtpmap", testAudioSDP("m=audio 0 RTP/AVP 9", "a=rtpmap:9 G722/8000"), "g722", 8000, 16000, 1},
+		{"g726", testAudioSDP("m=audio 0 RTP/AVP 97", "a=rtpmap:97 G726-32/8000"), "g726-32", 8000, 8000, 1},
+		{"opus", testAudioSDP("m=audio 0 RTP/AVP 111", "a=rtpmap:111 opus/48000/2"), "opus", 48000, 48000, 2},
+		{"aac config", testAACSDP, "acc", 44100, 44100, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := ParseSDP(tt.sdp)["audio"]
+			if info == nil {
+				t.Fatal("audio not found")
+			}
+			if info.Codec != tt.codec || info.TimeScale != tt.timeScale || info.SampleRate != tt.sampleRate || info.ChannelCount != tt.channels {
+				t.Errorf("got codec=%s clock=%d rate=%d channels=%d", info.Codec, info.TimeScale, info.SampleRate, info.ChannelCount)
+			}
+			if _, err := NewDepacketizer(info); err != nil && tt.codec != "g722" {
+				t.Errorf("NewDepacketizer: %v", err)
+			}
+		})
+	}
+	if StaticPayloadCodec(0) != "pcmu" || StaticPayloadCodec(96) != "" {
+		t.Error("unexpected static payload codec")
+	}
+}
+
+func TestFrameDepacketizers(t *testing.T) {
+	g726, err := NewG726Depacketizer(&SDPInfo{Codec: "AAL2-G726-24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g726.BitsPerSample != 3 || !g726.BigEndian {
+		t.Errorf("g726 bits=%d bigEndian=%v", g726.BitsPerSample, g726.BigEndian)
+	}
+	for _, codec := range []string{"g726", "g726-12", "g726-48"} {
+		if _, err := NewG726Depacketizer(&SDPInfo{Codec: codec}); err == nil {
+			t.Errorf("%s: expected error", codec)
+		}
+	}
+	if d := NewG711Depacketizer(&SDPInfo{Codec: "PCMU"}); !d.MuLaw {
+		t.Error("pcmu not detected")
+	}
+	if d := NewOpusDepacketizer(&SDPInfo{ChannelCount: 1}); d.ChannelCount != 1 || d.clockRate != 48000 {
+		t.Errorf("opus channels=%d clock=%d", d.ChannelCount, d.clockRate)
+	}
+
+	d := NewG711Depacketizer(nil)
+	aus := decodeAll(t, d, []*RTPInfo{
+		testRTP(1, 100, false, []byte{1, 2}),
+		testRTP(1, 100, false, []byte{1, 2}),
+		testRTP(3, 900, false, []byte{3}),
+	})
+	checkAudioUnits(t, aus, []*AccessUnit{
+		{Timestamp: 100, Keyframe: true, Data: []byte{1, 2}},
+		{Timestamp: 900, PTS: 100000000, Keyframe: true, Data: []byte{3}},
+	})
+	if d.Lost != 1 {
+		t.Errorf("Lost = %d", d.Lost)
+	}
+	if _, err := d.Decode(testRTP(4, 0, false, nil)); err == nil {
+		t.Error("expected error for empty payload")
+	}
+}
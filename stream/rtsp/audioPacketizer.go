@@ -0,0 +1,111 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+)
+
+// G711Packetizer g711 rtp打包器(RFC 3551)，每个采样一个字节，超过MTU时按采样拆分为多个rtp包
+type G711Packetizer struct {
+	*rtpPacker
+}
+
+// NewG711Packetizer 创建g711打包器，muLaw为true时是PCMU(负载类型0)，否则是PCMA(负载类型8)
+func NewG711Packetizer(muLaw bool, options PacketizerOptions) *G711Packetizer {
+	payloadType := 8
+	if muLaw {
+		payloadType = 0
+	}
+	return &G711Packetizer{rtpPacker: newRTPPacker(RTP_TYPE_AUDIO, payloadType, 8000, options)}
+}
+
+// Packetize 封装一段g711音频
+func (p *G711Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一段g711音频
+func (p *G711Packetizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("g711 frame is empty")
+	}
+	return p.packSamples(frame, p.rtpTimestamp(pts), p.maxPayloadSize(), 8), nil
+}
+
+// G726Packetizer g726 rtp打包器(RFC 3551)，超过MTU时按8个采样的整数倍拆分为多个rtp包
+type G726Packetizer struct {
+	*rtpPacker
+	bitsPerSample int
+}
+
+// NewG726Packetizer 创建g726打包器，bitsPerSample为2~5，对应16/24/32/40kbps
+func NewG726Packetizer(bitsPerSample int, options PacketizerOptions) (*G726Packetizer, error) {
+	if bitsPerSample < 2 || bitsPerSample > 5 {
+		return nil, fmt.Errorf("invalid g726 bits per sample %d", bitsPerSample)
+	}
+	return &G726Packetizer{
+		rtpPacker:     newRTPPacker(RTP_TYPE_AUDIO, 97, 8000, options),
+		bitsPerSample: bitsPerSample,
+	}, nil
+}
+
+// Codec 对应的rtpmap编码名称，例如 G726-32
+func (p *G726Packetizer) Codec() string {
+	return fmt.Sprintf("G726-%d", p.bitsPerSample*8)
+}
+
+// Packetize 封装一段g726音频
+func (p *G726Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一段g726音频
+func (p *G726Packetizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("g726 frame is empty")
+	}
+	// 8个采样占bitsPerSample个字节，拆分时保持采样完整
+	chunk := p.maxPayloadSize() / p.bitsPerSample * p.bitsPerSample
+	return p.packSamples(frame, p.rtpTimestamp(pts), chunk, p.bitsPerSample), nil
+}
+
+// packSamples 将音频按chunk字节拆分，时间戳按每个分片的采样数递增
+func (p *rtpPacker) packSamples(frame []byte, ts uint32, chunk int, bitsPerSample int) []*RTPPack {
+	var packs []*RTPPack
+	for len(frame) > 0 {
+		n := chunk
+		if n > len(frame) {
+			n = len(frame)
+		}
+		packs = append(packs, p.pack(frame[:n], ts, false))
+		ts += uint32(n * 8 / bitsPerSample)
+		frame = frame[n:]
+	}
+	return packs
+}
+
+// OpusPacketizer opus rtp打包器(RFC 7587)，每个rtp包为一个opus包
+type OpusPacketizer struct {
+	*rtpPacker
+}
+
+// NewOpusPacketizer 创建opus打包器，时钟频率固定为48000
+func NewOpusPacketizer(options PacketizerOptions) *OpusPacketizer {
+	return &OpusPacketizer{rtpPacker: newRTPPacker(RTP_TYPE_AUDIO, 97, 48000, options)}
+}
+
+// Packetize 封装一个opus包
+func (p *OpusPacketizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一个opus包，opus包不能分片
+func (p *OpusPacketizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("opus packet is empty")
+	}
+	if len(frame) > p.maxPayloadSize() {
+		return nil, fmt.Errorf("opus packet size %d exceeds %d", len(frame), p.maxPayloadSize())
+	}
+	return []*RTPPack{p.pack(frame, p.rtpTimestamp(pts), false)}, nil
+}
@@ -0,0 +1,66 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAudioPacketizers(t *testing.T) {
+	g726, err := NewG726Packetizer(4, PacketizerOptions{MTU: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g726.Codec() != "G726-32" {
+		t.Errorf("Codec = %s", g726.Codec())
+	}
+	if _, err := NewG726Packetizer(6, PacketizerOptions{}); err == nil {
+		t.Error("expected error for invalid bits per sample")
+	}
+
+	tests := []struct {
+		name        string
+		packetizer  Packetizer
+		payloadType int
+		frame       []byte
+		// 每个rtp包的负载长度和相对第一个包的时间戳
+		sizes      []int
+		timestamps []uint32
+	}{
+		{"pcmu", NewG711Packetizer(true, PacketizerOptions{MTU: 100}), 0, make([]byte, 200), []int{88, 88, 24}, []uint32{0, 88, 176}},
+		{"pcma", NewG711Packetizer(false, PacketizerOptions{}), 8, make([]byte, 160), []int{160}, []uint32{0}},
+		// 8个采样占4个字节，拆分时保持采样完整
+		{"g726-32", g726, 97, make([]byte, 200), []int{88, 88, 24}, []uint32{0, 176, 352}},
+		{"opus", NewOpusPacketizer(PacketizerOptions{}), 97, make([]byte, 120), []int{120}, []uint32{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packs, err := tt.packetizer.Packetize(&AccessUnit{PTS: 20 * time.Millisecond, Data: tt.frame})
+			if err != nil {
+				t.Fatal(err)
+			}
+			infos := parsePacks(t, packs)
+			if len(infos) != len(tt.sizes) {
+				t.Fatalf("got %d packets, want %d", len(infos), len(tt.sizes))
+			}
+			var data []byte
+			for i, info := range infos {
+				ts := uint32(info.Timestamp - infos[0].Timestamp)
+				if len(info.Payload) != tt.sizes[i] || ts != tt.timestamps[i] || info.PayloadType != tt.payloadType || info.Marker {
+					t.Errorf("packet %d: size=%d ts=+%d pt=%d marker=%v", i, len(info.Payload), ts, info.PayloadType, info.Marker)
+				}
+				data = append(data, info.Payload...)
+			}
+			if !bytes.Equal(data, tt.frame) {
+				t.Error("payloads do not add up to the frame")
+			}
+			if _, err := tt.packetizer.Packetize(&AccessUnit{}); err == nil {
+				t.Error("expected error for empty frame")
+			}
+		})
+	}
+
+	if _, err := NewOpusPacketizer(PacketizerOptions{MTU: 100}).PacketizeFrame(make([]byte, 100), 0); err == nil {
+		t.Error("expected error for opus packet exceeding mtu")
+	}
+}
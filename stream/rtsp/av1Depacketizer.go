@@ -0,0 +1,196 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/av1"
+)
+
+// AV1Depacketizer av1 rtp解包器(AV1 RTP Payload Specification)
+// 根据aggregation header重组OBU，以marker位或时间戳变化作为时间单元边界
+// 输出的时间单元为带长度字段的低开销格式，不含temporal delimiter
+// 检测到丢包后丢弃数据直到下一个关键帧
+type AV1Depacketizer struct {
+	clockRate int
+
+	seq          sequenceTracker
+	waitKeyframe bool
+
+	timestamp   uint32
+	obus        [][]byte
+	size        int
+	fragment    []byte
+	fragmenting bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewAV1Depacketizer 创建av1解包器，info 可为nil
+func NewAV1Depacketizer(info *SDPInfo) *AV1Depacketizer {
+	d := &AV1Depacketizer{
+		clockRate:    90000,
+		waitKeyframe: true,
+	}
+	if info != nil && info.TimeScale > 0 {
+		d.clockRate = info.TimeScale
+	}
+	return d
+}
+
+// Decode 输入一个rtp包，返回此时已完整的时间单元
+func (d *AV1Depacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil || len(rtp.Payload) < 2 {
+		return nil, fmt.Errorf("av1 rtp payload too short")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+		d.waitKeyframe = true
+	}
+
+	var aus []*AccessUnit
+	ts := uint32(rtp.Timestamp)
+	if (len(d.obus) > 0 || d.fragmenting) && ts != d.timestamp {
+		// marker丢失时以时间戳变化作为边界
+		if au, err := d.flush(); err != nil {
+			return nil, err
+		} else if au != nil {
+			aus = append(aus, au)
+		}
+	}
+	d.timestamp = ts
+
+	if err := d.unpack(rtp.Payload); err != nil {
+		d.discard()
+		d.waitKeyframe = true
+		return aus, err
+	}
+
+	if rtp.Marker {
+		au, err := d.flush()
+		if err != nil {
+			return aus, err
+		}
+		if au != nil {
+			aus = append(aus, au)
+		}
+	}
+	return aus, nil
+}
+
+// unpack 解析一个rtp负载中的OBU元素
+func (d *AV1Depacketizer) unpack(payload []byte) error {
+	// Z|Y|W(2)|N|-(3)
+	header := payload[0]
+	z := header&0x80 != 0
+	y := header&0x40 != 0
+	w := int(header >> 4 & 0x03)
+	payload = payload[1:]
+
+	for i := 0; len(payload) > 0; i++ {
+		// W为0时每个元素都带长度，否则最后一个元素不带长度
+		var element []byte
+		if w == 0 || i < w-1 {
+			size, n, err := av1.ReadLEB128(payload)
+			if err != nil {
+				return err
+			}
+			if uint64(len(payload)-n) < size {
+				return fmt.Errorf("av1 obu element size %d exceeds payload", size)
+			}
+			element = payload[n : n+int(size)]
+			payload = payload[n+int(size):]
+		} else {
+			element = payload
+			payload = nil
+		}
+		last := len(payload) == 0
+
+		if i == 0 && z {
+			if !d.fragmenting {
+				// 缺少起始分片，丢弃
+				continue
+			}
+			if len(d.fragment)+len(element) > maxAccessUnitSize {
+				return fmt.Errorf("av1 fragmented obu exceeds %d bytes", maxAccessUnitSize)
+			}
+			d.fragment = append(d.fragment, element...)
+		} else {
+			d.fragment = append(d.fragment[:0], element...)
+			d.fragmenting = true
+		}
+		if last && y {
+			// 在下一个包中继续
+			return nil
+		}
+		obu := d.fragment
+		d.fragment = nil
+		d.fragmenting = false
+		if err := d.append(obu); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// append 加入一个完整的OBU到当前时间单元
+func (d *AV1Depacketizer) append(obu []byte) error {
+	if len(obu) == 0 {
+		return nil
+	}
+	switch av1.Type(obu) {
+	case av1.OBUTypeTemporalDelimiter, av1.OBUTypeTileList, av1.OBUTypePadding:
+		return nil
+	}
+	obu, err := av1.WithSizeField(obu)
+	if err != nil {
+		return err
+	}
+	if d.size+len(obu) > maxAccessUnitSize {
+		return fmt.Errorf("av1 temporal unit exceeds %d bytes", maxAccessUnitSize)
+	}
+	d.obus = append(d.obus, append([]byte(nil), obu...))
+	d.size += len(obu)
+	return nil
+}
+
+// discard 丢弃当前未完成的时间单元
+func (d *AV1Depacketizer) discard() {
+	d.obus = nil
+	d.size = 0
+	d.fragment = nil
+	d.fragmenting = false
+}
+
+// flush 结束当前时间单元，等待关键帧期间返回nil
+func (d *AV1Depacketizer) flush() (*AccessUnit, error) {
+	obus := d.obus
+	d.discard()
+	if len(obus) == 0 {
+		return nil, nil
+	}
+	keyframe := av1.IsKeyframe(obus)
+	if d.waitKeyframe {
+		if !keyframe {
+			return nil, nil
+		}
+		d.waitKeyframe = false
+	}
+	data, err := av1.JoinOBUs(obus)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessUnit{
+		Timestamp: d.timestamp,
+		PTS:       timestampToDuration(d.ts.extend(d.timestamp), d.clockRate),
+		Keyframe:  keyframe,
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/av1"
+)
+
+// AV1Packetizer av1 rtp打包器(AV1 RTP Payload Specification)
+// 去掉temporal delimiter和OBU长度字段，每个OBU元素前带长度(W=0)，超过MTU时分片
+type AV1Packetizer struct {
+	*rtpPacker
+}
+
+// NewAV1Packetizer 创建av1打包器
+func NewAV1Packetizer(options PacketizerOptions) *AV1Packetizer {
+	return &AV1Packetizer{rtpPacker: newRTPPacker(RTP_TYPE_VIDEO, 96, 90000, options)}
+}
+
+// Packetize 封装一个时间单元
+func (p *AV1Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一个低开销格式的时间单元
+func (p *AV1Packetizer) PacketizeFrame(data []byte, pts time.Duration) ([]*RTPPack, error) {
+	all, err := av1.SplitOBUs(data)
+	if err != nil {
+		return nil, err
+	}
+	obus := make([][]byte, 0, len(all))
+	for _, obu := range all {
+		switch av1.Type(obu) {
+		case av1.OBUTypeTemporalDelimiter, av1.OBUTypeTileList, av1.OBUTypePadding:
+			continue
+		}
+		obu, err := av1.WithoutSizeField(obu)
+		if err != nil {
+			return nil, err
+		}
+		obus = append(obus, obu)
+	}
+	if len(obus) == 0 {
+		return nil, fmt.Errorf("av1 temporal unit is empty")
+	}
+
+	// 新的编码视频序列的第一个包N=1
+	newSequence := av1.IsKeyframe(obus)
+	ts := p.rtpTimestamp(pts)
+	maxSize := p.maxPayloadSize() - 1
+
+	var payloads [][]byte
+	var current []byte
+	continued := false
+	flush := func(fragmented bool) {
+		// Z|Y|W(2)|N|-(3)
+		var header byte
+		if continued {
+			header |= 0x80
+		}
+		if fragmented {
+			header |= 0x40
+		}
+		if newSequence && len(payloads) == 0 {
+			header |= 0x08
+		}
+		payloads = append(payloads, append([]byte{header}, current...))
+		current = nil
+		continued = fragmented
+	}
+
+	for _, obu := range obus {
+		for len(obu) > 0 {
+			space := maxSize - len(current)
+			n := space - len(av1.AppendLEB128(nil, uint64(space)))
+			if n <= 0 {
+				flush(false)
+				continue
+			}
+			if n > len(obu) {
+				n = len(obu)
+			}
+			current = av1.AppendLEB128(current, uint64(n))
+			current = append(current, obu[:n]...)
+			obu = obu[n:]
+			if len(obu) > 0 {
+				flush(true)
+			}
+		}
+	}
+	if len(current) > 0 {
+		flush(false)
+	}
+
+	packs := make([]*RTPPack, 0, len(payloads))
+	for i, payload := range payloads {
+		packs = append(packs, p.pack(payload, ts, i == len(payloads)-1))
+	}
+	return packs, nil
+}
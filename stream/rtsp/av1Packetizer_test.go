@@ -0,0 +1,79 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec/av1"
+)
+
+func TestAV1PacketizerRoundTrip(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	seq := []byte{0x0a, 0x03, 0x00, 0x00, 0x00}
+	keyframe := append([]byte{0x32, 0xf5, 0x03, 0x10}, bytes.Repeat([]byte{0xAA}, 500)...)
+	interframe := append([]byte{0x32, 0x65, 0x30}, bytes.Repeat([]byte{0xBB}, 100)...)
+	join := func(obus ...[]byte) []byte { return bytes.Join(obus, nil) }
+	frames := [][]byte{join(td, interframe), join(td, seq, keyframe), join(td, interframe)}
+
+	packets, aus := testVideoRoundTrip(t, NewAV1Packetizer(PacketizerOptions{MTU: 200}), NewAV1Depacketizer(nil), frames)
+	// 输出不含temporal delimiter
+	if len(aus) != 2 || !bytes.Equal(aus[0].Data, join(seq, keyframe)) || !aus[0].Keyframe ||
+		!bytes.Equal(aus[1].Data, interframe) || aus[1].Keyframe {
+		t.Fatalf("round trip mismatch, %d frames", len(aus))
+	}
+	for i, infos := range packets {
+		if got := rtpKeyframe("av1", false, infos[0].Payload); got != (i == 1) {
+			t.Errorf("frame %d: rtpKeyframe = %v", i, got)
+		}
+		for j, info := range infos {
+			// 除最后一个包外都以分片结束
+			if fragmented := info.Payload[0]&0x40 != 0; fragmented != (j < len(infos)-1) {
+				t.Errorf("frame %d packet %d: Y=%v", i, j, fragmented)
+			}
+		}
+	}
+
+	d := NewAV1Depacketizer(nil)
+	all := append(append([]*RTPInfo(nil), packets[1][0]), packets[1][2:]...)
+	all = append(all, packets[2]...)
+	if aus := decodeAll(t, d, all); len(aus) != 0 || d.Lost != 1 {
+		t.Errorf("got %d frames after loss, lost %d", len(aus), d.Lost)
+	}
+}
+
+func TestAV1Depacketizer(t *testing.T) {
+	keyframe := []byte{0x30, 0x10, 0xAA}
+	tests := []struct {
+		name    string
+		packets []*RTPInfo
+		want    []byte
+	}{
+		// W=2，第二个元素不带长度
+		{"w=2", []*RTPInfo{testRTP(1, 0, true, []byte{0x28, 0x03, 0x08, 0x00, 0x00, 0x30, 0x10, 0xAA})},
+			[]byte{0x0a, 0x02, 0x00, 0x00, 0x32, 0x02, 0x10, 0xAA}},
+		// W=1 跨包分片
+		{"fragment", []*RTPInfo{
+			testRTP(1, 0, false, []byte{0x58, 0x30, 0x10}),
+			testRTP(2, 0, true, []byte{0x90, 0xAA}),
+		}, []byte{0x32, 0x02, 0x10, 0xAA}},
+		// 时间戳变化时结束上一个时间单元
+		{"timestamp change", []*RTPInfo{
+			testRTP(1, 0, false, append([]byte{0x18}, keyframe...)),
+			testRTP(2, 3000, false, append([]byte{0x10}, keyframe...)),
+		}, []byte{0x32, 0x02, 0x10, 0xAA}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aus := decodeAll(t, NewAV1Depacketizer(nil), tt.packets)
+			if len(aus) != 1 || !bytes.Equal(aus[0].Data, tt.want) {
+				t.Fatalf("got %d units", len(aus))
+			}
+			if obus, err := av1.SplitOBUs(aus[0].Data); err != nil || !av1.IsKeyframe(obus) {
+				t.Errorf("output is not a keyframe temporal unit: %v", err)
+			}
+		})
+	}
+	if _, err := NewAV1Depacketizer(nil).Decode(testRTP(1, 0, true, []byte{0x00, 0x05, 0x30})); err == nil {
+		t.Error("expected error for element size exceeding payload")
+	}
+}
@@ -9,12 +9,17 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mrHChen/goutils/stream/common"
 	"github.com/mrHChen/goutils/stream/utils"
 )
 
+// clientReconnectMaxInterval 重连等待时长加倍的上限
+const clientReconnectMaxInterval = 30 * time.Second
+
 // Client rtsp 客户端 C
 type Client struct {
 	Server  *Server
@@ -25,6 +30,8 @@ type Client struct {
 	URL     *url.URL
 	Path    string
 	Stopped bool
+	// stopped 以原子操作读写，Stopped 只在 stop 中设置，其他协程通过 isStopped 判断
+	stopped int32
 
 	VCodec   string
 	VControl string
@@ -41,11 +48,33 @@ type Client struct {
 	Conn      *ClientConn
 	TransType TransType
 
-	RTPHandles  []func(*RTPPack)
+	RTPHandles []func(*RTPPack)
+	// StopHandles 拉流结束时调用，开启重连时在放弃重连后调用
 	StopHandles []func()
+	LossHandles []func(*LossEvent)
+
+	// lock 重连时在其他协程中替换 Conn、SDPRaw 和各路媒体的信息，推流端加读锁获取
+	lock sync.RWMutex
 
+	// Deprecated: 使用 Pusher.Filters 添加 NewPayloadEncryptFilter/NewPayloadDecryptFilter
 	EncryptPack func([]byte, uint16) []byte
-	DecodePack  func([]byte) []byte
+	// Deprecated: 使用 Pusher.Filters 添加 NewPayloadDecryptFilter
+	DecodePack func([]byte) []byte
+
+	// 带内获取的视频参数集
+	paramSets parameterSetTracker
+	// 接收统计，用于向摄像机发送RR
+	rtcpReceiver *rtcpReceiver
+	// 由SR换算的采集时间
+	wallClock *WallClock
+	// 抖动缓冲，未启用时为nil
+	jitterBuffer *trackJitterBuffers
+	// deliverLock 缓冲的输出在接收协程和定时协程中进行，保证处理函数按顺序调用
+	deliverLock sync.Mutex
+	// discontinuity 重连后还没有输出包，由deliverLock保护
+	discontinuity bool
+	// RTP/SAVP媒体的加解密，密钥取自DESCRIBE的sdp
+	srtp srtpContexts
 }
 
 type ClientOptions struct {
@@ -59,10 +88,16 @@ type ClientOptions struct {
 	Agent string
 	// 超时
 	Timeout time.Duration
-	// 是否加密
+	// 是否以 EncryptPack 加密，Deprecated: 使用 Pusher.Filters
 	IsEncrypt bool
-	// 是否解密
+	// 是否以 DecodePack 解密，Deprecated: 使用 Pusher.Filters
 	IsDecode bool
+	// 抖动缓冲
+	JitterBuffer JitterBufferOptions
+	// ReconnectAttempts 与摄像机的连接断开后连续重连的次数，为0时不重连，重连期间保留推流和播放器
+	ReconnectAttempts int
+	// ReconnectInterval 第一次重连前的等待时长，之后每次加倍，最长30秒，默认为1秒
+	ReconnectInterval time.Duration
 }
 
 // NewRTSPClient 创建 rtsp 客户端实例
@@ -128,11 +163,14 @@ func (c *Client) Run() error {
 
 	url, err := url.Parse(c.options.RtspAddress)
 	if err != nil {
-		c.Println("Address resolution error: %s", err)
+		c.Println(fmt.Sprintf("Address resolution error: %s", err))
 		return err
 	}
-	c.URL = url
-	c.Path = url.Path
+	if c.URL == nil {
+		// 重连时地址不变，推流端可能正在其他协程中读取
+		c.URL = url
+		c.Path = url.Path
+	}
 	// 循环建立连接
 	conn, err := NewClientConn(c, url.Scheme, url.Host)
 	if err != nil {
@@ -169,22 +207,290 @@ func (c *Client) Run() error {
 		conn.Close()
 		return err
 	}
+	c.lock.Lock()
 	c.Conn = conn
+	c.lock.Unlock()
 	return nil
 }
 
+// conn 当前与摄像机的连接
+func (c *Client) conn() *ClientConn {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.Conn
+}
+
+// Stop 停止拉流，关闭与摄像机的连接，推流和录制等在连接结束后停止
+func (c *Client) Stop() {
+	if !c.stop() {
+		return
+	}
+	if conn := c.conn(); conn != nil {
+		conn.Close()
+		conn.doClose()
+	}
+}
+
+// stop 标记拉流结束，已结束时返回false
+func (c *Client) stop() bool {
+	if !atomic.CompareAndSwapInt32(&c.stopped, 0, 1) {
+		return false
+	}
+	c.Stopped = true
+	return true
+}
+
+// finish 拉流结束，标记停止后通知推流和录制等结束
+func (c *Client) finish() {
+	c.stop()
+	for _, h := range c.StopHandles {
+		h()
+	}
+}
+
+// isStopped 拉流是否已结束，可在任意协程中调用
+func (c *Client) isStopped() bool {
+	return atomic.LoadInt32(&c.stopped) != 0
+}
+
 //Println mini logging functions
 func (c *Client) Println(v ...interface{}) {
 	if c.options.Debug {
-		log.Println(v)
+		log.Println(v...)
+	}
+}
+
+// VideoParams 视频的分辨率、profile、帧率等参数，优先使用带内的SPS/VPS，无法解析时返回nil
+func (c *Client) VideoParams() *VideoParams {
+	var sdpSets [][]byte
+	if info := ParseSDP(c.SDPRaw)["video"]; info != nil {
+		sdpSets = info.ParameterSets
+	}
+	return c.paramSets.videoParams(c.VCodec, sdpSets)
+}
+
+// receive 处理一个收到的包：统计、换算采集时间、经抖动缓冲后交给处理函数
+func (c *Client) receive(pack *RTPPack, videoInfo *SDPInfo, now time.Time) {
+	if pack.Type == RTP_TYPE_VIDEO {
+		c.trackParameterSets(pack, videoInfo)
+	}
+	if err := c.rtcpReceiver.onPacket(pack, now); err != nil {
+		c.Println(fmt.Errorf("parse %v error:%v", pack.Type, err))
+	}
+	if isRTCP(pack.Type) {
+		c.wallClock.OnRTCP(pack)
+	} else if t, ok := c.wallClock.OnRTP(pack, now); ok {
+		// 包在分发之前只属于接收协程，此时设置采集时间
+		pack.CaptureTime = t
+	}
+
+	c.deliver(c.jitterBuffer.push(pack, now))
+}
+
+// deliver 将抖动缓冲输出的包和丢包事件交给处理函数
+func (c *Client) deliver(packs []*RTPPack, losses []*LossEvent) {
+	if len(packs) == 0 && len(losses) == 0 {
+		return
+	}
+	c.deliverLock.Lock()
+	defer c.deliverLock.Unlock()
+	if c.discontinuity && len(packs) > 0 {
+		// 包在分发之前只属于客户端
+		packs[0].Discontinuity = true
+		c.discontinuity = false
+	}
+	for _, loss := range losses {
+		for _, h := range c.LossHandles {
+			h(loss)
+		}
+	}
+	for _, pack := range packs {
+		for _, h := range c.RTPHandles {
+			h(pack)
+		}
+	}
+}
+
+// releaseJitter 定时输出抖动缓冲中等待超时的包，摄像机暂停时缓冲中的包也按延迟目标输出，连接关闭后退出
+func (c *Client) releaseJitter(conn *ClientConn, jitterBuffer *trackJitterBuffers) {
+	ticker := time.NewTicker(jitterBuffer.releaseInterval())
+	defer ticker.Stop()
+	for range ticker.C {
+		if c.isStopped() || c.conn() != conn {
+			return
+		}
+		c.deliver(jitterBuffer.release(time.Now()))
+	}
+}
+
+// sendNACKs 抖动缓冲中有缺包时向摄像机或服务端请求重传
+func (c *Client) sendNACKs(conn *ClientConn, now time.Time) {
+	for _, pack := range c.jitterBuffer.nacks(now, c.rtcpReceiver.ssrc) {
+		if err := c.writeRTCP(conn, pack); err != nil {
+			c.Println(fmt.Errorf("send %v nack error:%v", pack.Type, err))
+		}
+	}
+}
+
+// writeRTCP 通过interleaved通道发送rtcp包，RTP/SAVP时先加密
+func (c *Client) writeRTCP(conn *ClientConn, pack *RTPPack) error {
+	b, err := c.srtp.encrypt(pack)
+	if err != nil {
+		return err
+	}
+	return conn.WriteInterleaved(c.rtcpChannel(pack.Type), b)
+}
+
+// rtcpChannel rtcp包对应的交织通道
+func (c *Client) rtcpChannel(t RTPType) int {
+	if t == RTP_TYPE_AUDIOCONTROL {
+		return c.aRtcpPort
 	}
+	return c.vRtcpPort
 }
 
+// sendReceiverReports 定时通过interleaved通道发送RR，连接关闭后退出
+func (c *Client) sendReceiverReports(conn *ClientConn, receiver *rtcpReceiver) {
+	ticker := time.NewTicker(rtcpReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if c.isStopped() || c.conn() != conn {
+			return
+		}
+		for _, pack := range receiver.reports(time.Now()) {
+			if err := c.writeRTCP(conn, pack); err != nil {
+				c.Println(fmt.Errorf("send %v error:%v", pack.Type, err))
+				return
+			}
+		}
+	}
+}
+
+// JitterStats 指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的抖动缓冲统计，未启用时返回nil
+func (c *Client) JitterStats(t RTPType) *JitterBufferStats {
+	return c.jitterBuffer.stats(t)
+}
+
+// WallClock 各路媒体rtp时间戳对应的采集时间和音视频同步的PTS，开始拉流前为nil
+func (c *Client) WallClock() *WallClock {
+	return c.wallClock
+}
+
+// ReceptionStats 指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的接收统计，没有时返回nil
+func (c *Client) ReceptionStats(t RTPType) *ReceptionStats {
+	if c.rtcpReceiver == nil {
+		return nil
+	}
+	return c.rtcpReceiver.stats(t)
+}
+
+// trackParameterSets 从带内的视频rtp包中获取参数集，SPS变化时记录新的视频参数
+func (c *Client) trackParameterSets(pack *RTPPack, videoInfo *SDPInfo) {
+	rtp := ParseRTP(pack.Buffer.Bytes())
+	if rtp == nil {
+		return
+	}
+	donl := videoInfo != nil && videoInfo.MaxDonDiff > 0
+	if c.paramSets.update(c.VCodec, donl, rtp) {
+		c.Println(fmt.Sprintf("video sps changed: %v", c.VideoParams()))
+	}
+}
+
+// startStream 接收摄像机的流，连接断开后按设置重连，停止或放弃重连后通知推流和录制等结束
 func (c *Client) startStream() {
+	defer c.finish()
+	for {
+		c.stream(c.conn())
+		if c.isStopped() || !c.reconnect() {
+			return
+		}
+	}
+}
+
+// reconnect 按加倍的等待时长重连，成功后输出的第一个包标记为不连续，停止或重连次数用完时返回false
+func (c *Client) reconnect() bool {
+	interval := c.options.ReconnectInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for attempt := 1; attempt <= c.options.ReconnectAttempts; attempt++ {
+		if !c.sleep(interval) {
+			return false
+		}
+		if err := c.Run(); err != nil {
+			c.Println(fmt.Errorf("reconnect %d/%d error:%v", attempt, c.options.ReconnectAttempts, err))
+			if interval *= 2; interval > clientReconnectMaxInterval {
+				interval = clientReconnectMaxInterval
+			}
+			continue
+		}
+		if c.isStopped() {
+			// 重连过程中调用了Stop
+			conn := c.conn()
+			conn.Close()
+			conn.doClose()
+			return false
+		}
+		c.deliverLock.Lock()
+		c.discontinuity = true
+		c.deliverLock.Unlock()
+		c.Println(fmt.Sprintf("reconnected to %s, attempt %d", c.options.RtspAddress, attempt))
+		return true
+	}
+	return false
+}
+
+// sleep 等待d，期间拉流停止时返回false
+func (c *Client) sleep(d time.Duration) bool {
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+		if c.isStopped() {
+			return false
+		}
+		wait := time.Until(deadline)
+		if wait > 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+	return !c.isStopped()
+}
+
+// stream 接收一个连接上的流，直到连接断开或停止
+func (c *Client) stream(conn *ClientConn) {
 	startTime := time.Now()
-	conn := c.Conn
-	defer conn.doClose()
-	for !c.Stopped {
+	defer func() {
+		conn.Close()
+		conn.doClose()
+	}()
+	sdpMap := ParseSDP(c.SDPRaw)
+	videoInfo := sdpMap["video"]
+	// 部分摄像机收不到rtcp时会断开会话，定时发送RR
+	c.rtcpReceiver = newRTCPReceiver(sdpClockRates(sdpMap))
+	c.wallClock = NewWallClock(sdpClockRates(sdpMap))
+	c.jitterBuffer = newTrackJitterBuffers(c.options.JitterBuffer)
+	contexts, err := newSRTPContexts(sdpCryptos(sdpMap))
+	if err != nil {
+		c.Println(err)
+		return
+	}
+	c.srtp = contexts
+	// sdp中有rtx或fec时，重传包和fec包与媒体包在同一个通道中
+	repairs := make(map[RTPType]*rtpRepair)
+	if repair := newRTPRepair(videoInfo); repair != nil {
+		repairs[RTP_TYPE_VIDEO] = repair
+	}
+	if repair := newRTPRepair(sdpMap["audio"]); repair != nil {
+		repairs[RTP_TYPE_AUDIO] = repair
+	}
+	go c.sendReceiverReports(conn, c.rtcpReceiver)
+	if c.jitterBuffer != nil {
+		go c.releaseJitter(conn, c.jitterBuffer)
+		// 连接结束时输出缓冲中剩余的包
+		defer func(jitterBuffer *trackJitterBuffers) {
+			c.deliver(jitterBuffer.drain(time.Now()))
+		}(c.jitterBuffer)
+	}
+	for !c.isStopped() {
 		if time.Since(startTime) > time.Duration(30)*time.Second {
 			startTime = time.Now()
 			// 心跳保活
@@ -194,7 +500,7 @@ func (c *Client) startStream() {
 		}
 		b, err := conn.connRW.ReadByte()
 		if err != nil {
-			if !c.Stopped {
+			if !c.isStopped() {
 				c.Println(fmt.Errorf("client.connRW.ReadByte err:%v", err))
 			}
 			return
@@ -205,7 +511,7 @@ func (c *Client) startStream() {
 			header[0] = b
 			_, err = io.ReadFull(conn.connRW, header[1:])
 			if err != nil {
-				if !c.Stopped {
+				if !c.isStopped() {
 					c.Println(fmt.Errorf("client.connRW.ReadByte err:%v", err))
 				}
 				return
@@ -216,7 +522,7 @@ func (c *Client) startStream() {
 
 			_, err = io.ReadFull(conn.connRW, content)
 			if err != nil {
-				if !c.Stopped {
+				if !c.isStopped() {
 					c.Println(fmt.Errorf("io.ReadFull err:%v", err))
 				}
 				return
@@ -249,18 +555,27 @@ func (c *Client) startStream() {
 				c.Println(fmt.Errorf("unknow rtp pack type, channel:%v", channel))
 				continue
 			}
-
-			for _, h := range c.RTPHandles {
-				h(pack)
+			if err := c.srtp.decrypt(pack); err != nil {
+				c.Println(fmt.Errorf("decrypt %v error:%v", pack.Type, err))
+				continue
+			}
+			now := time.Now()
+			received := []*RTPPack{pack}
+			if repair := repairs[pack.Type]; repair != nil {
+				received = repair.process(pack)
+			}
+			for _, pack := range received {
+				c.receive(pack, videoInfo, now)
 			}
+			c.sendNACKs(conn, now)
 		default: // rtsp
 			builder := bytes.Buffer{}
 			builder.WriteByte(b)
 			contentLen := 0
-			for !c.Stopped {
+			for !c.isStopped() {
 				line, prefix, err := conn.connRW.ReadLine()
 				if err != nil {
-					if !c.Stopped {
+					if !c.isStopped() {
 						c.Println(fmt.Errorf("client.connRW.ReadLine err:%v", err))
 					}
 					return
@@ -270,7 +585,7 @@ func (c *Client) startStream() {
 						content := make([]byte, contentLen)
 						_, err = io.ReadFull(conn.connRW, content)
 						if err != nil {
-							if !c.Stopped {
+							if !c.isStopped() {
 								c.Println(fmt.Errorf("Read content err.ContentLength:%d ", err))
 							}
 							return
@@ -291,7 +606,7 @@ func (c *Client) startStream() {
 					splits := strings.Split(s, ":")
 					contentLen, err = strconv.Atoi(strings.TrimSpace(splits[1]))
 					if err != nil {
-						if !c.Stopped {
+						if !c.isStopped() {
 							c.Println(fmt.Errorf("strconv.Atoi err:%v, str:%v", err, splits[1]))
 						}
 						return
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/mrHChen/goutils/stream/base"
 	"github.com/mrHChen/goutils/stream/headers"
@@ -64,8 +65,10 @@ type ClientConn struct {
 	// 验证
 	sender *headers.Sender
 
-	connRW  *bufio.ReadWriter
-	session string
+	connRW *bufio.ReadWriter
+	// 请求和interleaved数据可能在不同的协程中写入
+	writeLock sync.Mutex
+	session   string
 	// in
 	options  chan optionsReq
 	describe chan describeReq
@@ -165,10 +168,6 @@ func (cc *ClientConn) run() {
 			return
 		}
 	}
-
-	cc.ctxCancel()
-
-	cc.doClose()
 }
 
 // Options  写入一个OPTIONS请求并读取一个响应。
@@ -224,7 +223,9 @@ func (cc *ClientConn) doDescribe(u *url.URL) (*sdp.Session, *base.Response, erro
 	if err != nil {
 		return nil, nil, err
 	}
+	cc.c.lock.Lock()
 	cc.c.SDPRaw = string(res.Body)
+	cc.c.lock.Unlock()
 	return _sdp, res, nil
 }
 
@@ -250,6 +251,11 @@ func (cc *ClientConn) doSetup(u *url.URL, media *sdp.Media) (*base.Response, err
 	var rtpPort, rtcpPort int
 	control := media.Attributes.Get("control")
 	codec := media.Format[0].Name
+	if codec == "" {
+		// 缺少rtpmap时按静态负载类型识别
+		codec = strings.ToUpper(StaticPayloadCodec(int(media.Format[0].Payload)))
+	}
+	cc.c.lock.Lock()
 	if media.Type == "video" {
 		rtpPort, rtcpPort = cc.c.vRtpPort, cc.c.vRtcpPort
 		cc.c.VControl, cc.c.VCodec = control, codec
@@ -258,6 +264,7 @@ func (cc *ClientConn) doSetup(u *url.URL, media *sdp.Media) (*base.Response, err
 		rtpPort, rtcpPort = cc.c.aRtpPort, cc.c.aRtcpPort
 		cc.c.AControl, cc.c.ACodec = control, codec
 	}
+	cc.c.lock.Unlock()
 
 	l := ""
 	if strings.Index(strings.ToLower(control), "rtsp://") == 0 {
@@ -266,11 +273,15 @@ func (cc *ClientConn) doSetup(u *url.URL, media *sdp.Media) (*base.Response, err
 		l = strings.TrimRight(u.String(), "/") + "/" + strings.TrimLeft(control, "/")
 	}
 
-	transport := fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", rtpPort, rtcpPort)
+	profile := "RTP/AVP"
+	if strings.Contains(strings.ToUpper(media.Proto), "SAVP") {
+		profile = "RTP/SAVP"
+	}
+	transport := fmt.Sprintf("%s/TCP;unicast;interleaved=%d-%d", profile, rtpPort, rtcpPort)
 
-	cc.c.Println(
-		"Parse DESCRIBE response, VIDEO control:%s, codec:%s, url:%s,Session:%s,rtpPort:%d,rtpPort:%d",
-		control, codec, l, rtpPort, rtcpPort)
+	cc.c.Println(fmt.Sprintf(
+		"Parse DESCRIBE response, control:%s, codec:%s, url:%s, rtpPort:%d, rtcpPort:%d",
+		control, codec, l, rtpPort, rtcpPort))
 	ur, _ := url.Parse(l)
 	res, err := cc.do(&base.Request{
 		Method: base.Setup,
@@ -335,9 +346,11 @@ func (cc *ClientConn) do(req *base.Request, skipResponse bool) (*base.Response,
 	cc.cSeq++
 	req.Header["CSeq"] = base.HeaderValue{strconv.FormatInt(int64(cc.cSeq), 10)}
 
-	cc.c.Println("client [c->s] \n %v", req)
+	cc.c.Println(fmt.Sprintf("client [c->s] \n %v", req))
 
+	cc.writeLock.Lock()
 	err := req.Write(cc.connRW.Writer)
+	cc.writeLock.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -352,7 +365,7 @@ func (cc *ClientConn) do(req *base.Request, skipResponse bool) (*base.Response,
 		return nil, err
 	}
 
-	cc.c.Println("client [s->c] \n %v", res)
+	cc.c.Println(fmt.Sprintf("client [s->c] \n %v", res))
 
 	if v, ok := res.Header["Session"]; ok {
 		var sx headers.Session
@@ -379,7 +392,30 @@ func (cc *ClientConn) do(req *base.Request, skipResponse bool) (*base.Response,
 	return res, nil
 }
 
+// WriteInterleaved 通过rtsp连接发送interleaved数据，例如rtcp
+func (cc *ClientConn) WriteInterleaved(channel int, data []byte) error {
+	if len(data) > 0xFFFF {
+		return fmt.Errorf("interleaved data too long: %d", len(data))
+	}
+	cc.writeLock.Lock()
+	defer cc.writeLock.Unlock()
+	if cc.Conn == nil {
+		return errors.New(" Connection terminated [WriteInterleaved] ")
+	}
+	header := []byte{0x24, byte(channel), byte(len(data) >> 8), byte(len(data))}
+	if _, err := cc.connRW.Write(header); err != nil {
+		return err
+	}
+	if _, err := cc.connRW.Write(data); err != nil {
+		return err
+	}
+	return cc.connRW.Flush()
+}
+
 func (cc *ClientConn) doClose() {
+	// rtcp可能在其他协程中通过 WriteInterleaved 写入
+	cc.writeLock.Lock()
+	defer cc.writeLock.Unlock()
 	if cc.Conn != nil {
 		cc.connRW.Flush()
 		cc.Conn.Close()
@@ -0,0 +1,171 @@
+package rtsp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dashTimeFormat MPD中的时间格式
+const dashTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// waitSegment 等待每路媒体的第一个分段完成，超时后参考媒体有分段也返回true
+func (m *dashMuxer) waitSegment() bool {
+	ready := func(all bool) bool {
+		if len(m.reps) == 0 {
+			return false
+		}
+		for _, rep := range m.reps {
+			if len(rep.segments) == 0 && (all || rep.t == m.reps[0].t) {
+				return false
+			}
+		}
+		return true
+	}
+	timer := time.AfterFunc(m.options.WaitTimeout, func() {
+		m.lock.Lock()
+		m.cond.Broadcast()
+		m.lock.Unlock()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(m.options.WaitTimeout)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for !ready(true) && !m.closed && time.Now().Before(deadline) {
+		m.cond.Wait()
+	}
+	return ready(false)
+}
+
+// serve 响应MPD、初始化段和分段的请求，name 为路径中的文件名
+func (m *dashMuxer) serve(w http.ResponseWriter, r *http.Request, name string) {
+	m.lock.Lock()
+	m.lastAccess = time.Now()
+	m.lock.Unlock()
+
+	if name == "index.mpd" {
+		if !m.waitSegment() {
+			http.Error(w, "stream not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dash+xml")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(m.mpd(time.Now())))
+		return
+	}
+
+	var data []byte
+	m.lock.Lock()
+	var reps []*dashRepresentation
+	for _, period := range m.periods {
+		reps = append(reps, period.reps...)
+	}
+	for _, rep := range append(reps, m.reps...) {
+		if rep.initName == name {
+			data = rep.init
+		}
+		for _, seg := range rep.segments {
+			if seg.name == name {
+				data = seg.data
+			}
+		}
+	}
+	m.lock.Unlock()
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if strings.HasPrefix(name, "dash-video") {
+		w.Header().Set("Content-Type", "video/mp4")
+	} else {
+		w.Header().Set("Content-Type", "audio/mp4")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// mpd 动态的MPD，列出时移缓冲内的各个Period，每路媒体为一个AdaptationSet，使用SegmentTimeline列出已完成的分段
+func (m *dashMuxer) mpd(now time.Time) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	duration := m.options.SegmentDuration
+	maxSegmentDuration := m.maxSegmentDuration
+	if maxSegmentDuration < duration {
+		maxSegmentDuration = duration
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011,urn:mpeg:dash:profile:cmaf:2019" type="dynamic"`)
+	b.WriteString(fmt.Sprintf(` availabilityStartTime="%s" publishTime="%s"`,
+		m.availabilityStart.UTC().Format(dashTimeFormat), now.UTC().Format(dashTimeFormat)))
+	b.WriteString(fmt.Sprintf(` minimumUpdatePeriod="%s" minBufferTime="%s" timeShiftBufferDepth="%s" suggestedPresentationDelay="%s" maxSegmentDuration="%s">`+"\n",
+		dashDuration(duration), dashDuration(duration), dashDuration(duration*time.Duration(m.options.SegmentCount)),
+		dashDuration(3*duration), dashDuration(maxSegmentDuration)))
+	for _, period := range m.periods {
+		m.writePeriod(&b, period.id, period.start, period.reps)
+	}
+	m.writePeriod(&b, m.period, m.periodStart, m.reps)
+	b.WriteString(fmt.Sprintf(`  <UTCTiming schemeIdUri="urn:mpeg:dash:utc:direct:2014" value="%s"/>`+"\n", now.UTC().Format(dashTimeFormat)))
+	b.WriteString("</MPD>\n")
+	return b.String()
+}
+
+// writePeriod 写入一个Period，调用时持有lock
+func (m *dashMuxer) writePeriod(b *strings.Builder, id int, start time.Duration, reps []*dashRepresentation) {
+	b.WriteString(fmt.Sprintf(`  <Period id="%d" start="%s">`+"\n", id, dashDuration(start)))
+	for i, rep := range reps {
+		if len(rep.segments) == 0 {
+			continue
+		}
+		if rep.t == RTP_TYPE_VIDEO {
+			b.WriteString(fmt.Sprintf(`    <AdaptationSet id="%d" contentType="video" mimeType="video/mp4" segmentAlignment="true" startWithSAP="1">`+"\n", i))
+		} else {
+			b.WriteString(fmt.Sprintf(`    <AdaptationSet id="%d" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" startWithSAP="1">`+"\n", i))
+		}
+		media := "dash-$RepresentationID$-$Number$.m4s"
+		if m.options.UseTime {
+			media = "dash-$RepresentationID$-t$Time$.m4s"
+		}
+		b.WriteString(fmt.Sprintf(`      <SegmentTemplate timescale="%d" presentationTimeOffset="%d" initialization="%s" media="%s" startNumber="%d">`+"\n",
+			rep.timeScale, rtpTicks(start, rep.timeScale), rep.initName, media, rep.segments[0].number))
+		b.WriteString("        <SegmentTimeline>\n")
+		for j := 0; j < len(rep.segments); {
+			seg := rep.segments[j]
+			repeat := 0
+			for j+repeat+1 < len(rep.segments) && rep.segments[j+repeat+1].duration == seg.duration {
+				repeat++
+			}
+			if repeat > 0 {
+				b.WriteString(fmt.Sprintf(`          <S t="%d" d="%d" r="%d"/>`+"\n", seg.time, seg.duration, repeat))
+			} else {
+				b.WriteString(fmt.Sprintf(`          <S t="%d" d="%d"/>`+"\n", seg.time, seg.duration))
+			}
+			j += repeat + 1
+		}
+		b.WriteString("        </SegmentTimeline>\n")
+		b.WriteString("      </SegmentTemplate>\n")
+		b.WriteString(fmt.Sprintf(`      <Representation id="%s" codecs="%s" bandwidth="%d"`, rep.id, rep.codecs, rep.bandwidth))
+		if rep.t == RTP_TYPE_VIDEO {
+			if rep.width > 0 && rep.height > 0 {
+				b.WriteString(fmt.Sprintf(` width="%d" height="%d"`, rep.width, rep.height))
+			}
+			b.WriteString("/>\n")
+		} else {
+			b.WriteString(fmt.Sprintf(` audioSamplingRate="%d">`+"\n", rep.timeScale))
+			if rep.channels > 0 {
+				b.WriteString(fmt.Sprintf(`        <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="%d"/>`+"\n", rep.channels))
+			}
+			b.WriteString("      </Representation>\n")
+		}
+		b.WriteString("    </AdaptationSet>\n")
+	}
+	b.WriteString("  </Period>\n")
+}
+
+// dashDuration xs:duration 格式的时长
+func dashDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
@@ -0,0 +1,404 @@
+package rtsp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/fmp4"
+)
+
+// dashQueueSize 封装队列的长度，跟不上时丢包，之后从下一个关键帧恢复
+const dashQueueSize = 1024
+
+// DASHOptions DASH输出参数
+type DASHOptions struct {
+	// SegmentDuration 分段时长，达到后在下一个关键帧处开始新的分段，默认为2秒
+	SegmentDuration time.Duration
+	// SegmentCount 每路媒体保留的分段数，决定 timeShiftBufferDepth，默认为10
+	SegmentCount int
+	// UseTime SegmentTemplate 使用 $Time$ 命名分段，默认使用 $Number$
+	UseTime bool
+	// IdleTimeout 超过该时长没有http请求时关闭封装，默认为30秒
+	IdleTimeout time.Duration
+	// WaitTimeout 请求MPD时等待第一个分段的时长，默认为10秒
+	WaitTimeout time.Duration
+}
+
+// dashMuxer 一路推流的DASH封装，每路媒体为一个CMAF轨道，在第一个http请求时创建，空闲时关闭
+// 源发生变化或编码参数变化时开始新的Period
+type dashMuxer struct {
+	path    string
+	pusher  *Pusher
+	options DASHOptions
+	reader  *FrameReader
+
+	queue       chan *RTPPack
+	done        chan struct{}
+	unsubscribe func()
+
+	// 以下字段由lock保护
+	lock       sync.Mutex
+	cond       *sync.Cond
+	closed     bool
+	lastAccess time.Time
+	// availabilityStart 时间轴0点对应的时间
+	availabilityStart time.Time
+	period            int
+	periodStart       time.Duration
+	reps              []*dashRepresentation
+	// periods 之前的Period，分段移出时移缓冲后删除
+	periods []*dashPeriod
+	// maxSegmentDuration 参考媒体分段的最大时长
+	maxSegmentDuration time.Duration
+
+	// 以下字段只在封装协程中访问
+	started      bool
+	config       string
+	nextPeriod   int
+	numbers      map[RTPType]int
+	segmentStart time.Duration
+}
+
+// dashPeriod 一个已结束的Period
+type dashPeriod struct {
+	id    int
+	start time.Duration
+	reps  []*dashRepresentation
+}
+
+// dashRepresentation 一路媒体，各自为一个AdaptationSet
+type dashRepresentation struct {
+	id        string
+	t         RTPType
+	codecs    string
+	timeScale int
+	width     int
+	height    int
+	channels  int
+	initName  string
+	init      []byte
+
+	// 以下字段由muxer的lock保护
+	segments  []*dashSegment
+	bandwidth int
+
+	// 以下字段只在封装协程中访问
+	buffer   *fmp4.TrackBuffer
+	sequence uint32
+	// cut 参考媒体已在该时间开始新的分段，其余媒体在之后的第一帧处跟随
+	cut    time.Duration
+	hasCut bool
+}
+
+// dashSegment 一路媒体的一个分段，time duration 为该媒体的时钟计数
+type dashSegment struct {
+	number   int
+	time     int64
+	duration int64
+	name     string
+	data     []byte
+}
+
+// newDASHMuxer 创建封装并订阅推流
+func newDASHMuxer(pusher *Pusher, options DASHOptions) *dashMuxer {
+	if options.SegmentDuration <= 0 {
+		options.SegmentDuration = 2 * time.Second
+	}
+	if options.SegmentCount <= 0 {
+		options.SegmentCount = 10
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 30 * time.Second
+	}
+	if options.WaitTimeout <= 0 {
+		options.WaitTimeout = 10 * time.Second
+	}
+	m := &dashMuxer{
+		path:       pusher.Path(),
+		pusher:     pusher,
+		options:    options,
+		reader:     NewPusherFrameReader(pusher),
+		queue:      make(chan *RTPPack, dashQueueSize),
+		done:       make(chan struct{}),
+		lastAccess: time.Now(),
+		numbers:    make(map[RTPType]int),
+	}
+	m.cond = sync.NewCond(&m.lock)
+	go m.run()
+	m.unsubscribe = pusher.Subscribe(m.writeRTP)
+	log.Println(fmt.Sprintf("dash muxer[%s] start", m.path))
+	return m
+}
+
+func (m *dashMuxer) source() *Pusher {
+	return m.pusher
+}
+
+// writeRTP 写入一个包，不阻塞，队列满时丢弃
+func (m *dashMuxer) writeRTP(pack *RTPPack) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.queue <- pack:
+	default:
+	}
+}
+
+// close 取消订阅并结束封装
+func (m *dashMuxer) close() {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.queue)
+	m.cond.Broadcast()
+	m.lock.Unlock()
+	m.unsubscribe()
+	<-m.done
+	log.Println(fmt.Sprintf("dash muxer[%s] closed", m.path))
+}
+
+// idle 超过空闲时长没有请求或已经关闭
+func (m *dashMuxer) idle(now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.closed || now.Sub(m.lastAccess) > m.options.IdleTimeout
+}
+
+func (m *dashMuxer) run() {
+	defer close(m.done)
+	for pack := range m.queue {
+		for _, frame := range m.reader.ReadRTP(pack) {
+			m.writeFrame(frame)
+		}
+	}
+}
+
+// reference 决定分段的媒体，有视频时为视频
+func (m *dashMuxer) reference() RTPType {
+	if m.reader.Codec(RTP_TYPE_VIDEO) != "" {
+		return RTP_TYPE_VIDEO
+	}
+	return RTP_TYPE_AUDIO
+}
+
+// writeFrame 写入一帧，参考媒体的关键帧处开始新的分段，其余媒体在之后的第一帧处跟随
+func (m *dashMuxer) writeFrame(frame *Frame) {
+	isRef := frame.Type == m.reference()
+	if isRef && frame.Keyframe {
+		config := m.reader.trackConfig()
+		if !m.started || frame.Discontinuity || config != m.config {
+			m.closePeriod()
+			if err := m.openPeriod(frame, config); err != nil {
+				log.Println(fmt.Errorf("dash muxer[%s] open period error:%s", m.path, err))
+				return
+			}
+		} else if frame.DTS-m.segmentStart >= m.options.SegmentDuration {
+			for _, rep := range m.reps {
+				if rep.t == frame.Type {
+					m.finishSegment(rep, frame.DTS, false)
+				} else {
+					rep.cut, rep.hasCut = frame.DTS, true
+				}
+			}
+			m.segmentStart = frame.DTS
+		}
+	}
+	if !m.started {
+		return
+	}
+	var rep *dashRepresentation
+	for _, r := range m.reps {
+		if r.t == frame.Type {
+			rep = r
+		}
+	}
+	if rep == nil {
+		return
+	}
+	if rep.hasCut && frame.DTS >= rep.cut {
+		m.finishSegment(rep, frame.DTS, false)
+		rep.hasCut = false
+	}
+
+	dts := rtpTicks(frame.DTS, rep.timeScale)
+	sample := &fmp4.Sample{PTSOffset: int32(rtpTicks(frame.PTS, rep.timeScale) - dts)}
+	if frame.Type == RTP_TYPE_VIDEO {
+		sample.IsNonSyncSample = !frame.Keyframe
+		sample.Payload = codec.JoinAVCC(frame.NALUs)
+	} else {
+		sample.Payload = frame.Data
+	}
+	rep.buffer.Push(dts, sample)
+}
+
+// openPeriod 以参考媒体的关键帧开始新的Period，每路媒体生成单独的初始化段
+func (m *dashMuxer) openPeriod(frame *Frame, config string) error {
+	period := m.nextPeriod
+	var reps []*dashRepresentation
+	for _, t := range m.reader.Tracks() {
+		codec, err := m.reader.FMP4Codec(t)
+		if err != nil {
+			if t == frame.Type {
+				return err
+			}
+			continue
+		}
+		rep := &dashRepresentation{
+			id:        t.String(),
+			t:         t,
+			codecs:    codec.CodecString(),
+			timeScale: m.reader.ClockRate(t),
+			initName:  fmt.Sprintf("dash-%s-init%d.mp4", t.String(), period),
+			buffer:    fmp4.NewTrackBuffer(1),
+		}
+		init := &fmp4.Init{Tracks: []*fmp4.Track{{ID: 1, TimeScale: uint32(rep.timeScale), Codec: codec}}}
+		if rep.init, err = init.Marshal(); err != nil {
+			if t == frame.Type {
+				return err
+			}
+			continue
+		}
+		if t == RTP_TYPE_VIDEO {
+			if params, err := ParseVideoParams(m.reader.Codec(t), m.reader.ParameterSets()); err == nil {
+				rep.width, rep.height = params.Width, params.Height
+			}
+		} else if aacConfig, err := aac.ParseConfig(m.reader.AACConfig()); err == nil {
+			rep.channels = aacConfig.ChannelCount
+		} else if info := m.reader.Info(t); info != nil {
+			rep.channels = info.ChannelCount
+		}
+		reps = append(reps, rep)
+	}
+	m.nextPeriod++
+	m.started, m.config, m.segmentStart = true, config, frame.DTS
+
+	m.lock.Lock()
+	if m.availabilityStart.IsZero() {
+		start := frame.CaptureTime
+		if start.IsZero() {
+			start = time.Now()
+		}
+		m.availabilityStart = start.Add(-frame.DTS)
+	}
+	if m.hasSegments() {
+		m.periods = append(m.periods, &dashPeriod{id: m.period, start: m.periodStart, reps: m.reps})
+	}
+	m.period, m.periodStart, m.reps = period, frame.DTS, reps
+	m.cond.Broadcast()
+	m.lock.Unlock()
+	return nil
+}
+
+// closePeriod 写完当前Period各路媒体剩余的样本，最后一帧的时长沿用上一帧
+func (m *dashMuxer) closePeriod() {
+	if !m.started {
+		return
+	}
+	for _, rep := range m.reps {
+		m.finishSegment(rep, 0, true)
+	}
+	m.started = false
+}
+
+// finishSegment 一路媒体的分段在end处结束，close 为true时最后一帧的时长沿用上一帧
+func (m *dashMuxer) finishSegment(rep *dashRepresentation, end time.Duration, close bool) {
+	if close {
+		rep.buffer.Close()
+	} else {
+		rep.buffer.End(rtpTicks(end, rep.timeScale))
+	}
+	tf := rep.buffer.Fragment()
+	if tf == nil {
+		return
+	}
+	rep.sequence++
+	seg := &dashSegment{
+		number:   m.numbers[rep.t],
+		time:     int64(tf.BaseTime),
+		duration: int64(tf.Duration()),
+		data:     (&fmp4.Fragment{SequenceNumber: rep.sequence, Tracks: []*fmp4.TrackFragment{tf}}).Marshal(),
+	}
+	m.numbers[rep.t]++
+	if m.options.UseTime {
+		seg.name = fmt.Sprintf("dash-%s-t%d.m4s", rep.id, seg.time)
+	} else {
+		seg.name = fmt.Sprintf("dash-%s-%d.m4s", rep.id, seg.number)
+	}
+
+	duration := timestampToDuration(seg.duration, rep.timeScale)
+	isRef := rep.t == m.reference()
+	m.lock.Lock()
+	rep.segments = append(rep.segments, seg)
+	m.trimSegments(rep.t)
+	if duration > 0 {
+		if bps := int(float64(len(seg.data)*8) / duration.Seconds()); bps > rep.bandwidth {
+			rep.bandwidth = bps
+		}
+	}
+	if isRef && duration > m.maxSegmentDuration {
+		m.maxSegmentDuration = duration
+	}
+	m.cond.Broadcast()
+	m.lock.Unlock()
+}
+
+// hasSegments 当前Period是否有分段，调用时持有lock
+func (m *dashMuxer) hasSegments() bool {
+	for _, rep := range m.reps {
+		if len(rep.segments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// trimSegments 一路媒体在各Period中共保留 SegmentCount 个分段，从最早的分段删除，调用时持有lock
+// 之前的Period没有分段后删除
+func (m *dashMuxer) trimSegments(t RTPType) {
+	var reps []*dashRepresentation
+	for _, period := range m.periods {
+		reps = append(reps, period.reps...)
+	}
+	reps = append(reps, m.reps...)
+	count := 0
+	for _, rep := range reps {
+		if rep.t == t {
+			count += len(rep.segments)
+		}
+	}
+	for _, rep := range reps {
+		if count <= m.options.SegmentCount {
+			break
+		}
+		if rep.t != t {
+			continue
+		}
+		n := count - m.options.SegmentCount
+		if n > len(rep.segments) {
+			n = len(rep.segments)
+		}
+		rep.segments = rep.segments[n:]
+		count -= n
+	}
+
+	periods := m.periods[:0]
+	for _, period := range m.periods {
+		for _, rep := range period.reps {
+			if len(rep.segments) > 0 {
+				periods = append(periods, period)
+				break
+			}
+		}
+	}
+	m.periods = periods
+}
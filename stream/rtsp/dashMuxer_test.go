@@ -0,0 +1,214 @@
+package rtsp
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDASHSDP h264视频和48kHz双声道aac音频的sdp
+func testDASHSDP() (string, []byte, []byte) {
+	sdp, sps, pps := testRecorderSDP()
+	sdp += "m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/48000/2\r\n" +
+		"a=fmtp:97 streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1190\r\n" +
+		"a=control:trackID=1\r\n"
+	return sdp, sps, pps
+}
+
+// testAVFrames [start, end) 内按DTS排列的帧，视频25fps每秒一个关键帧，aac每帧1024个采样
+func testAVFrames(start, end time.Duration, sps, pps []byte) []*Frame {
+	var frames []*Frame
+	for f := int(start / (40 * time.Millisecond)); time.Duration(f)*40*time.Millisecond < end; f++ {
+		frame := &Frame{Type: RTP_TYPE_VIDEO, DTS: time.Duration(f) * 40 * time.Millisecond, Keyframe: f%25 == 0}
+		frame.NALUs = [][]byte{testNALU([]byte{0x41, 0x9A}, 100)}
+		if frame.Keyframe {
+			frame.NALUs = [][]byte{sps, pps, testNALU([]byte{0x65, 0x88}, 500)}
+		}
+		frame.PTS = frame.DTS
+		frames = append(frames, frame)
+	}
+	for k := int(rtpTicks(start, 48000)+1023) / 1024; ticksDuration(int64(k)*1024, 48000) < end; k++ {
+		dts := ticksDuration(int64(k)*1024, 48000)
+		frames = append(frames, &Frame{Type: RTP_TYPE_AUDIO, PTS: dts, DTS: dts, Keyframe: true, Data: []byte{0x21, byte(k)}})
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].DTS < frames[j].DTS })
+	return frames
+}
+
+// newTestDASHMuxer 不经过rtp，由测试直接写入帧
+func newTestDASHMuxer(options DASHOptions) (*dashMuxer, []byte, []byte) {
+	sdp, sps, pps := testDASHSDP()
+	return newDASHMuxer(newTestPusher(sdp), options), sps, pps
+}
+
+func TestDASHMuxerMPD(t *testing.T) {
+	m, sps, pps := newTestDASHMuxer(DASHOptions{SegmentDuration: time.Second, WaitTimeout: 100 * time.Millisecond})
+	defer m.close()
+	if w := serveMuxer(m.serve, "/live/cam/index.mpd"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("mpd before segments status %d", w.Code)
+	}
+	for _, frame := range testAVFrames(0, 3*time.Second, sps, pps) {
+		m.writeFrame(frame)
+	}
+
+	mpd := m.mpd(time.Unix(0, 0))
+	for _, s := range []string{
+		`type="dynamic"`,
+		`publishTime="1970-01-01T00:00:00.000Z"`,
+		`minimumUpdatePeriod="PT1.000S" minBufferTime="PT1.000S" timeShiftBufferDepth="PT10.000S" suggestedPresentationDelay="PT3.000S" maxSegmentDuration="PT1.000S"`,
+		`<Period id="0" start="PT0.000S">`,
+		`<AdaptationSet id="0" contentType="video" mimeType="video/mp4" segmentAlignment="true" startWithSAP="1">`,
+		`<SegmentTemplate timescale="90000" presentationTimeOffset="0" initialization="dash-video-init0.mp4" media="dash-$RepresentationID$-$Number$.m4s" startNumber="0">`,
+		// 视频在每个关键帧处切分
+		`<S t="0" d="90000" r="1"/>`,
+		`<Representation id="video" codecs="avc1.42C01F" bandwidth="`,
+		`width="1920" height="1080"/>`,
+		`<SegmentTemplate timescale="48000" presentationTimeOffset="0" initialization="dash-audio-init0.mp4"`,
+		// 音频在视频切分之后的第一帧处跟随，47帧
+		`<S t="0" d="48128" r="1"/>`,
+		`<Representation id="audio" codecs="mp4a.40.2" bandwidth="`,
+		`audioSamplingRate="48000">`,
+		`value="2"/>`,
+		`<UTCTiming schemeIdUri="urn:mpeg:dash:utc:direct:2014" value="1970-01-01T00:00:00.000Z"/>`,
+	} {
+		if !strings.Contains(mpd, s) {
+			t.Errorf("mpd missing %q:\n%s", s, mpd)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		typ    string
+	}{
+		{"index.mpd", http.StatusOK, "application/dash+xml"},
+		{"dash-video-init0.mp4", http.StatusOK, "video/mp4"},
+		{"dash-audio-init0.mp4", http.StatusOK, "audio/mp4"},
+		{"dash-video-1.m4s", http.StatusOK, "video/mp4"},
+		{"dash-audio-0.m4s", http.StatusOK, "audio/mp4"},
+		{"dash-video-2.m4s", http.StatusNotFound, ""},
+		{"dash-video-t0.m4s", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveMuxer(m.serve, "/live/cam/"+tt.name)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.typ != "" && w.Header().Get("Content-Type") != tt.typ {
+				t.Errorf("content type %s", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestDASHMuxerPeriods(t *testing.T) {
+	m, sps, pps := newTestDASHMuxer(DASHOptions{SegmentDuration: time.Second, SegmentCount: 1, UseTime: true})
+	defer m.close()
+	for _, frame := range testAVFrames(0, 3*time.Second, sps, pps) {
+		m.writeFrame(frame)
+	}
+	// 只保留最后一个分段
+	mpd := m.mpd(time.Now())
+	for _, s := range []string{
+		`timeShiftBufferDepth="PT1.000S"`,
+		`media="dash-$RepresentationID$-t$Time$.m4s" startNumber="1"`,
+		`<S t="90000" d="90000"/>`,
+		`<S t="48128" d="48128"/>`,
+	} {
+		if !strings.Contains(mpd, s) {
+			t.Errorf("mpd missing %q:\n%s", s, mpd)
+		}
+	}
+	if w := serveMuxer(m.serve, "/live/cam/dash-video-t90000.m4s"); w.Code != http.StatusOK {
+		t.Errorf("segment by time status %d", w.Code)
+	}
+
+	// 源变化后开始新的Period，时间轴继续
+	frames := testAVFrames(3*time.Second, 5*time.Second, sps, pps)
+	frames[0].Discontinuity = true
+	for _, frame := range frames {
+		m.writeFrame(frame)
+	}
+	mpd = m.mpd(time.Now())
+	for _, s := range []string{
+		`<Period id="1" start="PT3.000S">`,
+		`presentationTimeOffset="270000" initialization="dash-video-init1.mp4"`,
+		`presentationTimeOffset="144000" initialization="dash-audio-init1.mp4"`,
+		`<S t="270000" d="90000"/>`,
+	} {
+		if !strings.Contains(mpd, s) {
+			t.Errorf("mpd missing %q:\n%s", s, mpd)
+		}
+	}
+	if strings.Contains(mpd, "init0") {
+		t.Errorf("previous period in mpd:\n%s", mpd)
+	}
+}
+
+// TestDASHMuxerPreviousPeriods 之前的Period在分段移出时移缓冲前保留在MPD中
+func TestDASHMuxerPreviousPeriods(t *testing.T) {
+	m, sps, pps := newTestDASHMuxer(DASHOptions{SegmentDuration: time.Second, SegmentCount: 3})
+	defer m.close()
+	for _, frame := range testAVFrames(0, 3*time.Second, sps, pps) {
+		m.writeFrame(frame)
+	}
+	frames := testAVFrames(3*time.Second, 5*time.Second, sps, pps)
+	frames[0].Discontinuity = true
+	for _, frame := range frames {
+		m.writeFrame(frame)
+	}
+
+	// 两个Period共保留3个视频分段，最早的分段已移出
+	mpd := m.mpd(time.Now())
+	for _, s := range []string{
+		`<Period id="0" start="PT0.000S">`,
+		`presentationTimeOffset="0" initialization="dash-video-init0.mp4" media="dash-$RepresentationID$-$Number$.m4s" startNumber="1">`,
+		`<S t="90000" d="90000" r="1"/>`,
+		`<Period id="1" start="PT3.000S">`,
+		`initialization="dash-video-init1.mp4" media="dash-$RepresentationID$-$Number$.m4s" startNumber="3">`,
+		`<S t="270000" d="90000"/>`,
+	} {
+		if !strings.Contains(mpd, s) {
+			t.Errorf("mpd missing %q:\n%s", s, mpd)
+		}
+	}
+	if strings.Index(mpd, `<Period id="0"`) > strings.Index(mpd, `<Period id="1"`) {
+		t.Errorf("periods out of order:\n%s", mpd)
+	}
+	for _, name := range []string{"dash-video-init0.mp4", "dash-video-2.m4s", "dash-video-3.m4s"} {
+		if w := serveMuxer(m.serve, "/live/cam/"+name); w.Code != http.StatusOK {
+			t.Errorf("%s status %d", name, w.Code)
+		}
+	}
+
+	// 之前Period的分段全部移出后删除该Period
+	for _, frame := range testAVFrames(5*time.Second, 8*time.Second, sps, pps) {
+		m.writeFrame(frame)
+	}
+	mpd = m.mpd(time.Now())
+	if strings.Contains(mpd, `<Period id="0"`) || !strings.Contains(mpd, `<Period id="1" start="PT3.000S">`) {
+		t.Errorf("mpd after previous period aged out:\n%s", mpd)
+	}
+	if w := serveMuxer(m.serve, "/live/cam/dash-video-init0.mp4"); w.Code != http.StatusNotFound {
+		t.Errorf("removed period init status %d", w.Code)
+	}
+}
+
+func TestDASHDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "PT0.000S"},
+		{1500 * time.Millisecond, "PT1.500S"},
+		{2 * time.Minute, "PT120.000S"},
+	}
+	for _, tt := range tests {
+		if got := dashDuration(tt.d); got != tt.want {
+			t.Errorf("duration %v %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package rtsp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// AccessUnit 解包后的一个完整访问单元（一帧）
+type AccessUnit struct {
+	// rtp时间戳
+	Timestamp uint32
+	// 相对第一个访问单元的展示时间
+	PTS time.Duration
+	// 采集时间和音视频同步的展示时间，由 WallClock.Stamp 填充
+	CaptureTime time.Time
+	SyncPTS     time.Duration
+	// 是否为关键帧
+	Keyframe bool
+	// h264/h265 为不带起始码的NALU列表
+	NALUs [][]byte
+	// 音频帧、jpeg图片、vp8/vp9帧、av1时间单元等非NALU格式的数据
+	Data []byte
+}
+
+// AnnexB 以起始码拼接NALU
+func (au *AccessUnit) AnnexB() []byte {
+	return codec.JoinAnnexB(au.NALUs)
+}
+
+// AVCC 以4字节长度前缀拼接NALU
+func (au *AccessUnit) AVCC() []byte {
+	return codec.JoinAVCC(au.NALUs)
+}
+
+// Depacketizer rtp解包器，将rtp包组装为完整的访问单元
+type Depacketizer interface {
+	// Decode 输入一个rtp包，返回此时已经完整的访问单元，可能为空
+	Decode(rtp *RTPInfo) ([]*AccessUnit, error)
+}
+
+// NewDepacketizer 根据sdp信息创建对应编码的解包器
+func NewDepacketizer(info *SDPInfo) (Depacketizer, error) {
+	if info == nil {
+		return nil, fmt.Errorf("sdp info is nil")
+	}
+	switch strings.ToLower(info.Codec) {
+	case "h264":
+		return NewH264Depacketizer(info), nil
+	case "h265":
+		return NewH265Depacketizer(info), nil
+	case "acc", "aac":
+		return NewAACDepacketizer(info)
+	case "mp4a-latm":
+		return NewLATMDepacketizer(info)
+	case "pcmu", "pcma":
+		return NewG711Depacketizer(info), nil
+	case "g726-16", "g726-24", "g726-32", "g726-40",
+		"aal2-g726-16", "aal2-g726-24", "aal2-g726-32", "aal2-g726-40":
+		return NewG726Depacketizer(info)
+	case "opus":
+		return NewOpusDepacketizer(info), nil
+	case "jpeg":
+		return NewMJPEGDepacketizer(info), nil
+	case "vp8":
+		return NewVP8Depacketizer(info), nil
+	case "vp9":
+		return NewVP9Depacketizer(info), nil
+	case "av1":
+		return NewAV1Depacketizer(info), nil
+	}
+	return nil, fmt.Errorf("unsupported codec[%s] for depacketizer", info.Codec)
+}
+
+// sequenceTracker 检测rtp序号的重复、迟到和丢包
+type sequenceTracker struct {
+	initialized bool
+	last        uint16
+}
+
+// check 返回丢失的包数，ok为false表示重复或迟到的包，应丢弃
+func (t *sequenceTracker) check(seq uint16) (lost int, ok bool) {
+	if t.initialized {
+		diff := seq - t.last
+		if diff == 0 || diff >= 0x8000 {
+			return 0, false
+		}
+		lost = int(diff - 1)
+	}
+	t.initialized = true
+	t.last = seq
+	return lost, true
+}
+
+// timestampExtender 将32位rtp时间戳展开为相对第一个时间戳的64位值，处理回绕
+type timestampExtender struct {
+	initialized bool
+	last        uint32
+	value       int64
+}
+
+func (e *timestampExtender) extend(ts uint32) int64 {
+	if !e.initialized {
+		e.initialized = true
+		e.last = ts
+		return 0
+	}
+	e.value += int64(int32(ts - e.last))
+	e.last = ts
+	return e.value
+}
+
+// timestampToDuration rtp时间戳差值按时钟频率换算为时长
+func timestampToDuration(ts int64, clockRate int) time.Duration {
+	if clockRate <= 0 {
+		return 0
+	}
+	rate := int64(clockRate)
+	return time.Duration(ts/rate)*time.Second + time.Duration(ts%rate)*time.Second/time.Duration(rate)
+}
@@ -0,0 +1,400 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// ulpfecHeaderLength ULPFEC头部和16位掩码的0级保护头部长度
+	ulpfecHeaderLength = 10
+	// ulpfecMaxProtected ULPFEC长掩码最多保护的包数
+	ulpfecMaxProtected = 48
+	// flexfecHeaderLength FlexFEC固定头部长度，不含第一段掩码
+	flexfecHeaderLength = 10
+	// flexfecMaxProtected FlexFEC灵活掩码最多保护的包数
+	flexfecMaxProtected = 109
+	// fecMediaHistory 解码端保留的媒体包数
+	fecMediaHistory = 512
+	// fecPendingLimit 解码端保留的尚未使用的fec包数
+	fecPendingLimit = 64
+)
+
+// fecRecovery 一组被保护的包按位异或的结果
+type fecRecovery struct {
+	// seqs 被保护的包序号
+	seqs []uint16
+	// header rtp头部前两个字节(P/X/CC/M/PT)的异或
+	header    [2]byte
+	timestamp uint32
+	// length 去掉固定头部后长度的异或
+	length  uint16
+	payload []byte
+}
+
+// xor 将一个rtp包异或到恢复数据中
+func (r *fecRecovery) xor(pkt []byte) {
+	r.header[0] ^= pkt[0]
+	r.header[1] ^= pkt[1]
+	r.timestamp ^= binary.BigEndian.Uint32(pkt[4:])
+	r.length ^= uint16(len(pkt) - 12)
+	body := pkt[12:]
+	if len(body) > len(r.payload) {
+		r.payload = append(r.payload, make([]byte, len(body)-len(r.payload))...)
+	}
+	for i := range body {
+		r.payload[i] ^= body[i]
+	}
+}
+
+// protect 计算同一个源的一组包的异或，返回序号基准
+func (r *fecRecovery) protect(packets [][]byte, maxProtected int) (uint16, error) {
+	if len(packets) == 0 {
+		return 0, fmt.Errorf("fec has no packet to protect")
+	}
+	var base uint16
+	for i, pkt := range packets {
+		if len(pkt) < 12 {
+			return 0, fmt.Errorf("fec protected packet too short: %d", len(pkt))
+		}
+		seq := binary.BigEndian.Uint16(pkt[2:])
+		if i == 0 {
+			base = seq
+		}
+		if offset := seq - base; int(offset) >= maxProtected {
+			return 0, fmt.Errorf("fec protected seq %d exceeds base %d by %d", seq, base, offset)
+		}
+		r.seqs = append(r.seqs, seq)
+		r.xor(pkt)
+	}
+	return base, nil
+}
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |E|L|P|X|  CC   |M| PT recovery |            SN base            |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                          TS recovery                          |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |        length recovery        |       Protection Length       |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |             mask              |    mask cont. (present only when L = 1)
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// EncodeULPFEC 生成保护一组包的ULPFEC负载(RFC 5109，只有0级保护)
+// packets 为同一个源的完整rtp包，序号不超过第一个包48
+func EncodeULPFEC(packets [][]byte) ([]byte, error) {
+	r := &fecRecovery{}
+	base, err := r.protect(packets, ulpfecMaxProtected)
+	if err != nil {
+		return nil, err
+	}
+	maskLength := 2
+	for _, seq := range r.seqs {
+		if seq-base >= 16 {
+			maskLength = 6
+		}
+	}
+	b := make([]byte, ulpfecHeaderLength+2+maskLength+len(r.payload))
+	b[0] = r.header[0] & 0x3F
+	if maskLength == 6 {
+		b[0] |= 0x40
+	}
+	b[1] = r.header[1]
+	binary.BigEndian.PutUint16(b[2:], base)
+	binary.BigEndian.PutUint32(b[4:], r.timestamp)
+	binary.BigEndian.PutUint16(b[8:], r.length)
+	binary.BigEndian.PutUint16(b[10:], uint16(len(r.payload)))
+	mask := b[12 : 12+maskLength]
+	for _, seq := range r.seqs {
+		offset := seq - base
+		mask[offset/8] |= 0x80 >> (offset % 8)
+	}
+	copy(b[12+maskLength:], r.payload)
+	return b, nil
+}
+
+// parseULPFEC 解析ULPFEC负载
+func parseULPFEC(b []byte) (*fecRecovery, error) {
+	if len(b) < ulpfecHeaderLength+4 {
+		return nil, fmt.Errorf("ulpfec payload too short: %d", len(b))
+	}
+	if b[0]&0x80 != 0 {
+		return nil, fmt.Errorf("ulpfec extension flag not supported")
+	}
+	maskLength := 2
+	if b[0]&0x40 != 0 {
+		maskLength = 6
+	}
+	if len(b) < ulpfecHeaderLength+2+maskLength {
+		return nil, fmt.Errorf("ulpfec payload too short: %d", len(b))
+	}
+	r := &fecRecovery{
+		header:    [2]byte{b[0] & 0x3F, b[1]},
+		timestamp: binary.BigEndian.Uint32(b[4:]),
+		length:    binary.BigEndian.Uint16(b[8:]),
+	}
+	base := binary.BigEndian.Uint16(b[2:])
+	protectionLength := int(binary.BigEndian.Uint16(b[10:]))
+	mask := b[12 : 12+maskLength]
+	payload := b[12+maskLength:]
+	if len(payload) < protectionLength {
+		return nil, fmt.Errorf("ulpfec protection length %d exceeds payload %d", protectionLength, len(payload))
+	}
+	r.payload = append([]byte(nil), payload[:protectionLength]...)
+	for i := 0; i < maskLength*8; i++ {
+		if mask[i/8]&(0x80>>(i%8)) != 0 {
+			r.seqs = append(r.seqs, base+uint16(i))
+		}
+	}
+	return r, nil
+}
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |0|0|P|X|  CC   |M| PT recovery |        length recovery        |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                          TS recovery                          |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |           SN base             |k|          Mask [0-14]        |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |k|                   Mask [15-45] (optional)                   |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |k|                                                             |
+  +-+                   Mask [46-108] (optional)                  |
+  |                                                               |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// flexfecMaskSegments 灵活掩码每段的位数(不含k位)
+var flexfecMaskSegments = []int{15, 31, 63}
+
+// EncodeFlexFEC 生成保护一组包的FlexFEC负载(RFC 8627，灵活掩码，单个源)
+// packets 为同一个源的完整rtp包，序号不超过第一个包109
+func EncodeFlexFEC(packets [][]byte) ([]byte, error) {
+	r := &fecRecovery{}
+	base, err := r.protect(packets, flexfecMaxProtected)
+	if err != nil {
+		return nil, err
+	}
+	var maxOffset int
+	for _, seq := range r.seqs {
+		if offset := int(seq - base); offset > maxOffset {
+			maxOffset = offset
+		}
+	}
+	// 选择能容纳最大偏移的掩码长度
+	segments, bits, maskLength := 0, 0, 0
+	for bits <= maxOffset {
+		bits += flexfecMaskSegments[segments]
+		maskLength += (flexfecMaskSegments[segments] + 1) / 8
+		segments++
+	}
+	b := make([]byte, flexfecHeaderLength+maskLength+len(r.payload))
+	b[0] = r.header[0] & 0x3F
+	b[1] = r.header[1]
+	binary.BigEndian.PutUint16(b[2:], r.length)
+	binary.BigEndian.PutUint32(b[4:], r.timestamp)
+	binary.BigEndian.PutUint16(b[8:], base)
+	mask := b[flexfecHeaderLength : flexfecHeaderLength+maskLength]
+	for _, seq := range r.seqs {
+		setFlexFECMaskBit(mask, int(seq-base))
+	}
+	// 最后一段的k位为1
+	mask[maskLength-(flexfecMaskSegments[segments-1]+1)/8] |= 0x80
+	copy(b[flexfecHeaderLength+maskLength:], r.payload)
+	return b, nil
+}
+
+// flexfecMaskBitPosition 掩码第i位在整个掩码中的位位置，每段开头是k位
+func flexfecMaskBitPosition(i int) int {
+	pos := 0
+	for _, bits := range flexfecMaskSegments {
+		if i < bits {
+			return pos + 1 + i
+		}
+		i -= bits
+		pos += bits + 1
+	}
+	return -1
+}
+
+func setFlexFECMaskBit(mask []byte, i int) {
+	pos := flexfecMaskBitPosition(i)
+	mask[pos/8] |= 0x80 >> (pos % 8)
+}
+
+// parseFlexFEC 解析FlexFEC负载
+func parseFlexFEC(b []byte) (*fecRecovery, error) {
+	if len(b) < flexfecHeaderLength+2 {
+		return nil, fmt.Errorf("flexfec payload too short: %d", len(b))
+	}
+	if b[0]&0x80 != 0 {
+		return nil, fmt.Errorf("flexfec retransmission not supported")
+	}
+	if b[0]&0x40 != 0 {
+		return nil, fmt.Errorf("flexfec fixed mask not supported")
+	}
+	r := &fecRecovery{
+		header:    [2]byte{b[0] & 0x3F, b[1]},
+		length:    binary.BigEndian.Uint16(b[2:]),
+		timestamp: binary.BigEndian.Uint32(b[4:]),
+	}
+	base := binary.BigEndian.Uint16(b[8:])
+	mask := b[flexfecHeaderLength:]
+	maskLength, bits := 0, 0
+	for _, segment := range flexfecMaskSegments {
+		size := (segment + 1) / 8
+		if len(mask) < maskLength+size {
+			return nil, fmt.Errorf("flexfec mask truncated")
+		}
+		maskLength += size
+		bits += segment
+		if mask[maskLength-size]&0x80 != 0 {
+			break
+		}
+	}
+	for i := 0; i < bits; i++ {
+		pos := flexfecMaskBitPosition(i)
+		if mask[pos/8]&(0x80>>(pos%8)) != 0 {
+			r.seqs = append(r.seqs, base+uint16(i))
+		}
+	}
+	r.payload = append([]byte(nil), mask[maskLength:]...)
+	return r, nil
+}
+
+// FECDecoder 由前向纠错包恢复同一个源中丢失的rtp包
+type FECDecoder struct {
+	parse func([]byte) (*fecRecovery, error)
+	ssrc  uint32
+	// media 最近收到的媒体包，order为收到的顺序，用于淘汰
+	media   map[uint16][]byte
+	order   []uint16
+	pending []*fecRecovery
+}
+
+// NewFECDecoder codec 为sdp中的编码名称，ulpfec或flexfec(RFC 8627)，flexfec-03 草案的头部格式不同，不支持
+func NewFECDecoder(codec string) (*FECDecoder, error) {
+	d := &FECDecoder{media: make(map[uint16][]byte)}
+	switch strings.ToLower(codec) {
+	case "ulpfec":
+		d.parse = parseULPFEC
+	case "flexfec":
+		d.parse = parseFlexFEC
+	default:
+		return nil, fmt.Errorf("fec codec %s not supported", codec)
+	}
+	return d, nil
+}
+
+// Media 记录收到的媒体包，返回因此可以恢复的包
+func (d *FECDecoder) Media(pkt []byte) [][]byte {
+	if len(pkt) < 12 {
+		return nil
+	}
+	ssrc := binary.BigEndian.Uint32(pkt[8:])
+	if ssrc != d.ssrc && len(d.order) == 0 {
+		// 第一个媒体包，保留之前收到的fec包
+		d.ssrc = ssrc
+	} else if ssrc != d.ssrc {
+		// 源变化后之前的包不再有用
+		d.ssrc = ssrc
+		d.media = make(map[uint16][]byte)
+		d.order = nil
+		d.pending = nil
+	}
+	d.store(binary.BigEndian.Uint16(pkt[2:]), pkt)
+	return d.recover()
+}
+
+// FEC 处理一个fec包的负载，返回可以恢复的包
+func (d *FECDecoder) FEC(payload []byte) ([][]byte, error) {
+	r, err := d.parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	d.pending = append(d.pending, r)
+	if len(d.pending) > fecPendingLimit {
+		d.pending = d.pending[len(d.pending)-fecPendingLimit:]
+	}
+	return d.recover(), nil
+}
+
+func (d *FECDecoder) store(seq uint16, pkt []byte) {
+	if _, ok := d.media[seq]; ok {
+		return
+	}
+	d.media[seq] = pkt
+	d.order = append(d.order, seq)
+	if len(d.order) > fecMediaHistory {
+		delete(d.media, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+// recover 恢复只缺一个包的保护组，恢复的包可能使其它组也只缺一个包
+func (d *FECDecoder) recover() [][]byte {
+	if len(d.media) == 0 {
+		return nil
+	}
+	var recovered [][]byte
+	for found := true; found; {
+		found = false
+		pending := d.pending[:0]
+		for _, r := range d.pending {
+			missing, count := uint16(0), 0
+			for _, seq := range r.seqs {
+				if _, ok := d.media[seq]; !ok {
+					missing = seq
+					count++
+				}
+			}
+			switch count {
+			case 0:
+				continue
+			case 1:
+				if pkt := d.rebuild(r, missing); pkt != nil {
+					d.store(missing, pkt)
+					recovered = append(recovered, pkt)
+					found = true
+				}
+				continue
+			}
+			pending = append(pending, r)
+		}
+		d.pending = pending
+	}
+	return recovered
+}
+
+// rebuild 异或保护组中其余的包得到丢失的包
+func (d *FECDecoder) rebuild(r *fecRecovery, seq uint16) []byte {
+	x := &fecRecovery{header: r.header, timestamp: r.timestamp, length: r.length}
+	x.payload = append([]byte(nil), r.payload...)
+	for _, s := range r.seqs {
+		if s != seq {
+			x.xor(d.media[s])
+		}
+	}
+	length := int(x.length)
+	if length > len(x.payload) {
+		return nil
+	}
+	pkt := make([]byte, 12+length)
+	pkt[0] = 0x80 | x.header[0]&0x3F
+	pkt[1] = x.header[1]
+	binary.BigEndian.PutUint16(pkt[2:], seq)
+	binary.BigEndian.PutUint32(pkt[4:], x.timestamp)
+	binary.BigEndian.PutUint32(pkt[8:], d.ssrc)
+	copy(pkt[12:], x.payload[:length])
+	return pkt
+}
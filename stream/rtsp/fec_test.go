@@ -0,0 +1,157 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testFECPackets 构造同一个源的一组rtp包，负载长度和marker各不相同
+func testFECPackets(t *testing.T, base uint16, seqs []uint16) [][]byte {
+	t.Helper()
+	packets := make([][]byte, 0, len(seqs))
+	for i, offset := range seqs {
+		payload := make([]byte, 20+i*7)
+		for j := range payload {
+			payload[j] = byte(i*31 + j)
+		}
+		b, err := NewRTPPacket(96, base+offset, 3000*uint32(i), 0xABCD, i%3 == 2, payload).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, b)
+	}
+	return packets
+}
+
+// offsets 生成0..n-1的序号偏移
+func offsets(n int) []uint16 {
+	seqs := make([]uint16, n)
+	for i := range seqs {
+		seqs[i] = uint16(i)
+	}
+	return seqs
+}
+
+func TestFECRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		codec    string
+		base     uint16
+		seqs     []uint16
+		drop     int
+		fecFirst bool
+	}{
+		{"ulpfec short mask", "ulpfec", 100, offsets(5), 2, false},
+		{"ulpfec first packet", "ulpfec", 100, offsets(5), 0, false},
+		{"ulpfec long mask", "ulpfec", 100, []uint16{0, 7, 20, 47}, 2, false},
+		{"ulpfec wrap", "ulpfec", 65530, offsets(10), 6, false},
+		{"ulpfec fec first", "ulpfec", 100, offsets(4), 3, true},
+		{"flexfec one segment", "flexfec", 100, offsets(5), 4, false},
+		{"flexfec two segments", "flexfec", 100, []uint16{0, 14, 15, 40}, 2, false},
+		{"flexfec three segments", "flexfec", 65500, []uint16{0, 30, 46, 108}, 3, false},
+		{"flexfec fec first", "flexfec", 100, offsets(8), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets := testFECPackets(t, tt.base, tt.seqs)
+			encode := EncodeULPFEC
+			if tt.codec == "flexfec" {
+				encode = EncodeFlexFEC
+			}
+			fec, err := encode(packets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := NewFECDecoder(tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recovered [][]byte
+			if tt.fecFirst {
+				if recovered, err = d.FEC(fec); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, pkt := range packets {
+				if i != tt.drop {
+					recovered = append(recovered, d.Media(pkt)...)
+				}
+			}
+			if !tt.fecFirst {
+				out, err := d.FEC(fec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recovered = append(recovered, out...)
+			}
+			if len(recovered) != 1 || !bytes.Equal(recovered[0], packets[tt.drop]) {
+				t.Fatalf("recovered %x, want %x", recovered, packets[tt.drop])
+			}
+			// 丢失的包已恢复，再收到时不重复恢复
+			if out := d.Media(packets[tt.drop]); len(out) != 0 {
+				t.Errorf("recovered again %d", len(out))
+			}
+		})
+	}
+}
+
+func TestFECChainedRecovery(t *testing.T) {
+	// 第二组缺两个包，第一组恢复其中一个后第二组也可以恢复
+	packets := testFECPackets(t, 0, offsets(6))
+	first, _ := EncodeULPFEC(packets[:3])
+	second, _ := EncodeULPFEC(packets[2:])
+	d, _ := NewFECDecoder("ulpfec")
+	for _, i := range []int{0, 1, 4, 5} {
+		d.Media(packets[i])
+	}
+	if out, _ := d.FEC(second); len(out) != 0 {
+		t.Fatalf("recovered with two packets missing")
+	}
+	out, err := d.FEC(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || !bytes.Equal(out[0], packets[2]) || !bytes.Equal(out[1], packets[3]) {
+		t.Errorf("chained recovery %d packets", len(out))
+	}
+}
+
+func TestFECErrors(t *testing.T) {
+	if _, err := NewFECDecoder("flexfec-03"); err == nil {
+		t.Errorf("flexfec-03 accepted")
+	}
+	if _, err := NewFECDecoder("red"); err == nil {
+		t.Errorf("red accepted")
+	}
+	if _, err := EncodeULPFEC(nil); err == nil {
+		t.Errorf("empty group accepted")
+	}
+	if _, err := EncodeULPFEC(testFECPackets(t, 0, []uint16{0, 48})); err == nil {
+		t.Errorf("ulpfec offset 48 accepted")
+	}
+	if _, err := EncodeFlexFEC(testFECPackets(t, 0, []uint16{0, 109})); err == nil {
+		t.Errorf("flexfec offset 109 accepted")
+	}
+	d, _ := NewFECDecoder("ulpfec")
+	if _, err := d.FEC([]byte{0x80, 0, 0, 0}); err == nil {
+		t.Errorf("short ulpfec accepted")
+	}
+	d, _ = NewFECDecoder("flexfec")
+	if _, err := d.FEC([]byte{0x40, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Errorf("flexfec fixed mask accepted")
+	}
+}
+
+func TestFECSourceChange(t *testing.T) {
+	packets := testFECPackets(t, 0, offsets(3))
+	fec, _ := EncodeULPFEC(packets)
+	d, _ := NewFECDecoder("ulpfec")
+	d.Media(packets[0])
+	d.FEC(fec)
+	// 新的源丢弃之前的包和fec
+	other, _ := NewRTPPacket(96, 1, 0, 0x1234, false, []byte{1}).Marshal()
+	d.Media(other)
+	if out := d.Media(packets[1]); len(out) != 0 {
+		t.Errorf("recovered across source change")
+	}
+}
@@ -0,0 +1,347 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+)
+
+// FilterContext 过滤器处理的媒体信息
+type FilterContext struct {
+	// Type 媒体类型，RTP_TYPE_AUDIO/RTP_TYPE_VIDEO
+	Type RTPType
+	// Info 推流端sdp中该媒体的信息，可能为nil
+	Info *SDPInfo
+}
+
+// Codec 小写的编码名称，没有sdp信息时为空
+func (ctx *FilterContext) Codec() string {
+	if ctx.Info == nil {
+		return ""
+	}
+	return strings.ToLower(ctx.Info.Codec)
+}
+
+// Keyframe rtp包是否为视频关键帧的开始
+func (ctx *FilterContext) Keyframe(pkt *RTPPacket) bool {
+	if ctx.Type != RTP_TYPE_VIDEO {
+		return false
+	}
+	return rtpKeyframe(ctx.Codec(), ctx.Info != nil && ctx.Info.MaxDonDiff > 0, pkt.Payload)
+}
+
+// Filter rtp包过滤器，可挂在推流端、播放端或某一路媒体上
+type Filter interface {
+	// FilterPacket 处理解析后的rtp包，可直接修改包的内容，返回false时丢弃该包
+	FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool
+}
+
+// FrameFilter 处理解包后的帧的过滤器
+// 过滤链中有帧过滤器的媒体，rtp包经过所有 FilterPacket 后组装为帧，依次经过 FilterFrame 后重新打包，
+// 重新打包后保留SSRC和时间戳，序号连续，rtp头部扩展不保留
+type FrameFilter interface {
+	Filter
+	// FilterFrame 处理一个访问单元，可直接修改帧的内容，返回false时丢弃该帧
+	FilterFrame(ctx *FilterContext, au *AccessUnit) bool
+}
+
+// SDPAttributeFilter 需要改写下发sdp的过滤器，如媒体的加解密
+type SDPAttributeFilter interface {
+	Filter
+	// SDPAttributes 该媒体在下发的sdp中的属性，key为属性名称，值为空时去掉推流端sdp中的该属性
+	SDPAttributes(ctx *FilterContext) map[string]string
+}
+
+// FilterFunc 以函数实现的rtp包过滤器
+type FilterFunc func(ctx *FilterContext, pkt *RTPPacket) bool
+
+// FilterPacket 调用函数本身
+func (f FilterFunc) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	return f(ctx, pkt)
+}
+
+// trackFilter 过滤器及其作用的媒体，allTracks为true时作用于所有媒体
+type trackFilter struct {
+	allTracks bool
+	t         RTPType
+	filter    Filter
+}
+
+// FilterChain 按添加顺序执行的过滤链，rtcp包不经过过滤器
+// 丢弃的包不占用序号，输出的序号保持连续
+type FilterChain struct {
+	lock    sync.Mutex
+	filters []trackFilter
+	tracks  map[RTPType]*filterTrack
+}
+
+// filterTrack 一路媒体的过滤状态
+type filterTrack struct {
+	// dropped 已丢弃的包数，用于修正后续包的序号
+	dropped uint16
+	frames  *frameStage
+}
+
+// NewFilterChain 创建过滤链
+func NewFilterChain() *FilterChain {
+	return &FilterChain{tracks: make(map[RTPType]*filterTrack)}
+}
+
+// Add 添加作用于所有媒体的过滤器
+func (c *FilterChain) Add(filter Filter) *FilterChain {
+	c.lock.Lock()
+	c.filters = append(c.filters, trackFilter{allTracks: true, filter: filter})
+	c.lock.Unlock()
+	return c
+}
+
+// AddTrack 添加只作用于指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的过滤器
+func (c *FilterChain) AddTrack(t RTPType, filter Filter) *FilterChain {
+	c.lock.Lock()
+	c.filters = append(c.filters, trackFilter{t: t, filter: filter})
+	c.lock.Unlock()
+	return c
+}
+
+// Len 过滤器数量
+func (c *FilterChain) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.filters)
+}
+
+// sdpAttributes 各媒体的过滤器声明的sdp属性，合并到attrs中，key为媒体类型(audio/video)
+func (c *FilterChain) sdpAttributes(attrs map[string]map[string]string, info func(string) *SDPInfo) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, f := range c.filters {
+		filter, ok := f.filter.(SDPAttributeFilter)
+		if !ok {
+			continue
+		}
+		for _, t := range []RTPType{RTP_TYPE_AUDIO, RTP_TYPE_VIDEO} {
+			if !f.allTracks && f.t != t {
+				continue
+			}
+			ctx := &FilterContext{Type: t, Info: info(t.String())}
+			if ctx.Info == nil {
+				continue
+			}
+			for name, val := range filter.SDPAttributes(ctx) {
+				if attrs[t.String()] == nil {
+					attrs[t.String()] = make(map[string]string)
+				}
+				attrs[t.String()][name] = val
+			}
+		}
+	}
+}
+
+// process 处理一个包，返回需要继续发送的包，不修改输入的包
+// info 返回媒体类型(audio/video)对应的sdp信息
+func (c *FilterChain) process(pack *RTPPack, info func(string) *SDPInfo) []*RTPPack {
+	if c == nil || isRTCP(pack.Type) {
+		return []*RTPPack{pack}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var packetFilters []Filter
+	var frameFilters []FrameFilter
+	for _, f := range c.filters {
+		if !f.allTracks && f.t != pack.Type {
+			continue
+		}
+		packetFilters = append(packetFilters, f.filter)
+		if frameFilter, ok := f.filter.(FrameFilter); ok {
+			frameFilters = append(frameFilters, frameFilter)
+		}
+	}
+	if len(packetFilters) == 0 {
+		return []*RTPPack{pack}
+	}
+
+	pkt := &RTPPacket{}
+	if err := pkt.Unmarshal(append([]byte(nil), pack.Buffer.Bytes()...)); err != nil {
+		return []*RTPPack{pack}
+	}
+	track := c.tracks[pack.Type]
+	if track == nil {
+		track = &filterTrack{}
+		c.tracks[pack.Type] = track
+	}
+	ctx := &FilterContext{Type: pack.Type}
+	if info != nil {
+		ctx.Info = info(pack.Type.String())
+	}
+	for _, filter := range packetFilters {
+		if !filter.FilterPacket(ctx, pkt) {
+			track.dropped++
+			return nil
+		}
+	}
+	pkt.SequenceNumber -= track.dropped
+
+	if len(frameFilters) > 0 {
+		if track.frames == nil || track.frames.info != ctx.Info {
+			frames, err := newFrameStage(ctx.Info)
+			if err != nil {
+				log.Println(fmt.Errorf("%v frame filter disabled: %s", pack.Type, err))
+			}
+			track.frames = frames
+		}
+		if track.frames.enabled() {
+			return track.frames.process(ctx, pkt, frameFilters, pack.CaptureTime)
+		}
+	}
+
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return []*RTPPack{pack}
+	}
+	return []*RTPPack{{Type: pack.Type, Buffer: bytes.NewBuffer(buf), CaptureTime: pack.CaptureTime}}
+}
+
+// frameStage 帧过滤器的解包和重新打包，编码不支持重新打包时不处理帧
+type frameStage struct {
+	info         *SDPInfo
+	depacketizer Depacketizer
+	packetizer   Packetizer
+	payloadType  int
+	ssrc         uint32
+}
+
+func newFrameStage(info *SDPInfo) (*frameStage, error) {
+	stage := &frameStage{info: info}
+	if info == nil {
+		return stage, fmt.Errorf("sdp info is nil")
+	}
+	depacketizer, err := NewDepacketizer(info)
+	if err != nil {
+		return stage, err
+	}
+	if _, err := newSDPPacketizer(info, PacketizerOptions{}); err != nil {
+		return stage, err
+	}
+	stage.depacketizer = depacketizer
+	stage.payloadType = info.PayloadType
+	return stage, nil
+}
+
+func (s *frameStage) enabled() bool {
+	return s != nil && s.depacketizer != nil
+}
+
+// process 输入一个rtp包，返回由此完整的帧经过帧过滤器后重新打包的rtp包
+func (s *frameStage) process(ctx *FilterContext, pkt *RTPPacket, filters []FrameFilter, captureTime time.Time) []*RTPPack {
+	if s.packetizer == nil || pkt.SSRC != s.ssrc {
+		// 沿用源的SSRC和序号，时间戳由 au.Timestamp 直接换算
+		seq, ts := pkt.SequenceNumber, uint32(0)
+		packetizer, err := newSDPPacketizer(s.info, PacketizerOptions{
+			PayloadType:           s.payloadType,
+			SSRC:                  pkt.SSRC,
+			InitialSequenceNumber: &seq,
+			InitialTimestamp:      &ts,
+		})
+		if err != nil {
+			return nil
+		}
+		s.packetizer, s.ssrc = packetizer, pkt.SSRC
+	}
+	buf, err := pkt.Marshal()
+	if err != nil {
+		return nil
+	}
+	rtp := ParseRTP(buf)
+	if rtp == nil {
+		return nil
+	}
+	aus, err := s.depacketizer.Decode(rtp)
+	if err != nil {
+		return nil
+	}
+	var packs []*RTPPack
+	for _, au := range aus {
+		keep := true
+		for _, filter := range filters {
+			if keep = filter.FilterFrame(ctx, au); !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		out := *au
+		out.PTS = rtpTimestampDuration(au.Timestamp, s.info.TimeScale)
+		frame, err := s.packetizer.Packetize(&out)
+		if err != nil {
+			continue
+		}
+		for _, pack := range frame {
+			pack.CaptureTime = captureTime
+		}
+		packs = append(packs, frame...)
+	}
+	return packs
+}
+
+// rtpTimestampDuration 时间戳换算为时长，向上取整使 rtpTicks 换算回原时间戳
+func rtpTimestampDuration(ts uint32, clockRate int) time.Duration {
+	return ticksDuration(int64(ts), clockRate)
+}
+
+// newSDPPacketizer 根据sdp信息创建与源格式一致的打包器，不一致时返回错误
+func newSDPPacketizer(info *SDPInfo, options PacketizerOptions) (Packetizer, error) {
+	options.ClockRate = info.TimeScale
+	switch codec := strings.ToLower(info.Codec); codec {
+	case "h264":
+		return NewH264Packetizer(options), nil
+	case "h265":
+		if info.MaxDonDiff > 0 {
+			return nil, fmt.Errorf("h265 packetizer not support donl")
+		}
+		return NewH265Packetizer(options), nil
+	case "vp8":
+		return NewVP8Packetizer(options), nil
+	case "vp9":
+		return NewVP9Packetizer(options), nil
+	case "av1":
+		return NewAV1Packetizer(options), nil
+	case "pcmu", "pcma":
+		return NewG711Packetizer(codec == "pcmu", options), nil
+	case "opus":
+		return NewOpusPacketizer(options), nil
+	case "acc", "aac":
+		// 打包器固定为AAC-hbr的AU-header格式
+		if info.SizeLength != 13 || info.IndexLength != 3 || info.IndexDeltaLength != 3 ||
+			info.CTSDeltaLength > 0 || info.DTSDeltaLength > 0 || info.RandomAccessIndication ||
+			info.StreamStateIndication > 0 || info.AuxiliaryDataSizeLength > 0 {
+			return nil, fmt.Errorf("aac au-header not AAC-hbr")
+		}
+		config, err := aac.ParseConfig(info.Config)
+		if err != nil {
+			return nil, err
+		}
+		return NewAACPacketizer(config, options), nil
+	case "mp4a-latm":
+		if info.CPresent {
+			return nil, fmt.Errorf("latm packetizer not support cpresent=1")
+		}
+		muxConfig, err := aac.ParseStreamMuxConfig(info.Config)
+		if err != nil {
+			return nil, err
+		}
+		return NewLATMPacketizer(muxConfig.Config, options), nil
+	}
+	return nil, fmt.Errorf("unsupported codec[%s] for packetizer", info.Codec)
+}
@@ -0,0 +1,131 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// seiFrameFilter 去掉帧中的SEI，只有SEI的帧整帧丢弃
+type seiFrameFilter struct{}
+
+func (seiFrameFilter) FilterPacket(*FilterContext, *RTPPacket) bool {
+	return true
+}
+
+func (seiFrameFilter) FilterFrame(_ *FilterContext, au *AccessUnit) bool {
+	var nalus [][]byte
+	for _, nalu := range au.NALUs {
+		if nalu[0]&0x1F != 6 {
+			nalus = append(nalus, nalu)
+		}
+	}
+	au.NALUs = nalus
+	return len(nalus) > 0
+}
+
+func TestFilterChainSequence(t *testing.T) {
+	h264 := &SDPInfo{Codec: "H264", PayloadType: 96, TimeScale: 90000}
+	info := func(avType string) *SDPInfo {
+		if avType == "video" {
+			return h264
+		}
+		return nil
+	}
+	chain := NewFilterChain().
+		Add(&DropFilter{Match: func(_ *FilterContext, pkt *RTPPacket) bool { return pkt.Payload[0] == 0x06 }}).
+		AddTrack(RTP_TYPE_AUDIO, &DropFilter{})
+	if chain.Len() != 2 {
+		t.Errorf("len %d", chain.Len())
+	}
+	tests := []struct {
+		name    string
+		typ     RTPType
+		seq     uint16
+		payload byte
+		out     int
+		outSeq  uint16
+	}{
+		{"first", RTP_TYPE_VIDEO, 10, 0x41, 1, 10},
+		{"dropped", RTP_TYPE_VIDEO, 11, 0x06, 0, 0},
+		{"after drop", RTP_TYPE_VIDEO, 12, 0x41, 1, 11},
+		{"dropped again", RTP_TYPE_VIDEO, 13, 0x06, 0, 0},
+		{"after second drop", RTP_TYPE_VIDEO, 14, 0x65, 1, 12},
+		{"audio dropped by track filter", RTP_TYPE_AUDIO, 100, 0x41, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := NewRTPPacket(96, tt.seq, 3000, 1, false, []byte{tt.payload, 0x01}).Marshal()
+			pack := &RTPPack{Type: tt.typ, Buffer: bytes.NewBuffer(append([]byte(nil), b...))}
+			out := chain.process(pack, info)
+			if len(out) != tt.out {
+				t.Fatalf("out %d, want %d", len(out), tt.out)
+			}
+			if !bytes.Equal(pack.Buffer.Bytes(), b) {
+				t.Errorf("input pack modified")
+			}
+			if tt.out == 1 {
+				if seq, _, _ := rtpHeader(out[0]); seq != tt.outSeq {
+					t.Errorf("seq %d, want %d", seq, tt.outSeq)
+				}
+			}
+		})
+	}
+
+	control := testSRPack(t, RTP_TYPE_VIDEOCONTROL, 1, time.Unix(1000, 0), 0)
+	if out := chain.process(control, info); len(out) != 1 || out[0] != control {
+		t.Errorf("rtcp filtered")
+	}
+	var empty *FilterChain
+	if empty.Len() != 0 || len(empty.process(control, info)) != 1 {
+		t.Errorf("nil chain")
+	}
+}
+
+func TestFilterChainFrames(t *testing.T) {
+	h264 := &SDPInfo{Codec: "H264", PayloadType: 96, TimeScale: 90000}
+	info := func(string) *SDPInfo { return h264 }
+	chain := NewFilterChain().AddTrack(RTP_TYPE_VIDEO, seiFrameFilter{})
+
+	sei := []byte{0x06, 0x05, 0x01, 0x80}
+	idr := testNALU([]byte{0x65, 0x88}, 2500)
+	slice := testNALU([]byte{0x41, 0x9A}, 300)
+	var zero uint32
+	seq := uint16(500)
+	p := NewH264Packetizer(PacketizerOptions{SSRC: 0x4444, MTU: 1200, InitialSequenceNumber: &seq, InitialTimestamp: &zero})
+	var in []*RTPPack
+	for i, nalus := range [][][]byte{{sei, idr}, {sei}, {slice}} {
+		packs, err := p.Packetize(&AccessUnit{PTS: time.Duration(i) * 40 * time.Millisecond, NALUs: nalus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = append(in, packs...)
+	}
+	var out []*RTPPack
+	for _, pack := range in {
+		out = append(out, chain.process(pack, info)...)
+	}
+	// 帧在收到marker时输出，只有SEI的帧丢弃，序号从源的序号开始连续
+	packets := parsePacks(t, out)
+	for i, pkt := range packets {
+		if pkt.SequenceNumber != 500+i || pkt.SSRC != 0x4444 {
+			t.Errorf("packet %d seq %d ssrc %x", i, pkt.SequenceNumber, pkt.SSRC)
+		}
+	}
+	d, _ := NewDepacketizer(h264)
+	aus := decodeAll(t, d, packets)
+	if len(aus) != 2 {
+		t.Fatalf("aus %d, want 2", len(aus))
+	}
+	for i, want := range []struct {
+		ts    uint32
+		nalus [][]byte
+	}{
+		{0, [][]byte{idr}},
+		{7200, [][]byte{slice}},
+	} {
+		if aus[i].Timestamp != want.ts || !equalNALUs(aus[i].NALUs, want.nalus) {
+			t.Errorf("au %d ts %d nalus %d", i, aus[i].Timestamp, len(aus[i].NALUs))
+		}
+	}
+}
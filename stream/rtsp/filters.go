@@ -0,0 +1,198 @@
+package rtsp
+
+import "encoding/binary"
+
+// PayloadFilter 以自定义函数变换rtp负载，用于负载的加密和解密
+type PayloadFilter struct {
+	// Transform 变换负载，seq为rtp序号，返回变换后的负载
+	Transform func(payload []byte, seq uint16) []byte
+	// Skip 负载开头不变换的字节数，如h264的FU indicator和FU header
+	Skip int
+	// KeyframeOnly 是否只处理视频关键帧开始的包
+	KeyframeOnly bool
+	// Codecs 只处理这些小写编码的包，为空时不限制
+	Codecs []string
+}
+
+// NewPayloadEncryptFilter 加密h264关键帧开始的包中前两个字节之后的负载，其余编码不处理
+func NewPayloadEncryptFilter(encrypt func(payload []byte, seq uint16) []byte) *PayloadFilter {
+	return &PayloadFilter{Transform: encrypt, Skip: 2, KeyframeOnly: true, Codecs: []string{"h264"}}
+}
+
+// NewPayloadDecryptFilter 解密 NewPayloadEncryptFilter 加密的负载
+func NewPayloadDecryptFilter(decrypt func(payload []byte) []byte) *PayloadFilter {
+	return &PayloadFilter{
+		Transform: func(payload []byte, _ uint16) []byte {
+			return decrypt(payload)
+		},
+		Skip:         2,
+		KeyframeOnly: true,
+		Codecs:       []string{"h264"},
+	}
+}
+
+// FilterPacket 变换负载，负载不足Skip时不处理
+func (f *PayloadFilter) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	if f.Transform == nil || len(pkt.Payload) <= f.Skip {
+		return true
+	}
+	if len(f.Codecs) > 0 && !f.codecMatched(ctx.Codec()) {
+		return true
+	}
+	if f.KeyframeOnly && !ctx.Keyframe(pkt) {
+		return true
+	}
+	payload := f.Transform(pkt.Payload[f.Skip:], pkt.SequenceNumber)
+	pkt.Payload = append(pkt.Payload[:f.Skip:f.Skip], payload...)
+	return true
+}
+
+// codecMatched 编码是否在 Codecs 中
+func (f *PayloadFilter) codecMatched(codec string) bool {
+	for _, c := range f.Codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// NALUStripFilter 去掉h264/h265中指定类型的NALU
+// 单一NALU包和分片包整包丢弃，聚合包中去掉对应的NALU，
+// 去掉的NALU带有帧结束标记时负载换成填充数据NALU，解码器忽略填充数据，播放端仍能收到marker
+type NALUStripFilter struct {
+	H264Types []uint8
+	H265Types []uint8
+}
+
+// NewSEIAUDStripFilter 去掉SEI和AUD，h265只去掉前缀SEI
+func NewSEIAUDStripFilter() *NALUStripFilter {
+	return &NALUStripFilter{
+		H264Types: []uint8{6, 9},
+		H265Types: []uint8{35, 39},
+	}
+}
+
+// FilterPacket 去掉指定类型的NALU
+func (f *NALUStripFilter) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	if ctx.Type != RTP_TYPE_VIDEO || len(pkt.Payload) < 2 {
+		return true
+	}
+	switch ctx.Codec() {
+	case "h264":
+		return f.filterH264(pkt)
+	case "h265":
+		if len(pkt.Payload) < 3 {
+			return true
+		}
+		return f.filterH265(pkt, ctx.Info != nil && ctx.Info.MaxDonDiff > 0)
+	}
+	return true
+}
+
+func (f *NALUStripFilter) filterH264(pkt *RTPPacket) bool {
+	switch t := pkt.Payload[0] & 0x1F; {
+	case t >= 1 && t <= 23:
+		return !containsType(f.H264Types, t) || endAccessUnit(pkt, h264FillerData())
+	case t == 24: // STAP-A
+		nalus := h264AggregatedNALUs(pkt.Payload)
+		kept := make([]byte, 1, len(pkt.Payload))
+		kept[0] = pkt.Payload[0]
+		for _, nalu := range nalus {
+			if !containsType(f.H264Types, nalu[0]&0x1F) {
+				kept = appendSizedNALU(kept, nalu)
+			}
+		}
+		return f.aggregated(pkt, kept, 1, h264FillerData())
+	case t == 28 || t == 29: // FU-A/FU-B
+		// 开始和中间分片丢弃，结束分片带marker时换成填充数据，不会转发没有开始分片的结束分片
+		return !containsType(f.H264Types, pkt.Payload[1]&0x1F) || endAccessUnit(pkt, h264FillerData())
+	}
+	return true
+}
+
+func (f *NALUStripFilter) filterH265(pkt *RTPPacket, donl bool) bool {
+	switch t := (pkt.Payload[0] >> 1) & 0x3F; {
+	case t < 48:
+		return !containsType(f.H265Types, t) || endAccessUnit(pkt, h265FillerData(pkt.Payload))
+	case t == 48: // AP
+		if donl {
+			// 去掉NALU后需要重新计算DOND，不处理
+			return true
+		}
+		kept := make([]byte, 2, len(pkt.Payload))
+		copy(kept, pkt.Payload[:2])
+		for _, nalu := range h265AggregatedNALUs(pkt.Payload, false) {
+			if !containsType(f.H265Types, (nalu[0]>>1)&0x3F) {
+				kept = appendSizedNALU(kept, nalu)
+			}
+		}
+		return f.aggregated(pkt, kept, 2, h265FillerData(pkt.Payload))
+	case t == 49: // FU
+		return !containsType(f.H265Types, pkt.Payload[2]&0x3F) || endAccessUnit(pkt, h265FillerData(pkt.Payload))
+	}
+	return true
+}
+
+// aggregated 使用去掉NALU后的聚合包，没有剩余NALU时丢弃
+func (f *NALUStripFilter) aggregated(pkt *RTPPacket, kept []byte, headerLength int, filler []byte) bool {
+	if len(kept) == headerLength {
+		return endAccessUnit(pkt, filler)
+	}
+	pkt.Payload = kept
+	return true
+}
+
+// endAccessUnit 去掉整个包的内容，带marker时负载换成填充数据NALU后转发，否则丢弃
+func endAccessUnit(pkt *RTPPacket, filler []byte) bool {
+	if !pkt.Marker {
+		return false
+	}
+	pkt.Payload = filler
+	return true
+}
+
+// h264FillerData h264的填充数据NALU，只有rbsp_trailing_bits
+func h264FillerData() []byte {
+	return []byte{12, 0x80}
+}
+
+// h265FillerData h265的FD_NUT，layer id和tid与原包相同
+func h265FillerData(payload []byte) []byte {
+	return []byte{38<<1 | payload[0]&0x01, payload[1], 0x80}
+}
+
+// appendSizedNALU 以2字节长度前缀追加NALU
+func appendSizedNALU(b []byte, nalu []byte) []byte {
+	var size [2]byte
+	binary.BigEndian.PutUint16(size[:], uint16(len(nalu)))
+	return append(append(b, size[:]...), nalu...)
+}
+
+func containsType(types []uint8, t uint8) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// DropFilter 按条件丢弃rtp包，条件都为空时丢弃所有包
+type DropFilter struct {
+	// PayloadTypes 丢弃的负载类型
+	PayloadTypes []uint8
+	// Match 返回true时丢弃
+	Match func(ctx *FilterContext, pkt *RTPPacket) bool
+}
+
+// FilterPacket 满足任一条件时丢弃
+func (f *DropFilter) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	if len(f.PayloadTypes) == 0 && f.Match == nil {
+		return false
+	}
+	if containsType(f.PayloadTypes, pkt.PayloadType) {
+		return false
+	}
+	return f.Match == nil || !f.Match(ctx, pkt)
+}
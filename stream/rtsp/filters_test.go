@@ -0,0 +1,177 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// xorTransform 以固定字节异或负载，加密和解密相同
+func xorTransform(payload []byte, _ uint16) []byte {
+	out := make([]byte, len(payload))
+	for i := range payload {
+		out[i] = payload[i] ^ 0x5A
+	}
+	return out
+}
+
+func TestPayloadEncryptFilter(t *testing.T) {
+	h264 := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H264"}}
+	h265 := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H265"}}
+	audio := &FilterContext{Type: RTP_TYPE_AUDIO, Info: &SDPInfo{Codec: "PCMA"}}
+	tests := []struct {
+		name      string
+		ctx       *FilterContext
+		payload   []byte
+		encrypted bool
+	}{
+		{"h264 idr", h264, []byte{0x65, 0x88, 0x01, 0x02, 0x03}, true},
+		{"h264 idr fu-a start", h264, []byte{0x7C, 0x85, 0x01, 0x02, 0x03}, true},
+		{"h264 idr fu-a middle", h264, []byte{0x7C, 0x05, 0x01, 0x02, 0x03}, false},
+		{"h264 non-idr", h264, []byte{0x41, 0x9A, 0x01, 0x02, 0x03}, false},
+		{"h264 too short", h264, []byte{0x65, 0x88}, false},
+		// 兼容的加密过滤器只处理h264，h265的关键帧原样通过
+		{"h265 idr", h265, []byte{0x26, 0x01, 0xAF, 0x01, 0x02}, false},
+		{"h265 idr fu start", h265, []byte{0x62, 0x01, 0x93, 0x01, 0x02}, false},
+		{"audio", audio, []byte{0xD5, 0xD5, 0xD5, 0xD5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := NewRTPPacket(96, 1, 0, 1, false, append([]byte(nil), tt.payload...))
+			if !NewPayloadEncryptFilter(xorTransform).FilterPacket(tt.ctx, pkt) {
+				t.Fatal("packet dropped")
+			}
+			if encrypted := !bytes.Equal(pkt.Payload, tt.payload); encrypted != tt.encrypted {
+				t.Fatalf("encrypted %v, payload %x", encrypted, pkt.Payload)
+			}
+			if tt.encrypted && !bytes.Equal(pkt.Payload[:2], tt.payload[:2]) {
+				t.Errorf("payload header encrypted %x", pkt.Payload[:2])
+			}
+			decrypt := NewPayloadDecryptFilter(func(payload []byte) []byte { return xorTransform(payload, 0) })
+			decrypt.FilterPacket(tt.ctx, pkt)
+			if !bytes.Equal(pkt.Payload, tt.payload) {
+				t.Errorf("decrypted %x, want %x", pkt.Payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestNALUStripFilter(t *testing.T) {
+	h264 := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H264"}}
+	h265 := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H265"}}
+	h265DONL := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H265", MaxDonDiff: 2}}
+	tests := []struct {
+		name    string
+		ctx     *FilterContext
+		marker  bool
+		payload []byte
+		keep    bool
+		want    []byte
+	}{
+		{"h264 sei", h264, false, []byte{0x06, 0x05, 0x01}, false, nil},
+		{"h264 aud", h264, false, []byte{0x09, 0xF0}, false, nil},
+		// 去掉的NALU结束访问单元时换成填充数据以保留marker
+		{"h264 sei with marker", h264, true, []byte{0x06, 0x05, 0x01}, true, []byte{0x0C, 0x80}},
+		{"h264 sps", h264, false, []byte{0x67, 0x42}, true, []byte{0x67, 0x42}},
+		{"h264 stap-a", h264, false, []byte{0x18, 0x00, 0x02, 0x09, 0xF0, 0x00, 0x02, 0x67, 0x42, 0x00, 0x03, 0x06, 0x05, 0x01},
+			true, []byte{0x18, 0x00, 0x02, 0x67, 0x42}},
+		{"h264 stap-a only sei", h264, false, []byte{0x18, 0x00, 0x02, 0x09, 0xF0, 0x00, 0x03, 0x06, 0x05, 0x01}, false, nil},
+		{"h264 stap-a only sei with marker", h264, true, []byte{0x18, 0x00, 0x02, 0x09, 0xF0, 0x00, 0x03, 0x06, 0x05, 0x01},
+			true, []byte{0x0C, 0x80}},
+		{"h264 fu-a sei", h264, false, []byte{0x7C, 0x86, 0x01}, false, nil},
+		{"h264 fu-a sei end with marker", h264, true, []byte{0x7C, 0x46, 0x01}, true, []byte{0x0C, 0x80}},
+		{"h264 fu-a idr", h264, false, []byte{0x7C, 0x85, 0x01}, true, []byte{0x7C, 0x85, 0x01}},
+		{"h265 prefix sei", h265, false, []byte{0x4E, 0x01, 0x05}, false, nil},
+		{"h265 aud", h265, false, []byte{0x46, 0x01, 0x50}, false, nil},
+		{"h265 suffix sei", h265, false, []byte{0x50, 0x01, 0x05}, true, []byte{0x50, 0x01, 0x05}},
+		{"h265 ap", h265, false, []byte{0x60, 0x01, 0x00, 0x03, 0x4E, 0x01, 0x05, 0x00, 0x03, 0x40, 0x01, 0x0C},
+			true, []byte{0x60, 0x01, 0x00, 0x03, 0x40, 0x01, 0x0C}},
+		{"h265 ap with donl", h265DONL, false, []byte{0x60, 0x01, 0x00, 0x00, 0x00, 0x03, 0x4E, 0x01, 0x05},
+			true, []byte{0x60, 0x01, 0x00, 0x00, 0x00, 0x03, 0x4E, 0x01, 0x05}},
+		{"h265 fu sei", h265, false, []byte{0x62, 0x01, 0xA7, 0x01}, false, nil},
+		{"h265 fu sei end with marker", h265, true, []byte{0x62, 0x01, 0x67, 0x01}, true, []byte{0x4C, 0x01, 0x80}},
+		{"h265 prefix sei with marker", h265, true, []byte{0x4E, 0x01, 0x05}, true, []byte{0x4C, 0x01, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := NewRTPPacket(96, 1, 0, 1, tt.marker, append([]byte(nil), tt.payload...))
+			if keep := NewSEIAUDStripFilter().FilterPacket(tt.ctx, pkt); keep != tt.keep {
+				t.Fatalf("keep %v, want %v", keep, tt.keep)
+			}
+			if tt.keep && !bytes.Equal(pkt.Payload, tt.want) {
+				t.Errorf("payload %x, want %x", pkt.Payload, tt.want)
+			}
+		})
+	}
+}
+
+// TestNALUStripFilterAccessUnitEnd 去掉访问单元末尾分片的SEI后，帧仍以marker结束且不含SEI
+func TestNALUStripFilterAccessUnitEnd(t *testing.T) {
+	h264 := &SDPInfo{Codec: "H264", PayloadType: 96, TimeScale: 90000}
+	info := func(avType string) *SDPInfo {
+		if avType == "video" {
+			return h264
+		}
+		return nil
+	}
+	chain := NewFilterChain().Add(NewSEIAUDStripFilter())
+	var zero uint32
+	packetizer := NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 1200, InitialTimestamp: &zero})
+	depacketizer := NewH264Depacketizer(h264)
+	// 解包从关键帧开始输出
+	idr := testNALU([]byte{0x65, 0x88}, 100)
+	var aus []*AccessUnit
+	for i := 0; i < 2; i++ {
+		// SEI超过MTU，以FU-A分片发送，结束分片带marker
+		packs, err := packetizer.Packetize(&AccessUnit{PTS: time.Duration(i) * 40 * time.Millisecond,
+			NALUs: [][]byte{idr, testNALU([]byte{0x06, 0x05}, 3000)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range packs {
+			pack.Type = RTP_TYPE_VIDEO
+			for _, out := range chain.process(pack, info) {
+				got, err := depacketizer.Decode(ParseRTP(out.Buffer.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				aus = append(aus, got...)
+			}
+		}
+		// 第一帧由marker结束，不需要等到下一帧的时间戳变化
+		if len(aus) != i+1 {
+			t.Fatalf("frame %d: access units %d", i, len(aus))
+		}
+	}
+	for _, au := range aus {
+		if len(au.NALUs) != 2 || !bytes.Equal(au.NALUs[0], idr) || !bytes.Equal(au.NALUs[1], h264FillerData()) {
+			t.Errorf("nalus %x", au.NALUs)
+		}
+	}
+}
+
+func TestDropFilter(t *testing.T) {
+	ctx := &FilterContext{Type: RTP_TYPE_VIDEO, Info: &SDPInfo{Codec: "H264"}}
+	tests := []struct {
+		name   string
+		filter *DropFilter
+		pt     uint8
+		keep   bool
+	}{
+		{"drop all", &DropFilter{}, 96, false},
+		{"payload type", &DropFilter{PayloadTypes: []uint8{97}}, 97, false},
+		{"other payload type", &DropFilter{PayloadTypes: []uint8{97}}, 96, true},
+		{"match", &DropFilter{Match: func(_ *FilterContext, pkt *RTPPacket) bool { return pkt.PayloadType == 96 }}, 96, false},
+		{"not match", &DropFilter{Match: func(_ *FilterContext, pkt *RTPPacket) bool { return pkt.PayloadType == 96 }}, 98, true},
+		// 丢弃非关键帧时保留STAP-A中的IDR
+		{"keyframe in stap-a", &DropFilter{Match: func(ctx *FilterContext, pkt *RTPPacket) bool { return !ctx.Keyframe(pkt) }}, 96, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := testSTAPA([]byte{0x67, 0x42}, []byte{0x68, 0xce}, []byte{0x65, 0x88})
+			if keep := tt.filter.FilterPacket(ctx, NewRTPPacket(tt.pt, 1, 0, 1, false, payload)); keep != tt.keep {
+				t.Errorf("keep %v, want %v", keep, tt.keep)
+			}
+		})
+	}
+}
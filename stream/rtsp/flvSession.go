@@ -0,0 +1,268 @@
+package rtsp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/flv"
+	"github.com/mrHChen/goutils/stream/fmp4"
+)
+
+// flvQueueSize 每个客户端的队列长度，跟不上时丢包，之后从下一个关键帧恢复
+const flvQueueSize = 1024
+
+// flvHEVCCodecID Enhanced RTMP中onMetaData的videocodecid为FourCC hvc1的数值
+const flvHEVCCodecID = 0x68766331
+
+// flvSession 一个HTTP-FLV或WebSocket-FLV客户端，订阅推流后从GOP缓存中的关键帧开始输出
+// 视频支持h264和h265(Enhanced RTMP)，音频支持aac，其余媒体忽略
+type flvSession struct {
+	path   string
+	pusher *Pusher
+	reader *FrameReader
+	// write 写入一段完整的tag，返回错误时结束输出
+	write func([]byte) error
+
+	queue  chan *RTPPack
+	lock   sync.Mutex
+	closed bool
+	// dropped 有包被丢弃，下一个入队的包之前放入nil
+	dropped bool
+
+	// 以下字段只在输出协程中访问
+	started bool
+	config  string
+	// video audio 文件头中声明的媒体，audioReady 已写入aac序列头
+	video      bool
+	audio      bool
+	audioReady bool
+	hevc       bool
+	reason     string
+	lastTime   uint32
+	// waitKeyframe 丢包后等待下一个视频关键帧
+	waitKeyframe bool
+}
+
+// flvTracks 推流中可以用flv输出的视频和音频
+func flvTracks(reader *FrameReader) (video, audio bool) {
+	switch reader.Codec(RTP_TYPE_VIDEO) {
+	case "h264", "h265":
+		video = true
+	}
+	switch reader.Codec(RTP_TYPE_AUDIO) {
+	case "aac", "mp4a-latm":
+		audio = true
+	}
+	return
+}
+
+// newFLVSession 创建客户端的输出，run 之后开始订阅
+func newFLVSession(pusher *Pusher, write func([]byte) error) *flvSession {
+	return &flvSession{
+		path:   pusher.Path(),
+		pusher: pusher,
+		reader: NewPusherFrameReader(pusher),
+		write:  write,
+		queue:  make(chan *RTPPack, flvQueueSize),
+	}
+}
+
+// writeRTP 写入一个包，不阻塞，队列满时丢弃，之后入队的第一个包之前放入nil通知输出协程
+func (s *flvSession) writeRTP(pack *RTPPack) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	if s.dropped {
+		select {
+		case s.queue <- nil:
+			s.dropped = false
+		default:
+			return
+		}
+	}
+	select {
+	case s.queue <- pack:
+	default:
+		s.dropped = true
+	}
+}
+
+// run 订阅推流并输出，直到写入失败、done 或 closed 关闭、推流结束
+func (s *flvSession) run(done, closed <-chan struct{}) error {
+	unsubscribe := s.pusher.Subscribe(s.writeRTP)
+	defer func() {
+		s.lock.Lock()
+		s.closed = true
+		s.lock.Unlock()
+		unsubscribe()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-closed:
+			return nil
+		case <-ticker.C:
+			if s.pusher.Stopped() {
+				return nil
+			}
+		case pack := <-s.queue:
+			if err := s.read(pack); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// read 解包并输出一个包，pack 为nil时之前有包被丢弃，重置解包并从下一个视频关键帧恢复输出
+func (s *flvSession) read(pack *RTPPack) error {
+	if pack == nil {
+		s.reader.drop()
+		s.waitKeyframe = s.video
+		return nil
+	}
+	for _, frame := range s.reader.ReadRTP(pack) {
+		if err := s.writeFrame(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFrame 写入一帧，第一帧前写入文件头、onMetaData和序列头，参数变化时在关键帧前重写序列头
+func (s *flvSession) writeFrame(frame *Frame) error {
+	video, _ := flvTracks(s.reader)
+	var b []byte
+	if frame.Keyframe && (frame.Type == RTP_TYPE_VIDEO) == video {
+		config := s.reader.trackConfig()
+		if !s.started || config != s.config {
+			header, err := s.header(frame.DTS, !s.started)
+			if err != nil {
+				// 参数集或aac配置尚未收到，等待下一个关键帧
+				if err.Error() != s.reason {
+					log.Println(fmt.Errorf("flv session[%s] wait for keyframe:%s", s.path, err))
+					s.reason = err.Error()
+				}
+				return nil
+			}
+			b = header
+			s.started, s.config = true, config
+		}
+	}
+	if !s.started || frame.Type == RTP_TYPE_VIDEO && !s.video || frame.Type == RTP_TYPE_AUDIO && !s.audioReady {
+		return nil
+	}
+	if s.waitKeyframe {
+		if frame.Type != RTP_TYPE_VIDEO || !frame.Keyframe {
+			return nil
+		}
+		s.waitKeyframe = false
+	}
+
+	timestamp := s.timestamp(frame.DTS)
+	if frame.Type == RTP_TYPE_VIDEO {
+		cts := int32(frame.PTS/time.Millisecond) - int32(frame.DTS/time.Millisecond)
+		data := flv.VideoFrame(s.videoCodec(), frame.Keyframe, cts, codec.JoinAVCC(frame.NALUs))
+		b = append(b, flv.Tag(flv.TagTypeVideo, timestamp, data)...)
+	} else {
+		b = append(b, flv.Tag(flv.TagTypeAudio, timestamp, flv.AudioFrame(frame.Data))...)
+	}
+	return s.write(b)
+}
+
+// timestamp 毫秒时间戳，各路媒体交错时保证不回退
+func (s *flvSession) timestamp(dts time.Duration) uint32 {
+	timestamp := uint32(dts / time.Millisecond)
+	if timestamp < s.lastTime {
+		timestamp = s.lastTime
+	}
+	s.lastTime = timestamp
+	return timestamp
+}
+
+func (s *flvSession) videoCodec() flv.VideoCodec {
+	if s.hevc {
+		return flv.VideoCodecH265
+	}
+	return flv.VideoCodecH264
+}
+
+// header 序列头，first 为true时前面加上文件头和onMetaData
+func (s *flvSession) header(dts time.Duration, first bool) ([]byte, error) {
+	video, audio := flvTracks(s.reader)
+	if !video && !audio {
+		return nil, fmt.Errorf("no media supported by flv")
+	}
+	if !first {
+		// 文件头中的媒体不能再变化
+		video, audio = video && s.video, audio && s.audio
+	}
+
+	var videoConfig, audioConfig []byte
+	var properties []flv.Property
+	if video {
+		c, err := s.reader.FMP4Codec(RTP_TYPE_VIDEO)
+		if err != nil {
+			return nil, err
+		}
+		var codecID float64 = 7
+		switch c := c.(type) {
+		case *fmp4.CodecH264:
+			videoConfig, err = c.DecoderConfig()
+		case *fmp4.CodecH265:
+			videoConfig, err = c.DecoderConfig()
+			codecID = flvHEVCCodecID
+		}
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, flv.Property{Name: "videocodecid", Value: codecID})
+		if params, err := ParseVideoParams(s.reader.Codec(RTP_TYPE_VIDEO), s.reader.ParameterSets()); err == nil {
+			properties = append(properties,
+				flv.Property{Name: "width", Value: float64(params.Width)},
+				flv.Property{Name: "height", Value: float64(params.Height)})
+		}
+	}
+	if audio {
+		audioConfig = s.reader.AACConfig()
+		config, err := aac.ParseConfig(audioConfig)
+		if err != nil && !video {
+			return nil, fmt.Errorf("aac config not received")
+		}
+		// 有视频时不等待aac的配置，收到后在之后的关键帧前写入序列头
+		s.audioReady = err == nil
+		if err == nil {
+			properties = append(properties,
+				flv.Property{Name: "audiocodecid", Value: float64(10)},
+				flv.Property{Name: "audiosamplerate", Value: float64(config.SampleRate)},
+				flv.Property{Name: "audiochannels", Value: float64(config.ChannelCount)},
+				flv.Property{Name: "stereo", Value: config.ChannelCount > 1})
+		}
+	}
+
+	var b []byte
+	s.hevc = s.reader.Codec(RTP_TYPE_VIDEO) == "h265"
+	timestamp := s.timestamp(dts)
+	if first {
+		s.video, s.audio = video, audio
+		b = append(b, flv.Header(video, audio)...)
+		b = append(b, flv.Tag(flv.TagTypeScript, 0, flv.MetaData(properties))...)
+		log.Println(fmt.Sprintf("flv session[%s] start video:%v audio:%v", s.path, video, audio))
+	}
+	if video {
+		b = append(b, flv.Tag(flv.TagTypeVideo, timestamp, flv.VideoSequenceHeader(s.videoCodec(), videoConfig))...)
+	}
+	if s.audioReady {
+		b = append(b, flv.Tag(flv.TagTypeAudio, timestamp, flv.AudioSequenceHeader(audioConfig))...)
+	}
+	return b, nil
+}
@@ -0,0 +1,162 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/flv"
+)
+
+// testFLVTag 解析后的flv tag
+type testFLVTag struct {
+	typ       uint8
+	timestamp uint32
+	data      []byte
+}
+
+// parseFLVTags 解析文件头之后的tag，检查PreviousTagSize
+func parseFLVTags(t *testing.T, b []byte) []testFLVTag {
+	t.Helper()
+	var tags []testFLVTag
+	for len(b) > 0 {
+		if len(b) < 15 {
+			t.Fatalf("short tag %x", b)
+		}
+		size := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+		timestamp := uint32(b[7])<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+		if prev := binary.BigEndian.Uint32(b[11+size:]); prev != uint32(11+size) {
+			t.Fatalf("previous tag size %d, want %d", prev, 11+size)
+		}
+		tags = append(tags, testFLVTag{b[0], timestamp, b[11 : 11+size]})
+		b = b[15+size:]
+	}
+	return tags
+}
+
+func TestFLVSession(t *testing.T) {
+	sdp, sps, pps := testDASHSDP()
+	var out bytes.Buffer
+	s := newFLVSession(newTestPusher(sdp), func(b []byte) error {
+		out.Write(b)
+		return nil
+	})
+	// 关键帧之前的帧丢弃
+	frames := testAVFrames(960*time.Millisecond, 1100*time.Millisecond, sps, pps)
+	for _, frame := range frames {
+		if err := s.writeFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := out.Bytes()
+	if !bytes.Equal(b[:13], flv.Header(true, true)) {
+		t.Fatalf("header %x", b[:13])
+	}
+	tags := parseFLVTags(t, b[13:])
+	tests := []struct {
+		name      string
+		typ       uint8
+		timestamp uint32
+		prefix    []byte
+	}{
+		{"metadata", flv.TagTypeScript, 0, []byte{0x02, 0x00, 0x0A, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a'}},
+		{"video sequence header", flv.TagTypeVideo, 1000, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x42, 0xC0, 0x1F}},
+		{"audio sequence header", flv.TagTypeAudio, 1000, []byte{0xAF, 0x00, 0x11, 0x90}},
+		{"keyframe", flv.TagTypeVideo, 1000, []byte{0x17, 0x01, 0x00, 0x00, 0x00}},
+		// 1000ms 之后的第一帧音频
+		{"audio", flv.TagTypeAudio, 1002, []byte{0xAF, 0x01, 0x21, 47}},
+		{"audio", flv.TagTypeAudio, 1024, []byte{0xAF, 0x01, 0x21, 48}},
+		{"inter frame", flv.TagTypeVideo, 1040, []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+	}
+	if len(tags) < len(tests) {
+		t.Fatalf("tags %d, want at least %d", len(tags), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := tags[i]
+			if tag.typ != tt.typ || tag.timestamp != tt.timestamp || !bytes.HasPrefix(tag.data, tt.prefix) {
+				t.Errorf("tag type %d timestamp %d data %x", tag.typ, tag.timestamp, tag.data[:len(tt.prefix)])
+			}
+		})
+	}
+	for i := 1; i < len(tags); i++ {
+		if tags[i].timestamp < tags[i-1].timestamp {
+			t.Errorf("timestamp %d after %d", tags[i].timestamp, tags[i-1].timestamp)
+		}
+	}
+	// 宽高来自SPS
+	for _, name := range []string{"width", "height", "audiosamplerate", "stereo"} {
+		if !bytes.Contains(tags[0].data, []byte(name)) {
+			t.Errorf("metadata missing %s", name)
+		}
+	}
+}
+
+func TestFLVSessionUnsupported(t *testing.T) {
+	sdp := testAudioSDP("m=audio 0 RTP/AVP 8", "a=rtpmap:8 PCMA/8000")
+	s := newFLVSession(newTestPusher(sdp), func([]byte) error {
+		t.Errorf("unexpected write")
+		return nil
+	})
+	if video, audio := flvTracks(s.reader); video || audio {
+		t.Errorf("tracks %v %v", video, audio)
+	}
+	if err := s.writeFrame(&Frame{Type: RTP_TYPE_AUDIO, Keyframe: true, Data: []byte{0xD5}}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestFLVSessionDrop 队列满丢包后重置解包，到下一个视频关键帧之前音视频都不输出
+func TestFLVSessionDrop(t *testing.T) {
+	sdp, sps, pps := testDASHSDP()
+	var out bytes.Buffer
+	s := newFLVSession(newTestPusher(sdp), func(b []byte) error {
+		out.Write(b)
+		return nil
+	})
+	s.queue = make(chan *RTPPack, 2)
+	for i := 0; i < 3; i++ {
+		s.writeRTP(&RTPPack{Type: RTP_TYPE_VIDEO})
+	}
+	// 队列有空位后先放入nil
+	<-s.queue
+	<-s.queue
+	last := &RTPPack{Type: RTP_TYPE_VIDEO}
+	s.writeRTP(last)
+	if pack := <-s.queue; pack != nil {
+		t.Fatalf("first pack after drop %v", pack)
+	}
+	if pack := <-s.queue; pack != last {
+		t.Fatalf("pack after drop marker %v", pack)
+	}
+
+	for _, frame := range testAVFrames(0, 500*time.Millisecond, sps, pps) {
+		if err := s.writeFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.read(nil); err != nil {
+		t.Fatal(err)
+	}
+	if track := s.reader.tracks[RTP_TYPE_VIDEO]; track == nil || !track.needKeyframe {
+		t.Errorf("video depacketizer not reset")
+	}
+	size := out.Len()
+	for _, frame := range testAVFrames(500*time.Millisecond, 1100*time.Millisecond, sps, pps) {
+		if err := s.writeFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags := parseFLVTags(t, out.Bytes()[size:])
+	if len(tags) == 0 {
+		t.Fatal("no tags after drop")
+	}
+	if tag := tags[0]; tag.typ != flv.TagTypeVideo || tag.timestamp != 1000 || tag.data[0] != 0x17 {
+		t.Errorf("first tag after drop type %d timestamp %d data %x", tag.typ, tag.timestamp, tag.data[:2])
+	}
+	if s.waitKeyframe {
+		t.Errorf("still waiting for keyframe")
+	}
+}
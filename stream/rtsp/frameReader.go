@@ -0,0 +1,498 @@
+package rtsp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/codec/h264"
+	"github.com/mrHChen/goutils/stream/codec/h265"
+	"github.com/mrHChen/goutils/stream/fmp4"
+)
+
+// frameReaderMaxJump 时间戳跳变超过该时长时视为源发生变化
+const frameReaderMaxJump = 10 * time.Second
+
+// frameReaderDefaultReorder SPS中没有给出重排序帧数时按B帧金字塔计算，DTS偏早不影响解码
+const frameReaderDefaultReorder = 2
+
+// Frame 解包后的一帧，各路媒体的PTS和DTS共用同一时间轴
+type Frame struct {
+	Type RTPType
+	// PTS DTS 由各路媒体的rtp时钟换算，rtpTicks 按时钟频率换算回的值是准确的，DTS单调递增
+	PTS time.Duration
+	DTS time.Duration
+	// CaptureTime 采集时间
+	CaptureTime time.Time
+	Keyframe    bool
+	// h264/h265 为不带起始码的NALU列表
+	NALUs [][]byte
+	// 音频帧
+	Data []byte
+	// Discontinuity 源发生变化(sdp、SSRC变化或时间戳跳变)后的第一帧，时间轴保持连续
+	Discontinuity bool
+}
+
+// FrameReader 将rtp包解包为h264/h265/aac/opus的帧，供录制、HLS等输出使用
+// 有视频时从视频关键帧开始输出，视频丢包后丢弃到下一个关键帧，各路媒体按同步PTS对齐
+// 不支持并发调用
+type FrameReader struct {
+	sdp       func() string
+	sdpRaw    string
+	wallClock *WallClock
+	tracks    map[RTPType]*frameTrack
+
+	// started 时间轴已经确定起点，origin 为起点处的同步PTS，anchor 为起点在时间轴上的位置
+	started bool
+	origin  time.Duration
+	anchor  time.Duration
+	// 已输出的最大DTS和参考媒体的帧间隔，源变化后时间轴从其后继续
+	lastDTS       time.Duration
+	frameDuration time.Duration
+	discontinuity bool
+}
+
+// frameTrack 一路媒体的解包状态
+type frameTrack struct {
+	t            RTPType
+	info         *SDPInfo
+	codec        string
+	clockRate    int
+	depacketizer Depacketizer
+	seq          sequenceTracker
+	ssrc         int
+	hasSSRC      bool
+	ts           timestampExtender
+	// 带内获取的视频参数集
+	paramSets    map[int][]byte
+	needKeyframe bool
+
+	// 时间轴上的位置，均以时钟计数表示，base 为 offset 对应的展开后的时间戳
+	started bool
+	base    int64
+	offset  int64
+	lastDTS int64
+	// 视频的重排序帧数和尚未用作DTS的PTS(升序)
+	reorder int
+	pending []int64
+}
+
+// NewFrameReader sdp 返回当前的sdp，sdp变化时重新创建解包器
+func NewFrameReader(sdp func() string) *FrameReader {
+	return &FrameReader{sdp: sdp}
+}
+
+// NewPusherFrameReader 读取推流经过过滤链后的帧
+func NewPusherFrameReader(pusher *Pusher) *FrameReader {
+	return NewFrameReader(pusher.SDPRaw)
+}
+
+// ReadRTP 输入一个rtp或rtcp包，返回此时完整的帧
+func (r *FrameReader) ReadRTP(pack *RTPPack) []*Frame {
+	r.update()
+	if isRTCP(pack.Type) {
+		r.wallClock.OnRTCP(pack)
+		return nil
+	}
+	track := r.tracks[pack.Type]
+	if track == nil {
+		return nil
+	}
+	rtp := ParseRTP(pack.Buffer.Bytes())
+	if rtp == nil {
+		return nil
+	}
+	r.wallClock.OnRTP(pack, time.Now())
+	if pack.Discontinuity {
+		r.restart(fmt.Sprintf("%v source reconnected", track.t))
+		track.seq = sequenceTracker{}
+		track.depacketizer, _ = NewDepacketizer(track.info)
+	} else if track.hasSSRC && track.ssrc != rtp.SSRC {
+		r.restart(fmt.Sprintf("%v ssrc changed", track.t))
+		track.seq = sequenceTracker{}
+		track.depacketizer, _ = NewDepacketizer(track.info)
+	}
+	track.ssrc, track.hasSSRC = rtp.SSRC, true
+
+	lost, ok := track.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil
+	}
+	if lost > 0 && track.t == RTP_TYPE_VIDEO {
+		track.needKeyframe = true
+	}
+	aus, err := track.depacketizer.Decode(rtp)
+	if err != nil {
+		return nil
+	}
+	var frames []*Frame
+	for _, au := range aus {
+		r.wallClock.Stamp(track.t, au)
+		if frame := r.frame(track, au); frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// drop 调用方丢弃了输入的包，各路媒体重新开始解包，视频丢弃到下一个关键帧，时间轴不变
+func (r *FrameReader) drop() {
+	for _, track := range r.tracks {
+		track.seq = sequenceTracker{}
+		track.depacketizer, _ = NewDepacketizer(track.info)
+		if track.t == RTP_TYPE_VIDEO {
+			track.needKeyframe = true
+		}
+	}
+}
+
+// update sdp变化时按新的sdp重新创建各路媒体，时间轴从已输出的帧之后继续
+func (r *FrameReader) update() {
+	raw := r.sdp()
+	if raw == r.sdpRaw && r.tracks != nil {
+		return
+	}
+	if r.tracks != nil {
+		r.restart("sdp changed")
+	}
+	r.sdpRaw = raw
+	infos := ParseSDP(raw)
+	r.wallClock = NewWallClock(sdpClockRates(infos))
+	r.tracks = make(map[RTPType]*frameTrack)
+	for _, t := range []RTPType{RTP_TYPE_VIDEO, RTP_TYPE_AUDIO} {
+		info := infos[t.String()]
+		if info == nil {
+			continue
+		}
+		codec := strings.ToLower(info.Codec)
+		switch codec {
+		case "h264", "h265", "acc", "aac", "mp4a-latm", "opus":
+		default:
+			continue
+		}
+		if info.TimeScale <= 0 {
+			continue
+		}
+		depacketizer, err := NewDepacketizer(info)
+		if err != nil {
+			log.Println(fmt.Errorf("frame reader %v disabled: %s", t, err))
+			continue
+		}
+		r.tracks[t] = &frameTrack{
+			t:            t,
+			info:         info,
+			codec:        codec,
+			clockRate:    info.TimeScale,
+			depacketizer: depacketizer,
+			paramSets:    make(map[int][]byte),
+			needKeyframe: t == RTP_TYPE_VIDEO,
+		}
+	}
+}
+
+// restart 源发生变化，从下一个视频关键帧重新对齐各路媒体
+func (r *FrameReader) restart(reason string) {
+	if !r.started {
+		return
+	}
+	log.Println(fmt.Sprintf("frame reader %s, timeline continues from %v", reason, r.lastDTS))
+	r.started = false
+	r.discontinuity = true
+	for _, track := range r.tracks {
+		track.started = false
+		if track.t == RTP_TYPE_VIDEO {
+			track.needKeyframe = true
+		}
+	}
+}
+
+// frame 计算一帧在时间轴上的PTS和DTS，丢弃的帧返回nil
+func (r *FrameReader) frame(track *frameTrack, au *AccessUnit) *Frame {
+	ext := track.ts.extend(au.Timestamp)
+	if track.started {
+		jump := ext - track.base + track.offset - track.lastDTS
+		if limit := int64(frameReaderMaxJump/time.Second) * int64(track.clockRate); jump > limit || jump < -limit {
+			r.restart(fmt.Sprintf("%v timestamp jump %d", track.t, jump))
+		}
+	}
+	if track.t == RTP_TYPE_VIDEO {
+		track.updateParamSets(au.NALUs)
+		if track.needKeyframe && !au.Keyframe {
+			return nil
+		}
+		track.needKeyframe = false
+	}
+
+	if !track.started {
+		if !r.started {
+			// 有视频时以视频关键帧作为时间轴的起点
+			if r.tracks[RTP_TYPE_VIDEO] != nil && track.t != RTP_TYPE_VIDEO {
+				return nil
+			}
+			r.started = true
+			r.origin = au.SyncPTS
+			r.anchor = 0
+			if r.lastDTS > 0 || r.discontinuity {
+				r.anchor = r.lastDTS + r.frameDuration
+			}
+		}
+		// 其余媒体按同步PTS对齐，早于起点的帧丢弃
+		position := r.anchor + au.SyncPTS - r.origin
+		if position < 0 {
+			return nil
+		}
+		track.started = true
+		track.base = ext
+		track.reorder = 0
+		if track.t == RTP_TYPE_VIDEO {
+			track.reorder = track.reorderFrames()
+		}
+		track.pending = nil
+		// 前reorder帧的DTS早于首帧的PTS，PTS后移同样的时钟计数使DTS不早于起点
+		track.offset = rtpTicks(position, track.clockRate) + int64(track.reorder)
+		track.lastDTS = track.offset - int64(track.reorder) - 1
+	}
+
+	pts := ext - track.base + track.offset
+	dts := track.decodeTime(pts)
+	if dts <= track.lastDTS {
+		// 实际的重排序超过SPS中给出的帧数，解码时间在上一帧之后递增
+		dts = track.lastDTS + 1
+	}
+	if track.t == RTP_TYPE_VIDEO || r.tracks[RTP_TYPE_VIDEO] == nil {
+		if track.lastDTS >= track.offset {
+			r.frameDuration = ticksDuration(dts-track.lastDTS, track.clockRate)
+		}
+	}
+	track.lastDTS = dts
+
+	frame := &Frame{
+		Type:          track.t,
+		PTS:           ticksDuration(pts, track.clockRate),
+		DTS:           ticksDuration(dts, track.clockRate),
+		CaptureTime:   au.CaptureTime,
+		Keyframe:      au.Keyframe || track.t != RTP_TYPE_VIDEO,
+		NALUs:         au.NALUs,
+		Data:          au.Data,
+		Discontinuity: r.discontinuity,
+	}
+	r.discontinuity = false
+	if frame.DTS > r.lastDTS {
+		r.lastDTS = frame.DTS
+	}
+	return frame
+}
+
+// decodeTime 由PTS推算DTS，rtp中没有解码时间
+// 解码顺序的第n帧的DTS取显示顺序的第n-reorder帧的PTS，显示顺序最多晚reorder帧，
+// 收到第n帧时已收到的PTS中尚未使用的最小值就是它，前reorder帧在起点前逐个计数递增
+func (t *frameTrack) decodeTime(pts int64) int64 {
+	if t.reorder == 0 {
+		return pts
+	}
+	i := sort.Search(len(t.pending), func(i int) bool { return t.pending[i] > pts })
+	t.pending = append(t.pending, 0)
+	copy(t.pending[i+1:], t.pending[i:])
+	t.pending[i] = pts
+	if len(t.pending) <= t.reorder {
+		return t.offset - int64(t.reorder-len(t.pending)+1)
+	}
+	dts := t.pending[0]
+	t.pending = t.pending[1:]
+	return dts
+}
+
+// reorderFrames 由带内或sdp中的SPS得到显示顺序和解码顺序最多相差的帧数
+func (t *frameTrack) reorderFrames() int {
+	typ := int(h264.NALUTypeSPS)
+	if t.codec == "h265" {
+		typ = int(h265.NALUTypeSPS)
+	}
+	sps := t.paramSets[typ]
+	for _, ps := range t.info.ParameterSets {
+		if sps != nil {
+			break
+		}
+		if (t.codec == "h264" && int(h264.Type(ps)) == typ) || (t.codec == "h265" && len(ps) >= 2 && int(h265.Type(ps)) == typ) {
+			sps = ps
+		}
+	}
+	if sps == nil {
+		return frameReaderDefaultReorder
+	}
+	if t.codec == "h265" {
+		if s, err := h265.ParseSPS(sps); err == nil {
+			return s.MaxNumReorderPics
+		}
+	} else if s, err := h264.ParseSPS(sps); err == nil {
+		if n, ok := s.ReorderFrames(); ok {
+			return n
+		}
+	}
+	return frameReaderDefaultReorder
+}
+
+// updateParamSets 记录帧中带内的VPS/SPS/PPS
+func (t *frameTrack) updateParamSets(nalus [][]byte) {
+	for _, nalu := range nalus {
+		if t.codec == "h264" {
+			if typ := h264.Type(nalu); typ == h264.NALUTypeSPS || typ == h264.NALUTypePPS {
+				t.paramSets[int(typ)] = append([]byte(nil), nalu...)
+			}
+		} else if len(nalu) >= 2 && h265.Type(nalu).IsParameterSet() {
+			t.paramSets[int(h265.Type(nalu))] = append([]byte(nil), nalu...)
+		}
+	}
+}
+
+// Tracks 支持输出的媒体，视频在前
+func (r *FrameReader) Tracks() []RTPType {
+	r.update()
+	var tracks []RTPType
+	for _, t := range []RTPType{RTP_TYPE_VIDEO, RTP_TYPE_AUDIO} {
+		if r.tracks[t] != nil {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks
+}
+
+// Codec 媒体的小写编码名称，aac为 aac 或 mp4a-latm，不支持时为空
+func (r *FrameReader) Codec(t RTPType) string {
+	r.update()
+	if track := r.tracks[t]; track != nil {
+		if track.codec == "acc" {
+			return "aac"
+		}
+		return track.codec
+	}
+	return ""
+}
+
+// ClockRate 媒体的rtp时钟频率
+func (r *FrameReader) ClockRate(t RTPType) int {
+	r.update()
+	if track := r.tracks[t]; track != nil {
+		return track.clockRate
+	}
+	return 0
+}
+
+// Info 媒体的sdp信息
+func (r *FrameReader) Info(t RTPType) *SDPInfo {
+	r.update()
+	if track := r.tracks[t]; track != nil {
+		return track.info
+	}
+	return nil
+}
+
+// ParameterSets 视频的参数集，h264为[SPS,PPS]，h265为[VPS,SPS,PPS]，带内的优先于sdp中的，缺少时返回nil
+func (r *FrameReader) ParameterSets() [][]byte {
+	r.update()
+	t := r.tracks[RTP_TYPE_VIDEO]
+	if t == nil {
+		return nil
+	}
+	types := []int{int(h264.NALUTypeSPS), int(h264.NALUTypePPS)}
+	if t.codec == "h265" {
+		types = []int{int(h265.NALUTypeVPS), int(h265.NALUTypeSPS), int(h265.NALUTypePPS)}
+	}
+	sets := make([][]byte, len(types))
+	for i, typ := range types {
+		if ps := t.paramSets[typ]; ps != nil {
+			sets[i] = ps
+			continue
+		}
+		for _, ps := range t.info.ParameterSets {
+			if (t.codec == "h264" && int(h264.Type(ps)) == typ) || (t.codec == "h265" && len(ps) >= 2 && int(h265.Type(ps)) == typ) {
+				sets[i] = ps
+				break
+			}
+		}
+		if sets[i] == nil {
+			return nil
+		}
+	}
+	return sets
+}
+
+// AACConfig aac的AudioSpecificConfig，mp4a-latm带内的配置尚未收到或不是aac时返回nil
+func (r *FrameReader) AACConfig() []byte {
+	r.update()
+	t := r.tracks[RTP_TYPE_AUDIO]
+	if t == nil {
+		return nil
+	}
+	switch t.codec {
+	case "acc", "aac":
+		if _, err := aac.ParseConfig(t.info.Config); err != nil {
+			return nil
+		}
+		return t.info.Config
+	case "mp4a-latm":
+		if depacketizer, ok := t.depacketizer.(*LATMDepacketizer); ok && depacketizer.Config() != nil {
+			return depacketizer.Config().Marshal()
+		}
+	}
+	return nil
+}
+
+// trackConfig 各路媒体的编码和参数集，输出在其变化时需要重新初始化
+func (r *FrameReader) trackConfig() string {
+	var b strings.Builder
+	for _, t := range r.Tracks() {
+		b.WriteString(r.Codec(t))
+		b.WriteString(":")
+		if t == RTP_TYPE_VIDEO {
+			for _, ps := range r.ParameterSets() {
+				b.WriteString(hex.EncodeToString(ps))
+				b.WriteString(",")
+			}
+		} else {
+			b.WriteString(hex.EncodeToString(r.AACConfig()))
+		}
+		b.WriteString(";")
+	}
+	return b.String()
+}
+
+// FMP4Codec 媒体在fmp4中的编码参数
+func (r *FrameReader) FMP4Codec(t RTPType) (fmp4.Codec, error) {
+	switch codec := r.Codec(t); codec {
+	case "h264", "h265":
+		sets := r.ParameterSets()
+		if sets == nil {
+			return nil, fmt.Errorf("%s parameter sets not received", codec)
+		}
+		if codec == "h264" {
+			return &fmp4.CodecH264{SPS: sets[0], PPS: sets[1]}, nil
+		}
+		return &fmp4.CodecH265{VPS: sets[0], SPS: sets[1], PPS: sets[2]}, nil
+	case "aac", "mp4a-latm":
+		config := r.AACConfig()
+		if config == nil {
+			return nil, fmt.Errorf("aac config not received")
+		}
+		return &fmp4.CodecAAC{Config: config}, nil
+	case "opus":
+		return &fmp4.CodecOpus{ChannelCount: r.Info(t).ChannelCount}, nil
+	case "":
+		return nil, fmt.Errorf("%v not available", t)
+	default:
+		return nil, fmt.Errorf("unsupported codec[%s] for fmp4", codec)
+	}
+}
+
+// ticksDuration 时钟计数换算为时长，向上取整使 rtpTicks 换算回原值
+func ticksDuration(ticks int64, clockRate int) time.Duration {
+	if clockRate <= 0 {
+		return 0
+	}
+	rate := int64(clockRate)
+	return time.Duration(ticks/rate)*time.Second + time.Duration((ticks%rate*int64(time.Second)+rate-1)/rate)
+}
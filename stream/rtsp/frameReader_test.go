@@ -0,0 +1,153 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFrameReaderVideo(t *testing.T) {
+	sdp, sps, pps := testRecorderSDP()
+	r := NewFrameReader(func() string { return sdp })
+	if tracks := r.Tracks(); len(tracks) != 1 || tracks[0] != RTP_TYPE_VIDEO || r.Codec(RTP_TYPE_VIDEO) != "h264" || r.ClockRate(RTP_TYPE_VIDEO) != 90000 {
+		t.Fatalf("tracks %v", tracks)
+	}
+	if sets := r.ParameterSets(); len(sets) != 2 || !equalNALUs(sets, [][]byte{sps, pps}) {
+		t.Errorf("parameter sets %x", sets)
+	}
+
+	var zero uint32
+	packetizers := map[uint32]Packetizer{
+		1: NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 1200, InitialTimestamp: &zero}),
+		2: NewH264Packetizer(PacketizerOptions{SSRC: 2, MTU: 1200, InitialTimestamp: &zero}),
+	}
+	idr := testNALU([]byte{0x65, 0x88}, 100)
+	slice := testNALU([]byte{0x41, 0x9A}, 100)
+	tests := []struct {
+		name          string
+		ssrc          uint32
+		frame         int
+		keyframe      bool
+		lost          bool
+		output        bool
+		dts           time.Duration
+		discontinuity bool
+	}{
+		{"wait keyframe", 1, 0, false, false, false, 0, false},
+		{"first keyframe", 1, 1, true, false, true, 0, false},
+		{"slice", 1, 2, false, false, true, 40 * time.Millisecond, false},
+		{"lost", 1, 3, false, true, false, 0, false},
+		{"after loss", 1, 4, false, false, false, 0, false},
+		{"keyframe after loss", 1, 5, true, false, true, 160 * time.Millisecond, false},
+		{"slice after keyframe", 1, 6, false, false, true, 200 * time.Millisecond, false},
+		// 新的源从关键帧开始，时间轴在上一帧之后按帧间隔继续
+		{"ssrc change slice", 2, 0, false, false, false, 0, false},
+		{"ssrc change keyframe", 2, 1, true, false, true, 240 * time.Millisecond, true},
+		{"ssrc change next", 2, 2, false, false, true, 280 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nalus := [][]byte{slice}
+			if tt.keyframe {
+				nalus = [][]byte{idr}
+			}
+			packs, err := packetizers[tt.ssrc].Packetize(&AccessUnit{PTS: time.Duration(tt.frame) * 40 * time.Millisecond, NALUs: nalus})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.lost {
+				return
+			}
+			var frames []*Frame
+			for _, pack := range packs {
+				pack.Type = RTP_TYPE_VIDEO
+				frames = append(frames, r.ReadRTP(pack)...)
+			}
+			if !tt.output {
+				if len(frames) != 0 {
+					t.Errorf("frames %d, want 0", len(frames))
+				}
+				return
+			}
+			if len(frames) != 1 {
+				t.Fatalf("frames %d, want 1", len(frames))
+			}
+			f := frames[0]
+			if f.DTS != tt.dts || f.PTS != tt.dts || f.Keyframe != tt.keyframe || f.Discontinuity != tt.discontinuity {
+				t.Errorf("frame dts %v pts %v keyframe %v discontinuity %v", f.DTS, f.PTS, f.Keyframe, f.Discontinuity)
+			}
+			// 关键帧前可能带有参数集
+			if last := f.NALUs[len(f.NALUs)-1:]; !equalNALUs(last, nalus) {
+				t.Errorf("nalus mismatch")
+			}
+		})
+	}
+}
+
+// TestFrameReaderBFrames IBBP的流按SPS中的重排序帧数推算DTS，DTS单调递增且不晚于PTS
+func TestFrameReaderBFrames(t *testing.T) {
+	// high profile，bitstream_restriction中max_num_reorder_frames为2
+	sps := mustHex("6764001facd9405005bb011000000300100000030320f1831960")
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	sdp := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=camera\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+		fmt.Sprintf("a=fmtp:96 packetization-mode=1;sprop-parameter-sets=%s,%s\r\n",
+			base64.StdEncoding.EncodeToString(sps), base64.StdEncoding.EncodeToString(pps)) +
+		"a=control:trackID=0\r\n"
+	r := NewFrameReader(func() string { return sdp })
+	var zero uint32
+	packetizer := NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 1200, InitialTimestamp: &zero})
+
+	// 解码顺序 I0 P3 B1 B2 P6 B4 B5 P9 B7 B8
+	order := []int{0, 3, 1, 2, 6, 4, 5, 9, 7, 8}
+	var frames []*Frame
+	for _, n := range order {
+		nalus := [][]byte{testNALU([]byte{0x01, 0x9A}, 100)}
+		if n == 0 {
+			nalus = [][]byte{testNALU([]byte{0x65, 0x88}, 100)}
+		}
+		packs, err := packetizer.Packetize(&AccessUnit{PTS: time.Duration(n) * 40 * time.Millisecond, NALUs: nalus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range packs {
+			pack.Type = RTP_TYPE_VIDEO
+			frames = append(frames, r.ReadRTP(pack)...)
+		}
+	}
+	if len(frames) != len(order) {
+		t.Fatalf("frames %d, want %d", len(frames), len(order))
+	}
+	// 起点后移重排序帧数的时钟计数，前两帧的DTS在起点前逐个递增
+	shift := ticksDuration(2, 90000)
+	for i, f := range frames {
+		if want := time.Duration(order[i])*40*time.Millisecond + shift; f.PTS != want {
+			t.Errorf("frame %d pts %v, want %v", i, f.PTS, want)
+		}
+		if f.DTS > f.PTS {
+			t.Errorf("frame %d dts %v after pts %v", i, f.DTS, f.PTS)
+		}
+		if i > 0 && f.DTS <= frames[i-1].DTS {
+			t.Errorf("frame %d dts %v not after %v", i, f.DTS, frames[i-1].DTS)
+		}
+		if i >= 2 {
+			if want := time.Duration(i-2)*40*time.Millisecond + shift; f.DTS != want {
+				t.Errorf("frame %d dts %v, want %v", i, f.DTS, want)
+			}
+		}
+	}
+}
+
+func TestFrameReaderUnsupported(t *testing.T) {
+	sdp := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=camera\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 26\r\na=rtpmap:26 JPEG/90000\r\n" +
+		"m=audio 0 RTP/AVP 8\r\na=rtpmap:8 PCMA/8000\r\n"
+	r := NewFrameReader(func() string { return sdp })
+	if tracks := r.Tracks(); len(tracks) != 0 {
+		t.Errorf("tracks %v", tracks)
+	}
+	if _, err := r.FMP4Codec(RTP_TYPE_VIDEO); err == nil {
+		t.Errorf("fmp4 codec for unsupported track")
+	}
+}
@@ -0,0 +1,252 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/h264"
+)
+
+// 单个访问单元的最大字节数，超过后丢弃
+const maxAccessUnitSize = 8 * 1024 * 1024
+
+// H264Depacketizer h264 rtp解包器(RFC 6184)
+// 支持单一NALU、STAP-A、STAP-B、MTAP、FU-A、FU-B，以marker位或时间戳变化作为帧边界
+// 检测到丢包后丢弃数据直到下一个IDR
+type H264Depacketizer struct {
+	clockRate int
+	sps       []byte
+	pps       []byte
+
+	seq          sequenceTracker
+	waitKeyframe bool
+
+	timestamp   uint32
+	nalus       [][]byte
+	size        int
+	fragment    []byte
+	fragmenting bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewH264Depacketizer 创建h264解包器，info 可为nil
+// sdp中携带的 sprop-parameter-sets 会在缺少参数集的IDR前补全
+func NewH264Depacketizer(info *SDPInfo) *H264Depacketizer {
+	d := &H264Depacketizer{
+		clockRate:    90000,
+		waitKeyframe: true,
+	}
+	if info != nil {
+		if info.TimeScale > 0 {
+			d.clockRate = info.TimeScale
+		}
+		for _, ps := range info.ParameterSets {
+			switch h264.Type(ps) {
+			case h264.NALUTypeSPS:
+				d.sps = ps
+			case h264.NALUTypePPS:
+				d.pps = ps
+			}
+		}
+	}
+	return d
+}
+
+// Decode 输入一个rtp包，返回此时已完整的访问单元
+func (d *H264Depacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil || len(rtp.Payload) == 0 {
+		return nil, fmt.Errorf("h264 rtp payload is empty")
+	}
+
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		// 重复或迟到的包
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+		d.waitKeyframe = true
+	}
+
+	var aus []*AccessUnit
+	ts := uint32(rtp.Timestamp)
+	if (len(d.nalus) > 0 || d.fragmenting) && ts != d.timestamp {
+		// marker丢失时以时间戳变化作为帧边界
+		if au := d.flush(); au != nil {
+			aus = append(aus, au)
+		}
+	}
+	d.timestamp = ts
+
+	if err := d.unpack(rtp.Payload); err != nil {
+		d.discard()
+		d.waitKeyframe = true
+		return aus, err
+	}
+
+	if rtp.Marker {
+		if au := d.flush(); au != nil {
+			aus = append(aus, au)
+		}
+	}
+	return aus, nil
+}
+
+// unpack 解析一个rtp负载中的NALU
+func (d *H264Depacketizer) unpack(payload []byte) error {
+	switch t := h264.Type(payload); t {
+	case h264.NALUTypeSTAPA, h264.NALUTypeSTAPB:
+		// STAP-B 在payload header后有2字节DON
+		offset := 1
+		if t == h264.NALUTypeSTAPB {
+			offset = 3
+		}
+		if len(payload) < offset {
+			return fmt.Errorf("h264 %v packet too short", t)
+		}
+		payload = payload[offset:]
+		for len(payload) > 0 {
+			if len(payload) < 2 {
+				return fmt.Errorf("h264 %v size field truncated", t)
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size == 0 || size > len(payload) {
+				return fmt.Errorf("h264 %v invalid nalu size %d", t, size)
+			}
+			if err := d.append(payload[:size]); err != nil {
+				return err
+			}
+			payload = payload[size:]
+		}
+	case h264.NALUTypeMTAP16, h264.NALUTypeMTAP24:
+		// payload header后为2字节DONB，每个NALU前为 size(2) DOND(1) TS offset(2或3)
+		tsLen := 2
+		if t == h264.NALUTypeMTAP24 {
+			tsLen = 3
+		}
+		if len(payload) < 3 {
+			return fmt.Errorf("h264 %v packet too short", t)
+		}
+		payload = payload[3:]
+		for len(payload) > 0 {
+			if len(payload) < 3+tsLen {
+				return fmt.Errorf("h264 %v unit header truncated", t)
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[3+tsLen:]
+			if size == 0 || size > len(payload) {
+				return fmt.Errorf("h264 %v invalid nalu size %d", t, size)
+			}
+			if err := d.append(payload[:size]); err != nil {
+				return err
+			}
+			payload = payload[size:]
+		}
+	case h264.NALUTypeFUA, h264.NALUTypeFUB:
+		// FU indicator | FU header(S|E|R|Type)，FU-B 在FU header后有2字节DON
+		offset := 2
+		if t == h264.NALUTypeFUB {
+			offset = 4
+		}
+		if len(payload) < offset {
+			return fmt.Errorf("h264 %v packet too short", t)
+		}
+		start := payload[1]&0x80 != 0
+		end := payload[1]&0x40 != 0
+		if start {
+			d.fragment = append(d.fragment[:0], payload[0]&0xE0|payload[1]&0x1F)
+			d.fragmenting = true
+		} else if !d.fragmenting {
+			// 缺少起始分片，丢弃
+			return nil
+		}
+		if len(d.fragment)+len(payload)-offset > maxAccessUnitSize {
+			return fmt.Errorf("h264 fragmented nalu exceeds %d bytes", maxAccessUnitSize)
+		}
+		d.fragment = append(d.fragment, payload[offset:]...)
+		if end {
+			d.fragmenting = false
+			nalu := d.fragment
+			d.fragment = nil
+			return d.append(nalu)
+		}
+	case 0, 30, 31:
+		return fmt.Errorf("h264 unsupported nalu type %d", t)
+	default:
+		return d.append(payload)
+	}
+	return nil
+}
+
+// append 加入一个完整的NALU到当前访问单元
+func (d *H264Depacketizer) append(nalu []byte) error {
+	if d.size+len(nalu) > maxAccessUnitSize {
+		return fmt.Errorf("h264 access unit exceeds %d bytes", maxAccessUnitSize)
+	}
+	d.nalus = append(d.nalus, append([]byte(nil), nalu...))
+	d.size += len(nalu)
+	return nil
+}
+
+// discard 丢弃当前未完成的访问单元
+func (d *H264Depacketizer) discard() {
+	d.nalus = nil
+	d.size = 0
+	d.fragment = nil
+	d.fragmenting = false
+}
+
+// flush 结束当前访问单元，等待IDR期间返回nil
+func (d *H264Depacketizer) flush() *AccessUnit {
+	nalus := d.nalus
+	d.discard()
+	if len(nalus) == 0 {
+		return nil
+	}
+
+	hasSPS, hasPPS := false, false
+	for _, nalu := range nalus {
+		switch h264.Type(nalu) {
+		case h264.NALUTypeSPS:
+			d.sps, hasSPS = nalu, true
+		case h264.NALUTypePPS:
+			d.pps, hasPPS = nalu, true
+		}
+	}
+
+	keyframe := h264.IsKeyframe(nalus)
+	if d.waitKeyframe {
+		if !keyframe {
+			return nil
+		}
+		d.waitKeyframe = false
+	}
+
+	// IDR前补全参数集，方便直接解码或录制
+	if keyframe && (!hasSPS || !hasPPS) && d.sps != nil && d.pps != nil {
+		head := make([][]byte, 0, len(nalus)+2)
+		if h264.Type(nalus[0]) == h264.NALUTypeAUD {
+			head = append(head, nalus[0])
+			nalus = nalus[1:]
+		}
+		if !hasSPS {
+			head = append(head, d.sps)
+		}
+		if !hasPPS {
+			head = append(head, d.pps)
+		}
+		nalus = append(head, nalus...)
+	}
+
+	return &AccessUnit{
+		Timestamp: d.timestamp,
+		PTS:       timestampToDuration(d.ts.extend(d.timestamp), d.clockRate),
+		Keyframe:  keyframe,
+		NALUs:     nalus,
+	}
+}
@@ -0,0 +1,171 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testRTP 构造解包器的输入
+func testRTP(seq int, ts int, marker bool, payload []byte) *RTPInfo {
+	return &RTPInfo{Version: 2, SequenceNumber: seq, Timestamp: ts, Marker: marker, Payload: payload}
+}
+
+// decodeAll 依次解包，返回所有访问单元
+func decodeAll(t *testing.T, d Depacketizer, packets []*RTPInfo) []*AccessUnit {
+	t.Helper()
+	var aus []*AccessUnit
+	for _, p := range packets {
+		out, err := d.Decode(p)
+		if err != nil {
+			t.Fatalf("decode seq %d: %v", p.SequenceNumber, err)
+		}
+		aus = append(aus, out...)
+	}
+	return aus
+}
+
+func equalNALUs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestH264Depacketizer(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f}
+	pps := []byte{0x68, 0xcb, 0x83}
+	idr := []byte{0x65, 0x88, 0x84, 0x00, 0x21}
+	slice := []byte{0x41, 0x9a, 0x02}
+
+	tests := []struct {
+		name    string
+		info    *SDPInfo
+		packets []*RTPInfo
+		want    []*AccessUnit
+	}{
+		{
+			name: "single nalu",
+			packets: []*RTPInfo{
+				testRTP(1, 3000, false, sps),
+				testRTP(2, 3000, false, pps),
+				testRTP(3, 3000, true, idr),
+				testRTP(4, 6000, true, slice),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 3000, Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+				{Timestamp: 6000, PTS: 33333333, NALUs: [][]byte{slice}},
+			},
+		},
+		{
+			name: "stap-a",
+			packets: []*RTPInfo{
+				testRTP(10, 0, true, []byte{24, 0, 4, 0x67, 0x42, 0xc0, 0x1f, 0, 3, 0x68, 0xcb, 0x83, 0, 5, 0x65, 0x88, 0x84, 0x00, 0x21}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+			},
+		},
+		{
+			name: "fu-a",
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, []byte{24, 0, 4, 0x67, 0x42, 0xc0, 0x1f, 0, 3, 0x68, 0xcb, 0x83}),
+				testRTP(2, 0, false, []byte{0x7c, 0x85, 0x88, 0x84}),
+				testRTP(3, 0, false, []byte{0x7c, 0x05, 0x00}),
+				testRTP(4, 0, true, []byte{0x7c, 0x45, 0x21}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+			},
+		},
+		{
+			name: "parameter sets from sdp",
+			info: &SDPInfo{TimeScale: 90000, ParameterSets: [][]byte{sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, idr),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+			},
+		},
+		{
+			name: "wait for idr",
+			info: &SDPInfo{ParameterSets: [][]byte{sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, slice),
+				testRTP(2, 3000, true, idr),
+			},
+			want: []*AccessUnit{
+				{Timestamp: 3000, Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+			},
+		},
+		{
+			name: "loss discards until idr",
+			info: &SDPInfo{ParameterSets: [][]byte{sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, idr),
+				testRTP(3, 3000, true, slice),
+				testRTP(4, 6000, true, idr),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+				{Timestamp: 6000, PTS: 66666666, Keyframe: true, NALUs: [][]byte{sps, pps, idr}},
+			},
+		},
+		{
+			name: "timestamp change without marker and duplicate",
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, idr),
+				testRTP(2, 3000, false, slice),
+				testRTP(3, 3000, false, slice),
+				testRTP(3, 3000, true, slice),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{idr}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aus := decodeAll(t, NewH264Depacketizer(tt.info), tt.packets)
+			if len(aus) != len(tt.want) {
+				t.Fatalf("got %d access units, want %d", len(aus), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := aus[i]
+				if got.Timestamp != want.Timestamp || got.PTS != want.PTS || got.Keyframe != want.Keyframe {
+					t.Errorf("au %d: got ts=%d pts=%v key=%v, want ts=%d pts=%v key=%v", i,
+						got.Timestamp, got.PTS, got.Keyframe, want.Timestamp, want.PTS, want.Keyframe)
+				}
+				if !equalNALUs(got.NALUs, want.NALUs) {
+					t.Errorf("au %d: got nalus %x, want %x", i, got.NALUs, want.NALUs)
+				}
+			}
+		})
+	}
+}
+
+func TestH264DepacketizerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"stap-a truncated size", []byte{24, 0}},
+		{"stap-a size overflow", []byte{24, 0, 9, 0x65}},
+		{"fu-a too short", []byte{0x7c}},
+		{"reserved type", []byte{30, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewH264Depacketizer(nil)
+			if _, err := d.Decode(testRTP(1, 0, true, tt.payload)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
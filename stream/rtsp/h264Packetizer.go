@@ -0,0 +1,127 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/h264"
+)
+
+// H264Packetizer h264 rtp打包器(RFC 6184)
+// 超过MTU的NALU使用FU-A分片，可选将SPS/PPS聚合为STAP-A
+type H264Packetizer struct {
+	*rtpPacker
+}
+
+// NewH264Packetizer 创建h264打包器
+func NewH264Packetizer(options PacketizerOptions) *H264Packetizer {
+	return &H264Packetizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_VIDEO, 96, 90000, options),
+	}
+}
+
+// Packetize 封装一个访问单元
+func (p *H264Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.packetize(au.NALUs, au.PTS)
+}
+
+// PacketizeFrame 封装一帧Annex-B或AVCC格式的数据
+func (p *H264Packetizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	nalus, err := splitFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	return p.packetize(nalus, pts)
+}
+
+func (p *H264Packetizer) packetize(nalus [][]byte, pts time.Duration) ([]*RTPPack, error) {
+	maxSize := p.maxPayloadSize()
+	var payloads [][]byte
+	for i := 0; i < len(nalus); {
+		nalu := nalus[i]
+		if len(nalu) == 0 {
+			i++
+			continue
+		}
+
+		if p.options.AggregateParameterSets && isH264ParameterSet(nalu) {
+			j, size := i, 1
+			for j < len(nalus) && isH264ParameterSet(nalus[j]) && size+2+len(nalus[j]) <= maxSize {
+				size += 2 + len(nalus[j])
+				j++
+			}
+			if j-i >= 2 {
+				payloads = append(payloads, h264STAPA(nalus[i:j], size))
+				i = j
+				continue
+			}
+		}
+
+		if len(nalu) <= maxSize {
+			payloads = append(payloads, nalu)
+		} else {
+			payloads = append(payloads, h264FUA(nalu, maxSize)...)
+		}
+		i++
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("h264 access unit is empty")
+	}
+
+	ts := p.rtpTimestamp(pts)
+	packs := make([]*RTPPack, 0, len(payloads))
+	for i, payload := range payloads {
+		packs = append(packs, p.pack(payload, ts, i == len(payloads)-1))
+	}
+	return packs, nil
+}
+
+func isH264ParameterSet(nalu []byte) bool {
+	t := h264.Type(nalu)
+	return t == h264.NALUTypeSPS || t == h264.NALUTypePPS
+}
+
+// h264STAPA 将多个NALU聚合为STAP-A负载
+func h264STAPA(nalus [][]byte, size int) []byte {
+	payload := make([]byte, 1, size)
+	for _, nalu := range nalus {
+		// F位取或，NRI取最大值
+		payload[0] |= nalu[0] & 0x80
+		if nri := nalu[0] & 0x60; nri > payload[0]&0x60 {
+			payload[0] = payload[0]&0x9F | nri
+		}
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	payload[0] |= byte(h264.NALUTypeSTAPA)
+	return payload
+}
+
+// h264FUA 将NALU拆分为FU-A负载
+func h264FUA(nalu []byte, maxSize int) [][]byte {
+	indicator := nalu[0]&0xE0 | byte(h264.NALUTypeFUA)
+	header := nalu[0] & 0x1F
+	data := nalu[1:]
+	chunk := maxSize - 2
+
+	var payloads [][]byte
+	for start := true; len(data) > 0; start = false {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		fuHeader := header
+		if start {
+			fuHeader |= 0x80
+		}
+		if n == len(data) {
+			fuHeader |= 0x40
+		}
+		payload := make([]byte, 0, 2+n)
+		payload = append(payload, indicator, fuHeader)
+		payload = append(payload, data[:n]...)
+		payloads = append(payloads, payload)
+		data = data[n:]
+	}
+	return payloads
+}
@@ -0,0 +1,120 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// parsePacks 将打包器输出的rtp包解析为解包器的输入
+func parsePacks(t *testing.T, packs []*RTPPack) []*RTPInfo {
+	t.Helper()
+	infos := make([]*RTPInfo, 0, len(packs))
+	for _, pack := range packs {
+		info := ParseRTP(pack.Buffer.Bytes())
+		if info == nil {
+			t.Fatalf("invalid rtp packet %x", pack.Buffer.Bytes())
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// testNALU 以 header 开头、长度为 size 的NALU
+func testNALU(header []byte, size int) []byte {
+	nalu := append([]byte(nil), header...)
+	for len(nalu) < size {
+		nalu = append(nalu, byte(len(nalu)))
+	}
+	return nalu
+}
+
+func TestH264PacketizerRoundTrip(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f, 0xd9}
+	pps := []byte{0x68, 0xcb, 0x83, 0xcb, 0x20}
+
+	tests := []struct {
+		name      string
+		mtu       int
+		aggregate bool
+		aus       [][][]byte
+		// 每个访问单元的rtp包数
+		packets []int
+	}{
+		{
+			name:    "single nalu",
+			aus:     [][][]byte{{sps, pps, testNALU([]byte{0x65}, 500)}, {testNALU([]byte{0x41}, 100)}},
+			packets: []int{3, 1},
+		},
+		{
+			name:      "stap-a",
+			aggregate: true,
+			aus:       [][][]byte{{sps, pps, testNALU([]byte{0x65}, 500)}},
+			packets:   []int{2},
+		},
+		{
+			name:      "fu-a",
+			mtu:       100,
+			aggregate: true,
+			aus:       [][][]byte{{sps, pps, testNALU([]byte{0x65}, 1000)}, {testNALU([]byte{0x41}, 89)}},
+			packets:   []int{13, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, ts := uint16(0xFFFE), uint32(0xFFFFFF00)
+			p := NewH264Packetizer(PacketizerOptions{MTU: tt.mtu, SSRC: 0x1234, AggregateParameterSets: tt.aggregate,
+				InitialSequenceNumber: &seq, InitialTimestamp: &ts})
+			d := NewH264Depacketizer(nil)
+			for i, nalus := range tt.aus {
+				pts := time.Duration(i) * 40 * time.Millisecond
+				packs, err := p.Packetize(&AccessUnit{PTS: pts, NALUs: nalus})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(packs) != tt.packets[i] {
+					t.Fatalf("au %d: got %d packets, want %d", i, len(packs), tt.packets[i])
+				}
+				infos := parsePacks(t, packs)
+				for j, info := range infos {
+					if info.Marker != (j == len(infos)-1) {
+						t.Errorf("au %d packet %d: marker %v", i, j, info.Marker)
+					}
+					if info.SSRC != 0x1234 || info.PayloadType != 96 || uint32(info.Timestamp) != ts+uint32(i)*3600 {
+						t.Errorf("au %d packet %d: ssrc=%x pt=%d ts=%d", i, j, info.SSRC, info.PayloadType, info.Timestamp)
+					}
+					if len(packs[j].Buffer.Bytes()) > tt.mtu && tt.mtu > 0 {
+						t.Errorf("au %d packet %d: %d bytes exceeds mtu", i, j, len(packs[j].Buffer.Bytes()))
+					}
+				}
+				aus := decodeAll(t, d, infos)
+				if len(aus) != 1 || !equalNALUs(aus[0].NALUs, nalus) || aus[0].PTS != pts {
+					t.Fatalf("au %d: round trip mismatch", i)
+				}
+			}
+			if d.Lost != 0 {
+				t.Errorf("lost %d packets across sequence wrap", d.Lost)
+			}
+		})
+	}
+}
+
+func TestH264PacketizeFrame(t *testing.T) {
+	idr := testNALU([]byte{0x65}, 20)
+	frames := [][]byte{
+		append([]byte{0, 0, 0, 1}, idr...),
+		append([]byte{0, 0, 0, 20}, idr...),
+	}
+	for _, frame := range frames {
+		packs, err := NewH264Packetizer(PacketizerOptions{}).PacketizeFrame(frame, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info := ParseRTP(packs[0].Buffer.Bytes()); len(packs) != 1 || !bytes.Equal(info.Payload, idr) {
+			t.Errorf("frame %x: unexpected packets", frame[:4])
+		}
+	}
+	if _, err := NewH264Packetizer(PacketizerOptions{}).Packetize(&AccessUnit{}); err == nil {
+		t.Error("expected error for empty access unit")
+	}
+}
@@ -0,0 +1,320 @@
+package rtsp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mrHChen/goutils/stream/codec/h265"
+)
+
+// h265NALU 带解码顺序号的NALU
+type h265NALU struct {
+	don  int64
+	data []byte
+}
+
+// H265Depacketizer h265 rtp解包器(RFC 7798)
+// 支持单一NALU、AP、FU、PACI，sprop-max-don-diff大于0时解析DONL/DOND并在访问单元内按解码顺序重排
+// 检测到丢包后丢弃数据直到下一个IRAP
+type H265Depacketizer struct {
+	clockRate int
+	donl      bool
+	vps       []byte
+	sps       []byte
+	pps       []byte
+
+	seq          sequenceTracker
+	waitKeyframe bool
+
+	timestamp   uint32
+	nalus       []h265NALU
+	size        int
+	fragment    []byte
+	fragmentDON int64
+	fragmenting bool
+
+	// 展开后的解码顺序号
+	donInitialized bool
+	lastDON        uint16
+	don            int64
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewH265Depacketizer 创建h265解包器，info 可为nil
+// sdp中携带的 sprop-vps/sprop-sps/sprop-pps 会在缺少参数集的IRAP前补全
+func NewH265Depacketizer(info *SDPInfo) *H265Depacketizer {
+	d := &H265Depacketizer{
+		clockRate:    90000,
+		waitKeyframe: true,
+	}
+	if info != nil {
+		if info.TimeScale > 0 {
+			d.clockRate = info.TimeScale
+		}
+		d.donl = info.MaxDonDiff > 0
+		for _, ps := range info.ParameterSets {
+			d.setParameterSet(ps)
+		}
+	}
+	return d
+}
+
+// ParameterSets 当前的参数集[VPS,SPS,PPS]，尚未获取时对应项为nil
+func (d *H265Depacketizer) ParameterSets() [][]byte {
+	return [][]byte{d.vps, d.sps, d.pps}
+}
+
+func (d *H265Depacketizer) setParameterSet(nalu []byte) bool {
+	switch h265.Type(nalu) {
+	case h265.NALUTypeVPS:
+		d.vps = nalu
+	case h265.NALUTypeSPS:
+		d.sps = nalu
+	case h265.NALUTypePPS:
+		d.pps = nalu
+	default:
+		return false
+	}
+	return true
+}
+
+// Decode 输入一个rtp包，返回此时已完整的访问单元
+func (d *H265Depacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil || len(rtp.Payload) < 2 {
+		return nil, fmt.Errorf("h265 rtp payload too short")
+	}
+
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		// 重复或迟到的包
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+		d.waitKeyframe = true
+	}
+
+	var aus []*AccessUnit
+	ts := uint32(rtp.Timestamp)
+	if (len(d.nalus) > 0 || d.fragmenting) && ts != d.timestamp {
+		// marker丢失时以时间戳变化作为帧边界
+		if au := d.flush(); au != nil {
+			aus = append(aus, au)
+		}
+	}
+	d.timestamp = ts
+
+	if err := d.unpack(rtp.Payload); err != nil {
+		d.discard()
+		d.waitKeyframe = true
+		return aus, err
+	}
+
+	if rtp.Marker {
+		if au := d.flush(); au != nil {
+			aus = append(aus, au)
+		}
+	}
+	return aus, nil
+}
+
+// extendDON 将16位DON展开，处理回绕
+func (d *H265Depacketizer) extendDON(don uint16) int64 {
+	if !d.donInitialized {
+		d.donInitialized = true
+		d.lastDON = don
+		d.don = int64(don)
+		return d.don
+	}
+	d.don += int64(int16(don - d.lastDON))
+	d.lastDON = don
+	return d.don
+}
+
+// unpack 解析一个rtp负载中的NALU
+func (d *H265Depacketizer) unpack(payload []byte) error {
+	switch t := h265.Type(payload); t {
+	case h265.NALUTypeAP:
+		// payload header(2) [DONL(2)] size(2) NALU [DOND(1)] size(2) NALU ...
+		payload = payload[2:]
+		var don int64
+		for i := 0; len(payload) > 0; i++ {
+			if d.donl {
+				if i == 0 {
+					if len(payload) < 2 {
+						return fmt.Errorf("h265 AP DONL truncated")
+					}
+					don = d.extendDON(uint16(payload[0])<<8 | uint16(payload[1]))
+					payload = payload[2:]
+				} else {
+					if len(payload) < 1 {
+						return fmt.Errorf("h265 AP DOND truncated")
+					}
+					don += int64(payload[0]) + 1
+					payload = payload[1:]
+				}
+			}
+			if len(payload) < 2 {
+				return fmt.Errorf("h265 AP size field truncated")
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			payload = payload[2:]
+			if size < 2 || size > len(payload) {
+				return fmt.Errorf("h265 AP invalid nalu size %d", size)
+			}
+			if err := d.append(payload[:size], don); err != nil {
+				return err
+			}
+			payload = payload[size:]
+		}
+		if d.donl {
+			d.don = don
+			d.lastDON = uint16(don)
+		}
+	case h265.NALUTypeFU:
+		// payload header(2) FU header(S|E|FuType) [DONL(2)] data
+		if len(payload) < 3 {
+			return fmt.Errorf("h265 FU packet too short")
+		}
+		fuHeader := payload[2]
+		start := fuHeader&0x80 != 0
+		end := fuHeader&0x40 != 0
+		offset := 3
+		if start {
+			if d.donl {
+				if len(payload) < 5 {
+					return fmt.Errorf("h265 FU DONL truncated")
+				}
+				d.fragmentDON = d.extendDON(uint16(payload[3])<<8 | uint16(payload[4]))
+				offset = 5
+			}
+			// 还原NALU header，类型取FU header中的FuType
+			d.fragment = append(d.fragment[:0], payload[0]&0x81|(fuHeader&0x3F)<<1, payload[1])
+			d.fragmenting = true
+		} else if !d.fragmenting {
+			// 缺少起始分片，丢弃
+			return nil
+		}
+		if len(d.fragment)+len(payload)-offset > maxAccessUnitSize {
+			return fmt.Errorf("h265 fragmented nalu exceeds %d bytes", maxAccessUnitSize)
+		}
+		d.fragment = append(d.fragment, payload[offset:]...)
+		if end {
+			d.fragmenting = false
+			nalu := d.fragment
+			d.fragment = nil
+			return d.append(nalu, d.fragmentDON)
+		}
+	case h265.NALUTypePACI:
+		// payload header(2) A|cType|PHSsize|F0..2|Y(2) PHES payload
+		if len(payload) < 4 {
+			return fmt.Errorf("h265 PACI packet too short")
+		}
+		cType := (payload[2] >> 1) & 0x3F
+		phsSize := int(payload[2]&0x01)<<4 | int(payload[3]>>4)
+		if len(payload) < 4+phsSize+1 {
+			return fmt.Errorf("h265 PACI header extension truncated")
+		}
+		if h265.NALUType(cType) == h265.NALUTypePACI {
+			return fmt.Errorf("h265 nested PACI packet")
+		}
+		inner := make([]byte, 0, 2+len(payload)-4-phsSize)
+		inner = append(inner, payload[0]&0x81|cType<<1, payload[1])
+		inner = append(inner, payload[4+phsSize:]...)
+		return d.unpack(inner)
+	default:
+		if t > h265.NALUTypePACI {
+			return fmt.Errorf("h265 unsupported nalu type %d", t)
+		}
+		var don int64
+		if d.donl {
+			// payload header(2) DONL(2) data
+			if len(payload) < 4 {
+				return fmt.Errorf("h265 single nalu DONL truncated")
+			}
+			don = d.extendDON(uint16(payload[2])<<8 | uint16(payload[3]))
+			nalu := make([]byte, 0, len(payload)-2)
+			nalu = append(nalu, payload[:2]...)
+			payload = append(nalu, payload[4:]...)
+		}
+		return d.append(payload, don)
+	}
+	return nil
+}
+
+// append 加入一个完整的NALU到当前访问单元
+func (d *H265Depacketizer) append(nalu []byte, don int64) error {
+	if d.size+len(nalu) > maxAccessUnitSize {
+		return fmt.Errorf("h265 access unit exceeds %d bytes", maxAccessUnitSize)
+	}
+	d.nalus = append(d.nalus, h265NALU{don: don, data: append([]byte(nil), nalu...)})
+	d.size += len(nalu)
+	return nil
+}
+
+// discard 丢弃当前未完成的访问单元
+func (d *H265Depacketizer) discard() {
+	d.nalus = nil
+	d.size = 0
+	d.fragment = nil
+	d.fragmenting = false
+}
+
+// flush 结束当前访问单元，等待IRAP期间返回nil
+func (d *H265Depacketizer) flush() *AccessUnit {
+	units := d.nalus
+	d.discard()
+	if len(units) == 0 {
+		return nil
+	}
+	if d.donl {
+		sort.SliceStable(units, func(i, j int) bool {
+			return units[i].don < units[j].don
+		})
+	}
+
+	nalus := make([][]byte, 0, len(units)+3)
+	has := make(map[h265.NALUType]bool)
+	for _, unit := range units {
+		if d.setParameterSet(unit.data) {
+			has[h265.Type(unit.data)] = true
+		}
+		nalus = append(nalus, unit.data)
+	}
+
+	keyframe := h265.IsKeyframe(nalus)
+	if d.waitKeyframe {
+		if !keyframe {
+			return nil
+		}
+		d.waitKeyframe = false
+	}
+
+	// IRAP前补全参数集，方便直接解码或录制
+	if keyframe && d.vps != nil && d.sps != nil && d.pps != nil &&
+		(!has[h265.NALUTypeVPS] || !has[h265.NALUTypeSPS] || !has[h265.NALUTypePPS]) {
+		head := make([][]byte, 0, len(nalus)+3)
+		if h265.Type(nalus[0]) == h265.NALUTypeAUD {
+			head = append(head, nalus[0])
+			nalus = nalus[1:]
+		}
+		for _, ps := range [][]byte{d.vps, d.sps, d.pps} {
+			if !has[h265.Type(ps)] {
+				head = append(head, ps)
+			}
+		}
+		nalus = append(head, nalus...)
+	}
+
+	return &AccessUnit{
+		Timestamp: d.timestamp,
+		PTS:       timestampToDuration(d.ts.extend(d.timestamp), d.clockRate),
+		Keyframe:  keyframe,
+		NALUs:     nalus,
+	}
+}
@@ -0,0 +1,145 @@
+package rtsp
+
+import (
+	"testing"
+)
+
+func TestH265Depacketizer(t *testing.T) {
+	vps := []byte{0x40, 0x01, 0x0c}
+	sps := []byte{0x42, 0x01, 0x01}
+	pps := []byte{0x44, 0x01, 0xc1}
+	idrA := []byte{0x26, 0x01, 0xaa}
+	idrB := []byte{0x26, 0x01, 0xbb}
+	trail := []byte{0x02, 0x01, 0xd0}
+	donl := &SDPInfo{MaxDonDiff: 1}
+
+	tests := []struct {
+		name    string
+		info    *SDPInfo
+		packets []*RTPInfo
+		want    []*AccessUnit
+	}{
+		{
+			name: "single nalu",
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, vps),
+				testRTP(2, 0, false, sps),
+				testRTP(3, 0, false, pps),
+				testRTP(4, 0, true, idrA),
+				testRTP(5, 9000, true, trail),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{vps, sps, pps, idrA}},
+				{Timestamp: 9000, PTS: 100000000, NALUs: [][]byte{trail}},
+			},
+		},
+		{
+			name: "parameter sets from sdp",
+			info: &SDPInfo{ParameterSets: [][]byte{vps, sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, idrA),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{vps, sps, pps, idrA}},
+			},
+		},
+		{
+			name: "donl reorders nalus",
+			info: donl,
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, []byte{0x26, 0x01, 0x00, 0x02, 0xbb}),
+				testRTP(2, 0, true, []byte{0x26, 0x01, 0x00, 0x01, 0xaa}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{idrA, idrB}},
+			},
+		},
+		{
+			name: "ap with donl",
+			info: donl,
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, []byte{0x60, 0x01, 0x00, 0x05, 0, 3, 0x40, 0x01, 0x0c, 0, 0, 3, 0x42, 0x01, 0x01, 0, 0, 3, 0x44, 0x01, 0xc1}),
+				testRTP(2, 0, true, []byte{0x26, 0x01, 0x00, 0x08, 0xaa}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{vps, sps, pps, idrA}},
+			},
+		},
+		{
+			name: "fu with donl",
+			info: &SDPInfo{MaxDonDiff: 1, ParameterSets: [][]byte{vps, sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, false, []byte{0x62, 0x01, 0x93, 0x00, 0x01, 0xaa}),
+				testRTP(2, 0, false, []byte{0x62, 0x01, 0x13, 0xbb}),
+				testRTP(3, 0, true, []byte{0x62, 0x01, 0x53, 0xcc}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{vps, sps, pps, {0x26, 0x01, 0xaa, 0xbb, 0xcc}}},
+			},
+		},
+		{
+			name: "paci",
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, []byte{0x64, 0x01, 0x26, 0x00, 0xaa}),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{idrA}},
+			},
+		},
+		{
+			name: "loss discards until irap",
+			info: &SDPInfo{ParameterSets: [][]byte{vps, sps, pps}},
+			packets: []*RTPInfo{
+				testRTP(1, 0, true, idrA),
+				testRTP(3, 3000, true, trail),
+				testRTP(4, 6000, true, trail),
+				testRTP(5, 9000, true, idrB),
+			},
+			want: []*AccessUnit{
+				{Keyframe: true, NALUs: [][]byte{vps, sps, pps, idrA}},
+				{Timestamp: 9000, PTS: 100000000, Keyframe: true, NALUs: [][]byte{vps, sps, pps, idrB}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewH265Depacketizer(tt.info)
+			aus := decodeAll(t, d, tt.packets)
+			if len(aus) != len(tt.want) {
+				t.Fatalf("got %d access units, want %d", len(aus), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := aus[i]
+				if got.Timestamp != want.Timestamp || got.PTS != want.PTS || got.Keyframe != want.Keyframe {
+					t.Errorf("au %d: got ts=%d pts=%v key=%v, want ts=%d pts=%v key=%v", i,
+						got.Timestamp, got.PTS, got.Keyframe, want.Timestamp, want.PTS, want.Keyframe)
+				}
+				if !equalNALUs(got.NALUs, want.NALUs) {
+					t.Errorf("au %d: got nalus %x, want %x", i, got.NALUs, want.NALUs)
+				}
+			}
+		})
+	}
+}
+
+func TestH265DepacketizerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *SDPInfo
+		payload []byte
+	}{
+		{"too short", nil, []byte{0x26}},
+		{"ap invalid size", nil, []byte{0x60, 0x01, 0, 9, 0x26, 0x01}},
+		{"fu too short", nil, []byte{0x62, 0x01}},
+		{"fu donl truncated", &SDPInfo{MaxDonDiff: 1}, []byte{0x62, 0x01, 0x93, 0x00}},
+		{"nested paci", nil, []byte{0x64, 0x01, 0x64, 0x00, 0xaa}},
+		{"unsupported type", nil, []byte{0x66, 0x01, 0xaa}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewH265Depacketizer(tt.info).Decode(testRTP(1, 0, true, tt.payload)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/h265"
+)
+
+// H265Packetizer h265 rtp打包器(RFC 7798)
+// 超过MTU的NALU使用FU分片，可选将VPS/SPS/PPS聚合为AP，不携带DONL
+type H265Packetizer struct {
+	*rtpPacker
+}
+
+// NewH265Packetizer 创建h265打包器
+func NewH265Packetizer(options PacketizerOptions) *H265Packetizer {
+	return &H265Packetizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_VIDEO, 96, 90000, options),
+	}
+}
+
+// Packetize 封装一个访问单元
+func (p *H265Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.packetize(au.NALUs, au.PTS)
+}
+
+// PacketizeFrame 封装一帧Annex-B或AVCC格式的数据
+func (p *H265Packetizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	nalus, err := splitFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+	return p.packetize(nalus, pts)
+}
+
+func (p *H265Packetizer) packetize(nalus [][]byte, pts time.Duration) ([]*RTPPack, error) {
+	maxSize := p.maxPayloadSize()
+	var payloads [][]byte
+	for i := 0; i < len(nalus); {
+		nalu := nalus[i]
+		if len(nalu) < 2 {
+			i++
+			continue
+		}
+
+		if p.options.AggregateParameterSets && h265.Type(nalu).IsParameterSet() {
+			j, size := i, 2
+			for j < len(nalus) && len(nalus[j]) >= 2 && h265.Type(nalus[j]).IsParameterSet() &&
+				size+2+len(nalus[j]) <= maxSize {
+				size += 2 + len(nalus[j])
+				j++
+			}
+			if j-i >= 2 {
+				payloads = append(payloads, h265AP(nalus[i:j], size))
+				i = j
+				continue
+			}
+		}
+
+		if len(nalu) <= maxSize {
+			payloads = append(payloads, nalu)
+		} else {
+			payloads = append(payloads, h265FU(nalu, maxSize)...)
+		}
+		i++
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("h265 access unit is empty")
+	}
+
+	ts := p.rtpTimestamp(pts)
+	packs := make([]*RTPPack, 0, len(payloads))
+	for i, payload := range payloads {
+		packs = append(packs, p.pack(payload, ts, i == len(payloads)-1))
+	}
+	return packs, nil
+}
+
+// h265AP 将多个NALU聚合为AP负载
+// payload header 的F位取或，LayerId和TID取最小值
+func h265AP(nalus [][]byte, size int) []byte {
+	var forbidden byte
+	layerID, tid := byte(0x3F), byte(0x07)
+	for _, nalu := range nalus {
+		forbidden |= nalu[0] & 0x80
+		if l := (nalu[0]&0x01)<<5 | nalu[1]>>3; l < layerID {
+			layerID = l
+		}
+		if t := nalu[1] & 0x07; t < tid {
+			tid = t
+		}
+	}
+
+	payload := make([]byte, 2, size)
+	payload[0] = forbidden | byte(h265.NALUTypeAP)<<1 | layerID>>5
+	payload[1] = layerID<<3 | tid
+	for _, nalu := range nalus {
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	return payload
+}
+
+// h265FU 将NALU拆分为FU负载
+func h265FU(nalu []byte, maxSize int) [][]byte {
+	header0 := nalu[0]&0x81 | byte(h265.NALUTypeFU)<<1
+	header1 := nalu[1]
+	fuType := byte(h265.Type(nalu))
+	data := nalu[2:]
+	chunk := maxSize - 3
+
+	var payloads [][]byte
+	for start := true; len(data) > 0; start = false {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		fuHeader := fuType
+		if start {
+			fuHeader |= 0x80
+		}
+		if n == len(data) {
+			fuHeader |= 0x40
+		}
+		payload := make([]byte, 0, 3+n)
+		payload = append(payload, header0, header1, fuHeader)
+		payload = append(payload, data[:n]...)
+		payloads = append(payloads, payload)
+		data = data[n:]
+	}
+	return payloads
+}
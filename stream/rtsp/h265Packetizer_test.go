@@ -0,0 +1,69 @@
+package rtsp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestH265PacketizerRoundTrip(t *testing.T) {
+	vps := []byte{0x40, 0x01, 0x0c, 0x01, 0xff}
+	sps := []byte{0x42, 0x01, 0x01, 0x01, 0x60}
+	pps := []byte{0x44, 0x01, 0xc1, 0x72, 0xb4}
+
+	tests := []struct {
+		name      string
+		mtu       int
+		aggregate bool
+		aus       [][][]byte
+		packets   []int
+	}{
+		{
+			name:    "single nalu",
+			aus:     [][][]byte{{vps, sps, pps, testNALU([]byte{0x26, 0x01}, 500)}, {testNALU([]byte{0x02, 0x01}, 100)}},
+			packets: []int{4, 1},
+		},
+		{
+			name:      "ap",
+			aggregate: true,
+			aus:       [][][]byte{{vps, sps, pps, testNALU([]byte{0x26, 0x01}, 500)}},
+			packets:   []int{2},
+		},
+		{
+			name:      "fu",
+			mtu:       100,
+			aggregate: true,
+			aus:       [][][]byte{{vps, sps, pps, testNALU([]byte{0x26, 0x01}, 1000)}, {testNALU([]byte{0x02, 0x01}, 89)}},
+			packets:   []int{13, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq := uint16(0xFFFF)
+			p := NewH265Packetizer(PacketizerOptions{MTU: tt.mtu, AggregateParameterSets: tt.aggregate, InitialSequenceNumber: &seq})
+			d := NewH265Depacketizer(nil)
+			for i, nalus := range tt.aus {
+				pts := time.Duration(i) * 40 * time.Millisecond
+				packs, err := p.Packetize(&AccessUnit{PTS: pts, NALUs: nalus})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(packs) != tt.packets[i] {
+					t.Fatalf("au %d: got %d packets, want %d", i, len(packs), tt.packets[i])
+				}
+				infos := parsePacks(t, packs)
+				for j, info := range infos {
+					if info.Marker != (j == len(infos)-1) {
+						t.Errorf("au %d packet %d: marker %v", i, j, info.Marker)
+					}
+					if tt.mtu > 0 && len(packs[j].Buffer.Bytes()) > tt.mtu {
+						t.Errorf("au %d packet %d: %d bytes exceeds mtu", i, j, len(packs[j].Buffer.Bytes()))
+					}
+				}
+				aus := decodeAll(t, d, infos)
+				if len(aus) != 1 || !equalNALUs(aus[0].NALUs, nalus) || aus[0].PTS != pts || aus[0].Keyframe != (i == 0) {
+					t.Fatalf("au %d: round trip mismatch", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,551 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/fmp4"
+	"github.com/mrHChen/goutils/stream/mpegts"
+)
+
+// hlsQueueSize 封装队列的长度，跟不上时丢包，之后从下一个关键帧恢复
+const hlsQueueSize = 1024
+
+// ts中的PID和时间戳偏移
+const (
+	hlsVideoPID = 0x100
+	hlsAudioPID = 0x101
+	// hlsTSOffset ts的时间戳从1秒开始，PCR提前于DTS时不为负
+	hlsTSOffset = 90000
+)
+
+// HLSVariant HLS的分段格式
+type HLSVariant string
+
+const (
+	HLS_VARIANT_MPEGTS HLSVariant = "mpegts"
+	HLS_VARIANT_FMP4   HLSVariant = "fmp4"
+)
+
+// HLSOptions HLS输出参数
+type HLSOptions struct {
+	// Variant 分段格式，默认为mpegts，mpegts不支持opus
+	Variant HLSVariant
+	// SegmentDuration 分段时长，达到后在下一个关键帧处开始新的分段，默认为2秒
+	SegmentDuration time.Duration
+	// SegmentCount 播放列表中的分段数，默认为7
+	SegmentCount int
+	// IdleTimeout 超过该时长没有http请求时关闭封装，默认为30秒
+	IdleTimeout time.Duration
+	// WaitTimeout 请求播放列表时等待第一个分段的时长，默认为10秒
+	WaitTimeout time.Duration
+	// LowLatency 低延迟HLS，输出部分分段并支持阻塞的播放列表请求和增量更新，只支持fmp4
+	LowLatency bool
+	// PartDuration 低延迟时部分分段的时长，默认为200毫秒
+	PartDuration time.Duration
+}
+
+// hlsMuxer 一路推流的HLS封装，在第一个http请求时创建，空闲时关闭
+type hlsMuxer struct {
+	path    string
+	pusher  *Pusher
+	options HLSOptions
+	reader  *FrameReader
+
+	queue       chan *RTPPack
+	done        chan struct{}
+	unsubscribe func()
+
+	// 以下字段由lock保护
+	lock       sync.Mutex
+	cond       *sync.Cond
+	closed     bool
+	lastAccess time.Time
+	// 播放列表中的分段
+	segments []*hlsSegment
+	// discontinuitySequence 移出播放列表的不连续点的个数
+	discontinuitySequence int
+	// targetDuration 由分段时长确定，第一个分段超出时在发布播放列表前取整一次，之后不再变化
+	targetDuration int
+	// codecs 主播放列表中的CODECS
+	codecs []string
+	// partial 低延迟时正在生成的分段，其中的部分分段可以请求
+	partial *hlsSegment
+
+	// 以下字段只在封装协程中访问
+	current    *hlsSegment
+	nextNumber int
+	config     string
+	init       *hlsInit
+	nextInitID int
+	ts         *mpegts.Writer
+	aacConfig  *aac.Config
+	tracks     map[RTPType]*hlsTrack
+	// 参考媒体最后一帧的DTS和帧间隔，没有下一帧时估计分段的结束时间
+	lastDTS      time.Duration
+	lastInterval time.Duration
+	// fmp4分片的序号
+	fragmentSequence uint32
+	// 当前部分分段的开始时间，是否从关键帧开始
+	partStart       time.Duration
+	partIndependent bool
+}
+
+// hlsTrack fmp4中的一路媒体
+type hlsTrack struct {
+	timeScale int
+	buffer    *fmp4.TrackBuffer
+}
+
+// hlsInit fmp4的初始化段
+type hlsInit struct {
+	name string
+	data []byte
+}
+
+// hlsSegment 一个分段，完成后内容不再变化
+type hlsSegment struct {
+	number          int
+	name            string
+	init            *hlsInit
+	discontinuity   bool
+	programDateTime time.Time
+	// start 第一帧在时间轴上的DTS
+	start    time.Duration
+	duration time.Duration
+	buf      bytes.Buffer
+	// parts 低延迟时的部分分段
+	parts []*hlsPart
+}
+
+// hlsPart 低延迟HLS的部分分段，为一个fmp4分片
+type hlsPart struct {
+	name        string
+	duration    time.Duration
+	independent bool
+	data        []byte
+}
+
+// newHLSMuxer 创建封装并订阅推流
+func newHLSMuxer(pusher *Pusher, options HLSOptions) *hlsMuxer {
+	if options.Variant == "" {
+		options.Variant = HLS_VARIANT_MPEGTS
+	}
+	if options.LowLatency {
+		options.Variant = HLS_VARIANT_FMP4
+	}
+	if options.PartDuration <= 0 {
+		options.PartDuration = 200 * time.Millisecond
+	}
+	if options.SegmentDuration <= 0 {
+		options.SegmentDuration = 2 * time.Second
+	}
+	if options.SegmentCount <= 0 {
+		options.SegmentCount = 7
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = 30 * time.Second
+	}
+	if options.WaitTimeout <= 0 {
+		options.WaitTimeout = 10 * time.Second
+	}
+	m := &hlsMuxer{
+		path:           pusher.Path(),
+		pusher:         pusher,
+		options:        options,
+		reader:         NewPusherFrameReader(pusher),
+		queue:          make(chan *RTPPack, hlsQueueSize),
+		done:           make(chan struct{}),
+		lastAccess:     time.Now(),
+		targetDuration: int(math.Ceil(options.SegmentDuration.Seconds())),
+		nextInitID:     1,
+	}
+	m.cond = sync.NewCond(&m.lock)
+	go m.run()
+	m.unsubscribe = pusher.Subscribe(m.writeRTP)
+	log.Println(fmt.Sprintf("hls muxer[%s] start, variant[%s]", m.path, options.Variant))
+	return m
+}
+
+// writeRTP 写入一个包，不阻塞，队列满时丢弃
+func (m *hlsMuxer) writeRTP(pack *RTPPack) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.queue <- pack:
+	default:
+	}
+}
+
+// close 取消订阅并结束封装
+func (m *hlsMuxer) close() {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.queue)
+	m.cond.Broadcast()
+	m.lock.Unlock()
+	m.unsubscribe()
+	<-m.done
+	log.Println(fmt.Sprintf("hls muxer[%s] closed", m.path))
+}
+
+func (m *hlsMuxer) source() *Pusher {
+	return m.pusher
+}
+
+// idle 超过空闲时长没有请求或已经关闭
+func (m *hlsMuxer) idle(now time.Time) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.closed || now.Sub(m.lastAccess) > m.options.IdleTimeout
+}
+
+func (m *hlsMuxer) run() {
+	defer close(m.done)
+	for pack := range m.queue {
+		for _, frame := range m.reader.ReadRTP(pack) {
+			m.writeFrame(frame)
+		}
+	}
+}
+
+// reference 决定分段的媒体，有视频时为视频
+func (m *hlsMuxer) reference() RTPType {
+	if m.reader.Codec(RTP_TYPE_VIDEO) != "" {
+		return RTP_TYPE_VIDEO
+	}
+	return RTP_TYPE_AUDIO
+}
+
+// writeFrame 写入一帧，参考媒体的关键帧处开始新的分段
+func (m *hlsMuxer) writeFrame(frame *Frame) {
+	isRef := frame.Type == m.reference()
+	if isRef && frame.Keyframe {
+		config := m.reader.trackConfig()
+		changed := m.current != nil && config != m.config
+		if m.current == nil || frame.Discontinuity || changed || frame.DTS-m.current.start >= m.options.SegmentDuration {
+			discontinuity := m.current != nil && (frame.Discontinuity || changed)
+			m.finishSegment(frame, discontinuity)
+			if err := m.openSegment(frame, config, discontinuity); err != nil {
+				log.Println(fmt.Errorf("hls muxer[%s] open segment error:%s", m.path, err))
+				m.current = nil
+				return
+			}
+		}
+	}
+	seg := m.current
+	if seg == nil {
+		return
+	}
+
+	if m.options.LowLatency && isRef && frame.DTS > m.partStart && frame.DTS+m.lastInterval-m.partStart > m.options.PartDuration {
+		// 加入这一帧后超出部分分段的时长
+		m.flushPart(frame)
+	}
+	var err error
+	if m.options.Variant == HLS_VARIANT_FMP4 {
+		m.writeSample(frame)
+	} else {
+		err = m.writePES(frame)
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("hls muxer[%s] write frame error:%s", m.path, err))
+	}
+	if isRef && frame.DTS > m.lastDTS {
+		m.lastInterval = frame.DTS - m.lastDTS
+		m.lastDTS = frame.DTS
+	}
+}
+
+// openSegment 以参考媒体的关键帧开始新的分段，编码参数变化时重新创建轨道
+func (m *hlsMuxer) openSegment(frame *Frame, config string, discontinuity bool) error {
+	if config != m.config || m.tracks == nil && m.ts == nil {
+		var (
+			codecs []string
+			err    error
+		)
+		if m.options.Variant == HLS_VARIANT_FMP4 {
+			codecs, err = m.openFMP4Tracks(frame.Type)
+		} else {
+			codecs, err = m.openTSTracks(frame.Type)
+		}
+		if err != nil {
+			m.config = ""
+			m.tracks, m.ts = nil, nil
+			return err
+		}
+		m.config = config
+		m.lock.Lock()
+		m.codecs = codecs
+		m.lock.Unlock()
+	}
+
+	seg := &hlsSegment{
+		number:          m.nextNumber,
+		init:            m.init,
+		discontinuity:   discontinuity,
+		programDateTime: frame.CaptureTime,
+		start:           frame.DTS,
+	}
+	if seg.programDateTime.IsZero() {
+		seg.programDateTime = time.Now()
+	}
+	m.nextNumber++
+	m.lastDTS, m.lastInterval = frame.DTS, 0
+	m.partStart, m.partIndependent = frame.DTS, true
+	if m.options.Variant == HLS_VARIANT_FMP4 {
+		seg.name = fmt.Sprintf("seg%d.m4s", seg.number)
+	} else {
+		seg.name = fmt.Sprintf("seg%d.ts", seg.number)
+		m.ts.SetWriter(&seg.buf)
+		if err := m.ts.WriteTables(); err != nil {
+			return err
+		}
+	}
+	m.current = seg
+	m.lock.Lock()
+	m.partial = seg
+	m.lock.Unlock()
+	return nil
+}
+
+// openTSTracks 按当前的编码参数创建ts的节目，返回各路媒体的CODECS，参考媒体不支持时返回错误
+func (m *hlsMuxer) openTSTracks(ref RTPType) ([]string, error) {
+	var (
+		tracks []*mpegts.Track
+		codecs []string
+	)
+	m.aacConfig = nil
+	for _, t := range m.reader.Tracks() {
+		var track *mpegts.Track
+		switch codecName := m.reader.Codec(t); codecName {
+		case "h264":
+			track = &mpegts.Track{PID: hlsVideoPID, StreamType: mpegts.StreamTypeH264}
+		case "h265":
+			track = &mpegts.Track{PID: hlsVideoPID, StreamType: mpegts.StreamTypeH265}
+		case "aac", "mp4a-latm":
+			if config, err := aac.ParseConfig(m.reader.AACConfig()); err == nil {
+				m.aacConfig = config
+				track = &mpegts.Track{PID: hlsAudioPID, StreamType: mpegts.StreamTypeAAC}
+			}
+		}
+		c, err := m.reader.FMP4Codec(t)
+		if track == nil || err != nil {
+			if t == ref {
+				return nil, fmt.Errorf("%v codec[%s] not supported by mpegts", t, m.reader.Codec(t))
+			}
+			continue
+		}
+		tracks = append(tracks, track)
+		codecs = append(codecs, c.CodecString())
+	}
+	m.ts = mpegts.NewWriter(nil, tracks)
+	return codecs, nil
+}
+
+// openFMP4Tracks 按当前的编码参数创建初始化段，返回各路媒体的CODECS
+func (m *hlsMuxer) openFMP4Tracks(ref RTPType) ([]string, error) {
+	var codecs []string
+	init := &fmp4.Init{}
+	tracks := make(map[RTPType]*hlsTrack)
+	for _, t := range m.reader.Tracks() {
+		codec, err := m.reader.FMP4Codec(t)
+		if err != nil {
+			if t == ref {
+				return nil, err
+			}
+			continue
+		}
+		codecs = append(codecs, codec.CodecString())
+		id := len(init.Tracks) + 1
+		track := &hlsTrack{timeScale: m.reader.ClockRate(t), buffer: fmp4.NewTrackBuffer(id)}
+		tracks[t] = track
+		init.Tracks = append(init.Tracks, &fmp4.Track{ID: id, TimeScale: uint32(track.timeScale), Codec: codec})
+	}
+	b, err := init.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m.tracks = tracks
+	m.init = &hlsInit{name: fmt.Sprintf("init%d.mp4", m.nextInitID), data: b}
+	m.nextInitID++
+	return codecs, nil
+}
+
+// writePES 将一帧写为ts的PES，视频关键帧前加入参数集
+func (m *hlsMuxer) writePES(frame *Frame) error {
+	pts := rtpTicks(frame.PTS, 90000) + hlsTSOffset
+	dts := rtpTicks(frame.DTS, 90000) + hlsTSOffset
+	if pts < dts {
+		pts = dts
+	}
+	if frame.Type == RTP_TYPE_VIDEO {
+		return m.ts.WritePES(hlsVideoPID, pts, dts, frame.Keyframe, m.annexB(frame))
+	}
+	if m.aacConfig == nil {
+		return nil
+	}
+	return m.ts.WritePES(hlsAudioPID, pts, dts, true, m.aacConfig.ADTS(frame.Data))
+}
+
+// annexB 视频帧转为带AUD的Annex-B格式，关键帧前为当前的参数集
+func (m *hlsMuxer) annexB(frame *Frame) []byte {
+	h265 := m.reader.Codec(RTP_TYPE_VIDEO) == "h265"
+	nalus := make([][]byte, 0, len(frame.NALUs)+4)
+	if h265 {
+		nalus = append(nalus, []byte{0x46, 0x01, 0x50})
+	} else {
+		nalus = append(nalus, []byte{0x09, 0xF0})
+	}
+	if frame.Keyframe {
+		nalus = append(nalus, m.reader.ParameterSets()...)
+	}
+	for _, nalu := range frame.NALUs {
+		if len(nalu) == 0 {
+			continue
+		}
+		var aud, paramSet bool
+		if h265 {
+			typ := nalu[0] >> 1 & 0x3F
+			aud, paramSet = typ == 35, typ >= 32 && typ <= 34
+		} else {
+			typ := nalu[0] & 0x1F
+			aud, paramSet = typ == 9, typ == 7 || typ == 8
+		}
+		if aud || frame.Keyframe && paramSet {
+			continue
+		}
+		nalus = append(nalus, nalu)
+	}
+	return codec.JoinAnnexB(nalus)
+}
+
+// writeSample 将一帧加入fmp4的样本缓存
+func (m *hlsMuxer) writeSample(frame *Frame) {
+	track := m.tracks[frame.Type]
+	if track == nil {
+		return
+	}
+	dts := rtpTicks(frame.DTS, track.timeScale)
+	sample := &fmp4.Sample{PTSOffset: int32(rtpTicks(frame.PTS, track.timeScale) - dts)}
+	if frame.Type == RTP_TYPE_VIDEO {
+		sample.IsNonSyncSample = !frame.Keyframe
+		sample.Payload = codec.JoinAVCC(frame.NALUs)
+	} else {
+		sample.Payload = frame.Data
+	}
+	track.buffer.Push(dts, sample)
+}
+
+// takeFragment 取出各路媒体已确定时长的样本写为一个分片，没有样本时返回nil
+// next 为下一个分片的第一帧，参考媒体的最后一帧延续到该帧，close 为true时各路媒体的最后一帧沿用上一帧的时长
+func (m *hlsMuxer) takeFragment(next *Frame, close bool) []byte {
+	fragment := &fmp4.Fragment{SequenceNumber: m.fragmentSequence + 1}
+	for _, t := range []RTPType{RTP_TYPE_VIDEO, RTP_TYPE_AUDIO} {
+		track := m.tracks[t]
+		if track == nil {
+			continue
+		}
+		if close {
+			track.buffer.Close()
+		} else if next != nil && t == next.Type {
+			track.buffer.End(rtpTicks(next.DTS, track.timeScale))
+		}
+		if tf := track.buffer.Fragment(); tf != nil {
+			fragment.Tracks = append(fragment.Tracks, tf)
+		}
+	}
+	if len(fragment.Tracks) == 0 {
+		return nil
+	}
+	m.fragmentSequence++
+	return fragment.Marshal()
+}
+
+// flushPart 在参考媒体的一帧之前结束当前的部分分段
+func (m *hlsMuxer) flushPart(next *Frame) {
+	m.addPart(m.takeFragment(next, false), next.DTS-m.partStart)
+	m.partStart, m.partIndependent = next.DTS, next.Keyframe
+}
+
+// addPart 当前分段加入一个部分分段并通知等待的请求
+func (m *hlsMuxer) addPart(data []byte, duration time.Duration) {
+	seg := m.current
+	if data == nil || duration <= 0 {
+		return
+	}
+	m.lock.Lock()
+	seg.parts = append(seg.parts, &hlsPart{
+		name:        fmt.Sprintf("part%d_%d.m4s", seg.number, len(seg.parts)),
+		duration:    duration,
+		independent: m.partIndependent,
+		data:        data,
+	})
+	m.cond.Broadcast()
+	m.lock.Unlock()
+}
+
+// finishSegment 完成当前分段并加入播放列表，next 为下一个分段的第一帧
+// discontinuity 为true时各路媒体最后一帧的时长沿用上一帧，否则参考媒体延续到下一帧
+func (m *hlsMuxer) finishSegment(next *Frame, discontinuity bool) {
+	seg := m.current
+	if seg == nil {
+		return
+	}
+	end := m.lastDTS + m.lastInterval
+	if next != nil && !discontinuity {
+		end = next.DTS
+	}
+	seg.duration = end - seg.start
+
+	if m.options.Variant == HLS_VARIANT_FMP4 {
+		data := m.takeFragment(next, next == nil || discontinuity)
+		if m.options.LowLatency {
+			// 分段由各部分分段拼接而成
+			m.addPart(data, end-m.partStart)
+			for _, part := range seg.parts {
+				seg.buf.Write(part.data)
+			}
+		} else {
+			seg.buf.Write(data)
+		}
+	}
+	m.current = nil
+
+	m.lock.Lock()
+	m.partial = nil
+	if seg.duration > 0 && seg.buf.Len() > 0 {
+		if len(m.segments) == 0 {
+			// 第一个分段为整个关键帧间隔，超出时在发布播放列表前取整目标时长
+			if d := int(math.Ceil(seg.duration.Seconds())); d > m.targetDuration {
+				m.targetDuration = d
+			}
+		} else if d := int(math.Round(seg.duration.Seconds())); d > m.targetDuration {
+			// 分段都从关键帧开始，不在gop中间切分，目标时长发布后也不能改变
+			log.Println(fmt.Sprintf("hls muxer[%s] %s duration %v exceeds target duration %ds, keyframe interval too long",
+				m.path, seg.name, seg.duration, m.targetDuration))
+		}
+		m.segments = append(m.segments, seg)
+		for len(m.segments) > m.options.SegmentCount {
+			if m.segments[1].discontinuity {
+				m.discontinuitySequence++
+			}
+			m.segments = m.segments[1:]
+		}
+	}
+	m.cond.Broadcast()
+	m.lock.Unlock()
+}
@@ -0,0 +1,269 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// publish 输入n帧
+func (s *testVideoSource) publish(t *testing.T, pusher *Pusher, n int) {
+	t.Helper()
+	for end := s.next + n; s.next < end; s.next++ {
+		nalus := [][]byte{testNALU([]byte{0x41, 0x9A}, 200)}
+		if s.next%s.gop == 0 {
+			nalus = [][]byte{s.sps, s.pps, testNALU([]byte{0x65, 0x88}, 1000)}
+		}
+		packs, err := s.packetizer.Packetize(&AccessUnit{PTS: time.Duration(s.next) * 40 * time.Millisecond, NALUs: nalus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range packs {
+			pack.Type = RTP_TYPE_VIDEO
+			pusher.publish(pack)
+		}
+	}
+}
+
+// waitSegments 等待封装完成n个分段
+func waitSegments(t *testing.T, m *hlsMuxer, n int) {
+	t.Helper()
+	if !m.wait(2*time.Second, func() bool { return len(m.segments) >= n }) {
+		t.Fatalf("segments %d, want %d", len(m.segments), n)
+	}
+}
+
+// serveMuxer 请求封装中的文件
+func serveMuxer(serve func(http.ResponseWriter, *http.Request, string), target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	serve(w, r, name)
+	return w
+}
+
+func TestHLSMuxerMPEGTS(t *testing.T) {
+	source, sdp := newTestVideoSource(25)
+	pusher := newTestPusher(sdp)
+	m := newHLSMuxer(pusher, HLSOptions{SegmentDuration: time.Second, SegmentCount: 2})
+	defer m.close()
+	source.publish(t, pusher, 100)
+	waitSegments(t, m, 2)
+	m.wait(2*time.Second, func() bool { return m.segments[0].number == 1 })
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		typ    string
+		body   []string
+	}{
+		{"multivariant", "/live/cam/index.m3u8", http.StatusOK, "application/vnd.apple.mpegurl",
+			[]string{"#EXT-X-VERSION:3\n", "#EXT-X-STREAM-INF:BANDWIDTH=", ",CODECS=\"avc1.42C01F\"\nstream.m3u8\n"}},
+		// 滑动窗口只保留最后两个分段
+		{"media", "/live/cam/stream.m3u8", http.StatusOK, "application/vnd.apple.mpegurl",
+			[]string{"#EXT-X-TARGETDURATION:1\n", "#EXT-X-MEDIA-SEQUENCE:1\n", "#EXTINF:1.000,\nseg1.ts\n#EXT-X-PROGRAM-DATE-TIME:", "#EXTINF:1.000,\nseg2.ts\n"}},
+		// 非低延迟时忽略阻塞参数
+		{"media ignores msn", "/live/cam/stream.m3u8?_HLS_msn=100", http.StatusOK, "application/vnd.apple.mpegurl", []string{"seg2.ts"}},
+		{"segment", "/live/cam/seg2.ts", http.StatusOK, "video/mp2t", nil},
+		{"removed segment", "/live/cam/seg0.ts", http.StatusNotFound, "", nil},
+		// 非低延迟时没有部分分段，预加载提示的名称也不阻塞
+		{"part", "/live/cam/part3_0.m4s", http.StatusNotFound, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveMuxer(m.serve, tt.target)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.typ != "" && w.Header().Get("Content-Type") != tt.typ {
+				t.Errorf("content type %s", w.Header().Get("Content-Type"))
+			}
+			for _, s := range tt.body {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("body missing %q:\n%s", s, w.Body.String())
+				}
+			}
+		})
+	}
+	if strings.Contains(m.mediaPlaylist(false), "#EXT-X-PART") {
+		t.Errorf("parts without low latency")
+	}
+
+	// 分段以PAT、PMT开始，视频PES带随机访问点
+	data := m.findSegment("seg2.ts").buf.Bytes()
+	if len(data)%188 != 0 || data[0] != 0x47 || data[1]&0x1F != 0 || data[2] != 0 || data[188+1]&0x1F != 0x10 {
+		t.Fatalf("segment header %x", data[:4])
+	}
+	video := data[2*188:]
+	if pid := uint16(video[1]&0x1F)<<8 | uint16(video[2]); pid != hlsVideoPID || video[1]&0x40 == 0 || video[3]&0x20 == 0 || video[5]&0x40 == 0 {
+		t.Errorf("first video packet %x", video[:6])
+	}
+}
+
+// TestHLSMuxerTargetDuration 目标时长在发布播放列表前按第一个gop取整，之后不变，更长的gop也不在中间切分
+func TestHLSMuxerTargetDuration(t *testing.T) {
+	source, sdp := newTestVideoSource(50)
+	pusher := newTestPusher(sdp)
+	m := newHLSMuxer(pusher, HLSOptions{SegmentDuration: time.Second, SegmentCount: 10})
+	defer m.close()
+	source.publish(t, pusher, 100)
+	waitSegments(t, m, 1)
+	if playlist := m.mediaPlaylist(false); !strings.Contains(playlist, "#EXT-X-TARGETDURATION:2\n") || !strings.Contains(playlist, "#EXT-X-INDEPENDENT-SEGMENTS\n") {
+		t.Fatalf("first playlist:\n%s", playlist)
+	}
+
+	source.gop = 100
+	source.publish(t, pusher, 300)
+	waitSegments(t, m, 4)
+	playlist := m.mediaPlaylist(false)
+	if !strings.Contains(playlist, "#EXT-X-TARGETDURATION:2\n") || !strings.Contains(playlist, "#EXT-X-INDEPENDENT-SEGMENTS\n") {
+		t.Errorf("playlist:\n%s", playlist)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// 2秒的gop之后是4秒的gop，每个分段都是完整的gop
+	for i, seg := range m.segments {
+		want := 2 * time.Second
+		if seg.start >= 4*time.Second {
+			want = 4 * time.Second
+		}
+		if seg.start%want != 0 || seg.duration != want {
+			t.Errorf("segment %d start %v duration %v, want a whole gop of %v", i, seg.start, seg.duration, want)
+		}
+	}
+}
+
+func TestHLSMuxerLowLatency(t *testing.T) {
+	source, sdp := newTestVideoSource(25)
+	pusher := newTestPusher(sdp)
+	m := newHLSMuxer(pusher, HLSOptions{SegmentDuration: time.Second, SegmentCount: 10, LowLatency: true})
+	defer m.close()
+	source.publish(t, pusher, 56)
+	waitSegments(t, m, 2)
+	// 第三个分段已有部分分段 part2_0(200ms)，part2_1 还在生成
+	m.wait(2*time.Second, func() bool { return m.hasPart(2, 0) })
+
+	playlist := m.mediaPlaylist(false)
+	for _, s := range []string{
+		"#EXT-X-VERSION:9\n",
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=0.600,CAN-SKIP-UNTIL=6.000\n",
+		"#EXT-X-PART-INF:PART-TARGET=0.200\n",
+		"#EXT-X-MAP:URI=\"init1.mp4\"\n",
+		"#EXT-X-PART:DURATION=0.200,URI=\"part0_0.m4s\",INDEPENDENT=YES\n#EXT-X-PART:DURATION=0.200,URI=\"part0_1.m4s\"\n",
+		"#EXT-X-PART:DURATION=0.200,URI=\"part0_4.m4s\"\n#EXTINF:1.000,\nseg0.m4s\n",
+		"#EXT-X-PART:DURATION=0.200,URI=\"part2_0.m4s\",INDEPENDENT=YES\n#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part2_1.m4s\"\n",
+	} {
+		if !strings.Contains(playlist, s) {
+			t.Errorf("playlist missing %q:\n%s", s, playlist)
+		}
+	}
+	if strings.Count(playlist, "#EXT-X-MAP") != 1 {
+		t.Errorf("map repeated:\n%s", playlist)
+	}
+
+	// 分段由部分分段拼接而成
+	seg := m.findSegment("seg1.m4s")
+	var parts []byte
+	for i := 0; i < 5; i++ {
+		w := serveMuxer(m.serve, fmt.Sprintf("/live/cam/part1_%d.m4s", i))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "video/iso.segment" {
+			t.Fatalf("part %d status %d", i, w.Code)
+		}
+		parts = append(parts, w.Body.Bytes()...)
+	}
+	if !bytes.Equal(parts, seg.buf.Bytes()) {
+		t.Errorf("segment differs from its parts")
+	}
+	if w := serveMuxer(m.serve, "/live/cam/init1.mp4"); w.Code != http.StatusOK || !bytes.HasPrefix(w.Body.Bytes()[4:], []byte("ftyp")) {
+		t.Errorf("init status %d", w.Code)
+	}
+	if w := serveMuxer(m.serve, "/live/cam/init2.mp4"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown init status %d", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"part without msn", "/live/cam/stream.m3u8?_HLS_part=1", http.StatusBadRequest},
+		{"invalid msn", "/live/cam/stream.m3u8?_HLS_msn=x", http.StatusBadRequest},
+		{"negative part", "/live/cam/stream.m3u8?_HLS_msn=1&_HLS_part=-1", http.StatusBadRequest},
+		{"msn too far", "/live/cam/stream.m3u8?_HLS_msn=5", http.StatusBadRequest},
+		{"available", "/live/cam/stream.m3u8?_HLS_msn=2&_HLS_part=0", http.StatusOK},
+		{"not hinted part", "/live/cam/part9_0.m4s", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveMuxer(m.serve, tt.target); w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestHLSMuxerBlocking 阻塞的请求在部分分段生成后返回
+func TestHLSMuxerBlocking(t *testing.T) {
+	source, sdp := newTestVideoSource(25)
+	pusher := newTestPusher(sdp)
+	m := newHLSMuxer(pusher, HLSOptions{SegmentDuration: time.Second, LowLatency: true})
+	defer m.close()
+	source.publish(t, pusher, 30)
+	waitSegments(t, m, 1)
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"playlist", "/live/cam/stream.m3u8?_HLS_msn=1&_HLS_part=2", "URI=\"part1_2.m4s\""},
+		{"next segment", "/live/cam/stream.m3u8?_HLS_msn=2", "seg1.m4s"},
+		{"preload hint", "/live/cam/part3_0.m4s", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan *httptest.ResponseRecorder)
+			go func() {
+				done <- serveMuxer(m.serve, tt.target)
+			}()
+			select {
+			case <-done:
+				t.Fatal("request returned before the part was available")
+			case <-time.After(50 * time.Millisecond):
+			}
+			source.publish(t, pusher, 25)
+			select {
+			case w := <-done:
+				if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.want) {
+					t.Errorf("status %d body %s", w.Code, w.Body.String())
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("request still blocked")
+			}
+		})
+	}
+}
+
+func TestHLSMuxerSkip(t *testing.T) {
+	source, sdp := newTestVideoSource(25)
+	pusher := newTestPusher(sdp)
+	m := newHLSMuxer(pusher, HLSOptions{SegmentDuration: time.Second, SegmentCount: 10, LowLatency: true})
+	defer m.close()
+	source.publish(t, pusher, 250)
+	waitSegments(t, m, 9)
+
+	// 距末尾6秒以上的分段在增量更新中省略
+	full := serveMuxer(m.serve, "/live/cam/stream.m3u8").Body.String()
+	delta := serveMuxer(m.serve, "/live/cam/stream.m3u8?_HLS_skip=YES").Body.String()
+	if strings.Contains(full, "#EXT-X-SKIP") || !strings.Contains(full, "seg0.m4s") {
+		t.Errorf("full playlist:\n%s", full)
+	}
+	if !strings.Contains(delta, "#EXT-X-SKIP:SKIPPED-SEGMENTS=3\n") || strings.Contains(delta, "seg2.m4s") || !strings.Contains(delta, "seg3.m4s") {
+		t.Errorf("delta playlist:\n%s", delta)
+	}
+}
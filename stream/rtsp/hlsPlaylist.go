@@ -0,0 +1,333 @@
+package rtsp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wait 等待ready返回true，调用ready时持有lock，超时或已关闭时返回ready的结果
+func (m *hlsMuxer) wait(timeout time.Duration, ready func() bool) bool {
+	timer := time.AfterFunc(timeout, func() {
+		m.lock.Lock()
+		m.cond.Broadcast()
+		m.lock.Unlock()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(timeout)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for !ready() && !m.closed && time.Now().Before(deadline) {
+		m.cond.Wait()
+	}
+	return ready()
+}
+
+// waitSegment 等待第一个分段完成
+func (m *hlsMuxer) waitSegment() bool {
+	return m.wait(m.options.WaitTimeout, func() bool {
+		return len(m.segments) > 0
+	})
+}
+
+// blockTimeout 阻塞请求的最长等待时间，为3倍目标时长
+func (m *hlsMuxer) blockTimeout() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return 3 * time.Duration(m.targetDuration) * time.Second
+}
+
+// serve 响应播放列表、初始化段、分段和部分分段的请求，name 为路径中的文件名
+func (m *hlsMuxer) serve(w http.ResponseWriter, r *http.Request, name string) {
+	m.lock.Lock()
+	m.lastAccess = time.Now()
+	m.lock.Unlock()
+
+	switch {
+	case name == "index.m3u8":
+		if !m.waitSegment() {
+			http.Error(w, "stream not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte(m.multivariantPlaylist()))
+	case name == "stream.m3u8":
+		m.serveMediaPlaylist(w, r)
+	case strings.HasPrefix(name, "init") && strings.HasSuffix(name, ".mp4"):
+		init := m.findInit(name)
+		if init == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(init.data)
+	case m.options.LowLatency && strings.HasPrefix(name, "part"):
+		part := m.findPart(name, true)
+		if part == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "video/iso.segment")
+		w.Header().Set("Content-Length", strconv.Itoa(len(part.data)))
+		w.Write(part.data)
+	default:
+		seg := m.findSegment(name)
+		if seg == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if m.options.Variant == HLS_VARIANT_FMP4 {
+			w.Header().Set("Content-Type", "video/iso.segment")
+		} else {
+			w.Header().Set("Content-Type", "video/mp2t")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(seg.buf.Len()))
+		w.Write(seg.buf.Bytes())
+	}
+}
+
+// serveMediaPlaylist 媒体播放列表，低延迟时按 _HLS_msn _HLS_part 阻塞到指定的分段，_HLS_skip 返回增量更新
+func (m *hlsMuxer) serveMediaPlaylist(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	msn, part := -1, -1
+	if m.options.LowLatency {
+		var err error
+		if v := query.Get("_HLS_msn"); v != "" {
+			if msn, err = strconv.Atoi(v); err != nil || msn < 0 {
+				http.Error(w, "invalid _HLS_msn", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("_HLS_part"); v != "" {
+			if part, err = strconv.Atoi(v); err != nil || part < 0 || msn < 0 {
+				http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if !m.waitSegment() {
+		http.Error(w, "stream not ready", http.StatusServiceUnavailable)
+		return
+	}
+	if msn >= 0 {
+		m.lock.Lock()
+		last := m.segments[len(m.segments)-1].number
+		if m.partial != nil {
+			last = m.partial.number
+		}
+		m.lock.Unlock()
+		if msn > last+2 {
+			http.Error(w, "_HLS_msn is too far in the future", http.StatusBadRequest)
+			return
+		}
+		if !m.wait(m.blockTimeout(), func() bool { return m.hasPart(msn, part) }) {
+			http.Error(w, "playlist update timeout", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	skip := m.options.LowLatency && (query.Get("_HLS_skip") == "YES" || query.Get("_HLS_skip") == "v2")
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(m.mediaPlaylist(skip)))
+}
+
+// hasPart 播放列表中是否已有序号为msn的分段，part 不小于0时为该分段的部分分段，调用时持有lock
+func (m *hlsMuxer) hasPart(msn, part int) bool {
+	if n := len(m.segments); n > 0 && m.segments[n-1].number >= msn {
+		return true
+	}
+	if p := m.partial; p != nil {
+		return p.number > msn || p.number == msn && part >= 0 && len(p.parts) > part
+	}
+	return false
+}
+
+func (m *hlsMuxer) findInit(name string) *hlsInit {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, seg := range m.segments {
+		if seg.init != nil && seg.init.name == name {
+			return seg.init
+		}
+	}
+	if m.partial != nil && m.partial.init != nil && m.partial.init.name == name {
+		return m.partial.init
+	}
+	return nil
+}
+
+func (m *hlsMuxer) findSegment(name string) *hlsSegment {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, seg := range m.segments {
+		if seg.name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+// findPart 查找部分分段，block 为true时请求的是预加载提示的部分分段则等待其生成
+func (m *hlsMuxer) findPart(name string, block bool) *hlsPart {
+	var msn, index int
+	if _, err := fmt.Sscanf(name, "part%d_%d.m4s", &msn, &index); err != nil {
+		return nil
+	}
+	var found *hlsPart
+	lookup := func() bool {
+		found = nil
+		segs := m.segments
+		if m.partial != nil {
+			segs = append(segs[:len(segs):len(segs)], m.partial)
+		}
+		for _, seg := range segs {
+			if seg.number == msn && index < len(seg.parts) {
+				found = seg.parts[index]
+			}
+		}
+		return found != nil
+	}
+	m.lock.Lock()
+	hinted := false
+	if !lookup() {
+		next, nextIndex := m.nextPart()
+		hinted = msn == next && index == nextIndex
+	}
+	m.lock.Unlock()
+	if hinted && block {
+		m.wait(m.blockTimeout(), lookup)
+	}
+	return found
+}
+
+// nextPart 下一个部分分段的分段序号和在分段中的序号，调用时持有lock
+func (m *hlsMuxer) nextPart() (int, int) {
+	if m.partial != nil {
+		return m.partial.number, len(m.partial.parts)
+	}
+	if n := len(m.segments); n > 0 {
+		return m.segments[n-1].number + 1, 0
+	}
+	return 0, 0
+}
+
+// multivariantPlaylist 主播放列表，带宽为分段的最大码率
+func (m *hlsMuxer) multivariantPlaylist() string {
+	m.lock.Lock()
+	bandwidth := 0
+	for _, seg := range m.segments {
+		if bps := int(float64(seg.buf.Len()*8) / seg.duration.Seconds()); bps > bandwidth {
+			bandwidth = bps
+		}
+	}
+	codecs := m.codecs
+	m.lock.Unlock()
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:" + m.version() + "\n")
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	b.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", bandwidth))
+	if len(codecs) > 0 {
+		b.WriteString(fmt.Sprintf(",CODECS=\"%s\"", strings.Join(codecs, ",")))
+	}
+	b.WriteString("\nstream.m3u8\n")
+	return b.String()
+}
+
+// mediaPlaylist 滑动窗口的媒体播放列表，低延迟时距末尾3倍目标时长以内的分段带有部分分段
+// skip 为true时省略距末尾超过 CAN-SKIP-UNTIL 的分段
+func (m *hlsMuxer) mediaPlaylist(skip bool) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	target := time.Duration(m.targetDuration) * time.Second
+	skipUntil := 6 * target
+
+	// after[i] 第i个分段结束到播放列表末尾的时长
+	after := make([]time.Duration, len(m.segments))
+	var tail time.Duration
+	if m.partial != nil {
+		for _, part := range m.partial.parts {
+			tail += part.duration
+		}
+	}
+	for i := len(m.segments) - 1; i >= 0; i-- {
+		after[i] = tail
+		tail += m.segments[i].duration
+	}
+	skipped := 0
+	if skip {
+		for skipped < len(m.segments)-1 && after[skipped] >= skipUntil {
+			skipped++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:" + m.version() + "\n")
+	b.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", m.targetDuration))
+	if m.options.LowLatency {
+		b.WriteString(fmt.Sprintf("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f,CAN-SKIP-UNTIL=%.3f\n",
+			(3 * m.options.PartDuration).Seconds(), skipUntil.Seconds()))
+		b.WriteString(fmt.Sprintf("#EXT-X-PART-INF:PART-TARGET=%.3f\n", m.options.PartDuration.Seconds()))
+	}
+	b.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", m.segments[0].number))
+	b.WriteString(fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", m.discontinuitySequence))
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if skipped > 0 {
+		b.WriteString(fmt.Sprintf("#EXT-X-SKIP:SKIPPED-SEGMENTS=%d\n", skipped))
+	}
+
+	var init *hlsInit
+	writeHeader := func(seg *hlsSegment, first bool) {
+		if seg.discontinuity && !first {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if seg.init != nil && seg.init != init {
+			init = seg.init
+			b.WriteString(fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"\n", init.name))
+		}
+		b.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + seg.programDateTime.UTC().Format("2006-01-02T15:04:05.000Z") + "\n")
+	}
+	writeParts := func(seg *hlsSegment) {
+		for _, part := range seg.parts {
+			b.WriteString(fmt.Sprintf("#EXT-X-PART:DURATION=%.3f,URI=\"%s\"", part.duration.Seconds(), part.name))
+			if part.independent {
+				b.WriteString(",INDEPENDENT=YES")
+			}
+			b.WriteString("\n")
+		}
+	}
+	for i := skipped; i < len(m.segments); i++ {
+		seg := m.segments[i]
+		writeHeader(seg, i == 0)
+		if m.options.LowLatency && after[i] < 3*target {
+			writeParts(seg)
+		}
+		b.WriteString(fmt.Sprintf("#EXTINF:%.3f,\n", seg.duration.Seconds()))
+		b.WriteString(seg.name + "\n")
+	}
+	if m.options.LowLatency {
+		if m.partial != nil {
+			writeHeader(m.partial, false)
+			writeParts(m.partial)
+		}
+		msn, index := m.nextPart()
+		b.WriteString(fmt.Sprintf("#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part%d_%d.m4s\"\n", msn, index))
+	}
+	return b.String()
+}
+
+// version 播放列表的版本，fmp4需要EXT-X-MAP，增量更新需要版本9
+func (m *hlsMuxer) version() string {
+	if m.options.LowLatency {
+		return "9"
+	}
+	if m.options.Variant == HLS_VARIANT_FMP4 {
+		return "7"
+	}
+	return "3"
+}
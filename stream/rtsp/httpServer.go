@@ -0,0 +1,321 @@
+package rtsp
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/websocket"
+)
+
+// websocketWriteTimeout WebSocket写入一条消息的超时时间，超时后断开客户端
+const websocketWriteTimeout = 10 * time.Second
+
+// httpMuxer 一路推流按需创建的封装，空闲或推流结束时关闭
+type httpMuxer interface {
+	source() *Pusher
+	idle(now time.Time) bool
+	close()
+}
+
+// HTTPServer 通过http输出rtsp服务端的推流
+// HLS的路径为 /<推流路径>/index.m3u8，DASH的路径为 /<推流路径>/index.mpd
+// HTTP-FLV和WebSocket-FLV的路径为 /<推流路径>.flv，用于MSE的WebSocket fMP4的路径为 /<推流路径>.mp4
+type HTTPServer struct {
+	Server  *Server
+	Port    int
+	Stopped bool
+	// HLS HLS输出参数，需要在 Start 之前设置
+	HLS HLSOptions
+	// DASH DASH输出参数，需要在 Start 之前设置
+	DASH DASHOptions
+	// CertFile KeyFile 设置后使用https，客户端支持时使用HTTP/2，低延迟HLS的并发阻塞请求复用同一个连接
+	CertFile string
+	KeyFile  string
+
+	listener   net.Listener
+	httpServer *http.Server
+	// muxers 按需创建的封装，键为 格式:推流路径
+	muxers map[string]httpMuxer
+	lock   sync.Mutex
+	done   chan struct{}
+}
+
+// NewHTTPServer 创建http服务端实例，server 为提供推流的rtsp服务端
+func NewHTTPServer(server *Server, port int) *HTTPServer {
+	return &HTTPServer{
+		Server:  server,
+		Port:    port,
+		Stopped: true,
+		muxers:  make(map[string]httpMuxer),
+	}
+}
+
+// Start 启动http服务，阻塞直到 Stop
+func (s *HTTPServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	s.lock.Lock()
+	s.listener = listener
+	s.httpServer = &http.Server{Handler: s}
+	s.done = make(chan struct{})
+	s.Stopped = false
+	s.lock.Unlock()
+
+	go s.closeIdle(s.done)
+	if s.CertFile != "" {
+		err = s.httpServer.ServeTLS(listener, s.CertFile, s.KeyFile)
+	} else {
+		err = s.httpServer.Serve(listener)
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// Stop 停止http服务并关闭所有封装
+func (s *HTTPServer) Stop() {
+	s.lock.Lock()
+	if s.Stopped {
+		s.lock.Unlock()
+		return
+	}
+	s.Stopped = true
+	close(s.done)
+	muxers := s.muxers
+	s.muxers = make(map[string]httpMuxer)
+	s.lock.Unlock()
+
+	if err := s.httpServer.Close(); err != nil {
+		log.Println(fmt.Errorf("http server close error:%s", err))
+	}
+	for _, m := range muxers {
+		m.close()
+	}
+}
+
+// closeIdle 定时关闭空闲或推流已经结束的封装
+func (s *HTTPServer) closeIdle(done chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			var idle []httpMuxer
+			s.lock.Lock()
+			for key, m := range s.muxers {
+				pusher := m.source()
+				if m.idle(now) || pusher.Stopped() || s.Server.GetPusher(pusher.Path()) != pusher {
+					delete(s.muxers, key)
+					idle = append(idle, m)
+				}
+			}
+			s.lock.Unlock()
+			for _, m := range idle {
+				m.close()
+			}
+		}
+	}
+}
+
+// ServeHTTP 按文件名路由，其余部分为推流路径
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "*")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	i := strings.LastIndex(r.URL.Path, "/")
+	path, name := r.URL.Path[:i], r.URL.Path[i+1:]
+	switch {
+	case strings.HasSuffix(name, ".flv"):
+		s.serveFLV(w, r, strings.TrimSuffix(r.URL.Path, ".flv"))
+	case strings.HasSuffix(name, ".mp4") && websocket.IsUpgrade(r):
+		s.serveMSE(w, r, strings.TrimSuffix(r.URL.Path, ".mp4"))
+	case name == "index.mpd" || strings.HasPrefix(name, "dash-"):
+		var create func(*Pusher) httpMuxer
+		if name == "index.mpd" {
+			create = func(pusher *Pusher) httpMuxer {
+				return newDASHMuxer(pusher, s.DASH)
+			}
+		}
+		m, _ := s.muxer("dash", path, create).(*dashMuxer)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		m.serve(w, r, name)
+	case strings.HasSuffix(name, ".m3u8"), strings.HasSuffix(name, ".ts"),
+		strings.HasSuffix(name, ".m4s"), strings.HasSuffix(name, ".mp4"):
+		var create func(*Pusher) httpMuxer
+		if strings.HasSuffix(name, ".m3u8") {
+			create = func(pusher *Pusher) httpMuxer {
+				return newHLSMuxer(pusher, s.HLS)
+			}
+		}
+		m, _ := s.muxer("hls", path, create).(*hlsMuxer)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		m.serve(w, r, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// muxer 获取推流的封装，create 不为nil时在没有封装时创建，推流不存在时返回nil
+// 只在请求播放列表或MPD时创建封装，分段的请求不会重新创建已经关闭的封装
+func (s *HTTPServer) muxer(kind, path string, create func(*Pusher) httpMuxer) httpMuxer {
+	if path == "" {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.Stopped {
+		return nil
+	}
+	key := kind + ":" + path
+	if m := s.muxers[key]; m != nil {
+		return m
+	}
+	if create == nil {
+		return nil
+	}
+	pusher := s.Server.GetPusher(path)
+	if pusher == nil || pusher.Stopped() {
+		return nil
+	}
+	m := create(pusher)
+	s.muxers[key] = m
+	return m
+}
+
+// livePusher 获取正在推流的 Pusher 和 Stop 时关闭的通道，不存在时返回nil
+func (s *HTTPServer) livePusher(path string) (*Pusher, <-chan struct{}) {
+	s.lock.Lock()
+	done, stopped := s.done, s.Stopped
+	s.lock.Unlock()
+	pusher := s.Server.GetPusher(path)
+	if stopped || pusher == nil || pusher.Stopped() {
+		return nil, nil
+	}
+	return pusher, done
+}
+
+// upgrade 完成WebSocket握手，并在单独的协程中读取客户端的消息以响应ping和close，连接断开时关闭返回的通道
+func (s *HTTPServer) upgrade(w http.ResponseWriter, r *http.Request, path string) (*websocket.Conn, <-chan struct{}) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Println(fmt.Errorf("websocket[%s] upgrade error:%s", path, err))
+		return nil, nil
+	}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	log.Println(fmt.Sprintf("websocket[%s] %s connected", path, conn.RemoteAddr()))
+	return conn, closed
+}
+
+// serveFLV 每个客户端单独订阅推流，以chunked的http响应或WebSocket的二进制消息输出flv
+// 阻塞直到客户端断开、推流结束或 Stop
+func (s *HTTPServer) serveFLV(w http.ResponseWriter, r *http.Request, path string) {
+	pusher, done := s.livePusher(path)
+	if pusher == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if video, audio := flvTracks(NewPusherFrameReader(pusher)); !video && !audio {
+		http.Error(w, "no media supported by flv", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var session *flvSession
+	var closed <-chan struct{}
+	if websocket.IsUpgrade(r) {
+		var conn *websocket.Conn
+		if conn, closed = s.upgrade(w, r, path); conn == nil {
+			return
+		}
+		defer conn.Close()
+		session = newFLVSession(pusher, func(b []byte) error {
+			conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+			return conn.WriteMessage(websocket.OpBinary, b)
+		})
+	} else {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "video/x-flv")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		closed = r.Context().Done()
+		session = newFLVSession(pusher, func(b []byte) error {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+		log.Println(fmt.Sprintf("http flv[%s] %s connected", path, r.RemoteAddr))
+	}
+
+	if err := session.run(done, closed); err != nil {
+		log.Println(fmt.Errorf("flv[%s] write error:%s", path, err))
+	}
+	log.Println(fmt.Sprintf("flv[%s] %s closed", path, r.RemoteAddr))
+}
+
+// serveMSE 每个客户端单独订阅推流，以WebSocket输出fMP4，供浏览器的Media Source Extensions直接使用
+// 请求参数 codecs 为客户端支持的编码字符串或其前缀，以逗号分隔，例如 avc1,mp4a.40.2，不支持的媒体不输出
+func (s *HTTPServer) serveMSE(w http.ResponseWriter, r *http.Request, path string) {
+	pusher, done := s.livePusher(path)
+	if pusher == nil {
+		http.NotFound(w, r)
+		return
+	}
+	codecs := mseParseCodecs(r.URL.Query().Get("codecs"))
+	if !mseAvailable(NewPusherFrameReader(pusher), codecs) {
+		http.Error(w, "no media supported by client", http.StatusUnsupportedMediaType)
+		return
+	}
+	conn, closed := s.upgrade(w, r, path)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	session := newMSESession(pusher, codecs, func(opcode int, data []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+		return conn.WriteMessage(opcode, data)
+	})
+	if err := session.run(done, closed); err != nil {
+		log.Println(fmt.Errorf("mse[%s] write error:%s", path, err))
+	}
+	log.Println(fmt.Sprintf("mse[%s] %s closed", path, r.RemoteAddr))
+}
@@ -0,0 +1,344 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+const (
+	// jitterMaxMisorder 落后于输出位置不超过该值的包视为迟到，超过时认为源重新开始(RFC 3550 A.1)
+	jitterMaxMisorder = 100
+	// jitterMaxDropout 超前于输出位置超过该值时认为源重新开始
+	jitterMaxDropout = 3000
+	// jitterDefaultMaxPackets 未设置缓冲包数上限时的默认值
+	jitterDefaultMaxPackets = 500
+	// jitterNackInterval 同一个缺包两次NACK的最小间隔
+	jitterNackInterval = 50 * time.Millisecond
+	// jitterNackMaxRetries 同一个缺包最多发送NACK的次数
+	jitterNackMaxRetries = 3
+	// jitterMinReleaseInterval jitterMaxReleaseInterval 定时输出超时包的间隔范围
+	jitterMinReleaseInterval = 5 * time.Millisecond
+	jitterMaxReleaseInterval = 50 * time.Millisecond
+)
+
+// JitterBufferOptions 抖动缓冲配置，Latency为0时不启用
+type JitterBufferOptions struct {
+	// Latency 缺包时最多等待的时长，超过后跳过缺失的包并产生丢包事件
+	Latency time.Duration
+	// MaxPackets 每路媒体最多缓冲的包数，超过后立即跳过缺失的包，0为默认值
+	MaxPackets int
+	// NACK 缺包时向发送端发送NACK请求重传(RFC 4585)，发送端需支持
+	NACK bool
+}
+
+// LossEvent 抖动缓冲确认的一段连续丢包
+type LossEvent struct {
+	Type RTPType
+	// FirstSequenceNumber 第一个丢失的包序号
+	FirstSequenceNumber uint16
+	Count               int
+	Time                time.Time
+}
+
+// String 丢包信息
+func (e *LossEvent) String() string {
+	return fmt.Sprintf("%v lost seq[%d] count[%d]", e.Type, e.FirstSequenceNumber, e.Count)
+}
+
+// JitterBufferStats 一路媒体抖动缓冲的统计
+type JitterBufferStats struct {
+	Received uint64
+	// Reordered 乱序到达并经缓冲恢复顺序的包数
+	Reordered  uint64
+	Duplicates uint64
+	// Late 落后于输出位置而丢弃的包数，包括已跳过的缺包和已输出包的重复
+	Late       uint64
+	Lost       uint64
+	LossEvents uint64
+	// Resets 序号跳变导致重新开始的次数
+	Resets uint64
+	// Nacks 请求重传的包数
+	Nacks    uint64
+	Buffered int
+}
+
+// String 统计信息
+func (s *JitterBufferStats) String() string {
+	return fmt.Sprintf("received[%d] reordered[%d] duplicates[%d] late[%d] lost[%d] events[%d] resets[%d] nacks[%d] buffered[%d]",
+		s.Received, s.Reordered, s.Duplicates, s.Late, s.Lost, s.LossEvents, s.Resets, s.Nacks, s.Buffered)
+}
+
+type jitterPacket struct {
+	pack    *RTPPack
+	seq     uint16
+	arrival time.Time
+}
+
+// jitterBuffer 一路媒体的抖动缓冲，按序号(含回绕)排序后输出
+// 缺包在后续包到达时和定时检查时按延迟目标和缓冲上限判断是否跳过，输出的序号严格递增，
+// 解包器据此遇到序号不连续即可确定地丢弃不完整的帧
+type jitterBuffer struct {
+	t          RTPType
+	latency    time.Duration
+	maxPackets int
+
+	initialized bool
+	// next 下一个应输出的序号
+	next uint16
+	// packets 按与next的距离升序排列
+	packets []*jitterPacket
+	stats   JitterBufferStats
+	// ssrc 最近的包的源，nacked 为已请求重传的缺包
+	ssrc   uint32
+	nacked map[uint16]*nackState
+}
+
+// nackState 一个缺包的重传请求状态
+type nackState struct {
+	count int
+	last  time.Time
+}
+
+func newJitterBuffer(t RTPType, options JitterBufferOptions) *jitterBuffer {
+	maxPackets := options.MaxPackets
+	if maxPackets <= 0 {
+		maxPackets = jitterDefaultMaxPackets
+	}
+	return &jitterBuffer{t: t, latency: options.Latency, maxPackets: maxPackets}
+}
+
+// push 放入一个包，返回可以按序输出的包和确认的丢包
+func (b *jitterBuffer) push(pack *RTPPack, seq uint16, now time.Time) ([]*RTPPack, []*LossEvent) {
+	b.stats.Received++
+	if !b.initialized {
+		b.initialized = true
+		b.next = seq
+	}
+	var out []*RTPPack
+	diff := seq - b.next
+	if diff >= 0x8000 && -int(int16(diff)) <= jitterMaxMisorder {
+		b.stats.Late++
+		return nil, nil
+	}
+	if diff >= jitterMaxDropout {
+		// 序号大幅跳变，认为源重新开始，已缓冲的包按原顺序输出
+		b.stats.Resets++
+		for _, p := range b.packets {
+			out = append(out, p.pack)
+		}
+		b.packets = nil
+		b.next = seq
+		diff = 0
+	}
+	i := len(b.packets)
+	for i > 0 && b.packets[i-1].seq-b.next > diff {
+		i--
+	}
+	if i > 0 && b.packets[i-1].seq == seq {
+		b.stats.Duplicates++
+		return out, nil
+	}
+	if i < len(b.packets) {
+		b.stats.Reordered++
+	}
+	b.packets = append(b.packets, nil)
+	copy(b.packets[i+1:], b.packets[i:])
+	b.packets[i] = &jitterPacket{pack: pack, seq: seq, arrival: now}
+
+	ready, losses := b.pop(now, false)
+	return append(out, ready...), losses
+}
+
+// missing 缓冲中需要请求重传的缺包，同一个缺包按间隔最多请求jitterNackMaxRetries次
+func (b *jitterBuffer) missing(now time.Time) []uint16 {
+	if len(b.packets) == 0 {
+		b.nacked = nil
+		return nil
+	}
+	nacked := make(map[uint16]*nackState)
+	var seqs []uint16
+	seq := b.next
+	for _, p := range b.packets {
+		for ; seq != p.seq; seq++ {
+			state := b.nacked[seq]
+			if state == nil {
+				state = &nackState{}
+			}
+			nacked[seq] = state
+			if state.count >= jitterNackMaxRetries || now.Sub(state.last) < jitterNackInterval {
+				continue
+			}
+			state.count++
+			state.last = now
+			seqs = append(seqs, seq)
+		}
+		seq++
+	}
+	b.nacked = nacked
+	b.stats.Nacks += uint64(len(seqs))
+	return seqs
+}
+
+// pop 输出连续的包，等待超过延迟目标或超出缓冲上限时跳过缺失的包，drain 为true时不再等待，输出所有的包
+func (b *jitterBuffer) pop(now time.Time, drain bool) ([]*RTPPack, []*LossEvent) {
+	var (
+		out    []*RTPPack
+		losses []*LossEvent
+	)
+	for len(b.packets) > 0 {
+		first := b.packets[0]
+		if first.seq == b.next {
+			out = append(out, first.pack)
+			b.packets = b.packets[1:]
+			b.next++
+			continue
+		}
+		if !drain && len(b.packets) <= b.maxPackets && now.Sub(b.oldestArrival()) < b.latency {
+			break
+		}
+		count := int(first.seq - b.next)
+		losses = append(losses, &LossEvent{Type: b.t, FirstSequenceNumber: b.next, Count: count, Time: now})
+		b.stats.Lost += uint64(count)
+		b.stats.LossEvents++
+		b.next = first.seq
+	}
+	if len(b.packets) == 0 {
+		b.packets = nil
+	}
+	return out, losses
+}
+
+// oldestArrival 缓冲中等待最久的包的到达时间
+func (b *jitterBuffer) oldestArrival() time.Time {
+	oldest := b.packets[0].arrival
+	for _, p := range b.packets[1:] {
+		if p.arrival.Before(oldest) {
+			oldest = p.arrival
+		}
+	}
+	return oldest
+}
+
+// trackJitterBuffers 各路媒体的抖动缓冲，rtcp包不经过缓冲
+type trackJitterBuffers struct {
+	lock    sync.Mutex
+	options JitterBufferOptions
+	buffers map[RTPType]*jitterBuffer
+}
+
+// newTrackJitterBuffers 未设置延迟目标时返回nil，包直接输出
+func newTrackJitterBuffers(options JitterBufferOptions) *trackJitterBuffers {
+	if options.Latency <= 0 {
+		return nil
+	}
+	return &trackJitterBuffers{options: options, buffers: make(map[RTPType]*jitterBuffer)}
+}
+
+// push 放入一个包，返回可以按序输出的包和确认的丢包
+func (j *trackJitterBuffers) push(pack *RTPPack, now time.Time) ([]*RTPPack, []*LossEvent) {
+	if j == nil || isRTCP(pack.Type) {
+		return []*RTPPack{pack}, nil
+	}
+	b := pack.Buffer.Bytes()
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return []*RTPPack{pack}, nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	buffer := j.buffers[pack.Type]
+	if buffer == nil {
+		buffer = newJitterBuffer(pack.Type, j.options)
+		j.buffers[pack.Type] = buffer
+	}
+	buffer.ssrc = binary.BigEndian.Uint32(b[8:])
+	return buffer.push(pack, binary.BigEndian.Uint16(b[2:]), now)
+}
+
+// releaseInterval 定时输出的间隔，为延迟目标的1/4
+func (j *trackJitterBuffers) releaseInterval() time.Duration {
+	interval := j.options.Latency / 4
+	if interval < jitterMinReleaseInterval {
+		interval = jitterMinReleaseInterval
+	}
+	if interval > jitterMaxReleaseInterval {
+		interval = jitterMaxReleaseInterval
+	}
+	return interval
+}
+
+// release 输出各路媒体中等待超过延迟目标的包，源暂停或结束时不再有新包触发输出，需要定时调用
+func (j *trackJitterBuffers) release(now time.Time) ([]*RTPPack, []*LossEvent) {
+	return j.pop(now, false)
+}
+
+// drain 输出各路媒体缓冲中所有的包，缺包记为丢失，停止时调用
+func (j *trackJitterBuffers) drain(now time.Time) ([]*RTPPack, []*LossEvent) {
+	return j.pop(now, true)
+}
+
+func (j *trackJitterBuffers) pop(now time.Time, drain bool) ([]*RTPPack, []*LossEvent) {
+	if j == nil {
+		return nil, nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	var (
+		out    []*RTPPack
+		losses []*LossEvent
+	)
+	for _, t := range []RTPType{RTP_TYPE_VIDEO, RTP_TYPE_AUDIO} {
+		if buffer := j.buffers[t]; buffer != nil {
+			packs, events := buffer.pop(now, drain)
+			out = append(out, packs...)
+			losses = append(losses, events...)
+		}
+	}
+	return out, losses
+}
+
+// nacks 生成各路媒体请求重传缺包的rtcp包，未启用NACK时返回nil
+func (j *trackJitterBuffers) nacks(now time.Time, senderSSRC uint32) []*RTPPack {
+	if j == nil || !j.options.NACK {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	var packs []*RTPPack
+	for t, buffer := range j.buffers {
+		seqs := buffer.missing(now)
+		if len(seqs) == 0 {
+			continue
+		}
+		buf, err := rtcp.Marshal(&rtcp.TransportLayerNack{
+			SenderSSRC: senderSSRC,
+			MediaSSRC:  buffer.ssrc,
+			Nacks:      rtcp.NackPairsFromSequenceNumbers(seqs),
+		})
+		if err != nil {
+			continue
+		}
+		packs = append(packs, &RTPPack{Type: controlType(t), Buffer: bytes.NewBuffer(buf)})
+	}
+	return packs
+}
+
+// stats 指定媒体的统计，没有时返回nil
+func (j *trackJitterBuffers) stats(t RTPType) *JitterBufferStats {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	buffer := j.buffers[t]
+	if buffer == nil {
+		return nil
+	}
+	stats := buffer.stats
+	stats.Buffered = len(buffer.packets)
+	return &stats
+}
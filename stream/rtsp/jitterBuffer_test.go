@@ -0,0 +1,244 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// packSeqs 取出包的序号
+func packSeqs(packs []*RTPPack) []uint16 {
+	var seqs []uint16
+	for _, pack := range packs {
+		seqs = append(seqs, binary.BigEndian.Uint16(pack.Buffer.Bytes()[2:]))
+	}
+	return seqs
+}
+
+// lossPairs 丢包事件的起始序号和数量
+func lossPairs(losses []*LossEvent) [][2]int {
+	var pairs [][2]int
+	for _, e := range losses {
+		pairs = append(pairs, [2]int{int(e.FirstSequenceNumber), e.Count})
+	}
+	return pairs
+}
+
+func TestJitterBufferReorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		seqs       []uint16
+		out        []uint16
+		reordered  uint64
+		duplicates uint64
+		late       uint64
+		resets     uint64
+	}{
+		{"in order", []uint16{1, 2, 3}, []uint16{1, 2, 3}, 0, 0, 0, 0},
+		{"swapped", []uint16{1, 3, 2, 4}, []uint16{1, 2, 3, 4}, 1, 0, 0, 0},
+		{"reversed", []uint16{1, 4, 3, 2}, []uint16{1, 2, 3, 4}, 2, 0, 0, 0},
+		{"duplicate buffered", []uint16{1, 3, 3, 2}, []uint16{1, 2, 3}, 1, 1, 0, 0},
+		{"late", []uint16{1, 2, 1}, []uint16{1, 2}, 0, 0, 1, 0},
+		{"wrap", []uint16{65534, 65535, 1, 0}, []uint16{65534, 65535, 0, 1}, 1, 0, 0, 0},
+		{"reset", []uint16{1, 3, 5000, 5001}, []uint16{1, 3, 5000, 5001}, 0, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTrackJitterBuffers(JitterBufferOptions{Latency: time.Second})
+			now := time.Unix(1000, 0)
+			var out []*RTPPack
+			for _, seq := range tt.seqs {
+				packs, losses := j.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, seq, 0), now)
+				if len(losses) != 0 {
+					t.Errorf("unexpected losses %v", losses)
+				}
+				out = append(out, packs...)
+			}
+			if got := packSeqs(out); !reflect.DeepEqual(got, tt.out) {
+				t.Errorf("out %v, want %v", got, tt.out)
+			}
+			stats := j.stats(RTP_TYPE_VIDEO)
+			if stats.Received != uint64(len(tt.seqs)) || stats.Reordered != tt.reordered || stats.Duplicates != tt.duplicates ||
+				stats.Late != tt.late || stats.Resets != tt.resets || stats.Lost != 0 || stats.Buffered != 0 {
+				t.Errorf("stats %v", stats)
+			}
+		})
+	}
+}
+
+func TestJitterBufferLoss(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name      string
+		options   JitterBufferOptions
+		seqs      []uint16
+		releaseAt time.Duration
+		drain     bool
+		pushed    []uint16
+		released  []uint16
+		losses    [][2]int
+		lost      uint64
+		buffered  int
+	}{
+		{"waiting", JitterBufferOptions{Latency: 100 * time.Millisecond}, []uint16{1, 3, 4}, 50 * time.Millisecond, false,
+			[]uint16{1}, nil, nil, 0, 2},
+		{"latency exceeded", JitterBufferOptions{Latency: 100 * time.Millisecond}, []uint16{1, 3, 4}, 100 * time.Millisecond, false,
+			[]uint16{1}, []uint16{3, 4}, [][2]int{{2, 1}}, 1, 0},
+		{"drain", JitterBufferOptions{Latency: time.Second}, []uint16{1, 3, 6}, 0, true,
+			[]uint16{1}, []uint16{3, 6}, [][2]int{{2, 1}, {4, 2}}, 3, 0},
+		{"drain wrap", JitterBufferOptions{Latency: time.Second}, []uint16{65534, 1}, 0, true,
+			[]uint16{65534}, []uint16{1}, [][2]int{{65535, 2}}, 2, 0},
+		{"max packets", JitterBufferOptions{Latency: time.Second, MaxPackets: 2}, []uint16{1, 3, 4, 5}, 0, false,
+			[]uint16{1, 3, 4, 5}, nil, [][2]int{{2, 1}}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newTrackJitterBuffers(tt.options)
+			var (
+				pushed []*RTPPack
+				losses []*LossEvent
+			)
+			for _, seq := range tt.seqs {
+				packs, events := j.push(testRTPPack(t, RTP_TYPE_AUDIO, 2, seq, 0), start)
+				pushed = append(pushed, packs...)
+				losses = append(losses, events...)
+			}
+			var (
+				released []*RTPPack
+				events   []*LossEvent
+			)
+			if tt.drain {
+				released, events = j.drain(start.Add(tt.releaseAt))
+			} else {
+				released, events = j.release(start.Add(tt.releaseAt))
+			}
+			losses = append(losses, events...)
+			if got := packSeqs(pushed); !reflect.DeepEqual(got, tt.pushed) {
+				t.Errorf("pushed %v, want %v", got, tt.pushed)
+			}
+			if got := packSeqs(released); !reflect.DeepEqual(got, tt.released) {
+				t.Errorf("released %v, want %v", got, tt.released)
+			}
+			if got := lossPairs(losses); !reflect.DeepEqual(got, tt.losses) {
+				t.Errorf("losses %v, want %v", got, tt.losses)
+			}
+			for _, e := range losses {
+				if e.Type != RTP_TYPE_AUDIO {
+					t.Errorf("loss type %v", e.Type)
+				}
+			}
+			stats := j.stats(RTP_TYPE_AUDIO)
+			if stats.Lost != tt.lost || stats.LossEvents != uint64(len(tt.losses)) || stats.Buffered != tt.buffered {
+				t.Errorf("stats %v", stats)
+			}
+		})
+	}
+}
+
+func TestJitterBufferPassThrough(t *testing.T) {
+	now := time.Unix(1000, 0)
+	pack := testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 0)
+	disabled := newTrackJitterBuffers(JitterBufferOptions{})
+	if disabled != nil {
+		t.Fatal("jitter buffer without latency should be nil")
+	}
+	if out, _ := disabled.push(pack, now); len(out) != 1 || out[0] != pack {
+		t.Errorf("disabled push %v", out)
+	}
+	if out, _ := disabled.drain(now); out != nil || disabled.stats(RTP_TYPE_VIDEO) != nil || disabled.nacks(now, 1) != nil {
+		t.Errorf("disabled buffer returned packs")
+	}
+
+	j := newTrackJitterBuffers(JitterBufferOptions{Latency: time.Second})
+	j.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 0), now)
+	j.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 3, 0), now)
+	// rtcp不经过缓冲
+	control := testSRPack(t, RTP_TYPE_VIDEOCONTROL, 1, now, 0)
+	if out, _ := j.push(control, now); len(out) != 1 || out[0] != control {
+		t.Errorf("rtcp push %v", out)
+	}
+	if stats := j.stats(RTP_TYPE_VIDEO); stats.Received != 2 || stats.Buffered != 1 {
+		t.Errorf("stats %v", stats)
+	}
+}
+
+func TestJitterBufferReleaseInterval(t *testing.T) {
+	tests := []struct {
+		latency  time.Duration
+		interval time.Duration
+	}{
+		{10 * time.Millisecond, jitterMinReleaseInterval},
+		{100 * time.Millisecond, 25 * time.Millisecond},
+		{time.Second, jitterMaxReleaseInterval},
+	}
+	for _, tt := range tests {
+		if got := newTrackJitterBuffers(JitterBufferOptions{Latency: tt.latency}).releaseInterval(); got != tt.interval {
+			t.Errorf("latency %v interval %v, want %v", tt.latency, got, tt.interval)
+		}
+	}
+}
+
+func TestJitterBufferNACK(t *testing.T) {
+	start := time.Unix(1000, 0)
+	j := newTrackJitterBuffers(JitterBufferOptions{Latency: time.Second, NACK: true})
+	for _, seq := range []uint16{10, 13, 15} {
+		j.push(testRTPPack(t, RTP_TYPE_VIDEO, 0x1234, seq, 0), start)
+	}
+	tests := []struct {
+		name string
+		at   time.Duration
+		seqs []uint16
+	}{
+		{"first request", 0, []uint16{11, 12, 14}},
+		{"within interval", 10 * time.Millisecond, nil},
+		{"second request", jitterNackInterval, []uint16{11, 12, 14}},
+		{"third request", 2 * jitterNackInterval, []uint16{11, 12, 14}},
+		{"retries exhausted", 3 * jitterNackInterval, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packs := j.nacks(start.Add(tt.at), 0x99)
+			if tt.seqs == nil {
+				if len(packs) != 0 {
+					t.Errorf("unexpected nacks %d", len(packs))
+				}
+				return
+			}
+			if len(packs) != 1 || packs[0].Type != RTP_TYPE_VIDEOCONTROL {
+				t.Fatalf("nacks %v", packs)
+			}
+			packets, err := rtcp.Unmarshal(packs[0].Buffer.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			nack, ok := packets[0].(*rtcp.TransportLayerNack)
+			if !ok || nack.SenderSSRC != 0x99 || nack.MediaSSRC != 0x1234 {
+				t.Fatalf("nack %v", packets[0])
+			}
+			if got := nack.PacketList(); !reflect.DeepEqual(got, tt.seqs) {
+				t.Errorf("nack list %v, want %v", got, tt.seqs)
+			}
+		})
+	}
+	if stats := j.stats(RTP_TYPE_VIDEO); stats.Nacks != 9 {
+		t.Errorf("nacks %d, want 9", stats.Nacks)
+	}
+
+	// 重传的包到达后不再请求
+	j2 := newTrackJitterBuffers(JitterBufferOptions{Latency: time.Second, NACK: true})
+	j2.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 0), start)
+	j2.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 3, 0), start)
+	if packs := j2.nacks(start, 1); len(packs) != 1 {
+		t.Errorf("nacks before recovery %d", len(packs))
+	}
+	j2.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 2, 0), start)
+	if packs := j2.nacks(start, 1); len(packs) != 0 {
+		t.Errorf("nacks after recovery %d", len(packs))
+	}
+	if packs := newTrackJitterBuffers(JitterBufferOptions{Latency: time.Second}).nacks(start, 1); packs != nil {
+		t.Errorf("nacks without NACK option")
+	}
+}
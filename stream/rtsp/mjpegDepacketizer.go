@@ -0,0 +1,186 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/jpeg"
+)
+
+// MJPEGDepacketizer jpeg rtp解包器(RFC 2435)
+// 按分片偏移重组熵编码数据，根据RTP/JPEG头重建JPEG头，每帧输出一张完整的图片
+type MJPEGDepacketizer struct {
+	clockRate int
+
+	seq sequenceTracker
+	ts  timestampExtender
+
+	timestamp  uint32
+	header     *jpeg.Header
+	data       []byte
+	assembling bool
+
+	// Q为128~255时带内传输的量化表，后续帧长度为0时沿用
+	quantTables map[int][][]byte
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewMJPEGDepacketizer 创建jpeg解包器，info 可为nil
+func NewMJPEGDepacketizer(info *SDPInfo) *MJPEGDepacketizer {
+	d := &MJPEGDepacketizer{
+		clockRate:   90000,
+		quantTables: make(map[int][][]byte),
+	}
+	if info != nil && info.TimeScale > 0 {
+		d.clockRate = info.TimeScale
+	}
+	return d
+}
+
+// Decode 输入一个rtp包，返回此时已完整的图片
+func (d *MJPEGDepacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	// Type-specific(1) Fragment Offset(3) Type(1) Q(1) Width(1) Height(1)
+	if rtp == nil || len(rtp.Payload) < 8 {
+		return nil, fmt.Errorf("jpeg rtp payload too short")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+	}
+
+	ts := uint32(rtp.Timestamp)
+	if d.assembling && ts != d.timestamp {
+		// 上一帧缺少marker，无法确认完整，丢弃
+		d.discard()
+	}
+
+	payload := rtp.Payload
+	offset := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	t := int(payload[4])
+	q := int(payload[5])
+	width := int(payload[6]) * 8
+	height := int(payload[7]) * 8
+	payload = payload[8:]
+
+	restartInterval := 0
+	if t >= 64 && t <= 127 {
+		// Restart Interval(2) F|L|Restart Count(2)
+		if len(payload) < 4 {
+			return nil, fmt.Errorf("jpeg restart marker header truncated")
+		}
+		restartInterval = int(payload[0])<<8 | int(payload[1])
+		payload = payload[4:]
+		t -= 64
+	}
+
+	if offset == 0 {
+		quantTables, rest, err := d.readQuantTables(q, payload)
+		if err != nil {
+			d.discard()
+			return nil, err
+		}
+		payload = rest
+		d.header = &jpeg.Header{
+			Type:            t,
+			Width:           width,
+			Height:          height,
+			RestartInterval: restartInterval,
+			QuantTables:     quantTables,
+		}
+		d.data = append(d.data[:0], payload...)
+		d.timestamp = ts
+		d.assembling = true
+	} else {
+		if !d.assembling {
+			// 缺少第一个分片，丢弃
+			return nil, nil
+		}
+		if offset != len(d.data) {
+			d.discard()
+			return nil, fmt.Errorf("jpeg fragment offset %d mismatch, expect %d", offset, len(d.data))
+		}
+		if len(d.data)+len(payload) > maxAccessUnitSize {
+			d.discard()
+			return nil, fmt.Errorf("jpeg frame exceeds %d bytes", maxAccessUnitSize)
+		}
+		d.data = append(d.data, payload...)
+	}
+
+	if !rtp.Marker {
+		return nil, nil
+	}
+	header, data := d.header, d.data
+	d.discard()
+
+	image, err := header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	image = append(image, data...)
+	if n := len(image); n < 2 || image[n-2] != 0xFF || image[n-1] != jpeg.MarkerEOI {
+		image = append(image, 0xFF, jpeg.MarkerEOI)
+	}
+	return []*AccessUnit{{
+		Timestamp: ts,
+		PTS:       timestampToDuration(d.ts.extend(ts), d.clockRate),
+		Keyframe:  true,
+		Data:      image,
+	}}, nil
+}
+
+// readQuantTables 获取量化表，Q为1~99时按公式生成，128~255时读取Quantization Table header
+func (d *MJPEGDepacketizer) readQuantTables(q int, payload []byte) ([][]byte, []byte, error) {
+	if q < 128 {
+		if q == 0 || q > 99 {
+			return nil, nil, fmt.Errorf("jpeg reserved q %d", q)
+		}
+		return jpeg.MakeQuantTables(q), payload, nil
+	}
+
+	// MBZ(1) Precision(1) Length(2) Quantization Table Data
+	if len(payload) < 4 {
+		return nil, nil, fmt.Errorf("jpeg quantization table header truncated")
+	}
+	precision := payload[1]
+	length := int(payload[2])<<8 | int(payload[3])
+	payload = payload[4:]
+	if len(payload) < length {
+		return nil, nil, fmt.Errorf("jpeg quantization table length %d exceeds payload", length)
+	}
+	if length == 0 {
+		// 长度为0时沿用之前相同Q的量化表
+		tables, ok := d.quantTables[q]
+		if !ok {
+			return nil, nil, fmt.Errorf("jpeg quantization table for q %d not received", q)
+		}
+		return tables, payload, nil
+	}
+
+	var tables [][]byte
+	data := payload[:length]
+	for i := 0; len(data) > 0 && i < 4; i++ {
+		size := 64
+		if precision&(1<<uint(i)) != 0 {
+			size = 128
+		}
+		if len(data) < size {
+			return nil, nil, fmt.Errorf("jpeg quantization table %d truncated", i)
+		}
+		tables = append(tables, append([]byte(nil), data[:size]...))
+		data = data[size:]
+	}
+	d.quantTables[q] = tables
+	return tables, payload[length:], nil
+}
+
+// discard 丢弃当前未完成的帧
+func (d *MJPEGDepacketizer) discard() {
+	d.header = nil
+	d.data = nil
+	d.assembling = false
+}
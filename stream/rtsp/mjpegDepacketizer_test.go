@@ -0,0 +1,119 @@
+package rtsp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testJPEGScan 用标准库编码一张4:2:0的图片，返回DQT中的量化表和SOS之后的数据
+func testJPEGScan(t *testing.T, width, height int) ([]byte, []byte) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x * y), 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 50}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()[2:]
+	var tables []byte
+	for len(b) >= 4 {
+		marker, length := b[1], int(b[2])<<8|int(b[3])
+		segment := b[4 : 2+length]
+		b = b[2+length:]
+		switch marker {
+		case 0xDB:
+			for ; len(segment) >= 65; segment = segment[65:] {
+				tables = append(tables, segment[1:65]...)
+			}
+		case 0xDA:
+			return tables, b
+		}
+	}
+	t.Fatal("sos not found")
+	return nil, nil
+}
+
+// testJPEGPackets 按 size 字节分片，header 为第一个分片中主头之后的内容
+func testJPEGPackets(seq int, ts int, q int, width, height int, header, scan []byte, size int) []*RTPInfo {
+	var packets []*RTPInfo
+	for offset := 0; offset < len(scan); offset += size {
+		end := offset + size
+		if end > len(scan) {
+			end = len(scan)
+		}
+		payload := []byte{0, byte(offset >> 16), byte(offset >> 8), byte(offset), 1, byte(q), byte(width / 8), byte(height / 8)}
+		if offset == 0 {
+			payload = append(payload, header...)
+		}
+		payload = append(payload, scan[offset:end]...)
+		packets = append(packets, testRTP(seq, ts, end == len(scan), payload))
+		seq++
+	}
+	return packets
+}
+
+func TestMJPEGDepacketizer(t *testing.T) {
+	tables, scan := testJPEGScan(t, 64, 48)
+	inBand := append([]byte{0, 0, 0, byte(len(tables))}, tables...)
+	// 去掉EOI，由解包器补全
+	noEOI := scan[:len(scan)-2]
+
+	tests := []struct {
+		name    string
+		packets []*RTPInfo
+		frames  int
+	}{
+		{"q 50", testJPEGPackets(1, 0, 50, 64, 48, nil, scan, 100), 1},
+		{"in-band tables", testJPEGPackets(1, 0, 255, 64, 48, inBand, scan, 100), 1},
+		{"reuse in-band tables and append eoi", append(testJPEGPackets(1, 0, 255, 64, 48, inBand, scan, 100),
+			testJPEGPackets(100, 3000, 255, 64, 48, []byte{0, 0, 0, 0}, noEOI, 80)...), 2},
+		{"lost fragment", append(testJPEGPackets(1, 0, 50, 64, 48, nil, scan, 100)[1:],
+			testJPEGPackets(100, 3000, 50, 64, 48, nil, scan, 100)...), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewMJPEGDepacketizer(nil)
+			aus := decodeAll(t, d, tt.packets)
+			if len(aus) != tt.frames {
+				t.Fatalf("got %d frames, want %d", len(aus), tt.frames)
+			}
+			for _, au := range aus {
+				img, err := jpeg.Decode(bytes.NewReader(au.Data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !au.Keyframe || img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+					t.Errorf("keyframe=%v size=%v", au.Keyframe, img.Bounds())
+				}
+			}
+		})
+	}
+
+	errors := []struct {
+		name    string
+		payload []byte
+	}{
+		{"too short", []byte{0, 0, 0, 0, 1, 50, 8}},
+		{"reserved q", []byte{0, 0, 0, 0, 1, 0, 8, 6, 0xAA}},
+		{"tables not received", []byte{0, 0, 0, 0, 1, 255, 8, 6, 0, 0, 0, 0, 0xAA}},
+		{"tables truncated", []byte{0, 0, 0, 0, 1, 255, 8, 6, 0, 0, 0, 64, 0xAA}},
+		{"restart header truncated", []byte{0, 0, 0, 0, 65, 50, 8, 6, 0}},
+	}
+	for _, tt := range errors {
+		if _, err := NewMJPEGDepacketizer(nil).Decode(testRTP(1, 0, true, tt.payload)); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+	d := NewMJPEGDepacketizer(nil)
+	decodeAll(t, d, testJPEGPackets(1, 0, 50, 64, 48, nil, scan, 100)[:1])
+	if _, err := d.Decode(testRTP(2, 0, true, []byte{0, 0, 0, 50, 1, 50, 8, 6, 0xAA})); err == nil {
+		t.Error("expected error for fragment offset mismatch")
+	}
+}
@@ -0,0 +1,360 @@
+package rtsp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/fmp4"
+	"github.com/mrHChen/goutils/stream/websocket"
+)
+
+// mseQueueSize 每个客户端等待发送的消息数，需要容纳订阅时GOP缓存的突发，满时丢帧，之后从下一个关键帧恢复
+const mseQueueSize = 512
+
+// mseSession 一个WebSocket fMP4客户端，用于浏览器的Media Source Extensions
+// 先发送文本消息 video/mp4; codecs="..."，之后是二进制的初始化段和每帧一个的moof+mdat
+// 编码参数变化时重新发送编码和初始化段，丢帧后时间轴前移，使客户端的缓冲区保持连续
+type mseSession struct {
+	path   string
+	pusher *Pusher
+	reader *FrameReader
+	// codecs 客户端支持的编码，为编码字符串或其前缀，为空时不限制
+	codecs []string
+	// write 发送一条WebSocket消息，返回错误时结束输出
+	write func(opcode int, data []byte) error
+
+	queue  chan *RTPPack
+	out    chan mseMessage
+	lock   sync.Mutex
+	closed bool
+
+	// 以下字段只在封装协程中访问
+	started  bool
+	config   string
+	tracks   map[RTPType]*mseTrack
+	sequence uint32
+	reason   string
+	// dropping 发送队列满后丢帧，直到参考媒体的下一个关键帧
+	dropping bool
+	// shift 已发送的时间轴与帧时间的差，resume 之前的帧不再发送
+	shift  time.Duration
+	resume time.Duration
+}
+
+// mseTrack 一路协商后的媒体，end 为已发送的结束时间
+type mseTrack struct {
+	timeScale int
+	buffer    *fmp4.TrackBuffer
+	end       time.Duration
+}
+
+// mseMessage 等待发送的消息
+type mseMessage struct {
+	opcode int
+	data   []byte
+}
+
+// mseCodecFamily 媒体编码在编码字符串中的前缀
+func mseCodecFamily(name string) string {
+	switch name {
+	case "h264":
+		return "avc1"
+	case "h265":
+		return "hvc1"
+	case "aac", "mp4a-latm":
+		return "mp4a"
+	case "opus":
+		return "opus"
+	}
+	return ""
+}
+
+// mseParseCodecs 解析客户端请求的编码列表，以逗号分隔
+func mseParseCodecs(query string) []string {
+	var codecs []string
+	for _, c := range strings.Split(query, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+			codecs = append(codecs, c)
+		}
+	}
+	return codecs
+}
+
+// mseSupported 客户端是否支持编码字符串 codecString
+func mseSupported(codecs []string, codecString string) bool {
+	if len(codecs) == 0 {
+		return true
+	}
+	codecString = strings.ToLower(codecString)
+	for _, c := range codecs {
+		if strings.HasPrefix(codecString, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// mseFamilySupported 客户端是否可能支持媒体编码 name，参数集可能尚未收到，只比较编码的前缀
+func mseFamilySupported(codecs []string, name string) bool {
+	family := mseCodecFamily(name)
+	if family == "" {
+		return false
+	}
+	if len(codecs) == 0 {
+		return true
+	}
+	for _, c := range codecs {
+		if strings.HasPrefix(c, family) || strings.HasPrefix(family, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// mseAvailable 推流中是否有客户端可能支持的媒体
+func mseAvailable(reader *FrameReader, codecs []string) bool {
+	for _, t := range reader.Tracks() {
+		if mseFamilySupported(codecs, reader.Codec(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// newMSESession 创建客户端的输出，codecs 为客户端支持的编码
+func newMSESession(pusher *Pusher, codecs []string, write func(opcode int, data []byte) error) *mseSession {
+	return &mseSession{
+		path:   pusher.Path(),
+		pusher: pusher,
+		reader: NewPusherFrameReader(pusher),
+		codecs: codecs,
+		write:  write,
+		queue:  make(chan *RTPPack, flvQueueSize),
+		out:    make(chan mseMessage, mseQueueSize),
+	}
+}
+
+// writeRTP 写入一个包，不阻塞，队列满时丢弃
+func (s *mseSession) writeRTP(pack *RTPPack) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- pack:
+	default:
+	}
+}
+
+// run 订阅推流并输出，直到发送失败、done 或 closed 关闭、推流结束
+func (s *mseSession) run(done, closed <-chan struct{}) error {
+	// 发送协程，封装协程在队列满时丢帧而不会被阻塞
+	sendErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case m := <-s.out:
+				if err := s.write(m.opcode, m.data); err != nil {
+					sendErr <- err
+					return
+				}
+			}
+		}
+	}()
+
+	unsubscribe := s.pusher.Subscribe(s.writeRTP)
+	defer func() {
+		s.lock.Lock()
+		s.closed = true
+		s.lock.Unlock()
+		unsubscribe()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-closed:
+			return nil
+		case err := <-sendErr:
+			return err
+		case <-ticker.C:
+			if s.pusher.Stopped() {
+				return nil
+			}
+		case pack := <-s.queue:
+			for _, frame := range s.reader.ReadRTP(pack) {
+				if err := s.writeFrame(frame); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// send 加入发送队列，队列满时返回false
+func (s *mseSession) send(opcode int, data []byte) bool {
+	select {
+	case s.out <- mseMessage{opcode: opcode, data: data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// reference 决定重新初始化和丢帧恢复位置的媒体，协商了视频时为视频
+func (s *mseSession) reference() RTPType {
+	if s.started {
+		if s.tracks[RTP_TYPE_VIDEO] != nil {
+			return RTP_TYPE_VIDEO
+		}
+		return RTP_TYPE_AUDIO
+	}
+	// 参数集尚未收到时按编码的前缀判断
+	if c, err := s.reader.FMP4Codec(RTP_TYPE_VIDEO); err == nil && mseSupported(s.codecs, c.CodecString()) ||
+		err != nil && mseFamilySupported(s.codecs, s.reader.Codec(RTP_TYPE_VIDEO)) {
+		return RTP_TYPE_VIDEO
+	}
+	return RTP_TYPE_AUDIO
+}
+
+// end 各路媒体已发送的结束时间中最早的，从这里继续时视频连续，音频与已发送的部分重叠
+func (s *mseSession) end() time.Duration {
+	var end time.Duration
+	first := true
+	for _, track := range s.tracks {
+		if first || track.end < end {
+			end, first = track.end, false
+		}
+	}
+	return end
+}
+
+// writeFrame 写入一帧，每帧的时长由同一媒体的下一帧确定，因此发送的是上一帧
+func (s *mseSession) writeFrame(frame *Frame) error {
+	if frame.Type == s.reference() && frame.Keyframe {
+		config := s.reader.trackConfig()
+		if !s.started || config != s.config {
+			if err := s.open(frame, config); err != nil {
+				if err.Error() != s.reason {
+					log.Println(fmt.Errorf("mse session[%s] wait for keyframe:%s", s.path, err))
+					s.reason = err.Error()
+				}
+				return nil
+			}
+		} else if s.dropping {
+			// 丢弃未发送的帧，时间轴前移到已发送的结束时间
+			for _, track := range s.tracks {
+				track.buffer = fmp4.NewTrackBuffer(track.buffer.ID)
+			}
+			s.shift, s.resume, s.dropping = frame.DTS-s.end(), frame.DTS, false
+			log.Println(fmt.Sprintf("mse session[%s] resume at %v after dropping frames", s.path, frame.DTS))
+		}
+	}
+	if !s.started || s.dropping || frame.DTS < s.resume {
+		return nil
+	}
+	track := s.tracks[frame.Type]
+	if track == nil {
+		return nil
+	}
+
+	dts := rtpTicks(frame.DTS-s.shift, track.timeScale)
+	sample := &fmp4.Sample{PTSOffset: int32(rtpTicks(frame.PTS-s.shift, track.timeScale) - dts)}
+	if frame.Type == RTP_TYPE_VIDEO {
+		sample.IsNonSyncSample = !frame.Keyframe
+		sample.Payload = codec.JoinAVCC(frame.NALUs)
+	} else {
+		sample.Payload = frame.Data
+	}
+	track.buffer.Push(dts, sample)
+	s.sendFragment(track)
+	return nil
+}
+
+// sendFragment 发送一路媒体已确定时长的样本，发送队列满时开始丢帧
+func (s *mseSession) sendFragment(track *mseTrack) {
+	tf := track.buffer.Fragment()
+	if tf == nil || s.dropping {
+		return
+	}
+	s.sequence++
+	data := (&fmp4.Fragment{SequenceNumber: s.sequence, Tracks: []*fmp4.TrackFragment{tf}}).Marshal()
+	if !s.send(websocket.OpBinary, data) {
+		s.dropping = true
+		log.Println(fmt.Sprintf("mse session[%s] client too slow, dropping frames", s.path))
+		return
+	}
+	track.end = ticksDuration(int64(tf.BaseTime+tf.Duration()), track.timeScale)
+}
+
+// open 以参考媒体的关键帧开始输出或重新初始化，先发送之前剩余的帧，再发送编码和初始化段
+func (s *mseSession) open(frame *Frame, config string) error {
+	tracks := make(map[RTPType]*mseTrack)
+	init := &fmp4.Init{}
+	var codecs []string
+	for _, t := range s.reader.Tracks() {
+		c, err := s.reader.FMP4Codec(t)
+		if err != nil {
+			if t == frame.Type {
+				return err
+			}
+			continue
+		}
+		if !mseSupported(s.codecs, c.CodecString()) {
+			continue
+		}
+		id := len(init.Tracks) + 1
+		tracks[t] = &mseTrack{timeScale: s.reader.ClockRate(t), buffer: fmp4.NewTrackBuffer(id)}
+		init.Tracks = append(init.Tracks, &fmp4.Track{ID: id, TimeScale: uint32(s.reader.ClockRate(t)), Codec: c})
+		codecs = append(codecs, c.CodecString())
+	}
+	if tracks[frame.Type] == nil {
+		return fmt.Errorf("%v codec not accepted by client", frame.Type)
+	}
+	data, err := init.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if s.started && !s.dropping {
+		for _, track := range s.tracks {
+			track.buffer.Close()
+			s.sendFragment(track)
+		}
+	}
+	end := s.end()
+	if s.dropping || !s.started {
+		s.shift, s.resume = frame.DTS-end, frame.DTS
+	}
+	for _, track := range tracks {
+		track.end = end
+	}
+	mime := fmt.Sprintf(`video/mp4; codecs="%s"`, strings.Join(codecs, ","))
+	if tracks[RTP_TYPE_VIDEO] == nil {
+		mime = fmt.Sprintf(`audio/mp4; codecs="%s"`, strings.Join(codecs, ","))
+	}
+	if cap(s.out)-len(s.out) < 2 {
+		// 编码和初始化段必须一起发送，队列满时在下一个关键帧重试
+		s.dropping = true
+		return fmt.Errorf("client too slow for init segment")
+	}
+	s.send(websocket.OpText, []byte(mime))
+	s.send(websocket.OpBinary, data)
+	if !s.started {
+		log.Println(fmt.Sprintf("mse session[%s] start %s", s.path, mime))
+	}
+	s.started, s.config, s.tracks, s.dropping = true, config, tracks, false
+	return nil
+}
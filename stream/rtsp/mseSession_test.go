@@ -0,0 +1,154 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/websocket"
+)
+
+// drainMSE 取出发送队列中的消息
+func drainMSE(s *mseSession) []mseMessage {
+	var messages []mseMessage
+	for {
+		select {
+		case m := <-s.out:
+			messages = append(messages, m)
+		default:
+			return messages
+		}
+	}
+}
+
+// fragmentTrack 单轨道分片的轨道ID和tfdt中的解码时间
+func fragmentTrack(t *testing.T, data []byte) (uint32, uint64) {
+	t.Helper()
+	types, bodies := mp4Boxes(t, data)
+	if len(types) != 2 || types[0] != "moof" || types[1] != "mdat" {
+		t.Fatalf("fragment boxes %v", types)
+	}
+	// moof: mfhd(16), traf头(8), tfhd(16), tfdt
+	moof := bodies[0]
+	return binary.BigEndian.Uint32(moof[36:]), binary.BigEndian.Uint64(moof[52:])
+}
+
+func TestMSECodecs(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		codec     string
+		supported bool
+		family    string
+		available bool
+	}{
+		{"no restriction", "", "avc1.42C01F", true, "h265", true},
+		{"prefix", " AVC1 ,mp4a.40", "avc1.42C01F", true, "h264", true},
+		{"profile mismatch", "avc1.64", "avc1.42C01F", false, "h264", true},
+		{"audio only", "mp4a.40.2,opus", "avc1.42C01F", false, "h264", false},
+		{"family prefix", "hvc1.1", "hvc1.1.6.L120.90", true, "h265", true},
+		{"unknown codec", "avc1", "avc1.42C01F", true, "pcma", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codecs := mseParseCodecs(tt.query)
+			if got := mseSupported(codecs, tt.codec); got != tt.supported {
+				t.Errorf("supported %v, want %v", got, tt.supported)
+			}
+			if got := mseFamilySupported(codecs, tt.family); got != tt.available {
+				t.Errorf("family supported %v, want %v", got, tt.available)
+			}
+		})
+	}
+	if codecs := mseParseCodecs(" , avc1,"); len(codecs) != 1 || codecs[0] != "avc1" {
+		t.Errorf("codecs %v", codecs)
+	}
+}
+
+func TestMSESession(t *testing.T) {
+	sdp, sps, pps := testDASHSDP()
+	tests := []struct {
+		name   string
+		codecs []string
+		mime   string
+		tracks map[uint32]bool
+	}{
+		{"all", nil, `video/mp4; codecs="avc1.42C01F,mp4a.40.2"`, map[uint32]bool{1: true, 2: true}},
+		{"video only", []string{"avc1"}, `video/mp4; codecs="avc1.42C01F"`, map[uint32]bool{1: true}},
+		// 客户端不支持视频时以音频开始
+		{"audio only", []string{"mp4a"}, `audio/mp4; codecs="mp4a.40.2"`, map[uint32]bool{1: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMSESession(newTestPusher(sdp), tt.codecs, nil)
+			// 从1秒的关键帧开始，时间轴从0开始
+			for _, frame := range testAVFrames(960*time.Millisecond, 2*time.Second, sps, pps) {
+				s.writeFrame(frame)
+			}
+			messages := drainMSE(s)
+			if len(messages) < 4 {
+				t.Fatalf("messages %d", len(messages))
+			}
+			if messages[0].opcode != websocket.OpText || string(messages[0].data) != tt.mime {
+				t.Errorf("mime %s, want %s", messages[0].data, tt.mime)
+			}
+			if messages[1].opcode != websocket.OpBinary || string(messages[1].data[4:8]) != "ftyp" {
+				t.Errorf("init segment %x", messages[1].data[:8])
+			}
+			first := make(map[uint32]uint64)
+			for _, m := range messages[2:] {
+				id, base := fragmentTrack(t, m.data)
+				if !tt.tracks[id] {
+					t.Fatalf("fragment of track %d", id)
+				}
+				if _, ok := first[id]; !ok {
+					first[id] = base
+				}
+			}
+			for id := range tt.tracks {
+				// 音频从1000ms之后的第一帧开始
+				if base, ok := first[id]; !ok || base > 128 {
+					t.Errorf("track %d first base time %d %v", id, base, ok)
+				}
+			}
+		})
+	}
+}
+
+// TestMSESessionDropping 发送队列满后丢帧，在下一个关键帧恢复，时间轴从已发送的结束时间继续
+func TestMSESessionDropping(t *testing.T) {
+	sdp, sps, pps := testRecorderSDP()
+	s := newMSESession(newTestPusher(sdp), nil, nil)
+	s.out = make(chan mseMessage, 4)
+	var frames []*Frame
+	for _, frame := range testAVFrames(0, 2*time.Second, sps, pps) {
+		if frame.Type == RTP_TYPE_VIDEO {
+			frames = append(frames, frame)
+		}
+	}
+	// 编码、初始化段和前两帧填满队列，第三帧开始丢弃
+	for _, frame := range frames[:25] {
+		s.writeFrame(frame)
+	}
+	if !s.dropping {
+		t.Fatal("not dropping with full queue")
+	}
+	if messages := drainMSE(s); len(messages) != 4 {
+		t.Fatalf("messages %d, want 4", len(messages))
+	}
+	for _, frame := range frames[25:28] {
+		s.writeFrame(frame)
+	}
+	if s.dropping {
+		t.Fatal("still dropping after keyframe")
+	}
+	messages := drainMSE(s)
+	if len(messages) != 2 {
+		t.Fatalf("messages %d, want 2", len(messages))
+	}
+	for i, m := range messages {
+		if _, base := fragmentTrack(t, m.data); base != uint64(2+i)*3600 {
+			t.Errorf("fragment %d base time %d, want %d", i, base, (2+i)*3600)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package rtsp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mrHChen/goutils/stream/nalcrypt"
+)
+
+// NALEncryptFilter 加密h264/h265每一帧的VCL NALU，密钥ID和IV随帧以SEI携带，并在下发的sdp中声明加密参数
+// 加密失败的帧丢弃，不以明文发送
+type NALEncryptFilter struct {
+	Algorithm nalcrypt.Algorithm
+	Keys      nalcrypt.KeyProvider
+
+	lock       sync.Mutex
+	encryptors map[string]*nalcrypt.Encryptor
+}
+
+// NewNALEncryptFilter 创建NALU加密过滤器
+func NewNALEncryptFilter(algorithm nalcrypt.Algorithm, keys nalcrypt.KeyProvider) *NALEncryptFilter {
+	return &NALEncryptFilter{
+		Algorithm:  algorithm,
+		Keys:       keys,
+		encryptors: make(map[string]*nalcrypt.Encryptor),
+	}
+}
+
+// FilterPacket 不处理rtp包
+func (f *NALEncryptFilter) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	return true
+}
+
+// FilterFrame 加密帧中的VCL NALU
+func (f *NALEncryptFilter) FilterFrame(ctx *FilterContext, au *AccessUnit) bool {
+	encryptor := f.encryptor(ctx)
+	if encryptor == nil {
+		return true
+	}
+	nalus, err := encryptor.Encrypt(au.NALUs)
+	if err != nil {
+		log.Println(fmt.Errorf("nal encrypt error:%s", err))
+		return false
+	}
+	au.NALUs = nalus
+	return true
+}
+
+// SDPAttributes 声明加密算法和当前的密钥ID
+func (f *NALEncryptFilter) SDPAttributes(ctx *FilterContext) map[string]string {
+	encryptor := f.encryptor(ctx)
+	if encryptor == nil {
+		return nil
+	}
+	keyID, err := encryptor.CurrentKeyID()
+	if err != nil {
+		return nil
+	}
+	params := &nalcrypt.Params{Algorithm: f.Algorithm, KeyID: keyID}
+	return map[string]string{nalcrypt.SDPAttribute: params.String()}
+}
+
+// encryptor 视频编码对应的加密器，不支持的编码返回nil
+func (f *NALEncryptFilter) encryptor(ctx *FilterContext) *nalcrypt.Encryptor {
+	if ctx.Type != RTP_TYPE_VIDEO {
+		return nil
+	}
+	codec := ctx.Codec()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if encryptor, ok := f.encryptors[codec]; ok {
+		return encryptor
+	}
+	encryptor, err := nalcrypt.NewEncryptor(codec, f.Algorithm, f.Keys)
+	if err != nil {
+		encryptor = nil
+	}
+	f.encryptors[codec] = encryptor
+	return encryptor
+}
+
+// NALDecryptFilter 按帧中SEI携带的密钥ID解密 NALEncryptFilter 加密的帧，并去掉下发sdp中的加密参数
+// 没有授权密钥的帧丢弃
+type NALDecryptFilter struct {
+	Keys nalcrypt.KeyProvider
+
+	lock       sync.Mutex
+	decryptors map[string]*nalcrypt.Decryptor
+}
+
+// NewNALDecryptFilter 创建NALU解密过滤器
+func NewNALDecryptFilter(keys nalcrypt.KeyProvider) *NALDecryptFilter {
+	return &NALDecryptFilter{
+		Keys:       keys,
+		decryptors: make(map[string]*nalcrypt.Decryptor),
+	}
+}
+
+// FilterPacket 不处理rtp包
+func (f *NALDecryptFilter) FilterPacket(ctx *FilterContext, pkt *RTPPacket) bool {
+	return true
+}
+
+// FilterFrame 解密帧中的VCL NALU，未加密的帧原样通过
+func (f *NALDecryptFilter) FilterFrame(ctx *FilterContext, au *AccessUnit) bool {
+	decryptor := f.decryptor(ctx)
+	if decryptor == nil {
+		return true
+	}
+	nalus, err := decryptor.Decrypt(au.NALUs)
+	if err != nil {
+		log.Println(fmt.Errorf("nal decrypt error:%s", err))
+		return false
+	}
+	au.NALUs = nalus
+	return true
+}
+
+// SDPAttributes 解密后的媒体不再声明加密参数
+func (f *NALDecryptFilter) SDPAttributes(ctx *FilterContext) map[string]string {
+	if f.decryptor(ctx) == nil {
+		return nil
+	}
+	return map[string]string{nalcrypt.SDPAttribute: ""}
+}
+
+// decryptor 视频编码对应的解密器，不支持的编码返回nil
+func (f *NALDecryptFilter) decryptor(ctx *FilterContext) *nalcrypt.Decryptor {
+	if ctx.Type != RTP_TYPE_VIDEO {
+		return nil
+	}
+	codec := ctx.Codec()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if decryptor, ok := f.decryptors[codec]; ok {
+		return decryptor
+	}
+	decryptor, err := nalcrypt.NewDecryptor(codec, f.Keys)
+	if err != nil {
+		decryptor = nil
+	}
+	f.decryptors[codec] = decryptor
+	return decryptor
+}
@@ -0,0 +1,77 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/nalcrypt"
+)
+
+func TestNALCryptFilters(t *testing.T) {
+	key := &nalcrypt.Key{Value: bytes.Repeat([]byte{0x11}, nalcrypt.KeyLength)}
+	key.ID[0] = 0x42
+	tests := []struct {
+		name  string
+		info  *SDPInfo
+		nalus [][]byte
+	}{
+		{"h264", &SDPInfo{Codec: "H264", PayloadType: 96, TimeScale: 90000},
+			[][]byte{{0x67, 0x42, 0xc0, 0x1f}, {0x68, 0xcb, 0x83}, testNALU([]byte{0x65, 0x88}, 3000)}},
+		{"h265", &SDPInfo{Codec: "H265", PayloadType: 96, TimeScale: 90000},
+			[][]byte{{0x40, 0x01, 0x0c}, {0x42, 0x01, 0x01}, {0x44, 0x01, 0xc1}, testNALU([]byte{0x26, 0x01, 0xaf}, 3000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := func(avType string) *SDPInfo {
+				if avType == "video" {
+					return tt.info
+				}
+				return nil
+			}
+			encrypt := NewFilterChain().Add(NewNALEncryptFilter(nalcrypt.AlgorithmSM4CTR, nalcrypt.NewStaticKeyProvider(key)))
+			decrypt := NewFilterChain().Add(NewNALDecryptFilter(nalcrypt.NewStaticKeyProvider(key)))
+
+			attrs := make(map[string]map[string]string)
+			encrypt.sdpAttributes(attrs, info)
+			if got := attrs["video"][nalcrypt.SDPAttribute]; got != "alg=SM4-CTR;kid="+key.ID.String() || attrs["audio"] != nil {
+				t.Errorf("encrypt sdp attributes %v", attrs)
+			}
+			attrs = make(map[string]map[string]string)
+			decrypt.sdpAttributes(attrs, info)
+			if got, ok := attrs["video"][nalcrypt.SDPAttribute]; !ok || got != "" {
+				t.Errorf("decrypt sdp attributes %v", attrs)
+			}
+
+			var zero uint32
+			var p Packetizer
+			if tt.name == "h264" {
+				p = NewH264Packetizer(PacketizerOptions{SSRC: 1, InitialTimestamp: &zero})
+			} else {
+				p = NewH265Packetizer(PacketizerOptions{SSRC: 1, InitialTimestamp: &zero})
+			}
+			packs, err := p.Packetize(&AccessUnit{PTS: 40 * time.Millisecond, NALUs: tt.nalus})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var encrypted, decrypted []*RTPPack
+			for _, pack := range packs {
+				encrypted = append(encrypted, encrypt.process(pack, info)...)
+			}
+			for _, pack := range encrypted {
+				decrypted = append(decrypted, decrypt.process(pack, info)...)
+			}
+
+			d, _ := NewDepacketizer(tt.info)
+			aus := decodeAll(t, d, parsePacks(t, encrypted))
+			if len(aus) != 1 || len(aus[0].NALUs) != len(tt.nalus)+1 || bytes.Equal(aus[0].NALUs[len(tt.nalus)], tt.nalus[len(tt.nalus)-1]) {
+				t.Fatalf("encrypted frame %d", len(aus))
+			}
+			d, _ = NewDepacketizer(tt.info)
+			aus = decodeAll(t, d, parsePacks(t, decrypted))
+			if len(aus) != 1 || aus[0].Timestamp != 3600 || !equalNALUs(aus[0].NALUs, tt.nalus) {
+				t.Errorf("decrypted frame %v", aus)
+			}
+		})
+	}
+}
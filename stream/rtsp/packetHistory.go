@@ -0,0 +1,46 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// packetHistorySize 每路媒体保留的最近发送的包数，4G链路下约为1~2秒的视频
+const packetHistorySize = 1024
+
+// packetHistory 最近发送的rtp包，按序号取出用于响应播放端的NACK
+type packetHistory struct {
+	lock    sync.Mutex
+	packets []*RTPPack
+}
+
+func newPacketHistory() *packetHistory {
+	return &packetHistory{packets: make([]*RTPPack, packetHistorySize)}
+}
+
+// push 记录一个rtp包，覆盖序号相隔packetHistorySize的旧包
+func (h *packetHistory) push(pack *RTPPack) {
+	b := pack.Buffer.Bytes()
+	if len(b) < 12 {
+		return
+	}
+	seq := binary.BigEndian.Uint16(b[2:])
+	h.lock.Lock()
+	h.packets[int(seq)%packetHistorySize] = pack
+	h.lock.Unlock()
+}
+
+// get 取出指定源和序号的包，已被覆盖或不存在时返回nil
+func (h *packetHistory) get(ssrc uint32, seq uint16) *RTPPack {
+	h.lock.Lock()
+	pack := h.packets[int(seq)%packetHistorySize]
+	h.lock.Unlock()
+	if pack == nil {
+		return nil
+	}
+	b := pack.Buffer.Bytes()
+	if len(b) < 12 || binary.BigEndian.Uint16(b[2:]) != seq || binary.BigEndian.Uint32(b[8:]) != ssrc {
+		return nil
+	}
+	return pack
+}
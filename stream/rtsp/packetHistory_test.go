@@ -0,0 +1,36 @@
+package rtsp
+
+import "testing"
+
+func TestPacketHistory(t *testing.T) {
+	h := newPacketHistory()
+	first := testRTPPack(t, RTP_TYPE_VIDEO, 1, 10, 0)
+	h.push(first)
+	h.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 11, 0))
+	tests := []struct {
+		name  string
+		ssrc  uint32
+		seq   uint16
+		found bool
+	}{
+		{"found", 1, 10, true},
+		{"other ssrc", 2, 10, false},
+		{"not sent", 1, 12, false},
+		{"same slot", 1, 10 + packetHistorySize, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.get(tt.ssrc, tt.seq); (got != nil) != tt.found {
+				t.Errorf("get %v", got)
+			}
+		})
+	}
+	if h.get(1, 10) != first {
+		t.Errorf("get returned another pack")
+	}
+	// 相隔packetHistorySize的包覆盖旧包
+	h.push(testRTPPack(t, RTP_TYPE_VIDEO, 1, 10+packetHistorySize, 0))
+	if h.get(1, 10) != nil || h.get(1, 10+packetHistorySize) == nil {
+		t.Errorf("old pack not replaced")
+	}
+}
@@ -0,0 +1,129 @@
+package rtsp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+)
+
+// rtp包最大长度(含rtp头)的默认值和下限
+const (
+	defaultRTPMaxSize = 1400
+	minRTPMaxSize     = 64
+)
+
+// Packetizer rtp打包器，将访问单元封装为rtp包
+type Packetizer interface {
+	// Packetize 封装一个访问单元，rtp时间戳由 au.PTS 换算
+	Packetize(au *AccessUnit) ([]*RTPPack, error)
+}
+
+// PacketizerOptions 打包参数
+type PacketizerOptions struct {
+	// 负载类型，为0时使用编码的默认值，动态负载类型视频为96、音频为97
+	PayloadType int
+	// 时钟频率，为0时使用编码的默认值，视频为90000
+	ClockRate int
+	// rtp包最大长度(含rtp头)，默认1400
+	MTU int
+	// 为0时随机生成
+	SSRC uint32
+	// 初始序号，为nil时随机生成
+	InitialSequenceNumber *uint16
+	// 初始时间戳，为nil时随机生成
+	InitialTimestamp *uint32
+	// 是否将参数集(VPS/SPS/PPS)聚合到一个rtp包中
+	AggregateParameterSets bool
+}
+
+// rtpPacker 生成rtp包，维护序号、时间戳和SSRC
+type rtpPacker struct {
+	packType  RTPType
+	options   PacketizerOptions
+	seq       uint16
+	timestamp uint32
+}
+
+// newRTPPacker payloadType和clockRate为对应编码的默认值
+func newRTPPacker(packType RTPType, payloadType int, clockRate int, options PacketizerOptions) *rtpPacker {
+	if options.PayloadType == 0 {
+		options.PayloadType = payloadType
+	}
+	if options.ClockRate <= 0 {
+		options.ClockRate = clockRate
+	}
+	if options.MTU < minRTPMaxSize {
+		options.MTU = defaultRTPMaxSize
+	}
+	if options.SSRC == 0 {
+		options.SSRC = randUint32()
+	}
+	p := &rtpPacker{
+		packType:  packType,
+		options:   options,
+		seq:       uint16(randUint32()),
+		timestamp: randUint32(),
+	}
+	if options.InitialSequenceNumber != nil {
+		p.seq = *options.InitialSequenceNumber
+	}
+	if options.InitialTimestamp != nil {
+		p.timestamp = *options.InitialTimestamp
+	}
+	return p
+}
+
+// maxPayloadSize 单个rtp包的最大负载长度
+func (p *rtpPacker) maxPayloadSize() int {
+	return p.options.MTU - RTPFixedHeaderLength
+}
+
+// rtpTimestamp 展示时间换算为rtp时间戳
+func (p *rtpPacker) rtpTimestamp(pts time.Duration) uint32 {
+	return p.timestamp + uint32(rtpTicks(pts, p.options.ClockRate))
+}
+
+// pack 生成一个rtp包
+func (p *rtpPacker) pack(payload []byte, timestamp uint32, marker bool) *RTPPack {
+	pkt := NewRTPPacket(uint8(p.options.PayloadType), p.seq, timestamp, p.options.SSRC, marker, payload)
+	buf := make([]byte, pkt.MarshalSize())
+	// 固定头部和负载不会超出长度限制，忽略错误
+	_, _ = pkt.MarshalTo(buf)
+	p.seq++
+	return &RTPPack{
+		Type:   p.packType,
+		Buffer: bytes.NewBuffer(buf),
+	}
+}
+
+// SSRC 当前使用的SSRC
+func (p *rtpPacker) SSRC() uint32 {
+	return p.options.SSRC
+}
+
+// SequenceNumber 下一个rtp包的序号
+func (p *rtpPacker) SequenceNumber() uint16 {
+	return p.seq
+}
+
+// splitFrame 将Annex-B或AVCC格式的帧拆分为NALU
+func splitFrame(frame []byte) ([][]byte, error) {
+	if codec.IsAnnexB(frame) {
+		return codec.SplitAnnexB(frame), nil
+	}
+	nalus, err := codec.SplitAVCC(frame)
+	if err != nil {
+		return nil, fmt.Errorf("frame is neither annex-b nor avcc: %s", err)
+	}
+	return nalus, nil
+}
+
+func randUint32() uint32 {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return binary.BigEndian.Uint32(b)
+}
@@ -0,0 +1,478 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/base"
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// testCamera 模拟rtsp摄像机，PLAY之后以interleaved方式持续发送h264视频、aac音频和SR
+// drop 断开当前连接后可以重新连接，stop关闭后断开连接并停止监听
+// 重新连接后ssrc不变，序号从断开前稍早处、时间戳从0重新开始，模拟摄像机重启
+type testCamera struct {
+	listener net.Listener
+	sdp      string
+	stop     chan struct{}
+	drop     chan struct{}
+	done     chan struct{}
+
+	lock sync.Mutex
+	// 已接受的连接数，各通道下一个包的序号
+	connections int
+	nextSeq     map[int]uint16
+}
+
+func newTestCamera(t *testing.T) *testCamera {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sps, _ := hex.DecodeString("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := []byte{0x68, 0xcb, 0x83, 0xcb, 0x20}
+	config := &aac.Config{ObjectType: 2, SampleRate: 44100, ChannelCount: 2}
+	c := &testCamera{
+		listener: listener,
+		sdp: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=camera\r\nt=0 0\r\n" +
+			"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+			fmt.Sprintf("a=fmtp:96 packetization-mode=1;sprop-parameter-sets=%s,%s\r\n",
+				base64.StdEncoding.EncodeToString(sps), base64.StdEncoding.EncodeToString(pps)) +
+			"a=control:trackID=0\r\n" +
+			"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/44100/2\r\n" +
+			"a=fmtp:97 streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=" +
+			hex.EncodeToString(config.Marshal()) + "\r\n" +
+			"a=control:trackID=1\r\n",
+		stop:    make(chan struct{}),
+		drop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		nextSeq: make(map[int]uint16),
+	}
+	go func() {
+		<-c.stop
+		listener.Close()
+	}()
+	go c.serve(t, sps, pps, config)
+	return c
+}
+
+// connectionCount 已接受的连接数
+func (c *testCamera) connectionCount() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connections
+}
+
+func (c *testCamera) url(path string) string {
+	return "rtsp://" + c.listener.Addr().String() + path
+}
+
+// serve 依次处理每个连接，停止监听后返回
+func (c *testCamera) serve(t *testing.T, sps, pps []byte, config *aac.Config) {
+	defer close(c.done)
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		c.lock.Lock()
+		c.connections++
+		c.lock.Unlock()
+		c.handle(t, conn, sps, pps, config)
+	}
+}
+
+func (c *testCamera) handle(t *testing.T, conn net.Conn, sps, pps []byte, config *aac.Config) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	var writeLock sync.Mutex
+	streaming := false
+	for {
+		b, err := rw.ReadByte()
+		if err != nil {
+			return
+		}
+		if b == 0x24 {
+			// 客户端发送的rtcp，丢弃
+			header := make([]byte, 3)
+			if _, err := io.ReadFull(rw, header); err != nil {
+				return
+			}
+			if _, err := rw.Discard(int(binary.BigEndian.Uint16(header[1:]))); err != nil {
+				return
+			}
+			continue
+		}
+		req := base.Request{}.Read(rw.Reader, []byte{b})
+		if req == nil {
+			t.Error("camera: invalid request")
+			return
+		}
+		res := base.Response{StatusCode: base.StatusOK, Header: base.Header{"CSeq": req.Header["CSeq"]}}
+		switch req.Method {
+		case base.Options:
+			res.Header["Public"] = base.HeaderValue{"OPTIONS, DESCRIBE, SETUP, PLAY"}
+		case base.Describe:
+			res.Header["Content-Type"] = base.HeaderValue{"application/sdp"}
+			res.Body = []byte(c.sdp)
+		case base.Setup:
+			res.Header["Transport"] = req.Header["Transport"]
+			res.Header["Session"] = base.HeaderValue{"camera"}
+		case base.Play:
+			res.Header["Session"] = base.HeaderValue{"camera"}
+		}
+		writeLock.Lock()
+		err = res.Write(rw.Writer)
+		writeLock.Unlock()
+		if err != nil {
+			return
+		}
+		if req.Method == base.Play && !streaming {
+			streaming = true
+			go func() {
+				c.stream(rw.Writer, &writeLock, sps, pps, config)
+				conn.Close()
+			}()
+		}
+	}
+}
+
+// stream 每20ms发送一帧视频(时间戳按25fps)和对应的音频，每25帧一个IDR和一组SR
+func (c *testCamera) stream(w *bufio.Writer, writeLock *sync.Mutex, sps, pps []byte, config *aac.Config) {
+	var zero uint32
+	c.lock.Lock()
+	vSeq, aSeq := c.nextSeq[0]-10, c.nextSeq[2]-10
+	if c.connections == 1 {
+		vSeq, aSeq = 0, 0
+	}
+	c.lock.Unlock()
+	vp := NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 300, InitialTimestamp: &zero, InitialSequenceNumber: &vSeq})
+	ap := NewAACPacketizer(config, PacketizerOptions{SSRC: 2, InitialTimestamp: &zero, InitialSequenceNumber: &aSeq})
+	write := func(channel int, b []byte) bool {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		if channel%2 == 0 {
+			c.lock.Lock()
+			c.nextSeq[channel] = binary.BigEndian.Uint16(b[2:]) + 1
+			c.lock.Unlock()
+		}
+		w.Write([]byte{0x24, byte(channel), byte(len(b) >> 8), byte(len(b))})
+		w.Write(b)
+		return w.Flush() == nil
+	}
+	start := time.Now()
+	audio := 0
+	for f := 0; ; f++ {
+		select {
+		case <-c.stop:
+			return
+		case <-c.drop:
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		pts := time.Duration(f) * 40 * time.Millisecond
+		nalus := [][]byte{append([]byte{0x41, 0x9a, byte(f)}, make([]byte, 200)...)}
+		if f%25 == 0 {
+			nalus = [][]byte{sps, pps, append([]byte{0x65, 0x88, byte(f)}, make([]byte, 600)...)}
+			for _, sr := range []struct {
+				channel int
+				ssrc    uint32
+				rtpTime uint32
+			}{
+				{1, 1, uint32(rtpTicks(pts, 90000))},
+				{3, 2, uint32(rtpTicks(pts, 44100))},
+			} {
+				b, _ := (&rtcp.SenderReport{SSRC: sr.ssrc, NTPTime: rtcp.NTPTime(start.Add(pts)), RTPTime: sr.rtpTime}).Marshal()
+				if !write(sr.channel, b) {
+					return
+				}
+			}
+		}
+		packs, _ := vp.Packetize(&AccessUnit{PTS: pts, NALUs: nalus})
+		for _, p := range packs {
+			if !write(0, p.Buffer.Bytes()) {
+				return
+			}
+		}
+		for ; time.Duration(audio)*1024*time.Second/44100 <= pts; audio++ {
+			packs, _ := ap.Packetize(&AccessUnit{
+				PTS:  time.Duration(audio) * 1024 * time.Second / 44100,
+				Data: []byte{0x21, byte(audio), 0x03, 0x04},
+			})
+			for _, p := range packs {
+				if !write(2, p.Buffer.Bytes()) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// packCounter 并发安全的收包计数
+type packCounter struct {
+	lock   sync.Mutex
+	counts map[RTPType]int
+}
+
+func (c *packCounter) add(pack *RTPPack) {
+	c.lock.Lock()
+	if c.counts == nil {
+		c.counts = make(map[RTPType]int)
+	}
+	c.counts[pack.Type]++
+	c.lock.Unlock()
+}
+
+func (c *packCounter) get(t RTPType) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.counts[t]
+}
+
+// segmentCollector 并发安全地收集录制完成的文件
+type segmentCollector struct {
+	lock     sync.Mutex
+	segments []*RecordSegment
+}
+
+func (c *segmentCollector) add(s *RecordSegment) {
+	c.lock.Lock()
+	c.segments = append(c.segments, s)
+	c.lock.Unlock()
+}
+
+func (c *segmentCollector) get() []*RecordSegment {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*RecordSegment(nil), c.segments...)
+}
+
+// dialTestPlayer 连接服务端播放，服务端监听可能稍晚于客户端连接
+func dialTestPlayer(t *testing.T, port int, path string) *Client {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		player := NewRTSPClient(ClientOptions{RtspAddress: fmt.Sprintf("rtsp://127.0.0.1:%d%s", port, path), Timeout: time.Second})
+		err := player.Run()
+		if err == nil {
+			return player
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestClientPusherPipeline 摄像机 -> 拉流客户端 -> 推流 -> 服务端 -> 播放端，同时录制客户端和推流，可用 -race 运行
+func TestClientPusherPipeline(t *testing.T) {
+	camera := newTestCamera(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	server := NewRTSPServer(port)
+	go server.Start()
+
+	client := NewRTSPClient(ClientOptions{RtspAddress: camera.url("/live/cam1"), Timeout: 2 * time.Second})
+	if err := client.Run(); err != nil {
+		t.Fatal(err)
+	}
+	client.Server = server
+	var clientPacks packCounter
+	client.RTPHandles = append(client.RTPHandles, clientPacks.add)
+	pusher := NewClientPusher(client)
+	dir := t.TempDir()
+	var pusherSegments, clientSegments segmentCollector
+	pusherRecorder := RecordPusher(pusher, RecorderOptions{PathTemplate: filepath.Join(dir, "pusher/{path}/{start}.mp4")})
+	pusherRecorder.SegmentHandles = append(pusherRecorder.SegmentHandles, pusherSegments.add)
+	clientRecorder := RecordClient(client, RecorderOptions{PathTemplate: filepath.Join(dir, "client/{path}/{start}.mp4")})
+	clientRecorder.SegmentHandles = append(clientRecorder.SegmentHandles, clientSegments.add)
+	clientStopped := make(chan struct{})
+	client.StopHandles = append(client.StopHandles, func() { close(clientStopped) })
+	if !server.AddPusher(pusher) {
+		t.Fatal("pusher not added")
+	}
+	go client.startStream()
+
+	player := dialTestPlayer(t, port, "/live/cam1")
+	deadline := time.Now().Add(5 * time.Second)
+	var playerPacks packCounter
+	player.RTPHandles = append(player.RTPHandles, playerPacks.add)
+	playerStopped := make(chan struct{})
+	player.StopHandles = append(player.StopHandles, func() { close(playerStopped) })
+	go player.startStream()
+
+	for playerPacks.get(RTP_TYPE_VIDEO) < 100 || playerPacks.get(RTP_TYPE_AUDIO) < 20 {
+		if time.Now().After(deadline) {
+			t.Fatalf("player received video[%d] audio[%d]", playerPacks.get(RTP_TYPE_VIDEO), playerPacks.get(RTP_TYPE_AUDIO))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if params := pusher.VideoParams(); params == nil || params.Width != 1920 {
+		t.Errorf("pusher video params %v", params)
+	}
+	if _, ok := pusher.WallClock().Time(RTP_TYPE_VIDEO, 0); !ok {
+		t.Errorf("pusher wall clock not running")
+	}
+
+	// 摄像机断开后推流结束，播放端被断开，两路录制关闭文件
+	close(camera.stop)
+	<-camera.done
+	for name, ch := range map[string]chan struct{}{"client": clientStopped, "player": playerStopped} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not stopped", name)
+		}
+	}
+	if server.GetPusher(pusher.Path()) != nil {
+		t.Errorf("pusher not removed from server")
+	}
+	pusherRecorder.Close()
+	clientRecorder.Close()
+	for name, segments := range map[string][]*RecordSegment{"pusher": pusherSegments.get(), "client": clientSegments.get()} {
+		if len(segments) != 1 || segments[0].Size == 0 || segments[0].Duration <= 0 {
+			t.Errorf("%s segments %v", name, segments)
+		}
+	}
+	if clientPacks.get(RTP_TYPE_VIDEOCONTROL) == 0 {
+		t.Errorf("client received no rtcp")
+	}
+}
+
+// rtpRecorder 并发安全地记录一路媒体收到的序号和时间戳
+type rtpRecorder struct {
+	lock sync.Mutex
+	t    RTPType
+	seqs []uint16
+	tss  []uint32
+}
+
+func (r *rtpRecorder) add(pack *RTPPack) {
+	if pack.Type != r.t {
+		return
+	}
+	rtp := ParseRTP(pack.Buffer.Bytes())
+	if rtp == nil {
+		return
+	}
+	r.lock.Lock()
+	r.seqs = append(r.seqs, uint16(rtp.SequenceNumber))
+	r.tss = append(r.tss, uint32(rtp.Timestamp))
+	r.lock.Unlock()
+}
+
+func (r *rtpRecorder) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.seqs)
+}
+
+// check 序号连续、时间戳不回退
+func (r *rtpRecorder) check(t *testing.T) {
+	t.Helper()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := 1; i < len(r.seqs); i++ {
+		if r.seqs[i] != r.seqs[i-1]+1 || int32(r.tss[i]-r.tss[i-1]) < 0 {
+			t.Errorf("%v packet %d seq %d ts %d after seq %d ts %d", r.t, i, r.seqs[i], r.tss[i], r.seqs[i-1], r.tss[i-1])
+			return
+		}
+	}
+}
+
+// TestClientReconnect 摄像机断开后拉流客户端重连，推流和播放端保持，播放端收到的流连续；重连失败后推流结束
+func TestClientReconnect(t *testing.T) {
+	camera := newTestCamera(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	server := NewRTSPServer(port)
+	go server.Start()
+
+	client := NewRTSPClient(ClientOptions{
+		RtspAddress:       camera.url("/live/cam2"),
+		Timeout:           time.Second,
+		ReconnectAttempts: 3,
+		ReconnectInterval: 50 * time.Millisecond,
+	})
+	if err := client.Run(); err != nil {
+		t.Fatal(err)
+	}
+	client.Server = server
+	pusher := NewClientPusher(client)
+	clientStopped := make(chan struct{})
+	client.StopHandles = append(client.StopHandles, func() { close(clientStopped) })
+	if !server.AddPusher(pusher) {
+		t.Fatal("pusher not added")
+	}
+	go client.startStream()
+
+	player := dialTestPlayer(t, port, "/live/cam2")
+	video, audio := &rtpRecorder{t: RTP_TYPE_VIDEO}, &rtpRecorder{t: RTP_TYPE_AUDIO}
+	player.RTPHandles = append(player.RTPHandles, video.add, audio.add)
+	playerStopped := make(chan struct{})
+	player.StopHandles = append(player.StopHandles, func() { close(playerStopped) })
+	go player.startStream()
+
+	wait := func(name string, done func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for %s", name)
+			}
+		}
+	}
+	wait("video before drop", func() bool { return video.count() >= 20 })
+
+	// 断开后重连，序号回退不到100个包，只能依靠重连标记切换
+	camera.drop <- struct{}{}
+	wait("reconnect", func() bool { return camera.connectionCount() == 2 })
+	before := video.count()
+	wait("video after reconnect", func() bool { return video.count() >= before+50 && audio.count() >= 20 })
+	select {
+	case <-clientStopped:
+		t.Fatal("client stopped during reconnect")
+	case <-playerStopped:
+		t.Fatal("player stopped during reconnect")
+	default:
+	}
+	if server.GetPusher(pusher.Path()) != pusher || pusher.Stopped() {
+		t.Errorf("pusher replaced or stopped during reconnect")
+	}
+	video.check(t)
+	audio.check(t)
+
+	// 摄像机停止后重连失败，推流结束
+	close(camera.stop)
+	<-camera.done
+	for name, ch := range map[string]chan struct{}{"client": clientStopped, "player": playerStopped} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not stopped", name)
+		}
+	}
+	if server.GetPusher(pusher.Path()) != nil {
+		t.Errorf("pusher not removed from server")
+	}
+}
@@ -1,9 +1,13 @@
 package rtsp
 
 import (
+	"bytes"
+	"fmt"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
 )
 
 // Player 播放器
@@ -15,6 +19,22 @@ type Player struct {
 	queueLimit           int
 	dropPacketWhenPaused bool
 	paused               bool
+
+	// 发送统计，用于生成SR并解析播放端的RR
+	rtcpSender *rtcpSender
+	// 推流端切换源时保持输出连续
+	rewriter *rtpRewriter
+	// 各路媒体重传流的ssrc和序号，推流端sdp中有rtx时使用
+	rtxStreams map[RTPType]*rtxStream
+
+	// Filters 播放端的过滤链，只影响发给该播放端的包，有过滤器时不响应NACK
+	Filters *FilterChain
+}
+
+// rtxStream 重传流(RFC 4588)
+type rtxStream struct {
+	ssrc uint32
+	seq  uint16
 }
 
 // NewPlayer return Player
@@ -26,6 +46,10 @@ func NewPlayer(s *Session, pusher *Pusher) *Player {
 		queueLimit:           0,
 		dropPacketWhenPaused: false,
 		paused:               false,
+		rtcpSender:           newRTCPSender(pusher.clockRates()),
+		rewriter:             newRTPRewriter(pusher.clockRates),
+		rtxStreams:           make(map[RTPType]*rtxStream),
+		Filters:              NewFilterChain(),
 	}
 	s.StopHandles = append(s.StopHandles, func() {
 		pusher.RemovePlayer(player)
@@ -57,8 +81,9 @@ func (p *Player) QueueRTP(pack *RTPPack) *Player {
 // Start 启动
 func (p *Player) Start() {
 	timer := time.Unix(0, 0)
+	go p.sendSenderReports()
 
-	for !p.Stopped {
+	for !p.isStopped() {
 		var pack *RTPPack
 		p.cond.L.Lock()
 		if len(p.queue) == 0 {
@@ -77,29 +102,132 @@ func (p *Player) Start() {
 		}
 
 		if pack == nil {
-			if !p.Stopped {
+			if !p.isStopped() {
 				p.Println("player not Stopped, but queue take out nil pack")
 			}
 			continue
 		}
-		if err := p.SendRTP(pack); err != nil {
-			p.Println(err)
+		for _, pack := range p.Filters.process(pack, p.Pusher.SDPInfo) {
+			pack = p.rewriter.rewrite(pack, time.Now())
+			if err := p.SendRTP(pack); err != nil {
+				p.Println(err)
+			} else {
+				p.rtcpSender.onRTP(pack, time.Now())
+			}
 		}
 
 		elapsed := time.Now().Sub(timer)
 		if elapsed >= 30*time.Second {
-			p.Println("Player %s, Send a package.type:%d, queue.len=%d\n", p.String(), pack.Type, queueLen)
+			p.Println(fmt.Sprintf("Player %s, Send a package.type:%d, queue.len=%d", p.String(), pack.Type, queueLen))
 			timer = time.Now()
 		}
 	}
 }
 
+// sendSenderReports 定时向播放端发送SR，NTP时间优先使用推流端SR中的对应关系
+func (p *Player) sendSenderReports() {
+	ticker := time.NewTicker(rtcpReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if p.isStopped() {
+			return
+		}
+		if p.paused {
+			continue
+		}
+		for _, pack := range p.rtcpSender.reports(time.Now(), p.rtpNTPTime) {
+			if !p.hasRTCPChannel(pack.Type) {
+				continue
+			}
+			if err := p.SendRTP(pack); err != nil {
+				p.Println(err)
+			}
+		}
+	}
+}
+
+// rtpNTPTime 输出的时间戳先换算回推流端的时间戳，再按推流端SR换算NTP时间
+func (p *Player) rtpNTPTime(t RTPType, rtpTime uint32) (uint64, bool) {
+	return p.Pusher.rtpNTPTime(t, p.rewriter.sourceTimestamp(t, rtpTime))
+}
+
+// handleNACK 从推流端最近的包中重传播放端NACK请求的包
+// 推流端sdp中有rtx负载类型时以重传流发送，否则按原包重发
+func (p *Player) handleNACK(pack *RTPPack) {
+	if p.Filters.Len() > 0 {
+		// 推流端缓存的包未经过播放端的过滤链，序号也可能已被过滤链改写
+		return
+	}
+	packets, err := rtcp.Unmarshal(pack.Buffer.Bytes())
+	if err != nil {
+		return
+	}
+	t := mediaType(pack.Type)
+	var rtxPayloadType int
+	if info := p.Pusher.SDPInfo(t.String()); info != nil {
+		rtxPayloadType = info.RTXPayloadType
+	}
+	for _, pkt := range packets {
+		nack, ok := pkt.(*rtcp.TransportLayerNack)
+		if !ok {
+			continue
+		}
+		for _, seq := range nack.PacketList() {
+			ssrc, srcSeq, ok := p.rewriter.source(t, nack.MediaSSRC, seq)
+			if !ok {
+				break
+			}
+			orig := p.Pusher.historyPacket(t, ssrc, srcSeq)
+			if orig == nil {
+				continue
+			}
+			resend := p.rewriter.retransmit(orig)
+			if resend == nil {
+				continue
+			}
+			if rtxPayloadType > 0 {
+				if resend = p.encodeRTX(resend, uint8(rtxPayloadType)); resend == nil {
+					continue
+				}
+			}
+			if err := p.SendRTP(resend); err != nil {
+				p.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// encodeRTX 封装为重传流的包
+func (p *Player) encodeRTX(pack *RTPPack, payloadType uint8) *RTPPack {
+	pkt := &RTPPacket{}
+	if err := pkt.Unmarshal(pack.Buffer.Bytes()); err != nil {
+		return nil
+	}
+	stream := p.rtxStreams[pack.Type]
+	if stream == nil {
+		stream = &rtxStream{ssrc: randUint32(), seq: uint16(randUint32())}
+		p.rtxStreams[pack.Type] = stream
+	}
+	buf, err := EncodeRTX(pkt, payloadType, stream.ssrc, stream.seq).Marshal()
+	if err != nil {
+		return nil
+	}
+	stream.seq++
+	return &RTPPack{Type: pack.Type, Buffer: bytes.NewBuffer(buf)}
+}
+
+// ReceptionStats 播放端RR中指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的丢包和抖动，没有收到RR时返回nil
+func (p *Player) ReceptionStats(t RTPType) *ReceptionStats {
+	return p.rtcpSender.stats(t)
+}
+
 // Pause 暂停
 func (p *Player) Pause(b bool) {
 	if b {
-		p.Println("Player %s, Pause\n", p.String())
+		p.Println(fmt.Sprintf("Player %s, Pause", p.String()))
 	} else {
-		p.Println("Player %s, Play\n", p.String())
+		p.Println(fmt.Sprintf("Player %s, Play", p.String()))
 	}
 
 	p.cond.L.Lock()
@@ -113,5 +241,5 @@ func (p *Player) Pause(b bool) {
 
 //Println mini logging functions
 func (p *Player) Println(v ...interface{}) {
-	log.Println(v)
+	log.Println(v...)
 }
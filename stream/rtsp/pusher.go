@@ -1,9 +1,15 @@
 package rtsp
 
 import (
-	"bytes"
+	"fmt"
+	"log"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/vp8"
+	"github.com/mrHChen/goutils/stream/codec/vp9"
+	"github.com/mrHChen/goutils/stream/rtcp"
 )
 
 type Pusher struct {
@@ -18,6 +24,31 @@ type Pusher struct {
 	SPSPPSInSTAPaPack bool
 	cond              *sync.Cond
 	queue             []*RTPPack
+
+	// 带内获取的视频参数集
+	paramSets parameterSetTracker
+
+	// 推流端sdp的解析结果，sdp变化时重新解析
+	sdpInfoRaw  string
+	sdpInfoMap  map[string]*SDPInfo
+	sdpInfoLock sync.Mutex
+
+	// 由推流端SR换算的采集时间，也用于播放端SR中NTP时间与rtp时间戳的对应
+	wallClock *WallClock
+	// 最近的rtp包，用于响应播放端的NACK
+	history map[RTPType]*packetHistory
+
+	// Filters 推流端的过滤链，在缓存和转发给播放端之前处理
+	Filters *FilterChain
+	// discontinuity 拉流客户端重连后还没有输出rtp包的媒体，只在Start协程中访问
+	discontinuity map[RTPType]bool
+
+	// 订阅推流数据的处理函数，如录制
+	subscribers     map[uint64]func(*RTPPack)
+	subscriberID    uint64
+	subscribersLock sync.RWMutex
+	// StopHandles 推流结束时调用
+	StopHandles []func()
 }
 
 func (p *Pusher) Server() *Server {
@@ -39,9 +70,9 @@ func (p *Pusher) Path() string {
 
 func (p *Pusher) Stopped() bool {
 	if p.Session != nil {
-		return p.Session.Stopped
+		return p.Session.isStopped()
 	}
-	return p.Client.Stopped
+	return p.Client.isStopped()
 }
 
 func (p *Pusher) BroadcastRTP(pack *RTPPack) *Pusher {
@@ -65,6 +96,8 @@ func (p *Pusher) VCodec() string {
 	if p.Session != nil {
 		return p.Session.VCodec
 	}
+	p.Client.lock.RLock()
+	defer p.Client.lock.RUnlock()
 	return p.Client.VCodec
 }
 
@@ -72,6 +105,8 @@ func (p *Pusher) ACodec() string {
 	if p.Session != nil {
 		return p.Session.ACodec
 	}
+	p.Client.lock.RLock()
+	defer p.Client.lock.RUnlock()
 	return p.Client.ACodec
 }
 
@@ -79,6 +114,8 @@ func (p *Pusher) AControl() string {
 	if p.Session != nil {
 		return p.Session.AControl
 	}
+	p.Client.lock.RLock()
+	defer p.Client.lock.RUnlock()
 	return p.Client.AControl
 }
 
@@ -86,6 +123,8 @@ func (p *Pusher) VControl() string {
 	if p.Session != nil {
 		return p.Session.VControl
 	}
+	p.Client.lock.RLock()
+	defer p.Client.lock.RUnlock()
 	return p.Client.VControl
 }
 
@@ -93,9 +132,152 @@ func (p *Pusher) SDPRaw() string {
 	if p.Session != nil {
 		return p.Session.SDPRaw
 	}
+	p.Client.lock.RLock()
+	defer p.Client.lock.RUnlock()
 	return p.Client.SDPRaw
 }
 
+// SDPInfo 获取推流端sdp中指定媒体类型(audio/video)的信息
+func (p *Pusher) SDPInfo(avType string) *SDPInfo {
+	return p.sdpInfos()[avType]
+}
+
+// sdpInfos 推流端sdp的解析结果，sdp变化时重新解析
+func (p *Pusher) sdpInfos() map[string]*SDPInfo {
+	p.sdpInfoLock.Lock()
+	defer p.sdpInfoLock.Unlock()
+	if raw := p.SDPRaw(); raw != p.sdpInfoRaw || p.sdpInfoMap == nil {
+		p.sdpInfoMap = ParseSDP(raw)
+		p.sdpInfoRaw = raw
+	}
+	return p.sdpInfoMap
+}
+
+// clockRates 推流端sdp中各媒体的时钟频率
+func (p *Pusher) clockRates() map[RTPType]int {
+	return sdpClockRates(p.sdpInfos())
+}
+
+// rtpNTPTime 按推流端SR换算rtp时间戳对应的NTP时间
+// 只有每路媒体都收到过SR时才能保证音视频同步，否则返回false
+func (p *Pusher) rtpNTPTime(t RTPType, rtpTime uint32) (uint64, bool) {
+	if !p.wallClock.Synced() {
+		return 0, false
+	}
+	tm, ok := p.wallClock.Time(t, rtpTime)
+	if !ok {
+		return 0, false
+	}
+	return rtcp.NTPTime(tm), true
+}
+
+// historyPacket 最近转发过的指定源和序号的包，没有时返回nil
+func (p *Pusher) historyPacket(t RTPType, ssrc uint32, seq uint16) *RTPPack {
+	if history := p.history[t]; history != nil {
+		return history.get(ssrc, seq)
+	}
+	return nil
+}
+
+// WallClock 各路媒体rtp时间戳对应的采集时间和音视频同步的PTS
+func (p *Pusher) WallClock() *WallClock {
+	return p.wallClock
+}
+
+// JitterStats 推流端指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的抖动缓冲统计，未启用时返回nil
+func (p *Pusher) JitterStats(t RTPType) *JitterBufferStats {
+	if p.Session != nil {
+		return p.Session.JitterStats(t)
+	}
+	return p.Client.JitterStats(t)
+}
+
+// ParameterSets 带内获取的视频参数集，h264为[SPS,PPS]，h265为[VPS,SPS,PPS]，尚未收到时返回nil
+func (p *Pusher) ParameterSets() [][]byte {
+	return p.paramSets.parameterSets(p.VCodec())
+}
+
+// VideoParams 视频的分辨率、profile、帧率等参数，优先使用带内的SPS/VPS，无法解析时返回nil
+func (p *Pusher) VideoParams() *VideoParams {
+	var sdpSets [][]byte
+	if info := p.SDPInfo("video"); info != nil {
+		sdpSets = info.ParameterSets
+	}
+	return p.paramSets.videoParams(p.VCodec(), sdpSets)
+}
+
+// PlayerSDP 生成下发给播放端的sdp以及按媒体顺序排列的control
+// options 中的服务端地址、SRTP密钥等由调用方指定，参数集和推流端过滤器声明的属性由推流端补充
+// 生成失败时退回推流端原始sdp，使用SRTP时返回空
+func (p *Pusher) PlayerSDP(options SDPOptions) (string, []SDPControl) {
+	options.ParameterSets = map[string][][]byte{"video": p.ParameterSets()}
+	attrs := make(map[string]map[string]string)
+	p.Filters.sdpAttributes(attrs, p.SDPInfo)
+	for avType, vals := range options.Attributes {
+		if attrs[avType] == nil {
+			attrs[avType] = make(map[string]string)
+		}
+		for name, val := range vals {
+			attrs[avType][name] = val
+		}
+	}
+	options.Attributes = attrs
+	sdpRaw, controls, err := BuildSDP(p.SDPRaw(), options)
+	if err != nil {
+		log.Println(fmt.Errorf("build player sdp error:%s", err))
+		if len(options.Crypto) > 0 {
+			// 原始sdp中没有播放端的密钥，还可能携带推流端的密钥
+			return "", nil
+		}
+		return p.SDPRaw(), []SDPControl{{Type: "video", Control: p.VControl()}, {Type: "audio", Control: p.AControl()}}
+	}
+	return sdpRaw, controls
+}
+
+// Subscribe 订阅经过过滤链的rtp包和推流端的rtcp包，先收到缓存的GOP，返回取消订阅的函数
+// handle 在推流的协程中调用，不能阻塞，包的内容不能修改
+func (p *Pusher) Subscribe(handle func(*RTPPack)) (unsubscribe func()) {
+	// dispatch 在gopCacheLock内缓存并发布，重放缓存和注册之间不会漏包或重复
+	p.gopCacheLock.RLock()
+	p.subscribersLock.Lock()
+	p.subscriberID++
+	id := p.subscriberID
+	if p.gopCacheEnable {
+		for _, pack := range p.gopCache {
+			handle(pack)
+		}
+	}
+	p.subscribers[id] = handle
+	p.subscribersLock.Unlock()
+	p.gopCacheLock.RUnlock()
+	return func() {
+		p.subscribersLock.Lock()
+		delete(p.subscribers, id)
+		p.subscribersLock.Unlock()
+	}
+}
+
+// publish 将包交给订阅者
+func (p *Pusher) publish(pack *RTPPack) {
+	p.subscribersLock.RLock()
+	for _, handle := range p.subscribers {
+		handle(pack)
+	}
+	p.subscribersLock.RUnlock()
+}
+
+// stop 推流结束，停止播放器并从服务端删除
+func (p *Pusher) stop() {
+	p.ClearPlayer()
+	p.Server().RemovePusher(p)
+	p.cond.L.Lock()
+	p.cond.Broadcast()
+	p.cond.L.Unlock()
+	for _, h := range p.StopHandles {
+		h()
+	}
+}
+
 func (p *Pusher) HasPlayer(player *Player) bool {
 	p.playersLock.Lock()
 	_, ok := p.players[player.ID]
@@ -116,7 +298,7 @@ func (p *Pusher) AddPlayer(player *Player) *Pusher {
 	if _, ok := p.players[player.ID]; !ok {
 		p.players[player.ID] = player
 		go player.Start()
-		p.Client.Println("%v start, now player size[%d]", player, len(p.players))
+		p.Println(fmt.Sprintf("%v start, now player size[%d]", player, len(p.players)))
 	}
 	p.playersLock.Unlock()
 	return p
@@ -129,18 +311,33 @@ func NewClientPusher(client *Client) *Pusher {
 		players:        make(map[string]*Player),
 		gopCacheEnable: true,
 		gopCache:       make([]*RTPPack, 0),
+		wallClock:      NewWallClock(nil),
+		history: map[RTPType]*packetHistory{
+			RTP_TYPE_AUDIO: newPacketHistory(),
+			RTP_TYPE_VIDEO: newPacketHistory(),
+		},
 
 		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: make([]*RTPPack, 0),
+
+		Filters:     NewFilterChain(),
+		subscribers: make(map[uint64]func(*RTPPack)),
+	}
+	// 兼容 EncryptPack/DecodePack，与之前一样只处理h264
+	if client.options.IsEncrypt {
+		pusher.Filters.AddTrack(RTP_TYPE_VIDEO, NewPayloadEncryptFilter(func(payload []byte, seq uint16) []byte {
+			return client.EncryptPack(payload, seq)
+		}))
+	}
+	if client.options.IsDecode {
+		pusher.Filters.AddTrack(RTP_TYPE_VIDEO, NewPayloadDecryptFilter(func(payload []byte) []byte {
+			return client.DecodePack(payload)
+		}))
 	}
 	client.RTPHandles = append(client.RTPHandles, func(pack *RTPPack) {
 		pusher.QueueRTP(pack)
 	})
-	client.StopHandles = append(client.StopHandles, func() {
-		pusher.ClearPlayer()
-		pusher.Server().RemovePusher(pusher)
-		pusher.cond.Broadcast()
-	})
+	client.StopHandles = append(client.StopHandles, pusher.stop)
 	return pusher
 }
 
@@ -152,9 +349,17 @@ func NewPusher(s *Session) *Pusher {
 		players:        make(map[string]*Player),
 		gopCacheEnable: true,
 		gopCache:       make([]*RTPPack, 0),
+		wallClock:      NewWallClock(nil),
+		history: map[RTPType]*packetHistory{
+			RTP_TYPE_AUDIO: newPacketHistory(),
+			RTP_TYPE_VIDEO: newPacketHistory(),
+		},
 
 		cond:  sync.NewCond(&sync.Mutex{}),
 		queue: make([]*RTPPack, 0),
+
+		Filters:     NewFilterChain(),
+		subscribers: make(map[uint64]func(*RTPPack)),
 	}
 	pusher.bindSession(s)
 	return pusher
@@ -169,6 +374,15 @@ func (p *Pusher) QueueRTP(pack *RTPPack) *Pusher {
 	return p
 }
 
+// Println 推流端为客户端时按客户端的debug设置输出日志
+func (p *Pusher) Println(v ...interface{}) {
+	if p.Client != nil {
+		p.Client.Println(v...)
+		return
+	}
+	log.Println(v...)
+}
+
 // ClearPlayer 清理播放器
 func (p *Pusher) ClearPlayer() {
 	p.playersLock.Lock()
@@ -191,7 +405,7 @@ func (p *Pusher) RemovePlayer(player *Player) *Pusher {
 	}
 
 	delete(p.players, player.ID)
-	p.Client.Println("%v end, now player size[%d]\n", player, len(p.players))
+	p.Println(fmt.Sprintf("%v end, now player size[%d]", player, len(p.players)))
 	p.playersLock.Unlock()
 	return p
 }
@@ -200,25 +414,33 @@ func (p *Pusher) bindSession(s *Session) {
 	p.Session = s
 	s.RTPHandles = append(s.RTPHandles, func(pack *RTPPack) {
 		if s != p.Session {
-			p.Client.Println("Session recv rtp to pusher.but pusher got a new session[%v].", p.Session.ID)
+			p.Println(fmt.Sprintf("Session recv rtp to pusher.but pusher got a new session[%v].", p.Session.ID))
 			return
 		}
 		p.QueueRTP(pack)
 	})
 	s.StopHandles = append(s.StopHandles, func() {
 		if s != p.Session {
-			p.Client.Println("Session stop to release pusher.but pusher got a new session[%v].", p.Session.ID)
+			p.Println(fmt.Sprintf("Session stop to release pusher.but pusher got a new session[%v].", p.Session.ID))
 			return
 		}
-		p.ClearPlayer()
-		p.Server().RemovePusher(p)
-		p.cond.Broadcast()
+		p.stop()
 	})
 }
 
+// rebindSource 拉流客户端重连后切换到新的源，与 RebindSession 一样清空GOP缓存和采集时间，
+// 各路媒体的第一个rtp包标记为不连续，播放器在此处将各路媒体对齐到同一个切换时刻
+func (p *Pusher) rebindSource() {
+	p.gopCacheLock.Lock()
+	p.gopCache = make([]*RTPPack, 0)
+	p.gopCacheLock.Unlock()
+	p.wallClock.Reset(p.clockRates())
+	p.discontinuity = map[RTPType]bool{RTP_TYPE_VIDEO: true, RTP_TYPE_AUDIO: true}
+}
+
 func (p *Pusher) RebindSession(session *Session) bool {
 	if p.Client != nil {
-		p.Client.Println("call RebindSession[%s] to a Client-Pusher. got false", session.ID)
+		p.Println(fmt.Sprintf("call RebindSession[%s] to a Client-Pusher. got false", session.ID))
 		return false
 	}
 
@@ -229,6 +451,8 @@ func (p *Pusher) RebindSession(session *Session) bool {
 	p.gopCache = make([]*RTPPack, 0)
 	p.gopCacheLock.Unlock()
 
+	p.wallClock.Reset(p.clockRates())
+
 	if p.Session != nil {
 		p.Session.Stop()
 	}
@@ -237,11 +461,13 @@ func (p *Pusher) RebindSession(session *Session) bool {
 
 // Start 启动推流
 func (p *Pusher) Start() {
+	p.wallClock.Reset(p.clockRates())
 	for !p.Stopped() {
 		var pack *RTPPack
 		p.cond.L.Lock()
 
-		if len(p.queue) == 0 {
+		// 结束标记在加锁唤醒之前设置，加锁后再次判断避免错过唤醒
+		if len(p.queue) == 0 && !p.Stopped() {
 			p.cond.Wait()
 		}
 
@@ -253,43 +479,94 @@ func (p *Pusher) Start() {
 
 		if pack == nil {
 			if !p.Stopped() {
-				p.Client.Println("pusher not stopped, but queue take out nil pack")
+				p.Println("pusher not stopped, but queue take out nil pack")
 			}
 			continue
 		}
 
-		if p.gopCacheEnable && pack.Type == RTP_TYPE_VIDEO {
-			p.gopCacheLock.Lock()
-			packBuffer := pack.Buffer.Bytes()
-			if rtp := ParseRTP(packBuffer); rtp != nil && p.isKeyframe(rtp) {
-				p.gopCache = make([]*RTPPack, 0)
-				payload := make([]byte, 0)
-				if p.Client.options.IsEncrypt {
-					payload = p.Client.EncryptPack(rtp.Payload[2:], uint16(rtp.SequenceNumber))
-				}
-				if p.Client.options.IsDecode {
-					payload = p.Client.DecodePack(rtp.Payload[2:])
-				}
-				rtp.Payload = append(rtp.Payload[:2], payload...)
-				pack.Buffer = bytes.NewBuffer(append(packBuffer[:rtp.PayloadOffset], rtp.Payload...))
+		if pack.Discontinuity {
+			p.rebindSource()
+		}
+		if isRTCP(pack.Type) {
+			// rtcp由各播放器单独生成，推流端的rtcp不再转发
+			p.wallClock.OnRTCP(pack)
+			p.publish(pack)
+			continue
+		}
+		for _, pack := range p.Filters.process(pack, p.SDPInfo) {
+			if p.discontinuity[pack.Type] {
+				// 过滤链可能丢弃或重新生成包，标记在输出的第一个包上
+				marked := *pack
+				marked.Discontinuity = true
+				pack = &marked
+				delete(p.discontinuity, pack.Type)
 			}
-			p.gopCache = append(p.gopCache, pack)
-			p.gopCacheLock.Unlock()
+			p.dispatch(pack)
 		}
-		p.BroadcastRTP(pack)
 	}
 }
 
+// dispatch 缓存经过过滤链的rtp包并转发给播放端
+func (p *Pusher) dispatch(pack *RTPPack) {
+	if t, ok := p.wallClock.OnRTP(pack, time.Now()); ok {
+		// 原包可能仍被客户端的其他处理函数读取，采集时间设置在副本上
+		stamped := *pack
+		stamped.CaptureTime = t
+		pack = &stamped
+	}
+	if history := p.history[pack.Type]; history != nil {
+		history.push(pack)
+	}
+
+	var rtp *RTPInfo
+	if pack.Type == RTP_TYPE_VIDEO {
+		if rtp = ParseRTP(pack.Buffer.Bytes()); rtp != nil {
+			p.updateParameterSets(rtp)
+		}
+	}
+
+	p.BroadcastRTP(pack)
+	p.gopCacheLock.Lock()
+	if p.gopCacheEnable && pack.Type == RTP_TYPE_VIDEO {
+		if rtp != nil && p.isKeyframe(rtp) {
+			p.gopCache = make([]*RTPPack, 0)
+		}
+		p.gopCache = append(p.gopCache, pack)
+	}
+	p.publish(pack)
+	p.gopCacheLock.Unlock()
+}
+
 func (p *Pusher) isKeyframe(rtp *RTPInfo) bool {
-	if strings.EqualFold(p.VCodec(), "h264") {
+	return rtpKeyframe(strings.ToLower(p.VCodec()), p.h265DONL(), rtp.Payload)
+}
+
+// rtpKeyframe 视频rtp负载是否为关键帧的开始，codec为小写的编码名称
+// donl 为true时h265的聚合包中携带DONL字段
+func rtpKeyframe(codec string, donl bool, payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	if codec == "h264" {
 		var realNALU uint8
-		payloadHeader := rtp.Payload[0]
+		payloadHeader := payload[0]
 		t := payloadHeader & 0x1F
 		switch {
 		case t <= 23:
 			realNALU = payloadHeader
+		case t == 24:
+			// STAP-A 中可能是 SPS+PPS+IDR
+			for _, nalu := range h264AggregatedNALUs(payload) {
+				if nalu[0]&0x1F == 0x05 {
+					return true
+				}
+			}
+			return false
 		case t == 28 || t == 29:
-			realNALU = rtp.Payload[1]
+			if len(payload) < 2 {
+				return false
+			}
+			realNALU = payload[1]
 			if realNALU&0x80 == 0 {
 				return false
 			}
@@ -302,5 +579,125 @@ func (p *Pusher) isKeyframe(rtp *RTPInfo) bool {
 		}
 		return false
 	}
+	if codec == "h265" {
+		// h265 payload header 为2字节，NALU类型为第一个字节的第2~7位
+		// 48为聚合包(AP)，49为分片包(FU)，16~21为IRAP(BLA/IDR/CRA)
+		if len(payload) < 3 {
+			return false
+		}
+		switch t := (payload[0] >> 1) & 0x3F; {
+		case t == 49:
+			// FU header: |S|E| FuType |，只在起始分片上判断
+			if payload[2]&0x80 == 0 {
+				return false
+			}
+			return isH265IRAP(payload[2] & 0x3F)
+		case t == 48:
+			for _, nalu := range h265AggregatedNALUs(payload, donl) {
+				if isH265IRAP((nalu[0] >> 1) & 0x3F) {
+					return true
+				}
+			}
+			return false
+		default:
+			return isH265IRAP(t)
+		}
+	}
+	if codec == "vp8" {
+		start, offset, err := parseVP8Descriptor(payload)
+		return err == nil && start && vp8.IsKeyframe(payload[offset:])
+	}
+	if codec == "vp9" {
+		desc, err := parseVP9Descriptor(payload)
+		return err == nil && desc.start && !desc.interPredicted && vp9.IsKeyframe(payload[desc.offset:])
+	}
+	if codec == "av1" {
+		// aggregation header 的N位表示新的编码视频序列的第一个包
+		return len(payload) > 0 && payload[0]&0x08 != 0
+	}
+	if codec == "jpeg" {
+		// jpeg每帧都可独立解码，分片偏移为0的包是一帧的开始
+		return len(payload) >= 8 && payload[1] == 0 && payload[2] == 0 && payload[3] == 0
+	}
+	return false
+}
+
+// h265DONL 推流端是否在h265的聚合包和分片包中携带DONL字段
+func (p *Pusher) h265DONL() bool {
+	if info := p.SDPInfo("video"); info != nil {
+		return info.MaxDonDiff > 0
+	}
 	return false
 }
+
+// isH265IRAP h265 NALU类型是否为IRAP(16~21)
+func isH265IRAP(t uint8) bool {
+	return t >= 16 && t <= 21
+}
+
+// h264AggregatedNALUs 获取单一NALU包或STAP-A包中的NALU
+func h264AggregatedNALUs(payload []byte) [][]byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	var nalus [][]byte
+	switch t := payload[0] & 0x1F; {
+	case t >= 1 && t <= 23:
+		nalus = append(nalus, payload)
+	case t == 24: // STAP-A
+		payload = payload[1:]
+		for len(payload) > 2 {
+			size := int(payload[0])<<8 | int(payload[1])
+			if size == 0 || len(payload)-2 < size {
+				break
+			}
+			nalus = append(nalus, payload[2:2+size])
+			payload = payload[2+size:]
+		}
+	}
+	return nalus
+}
+
+// h265AggregatedNALUs 获取单一NALU包或聚合包(AP)中的NALU
+// donl 为true时，第一个NALU前有2字节DONL，其余NALU前有1字节DOND
+func h265AggregatedNALUs(payload []byte, donl bool) [][]byte {
+	if len(payload) < 2 {
+		return nil
+	}
+	var nalus [][]byte
+	switch t := (payload[0] >> 1) & 0x3F; {
+	case t < 48:
+		nalus = append(nalus, payload)
+	case t == 48: // AP
+		payload = payload[2:]
+		for i := 0; len(payload) > 0; i++ {
+			if donl {
+				skip := 1
+				if i == 0 {
+					skip = 2
+				}
+				if len(payload) < skip {
+					break
+				}
+				payload = payload[skip:]
+			}
+			if len(payload) < 2 {
+				break
+			}
+			size := int(payload[0])<<8 | int(payload[1])
+			if size < 2 || len(payload)-2 < size {
+				break
+			}
+			nalus = append(nalus, payload[2:2+size])
+			payload = payload[2+size:]
+		}
+	}
+	return nalus
+}
+
+// updateParameterSets 从带内的rtp包中获取VPS/SPS/PPS，SPS变化时记录新的视频参数
+func (p *Pusher) updateParameterSets(rtp *RTPInfo) {
+	if p.paramSets.update(p.VCodec(), p.h265DONL(), rtp) {
+		log.Println(fmt.Sprintf("pusher[%s] video sps changed: %v", p.Path(), p.VideoParams()))
+	}
+}
@@ -0,0 +1,242 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// newTestPusher 只有sdp的拉流推流
+func newTestPusher(sdp string) *Pusher {
+	return NewClientPusher(&Client{Path: "/live/cam", SDPRaw: sdp})
+}
+
+// testVideoSource 25fps的h264视频，每gop帧一个IDR
+type testVideoSource struct {
+	packetizer Packetizer
+	sps, pps   []byte
+	gop        int
+	next       int
+}
+
+func newTestVideoSource(gop int) (*testVideoSource, string) {
+	sdp, sps, pps := testRecorderSDP()
+	var zero uint32
+	return &testVideoSource{
+		packetizer: NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 1200, InitialTimestamp: &zero}),
+		sps:        sps,
+		pps:        pps,
+		gop:        gop,
+	}, sdp
+}
+
+// h265Header h265 NALU头，layer id为0，tid为1
+func h265Header(t uint8) []byte {
+	return []byte{t << 1, 0x01}
+}
+
+// testH265AP 按RFC 7798组装聚合包，donl 为true时携带DONL/DOND
+func testH265AP(donl bool, nalus ...[]byte) []byte {
+	payload := h265Header(48)
+	for i, nalu := range nalus {
+		if donl {
+			if i == 0 {
+				payload = append(payload, 0x00, 0x00)
+			} else {
+				payload = append(payload, 0x00)
+			}
+		}
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	return payload
+}
+
+// testSTAPA 按RFC 6184组装STAP-A
+func testSTAPA(nalus ...[]byte) []byte {
+	payload := []byte{0x78}
+	for _, nalu := range nalus {
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	return payload
+}
+
+func TestRTPKeyframe(t *testing.T) {
+	idr := append(h265Header(19), 0xAA, 0xBB)
+	trail := append(h265Header(1), 0xAA, 0xBB)
+	vps := append(h265Header(32), 0x0c, 0x01)
+	tests := []struct {
+		name    string
+		codec   string
+		donl    bool
+		payload []byte
+		want    bool
+	}{
+		{"h264 idr", "h264", false, []byte{0x65, 0x88}, true},
+		{"h264 non idr", "h264", false, []byte{0x41, 0x9a}, false},
+		{"h264 fu-a idr start", "h264", false, []byte{0x7c, 0x85, 0x88}, true},
+		{"h264 fu-a idr middle", "h264", false, []byte{0x7c, 0x05, 0x88}, false},
+		{"h264 fu-a non idr", "h264", false, []byte{0x7c, 0x81, 0x9a}, false},
+		{"h264 fu-a truncated", "h264", false, []byte{0x7c}, false},
+		{"h264 stap-a param sets and idr", "h264", false, testSTAPA([]byte{0x67, 0x42}, []byte{0x68, 0xce}, []byte{0x65, 0x88}), true},
+		{"h264 stap-a non idr", "h264", false, testSTAPA([]byte{0x09, 0xf0}, []byte{0x41, 0x9a}), false},
+		{"h264 stap-a truncated", "h264", false, []byte{0x78, 0x00, 0x05, 0x65}, false},
+		{"empty", "h264", false, nil, false},
+		{"h265 bla", "h265", false, append(h265Header(16), 0xAA), true},
+		{"h265 idr w radl", "h265", false, append(h265Header(19), 0xAA), true},
+		{"h265 idr n lp", "h265", false, append(h265Header(20), 0xAA), true},
+		{"h265 cra", "h265", false, append(h265Header(21), 0xAA), true},
+		{"h265 reserved irap", "h265", false, append(h265Header(22), 0xAA), false},
+		{"h265 trail", "h265", false, trail, false},
+		{"h265 vps", "h265", false, vps, false},
+		{"h265 truncated", "h265", false, h265Header(19), false},
+		{"h265 fu idr start", "h265", false, append(h265Header(49), 0x80|19, 0xAA), true},
+		{"h265 fu cra start", "h265", false, append(h265Header(49), 0x80|21, 0xAA), true},
+		{"h265 fu idr end", "h265", false, append(h265Header(49), 0x40|19, 0xAA), false},
+		{"h265 fu trail start", "h265", false, append(h265Header(49), 0x80|1, 0xAA), false},
+		{"h265 ap param sets and idr", "h265", false, testH265AP(false, vps, idr), true},
+		{"h265 ap trail", "h265", false, testH265AP(false, vps, trail), false},
+		{"h265 ap donl", "h265", true, testH265AP(true, vps, idr), true},
+		// 没有按DONL解析时NALU长度错位，找不到IRAP
+		{"h265 ap donl mismatch", "h265", false, testH265AP(true, vps, idr), false},
+		{"unknown codec", "mpv", false, []byte{0x65, 0x88}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rtpKeyframe(tt.codec, tt.donl, tt.payload); got != tt.want {
+				t.Errorf("rtpKeyframe = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestH265AggregatedNALUs(t *testing.T) {
+	idr := append(h265Header(19), 0xAA, 0xBB)
+	vps := append(h265Header(32), 0x0c, 0x01)
+	tests := []struct {
+		name    string
+		donl    bool
+		payload []byte
+		nalus   [][]byte
+	}{
+		{"single", false, idr, [][]byte{idr}},
+		{"ap", false, testH265AP(false, vps, idr), [][]byte{vps, idr}},
+		{"ap donl", true, testH265AP(true, vps, idr), [][]byte{vps, idr}},
+		{"ap truncated", false, testH265AP(false, vps, idr)[:10], [][]byte{vps}},
+		{"fu", false, append(h265Header(49), 0x80|19, 0xAA), nil},
+		{"too short", false, []byte{0x26}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nalus := h265AggregatedNALUs(tt.payload, tt.donl)
+			if len(nalus) != len(tt.nalus) {
+				t.Fatalf("got %d nalus, want %d", len(nalus), len(tt.nalus))
+			}
+			for i := range nalus {
+				if !bytes.Equal(nalus[i], tt.nalus[i]) {
+					t.Errorf("nalu %d = %x, want %x", i, nalus[i], tt.nalus[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPusherH265DONL(t *testing.T) {
+	tests := []struct {
+		name string
+		fmtp string
+		want bool
+	}{
+		{"no fmtp", "", false},
+		{"max don diff 0", "a=fmtp:96 sprop-max-don-diff=0\r\n", false},
+		{"max don diff", "a=fmtp:96 sprop-max-don-diff=2;sprop-vps=QAEMAf//AWAAAAMAkAAAAwAAAwB4lZgJ\r\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pusher := newTestPusher("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=cam\r\nt=0 0\r\n" +
+				"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H265/90000\r\n" + tt.fmtp + "a=control:trackID=0\r\n")
+			// 客户端在SETUP时按rtpmap设置编码名称
+			pusher.Client.VCodec = "H265"
+			if got := pusher.h265DONL(); got != tt.want {
+				t.Errorf("h265DONL = %v, want %v", got, tt.want)
+			}
+			rtp := &RTPInfo{Payload: testH265AP(tt.want, h265Header(32), append(h265Header(21), 0xAA))}
+			if !pusher.isKeyframe(rtp) {
+				t.Errorf("cra in aggregation packet not detected")
+			}
+		})
+	}
+}
+
+// TestClientPusherStop 拉流结束后推流的Start协程退出
+func TestClientPusherStop(t *testing.T) {
+	client := NewRTSPClient(ClientOptions{})
+	client.Server = NewRTSPServer(0)
+	pusher := NewClientPusher(client)
+	done := make(chan struct{})
+	go func() {
+		pusher.Start()
+		close(done)
+	}()
+	client.finish()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pusher start loop not stopped")
+	}
+	if !client.Stopped || !pusher.Stopped() {
+		t.Errorf("client stopped %v, pusher stopped %v", client.Stopped, pusher.Stopped())
+	}
+}
+
+// TestPusherSubscribeDuringDispatch 推流过程中订阅，缓存的GOP和之后发布的包不重复也不遗漏
+func TestPusherSubscribeDuringDispatch(t *testing.T) {
+	source, sdp := newTestVideoSource(5)
+	pusher := newTestPusher(sdp)
+	pusher.Client.VCodec = "H264"
+	var packs []*RTPPack
+	for i := 0; i < 100; i++ {
+		nalus := [][]byte{testNALU([]byte{0x41, 0x9A}, 200)}
+		if i%source.gop == 0 {
+			nalus = [][]byte{source.sps, source.pps, testNALU([]byte{0x65, 0x88}, 1000)}
+		}
+		out, err := source.packetizer.Packetize(&AccessUnit{PTS: time.Duration(i) * 40 * time.Millisecond, NALUs: nalus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range out {
+			pack.Type = RTP_TYPE_VIDEO
+			packs = append(packs, pack)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, pack := range packs {
+			pusher.dispatch(pack)
+		}
+		close(done)
+	}()
+	// 订阅者的回调都在推流协程中调用，推流结束后再读取
+	var seqs []*[]int
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		got := new([]int)
+		seqs = append(seqs, got)
+		pusher.Subscribe(func(pack *RTPPack) {
+			*got = append(*got, ParseRTP(pack.Buffer.Bytes()).SequenceNumber)
+		})
+	}
+	for i, got := range seqs {
+		for j := 1; j < len(*got); j++ {
+			if uint16((*got)[j]-(*got)[j-1]) != 1 {
+				t.Fatalf("subscriber %d: seq %d after %d", i, (*got)[j], (*got)[j-1])
+			}
+		}
+	}
+}
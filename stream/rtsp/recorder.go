@@ -0,0 +1,374 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/fmp4"
+)
+
+// recorderQueueSize 录制队列的长度，写文件跟不上时丢包，之后从下一个关键帧恢复
+const recorderQueueSize = 1024
+
+// RecorderOptions fmp4录制参数
+type RecorderOptions struct {
+	// PathTemplate 文件路径模板，{path}替换为流的路径，{start}替换为文件开始时间，{index}替换为文件序号
+	// 默认为 record/{path}/{start}.mp4
+	PathTemplate string
+	// TimeFormat {start}的时间格式，默认为 20060102150405
+	TimeFormat string
+	// SegmentDuration 文件时长，达到后在下一个关键帧处切换文件，为0时不按时长切换
+	SegmentDuration time.Duration
+	// SegmentSize 文件大小(字节)，达到后在下一个关键帧处切换文件，为0时不按大小切换
+	SegmentSize int64
+	// FragmentDuration 每个分片(moof+mdat)的时长，默认为1秒
+	FragmentDuration time.Duration
+}
+
+// RecordSegment 录制完成的一个文件
+type RecordSegment struct {
+	Path     string
+	Start    time.Time
+	Duration time.Duration
+	Size     int64
+}
+
+func (s *RecordSegment) String() string {
+	return fmt.Sprintf("record[%s] start[%s] duration[%v] size[%d]", s.Path, s.Start.Format(time.RFC3339), s.Duration, s.Size)
+}
+
+// Recorder 将h264/h265/aac/opus的rtp包录制为分段的fmp4文件
+// 有视频时每个文件从关键帧开始，丢包后丢弃视频直到下一个关键帧，源发生变化时开始新的文件
+type Recorder struct {
+	options RecorderOptions
+	path    string
+	reader  *FrameReader
+
+	// SegmentHandles 每个文件录制完成后调用
+	SegmentHandles []func(*RecordSegment)
+
+	lock        sync.Mutex
+	closed      bool
+	queue       chan *RTPPack
+	done        chan struct{}
+	unsubscribe func()
+
+	segment *recordSegment
+	index   int
+}
+
+// recordTrack 一路媒体在当前文件中的状态，样本的解码时间为相对文件开始的时钟计数
+type recordTrack struct {
+	timeScale int
+	// start 文件开始处在时间轴上的时钟计数
+	start  int64
+	buffer *fmp4.TrackBuffer
+}
+
+// recordSegment 正在录制的文件
+type recordSegment struct {
+	file     *os.File
+	info     RecordSegment
+	ref      RTPType
+	tracks   map[RTPType]*recordTrack
+	sequence uint32
+	// start 第一帧在时间轴上的DTS
+	start time.Duration
+	// 当前分片开始时参考媒体的解码时间
+	fragmentStart int64
+	// 视频的参数集，变化时切换文件
+	videoParams [][]byte
+}
+
+// NewRecorder 创建录制，path 为流的路径，sdp 返回当前的sdp
+// 通过 WriteRTP 写入rtp和rtcp包，Close 结束录制
+func NewRecorder(path string, sdp func() string, options RecorderOptions) *Recorder {
+	if options.PathTemplate == "" {
+		options.PathTemplate = "record/{path}/{start}.mp4"
+	}
+	if options.TimeFormat == "" {
+		options.TimeFormat = "20060102150405"
+	}
+	if options.FragmentDuration <= 0 {
+		options.FragmentDuration = time.Second
+	}
+	r := &Recorder{
+		options: options,
+		path:    path,
+		reader:  NewFrameReader(sdp),
+		queue:   make(chan *RTPPack, recorderQueueSize),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// RecordPusher 录制推流，推流结束时自动结束录制
+func RecordPusher(pusher *Pusher, options RecorderOptions) *Recorder {
+	r := NewRecorder(pusher.Path(), pusher.SDPRaw, options)
+	r.unsubscribe = pusher.Subscribe(r.WriteRTP)
+	pusher.StopHandles = append(pusher.StopHandles, func() {
+		r.Close()
+	})
+	return r
+}
+
+// RecordClient 录制拉流客户端收到的包，客户端停止时自动结束录制
+// 需要在客户端开始拉流前调用
+func RecordClient(client *Client, options RecorderOptions) *Recorder {
+	path := client.options.CustomPath
+	if path == "" {
+		path = client.Path
+	}
+	r := NewRecorder(path, func() string {
+		return client.SDPRaw
+	}, options)
+	client.RTPHandles = append(client.RTPHandles, r.WriteRTP)
+	client.StopHandles = append(client.StopHandles, func() {
+		r.Close()
+	})
+	return r
+}
+
+// WriteRTP 写入一个rtp或rtcp包，不阻塞，队列满时丢弃
+func (r *Recorder) WriteRTP(pack *RTPPack) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- pack:
+	default:
+	}
+}
+
+// Close 结束录制，写完队列中的包并关闭当前文件
+func (r *Recorder) Close() {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.queue)
+	r.lock.Unlock()
+	if r.unsubscribe != nil {
+		r.unsubscribe()
+	}
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for pack := range r.queue {
+		r.handle(pack)
+	}
+	r.closeSegment()
+}
+
+// handle 处理一个包
+func (r *Recorder) handle(pack *RTPPack) {
+	for _, frame := range r.reader.ReadRTP(pack) {
+		r.writeFrame(frame)
+	}
+}
+
+// reference 决定文件切换和分片的媒体，有视频时为视频
+func (r *Recorder) reference() RTPType {
+	if r.reader.Codec(RTP_TYPE_VIDEO) != "" {
+		return RTP_TYPE_VIDEO
+	}
+	return RTP_TYPE_AUDIO
+}
+
+// writeFrame 写入一帧，参考媒体的关键帧处开始或切换文件
+func (r *Recorder) writeFrame(frame *Frame) {
+	isRef := frame.Type == r.reference()
+	if isRef && frame.Keyframe && (r.segment == nil || frame.Discontinuity || r.shouldRotate(frame)) {
+		if seg := r.segment; seg != nil && !frame.Discontinuity {
+			// 切换处已知下一帧的时间，上一帧的时长延续到切换处
+			if track := seg.tracks[frame.Type]; track != nil {
+				track.buffer.End(rtpTicks(frame.DTS, track.timeScale) - track.start)
+			}
+		}
+		r.closeSegment()
+		if err := r.openSegment(frame); err != nil {
+			log.Println(fmt.Errorf("recorder[%s] open file error:%s", r.path, err))
+			r.closeSegment()
+			return
+		}
+	}
+	seg := r.segment
+	if seg == nil {
+		return
+	}
+	track := seg.tracks[frame.Type]
+	if track == nil {
+		return
+	}
+
+	dts := rtpTicks(frame.DTS, track.timeScale) - track.start
+	if dts < 0 {
+		// 早于文件开始的帧
+		return
+	}
+	sample := &fmp4.Sample{PTSOffset: int32(rtpTicks(frame.PTS, track.timeScale) - track.start - dts)}
+	if frame.Type == RTP_TYPE_VIDEO {
+		sample.IsNonSyncSample = !frame.Keyframe
+		sample.Payload = codec.JoinAVCC(frame.NALUs)
+	} else {
+		sample.Payload = frame.Data
+	}
+	track.buffer.Push(dts, sample)
+	if isRef && dts-seg.fragmentStart >= rtpTicks(r.options.FragmentDuration, track.timeScale) {
+		if err := seg.flushFragment(); err != nil {
+			log.Println(fmt.Errorf("recorder[%s] write file error:%s", r.path, err))
+			r.closeSegment()
+			return
+		}
+		seg.fragmentStart = dts
+	}
+}
+
+// shouldRotate 参考媒体的关键帧处是否需要切换文件
+func (r *Recorder) shouldRotate(frame *Frame) bool {
+	seg := r.segment
+	if frame.Type == RTP_TYPE_VIDEO && !paramSetsEqual(seg.videoParams, r.reader.ParameterSets()) {
+		return true
+	}
+	if r.options.SegmentSize > 0 && seg.info.Size >= r.options.SegmentSize {
+		return true
+	}
+	return r.options.SegmentDuration > 0 && frame.DTS-seg.start >= r.options.SegmentDuration
+}
+
+// openSegment 以参考媒体的一帧开始新的文件，写入初始化段，参考媒体缺少编码参数时返回错误
+func (r *Recorder) openSegment(frame *Frame) error {
+	seg := &recordSegment{ref: frame.Type, tracks: make(map[RTPType]*recordTrack), sequence: 1, start: frame.DTS}
+	init := &fmp4.Init{}
+	for _, t := range r.reader.Tracks() {
+		codec, err := r.reader.FMP4Codec(t)
+		if err != nil {
+			if t == frame.Type {
+				return err
+			}
+			continue
+		}
+		id := len(init.Tracks) + 1
+		track := &recordTrack{timeScale: r.reader.ClockRate(t), buffer: fmp4.NewTrackBuffer(id)}
+		track.start = rtpTicks(frame.DTS, track.timeScale)
+		seg.tracks[t] = track
+		init.Tracks = append(init.Tracks, &fmp4.Track{ID: id, TimeScale: uint32(track.timeScale), Codec: codec})
+	}
+	if frame.Type == RTP_TYPE_VIDEO {
+		seg.videoParams = r.reader.ParameterSets()
+	}
+	b, err := init.Marshal()
+	if err != nil {
+		return err
+	}
+
+	seg.info.Start = frame.CaptureTime
+	if seg.info.Start.IsZero() {
+		seg.info.Start = time.Now()
+	}
+	r.index++
+	seg.info.Path = r.segmentPath(seg.info.Start)
+	if err := os.MkdirAll(filepath.Dir(seg.info.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(seg.info.Path)
+	if err != nil {
+		return err
+	}
+	seg.file = file
+	r.segment = seg
+	return seg.write(b)
+}
+
+// segmentPath 按模板生成文件路径，流路径中的 . 和 .. 被去掉
+func (r *Recorder) segmentPath(start time.Time) string {
+	var parts []string
+	for _, part := range strings.Split(r.path, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.NewReplacer(
+		"{path}", strings.Join(parts, "/"),
+		"{start}", start.Format(r.options.TimeFormat),
+		"{index}", strconv.Itoa(r.index),
+	).Replace(r.options.PathTemplate)
+}
+
+// write 写入文件
+func (seg *recordSegment) write(b []byte) error {
+	n, err := seg.file.Write(b)
+	seg.info.Size += int64(n)
+	return err
+}
+
+// flushFragment 将各路媒体已确定时长的样本写为一个分片
+func (seg *recordSegment) flushFragment() error {
+	fragment := &fmp4.Fragment{SequenceNumber: seg.sequence}
+	for _, t := range []RTPType{RTP_TYPE_VIDEO, RTP_TYPE_AUDIO} {
+		if track := seg.tracks[t]; track != nil {
+			if tf := track.buffer.Fragment(); tf != nil {
+				fragment.Tracks = append(fragment.Tracks, tf)
+			}
+		}
+	}
+	if len(fragment.Tracks) == 0 {
+		return nil
+	}
+	seg.sequence++
+	return seg.write(fragment.Marshal())
+}
+
+// closeSegment 写入剩余的样本并关闭文件，最后一帧的时长沿用上一帧
+func (r *Recorder) closeSegment() {
+	seg := r.segment
+	if seg == nil {
+		return
+	}
+	r.segment = nil
+	for _, track := range seg.tracks {
+		track.buffer.Close()
+	}
+	if ref := seg.tracks[seg.ref]; ref != nil {
+		end, _ := ref.buffer.EndTime()
+		seg.info.Duration = timestampToDuration(end, ref.timeScale)
+	}
+	err := seg.flushFragment()
+	if e := seg.file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("recorder[%s] close file error:%s", r.path, err))
+	}
+	for _, h := range r.SegmentHandles {
+		h(&seg.info)
+	}
+}
+
+// paramSetsEqual 参数集是否相同
+func paramSetsEqual(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
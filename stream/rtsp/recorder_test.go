@@ -0,0 +1,159 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp4Boxes 顶层box的类型和内容
+func mp4Boxes(t *testing.T, b []byte) ([]string, [][]byte) {
+	t.Helper()
+	var (
+		types  []string
+		bodies [][]byte
+	)
+	for len(b) > 0 {
+		if len(b) < 8 || int(binary.BigEndian.Uint32(b)) < 8 || int(binary.BigEndian.Uint32(b)) > len(b) {
+			t.Fatalf("invalid box, %d bytes left", len(b))
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		types = append(types, string(b[4:8]))
+		bodies = append(bodies, b[8:size])
+		b = b[size:]
+	}
+	return types, bodies
+}
+
+// testRecorderSDP 只有h264视频的sdp
+func testRecorderSDP() (string, []byte, []byte) {
+	sps := mustHex("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := []byte{0x68, 0xcb, 0x83, 0xcb, 0x20}
+	sdp := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=camera\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+		fmt.Sprintf("a=fmtp:96 packetization-mode=1;sprop-parameter-sets=%s,%s\r\n",
+			base64.StdEncoding.EncodeToString(sps), base64.StdEncoding.EncodeToString(pps)) +
+		"a=control:trackID=0\r\n"
+	return sdp, sps, pps
+}
+
+func TestRecorderSegments(t *testing.T) {
+	sdp, sps, pps := testRecorderSDP()
+	dir := t.TempDir()
+	r := NewRecorder("/live/../cam", func() string { return sdp }, RecorderOptions{
+		PathTemplate:     filepath.Join(dir, "{path}/{index}.mp4"),
+		SegmentDuration:  400 * time.Millisecond,
+		FragmentDuration: 100 * time.Millisecond,
+	})
+	var segments []*RecordSegment
+	r.SegmentHandles = append(r.SegmentHandles, func(s *RecordSegment) {
+		segments = append(segments, s)
+	})
+
+	// 30帧，25fps，每5帧一个IDR
+	var zero uint32
+	p := NewH264Packetizer(PacketizerOptions{SSRC: 1, MTU: 1200, InitialTimestamp: &zero})
+	for f := 0; f < 30; f++ {
+		nalus := [][]byte{testNALU([]byte{0x41, 0x9A}, 500)}
+		if f%5 == 0 {
+			nalus = [][]byte{sps, pps, testNALU([]byte{0x65, 0x88}, 3000)}
+		}
+		packs, err := p.Packetize(&AccessUnit{PTS: time.Duration(f) * 40 * time.Millisecond, NALUs: nalus})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pack := range packs {
+			pack.Type = RTP_TYPE_VIDEO
+			r.WriteRTP(pack)
+		}
+	}
+	r.Close()
+	// 关闭后写入被忽略
+	r.WriteRTP(&RTPPack{Type: RTP_TYPE_VIDEO})
+	r.Close()
+
+	// 满400ms后在下一个IDR处切换文件
+	if len(segments) != 3 {
+		t.Fatalf("segments %d, want 3", len(segments))
+	}
+	for i, seg := range segments {
+		t.Run(fmt.Sprintf("segment %d", i+1), func(t *testing.T) {
+			if want := filepath.Join(dir, "live/cam", fmt.Sprintf("%d.mp4", i+1)); seg.Path != want {
+				t.Errorf("path %s, want %s", seg.Path, want)
+			}
+			if seg.Duration != 400*time.Millisecond {
+				t.Errorf("duration %v", seg.Duration)
+			}
+			b, err := os.ReadFile(seg.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(b)) != seg.Size {
+				t.Errorf("size %d, file %d", seg.Size, len(b))
+			}
+			types, bodies := mp4Boxes(t, b)
+			if len(types) < 4 || types[0] != "ftyp" || types[1] != "moov" {
+				t.Fatalf("boxes %v", types)
+			}
+			samples := 0
+			for j := 2; j < len(types); j += 2 {
+				if types[j] != "moof" || j+1 >= len(types) || types[j+1] != "mdat" {
+					t.Fatalf("boxes %v", types)
+				}
+				// moof: mfhd, traf(tfhd, tfdt, trun)
+				moof := bodies[j]
+				if seq := binary.BigEndian.Uint32(moof[12:]); seq != uint32(j/2) {
+					t.Errorf("fragment sequence %d, want %d", seq, j/2)
+				}
+				traf := moof[16+8:]
+				trun := traf[16+20:]
+				if string(trun[4:8]) != "trun" {
+					t.Fatalf("trun missing")
+				}
+				count := int(binary.BigEndian.Uint32(trun[12:]))
+				for k := 0; k < count; k++ {
+					entry := trun[20+k*16:]
+					if duration := binary.BigEndian.Uint32(entry); duration != 3600 {
+						t.Errorf("sample duration %d", duration)
+					}
+					// 每个文件以IDR开始
+					if sync := binary.BigEndian.Uint32(entry[8:]) == 0x02000000; sync != ((samples+k)%5 == 0) {
+						t.Errorf("sample %d sync %v", samples+k, sync)
+					}
+				}
+				samples += count
+			}
+			if samples != 10 {
+				t.Errorf("samples %d, want 10", samples)
+			}
+		})
+	}
+}
+
+func TestRecorderSegmentPath(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		path     string
+		template string
+		want     string
+	}{
+		{"default", "/live/cam", "", "record/live/cam/20240102030405.mp4"},
+		{"dot segments", "/../live/./cam/..", "", "record/live/cam/20240102030405.mp4"},
+		{"index", "cam", "out/{path}-{index}.mp4", "out/cam-1.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecorder(tt.path, func() string { return "" }, RecorderOptions{PathTemplate: tt.template})
+			defer r.Close()
+			r.index = 1
+			if got := r.segmentPath(start); got != tt.want {
+				t.Errorf("path %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+	"github.com/teris-io/shortid"
+)
+
+// rtcpReportInterval rtcp报告的发送间隔(RFC 3550 6.2 建议的最小值)
+const rtcpReportInterval = 5 * time.Second
+
+// 序号统计的参数(RFC 3550 A.1)
+const (
+	rtpSeqMod   = 1 << 16
+	maxDropout  = 3000
+	maxMisorder = 100
+)
+
+// ReceptionStats rtp流的接收统计，本端接收时由rtp包计算，本端发送时取自对端的RR
+type ReceptionStats struct {
+	SSRC uint32
+	// LastSequenceNumber 扩展的最大序号，高16位为序号回绕次数
+	LastSequenceNumber uint32
+	// PacketsReceived 收到的包数，取自对端RR时为0
+	PacketsReceived uint32
+	PacketsLost     int32
+	// FractionLost 最近一个报告间隔的丢包率，0~1
+	FractionLost float64
+	Jitter       time.Duration
+	// RoundTripTime 由RR中的LSR/DLSR计算，没有时为0
+	RoundTripTime time.Duration
+}
+
+// String 统计信息
+func (s *ReceptionStats) String() string {
+	return fmt.Sprintf("ssrc[%08X] received[%d] lost[%d] fraction[%.2f%%] jitter[%v] rtt[%v]",
+		s.SSRC, s.PacketsReceived, s.PacketsLost, s.FractionLost*100, s.Jitter, s.RoundTripTime)
+}
+
+// isRTCP 是否为rtcp包
+func isRTCP(t RTPType) bool {
+	return t == RTP_TYPE_AUDIOCONTROL || t == RTP_TYPE_VIDEOCONTROL
+}
+
+// mediaType rtcp包对应的媒体类型
+func mediaType(t RTPType) RTPType {
+	switch t {
+	case RTP_TYPE_AUDIOCONTROL:
+		return RTP_TYPE_AUDIO
+	case RTP_TYPE_VIDEOCONTROL:
+		return RTP_TYPE_VIDEO
+	}
+	return t
+}
+
+// controlType 媒体类型对应的rtcp包类型
+func controlType(t RTPType) RTPType {
+	switch t {
+	case RTP_TYPE_AUDIO:
+		return RTP_TYPE_AUDIOCONTROL
+	case RTP_TYPE_VIDEO:
+		return RTP_TYPE_VIDEOCONTROL
+	}
+	return t
+}
+
+// rtpTicks 时长换算为时钟频率下的时间戳增量
+func rtpTicks(d time.Duration, clockRate int) int64 {
+	rate := int64(clockRate)
+	return int64(d/time.Second)*rate + int64(d%time.Second)*rate/int64(time.Second)
+}
+
+// sdpClockRates sdp中各媒体的时钟频率
+func sdpClockRates(sdpMap map[string]*SDPInfo) map[RTPType]int {
+	rates := make(map[RTPType]int)
+	if info, ok := sdpMap["audio"]; ok {
+		rates[RTP_TYPE_AUDIO] = info.TimeScale
+	}
+	if info, ok := sdpMap["video"]; ok {
+		rates[RTP_TYPE_VIDEO] = info.TimeScale
+	}
+	return rates
+}
+
+// receiverStats 一路rtp流的接收统计(RFC 3550 A.1 A.3 A.8)
+type receiverStats struct {
+	ssrc      uint32
+	clockRate int
+
+	baseSeq       uint32
+	maxSeq        uint16
+	cycles        uint32
+	badSeq        uint32
+	received      uint32
+	expectedPrior uint32
+	receivedPrior uint32
+	fraction      uint8
+
+	start      time.Time
+	transit    uint32
+	hasTransit bool
+	jitter     float64
+
+	// 最近收到的SR
+	lastSR     uint32
+	lastSRTime time.Time
+}
+
+func newReceiverStats(ssrc uint32, seq uint16, clockRate int, arrival time.Time) *receiverStats {
+	s := &receiverStats{ssrc: ssrc, clockRate: clockRate, start: arrival}
+	s.init(seq)
+	return s
+}
+
+func (s *receiverStats) init(seq uint16) {
+	s.baseSeq = uint32(seq)
+	s.maxSeq = seq
+	s.cycles = 0
+	s.badSeq = rtpSeqMod + 1
+	s.received = 0
+	s.expectedPrior = 0
+	s.receivedPrior = 0
+	s.hasTransit = false
+	s.jitter = 0
+}
+
+// update 统计一个rtp包，序号跳变过大的包不计数
+func (s *receiverStats) update(seq uint16, timestamp uint32, arrival time.Time) {
+	switch udelta := seq - s.maxSeq; {
+	case udelta < maxDropout:
+		if seq < s.maxSeq {
+			s.cycles += rtpSeqMod
+		}
+		s.maxSeq = seq
+	case udelta <= rtpSeqMod-maxMisorder:
+		// 序号跳变过大，连续两个包时认为源已重启
+		if uint32(seq) != s.badSeq {
+			s.badSeq = (uint32(seq) + 1) & (rtpSeqMod - 1)
+			return
+		}
+		s.init(seq)
+	default:
+		// 重复或乱序的包
+	}
+	s.received++
+
+	if s.clockRate <= 0 {
+		return
+	}
+	transit := uint32(rtpTicks(arrival.Sub(s.start), s.clockRate)) - timestamp
+	if s.hasTransit {
+		d := float64(int32(transit - s.transit))
+		if d < 0 {
+			d = -d
+		}
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.transit = transit
+	s.hasTransit = true
+}
+
+// extendedMax 扩展的最大序号
+func (s *receiverStats) extendedMax() uint32 {
+	return s.cycles + uint32(s.maxSeq)
+}
+
+// lost 累计丢包数，限制在24位有符号数范围内
+func (s *receiverStats) lost() int32 {
+	expected := int64(s.extendedMax()) - int64(s.baseSeq) + 1
+	lost := expected - int64(s.received)
+	if lost > 0x7FFFFF {
+		lost = 0x7FFFFF
+	} else if lost < -0x800000 {
+		lost = -0x800000
+	}
+	return int32(lost)
+}
+
+// report 生成接收报告块，并开始新的统计间隔
+func (s *receiverStats) report(now time.Time) rtcp.ReceptionReport {
+	expected := s.extendedMax() - s.baseSeq + 1
+	expectedInterval := expected - s.expectedPrior
+	receivedInterval := s.received - s.receivedPrior
+	s.expectedPrior = expected
+	s.receivedPrior = s.received
+	s.fraction = 0
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval != 0 && lostInterval > 0 {
+		s.fraction = uint8(lostInterval << 8 / int64(expectedInterval))
+	}
+
+	report := rtcp.ReceptionReport{
+		SSRC:               s.ssrc,
+		FractionLost:       s.fraction,
+		TotalLost:          s.lost(),
+		LastSequenceNumber: s.extendedMax(),
+		Jitter:             uint32(s.jitter),
+		LastSenderReport:   s.lastSR,
+	}
+	if s.lastSR != 0 {
+		report.Delay = rtcp.DelaySince(s.lastSRTime, now)
+	}
+	return report
+}
+
+func (s *receiverStats) stats() *ReceptionStats {
+	stats := &ReceptionStats{
+		SSRC:               s.ssrc,
+		LastSequenceNumber: s.extendedMax(),
+		PacketsReceived:    s.received,
+		PacketsLost:        s.lost(),
+		FractionLost:       float64(s.fraction) / 256,
+	}
+	if s.clockRate > 0 {
+		stats.Jitter = time.Duration(s.jitter * float64(time.Second) / float64(s.clockRate))
+	}
+	return stats
+}
+
+// rtcpReceiver 接收端的rtcp处理，统计收到的rtp包和SR，定时生成RR
+type rtcpReceiver struct {
+	lock       sync.Mutex
+	ssrc       uint32
+	cname      string
+	clockRates map[RTPType]int
+	tracks     map[RTPType]*receiverStats
+}
+
+func newRTCPReceiver(clockRates map[RTPType]int) *rtcpReceiver {
+	return &rtcpReceiver{
+		ssrc:       randUint32(),
+		cname:      shortid.MustGenerate(),
+		clockRates: clockRates,
+		tracks:     make(map[RTPType]*receiverStats),
+	}
+}
+
+// onPacket 统计收到的rtp包或rtcp包
+func (r *rtcpReceiver) onPacket(pack *RTPPack, arrival time.Time) error {
+	if isRTCP(pack.Type) {
+		return r.onRTCP(pack, arrival)
+	}
+	rtp := ParseRTP(pack.Buffer.Bytes())
+	if rtp == nil {
+		return nil
+	}
+	ssrc, seq := uint32(rtp.SSRC), uint16(rtp.SequenceNumber)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.tracks[pack.Type]
+	if s == nil || s.ssrc != ssrc {
+		s = newReceiverStats(ssrc, seq, r.clockRates[pack.Type], arrival)
+		r.tracks[pack.Type] = s
+	}
+	s.update(seq, uint32(rtp.Timestamp), arrival)
+	return nil
+}
+
+// onRTCP 记录SR的时间，用于RR中的LSR/DLSR
+func (r *rtcpReceiver) onRTCP(pack *RTPPack, arrival time.Time) error {
+	packets, err := rtcp.Unmarshal(pack.Buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.tracks[mediaType(pack.Type)]
+	for _, pkt := range packets {
+		if sr, ok := pkt.(*rtcp.SenderReport); ok && s != nil && sr.SSRC == s.ssrc {
+			s.lastSR = rtcp.MiddleNTP(sr.NTPTime)
+			s.lastSRTime = arrival
+		}
+	}
+	return nil
+}
+
+// reports 为每路收到过rtp包的媒体生成RR+SDES复合包
+func (r *rtcpReceiver) reports(now time.Time) []*RTPPack {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var packs []*RTPPack
+	for _, t := range []RTPType{RTP_TYPE_AUDIO, RTP_TYPE_VIDEO} {
+		s := r.tracks[t]
+		if s == nil {
+			continue
+		}
+		buf, err := rtcp.Marshal(
+			&rtcp.ReceiverReport{SSRC: r.ssrc, Reports: []rtcp.ReceptionReport{s.report(now)}},
+			rtcp.NewCNAME(r.ssrc, r.cname),
+		)
+		if err != nil {
+			continue
+		}
+		packs = append(packs, &RTPPack{Type: controlType(t), Buffer: bytes.NewBuffer(buf)})
+	}
+	return packs
+}
+
+// stats 指定媒体的接收统计，没有收到过rtp包时返回nil
+func (r *rtcpReceiver) stats(t RTPType) *ReceptionStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s := r.tracks[t]; s != nil {
+		return s.stats()
+	}
+	return nil
+}
+
+// senderStats 一路rtp流的发送统计
+type senderStats struct {
+	ssrc      uint32
+	clockRate int
+	packets   uint32
+	octets    uint32
+	lastRTP   uint32
+	lastTime  time.Time
+
+	// 最近发送的SR，用于计算往返时间
+	lastSR     uint32
+	lastSRTime time.Time
+	// 对端RR中的接收统计
+	remote *ReceptionStats
+}
+
+// rtcpSender 发送端的rtcp处理，统计发送的rtp包并定时生成SR，解析对端的RR
+type rtcpSender struct {
+	lock       sync.Mutex
+	cname      string
+	clockRates map[RTPType]int
+	tracks     map[RTPType]*senderStats
+}
+
+func newRTCPSender(clockRates map[RTPType]int) *rtcpSender {
+	return &rtcpSender{
+		cname:      shortid.MustGenerate(),
+		clockRates: clockRates,
+		tracks:     make(map[RTPType]*senderStats),
+	}
+}
+
+// onRTP 统计发送的rtp包
+func (r *rtcpSender) onRTP(pack *RTPPack, now time.Time) {
+	if isRTCP(pack.Type) {
+		return
+	}
+	rtp := ParseRTP(pack.Buffer.Bytes())
+	if rtp == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.tracks[pack.Type]
+	if s == nil || s.ssrc != uint32(rtp.SSRC) {
+		s = &senderStats{ssrc: uint32(rtp.SSRC), clockRate: r.clockRates[pack.Type]}
+		r.tracks[pack.Type] = s
+	}
+	s.packets++
+	s.octets += uint32(len(rtp.Payload))
+	s.lastRTP = uint32(rtp.Timestamp)
+	s.lastTime = now
+}
+
+// onRTCP 解析对端RR中本端各路流的接收统计
+func (r *rtcpSender) onRTCP(pack *RTPPack, now time.Time) error {
+	packets, err := rtcp.Unmarshal(pack.Buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.tracks[mediaType(pack.Type)]
+	if s == nil {
+		return nil
+	}
+	for _, pkt := range packets {
+		var reports []rtcp.ReceptionReport
+		switch p := pkt.(type) {
+		case *rtcp.ReceiverReport:
+			reports = p.Reports
+		case *rtcp.SenderReport:
+			reports = p.Reports
+		}
+		for _, report := range reports {
+			if report.SSRC != s.ssrc {
+				continue
+			}
+			stats := &ReceptionStats{
+				SSRC:               report.SSRC,
+				LastSequenceNumber: report.LastSequenceNumber,
+				PacketsLost:        report.TotalLost,
+				FractionLost:       float64(report.FractionLost) / 256,
+			}
+			if s.clockRate > 0 {
+				stats.Jitter = time.Duration(int64(report.Jitter) * int64(time.Second) / int64(s.clockRate))
+			}
+			if report.LastSenderReport != 0 && report.LastSenderReport == s.lastSR {
+				delay := time.Duration(int64(report.Delay) * int64(time.Second) >> 16)
+				if rtt := now.Sub(s.lastSRTime) - delay; rtt > 0 {
+					stats.RoundTripTime = rtt
+				}
+			}
+			s.remote = stats
+		}
+	}
+	return nil
+}
+
+// reports 为每路发送过rtp包的媒体生成SR+SDES复合包
+// ntpTime 返回rtp时间戳对应的NTP时间，不可用时使用本地时间
+func (r *rtcpSender) reports(now time.Time, ntpTime func(RTPType, uint32) (uint64, bool)) []*RTPPack {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var packs []*RTPPack
+	for _, t := range []RTPType{RTP_TYPE_AUDIO, RTP_TYPE_VIDEO} {
+		s := r.tracks[t]
+		if s == nil {
+			continue
+		}
+		// 由最近发送的包推算当前时刻的rtp时间戳
+		rtpTime := s.lastRTP
+		if s.clockRate > 0 {
+			rtpTime += uint32(rtpTicks(now.Sub(s.lastTime), s.clockRate))
+		}
+		ntp, ok := uint64(0), false
+		if ntpTime != nil {
+			ntp, ok = ntpTime(t, rtpTime)
+		}
+		if !ok {
+			ntp = rtcp.NTPTime(now)
+		}
+		buf, err := rtcp.Marshal(
+			&rtcp.SenderReport{
+				SSRC:        s.ssrc,
+				NTPTime:     ntp,
+				RTPTime:     rtpTime,
+				PacketCount: s.packets,
+				OctetCount:  s.octets,
+			},
+			rtcp.NewCNAME(s.ssrc, r.cname),
+		)
+		if err != nil {
+			continue
+		}
+		s.lastSR = rtcp.MiddleNTP(ntp)
+		s.lastSRTime = now
+		packs = append(packs, &RTPPack{Type: controlType(t), Buffer: bytes.NewBuffer(buf)})
+	}
+	return packs
+}
+
+// stats 对端RR中指定媒体的接收统计，没有收到RR时返回nil
+func (r *rtcpSender) stats(t RTPType) *ReceptionStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s := r.tracks[t]; s != nil && s.remote != nil {
+		stats := *s.remote
+		return &stats
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// testRTPPack 构造指定类型的rtp包
+func testRTPPack(t *testing.T, typ RTPType, ssrc uint32, seq uint16, ts uint32) *RTPPack {
+	t.Helper()
+	b, err := NewRTPPacket(96, seq, ts, ssrc, false, []byte{0x01, 0x02}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RTPPack{Type: typ, Buffer: bytes.NewBuffer(b)}
+}
+
+func TestReceiverStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		seqs     []uint16
+		lost     int32
+		max      uint32
+		received uint32
+		fraction uint8
+	}{
+		{"in order", []uint16{1, 2, 3, 4, 5}, 0, 5, 5, 0},
+		{"gap", []uint16{1, 2, 5}, 2, 5, 3, 102},
+		{"wrap", []uint16{65534, 65535, 0, 1}, 0, 0x10001, 4, 0},
+		{"reorder", []uint16{1, 3, 2, 4}, 0, 4, 4, 0},
+		{"duplicate", []uint16{1, 2, 2, 3}, -1, 3, 4, 0},
+		{"restart", []uint16{1, 2, 10000, 10001, 10002}, 0, 10002, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			s := newReceiverStats(1, tt.seqs[0], 8000, now)
+			for _, seq := range tt.seqs {
+				s.update(seq, 0, now)
+			}
+			report := s.report(now)
+			if report.TotalLost != tt.lost || report.LastSequenceNumber != tt.max || report.FractionLost != tt.fraction {
+				t.Errorf("got lost=%d max=%d fraction=%d, want lost=%d max=%d fraction=%d",
+					report.TotalLost, report.LastSequenceNumber, report.FractionLost, tt.lost, tt.max, tt.fraction)
+			}
+			if s.received != tt.received {
+				t.Errorf("received %d, want %d", s.received, tt.received)
+			}
+		})
+	}
+}
+
+func TestReceiverStatsJitter(t *testing.T) {
+	start := time.Unix(0, 0)
+	s := newReceiverStats(1, 0, 8000, start)
+	// 20ms一个包，第3个包晚到10ms
+	arrivals := []time.Duration{0, 20 * time.Millisecond, 50 * time.Millisecond, 60 * time.Millisecond}
+	for i, d := range arrivals {
+		s.update(uint16(i), uint32(160*i), start.Add(d))
+	}
+	if report := s.report(start); report.Jitter != 9 {
+		t.Errorf("jitter %d, want 9", report.Jitter)
+	}
+	if stats := s.stats(); stats.Jitter != 1210937 {
+		t.Errorf("jitter %v, want 1.210937ms", stats.Jitter)
+	}
+}
+
+func TestRTCPSenderReceiver(t *testing.T) {
+	rates := map[RTPType]int{RTP_TYPE_VIDEO: 90000}
+	sender := newRTCPSender(rates)
+	receiver := newRTCPReceiver(rates)
+	t0 := time.Unix(1000, 0)
+
+	for i, seq := range []uint16{10, 11, 13} {
+		pack := testRTPPack(t, RTP_TYPE_VIDEO, 0x1234, seq, uint32(3000*i))
+		sender.onRTP(pack, t0)
+		if err := receiver.onPacket(pack, t0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srs := sender.reports(t0, nil)
+	if len(srs) != 1 || srs[0].Type != RTP_TYPE_VIDEOCONTROL {
+		t.Fatalf("got %d sender reports", len(srs))
+	}
+	packets, err := rtcp.Unmarshal(srs[0].Buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, ok := packets[0].(*rtcp.SenderReport)
+	if !ok || sr.SSRC != 0x1234 || sr.PacketCount != 3 || sr.OctetCount != 6 || sr.RTPTime != 6000 ||
+		sr.NTPTime != rtcp.NTPTime(t0) {
+		t.Errorf("got sr %+v", packets[0])
+	}
+	if _, ok := packets[1].(*rtcp.SourceDescription); !ok {
+		t.Errorf("sdes missing from compound packet")
+	}
+
+	// 接收端10ms后收到SR，1s后发送RR，发送端在50ms往返时延后收到
+	srArrival := t0.Add(10 * time.Millisecond)
+	if err := receiver.onPacket(srs[0], srArrival); err != nil {
+		t.Fatal(err)
+	}
+	rrs := receiver.reports(srArrival.Add(time.Second))
+	if len(rrs) != 1 || rrs[0].Type != RTP_TYPE_VIDEOCONTROL {
+		t.Fatalf("got %d receiver reports", len(rrs))
+	}
+	if err := sender.onRTCP(rrs[0], t0.Add(1050*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	stats := sender.stats(RTP_TYPE_VIDEO)
+	if stats == nil {
+		t.Fatal("no remote stats")
+	}
+	if stats.SSRC != 0x1234 || stats.PacketsLost != 1 || stats.LastSequenceNumber != 13 ||
+		stats.FractionLost != 0.25 || stats.RoundTripTime != 50*time.Millisecond {
+		t.Errorf("got %v", stats)
+	}
+	if local := receiver.stats(RTP_TYPE_VIDEO); local == nil || local.PacketsReceived != 3 || local.PacketsLost != 1 {
+		t.Errorf("got local %v", local)
+	}
+	if receiver.stats(RTP_TYPE_AUDIO) != nil || sender.stats(RTP_TYPE_AUDIO) != nil {
+		t.Errorf("stats for unused track")
+	}
+}
+
+func TestRTCPSenderNTPMapping(t *testing.T) {
+	sender := newRTCPSender(map[RTPType]int{RTP_TYPE_AUDIO: 8000})
+	t0 := time.Unix(1000, 0)
+	sender.onRTP(testRTPPack(t, RTP_TYPE_AUDIO, 1, 1, 800), t0)
+	mapped := rtcp.NTPTime(time.Unix(500, 0))
+	var gotRTP uint32
+	packs := sender.reports(t0.Add(100*time.Millisecond), func(typ RTPType, rtpTime uint32) (uint64, bool) {
+		gotRTP = rtpTime
+		return mapped, typ == RTP_TYPE_AUDIO
+	})
+	// 100ms后推算的rtp时间戳为 800+800
+	if gotRTP != 1600 {
+		t.Errorf("rtp time %d, want 1600", gotRTP)
+	}
+	packets, err := rtcp.Unmarshal(packs[0].Buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr := packets[0].(*rtcp.SenderReport); sr.NTPTime != mapped || sr.RTPTime != 1600 {
+		t.Errorf("got sr %+v", sr)
+	}
+}
@@ -0,0 +1,272 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// 常用的rtp头部扩展URI
+const (
+	ExtensionURIAbsSendTime = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+	ExtensionURITransportCC = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+	ExtensionURIAudioLevel  = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+	ExtensionURISDESMid     = "urn:ietf:params:rtp-hdrext:sdes:mid"
+)
+
+// RTPHeaderExtension 可按URI编解码的RFC 8285头部扩展
+type RTPHeaderExtension interface {
+	URI() string
+	Marshal() ([]byte, error)
+	Unmarshal(b []byte) error
+}
+
+// RTPExtensionMap sdp中 a=extmap 的扩展ID与URI的对应关系
+type RTPExtensionMap map[uint8]string
+
+// parseExtMap 解析 a=extmap:<id>[/direction] <uri> [attributes]
+func (m RTPExtensionMap) parseExtMap(key, val string) {
+	idStr := strings.SplitN(strings.TrimPrefix(key, "extmap:"), "/", 2)[0]
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 || id > 255 {
+		return
+	}
+	uri := strings.Fields(val)
+	if len(uri) == 0 {
+		return
+	}
+	m[uint8(id)] = uri[0]
+}
+
+// ID 获取URI对应的扩展ID
+func (m RTPExtensionMap) ID(uri string) (uint8, bool) {
+	for id, u := range m {
+		if u == uri {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// Get 从rtp包中解析ext，sdp中没有协商或包中没有携带时返回false
+func (m RTPExtensionMap) Get(pkt *RTPPacket, ext RTPHeaderExtension) (bool, error) {
+	id, ok := m.ID(ext.URI())
+	if !ok {
+		return false, nil
+	}
+	payload := pkt.GetExtension(id)
+	if payload == nil {
+		return false, nil
+	}
+	if err := ext.Unmarshal(payload); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Set 将ext写入rtp包，sdp中没有协商时返回错误
+func (m RTPExtensionMap) Set(pkt *RTPPacket, ext RTPHeaderExtension) error {
+	id, ok := m.ID(ext.URI())
+	if !ok {
+		return fmt.Errorf("rtp extension %s not negotiated", ext.URI())
+	}
+	payload, err := ext.Marshal()
+	if err != nil {
+		return err
+	}
+	return pkt.SetExtension(id, payload)
+}
+
+// AbsSendTimeExtension 发送时间，NTP时间的6.18定点数秒
+type AbsSendTimeExtension struct {
+	Timestamp uint32
+}
+
+// NewAbsSendTimeExtension 根据发送时间创建
+func NewAbsSendTimeExtension(t time.Time) *AbsSendTimeExtension {
+	return &AbsSendTimeExtension{Timestamp: uint32(rtcp.NTPTime(t)>>14) & 0xFFFFFF}
+}
+
+func (e *AbsSendTimeExtension) URI() string {
+	return ExtensionURIAbsSendTime
+}
+
+func (e *AbsSendTimeExtension) Marshal() ([]byte, error) {
+	return []byte{byte(e.Timestamp >> 16), byte(e.Timestamp >> 8), byte(e.Timestamp)}, nil
+}
+
+func (e *AbsSendTimeExtension) Unmarshal(b []byte) error {
+	if len(b) < 3 {
+		return fmt.Errorf("abs-send-time extension too short: %d", len(b))
+	}
+	e.Timestamp = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	return nil
+}
+
+// Time 以接收时间补全高位，得到发送时间
+func (e *AbsSendTimeExtension) Time(receive time.Time) time.Time {
+	ntp := rtcp.NTPTime(receive)
+	sent := ntp&^(0xFFFFFF<<14) | uint64(e.Timestamp)<<14
+	// 24位只能表示64秒，发送时间不会晚于接收时间
+	if sent > ntp {
+		sent -= 1 << 38
+	}
+	return rtcp.TimeFromNTP(sent)
+}
+
+// TransportCCExtension transport-wide拥塞控制序号
+type TransportCCExtension struct {
+	SequenceNumber uint16
+}
+
+func (e *TransportCCExtension) URI() string {
+	return ExtensionURITransportCC
+}
+
+func (e *TransportCCExtension) Marshal() ([]byte, error) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, e.SequenceNumber)
+	return b, nil
+}
+
+func (e *TransportCCExtension) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("transport-cc extension too short: %d", len(b))
+	}
+	e.SequenceNumber = binary.BigEndian.Uint16(b)
+	return nil
+}
+
+// AudioLevelExtension 音频电平(RFC 6464)，Level为-dBov，取值0~127
+type AudioLevelExtension struct {
+	Level uint8
+	Voice bool
+}
+
+func (e *AudioLevelExtension) URI() string {
+	return ExtensionURIAudioLevel
+}
+
+func (e *AudioLevelExtension) Marshal() ([]byte, error) {
+	if e.Level > 127 {
+		return nil, fmt.Errorf("audio level %d out of range", e.Level)
+	}
+	b := e.Level
+	if e.Voice {
+		b |= 0x80
+	}
+	return []byte{b}, nil
+}
+
+func (e *AudioLevelExtension) Unmarshal(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("audio level extension is empty")
+	}
+	e.Voice = b[0]&0x80 != 0
+	e.Level = b[0] & 0x7F
+	return nil
+}
+
+// SDESMidExtension 媒体标识(RFC 8843)
+type SDESMidExtension struct {
+	Mid string
+}
+
+func (e *SDESMidExtension) URI() string {
+	return ExtensionURISDESMid
+}
+
+func (e *SDESMidExtension) Marshal() ([]byte, error) {
+	if len(e.Mid) == 0 || len(e.Mid) > 255 {
+		return nil, fmt.Errorf("sdes mid length %d out of range", len(e.Mid))
+	}
+	return []byte(e.Mid), nil
+}
+
+func (e *SDESMidExtension) Unmarshal(b []byte) error {
+	e.Mid = string(b)
+	return nil
+}
+
+// ONVIFReplayExtension ONVIF回放头部扩展，profile为0xABAC，不使用RFC 8285格式
+type ONVIFReplayExtension struct {
+	// NTPTimestamp 帧的绝对时间，NTP 32.32定点数
+	NTPTimestamp uint64
+	// CleanPoint 可以从此帧开始解码
+	CleanPoint bool
+	// End 回放的最后一帧
+	End bool
+	// Discontinuity 与上一帧之间有间断
+	Discontinuity bool
+	// CSeq 对应PLAY请求CSeq的低8位
+	CSeq uint8
+}
+
+// onvifReplayLength ONVIF回放扩展数据的长度
+const onvifReplayLength = 12
+
+// Time 帧的绝对时间
+func (e *ONVIFReplayExtension) Time() time.Time {
+	return rtcp.TimeFromNTP(e.NTPTimestamp)
+}
+
+// SetTime 设置帧的绝对时间
+func (e *ONVIFReplayExtension) SetTime(t time.Time) {
+	e.NTPTimestamp = rtcp.NTPTime(t)
+}
+
+func (e *ONVIFReplayExtension) Marshal() ([]byte, error) {
+	b := make([]byte, onvifReplayLength)
+	binary.BigEndian.PutUint64(b, e.NTPTimestamp)
+	if e.CleanPoint {
+		b[8] |= 0x80
+	}
+	if e.End {
+		b[8] |= 0x40
+	}
+	if e.Discontinuity {
+		b[8] |= 0x20
+	}
+	b[9] = e.CSeq
+	return b, nil
+}
+
+func (e *ONVIFReplayExtension) Unmarshal(b []byte) error {
+	if len(b) < onvifReplayLength {
+		return fmt.Errorf("onvif replay extension too short: %d", len(b))
+	}
+	e.NTPTimestamp = binary.BigEndian.Uint64(b)
+	e.CleanPoint = b[8]&0x80 != 0
+	e.End = b[8]&0x40 != 0
+	e.Discontinuity = b[8]&0x20 != 0
+	e.CSeq = b[9]
+	return nil
+}
+
+// ONVIFReplay 获取ONVIF回放扩展，没有时返回nil
+func (p *RTPPacket) ONVIFReplay() (*ONVIFReplayExtension, error) {
+	if !p.Extension || p.ExtensionProfile != RTPExtensionProfileONVIF {
+		return nil, nil
+	}
+	ext := &ONVIFReplayExtension{}
+	if err := ext.Unmarshal(p.ExtensionPayload); err != nil {
+		return nil, err
+	}
+	return ext, nil
+}
+
+// SetONVIFReplay 设置ONVIF回放扩展，会替换已有的头部扩展
+func (p *RTPPacket) SetONVIFReplay(ext *ONVIFReplayExtension) error {
+	b, err := ext.Marshal()
+	if err != nil {
+		return err
+	}
+	p.Extension = true
+	p.ExtensionProfile = RTPExtensionProfileONVIF
+	p.ExtensionPayload = b
+	return nil
+}
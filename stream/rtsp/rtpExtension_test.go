@@ -0,0 +1,136 @@
+package rtsp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSDPExtMap(t *testing.T) {
+	sdpRaw := "v=0\r\n" +
+		"m=video 0 RTP/AVP 96\r\n" +
+		"a=rtpmap:96 H264/90000\r\n" +
+		"a=extmap:1 " + ExtensionURIAbsSendTime + "\r\n" +
+		"a=extmap:3/sendonly " + ExtensionURITransportCC + "\r\n" +
+		"a=extmap:20 " + ExtensionURISDESMid + " attr\r\n" +
+		"a=extmap:0 urn:invalid\r\n" +
+		"a=extmap:x urn:invalid\r\n"
+	info := ParseSDP(sdpRaw)["video"]
+	if info == nil {
+		t.Fatal("video not parsed")
+	}
+	want := RTPExtensionMap{1: ExtensionURIAbsSendTime, 3: ExtensionURITransportCC, 20: ExtensionURISDESMid}
+	if !reflect.DeepEqual(info.ExtMap, want) {
+		t.Errorf("got %v, want %v", info.ExtMap, want)
+	}
+	if id, ok := info.ExtMap.ID(ExtensionURITransportCC); !ok || id != 3 {
+		t.Errorf("transport-cc id %d %v", id, ok)
+	}
+	if _, ok := info.ExtMap.ID(ExtensionURIAudioLevel); ok {
+		t.Errorf("audio level not negotiated")
+	}
+}
+
+func TestRTPExtensionMapGetSet(t *testing.T) {
+	m := RTPExtensionMap{1: ExtensionURIAbsSendTime, 2: ExtensionURITransportCC, 3: ExtensionURIAudioLevel, 4: ExtensionURISDESMid}
+	tests := []struct {
+		name string
+		ext  RTPHeaderExtension
+		out  RTPHeaderExtension
+		raw  []byte
+	}{
+		{"abs-send-time", &AbsSendTimeExtension{Timestamp: 0x123456}, &AbsSendTimeExtension{}, []byte{0x12, 0x34, 0x56}},
+		{"transport-cc", &TransportCCExtension{SequenceNumber: 0xabcd}, &TransportCCExtension{}, []byte{0xab, 0xcd}},
+		{"audio level", &AudioLevelExtension{Level: 30, Voice: true}, &AudioLevelExtension{}, []byte{0x9e}},
+		{"mid", &SDESMidExtension{Mid: "video"}, &SDESMidExtension{}, []byte("video")},
+	}
+	p := NewRTPPacket(96, 1, 0, 1, false, []byte{0x01})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Set(p, tt.ext); err != nil {
+				t.Fatal(err)
+			}
+			id, _ := m.ID(tt.ext.URI())
+			if raw := p.GetExtension(id); !bytes.Equal(raw, tt.raw) {
+				t.Errorf("raw %x, want %x", raw, tt.raw)
+			}
+			ok, err := m.Get(p, tt.out)
+			if err != nil || !ok {
+				t.Fatalf("get %v %v", ok, err)
+			}
+			if !reflect.DeepEqual(tt.out, tt.ext) {
+				t.Errorf("got %+v, want %+v", tt.out, tt.ext)
+			}
+		})
+	}
+
+	if ok, err := (RTPExtensionMap{}).Get(p, &TransportCCExtension{}); ok || err != nil {
+		t.Errorf("not negotiated: got %v %v", ok, err)
+	}
+	if err := (RTPExtensionMap{}).Set(p, &TransportCCExtension{}); err == nil {
+		t.Errorf("set not negotiated: expected error")
+	}
+	if _, err := (&AudioLevelExtension{Level: 128}).Marshal(); err == nil {
+		t.Errorf("audio level 128: expected error")
+	}
+}
+
+func TestAbsSendTime(t *testing.T) {
+	sent := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC)
+	ext := NewAbsSendTimeExtension(sent)
+	tests := []struct {
+		name  string
+		delay time.Duration
+	}{
+		{"same time", 0},
+		{"one second", time.Second},
+		{"near wrap", 63 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ext.Time(sent.Add(tt.delay))
+			// 6.18定点数的精度约为3.8us
+			if d := got.Sub(sent); d > 4*time.Microsecond || d < -4*time.Microsecond {
+				t.Errorf("got %v, want %v", got, sent)
+			}
+		})
+	}
+}
+
+func TestONVIFReplayExtension(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ext := &ONVIFReplayExtension{CleanPoint: true, Discontinuity: true, CSeq: 7}
+	ext.SetTime(ts)
+
+	p := NewRTPPacket(96, 1, 0, 1, true, []byte{0x01})
+	if got, err := p.ONVIFReplay(); got != nil || err != nil {
+		t.Errorf("no extension: got %v %v", got, err)
+	}
+	if err := p.SetONVIFReplay(ext); err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeader := []byte{0xab, 0xac, 0x00, 0x03}
+	if !bytes.Equal(b[12:16], wantHeader) || b[24] != 0xa0 || b[25] != 7 {
+		t.Errorf("marshal %x", b)
+	}
+	var q RTPPacket
+	if err := q.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.ONVIFReplay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *ext || !got.Time().Equal(ts) {
+		t.Errorf("got %+v, want %+v", got, ext)
+	}
+	q.ExtensionPayload = q.ExtensionPayload[:8]
+	if _, err := q.ONVIFReplay(); err == nil {
+		t.Errorf("truncated: expected error")
+	}
+}
@@ -0,0 +1,359 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// rtp头部扩展的profile
+const (
+	// RFC 8285 one-byte header
+	RTPExtensionProfileOneByte = 0xBEDE
+	// RFC 8285 two-byte header，低4位为appbits
+	RTPExtensionProfileTwoByte = 0x1000
+	// ONVIF replay header extension
+	RTPExtensionProfileONVIF = 0xABAC
+)
+
+// RTPPacket 完整的rtp包(RFC 3550)，Unmarshal 后再 Marshal 可得到相同的数据
+type RTPPacket struct {
+	Version        uint8
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	CSRC           []uint32
+
+	// Extension 为true时携带头部扩展
+	Extension        bool
+	ExtensionProfile uint16
+	// ExtensionPayload 头部扩展的数据(不含profile和长度)，长度为4的倍数
+	ExtensionPayload []byte
+
+	Payload []byte
+	// Padding 填充数据，最后一个字节为填充长度，为空时不填充
+	Padding []byte
+}
+
+// RTPExtension RFC 8285 头部扩展元素
+type RTPExtension struct {
+	ID      uint8
+	Payload []byte
+}
+
+// NewRTPPacket 创建version为2的rtp包
+func NewRTPPacket(payloadType uint8, seq uint16, timestamp uint32, ssrc uint32, marker bool, payload []byte) *RTPPacket {
+	return &RTPPacket{
+		Version:        2,
+		Marker:         marker,
+		PayloadType:    payloadType,
+		SequenceNumber: seq,
+		Timestamp:      timestamp,
+		SSRC:           ssrc,
+		Payload:        payload,
+	}
+}
+
+// Unmarshal 解析rtp包，Payload 等字段与b共享内存
+func (p *RTPPacket) Unmarshal(b []byte) error {
+	if len(b) < RTPFixedHeaderLength {
+		return fmt.Errorf("rtp packet too short: %d", len(b))
+	}
+	p.Version = b[0] >> 6
+	if p.Version != 2 {
+		return fmt.Errorf("rtp version %d not supported", p.Version)
+	}
+	padding := b[0]&0x20 != 0
+	p.Extension = b[0]&0x10 != 0
+	csrcCount := int(b[0] & 0x0F)
+	p.Marker = b[1]&0x80 != 0
+	p.PayloadType = b[1] & 0x7F
+	p.SequenceNumber = binary.BigEndian.Uint16(b[2:])
+	p.Timestamp = binary.BigEndian.Uint32(b[4:])
+	p.SSRC = binary.BigEndian.Uint32(b[8:])
+
+	offset := RTPFixedHeaderLength
+	if len(b) < offset+4*csrcCount {
+		return fmt.Errorf("rtp csrc list truncated")
+	}
+	p.CSRC = nil
+	for i := 0; i < csrcCount; i++ {
+		p.CSRC = append(p.CSRC, binary.BigEndian.Uint32(b[offset:]))
+		offset += 4
+	}
+
+	p.ExtensionProfile = 0
+	p.ExtensionPayload = nil
+	if p.Extension {
+		if len(b) < offset+4 {
+			return fmt.Errorf("rtp header extension truncated")
+		}
+		p.ExtensionProfile = binary.BigEndian.Uint16(b[offset:])
+		extLen := 4 * int(binary.BigEndian.Uint16(b[offset+2:]))
+		offset += 4
+		if len(b) < offset+extLen {
+			return fmt.Errorf("rtp header extension length %d exceeds packet", extLen)
+		}
+		p.ExtensionPayload = b[offset : offset+extLen]
+		offset += extLen
+	}
+
+	end := len(b)
+	p.Padding = nil
+	if padding {
+		if end == offset {
+			return fmt.Errorf("rtp padding flag set without padding")
+		}
+		paddingLen := int(b[end-1])
+		if paddingLen == 0 || end-offset < paddingLen {
+			return fmt.Errorf("rtp invalid padding length %d", paddingLen)
+		}
+		p.Padding = b[end-paddingLen:]
+		end -= paddingLen
+	}
+	p.Payload = b[offset:end]
+	return nil
+}
+
+// MarshalSize 编码后的长度
+func (p *RTPPacket) MarshalSize() int {
+	size := RTPFixedHeaderLength + 4*len(p.CSRC) + len(p.Payload) + len(p.Padding)
+	if p.Extension {
+		size += 4 + (len(p.ExtensionPayload)+3)/4*4
+	}
+	return size
+}
+
+// Marshal 编码为rtp包
+func (p *RTPPacket) Marshal() ([]byte, error) {
+	b := make([]byte, p.MarshalSize())
+	n, err := p.MarshalTo(b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// MarshalTo 编码到b中，返回写入的长度
+func (p *RTPPacket) MarshalTo(b []byte) (int, error) {
+	size := p.MarshalSize()
+	if len(b) < size {
+		return 0, fmt.Errorf("rtp buffer too short, need %d", size)
+	}
+	if len(p.CSRC) > 15 {
+		return 0, fmt.Errorf("rtp csrc count %d exceeds 15", len(p.CSRC))
+	}
+	if p.Extension && len(p.ExtensionPayload) > 0xFFFF*4 {
+		return 0, fmt.Errorf("rtp header extension too long")
+	}
+	if len(p.Padding) > 0 && int(p.Padding[len(p.Padding)-1]) != len(p.Padding) {
+		return 0, fmt.Errorf("rtp padding length mismatch")
+	}
+
+	version := p.Version
+	if version == 0 {
+		version = 2
+	}
+	b[0] = version<<6 | byte(len(p.CSRC))
+	if len(p.Padding) > 0 {
+		b[0] |= 0x20
+	}
+	if p.Extension {
+		b[0] |= 0x10
+	}
+	b[1] = p.PayloadType & 0x7F
+	if p.Marker {
+		b[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(b[2:], p.SequenceNumber)
+	binary.BigEndian.PutUint32(b[4:], p.Timestamp)
+	binary.BigEndian.PutUint32(b[8:], p.SSRC)
+	offset := RTPFixedHeaderLength
+	for _, csrc := range p.CSRC {
+		binary.BigEndian.PutUint32(b[offset:], csrc)
+		offset += 4
+	}
+	if p.Extension {
+		words := (len(p.ExtensionPayload) + 3) / 4
+		binary.BigEndian.PutUint16(b[offset:], p.ExtensionProfile)
+		binary.BigEndian.PutUint16(b[offset+2:], uint16(words))
+		offset += 4
+		n := copy(b[offset:], p.ExtensionPayload)
+		for i := n; i < words*4; i++ {
+			b[offset+i] = 0
+		}
+		offset += words * 4
+	}
+	offset += copy(b[offset:], p.Payload)
+	offset += copy(b[offset:], p.Padding)
+	return offset, nil
+}
+
+// isRFC8285 头部扩展是否为RFC 8285格式，twoByte 表示是否为two-byte header
+func (p *RTPPacket) isRFC8285() (ok bool, twoByte bool) {
+	switch {
+	case p.ExtensionProfile == RTPExtensionProfileOneByte:
+		return true, false
+	case p.ExtensionProfile&0xFFF0 == RTPExtensionProfileTwoByte:
+		return true, true
+	}
+	return false, false
+}
+
+// Extensions 解析RFC 8285头部扩展元素，扩展的profile不是RFC 8285时返回错误
+func (p *RTPPacket) Extensions() ([]RTPExtension, error) {
+	if !p.Extension {
+		return nil, nil
+	}
+	ok, twoByte := p.isRFC8285()
+	if !ok {
+		return nil, fmt.Errorf("rtp header extension profile 0x%04X is not rfc 8285", p.ExtensionProfile)
+	}
+	var exts []RTPExtension
+	b := p.ExtensionPayload
+	for len(b) > 0 {
+		// ID为0的字节为填充
+		if b[0] == 0 {
+			b = b[1:]
+			continue
+		}
+		var id uint8
+		var length int
+		if twoByte {
+			if len(b) < 2 {
+				return nil, fmt.Errorf("rtp two-byte extension truncated")
+			}
+			id, length = b[0], int(b[1])
+			b = b[2:]
+		} else {
+			id, length = b[0]>>4, int(b[0]&0x0F)+1
+			if id == 15 {
+				// ID 15 表示停止解析
+				break
+			}
+			b = b[1:]
+		}
+		if len(b) < length {
+			return nil, fmt.Errorf("rtp extension %d length %d exceeds data", id, length)
+		}
+		exts = append(exts, RTPExtension{ID: id, Payload: b[:length]})
+		b = b[length:]
+	}
+	return exts, nil
+}
+
+// GetExtension 获取指定ID的RFC 8285头部扩展数据，不存在时返回nil
+func (p *RTPPacket) GetExtension(id uint8) []byte {
+	exts, err := p.Extensions()
+	if err != nil {
+		return nil
+	}
+	for _, ext := range exts {
+		if ext.ID == id {
+			return ext.Payload
+		}
+	}
+	return nil
+}
+
+// SetExtension 设置指定ID的RFC 8285头部扩展，已存在时替换
+// 所有元素的ID为1~14且长度为1~16时使用one-byte header，否则使用two-byte header
+func (p *RTPPacket) SetExtension(id uint8, payload []byte) error {
+	if id == 0 {
+		return fmt.Errorf("rtp extension id 0 is reserved")
+	}
+	if len(payload) > 255 {
+		return fmt.Errorf("rtp extension payload too long: %d", len(payload))
+	}
+	var exts []RTPExtension
+	if p.Extension {
+		var err error
+		if exts, err = p.Extensions(); err != nil {
+			return err
+		}
+	}
+	replaced := false
+	for i := range exts {
+		if exts[i].ID == id {
+			exts[i].Payload = payload
+			replaced = true
+		}
+	}
+	if !replaced {
+		exts = append(exts, RTPExtension{ID: id, Payload: payload})
+	}
+	return p.setExtensions(exts)
+}
+
+// DelExtension 删除指定ID的RFC 8285头部扩展
+func (p *RTPPacket) DelExtension(id uint8) error {
+	exts, err := p.Extensions()
+	if err != nil {
+		return err
+	}
+	kept := exts[:0]
+	for _, ext := range exts {
+		if ext.ID != id {
+			kept = append(kept, ext)
+		}
+	}
+	return p.setExtensions(kept)
+}
+
+// setExtensions 重新编码头部扩展，没有元素时去掉扩展
+func (p *RTPPacket) setExtensions(exts []RTPExtension) error {
+	if len(exts) == 0 {
+		p.Extension = false
+		p.ExtensionProfile = 0
+		p.ExtensionPayload = nil
+		return nil
+	}
+	twoByte := false
+	for _, ext := range exts {
+		if ext.ID > 14 || len(ext.Payload) == 0 || len(ext.Payload) > 16 {
+			twoByte = true
+		}
+	}
+
+	var b []byte
+	for _, ext := range exts {
+		if twoByte {
+			b = append(b, ext.ID, byte(len(ext.Payload)))
+		} else {
+			b = append(b, ext.ID<<4|byte(len(ext.Payload)-1))
+		}
+		b = append(b, ext.Payload...)
+	}
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	p.Extension = true
+	p.ExtensionProfile = RTPExtensionProfileOneByte
+	if twoByte {
+		p.ExtensionProfile = RTPExtensionProfileTwoByte
+	}
+	p.ExtensionPayload = b
+	return nil
+}
+
+// Info 转换为RTPInfo
+func (p *RTPPacket) Info() *RTPInfo {
+	offset := RTPFixedHeaderLength + 4*len(p.CSRC)
+	if p.Extension {
+		offset += 4 + (len(p.ExtensionPayload)+3)/4*4
+	}
+	return &RTPInfo{
+		Version:        int(p.Version),
+		Padding:        len(p.Padding) > 0,
+		Extension:      p.Extension,
+		CSRCCnt:        len(p.CSRC),
+		Marker:         p.Marker,
+		PayloadType:    int(p.PayloadType),
+		SequenceNumber: int(p.SequenceNumber),
+		Timestamp:      int(p.Timestamp),
+		SSRC:           int(p.SSRC),
+		Payload:        p.Payload,
+		PayloadOffset:  offset,
+	}
+}
@@ -0,0 +1,223 @@
+package rtsp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRTPPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		want RTPPacket
+	}{
+		{
+			name: "plain",
+			raw:  []byte{0x80, 0xe0, 0x12, 0x34, 0x00, 0x00, 0x0b, 0xb8, 0xde, 0xad, 0xbe, 0xef, 0x65, 0x88},
+			want: RTPPacket{Version: 2, Marker: true, PayloadType: 96, SequenceNumber: 0x1234,
+				Timestamp: 3000, SSRC: 0xdeadbeef, Payload: []byte{0x65, 0x88}},
+		},
+		{
+			name: "csrc",
+			raw: []byte{0x82, 0x08, 0x00, 0x01, 0x00, 0x00, 0x00, 0xa0, 0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03, 0xd5},
+			want: RTPPacket{Version: 2, PayloadType: 8, SequenceNumber: 1, Timestamp: 160, SSRC: 1,
+				CSRC: []uint32{2, 3}, Payload: []byte{0xd5}},
+		},
+		{
+			name: "one-byte extension",
+			raw: []byte{0x90, 0x60, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0xbe, 0xde, 0x00, 0x01, 0x32, 0xaa, 0xbb, 0xcc, 0x01},
+			want: RTPPacket{Version: 2, PayloadType: 96, SequenceNumber: 2, SSRC: 1, Extension: true,
+				ExtensionProfile: RTPExtensionProfileOneByte, ExtensionPayload: []byte{0x32, 0xaa, 0xbb, 0xcc},
+				Payload: []byte{0x01}},
+		},
+		{
+			name: "padding",
+			raw: []byte{0xa0, 0x60, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0x01, 0x02, 0x00, 0x00, 0x03},
+			want: RTPPacket{Version: 2, PayloadType: 96, SequenceNumber: 3, SSRC: 1,
+				Payload: []byte{0x01, 0x02}, Padding: []byte{0x00, 0x00, 0x03}},
+		},
+		{
+			name: "padding only",
+			raw:  []byte{0xa0, 0x60, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02},
+			want: RTPPacket{Version: 2, PayloadType: 96, SequenceNumber: 4, SSRC: 1,
+				Payload: []byte{}, Padding: []byte{0x00, 0x02}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p RTPPacket
+			if err := p.Unmarshal(tt.raw); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("got %+v, want %+v", p, tt.want)
+			}
+			if size := p.MarshalSize(); size != len(tt.raw) {
+				t.Errorf("marshal size %d, want %d", size, len(tt.raw))
+			}
+			b, err := p.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.raw) {
+				t.Errorf("marshal %x, want %x", b, tt.raw)
+			}
+			info := p.Info()
+			parsed := ParseRTP(tt.raw)
+			if !reflect.DeepEqual(info, parsed) {
+				t.Errorf("info %+v, ParseRTP %+v", info, parsed)
+			}
+		})
+	}
+}
+
+func TestRTPPacketUnmarshalErrors(t *testing.T) {
+	header := []byte{0x80, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+	with := func(first byte, rest ...byte) []byte {
+		b := append([]byte{first}, header[1:]...)
+		return append(b, rest...)
+	}
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"too short", header[:11]},
+		{"version 1", with(0x40)},
+		{"csrc truncated", with(0x81, 0x00, 0x00)},
+		{"extension truncated", with(0x90, 0xbe, 0xde)},
+		{"extension length", with(0x90, 0xbe, 0xde, 0x00, 0x02, 0x10, 0x00, 0x00, 0x00)},
+		{"padding without data", with(0xa0)},
+		{"padding zero", with(0xa0, 0x01, 0x00)},
+		{"padding too long", with(0xa0, 0x01, 0x05)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p RTPPacket
+			if err := p.Unmarshal(tt.raw); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestRTPPacketMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		p    RTPPacket
+	}{
+		{"too many csrc", RTPPacket{CSRC: make([]uint32, 16)}},
+		{"padding mismatch", RTPPacket{Padding: []byte{0x00, 0x03}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.p.Marshal(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+	p := NewRTPPacket(96, 1, 0, 1, false, []byte{1, 2, 3})
+	if _, err := p.MarshalTo(make([]byte, 14)); err == nil {
+		t.Errorf("short buffer: expected error")
+	}
+}
+
+func TestRTPPacketExtensions(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile uint16
+		payload []byte
+		want    []RTPExtension
+	}{
+		{
+			name:    "one-byte with padding",
+			profile: RTPExtensionProfileOneByte,
+			payload: []byte{0x10, 0xaa, 0x00, 0x21, 0xbb, 0xcc, 0x00, 0x00},
+			want:    []RTPExtension{{1, []byte{0xaa}}, {2, []byte{0xbb, 0xcc}}},
+		},
+		{
+			name:    "one-byte stops at id 15",
+			profile: RTPExtensionProfileOneByte,
+			payload: []byte{0x10, 0xaa, 0xf0, 0x21},
+			want:    []RTPExtension{{1, []byte{0xaa}}},
+		},
+		{
+			name:    "two-byte",
+			profile: RTPExtensionProfileTwoByte | 0x3,
+			payload: []byte{0x01, 0x00, 0x10, 0x02, 0xaa, 0xbb, 0x00, 0x00},
+			want:    []RTPExtension{{1, []byte{}}, {16, []byte{0xaa, 0xbb}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RTPPacket{Extension: true, ExtensionProfile: tt.profile, ExtensionPayload: tt.payload}
+			exts, err := p.Extensions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(exts, tt.want) {
+				t.Errorf("got %v, want %v", exts, tt.want)
+			}
+		})
+	}
+
+	p := RTPPacket{Extension: true, ExtensionProfile: RTPExtensionProfileONVIF, ExtensionPayload: make([]byte, 12)}
+	if _, err := p.Extensions(); err == nil {
+		t.Errorf("onvif profile: expected error")
+	}
+	p = RTPPacket{Extension: true, ExtensionProfile: RTPExtensionProfileOneByte, ExtensionPayload: []byte{0x13, 0xaa}}
+	if _, err := p.Extensions(); err == nil {
+		t.Errorf("element overflow: expected error")
+	}
+}
+
+func TestRTPPacketSetExtension(t *testing.T) {
+	p := NewRTPPacket(96, 1, 0, 1, false, []byte{0x01})
+	steps := []struct {
+		name    string
+		apply   func() error
+		profile uint16
+		payload []byte
+	}{
+		{"set one-byte", func() error { return p.SetExtension(3, []byte{0xaa, 0xbb, 0xcc}) },
+			RTPExtensionProfileOneByte, []byte{0x32, 0xaa, 0xbb, 0xcc}},
+		{"replace", func() error { return p.SetExtension(3, []byte{0xdd}) },
+			RTPExtensionProfileOneByte, []byte{0x30, 0xdd, 0x00, 0x00}},
+		{"id 15 switches to two-byte", func() error { return p.SetExtension(15, []byte{0xee}) },
+			RTPExtensionProfileTwoByte, []byte{0x03, 0x01, 0xdd, 0x0f, 0x01, 0xee, 0x00, 0x00}},
+		{"delete back to one-byte", func() error { return p.DelExtension(15) },
+			RTPExtensionProfileOneByte, []byte{0x30, 0xdd, 0x00, 0x00}},
+		{"delete last", func() error { return p.DelExtension(3) }, 0, nil},
+	}
+	for _, s := range steps {
+		if err := s.apply(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if p.ExtensionProfile != s.profile || !bytes.Equal(p.ExtensionPayload, s.payload) || p.Extension != (s.payload != nil) {
+			t.Errorf("%s: got profile %04x payload %x", s.name, p.ExtensionProfile, p.ExtensionPayload)
+		}
+		b, err := p.Marshal()
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		var q RTPPacket
+		if err := q.Unmarshal(b); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if !bytes.Equal(q.Payload, []byte{0x01}) {
+			t.Errorf("%s: payload %x", s.name, q.Payload)
+		}
+	}
+	if p.GetExtension(3) != nil {
+		t.Errorf("deleted extension still present")
+	}
+	if err := p.SetExtension(0, []byte{1}); err == nil {
+		t.Errorf("id 0: expected error")
+	}
+	if err := p.SetExtension(1, make([]byte, 256)); err == nil {
+		t.Errorf("payload 256: expected error")
+	}
+}
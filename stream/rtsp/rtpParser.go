@@ -38,7 +38,7 @@ type RTPInfo struct {
   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 */
 
-// ParseRTP 解析rtp
+// ParseRTP 解析rtp，负载为空的包(例如只有padding的包)也会返回
 func ParseRTP(rtpBytes []byte) *RTPInfo {
 	if len(rtpBytes) < RTPFixedHeaderLength {
 		return nil
@@ -79,9 +79,5 @@ func ParseRTP(rtpBytes []byte) *RTPInfo {
 	}
 	info.Payload = rtpBytes[offset:end]
 	info.PayloadOffset = offset
-	if end-offset < 1 {
-		return nil
-	}
-
 	return info
 }
@@ -0,0 +1,92 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// rtpRepair 一路媒体接收端的重传和前向纠错处理，重传包和fec包与媒体包在同一个通道中以负载类型区分
+type rtpRepair struct {
+	payloadType    uint8
+	rtxPayloadType int
+	fecPayloadType int
+	fec            *FECDecoder
+	// ssrc 媒体源，重传包恢复时使用
+	ssrc    uint32
+	hasSSRC bool
+}
+
+// newRTPRepair sdp中没有rtx和fec负载类型时返回nil
+func newRTPRepair(info *SDPInfo) *rtpRepair {
+	if info == nil || (info.RTXPayloadType == 0 && info.FECPayloadType == 0) {
+		return nil
+	}
+	r := &rtpRepair{
+		payloadType:    uint8(info.PayloadType),
+		rtxPayloadType: info.RTXPayloadType,
+	}
+	if info.FECPayloadType > 0 {
+		if fec, err := NewFECDecoder(info.FECCodec); err == nil {
+			r.fec = fec
+			r.fecPayloadType = info.FECPayloadType
+		}
+	}
+	return r
+}
+
+// process 返回需要继续处理的媒体包：重传包恢复为原始包，fec包不再继续处理而返回由其恢复的包
+func (r *rtpRepair) process(pack *RTPPack) []*RTPPack {
+	b := pack.Buffer.Bytes()
+	if len(b) < 12 {
+		return []*RTPPack{pack}
+	}
+	switch pt := int(b[1] & 0x7F); {
+	case r.rtxPayloadType > 0 && pt == r.rtxPayloadType:
+		if !r.hasSSRC {
+			return nil
+		}
+		rtx := &RTPPacket{}
+		if err := rtx.Unmarshal(b); err != nil {
+			return nil
+		}
+		pkt, err := DecodeRTX(rtx, r.payloadType, r.ssrc)
+		if err != nil {
+			return nil
+		}
+		buf, err := pkt.Marshal()
+		if err != nil {
+			return nil
+		}
+		return r.media(&RTPPack{Type: pack.Type, Buffer: bytes.NewBuffer(buf)})
+	case r.fec != nil && pt == r.fecPayloadType:
+		fec := &RTPPacket{}
+		if err := fec.Unmarshal(b); err != nil {
+			return nil
+		}
+		recovered, err := r.fec.FEC(fec.Payload)
+		if err != nil {
+			return nil
+		}
+		return r.packs(pack.Type, recovered)
+	}
+	r.ssrc = binary.BigEndian.Uint32(b[8:])
+	r.hasSSRC = true
+	return r.media(pack)
+}
+
+// media 媒体包交给fec解码，返回该包和因此恢复的包
+func (r *rtpRepair) media(pack *RTPPack) []*RTPPack {
+	packs := []*RTPPack{pack}
+	if r.fec != nil {
+		packs = append(packs, r.packs(pack.Type, r.fec.Media(pack.Buffer.Bytes()))...)
+	}
+	return packs
+}
+
+func (r *rtpRepair) packs(t RTPType, packets [][]byte) []*RTPPack {
+	packs := make([]*RTPPack, 0, len(packets))
+	for _, pkt := range packets {
+		packs = append(packs, &RTPPack{Type: t, Buffer: bytes.NewBuffer(pkt)})
+	}
+	return packs
+}
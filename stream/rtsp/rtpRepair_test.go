@@ -0,0 +1,68 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testRepairPack 将rtp包封装为指定类型的包
+func testRepairPack(t *testing.T, pkt *RTPPacket) *RTPPack {
+	t.Helper()
+	b, err := pkt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RTPPack{Type: RTP_TYPE_VIDEO, Buffer: bytes.NewBuffer(b)}
+}
+
+func TestRTPRepair(t *testing.T) {
+	if newRTPRepair(&SDPInfo{PayloadType: 96}) != nil {
+		t.Errorf("repair without rtx and fec")
+	}
+	r := newRTPRepair(&SDPInfo{PayloadType: 96, RTXPayloadType: 97, FECPayloadType: 98, FECCodec: "ulpfec"})
+	media := func(seq uint16) *RTPPacket {
+		return NewRTPPacket(96, seq, uint32(seq)*3000, 0x1111, false, []byte{byte(seq), 0xAA, 0xBB})
+	}
+	// 收到媒体包之前的重传包无法确定源
+	if out := r.process(testRepairPack(t, EncodeRTX(media(1), 97, 0x2222, 1))); len(out) != 0 {
+		t.Errorf("rtx before media %d", len(out))
+	}
+	if out := r.process(testRepairPack(t, media(1))); len(out) != 1 {
+		t.Fatalf("media %d", len(out))
+	}
+
+	tests := []struct {
+		name string
+		pack *RTPPack
+		want []*RTPPacket
+	}{
+		{"rtx", testRepairPack(t, EncodeRTX(media(2), 97, 0x2222, 2)), []*RTPPacket{media(2)}},
+		{"media", testRepairPack(t, media(4)), []*RTPPacket{media(4)}},
+		{"fec", func() *RTPPack {
+			var packets [][]byte
+			for _, seq := range []uint16{2, 3, 4} {
+				b, _ := media(seq).Marshal()
+				packets = append(packets, b)
+			}
+			payload, err := EncodeULPFEC(packets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return testRepairPack(t, NewRTPPacket(98, 100, 0, 0x3333, false, payload))
+		}(), []*RTPPacket{media(3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := r.process(tt.pack)
+			if len(out) != len(tt.want) {
+				t.Fatalf("packs %d, want %d", len(out), len(tt.want))
+			}
+			for i, pkt := range tt.want {
+				want, _ := pkt.Marshal()
+				if !bytes.Equal(out[i].Buffer.Bytes(), want) || out[i].Type != RTP_TYPE_VIDEO {
+					t.Errorf("pack %d %x, want %x", i, out[i].Buffer.Bytes(), want)
+				}
+			}
+		})
+	}
+}
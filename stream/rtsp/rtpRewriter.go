@@ -0,0 +1,188 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	// rtpSpliceGap 切换源时在时间戳中插入的间隔
+	rtpSpliceGap = 40 * time.Millisecond
+	// rtpSpliceMaxTimestampJump 同一个源的时间戳跳变超过该时长时视为切换源
+	rtpSpliceMaxTimestampJump = 10 * time.Second
+)
+
+// trackRewriter 一路媒体的输出改写状态
+type trackRewriter struct {
+	initialized bool
+	clockRate   int
+	// ssrc 输出的ssrc，取第一个源的ssrc
+	ssrc uint32
+	// 当前源最近输入的ssrc、序号和时间戳
+	srcSSRC uint32
+	srcSeq  uint16
+	srcTS   uint32
+	// 输入到输出的偏移
+	seqOffset uint16
+	tsOffset  uint32
+	// 最近输出的序号和时间戳，outTime 为输出 outTS 的时间
+	outSeq  uint16
+	outTS   uint32
+	outTime time.Time
+	// splice 已对齐到的切换次数
+	splice int
+}
+
+// spliced 是否与当前源不连续：ssrc变化、序号大幅跳变或时间戳大幅跳变
+func (r *trackRewriter) spliced(ssrc uint32, seq uint16, ts uint32) bool {
+	if ssrc != r.srcSSRC {
+		return true
+	}
+	if diff := int(int16(seq - r.srcSeq)); diff < -jitterMaxMisorder || diff > jitterMaxDropout {
+		return true
+	}
+	jump := int64(int32(ts - r.srcTS))
+	if jump < 0 {
+		jump = -jump
+	}
+	return r.clockRate > 0 && jump > rtpTicks(rtpSpliceMaxTimestampJump, r.clockRate)
+}
+
+// rtpRewriter 播放器输出的ssrc、序号和时间戳改写
+// 推流端重连或拉流客户端重连后源的ssrc、序号和时间戳会重新开始，改写后播放端收到的仍是连续的流，
+// 拉流客户端重连时推流端在各路媒体的第一个包上标记不连续，其余情况按ssrc、序号和时间戳的跳变判断，
+// 每次切换时在时间戳中插入一小段间隔；源不变时包原样输出
+// 各路媒体在同一个时刻切换，所有媒体的时间戳前移相同的时长，音视频保持同步
+type rtpRewriter struct {
+	lock   sync.Mutex
+	tracks map[RTPType]*trackRewriter
+	// clockRates 切换源时获取各路媒体的时钟频率
+	clockRates func() map[RTPType]int
+	// splice 切换次数，spliceAt 切换后的输出时刻，取各路媒体最近输出时刻加上间隔中最晚的，
+	// spliceStart 第一路媒体收到新源的时刻
+	splice      int
+	spliceAt    time.Time
+	spliceStart time.Time
+}
+
+func newRTPRewriter(clockRates func() map[RTPType]int) *rtpRewriter {
+	return &rtpRewriter{
+		tracks:     make(map[RTPType]*trackRewriter),
+		clockRates: clockRates,
+	}
+}
+
+// rewrite 改写rtp包，now 为包的输出时刻，需要改写时返回新的包，不修改推流端共享的包
+func (r *rtpRewriter) rewrite(pack *RTPPack, now time.Time) *RTPPack {
+	if isRTCP(pack.Type) {
+		return pack
+	}
+	b := pack.Buffer.Bytes()
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return pack
+	}
+	seq := binary.BigEndian.Uint16(b[2:])
+	ts := binary.BigEndian.Uint32(b[4:])
+	ssrc := binary.BigEndian.Uint32(b[8:])
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	t := r.tracks[pack.Type]
+	if t == nil {
+		t = &trackRewriter{}
+		r.tracks[pack.Type] = t
+	}
+	switch {
+	case !t.initialized:
+		t.initialized = true
+		t.clockRate = r.clockRate(pack.Type)
+		t.ssrc = ssrc
+		t.outSeq, t.outTS, t.outTime = seq, ts, now
+		t.splice = r.splice
+	case pack.Discontinuity || t.spliced(ssrc, seq, ts):
+		if t.splice == r.splice {
+			// 第一路收到新源的媒体，确定所有媒体共同的切换时刻
+			r.startSplice(now)
+		}
+		t.splice = r.splice
+		// 新源的时钟频率可能不同
+		t.clockRate = r.clockRate(pack.Type)
+		t.seqOffset = t.outSeq + 1 - seq
+		// 从最近的输出到切换时刻，再加上本路新源晚于第一路到达的时长
+		elapsed := r.spliceAt.Sub(t.outTime) + now.Sub(r.spliceStart)
+		t.tsOffset = t.outTS + uint32(rtpTicks(elapsed, t.clockRate)) - ts
+	}
+	t.srcSSRC, t.srcSeq, t.srcTS = ssrc, seq, ts
+	outSeq, outTS := seq+t.seqOffset, ts+t.tsOffset
+	// 迟到的包不回退输出位置
+	if int16(outSeq-t.outSeq) >= 0 {
+		t.outSeq, t.outTS, t.outTime = outSeq, outTS, now
+	}
+	return t.apply(pack)
+}
+
+// startSplice 开始一次切换，切换时刻为各路媒体最近输出时刻加上间隔中最晚的
+func (r *rtpRewriter) startSplice(now time.Time) {
+	r.splice++
+	r.spliceAt, r.spliceStart = time.Time{}, now
+	for _, t := range r.tracks {
+		if at := t.outTime.Add(rtpSpliceGap); t.initialized && at.After(r.spliceAt) {
+			r.spliceAt = at
+		}
+	}
+}
+
+// apply 按当前偏移改写包，不改变状态
+func (r *trackRewriter) apply(pack *RTPPack) *RTPPack {
+	b := pack.Buffer.Bytes()
+	if r.seqOffset == 0 && r.tsOffset == 0 && r.ssrc == binary.BigEndian.Uint32(b[8:]) {
+		return pack
+	}
+	out := make([]byte, len(b))
+	copy(out, b)
+	binary.BigEndian.PutUint16(out[2:], binary.BigEndian.Uint16(b[2:])+r.seqOffset)
+	binary.BigEndian.PutUint32(out[4:], binary.BigEndian.Uint32(b[4:])+r.tsOffset)
+	binary.BigEndian.PutUint32(out[8:], r.ssrc)
+	return &RTPPack{Type: pack.Type, Buffer: bytes.NewBuffer(out), CaptureTime: pack.CaptureTime}
+}
+
+// source 输出的ssrc和序号对应的当前源的ssrc和序号，用于查找重传的包
+func (r *rtpRewriter) source(t RTPType, ssrc uint32, seq uint16) (uint32, uint16, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	track := r.tracks[t]
+	if track == nil || track.ssrc != ssrc {
+		return 0, 0, false
+	}
+	return track.srcSSRC, seq - track.seqOffset, true
+}
+
+// retransmit 按当前偏移改写重传的包，源已切换时返回nil
+func (r *rtpRewriter) retransmit(pack *RTPPack) *RTPPack {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	track := r.tracks[pack.Type]
+	if track == nil || binary.BigEndian.Uint32(pack.Buffer.Bytes()[8:]) != track.srcSSRC {
+		return nil
+	}
+	return track.apply(pack)
+}
+
+// sourceTimestamp 输出的时间戳换算为当前源的时间戳
+func (r *rtpRewriter) sourceTimestamp(t RTPType, ts uint32) uint32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if track := r.tracks[t]; track != nil {
+		return ts - track.tsOffset
+	}
+	return ts
+}
+
+func (r *rtpRewriter) clockRate(t RTPType) int {
+	if r.clockRates == nil {
+		return 0
+	}
+	return r.clockRates()[t]
+}
@@ -0,0 +1,148 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// rtpHeader 取出包的序号、时间戳和ssrc
+func rtpHeader(pack *RTPPack) (uint16, uint32, uint32) {
+	b := pack.Buffer.Bytes()
+	return binary.BigEndian.Uint16(b[2:]), binary.BigEndian.Uint32(b[4:]), binary.BigEndian.Uint32(b[8:])
+}
+
+func testClockRates() map[RTPType]int {
+	return map[RTPType]int{RTP_TYPE_VIDEO: 90000, RTP_TYPE_AUDIO: 48000}
+}
+
+func TestRTPRewriterPassThrough(t *testing.T) {
+	r := newRTPRewriter(testClockRates)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		pack := testRTPPack(t, RTP_TYPE_VIDEO, 0x1111, uint16(65534+i), uint32(i*3600))
+		if out := r.rewrite(pack, start.Add(time.Duration(i)*40*time.Millisecond)); out != pack {
+			t.Errorf("packet %d rewritten", i)
+		}
+	}
+	control := testSRPack(t, RTP_TYPE_VIDEOCONTROL, 0x1111, start, 0)
+	if out := r.rewrite(control, start); out != control {
+		t.Errorf("rtcp rewritten")
+	}
+}
+
+func TestRTPRewriterSplice(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name string
+		ssrc uint32
+		seq  uint16
+		ts   uint32
+		// discontinuity 新源的第一个包带有拉流客户端重连的标记
+		discontinuity bool
+	}{
+		{"ssrc change", 0x2222, 5000, 123456, false},
+		{"sequence jump", 0x1111, 10000, 7200 + 3600, false},
+		{"timestamp jump", 0x1111, 103, 7200 + 20*90000, false},
+		{"ssrc change same numbers", 0x2222, 103, 10800, false},
+		// 序号和时间戳的回退都在跳变范围内
+		{"reconnect marked", 0x1111, 95, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRTPRewriter(testClockRates)
+			for i := 0; i < 3; i++ {
+				r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 0x1111, uint16(100+i), uint32(i*3600)), start.Add(time.Duration(i)*40*time.Millisecond))
+			}
+			// 新源的前两个包，间隔40ms
+			for i, want := range []struct {
+				seq uint16
+				ts  uint32
+			}{
+				{103, 7200 + 3600},
+				{104, 7200 + 7200},
+			} {
+				pack := testRTPPack(t, RTP_TYPE_VIDEO, tt.ssrc, tt.seq+uint16(i), tt.ts+uint32(i*3600))
+				pack.Discontinuity = tt.discontinuity && i == 0
+				out := r.rewrite(pack, start.Add(200*time.Millisecond+time.Duration(i)*40*time.Millisecond))
+				seq, ts, ssrc := rtpHeader(out)
+				if seq != want.seq || ts != want.ts || ssrc != 0x1111 {
+					t.Errorf("packet %d seq[%d] ts[%d] ssrc[%x], want seq[%d] ts[%d]", i, seq, ts, ssrc, want.seq, want.ts)
+				}
+				if _, srcTS, _ := rtpHeader(pack); srcTS != tt.ts+uint32(i*3600) {
+					t.Errorf("shared packet modified")
+				}
+			}
+			// 重传按输出序号找回源的包
+			ssrc, seq, ok := r.source(RTP_TYPE_VIDEO, 0x1111, 104)
+			if !ok || ssrc != tt.ssrc || seq != tt.seq+1 {
+				t.Errorf("source %x %d %v", ssrc, seq, ok)
+			}
+			if _, _, ok := r.source(RTP_TYPE_VIDEO, tt.ssrc+1, 104); ok {
+				t.Errorf("source found for unknown ssrc")
+			}
+			if ts := r.sourceTimestamp(RTP_TYPE_VIDEO, 7200+7200); ts != tt.ts+3600 {
+				t.Errorf("source timestamp %d", ts)
+			}
+			resend := r.retransmit(testRTPPack(t, RTP_TYPE_VIDEO, tt.ssrc, tt.seq, tt.ts))
+			if resend == nil {
+				t.Fatal("retransmit nil")
+			}
+			if seq, ts, _ := rtpHeader(resend); seq != 103 || ts != 10800 {
+				t.Errorf("retransmit seq[%d] ts[%d]", seq, ts)
+			}
+		})
+	}
+}
+
+func TestRTPRewriterLatePacket(t *testing.T) {
+	r := newRTPRewriter(testClockRates)
+	start := time.Unix(1000, 0)
+	r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 1, 10, 0), start)
+	r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 1, 12, 7200), start.Add(80*time.Millisecond))
+	r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 2, 500, 0), start.Add(200*time.Millisecond))
+	// 新源中迟到的包不回退输出位置
+	if seq, _, _ := rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 2, 502, 7200), start.Add(280*time.Millisecond))); seq != 15 {
+		t.Errorf("seq %d, want 15", seq)
+	}
+	if seq, _, _ := rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 2, 501, 3600), start.Add(290*time.Millisecond))); seq != 14 {
+		t.Errorf("late seq %d, want 14", seq)
+	}
+	if seq, _, _ := rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 2, 503, 10800), start.Add(320*time.Millisecond))); seq != 16 {
+		t.Errorf("seq %d, want 16", seq)
+	}
+	// 旧源的包已无法重传
+	if r.retransmit(testRTPPack(t, RTP_TYPE_VIDEO, 1, 12, 7200)) != nil {
+		t.Errorf("retransmit from previous source")
+	}
+}
+
+// TestRTPRewriterAVSync 音视频在共同的切换时刻对齐，切换后两路时间戳对应的时间保持一致
+func TestRTPRewriterAVSync(t *testing.T) {
+	r := newRTPRewriter(testClockRates)
+	start := time.Unix(1000, 0)
+	// 视频最后输出在80ms，音频在100ms，两路时间戳都从0开始
+	for i := 0; i < 3; i++ {
+		r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 1, uint16(i), uint32(i*3600)), start.Add(time.Duration(i)*40*time.Millisecond))
+	}
+	for i := 0; i < 6; i++ {
+		r.rewrite(testRTPPack(t, RTP_TYPE_AUDIO, 2, uint16(i), uint32(i*960)), start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	// 切换时刻为 max(80ms, 100ms)+40ms=140ms，音频晚到10ms
+	_, videoTS, _ := rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 3, 7000, 555), start.Add(300*time.Millisecond)))
+	_, audioTS, _ := rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_AUDIO, 4, 9000, 777), start.Add(310*time.Millisecond)))
+	video := time.Duration(videoTS) * time.Second / 90000
+	audio := time.Duration(audioTS) * time.Second / 48000
+	if video != 140*time.Millisecond || audio != 150*time.Millisecond {
+		t.Errorf("video %v audio %v, want 140ms 150ms", video, audio)
+	}
+
+	// 第二次切换，两路再次对齐
+	_, videoTS, _ = rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_VIDEO, 5, 1, 0), start.Add(600*time.Millisecond)))
+	_, audioTS, _ = rtpHeader(r.rewrite(testRTPPack(t, RTP_TYPE_AUDIO, 6, 1, 0), start.Add(600*time.Millisecond)))
+	video = time.Duration(videoTS) * time.Second / 90000
+	audio = time.Duration(audioTS) * time.Second / 48000
+	if video != 190*time.Millisecond || audio != 190*time.Millisecond {
+		t.Errorf("second splice video %v audio %v, want 190ms", video, audio)
+	}
+}
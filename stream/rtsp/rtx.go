@@ -0,0 +1,47 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/**
+
+  0                   1                   2                   3
+  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |                         RTP Header                            |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |            OSN                |                               |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               |
+  |                  Original RTP Packet Payload                  |
+  |                                                               |
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// EncodeRTX 将原始包封装为重传包(RFC 4588)，重传流使用独立的负载类型、ssrc和序号，时间戳和头部扩展不变
+func EncodeRTX(pkt *RTPPacket, payloadType uint8, ssrc uint32, seq uint16) *RTPPacket {
+	rtx := *pkt
+	rtx.PayloadType = payloadType
+	rtx.SSRC = ssrc
+	rtx.SequenceNumber = seq
+	rtx.Padding = nil
+	rtx.Payload = make([]byte, 2+len(pkt.Payload))
+	binary.BigEndian.PutUint16(rtx.Payload, pkt.SequenceNumber)
+	copy(rtx.Payload[2:], pkt.Payload)
+	return &rtx
+}
+
+// DecodeRTX 由重传包恢复原始包，payloadType和ssrc为原始流的负载类型和ssrc
+func DecodeRTX(rtx *RTPPacket, payloadType uint8, ssrc uint32) (*RTPPacket, error) {
+	if len(rtx.Payload) < 2 {
+		return nil, fmt.Errorf("rtx payload too short: %d", len(rtx.Payload))
+	}
+	pkt := *rtx
+	pkt.PayloadType = payloadType
+	pkt.SSRC = ssrc
+	pkt.SequenceNumber = binary.BigEndian.Uint16(rtx.Payload)
+	pkt.Padding = nil
+	pkt.Payload = append([]byte(nil), rtx.Payload[2:]...)
+	return &pkt, nil
+}
@@ -0,0 +1,58 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRTXRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker bool
+		ext    bool
+	}{
+		{"plain", false, false},
+		{"marker", true, false},
+		{"extension", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkt := NewRTPPacket(96, 1234, 90000, 0x1111, tt.marker, []byte{0x65, 0x88, 0x01, 0x02})
+			if tt.ext {
+				if err := pkt.SetExtension(3, []byte{0x12, 0x34, 0x56}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, _ := pkt.Marshal()
+			rtx := EncodeRTX(pkt, 97, 0x2222, 7)
+			if rtx.PayloadType != 97 || rtx.SSRC != 0x2222 || rtx.SequenceNumber != 7 || rtx.Timestamp != 90000 || rtx.Marker != tt.marker {
+				t.Errorf("rtx header %+v", rtx)
+			}
+			if !bytes.Equal(rtx.Payload[:2], []byte{0x04, 0xD2}) {
+				t.Errorf("osn %x", rtx.Payload[:2])
+			}
+			b, err := rtx.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed := &RTPPacket{}
+			if err := parsed.Unmarshal(b); err != nil {
+				t.Fatal(err)
+			}
+			orig, err := DecodeRTX(parsed, 96, 0x1111)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := orig.Marshal(); !bytes.Equal(got, want) {
+				t.Errorf("decoded %x, want %x", got, want)
+			}
+			// 原包不被修改
+			if got, _ := pkt.Marshal(); !bytes.Equal(got, want) {
+				t.Errorf("original modified")
+			}
+		})
+	}
+	if _, err := DecodeRTX(NewRTPPacket(97, 1, 0, 1, false, []byte{1}), 96, 1); err == nil {
+		t.Errorf("short rtx accepted")
+	}
+}
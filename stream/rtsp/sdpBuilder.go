@@ -0,0 +1,235 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/common"
+	"github.com/mrHChen/goutils/stream/nalcrypt"
+	"github.com/mrHChen/goutils/stream/srtp"
+	"github.com/pixelbender/go-sdp/sdp"
+)
+
+// 下发给播放端时保留的媒体级属性，其余（control、range、方向等）全部丢弃
+var sdpKeepMediaAttrs = map[string]bool{
+	"framerate":    true,
+	"framesize":    true,
+	"x-framerate":  true,
+	"x-dimensions": true,
+	"cliprect":     true,
+	"ptime":        true,
+	"maxptime":     true,
+	// NALU加密参数，转发时保持不变
+	nalcrypt.SDPAttribute: true,
+}
+
+// 下发给播放端时保留的头部扩展，转发的rtp包中保持推流端的扩展ID
+// transport-cc 需要服务端回复反馈，不下发
+var sdpKeepExtensions = map[string]bool{
+	ExtensionURIAbsSendTime: true,
+	ExtensionURIAudioLevel:  true,
+	ExtensionURISDESMid:     true,
+}
+
+// SDPControl 下发给播放端的sdp中一路媒体的类型和控制地址
+type SDPControl struct {
+	Type    string
+	Control string
+}
+
+// SDPOptions 生成播放端sdp的参数
+type SDPOptions struct {
+	// 会话名称，为空时使用 Stream
+	Name string
+	// 服务端地址，用于o=和c=行
+	Address string
+	// 带内获取的参数集，key为媒体类型(audio/video)
+	ParameterSets map[string][][]byte
+	// 媒体的SRTP密钥，key为媒体类型(audio/video)，有时该媒体使用RTP/SAVP并携带a=crypto
+	Crypto map[string]*srtp.Crypto
+	// 附加的媒体级属性，key为媒体类型(audio/video)，值为空时去掉推流端sdp中的同名属性
+	Attributes map[string]map[string]string
+}
+
+// BuildSDP 根据推流端的sdp生成下发给播放端的sdp
+// 控制地址改写为相对地址 trackID=N，o=、c=、s= 使用本服务的信息，保留编码相关的rtpmap/fmtp
+// 以及服务端支持的头部扩展和NACK反馈，返回新的sdp以及按媒体顺序排列的control
+func BuildSDP(sdpRaw string, options SDPOptions) (string, []SDPControl, error) {
+	src, err := sdp.ParseString(sdpRaw)
+	if err != nil {
+		return "", nil, fmt.Errorf("parse sdp error:%s", err)
+	}
+
+	if options.Name == "" {
+		options.Name = "Stream"
+	}
+	addrType, address := sdp.TypeIPv4, "0.0.0.0"
+	if ip := net.ParseIP(options.Address); ip != nil && !ip.IsUnspecified() {
+		address = ip.String()
+		if ip.To4() == nil {
+			addrType = sdp.TypeIPv6
+		}
+	}
+
+	now := time.Now().Unix()
+	dst := &sdp.Session{
+		Origin: &sdp.Origin{
+			Username:       "-",
+			SessionID:      now,
+			SessionVersion: now,
+			Network:        sdp.NetworkInternet,
+			Type:           addrType,
+			Address:        address,
+		},
+		Name: options.Name,
+		Connection: &sdp.Connection{
+			Network: sdp.NetworkInternet,
+			Type:    addrType,
+			Address: address,
+		},
+		Attributes: sdp.Attributes{
+			sdp.NewAttr("tool", common.GetAgent()),
+			sdp.NewAttr("range", "npt=now-"),
+			sdp.NewAttr("control", "*"),
+		},
+	}
+
+	var controls []SDPControl
+	for _, media := range src.Media {
+		if media.Type != "audio" && media.Type != "video" {
+			continue
+		}
+		control := fmt.Sprintf("trackID=%d", len(dst.Media))
+		controls = append(controls, SDPControl{Type: media.Type, Control: control})
+
+		m := &sdp.Media{
+			Type:      media.Type,
+			Proto:     "RTP/AVP",
+			Bandwidth: media.Bandwidth,
+			Format:    sdpFormats(media.Format),
+		}
+		attrs := options.Attributes[media.Type]
+		for _, attr := range media.Attributes {
+			if _, ok := attrs[attr.Name]; !ok && keepMediaAttr(attr) {
+				m.Attributes = append(m.Attributes, attr)
+			}
+		}
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if attrs[name] != "" {
+				m.Attributes = append(m.Attributes, sdp.NewAttr(name, attrs[name]))
+			}
+		}
+		m.Attributes = append(m.Attributes, sdp.NewAttr("control", control))
+		if crypto := options.Crypto[media.Type]; crypto != nil {
+			m.Proto = "RTP/SAVP"
+			m.Attributes = append(m.Attributes, sdp.NewAttr("crypto", crypto.String()))
+		}
+
+		if sets := options.ParameterSets[media.Type]; len(sets) > 0 && len(m.Format) > 0 {
+			fillParameterSets(m.Format[0], sets)
+		}
+		dst.Media = append(dst.Media, m)
+	}
+	return dst.String(), controls, nil
+}
+
+// trackControl 该类型中被转发的媒体的control
+// 与 ParseSDP 一致，同类型有多路媒体时只转发最后一路
+func trackControl(controls []SDPControl, avType string) string {
+	control := ""
+	for _, c := range controls {
+		if c.Type == avType {
+			control = c.Control
+		}
+	}
+	return control
+}
+
+// keepMediaAttr 媒体级属性是否下发给播放端
+func keepMediaAttr(attr *sdp.Attr) bool {
+	if attr.Name == "extmap" {
+		// a=extmap:<id>[/direction] <uri> [attributes]
+		fields := strings.Fields(attr.Value)
+		return len(fields) >= 2 && sdpKeepExtensions[fields[1]]
+	}
+	return sdpKeepMediaAttrs[attr.Name]
+}
+
+// sdpFormats 复制负载格式，a=rtcp-fb 只保留服务端响应的通用NACK，pli、fir等反馈不下发
+func sdpFormats(formats []*sdp.Format) []*sdp.Format {
+	dst := make([]*sdp.Format, 0, len(formats))
+	for _, f := range formats {
+		format := *f
+		format.Feedback = nil
+		for _, fb := range f.Feedback {
+			if strings.TrimSpace(fb) == "nack" {
+				format.Feedback = append(format.Feedback, fb)
+			}
+		}
+		dst = append(dst, &format)
+	}
+	return dst
+}
+
+// fillParameterSets 推流端未在fmtp中携带参数集时，使用带内的VPS/SPS/PPS补全
+func fillParameterSets(format *sdp.Format, sets [][]byte) {
+	var params []string
+	if len(format.Params) > 0 {
+		for _, param := range strings.Split(format.Params[0], ";") {
+			if param = strings.TrimSpace(param); param != "" {
+				params = append(params, param)
+			}
+		}
+	}
+	hasParam := func(name string) bool {
+		for _, param := range params {
+			if strings.HasPrefix(strings.ToLower(param), name+"=") {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch strings.ToUpper(format.Name) {
+	case "H264":
+		if hasParam("sprop-parameter-sets") || len(sets) < 2 || len(sets[0]) < 4 {
+			return
+		}
+		if !hasParam("packetization-mode") {
+			params = append(params, "packetization-mode=1")
+		}
+		if !hasParam("profile-level-id") {
+			params = append(params, "profile-level-id="+strings.ToUpper(hex.EncodeToString(sets[0][1:4])))
+		}
+		params = append(params, "sprop-parameter-sets="+
+			base64.StdEncoding.EncodeToString(sets[0])+","+
+			base64.StdEncoding.EncodeToString(sets[1]))
+	case "H265":
+		if hasParam("sprop-vps") || hasParam("sprop-sps") || hasParam("sprop-pps") || len(sets) < 3 {
+			return
+		}
+		params = append(params,
+			"sprop-vps="+base64.StdEncoding.EncodeToString(sets[0]),
+			"sprop-sps="+base64.StdEncoding.EncodeToString(sets[1]),
+			"sprop-pps="+base64.StdEncoding.EncodeToString(sets[2]))
+	default:
+		return
+	}
+
+	value := strings.Join(params, ";")
+	if len(format.Params) > 0 {
+		format.Params[0] = value
+	} else {
+		format.Params = []string{value}
+	}
+}
@@ -0,0 +1,174 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/srtp"
+	"github.com/pixelbender/go-sdp/sdp"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// testSourceSDP 推流端sdp，control为绝对地址，视频不携带参数集
+const testSourceSDP = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.168.1.64\r\n" +
+	"s=camera\r\n" +
+	"c=IN IP4 192.168.1.64\r\n" +
+	"t=0 0\r\n" +
+	"a=control:rtsp://192.168.1.64/live\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1\r\n" +
+	"a=framerate:25\r\n" +
+	"a=extmap:1 " + ExtensionURIAbsSendTime + "\r\n" +
+	"a=extmap:2 " + ExtensionURITransportCC + "\r\n" +
+	"a=rtcp-fb:96 nack\r\n" +
+	"a=rtcp-fb:96 nack pli\r\n" +
+	"a=recvonly\r\n" +
+	"a=control:rtsp://192.168.1.64/live/track1\r\n" +
+	"m=application 0 RTP/AVP 107\r\n" +
+	"a=rtpmap:107 vnd.onvif.metadata/90000\r\n" +
+	"a=control:rtsp://192.168.1.64/live/track2\r\n" +
+	"m=audio 0 RTP/AVP 8\r\n" +
+	"a=rtpmap:8 PCMA/8000\r\n" +
+	"a=control:rtsp://192.168.1.64/live/track3\r\n"
+
+func TestBuildSDP(t *testing.T) {
+	sps := mustHex("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := mustHex("68cb83cb20")
+	crypto, err := srtp.ParseCrypto("1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		options  SDPOptions
+		contains []string
+		excludes []string
+	}{
+		{"relative controls", SDPOptions{Address: "10.0.0.1"},
+			[]string{"s=Stream", "c=IN IP4 10.0.0.1", "a=control:*", "m=video 0 RTP/AVP 96", "a=framerate:25",
+				"a=control:trackID=0", "m=audio 0 RTP/AVP 8", "a=control:trackID=1",
+				"a=extmap:1 " + ExtensionURIAbsSendTime, "a=rtcp-fb:96 nack"},
+			[]string{"rtsp://", "a=recvonly", "m=application", "sprop-parameter-sets", "a=extmap:2", "nack pli"}},
+		{"unspecified address", SDPOptions{Name: "cam", Address: "0.0.0.0"},
+			[]string{"s=cam", "c=IN IP4 0.0.0.0"}, nil},
+		{"ipv6 address", SDPOptions{Address: "::1"},
+			[]string{"c=IN IP6 ::1"}, nil},
+		{"parameter sets", SDPOptions{ParameterSets: map[string][][]byte{"video": {sps, pps}}},
+			[]string{"a=fmtp:96 packetization-mode=1;profile-level-id=42C01F;sprop-parameter-sets=Z0LAH9kAeAIn5cBEAAADAAQAAAMA8DxgySA=,aMuDyyA="}, nil},
+		{"attributes", SDPOptions{Attributes: map[string]map[string]string{"video": {"framerate": "", "framesize": "96 1920-1080"}}},
+			[]string{"a=framesize:96 1920-1080"}, []string{"a=framerate"}},
+		{"crypto", SDPOptions{Crypto: map[string]*srtp.Crypto{"audio": crypto}},
+			[]string{"m=video 0 RTP/AVP 96", "m=audio 0 RTP/SAVP 8", "a=crypto:" + crypto.String()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdpRaw, controls, err := BuildSDP(testSourceSDP, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(controls) != 2 || controls[0] != (SDPControl{"video", "trackID=0"}) || controls[1] != (SDPControl{"audio", "trackID=1"}) {
+				t.Errorf("controls %v", controls)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(sdpRaw, s+"\r\n") {
+					t.Errorf("sdp missing %q:\n%s", s, sdpRaw)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(sdpRaw, s) {
+					t.Errorf("sdp contains %q:\n%s", s, sdpRaw)
+				}
+			}
+			// 生成的sdp可以被本服务自身解析
+			infos := ParseSDP(sdpRaw)
+			if infos["video"] == nil || infos["video"].Control != "trackID=0" || infos["audio"] == nil || infos["audio"].Control != "trackID=1" {
+				t.Errorf("parsed sdp %v", infos)
+			}
+		})
+	}
+}
+
+func TestFillParameterSets(t *testing.T) {
+	sps := mustHex("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := mustHex("68cb83cb20")
+	vps := mustHex("40010c01ffff016000000300900000030000030078959809")
+	tests := []struct {
+		name   string
+		format *sdp.Format
+		sets   [][]byte
+		params []string
+	}{
+		{"h264 no fmtp", &sdp.Format{Name: "H264"}, [][]byte{sps, pps},
+			[]string{"packetization-mode=1;profile-level-id=42C01F;sprop-parameter-sets=Z0LAH9kAeAIn5cBEAAADAAQAAAMA8DxgySA=,aMuDyyA="}},
+		{"h264 keep profile", &sdp.Format{Name: "h264", Params: []string{"profile-level-id=640028; packetization-mode=0"}}, [][]byte{sps, pps},
+			[]string{"profile-level-id=640028;packetization-mode=0;sprop-parameter-sets=Z0LAH9kAeAIn5cBEAAADAAQAAAMA8DxgySA=,aMuDyyA="}},
+		{"h264 has sprop", &sdp.Format{Name: "H264", Params: []string{"sprop-parameter-sets=AAAA,BBBB"}}, [][]byte{sps, pps},
+			[]string{"sprop-parameter-sets=AAAA,BBBB"}},
+		{"h264 missing pps", &sdp.Format{Name: "H264"}, [][]byte{sps}, nil},
+		{"h265", &sdp.Format{Name: "H265"}, [][]byte{vps, sps, pps},
+			[]string{"sprop-vps=QAEMAf//AWAAAAMAkAAAAwAAAwB4lZgJ;sprop-sps=Z0LAH9kAeAIn5cBEAAADAAQAAAMA8DxgySA=;sprop-pps=aMuDyyA="}},
+		{"h265 has sprop", &sdp.Format{Name: "H265", Params: []string{"sprop-sps=AAAA"}}, [][]byte{vps, sps, pps},
+			[]string{"sprop-sps=AAAA"}},
+		{"other codec", &sdp.Format{Name: "VP8"}, [][]byte{sps, pps}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fillParameterSets(tt.format, tt.sets)
+			if strings.Join(tt.format.Params, "\n") != strings.Join(tt.params, "\n") || len(tt.format.Params) != len(tt.params) {
+				t.Errorf("params %q, want %q", tt.format.Params, tt.params)
+			}
+		})
+	}
+}
+
+func TestBuildSDPMultipleTracks(t *testing.T) {
+	src := "v=0\r\no=- 1 1 IN IP4 127.0.0.1\r\ns=camera\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:track1\r\n" +
+		"m=audio 0 RTP/AVP 0\r\na=control:track2\r\n" +
+		"m=video 0 RTP/AVP 97\r\na=rtpmap:97 H265/90000\r\na=control:track3\r\n"
+	sdpRaw, controls, err := BuildSDP(src, SDPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SDPControl{{"video", "trackID=0"}, {"audio", "trackID=1"}, {"video", "trackID=2"}}
+	if len(controls) != len(want) {
+		t.Fatalf("controls %v", controls)
+	}
+	for i := range want {
+		if controls[i] != want[i] {
+			t.Errorf("controls[%d] %v, want %v", i, controls[i], want[i])
+		}
+	}
+	// 转发的媒体与 ParseSDP 的结果一致
+	infos := ParseSDP(sdpRaw)
+	if c := trackControl(controls, "video"); c != "trackID=2" || infos["video"].Control != c {
+		t.Errorf("video control %s, parsed %s", c, infos["video"].Control)
+	}
+	if c := trackControl(controls, "audio"); c != "trackID=1" || infos["audio"].Control != c {
+		t.Errorf("audio control %s, parsed %s", c, infos["audio"].Control)
+	}
+}
+
+func TestBuildSDPParameterSetsRoundTrip(t *testing.T) {
+	sps := mustHex("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := mustHex("68cb83cb20")
+	sdpRaw, _, err := BuildSDP(testSourceSDP, SDPOptions{ParameterSets: map[string][][]byte{"video": {sps, pps}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := ParseSDP(sdpRaw)["video"]
+	if info == nil || len(info.ParameterSets) != 2 || !bytes.Equal(info.ParameterSets[0], sps) || !bytes.Equal(info.ParameterSets[1], pps) {
+		t.Errorf("parsed parameter sets %v", info)
+	}
+}
@@ -5,19 +5,93 @@ import (
 	"encoding/hex"
 	"strconv"
 	"strings"
+
+	"github.com/mrHChen/goutils/stream/codec/aac"
+	"github.com/mrHChen/goutils/stream/nalcrypt"
+	"github.com/mrHChen/goutils/stream/srtp"
 )
 
 type SDPInfo struct {
-	AVType        string
-	Codec         string
-	TimeScale     int
-	Control       string
-	RtpMap        int
-	Config        []byte
+	AVType    string
+	Codec     string
+	TimeScale int
+	Control   string
+	RtpMap    int
+	Config    []byte
+	// h264为sprop-parameter-sets，h265为sprop-vps/sprop-sps/sprop-pps
 	ParameterSets [][]byte
 	PayloadType   int
 	SizeLength    int
 	IndexLength   int
+	// h265 sprop-max-don-diff，大于0时聚合包和分片包中携带DONL字段
+	MaxDonDiff int
+	// mpeg4-generic AU-header 中其余字段的长度(RFC 3640)
+	IndexDeltaLength        int
+	CTSDeltaLength          int
+	DTSDeltaLength          int
+	RandomAccessIndication  bool
+	StreamStateIndication   int
+	AuxiliaryDataSizeLength int
+	ConstantSize            int
+	ConstantDuration        int
+	// mp4a-latm 是否在带内携带StreamMuxConfig，默认为true(RFC 6416)
+	CPresent bool
+	// 音频采样率和声道数，aac取自config，opus声道数取自sprop-stereo
+	SampleRate   int
+	ChannelCount int
+	// ExtMap a=extmap 协商的rtp头部扩展
+	ExtMap RTPExtensionMap
+	// 重传(RFC 4588)的负载类型和缓存时长(毫秒)，没有时为0
+	RTXPayloadType int
+	RTXTime        int
+	// 前向纠错(ulpfec/flexfec)的负载类型和编码名称，没有时为0
+	FECPayloadType int
+	FECCodec       string
+	// Crypto RTP/SAVP媒体的a=crypto(SDES)，有多个时取第一个支持的，没有时为nil
+	Crypto *srtp.Crypto
+	// NALEncryption 视频NALU的加密参数，未加密时为nil
+	NALEncryption *nalcrypt.Params
+}
+
+// staticPayloadType rtp静态负载类型对应的编码参数
+type staticPayloadType struct {
+	codec      string
+	clockRate  int
+	sampleRate int
+	channels   int
+}
+
+// staticPayloadTypes RFC 3551 静态负载类型，sdp中缺少rtpmap时使用
+var staticPayloadTypes = map[int]staticPayloadType{
+	0:  {"pcmu", 8000, 8000, 1},
+	3:  {"gsm", 8000, 8000, 1},
+	4:  {"g723", 8000, 8000, 1},
+	5:  {"dvi4", 8000, 8000, 1},
+	6:  {"dvi4", 16000, 16000, 1},
+	7:  {"lpc", 8000, 8000, 1},
+	8:  {"pcma", 8000, 8000, 1},
+	9:  {"g722", 8000, 16000, 1},
+	10: {"l16", 44100, 44100, 2},
+	11: {"l16", 44100, 44100, 1},
+	12: {"qcelp", 8000, 8000, 1},
+	13: {"cn", 8000, 8000, 1},
+	14: {"mpa", 90000, 0, 0},
+	15: {"g728", 8000, 8000, 1},
+	16: {"dvi4", 11025, 11025, 1},
+	17: {"dvi4", 22050, 22050, 1},
+	18: {"g729", 8000, 8000, 1},
+	25: {"celb", 90000, 0, 0},
+	26: {"jpeg", 90000, 0, 0},
+	28: {"nv", 90000, 0, 0},
+	31: {"h261", 90000, 0, 0},
+	32: {"mpv", 90000, 0, 0},
+	33: {"mp2t", 90000, 0, 0},
+	34: {"h263", 90000, 0, 0},
+}
+
+// StaticPayloadCodec 静态负载类型对应的编码名称，动态负载类型返回空
+func StaticPayloadCodec(payloadType int) string {
+	return staticPayloadTypes[payloadType].codec
 }
 
 // ParseSDP 解析sdp包
@@ -41,67 +115,227 @@ func ParseSDP(sdpRaw string) map[string]*SDPInfo {
 						mFields := strings.Split(fields[1], " ")
 						if len(mFields) >= 3 {
 							info.PayloadType, _ = strconv.Atoi(mFields[2])
+							if pt, ok := staticPayloadTypes[info.PayloadType]; ok {
+								info.Codec = pt.codec
+								info.TimeScale = pt.clockRate
+								info.SampleRate = pt.sampleRate
+								info.ChannelCount = pt.channels
+							}
 						}
 					}
 				}
 			case "a": // 会话级别属性
 				if info != nil {
-					for _, field := range fields {
-						keyVal := strings.SplitN(field, ":", 2)
-						if len(keyVal) >= 2 {
-							key := keyVal[0]
-							val := keyVal[1]
-							switch key {
-							case "control":
-								info.Control = val
-							case "rtpmap":
-								info.RtpMap, _ = strconv.Atoi(val)
-							}
+					// m行中有多个负载类型时只取第一个的rtpmap和fmtp
+					if len(fields) == 2 && strings.HasPrefix(fields[0], "fmtp:") {
+						pt := strings.TrimPrefix(fields[0], "fmtp:")
+						if info.isPayloadType(pt) {
+							info.parseFmtp(fields[1])
+						} else {
+							info.parseRepairFmtp(pt, fields[1])
 						}
-
-						keyVal = strings.Split(field, "/")
-						if len(keyVal) >= 2 {
-							key := keyVal[0]
-							switch key {
-							case "MPEG4-GENERIC":
-								info.Codec = "acc"
-							case "H264":
-								info.Codec = "h264"
-							case "H265":
-								info.Codec = "h265"
-							}
-							if i, err := strconv.Atoi(keyVal[1]); err == nil {
-								info.TimeScale = i
-							}
+						continue
+					}
+					if len(fields) == 2 && strings.HasPrefix(fields[0], "rtpmap:") {
+						pt := strings.TrimPrefix(fields[0], "rtpmap:")
+						if info.isPayloadType(pt) {
+							info.RtpMap, _ = strconv.Atoi(pt)
+							info.parseRtpmap(fields[1])
+						} else {
+							info.parseRepairRtpmap(pt, fields[1])
 						}
-						keyVal = strings.Split(field, ";")
-						if len(keyVal) > 1 {
-							for _, field := range fields {
-								keyVal := strings.SplitN(field, "=", 2)
-								if len(keyVal) == 2 {
-									key := strings.TrimSpace(keyVal[0])
-									val := keyVal[1]
-									switch key {
-									case "config":
-										info.Config, _ = hex.DecodeString(val)
-									case "sizelength":
-										info.SizeLength, _ = strconv.Atoi(val)
-									case "indexlength":
-										info.IndexLength, _ = strconv.Atoi(val)
-									case "sprop-parameter-sets":
-										fields := strings.Split(val, ",")
-										for _, field := range fields {
-											val, _ := base64.StdEncoding.DecodeString(field)
-											info.ParameterSets = append(info.ParameterSets, val)
-										}
-									}
-								}
-							}
+						continue
+					}
+					if len(fields) == 2 && strings.HasPrefix(fields[0], "extmap:") {
+						if info.ExtMap == nil {
+							info.ExtMap = make(RTPExtensionMap)
 						}
+						info.ExtMap.parseExtMap(fields[0], fields[1])
+						continue
+					}
+					if len(fields) == 2 && strings.HasPrefix(fields[0], "crypto:") {
+						if info.Crypto == nil {
+							info.Crypto, _ = srtp.ParseCrypto(strings.TrimPrefix(fields[0], "crypto:") + " " + fields[1])
+						}
+						continue
+					}
+					keyVal := strings.SplitN(fields[0], ":", 2)
+					if len(keyVal) == 2 && keyVal[0] == "control" {
+						info.Control = keyVal[1]
+					}
+					if len(keyVal) == 2 && keyVal[0] == nalcrypt.SDPAttribute {
+						info.NALEncryption, _ = nalcrypt.ParseParams(keyVal[1])
 					}
 				}
 			}
 		}
 	}
+	for _, info := range sdpMap {
+		info.fillAudioParams()
+	}
 	return sdpMap
 }
+
+// isPayloadType rtpmap/fmtp中的负载类型是否与m行的第一个负载类型一致
+func (info *SDPInfo) isPayloadType(pt string) bool {
+	i, err := strconv.Atoi(strings.TrimSpace(pt))
+	return err != nil || i == info.PayloadType
+}
+
+// parseRtpmap 解析 a=rtpmap 的 编码名/时钟频率[/声道数]
+func (info *SDPInfo) parseRtpmap(val string) {
+	keyVal := strings.Split(strings.TrimSpace(val), "/")
+	if len(keyVal) < 2 {
+		return
+	}
+	switch name := strings.ToUpper(keyVal[0]); name {
+	case "MPEG4-GENERIC":
+		info.Codec = "acc"
+	case "MP4A-LATM":
+		info.Codec = "mp4a-latm"
+		info.CPresent = true
+	default:
+		info.Codec = strings.ToLower(name)
+	}
+	if i, err := strconv.Atoi(keyVal[1]); err == nil {
+		info.TimeScale = i
+	}
+	if info.AVType != "audio" {
+		return
+	}
+	info.SampleRate = info.TimeScale
+	if info.Codec == "g722" {
+		// g722的rtp时钟频率为8000，实际采样率为16000(RFC 3551)
+		info.SampleRate = 16000
+	}
+	info.ChannelCount = 1
+	if len(keyVal) >= 3 {
+		if i, err := strconv.Atoi(keyVal[2]); err == nil && i > 0 {
+			info.ChannelCount = i
+		}
+	}
+}
+
+// parseRepairRtpmap m行中其余负载类型的rtpmap，记录重传和前向纠错的负载类型
+func (info *SDPInfo) parseRepairRtpmap(pt string, val string) {
+	i, err := strconv.Atoi(strings.TrimSpace(pt))
+	if err != nil {
+		return
+	}
+	switch name := strings.ToLower(strings.SplitN(strings.TrimSpace(val), "/", 2)[0]); name {
+	case "rtx":
+		if info.RTXPayloadType == 0 {
+			info.RTXPayloadType = i
+		}
+	case "ulpfec", "flexfec":
+		// flexfec-03 草案的头部格式与RFC 8627不同，不支持，其修复流忽略
+		if info.FECPayloadType == 0 {
+			info.FECPayloadType = i
+			info.FECCodec = name
+		}
+	}
+}
+
+// parseRepairFmtp 重传负载类型的fmtp，apt与媒体负载类型不一致时不使用
+func (info *SDPInfo) parseRepairFmtp(pt string, params string) {
+	i, err := strconv.Atoi(strings.TrimSpace(pt))
+	if err != nil || i != info.RTXPayloadType {
+		return
+	}
+	for _, param := range strings.Split(params, ";") {
+		keyVal := strings.SplitN(param, "=", 2)
+		if len(keyVal) != 2 {
+			continue
+		}
+		val, _ := strconv.Atoi(strings.TrimSpace(keyVal[1]))
+		switch strings.ToLower(strings.TrimSpace(keyVal[0])) {
+		case "apt":
+			if val != info.PayloadType {
+				info.RTXPayloadType = 0
+				info.RTXTime = 0
+				return
+			}
+		case "rtx-time":
+			info.RTXTime = val
+		}
+	}
+}
+
+// fillAudioParams aac的采样率和声道数以config为准
+func (info *SDPInfo) fillAudioParams() {
+	var config *aac.Config
+	switch info.Codec {
+	case "acc", "aac":
+		config, _ = aac.ParseConfig(info.Config)
+	case "mp4a-latm":
+		if muxConfig, err := aac.ParseStreamMuxConfig(info.Config); err == nil {
+			config = muxConfig.Config
+		}
+	}
+	if config == nil {
+		return
+	}
+	info.SampleRate = config.SampleRate
+	if config.ExtensionSampleRate > 0 {
+		info.SampleRate = config.ExtensionSampleRate
+	}
+	if config.ChannelCount > 0 {
+		info.ChannelCount = config.ChannelCount
+	}
+}
+
+// parseFmtp 解析 a=fmtp 的参数列表，参数之间以;分隔
+func (info *SDPInfo) parseFmtp(params string) {
+	for _, param := range strings.Split(params, ";") {
+		keyVal := strings.SplitN(param, "=", 2)
+		if len(keyVal) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(keyVal[0]))
+		val := strings.TrimSpace(keyVal[1])
+		switch key {
+		case "config":
+			info.Config, _ = hex.DecodeString(val)
+		case "sizelength":
+			info.SizeLength, _ = strconv.Atoi(val)
+		case "indexlength":
+			info.IndexLength, _ = strconv.Atoi(val)
+		case "sprop-parameter-sets":
+			for _, field := range strings.Split(val, ",") {
+				val, _ := base64.StdEncoding.DecodeString(field)
+				info.ParameterSets = append(info.ParameterSets, val)
+			}
+		case "sprop-vps", "sprop-sps", "sprop-pps":
+			for _, field := range strings.Split(val, ",") {
+				if val, err := base64.StdEncoding.DecodeString(field); err == nil && len(val) > 0 {
+					info.ParameterSets = append(info.ParameterSets, val)
+				}
+			}
+		case "sprop-max-don-diff":
+			info.MaxDonDiff, _ = strconv.Atoi(val)
+		case "indexdeltalength":
+			info.IndexDeltaLength, _ = strconv.Atoi(val)
+		case "ctsdeltalength":
+			info.CTSDeltaLength, _ = strconv.Atoi(val)
+		case "dtsdeltalength":
+			info.DTSDeltaLength, _ = strconv.Atoi(val)
+		case "randomaccessindication":
+			info.RandomAccessIndication = val == "1"
+		case "streamstateindication":
+			info.StreamStateIndication, _ = strconv.Atoi(val)
+		case "auxiliarydatasizelength":
+			info.AuxiliaryDataSizeLength, _ = strconv.Atoi(val)
+		case "constantsize":
+			info.ConstantSize, _ = strconv.Atoi(val)
+		case "constantduration":
+			info.ConstantDuration, _ = strconv.Atoi(val)
+		case "cpresent":
+			info.CPresent = val != "0"
+		case "sprop-stereo":
+			// opus的rtpmap中声道数固定为2(RFC 7587)
+			if info.Codec == "opus" && val == "0" {
+				info.ChannelCount = 1
+			}
+		}
+	}
+}
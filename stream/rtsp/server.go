@@ -6,6 +6,8 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	"github.com/mrHChen/goutils/stream/srtp"
 )
 
 // Server rtsp服务端
@@ -17,6 +19,15 @@ type Server struct {
 	pushersLock    sync.RWMutex
 	addPusherCh    chan *Pusher
 	removePusherCh chan *Pusher
+
+	// JitterBuffer 推流会话的抖动缓冲，默认不启用
+	JitterBuffer JitterBufferOptions
+	// SRTP 下发给播放端的媒体使用RTP/SAVP的保护方式，为0时仅在推流端使用RTP/SAVP时加密
+	SRTP srtp.ProtectionProfile
+	// PlayerHandles 播放端DESCRIBE时创建播放器后调用，可在此添加播放端的过滤器
+	PlayerHandles []func(*Player)
+	// PusherHandles 推流加入服务端后、开始转发前调用，可在此添加推流端的过滤器或开始录制
+	PusherHandles []func(*Pusher)
 }
 
 // NewRTSPServer 创建 rtsp 服务端实例
@@ -78,6 +89,7 @@ func (s *Server) Start() error {
 				CloseOld:      true,
 				Authorization: false,
 				Timeout:       time.Duration(10) * time.Second,
+				JitterBuffer:  s.JitterBuffer,
 			})
 		go session.Start()
 	}
@@ -88,14 +100,18 @@ func (s *Server) Start() error {
 func (s *Server) RemovePusher(pusher *Pusher) {
 	s.pushersLock.Lock()
 	removed := false
-	if _pusher, ok := s.pushers[pusher.Path()]; ok && pusher.ID == _pusher.ID {
+	if _pusher, ok := s.pushers[pusher.Path()]; ok && pusher == _pusher {
 		delete(s.pushers, pusher.Path())
 		log.Println(fmt.Sprintf("%v end, now pusher size[%d]\n", pusher, len(s.pushers)))
 		removed = true
 	}
 	s.pushersLock.Unlock()
 	if removed {
-		s.removePusherCh <- pusher
+		// 没有接收方时不阻塞
+		select {
+		case s.removePusherCh <- pusher:
+		default:
+		}
 	}
 }
 
@@ -128,13 +144,20 @@ func (s *Server) TryAttachToPusher(session *Session) (int, *Pusher) {
 func (s *Server) AddPusher(pusher *Pusher) bool {
 	s.pushersLock.Lock()
 	if _, ok := s.pushers[pusher.Path()]; ok {
+		s.pushersLock.Unlock()
 		return false
 	}
 	s.pushers[pusher.Path()] = pusher
 	log.Println(fmt.Sprintf("start, now pusher size[%d]", len(s.pushers)))
 	s.pushersLock.Unlock()
 
+	for _, h := range s.PusherHandles {
+		h(pusher)
+	}
 	go pusher.Start()
-	s.addPusherCh <- pusher
+	select {
+	case s.addPusherCh <- pusher:
+	default:
+	}
 	return true
 }
@@ -14,10 +14,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mrHChen/goutils/stream/base"
 	"github.com/mrHChen/goutils/stream/headers"
+	"github.com/mrHChen/goutils/stream/srtp"
 	"github.com/teris-io/shortid"
 )
 
@@ -58,6 +60,10 @@ func (st SessionType) String() string {
 type RTPPack struct {
 	Type   RTPType
 	Buffer *bytes.Buffer
+	// CaptureTime 由SR或ONVIF回放扩展换算的采集时间，未知时为零值
+	CaptureTime time.Time
+	// Discontinuity 拉流客户端重连后的第一个包，推流端转发给播放端时标记在各路媒体的第一个rtp包上
+	Discontinuity bool
 }
 
 type RTPType int
@@ -97,6 +103,8 @@ type Session struct {
 	VControl string
 	ACodec   string
 	AControl string
+	// controls 下发给播放端的sdp中各路媒体的control
+	controls []SDPControl
 
 	cSeq          int
 	sessionID     string
@@ -106,6 +114,8 @@ type Session struct {
 	SDPMap map[string]*SDPInfo
 
 	Stopped bool
+	// stopped 以原子操作读写，Stopped 只在 Stop 中设置，其他协程通过 isStopped 判断
+	stopped int32
 	// 新的推流器连接时，如果已有同一个推流器是否关闭
 	closeOld bool
 
@@ -117,8 +127,20 @@ type Session struct {
 	Pusher *Pusher
 	Player *Player
 
+	// 推流会话的接收统计，用于向推流端发送RR
+	rtcpReceiver *rtcpReceiver
+	rtcpOnce     sync.Once
+	// 推流会话的抖动缓冲，未启用时为nil
+	jitterBuffer *trackJitterBuffers
+	jitterOnce   sync.Once
+	// deliverLock 缓冲的输出在接收协程和定时协程中进行，保证处理函数按顺序调用
+	deliverLock sync.Mutex
+	// RTP/SAVP媒体的加解密，推流会话使用推流端sdp中的密钥，播放会话使用下发给播放端的密钥
+	srtp srtpContexts
+
 	RTPHandles  []func(*RTPPack)
 	StopHandles []func()
+	LossHandles []func(*LossEvent)
 }
 
 type SessionOptions struct {
@@ -130,6 +152,9 @@ type SessionOptions struct {
 	Authorization bool
 
 	Timeout time.Duration
+
+	// 推流会话的抖动缓冲
+	JitterBuffer JitterBufferOptions
 }
 
 func (s *Session) String() string {
@@ -146,10 +171,13 @@ func NewSession(options SessionOptions) *Session {
 		),
 		RTPHandles:  make([]func(*RTPPack), 0),
 		StopHandles: make([]func(), 0),
+		LossHandles: make([]func(*LossEvent), 0),
 		vRtpPort:    -1,
 		vRtcpPort:   -1,
 		aRtpPort:    -1,
 		aRtcpPort:   -1,
+
+		jitterBuffer: newTrackJitterBuffers(options.JitterBuffer),
 	}
 	return session
 }
@@ -161,7 +189,7 @@ func (s *Session) Start() {
 
 	timer := time.Unix(0, 0)
 
-	for !s.Stopped {
+	for !s.isStopped() {
 		if _, err := io.ReadFull(s.connRW, buf1); err != nil {
 			log.Println(fmt.Errorf("session readFull error :%s", err))
 			return
@@ -224,11 +252,14 @@ func (s *Session) Start() {
 				continue
 			}
 
-			for _, h := range s.RTPHandles {
-				h(pack)
+			if err := s.srtp.decrypt(pack); err != nil {
+				log.Println(fmt.Errorf("%v decrypt %v error:%s", s, pack.Type, err))
+				continue
 			}
+			s.trackRTCP(pack)
+			s.deliver(s.jitterBuffer.push(pack, time.Now()))
 		} else { // rtsp
-			for !s.Stopped {
+			for !s.isStopped() {
 				req := &base.Request{}
 				req = req.Read(s.connRW.Reader, buf1)
 				s.handleRequest(req)
@@ -238,22 +269,31 @@ func (s *Session) Start() {
 	}
 }
 
+// isStopped 会话是否已结束，可在任意协程中调用
+func (s *Session) isStopped() bool {
+	return atomic.LoadInt32(&s.stopped) != 0
+}
+
 func (s *Session) Stop() {
-	if s.Stopped {
+	if !atomic.CompareAndSwapInt32(&s.stopped, 0, 1) {
 		return
 	}
 
 	s.Stopped = true
+	// 缓冲中剩余的包在结束前输出
+	s.deliver(s.jitterBuffer.drain(time.Now()))
 
 	for _, h := range s.StopHandles {
 		h()
 	}
 
+	// 播放器可能正在其他协程中发送rtp
+	s.connWLock.Lock()
 	if s.options.conn != nil {
 		s.connRW.Flush()
 		s.options.conn.Close()
-		s.options.conn = nil
 	}
+	s.connWLock.Unlock()
 }
 
 func (s *Session) handleRequest(req *base.Request) {
@@ -280,6 +320,17 @@ func (s *Session) handleRequest(req *base.Request) {
 				} else {
 					s.Pusher.AddPlayer(s.Player)
 				}
+			case SESSION_TYPE_PUSHER:
+				if res.StatusCode == base.StatusOK && s.rtcpReceiver != nil {
+					s.rtcpOnce.Do(func() {
+						go s.sendReceiverReports()
+					})
+				}
+				if res.StatusCode == base.StatusOK && s.jitterBuffer != nil {
+					s.jitterOnce.Do(func() {
+						go s.releaseJitter()
+					})
+				}
 			}
 		}
 	}()
@@ -320,6 +371,14 @@ func (s *Session) handleRequest(req *base.Request) {
 
 		s.SDPRaw = string(req.Body)
 		s.SDPMap = ParseSDP(s.SDPRaw)
+		s.rtcpReceiver = newRTCPReceiver(sdpClockRates(s.SDPMap))
+		contexts, err := newSRTPContexts(sdpCryptos(s.SDPMap))
+		if err != nil {
+			log.Println(fmt.Errorf("%v %s", s, err))
+			res.StatusCode = base.StatusNotAcceptable
+			return
+		}
+		s.srtp = contexts
 		if sdp, ok := s.SDPMap["audio"]; ok {
 			s.AControl = sdp.Control
 			s.ACodec = sdp.Codec
@@ -369,11 +428,44 @@ func (s *Session) handleRequest(req *base.Request) {
 
 		s.Player = NewPlayer(s, pusher)
 		s.Pusher = pusher
-		s.AControl = pusher.AControl()
+		for _, h := range s.options.Server.PlayerHandles {
+			h(s.Player)
+		}
 		s.ACodec = pusher.ACodec()
-		s.VControl = pusher.VControl()
 		s.VCodec = pusher.VCodec()
-		res.Body = []byte(s.Pusher.SDPRaw())
+
+		// 下发改写后的sdp，control统一为相对地址，由Content-Base确定完整地址
+		host := ""
+		if s.options.conn != nil {
+			host, _, _ = net.SplitHostPort(s.options.conn.LocalAddr().String())
+		}
+		cryptos, err := s.playerCryptos(pusher)
+		if err != nil {
+			log.Println(fmt.Errorf("%v %s", s, err))
+			res.StatusCode = base.StatusInternalServerError
+			return
+		}
+		if s.srtp, err = newSRTPContexts(cryptos); err != nil {
+			log.Println(fmt.Errorf("%v %s", s, err))
+			res.StatusCode = base.StatusInternalServerError
+			return
+		}
+		attrs := make(map[string]map[string]string)
+		s.Player.Filters.sdpAttributes(attrs, pusher.SDPInfo)
+		sdpRaw, controls := pusher.PlayerSDP(SDPOptions{Address: host, Crypto: cryptos, Attributes: attrs})
+		if sdpRaw == "" {
+			res.StatusCode = base.StatusInternalServerError
+			return
+		}
+		s.controls = controls
+		s.AControl = trackControl(controls, "audio")
+		s.VControl = trackControl(controls, "video")
+
+		contentBase := *req.URL
+		contentBase.User = nil
+		res.Header["Content-Base"] = base.HeaderValue{strings.TrimRight(contentBase.String(), "/") + "/"}
+		res.Header["Content-Type"] = base.HeaderValue{"application/sdp"}
+		res.Body = []byte(sdpRaw)
 	case base.Setup:
 
 		if _, ok := req.Header["Transport"]; !ok {
@@ -382,6 +474,11 @@ func (s *Session) handleRequest(req *base.Request) {
 		}
 
 		ts := req.Header["Transport"]
+		if s.Type == SESSION_TYPE_PLAYER && s.srtp != nil && !strings.Contains(ts[0], "RTP/SAVP") {
+			// 下发的sdp中为RTP/SAVP，播放端不支持时无法解密
+			res.StatusCode = base.StatusUnsupportedTransport
+			return
+		}
 		// control字段可能是`stream=1`字样，也可能是rtsp://...字样。即control可能是url的path，也可能是整个url
 		// 例1：
 		// a=control:streamid=1
@@ -435,10 +532,13 @@ func (s *Session) handleRequest(req *base.Request) {
 			s.TransType = TransTypeTcp
 			if setupPath == aPath || aPath != "" && strings.LastIndex(setupPath, aPath) == len(setupPath)-len(aPath) {
 				s.aRtpPort, _ = strconv.Atoi(tcpMatch[1])
-				s.aRtcpPort, _ = strconv.Atoi(tcpMatch[3])
+				s.aRtcpPort = rtcpInterleavedChannel(tcpMatch[3])
 			} else if setupPath == vPath || vPath != "" && strings.LastIndex(setupPath, vPath) == len(setupPath)-len(vPath) {
 				s.vRtpPort, _ = strconv.Atoi(tcpMatch[1])
-				s.vRtcpPort, _ = strconv.Atoi(tcpMatch[3])
+				s.vRtcpPort = rtcpInterleavedChannel(tcpMatch[3])
+			} else if s.hasControl(setupPath) {
+				// 同类型的其他媒体，服务端只转发每种类型的一路，允许SETUP但不发送数据
+				log.Println(fmt.Sprintf("%v SETUP [TCP] %s is not forwarded", s, setupPath))
 			} else {
 				res.StatusCode = base.StatusInternalServerError
 				res.StatusMessage = fmt.Sprintf("SETUP [TCP] got UnKown control:%s", setupPath)
@@ -475,7 +575,7 @@ func (s *Session) CheckAuth(req *base.Request, res *base.Response) error {
 	if err != nil {
 		return err
 	}
-	if err = sender.CheckAuth(req.URL); err != nil {
+	if err = sender.CheckAuth(req.Method, req.URL); err != nil {
 		log.Println(fmt.Errorf("%v", err))
 		res.StatusCode = base.StatusUnauthorized
 		nonce := fmt.Sprintf("%x", md5.Sum([]byte(shortid.MustGenerate())))
@@ -486,6 +586,16 @@ func (s *Session) CheckAuth(req *base.Request, res *base.Response) error {
 	return nil
 }
 
+// hasControl setupPath 是否为下发给播放端的sdp中的某一路媒体
+func (s *Session) hasControl(setupPath string) bool {
+	for _, c := range s.controls {
+		if c.Control != "" && (setupPath == c.Control || strings.HasSuffix(setupPath, "/"+c.Control)) {
+			return true
+		}
+	}
+	return false
+}
+
 // SendRTP 发送rtp包
 func (s *Session) SendRTP(pack *RTPPack) error {
 	if pack == nil {
@@ -505,16 +615,144 @@ func (s *Session) SendRTP(pack *RTPPack) error {
 		return fmt.Errorf("session tcp send rtp got unkown pack type[%v]", pack.Type)
 	}
 
+	payload, err := s.srtp.encrypt(pack)
+	if err != nil {
+		return fmt.Errorf("session encrypt %v error:%s", pack.Type, err)
+	}
+
 	bufChannel := make([]byte, 2)
 	bufChannel[0] = 0x24
 	bufChannel[1] = byte(port)
 	s.connWLock.Lock()
 	s.connRW.Write(bufChannel)
 	bufLen := make([]byte, 2)
-	binary.BigEndian.PutUint16(bufLen, uint16(pack.Buffer.Len()))
+	binary.BigEndian.PutUint16(bufLen, uint16(len(payload)))
 	s.connRW.Write(bufLen)
-	s.connRW.Write(pack.Buffer.Bytes())
+	s.connRW.Write(payload)
 	s.connRW.Flush()
 	s.connWLock.Unlock()
 	return nil
 }
+
+// playerCryptos 为播放端的各路媒体生成SRTP密钥
+// 服务端未指定保护方式时，推流端使用RTP/SAVP的媒体沿用推流端的保护方式，推流端的密钥不下发给播放端
+func (s *Session) playerCryptos(pusher *Pusher) (map[string]*srtp.Crypto, error) {
+	cryptos := make(map[string]*srtp.Crypto)
+	for avType, info := range ParseSDP(pusher.SDPRaw()) {
+		profile := s.options.Server.SRTP
+		if profile == 0 && info.Crypto != nil {
+			profile = info.Crypto.Profile
+		}
+		if profile == 0 {
+			continue
+		}
+		crypto, err := srtp.NewCrypto(1, profile)
+		if err != nil {
+			return nil, err
+		}
+		cryptos[avType] = crypto
+	}
+	return cryptos, nil
+}
+
+// rtcpInterleavedChannel interleaved中的rtcp通道，没有时为-1
+func rtcpInterleavedChannel(val string) int {
+	channel, err := strconv.Atoi(val)
+	if err != nil {
+		return -1
+	}
+	return channel
+}
+
+// hasRTCPChannel SETUP中是否协商了媒体对应的rtcp通道
+func (s *Session) hasRTCPChannel(t RTPType) bool {
+	switch t {
+	case RTP_TYPE_AUDIOCONTROL:
+		return s.aRtcpPort >= 0
+	case RTP_TYPE_VIDEOCONTROL:
+		return s.vRtcpPort >= 0
+	}
+	return false
+}
+
+// trackRTCP 推流会话统计收到的rtp包和SR，播放会话解析播放端的RR
+func (s *Session) trackRTCP(pack *RTPPack) {
+	var err error
+	switch s.Type {
+	case SESSION_TYPE_PUSHER:
+		if s.rtcpReceiver != nil {
+			err = s.rtcpReceiver.onPacket(pack, time.Now())
+		}
+	case SESSION_TYPE_PLAYER:
+		if s.Player != nil && isRTCP(pack.Type) {
+			err = s.Player.rtcpSender.onRTCP(pack, time.Now())
+			s.Player.handleNACK(pack)
+		}
+	}
+	if err != nil {
+		log.Println(fmt.Errorf("%v parse %v error:%s", s, pack.Type, err))
+	}
+}
+
+// sendReceiverReports 定时向推流端发送RR
+func (s *Session) sendReceiverReports() {
+	ticker := time.NewTicker(rtcpReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.isStopped() {
+			return
+		}
+		for _, pack := range s.rtcpReceiver.reports(time.Now()) {
+			if !s.hasRTCPChannel(pack.Type) {
+				continue
+			}
+			if err := s.SendRTP(pack); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// deliver 将抖动缓冲输出的包和丢包事件交给处理函数
+func (s *Session) deliver(packs []*RTPPack, losses []*LossEvent) {
+	if len(packs) == 0 && len(losses) == 0 {
+		return
+	}
+	s.deliverLock.Lock()
+	defer s.deliverLock.Unlock()
+	for _, loss := range losses {
+		for _, h := range s.LossHandles {
+			h(loss)
+		}
+	}
+	for _, pack := range packs {
+		for _, h := range s.RTPHandles {
+			h(pack)
+		}
+	}
+}
+
+// releaseJitter 定时输出抖动缓冲中等待超时的包，推流暂停时缓冲中的包也按延迟目标输出
+func (s *Session) releaseJitter() {
+	ticker := time.NewTicker(s.jitterBuffer.releaseInterval())
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.isStopped() {
+			return
+		}
+		s.deliver(s.jitterBuffer.release(time.Now()))
+	}
+}
+
+// JitterStats 推流会话中指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的抖动缓冲统计，未启用时返回nil
+func (s *Session) JitterStats(t RTPType) *JitterBufferStats {
+	return s.jitterBuffer.stats(t)
+}
+
+// ReceptionStats 推流会话中指定媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的接收统计，没有时返回nil
+func (s *Session) ReceptionStats(t RTPType) *ReceptionStats {
+	if s.rtcpReceiver == nil {
+		return nil
+	}
+	return s.rtcpReceiver.stats(t)
+}
@@ -0,0 +1,81 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/srtp"
+)
+
+// srtpContexts 各路媒体的SRTP加解密上下文，key为RTP_TYPE_AUDIO/RTP_TYPE_VIDEO，没有加密时为nil
+// sdes中的密钥由发送sdp的一方用于加密，rtsp中没有应答sdp，反向的rtcp使用同一密钥，以ssrc区分密钥流
+type srtpContexts map[RTPType]*srtp.Context
+
+// newSRTPContexts 由sdp中的a=crypto创建，key为媒体类型(audio/video)
+func newSRTPContexts(cryptos map[string]*srtp.Crypto) (srtpContexts, error) {
+	var contexts srtpContexts
+	for avType, crypto := range cryptos {
+		if crypto == nil {
+			continue
+		}
+		ctx, err := crypto.Context()
+		if err != nil {
+			return nil, fmt.Errorf("%s srtp error:%s", avType, err)
+		}
+		if contexts == nil {
+			contexts = make(srtpContexts)
+		}
+		switch avType {
+		case "audio":
+			contexts[RTP_TYPE_AUDIO] = ctx
+		case "video":
+			contexts[RTP_TYPE_VIDEO] = ctx
+		}
+	}
+	return contexts, nil
+}
+
+// sdpCryptos sdp中各媒体的a=crypto
+func sdpCryptos(sdpMap map[string]*SDPInfo) map[string]*srtp.Crypto {
+	cryptos := make(map[string]*srtp.Crypto)
+	for avType, info := range sdpMap {
+		if info.Crypto != nil {
+			cryptos[avType] = info.Crypto
+		}
+	}
+	return cryptos
+}
+
+// decrypt 解密收到的SRTP/SRTCP包，替换包的内容，该媒体没有加密时不处理
+func (s srtpContexts) decrypt(pack *RTPPack) error {
+	ctx := s[mediaType(pack.Type)]
+	if ctx == nil {
+		return nil
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if isRTCP(pack.Type) {
+		b, err = ctx.DecryptRTCP(pack.Buffer.Bytes())
+	} else {
+		b, err = ctx.DecryptRTP(pack.Buffer.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	pack.Buffer = bytes.NewBuffer(b)
+	return nil
+}
+
+// encrypt 返回待发送的内容，包可能被多个播放端共享，不修改包本身
+func (s srtpContexts) encrypt(pack *RTPPack) ([]byte, error) {
+	ctx := s[mediaType(pack.Type)]
+	if ctx == nil {
+		return pack.Buffer.Bytes(), nil
+	}
+	if isRTCP(pack.Type) {
+		return ctx.EncryptRTCP(pack.Buffer.Bytes())
+	}
+	return ctx.EncryptRTP(pack.Buffer.Bytes())
+}
@@ -0,0 +1,66 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/srtp"
+)
+
+func TestSRTPContexts(t *testing.T) {
+	sdp := testAudioSDP("m=video 0 RTP/SAVP 96",
+		"a=rtpmap:96 H264/90000",
+		"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20",
+		"a=crypto:2 AEAD_AES_128_GCM inline:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGw==",
+		"a=control:trackID=0",
+		"m=audio 0 RTP/AVP 0",
+		"a=control:trackID=1",
+	)
+	sdpMap := ParseSDP(sdp)
+	cryptos := sdpCryptos(sdpMap)
+	if len(cryptos) != 1 || cryptos["video"] == nil || cryptos["video"].Profile != srtp.ProfileAESCM128HMACSHA180 {
+		t.Fatalf("cryptos %v", cryptos)
+	}
+	sender, err := newSRTPContexts(cryptos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, _ := newSRTPContexts(cryptos)
+
+	tests := []struct {
+		name      string
+		pack      *RTPPack
+		encrypted bool
+	}{
+		{"video rtp", testRTPPack(t, RTP_TYPE_VIDEO, 1, 100, 0), true},
+		{"video rtcp", testSRPack(t, RTP_TYPE_VIDEOCONTROL, 1, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), 0), true},
+		{"audio rtp", testRTPPack(t, RTP_TYPE_AUDIO, 2, 100, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := append([]byte(nil), tt.pack.Buffer.Bytes()...)
+			out, err := sender.encrypt(tt.pack)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tt.pack.Buffer.Bytes(), plain) {
+				t.Errorf("shared pack modified")
+			}
+			if bytes.Equal(out, plain) == tt.encrypted {
+				t.Errorf("encrypted %v", !tt.encrypted)
+			}
+			received := &RTPPack{Type: tt.pack.Type, Buffer: bytes.NewBuffer(out)}
+			if err := receiver.decrypt(received); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(received.Buffer.Bytes(), plain) {
+				t.Errorf("decrypted %x, want %x", received.Buffer.Bytes(), plain)
+			}
+		})
+	}
+
+	if contexts, err := newSRTPContexts(sdpCryptos(ParseSDP(testAudioSDP("m=audio 0 RTP/AVP 0")))); err != nil || contexts != nil {
+		t.Errorf("contexts without crypto %v %v", contexts, err)
+	}
+}
@@ -0,0 +1,208 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mrHChen/goutils/stream/codec/h264"
+	"github.com/mrHChen/goutils/stream/codec/h265"
+)
+
+// VideoParams 从SPS/VPS中解析出的视频参数
+type VideoParams struct {
+	Codec  string
+	Width  int
+	Height int
+	// Profile Level 名称，例如 High、4.1
+	Profile string
+	Level   string
+	// Tier h265的High tier
+	HighTier bool
+	// ChromaFormat 色度采样格式，例如 4:2:0
+	ChromaFormat string
+	BitDepth     int
+	// FrameRate 标称帧率，码流中没有timing信息时为0
+	FrameRate float64
+	// CodecString RFC 6381 编码字符串，例如 avc1.64001F
+	CodecString string
+}
+
+func (v *VideoParams) String() string {
+	return fmt.Sprintf("%s %dx%d %s@%s %s %dbit %.3gfps",
+		v.Codec, v.Width, v.Height, v.Profile, v.Level, v.ChromaFormat, v.BitDepth, v.FrameRate)
+}
+
+// chromaFormats chroma_format_idc对应的名称
+var chromaFormats = []string{"4:0:0", "4:2:0", "4:2:2", "4:4:4"}
+
+func chromaFormatName(idc int) string {
+	if idc >= 0 && idc < len(chromaFormats) {
+		return chromaFormats[idc]
+	}
+	return ""
+}
+
+// ParseVideoParams 根据编码和参数集解析视频参数，h264需要SPS，h265需要SPS，VPS可选
+func ParseVideoParams(codec string, parameterSets [][]byte) (*VideoParams, error) {
+	switch strings.ToLower(codec) {
+	case "h264":
+		for _, ps := range parameterSets {
+			if h264.Type(ps) != h264.NALUTypeSPS {
+				continue
+			}
+			sps, err := h264.ParseSPS(ps)
+			if err != nil {
+				return nil, err
+			}
+			return &VideoParams{
+				Codec:        "h264",
+				Width:        sps.Width,
+				Height:       sps.Height,
+				Profile:      sps.ProfileName(),
+				Level:        sps.LevelName(),
+				ChromaFormat: chromaFormatName(sps.ChromaFormatIdc),
+				BitDepth:     sps.BitDepthLuma,
+				FrameRate:    sps.FrameRate(),
+				CodecString:  sps.Codec(),
+			}, nil
+		}
+		return nil, fmt.Errorf("h264 sps not found")
+	case "h265":
+		var vps *h265.VPS
+		var sps *h265.SPS
+		for _, ps := range parameterSets {
+			var err error
+			switch h265.Type(ps) {
+			case h265.NALUTypeVPS:
+				// VPS只用于补充帧率，解析失败不影响结果
+				vps, _ = h265.ParseVPS(ps)
+			case h265.NALUTypeSPS:
+				if sps, err = h265.ParseSPS(ps); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if sps == nil {
+			return nil, fmt.Errorf("h265 sps not found")
+		}
+		params := &VideoParams{
+			Codec:        "h265",
+			Width:        sps.Width,
+			Height:       sps.Height,
+			Profile:      sps.ProfileTierLevel.ProfileName(),
+			Level:        sps.ProfileTierLevel.LevelName(),
+			HighTier:     sps.ProfileTierLevel.Tier,
+			ChromaFormat: chromaFormatName(sps.ChromaFormatIdc),
+			BitDepth:     sps.BitDepthLuma,
+			FrameRate:    sps.FrameRate(),
+			CodecString:  sps.ProfileTierLevel.Codec(),
+		}
+		if params.FrameRate == 0 && vps != nil {
+			params.FrameRate = vps.FrameRate()
+		}
+		return params, nil
+	}
+	return nil, fmt.Errorf("unsupported codec[%s] for video params", codec)
+}
+
+// parameterSetTracker 记录带内的视频参数集，SPS/VPS变化时重新解析视频参数
+type parameterSetTracker struct {
+	lock   sync.RWMutex
+	vps    []byte
+	sps    []byte
+	pps    []byte
+	params *VideoParams
+}
+
+// update 从rtp包中获取VPS/SPS/PPS，返回SPS或VPS是否发生变化
+func (t *parameterSetTracker) update(codec string, donl bool, rtp *RTPInfo) bool {
+	var vps, sps, pps []byte
+	switch strings.ToLower(codec) {
+	case "h264":
+		for _, nalu := range h264AggregatedNALUs(rtp.Payload) {
+			switch h264.Type(nalu) {
+			case h264.NALUTypeSPS:
+				sps = nalu
+			case h264.NALUTypePPS:
+				pps = nalu
+			}
+		}
+	case "h265":
+		for _, nalu := range h265AggregatedNALUs(rtp.Payload, donl) {
+			switch h265.Type(nalu) {
+			case h265.NALUTypeVPS:
+				vps = nalu
+			case h265.NALUTypeSPS:
+				sps = nalu
+			case h265.NALUTypePPS:
+				pps = nalu
+			}
+		}
+	default:
+		return false
+	}
+	if vps == nil && sps == nil && pps == nil {
+		return false
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	changed := false
+	if vps != nil && !bytes.Equal(vps, t.vps) {
+		changed = changed || t.vps != nil
+		t.vps = append([]byte(nil), vps...)
+		t.params = nil
+	}
+	if sps != nil && !bytes.Equal(sps, t.sps) {
+		changed = changed || t.sps != nil
+		t.sps = append([]byte(nil), sps...)
+		t.params = nil
+	}
+	if pps != nil {
+		t.pps = append(t.pps[:0], pps...)
+	}
+	return changed
+}
+
+// parameterSets h264为[SPS,PPS]，h265为[VPS,SPS,PPS]，尚未收到时返回nil
+func (t *parameterSetTracker) parameterSets(codec string) [][]byte {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.sps == nil || t.pps == nil {
+		return nil
+	}
+	if strings.EqualFold(codec, "h265") {
+		if t.vps == nil {
+			return nil
+		}
+		return [][]byte{t.vps, t.sps, t.pps}
+	}
+	return [][]byte{t.sps, t.pps}
+}
+
+// videoParams 优先使用带内的参数集，没有时使用sdp中的参数集
+func (t *parameterSetTracker) videoParams(codec string, sdpSets [][]byte) *VideoParams {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.params != nil {
+		return t.params
+	}
+	sets := sdpSets
+	if t.sps != nil {
+		sets = [][]byte{t.sps}
+		if t.vps != nil {
+			sets = append(sets, t.vps)
+		}
+	}
+	params, err := ParseVideoParams(codec, sets)
+	if err != nil {
+		return nil
+	}
+	if t.sps != nil {
+		// sdp中的参数集可能在之后被带内的覆盖，只缓存带内的结果
+		t.params = params
+	}
+	return params
+}
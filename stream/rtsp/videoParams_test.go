@@ -0,0 +1,107 @@
+package rtsp
+
+import (
+	"testing"
+)
+
+func TestParseVideoParams(t *testing.T) {
+	h264SPS := mustHex("6764001facd9405005bb011000000300100000030320f1831960")
+	h265VPS := mustHex("40010c01ffff016000000300900000030000030078999809")
+	h265SPS := mustHex("420101016000000300900000030000030078a003c08010e5966669" +
+		"24cae010000003001000000301e080")
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb}
+
+	tests := []struct {
+		name  string
+		codec string
+		sets  [][]byte
+		want  VideoParams
+	}{
+		{
+			name:  "h264",
+			codec: "H264",
+			sets:  [][]byte{h264SPS, pps},
+			want: VideoParams{Codec: "h264", Width: 1280, Height: 720, Profile: "High", Level: "3.1",
+				ChromaFormat: "4:2:0", BitDepth: 8, FrameRate: 25, CodecString: "avc1.64001F"},
+		},
+		{
+			name:  "h265",
+			codec: "h265",
+			sets:  [][]byte{h265VPS, h265SPS},
+			want: VideoParams{Codec: "h265", Width: 1920, Height: 1080, Profile: "Main", Level: "4",
+				ChromaFormat: "4:2:0", BitDepth: 8, FrameRate: 30, CodecString: "hvc1.1.6.L120.90"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseVideoParams(tt.codec, tt.sets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *params != tt.want {
+				t.Errorf("got %+v, want %+v", *params, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVideoParamsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec string
+		sets  [][]byte
+	}{
+		{"h264 without sps", "h264", [][]byte{{0x68, 0xeb}}},
+		{"h265 without sps", "h265", [][]byte{mustHex("40010c01ffff016000000300900000030000030078999809")}},
+		{"h264 bad sps", "h264", [][]byte{{0x67, 0x64}}},
+		{"unsupported codec", "vp8", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseVideoParams(tt.codec, tt.sets); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestParameterSetTracker(t *testing.T) {
+	sps1 := mustHex("6764001facd9405005bb011000000300100000030320f1831960")
+	sps2 := mustHex("6742c01fd900780227e5c044000003000400000300f03c60c920")
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb}
+	stapA := func(nalus ...[]byte) []byte {
+		b := []byte{24}
+		for _, n := range nalus {
+			b = append(b, byte(len(n)>>8), byte(len(n)))
+			b = append(b, n...)
+		}
+		return b
+	}
+
+	var tr parameterSetTracker
+	if tr.update("h264", false, testRTP(1, 0, false, []byte{0x41, 0x9a})) {
+		t.Errorf("slice reported as change")
+	}
+	if tr.parameterSets("h264") != nil {
+		t.Errorf("parameter sets before sps/pps")
+	}
+	// 第一次收到参数集不算变化
+	if tr.update("h264", false, testRTP(2, 0, false, stapA(sps1, pps))) {
+		t.Errorf("first sps reported as change")
+	}
+	if sets := tr.parameterSets("h264"); !equalNALUs(sets, [][]byte{sps1, pps}) {
+		t.Errorf("got sets %x", sets)
+	}
+	if p := tr.videoParams("h264", [][]byte{sps2}); p == nil || p.Width != 1280 {
+		t.Errorf("in-band sps not preferred: %+v", p)
+	}
+	if tr.update("h264", false, testRTP(3, 0, false, sps1)) {
+		t.Errorf("same sps reported as change")
+	}
+	if !tr.update("h264", false, testRTP(4, 0, false, sps2)) {
+		t.Errorf("new sps not reported as change")
+	}
+	if p := tr.videoParams("h264", nil); p == nil || p.Width != 1920 {
+		t.Errorf("params not refreshed: %+v", p)
+	}
+}
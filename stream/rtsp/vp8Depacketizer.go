@@ -0,0 +1,147 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/vp8"
+)
+
+// parseVP8Descriptor 解析VP8 payload descriptor(RFC 7741 4.2)
+// start 表示该包是一帧的第一个包(S=1且PID=0)，offset 为VP8数据的起始位置
+func parseVP8Descriptor(payload []byte) (start bool, offset int, err error) {
+	if len(payload) < 1 {
+		return false, 0, fmt.Errorf("vp8 payload descriptor truncated")
+	}
+	// X|R|N|S|R|PID(3)
+	start = payload[0]&0x10 != 0 && payload[0]&0x07 == 0
+	offset = 1
+	if payload[0]&0x80 != 0 {
+		// I|L|T|K|RSV
+		if len(payload) < 2 {
+			return false, 0, fmt.Errorf("vp8 extension field truncated")
+		}
+		ext := payload[1]
+		offset = 2
+		if ext&0x80 != 0 {
+			// PictureID，M位为1时为15位
+			if len(payload) < offset+1 {
+				return false, 0, fmt.Errorf("vp8 picture id truncated")
+			}
+			if payload[offset]&0x80 != 0 {
+				offset += 2
+			} else {
+				offset++
+			}
+		}
+		if ext&0x40 != 0 {
+			// TL0PICIDX
+			offset++
+		}
+		if ext&0x30 != 0 {
+			// TID|Y|KEYIDX
+			offset++
+		}
+	}
+	if len(payload) <= offset {
+		return false, 0, fmt.Errorf("vp8 payload is empty")
+	}
+	return start, offset, nil
+}
+
+// VP8Depacketizer vp8 rtp解包器(RFC 7741)，以marker位作为帧结束
+// 检测到丢包后丢弃数据直到下一个关键帧
+type VP8Depacketizer struct {
+	clockRate int
+
+	seq          sequenceTracker
+	waitKeyframe bool
+
+	timestamp  uint32
+	frame      []byte
+	assembling bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewVP8Depacketizer 创建vp8解包器，info 可为nil
+func NewVP8Depacketizer(info *SDPInfo) *VP8Depacketizer {
+	d := &VP8Depacketizer{
+		clockRate:    90000,
+		waitKeyframe: true,
+	}
+	if info != nil && info.TimeScale > 0 {
+		d.clockRate = info.TimeScale
+	}
+	return d
+}
+
+// Decode 输入一个rtp包，返回此时已完整的帧
+func (d *VP8Depacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil {
+		return nil, fmt.Errorf("vp8 rtp is nil")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+		d.waitKeyframe = true
+	}
+
+	start, offset, err := parseVP8Descriptor(rtp.Payload)
+	if err != nil {
+		d.discard()
+		return nil, err
+	}
+	ts := uint32(rtp.Timestamp)
+	if d.assembling && (start || ts != d.timestamp) {
+		// 上一帧缺少marker，无法确认完整，丢弃
+		d.discard()
+	}
+
+	if start {
+		d.frame = append(d.frame[:0], rtp.Payload[offset:]...)
+		d.timestamp = ts
+		d.assembling = true
+	} else {
+		if !d.assembling {
+			// 缺少起始包，丢弃
+			return nil, nil
+		}
+		if len(d.frame)+len(rtp.Payload)-offset > maxAccessUnitSize {
+			d.discard()
+			return nil, fmt.Errorf("vp8 frame exceeds %d bytes", maxAccessUnitSize)
+		}
+		d.frame = append(d.frame, rtp.Payload[offset:]...)
+	}
+	if !rtp.Marker {
+		return nil, nil
+	}
+
+	frame := d.frame
+	d.discard()
+	keyframe := vp8.IsKeyframe(frame)
+	if d.waitKeyframe {
+		if !keyframe {
+			return nil, nil
+		}
+		d.waitKeyframe = false
+	}
+	return []*AccessUnit{{
+		Timestamp: ts,
+		PTS:       timestampToDuration(d.ts.extend(ts), d.clockRate),
+		Keyframe:  keyframe,
+		Data:      frame,
+	}}, nil
+}
+
+// discard 丢弃当前未完成的帧
+func (d *VP8Depacketizer) discard() {
+	d.frame = nil
+	d.assembling = false
+}
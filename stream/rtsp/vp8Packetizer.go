@@ -0,0 +1,55 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+)
+
+// VP8Packetizer vp8 rtp打包器(RFC 7741)，payload descriptor携带15位PictureID
+type VP8Packetizer struct {
+	*rtpPacker
+	pictureID uint16
+}
+
+// NewVP8Packetizer 创建vp8打包器
+func NewVP8Packetizer(options PacketizerOptions) *VP8Packetizer {
+	return &VP8Packetizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_VIDEO, 96, 90000, options),
+		pictureID: uint16(randUint32()) & 0x7FFF,
+	}
+}
+
+// Packetize 封装一帧
+func (p *VP8Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一帧，超过MTU时拆分为多个rtp包
+func (p *VP8Packetizer) PacketizeFrame(frame []byte, pts time.Duration) ([]*RTPPack, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("vp8 frame is empty")
+	}
+	ts := p.rtpTimestamp(pts)
+	// X=1 | I=1 | M=1 PictureID(15)
+	descriptor := []byte{0x80, 0x80, 0x80 | byte(p.pictureID>>8), byte(p.pictureID)}
+	chunk := p.maxPayloadSize() - len(descriptor)
+	p.pictureID = (p.pictureID + 1) & 0x7FFF
+
+	var packs []*RTPPack
+	for start := true; len(frame) > 0; start = false {
+		n := chunk
+		if n > len(frame) {
+			n = len(frame)
+		}
+		payload := make([]byte, 0, len(descriptor)+n)
+		payload = append(payload, descriptor...)
+		if start {
+			// S=1 PID=0
+			payload[0] |= 0x10
+		}
+		payload = append(payload, frame[:n]...)
+		frame = frame[n:]
+		packs = append(packs, p.pack(payload, ts, len(frame) == 0))
+	}
+	return packs, nil
+}
@@ -0,0 +1,86 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// testVideoRoundTrip 依次封装 frames 再解包，返回每帧的rtp包和解包结果
+func testVideoRoundTrip(t *testing.T, p Packetizer, d Depacketizer, frames [][]byte) ([][]*RTPInfo, []*AccessUnit) {
+	t.Helper()
+	var packets [][]*RTPInfo
+	var aus []*AccessUnit
+	for i, frame := range frames {
+		packs, err := p.Packetize(&AccessUnit{PTS: time.Duration(i) * 40 * time.Millisecond, Data: frame})
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos := parsePacks(t, packs)
+		for j, info := range infos {
+			if info.Marker != (j == len(infos)-1) {
+				t.Errorf("frame %d packet %d: marker %v", i, j, info.Marker)
+			}
+			if len(packs[j].Buffer.Bytes()) > 200 {
+				t.Errorf("frame %d packet %d: %d bytes exceeds mtu", i, j, len(packs[j].Buffer.Bytes()))
+			}
+		}
+		packets = append(packets, infos)
+		aus = append(aus, decodeAll(t, d, infos)...)
+	}
+	return packets, aus
+}
+
+func TestVP8PacketizerRoundTrip(t *testing.T) {
+	keyframe := append([]byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00}, bytes.Repeat([]byte{0xAA}, 500)...)
+	interframe := append([]byte{0x31, 0x02, 0x00}, bytes.Repeat([]byte{0xBB}, 100)...)
+	frames := [][]byte{interframe, keyframe, interframe}
+
+	packets, aus := testVideoRoundTrip(t, NewVP8Packetizer(PacketizerOptions{MTU: 200}), NewVP8Depacketizer(nil), frames)
+	// 第一个关键帧之前的帧丢弃
+	if len(aus) != 2 || !bytes.Equal(aus[0].Data, keyframe) || !aus[0].Keyframe ||
+		!bytes.Equal(aus[1].Data, interframe) || aus[1].Keyframe || aus[1].PTS != 40*time.Millisecond {
+		t.Fatalf("round trip mismatch, %d frames", len(aus))
+	}
+	if len(packets[1]) != 3 {
+		t.Errorf("keyframe split into %d packets", len(packets[1]))
+	}
+	for i, infos := range packets {
+		if got := rtpKeyframe("vp8", false, infos[0].Payload); got != (i == 1) {
+			t.Errorf("frame %d: rtpKeyframe = %v", i, got)
+		}
+		if rtpKeyframe("vp8", false, infos[len(infos)-1].Payload) && len(infos) > 1 {
+			t.Errorf("frame %d: continuation packet detected as keyframe", i)
+		}
+	}
+
+	// 丢包后等待关键帧
+	d := NewVP8Depacketizer(nil)
+	all := append(append(append([]*RTPInfo(nil), packets[1][0]), packets[1][2]), packets[2]...)
+	if aus := decodeAll(t, d, all); len(aus) != 0 || d.Lost != 1 {
+		t.Errorf("got %d frames after loss, lost %d", len(aus), d.Lost)
+	}
+}
+
+func TestVP8Descriptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		start   bool
+		offset  int
+		err     bool
+	}{
+		{"minimal", []byte{0x10, 0xAA}, true, 1, false},
+		{"7 bit picture id", []byte{0x90, 0x80, 0x05, 0xAA}, true, 3, false},
+		{"all extensions", []byte{0x90, 0xf0, 0x81, 0x02, 0x03, 0x04, 0xAA}, true, 6, false},
+		{"not partition 0", []byte{0x11, 0xAA}, false, 1, false},
+		{"extension truncated", []byte{0x80}, false, 0, true},
+		{"empty payload", []byte{0x90, 0x80, 0x05}, false, 0, true},
+	}
+	for _, tt := range tests {
+		start, offset, err := parseVP8Descriptor(tt.payload)
+		if (err != nil) != tt.err || !tt.err && (start != tt.start || offset != tt.offset) {
+			t.Errorf("%s: got start=%v offset=%d err=%v", tt.name, start, offset, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package rtsp
+
+import (
+	"fmt"
+
+	"github.com/mrHChen/goutils/stream/codec/vp9"
+)
+
+// vp9Descriptor VP9 payload descriptor(RFC 9628 4.2)中的部分字段
+type vp9Descriptor struct {
+	// 帧间预测
+	interPredicted bool
+	// 一帧的开始和结束
+	start bool
+	end   bool
+	// VP9数据的起始位置
+	offset int
+}
+
+// parseVP9Descriptor 解析VP9 payload descriptor
+func parseVP9Descriptor(payload []byte) (*vp9Descriptor, error) {
+	if len(payload) < 1 {
+		return nil, fmt.Errorf("vp9 payload descriptor truncated")
+	}
+	// I|P|L|F|B|E|V|Z
+	b := payload[0]
+	desc := &vp9Descriptor{
+		interPredicted: b&0x40 != 0,
+		start:          b&0x08 != 0,
+		end:            b&0x04 != 0,
+	}
+	flexible := b&0x10 != 0
+	off := 1
+	next := func() (byte, error) {
+		if off >= len(payload) {
+			return 0, fmt.Errorf("vp9 payload descriptor truncated")
+		}
+		off++
+		return payload[off-1], nil
+	}
+
+	if b&0x80 != 0 {
+		// PictureID，M位为1时为15位
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if v&0x80 != 0 {
+			if _, err = next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if b&0x20 != 0 {
+		// TID|U|SID|D，非flexible模式下还有TL0PICIDX
+		if _, err := next(); err != nil {
+			return nil, err
+		}
+		if !flexible {
+			if _, err := next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if flexible && desc.interPredicted {
+		// P_DIFF(7)|N(1)，最多3个
+		for i := 0; i < 3; i++ {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if v&0x01 == 0 {
+				break
+			}
+		}
+	}
+	if b&0x02 != 0 {
+		// scalability structure: N_S(3)|Y|G|RSV(3)
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if v&0x10 != 0 {
+			// 每个空间层的宽高
+			off += 4 * (int(v>>5) + 1)
+		}
+		if v&0x08 != 0 {
+			count, err := next()
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < int(count); i++ {
+				// TID(3)|U|R(2)|RSV(2) P_DIFF * R
+				g, err := next()
+				if err != nil {
+					return nil, err
+				}
+				off += int(g >> 2 & 0x03)
+			}
+		}
+	}
+	if off >= len(payload) {
+		return nil, fmt.Errorf("vp9 payload is empty")
+	}
+	desc.offset = off
+	return desc, nil
+}
+
+// VP9Depacketizer vp9 rtp解包器(RFC 9628)
+// 以B/E位重组每一帧，marker位作为一幅图像的结束，多个空间层合并为超帧
+// 检测到丢包后丢弃数据直到下一个关键帧
+type VP9Depacketizer struct {
+	clockRate int
+
+	seq          sequenceTracker
+	waitKeyframe bool
+
+	timestamp  uint32
+	frames     [][]byte
+	frame      []byte
+	assembling bool
+
+	ts timestampExtender
+
+	// Lost 检测到的丢包数
+	Lost int
+}
+
+// NewVP9Depacketizer 创建vp9解包器，info 可为nil
+func NewVP9Depacketizer(info *SDPInfo) *VP9Depacketizer {
+	d := &VP9Depacketizer{
+		clockRate:    90000,
+		waitKeyframe: true,
+	}
+	if info != nil && info.TimeScale > 0 {
+		d.clockRate = info.TimeScale
+	}
+	return d
+}
+
+// Decode 输入一个rtp包，返回此时已完整的图像
+func (d *VP9Depacketizer) Decode(rtp *RTPInfo) ([]*AccessUnit, error) {
+	if rtp == nil {
+		return nil, fmt.Errorf("vp9 rtp is nil")
+	}
+	lost, ok := d.seq.check(uint16(rtp.SequenceNumber))
+	if !ok {
+		return nil, nil
+	}
+	if lost > 0 {
+		d.Lost += lost
+		d.discard()
+		d.waitKeyframe = true
+	}
+
+	desc, err := parseVP9Descriptor(rtp.Payload)
+	if err != nil {
+		d.discard()
+		return nil, err
+	}
+	ts := uint32(rtp.Timestamp)
+	if (d.assembling || len(d.frames) > 0) && ts != d.timestamp {
+		// 上一幅图像缺少marker，无法确认完整，丢弃
+		d.discard()
+	}
+	d.timestamp = ts
+
+	data := rtp.Payload[desc.offset:]
+	if desc.start {
+		d.frame = append(d.frame[:0], data...)
+		d.assembling = true
+	} else {
+		if !d.assembling {
+			return nil, nil
+		}
+		if len(d.frame)+len(data) > maxAccessUnitSize {
+			d.discard()
+			return nil, fmt.Errorf("vp9 frame exceeds %d bytes", maxAccessUnitSize)
+		}
+		d.frame = append(d.frame, data...)
+	}
+	if desc.end && d.assembling {
+		if len(d.frames) == 8 {
+			d.discard()
+			return nil, fmt.Errorf("vp9 picture contains more than 8 frames")
+		}
+		d.frames = append(d.frames, d.frame)
+		d.frame = nil
+		d.assembling = false
+	}
+	if !rtp.Marker {
+		return nil, nil
+	}
+
+	frames := d.frames
+	d.discard()
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	keyframe := vp9.IsKeyframe(frames[0])
+	if d.waitKeyframe {
+		if !keyframe {
+			return nil, nil
+		}
+		d.waitKeyframe = false
+	}
+	return []*AccessUnit{{
+		Timestamp: ts,
+		PTS:       timestampToDuration(d.ts.extend(ts), d.clockRate),
+		Keyframe:  keyframe,
+		Data:      vp9.JoinSuperframe(frames),
+	}}, nil
+}
+
+// discard 丢弃当前未完成的图像
+func (d *VP9Depacketizer) discard() {
+	d.frames = nil
+	d.frame = nil
+	d.assembling = false
+}
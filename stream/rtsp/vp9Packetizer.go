@@ -0,0 +1,82 @@
+package rtsp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/codec/vp9"
+)
+
+// VP9Packetizer vp9 rtp打包器(RFC 9628)，非flexible模式，携带15位PictureID
+// 关键帧的第一个包携带包含分辨率的scalability structure
+type VP9Packetizer struct {
+	*rtpPacker
+	pictureID uint16
+}
+
+// NewVP9Packetizer 创建vp9打包器
+func NewVP9Packetizer(options PacketizerOptions) *VP9Packetizer {
+	return &VP9Packetizer{
+		rtpPacker: newRTPPacker(RTP_TYPE_VIDEO, 96, 90000, options),
+		pictureID: uint16(randUint32()) & 0x7FFF,
+	}
+}
+
+// Packetize 封装一幅图像
+func (p *VP9Packetizer) Packetize(au *AccessUnit) ([]*RTPPack, error) {
+	return p.PacketizeFrame(au.Data, au.PTS)
+}
+
+// PacketizeFrame 封装一幅图像，超帧拆分后每帧以B/E位标记，超过MTU时拆分为多个rtp包
+func (p *VP9Packetizer) PacketizeFrame(data []byte, pts time.Duration) ([]*RTPPack, error) {
+	frames := vp9.SplitSuperframe(data)
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("vp9 frame is empty")
+	}
+	ts := p.rtpTimestamp(pts)
+	pictureID := p.pictureID
+	p.pictureID = (p.pictureID + 1) & 0x7FFF
+
+	var packs []*RTPPack
+	for i, frame := range frames {
+		if len(frame) == 0 {
+			return nil, fmt.Errorf("vp9 frame %d is empty", i)
+		}
+		header, err := vp9.ParseHeader(frame)
+		if err != nil {
+			return nil, err
+		}
+		// I|P|L|F|B|E|V|Z，PictureID(M=1)
+		descriptor := []byte{0x80, 0x80 | byte(pictureID>>8), byte(pictureID)}
+		if !header.Keyframe {
+			descriptor[0] |= 0x40
+		}
+		var ss []byte
+		if header.Keyframe && header.Width > 0 {
+			// N_S=0|Y=1|G=0 WIDTH(16) HEIGHT(16)
+			ss = []byte{0x10, byte(header.Width >> 8), byte(header.Width), byte(header.Height >> 8), byte(header.Height)}
+		}
+
+		for start := true; len(frame) > 0; start = false {
+			desc := append([]byte(nil), descriptor...)
+			if start {
+				desc[0] |= 0x08
+				if ss != nil {
+					desc[0] |= 0x02
+					desc = append(desc, ss...)
+				}
+			}
+			n := p.maxPayloadSize() - len(desc)
+			if n > len(frame) {
+				n = len(frame)
+			}
+			if n == len(frame) {
+				desc[0] |= 0x04
+			}
+			payload := append(desc, frame[:n]...)
+			frame = frame[n:]
+			packs = append(packs, p.pack(payload, ts, len(frame) == 0 && i == len(frames)-1))
+		}
+	}
+	return packs, nil
+}
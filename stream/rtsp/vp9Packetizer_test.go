@@ -0,0 +1,80 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mrHChen/goutils/stream/codec"
+	"github.com/mrHChen/goutils/stream/codec/vp9"
+)
+
+// testVP9Keyframe profile 0的关键帧，宽高为 width x height，之后填充 size 字节
+func testVP9Keyframe(width, height, size int) []byte {
+	w := &codec.BitWriter{}
+	w.WriteBits(0x82, 8)
+	w.WriteBits(0x498342, 24)
+	w.WriteBits(1, 3)
+	w.WriteBits(0, 1)
+	w.WriteBits(uint64(width-1), 16)
+	w.WriteBits(uint64(height-1), 16)
+	return append(w.Bytes(), bytes.Repeat([]byte{0xAA}, size)...)
+}
+
+func TestVP9PacketizerRoundTrip(t *testing.T) {
+	keyframe := testVP9Keyframe(640, 360, 500)
+	interframe := append([]byte{0x86}, bytes.Repeat([]byte{0xBB}, 100)...)
+	// 两个空间层组成的超帧
+	superframe := vp9.JoinSuperframe([][]byte{interframe, append([]byte{0x86}, bytes.Repeat([]byte{0xCC}, 250)...)})
+	frames := [][]byte{interframe, keyframe, superframe}
+
+	packets, aus := testVideoRoundTrip(t, NewVP9Packetizer(PacketizerOptions{MTU: 200}), NewVP9Depacketizer(nil), frames)
+	if len(aus) != 2 || !bytes.Equal(aus[0].Data, keyframe) || !aus[0].Keyframe ||
+		!bytes.Equal(aus[1].Data, superframe) || aus[1].Keyframe {
+		t.Fatalf("round trip mismatch, %d frames", len(aus))
+	}
+	for i, infos := range packets {
+		if got := rtpKeyframe("vp9", false, infos[0].Payload); got != (i == 1) {
+			t.Errorf("frame %d: rtpKeyframe = %v", i, got)
+		}
+	}
+
+	// 关键帧的第一个包携带分辨率
+	desc, err := parseVP9Descriptor(packets[1][0].Payload)
+	if err != nil || !desc.start || desc.end || desc.interPredicted {
+		t.Fatalf("keyframe descriptor %+v, %v", desc, err)
+	}
+	if ss := packets[1][0].Payload[3:8]; !bytes.Equal(ss, []byte{0x10, 0x02, 0x80, 0x01, 0x68}) {
+		t.Errorf("scalability structure %x", ss)
+	}
+
+	d := NewVP9Depacketizer(nil)
+	all := append(append([]*RTPInfo(nil), packets[1][1:]...), packets[2]...)
+	if aus := decodeAll(t, d, all); len(aus) != 0 {
+		t.Errorf("got %d frames without a keyframe", len(aus))
+	}
+	if _, err := NewVP9Packetizer(PacketizerOptions{}).PacketizeFrame([]byte{0x42}, 0); err == nil {
+		t.Error("expected error for invalid frame header")
+	}
+}
+
+func TestVP9Descriptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		offset  int
+		err     bool
+	}{
+		{"minimal", []byte{0x0c, 0xAA}, 1, false},
+		{"layer indices", []byte{0xac, 0x81, 0x02, 0x00, 0x00, 0xAA}, 5, false},
+		{"flexible reference indices", []byte{0xdc, 0x05, 0x03, 0x02, 0xAA}, 4, false},
+		{"scalability structure with pictures", []byte{0x0e, 0x18, 0x02, 0x80, 0x01, 0x68, 0x01, 0x04, 0x01, 0xAA}, 9, false},
+		{"truncated picture id", []byte{0x8c, 0x81}, 0, true},
+		{"empty payload", []byte{0x0c}, 0, true},
+	}
+	for _, tt := range tests {
+		desc, err := parseVP9Descriptor(tt.payload)
+		if (err != nil) != tt.err || !tt.err && desc.offset != tt.offset {
+			t.Errorf("%s: got %+v, %v", tt.name, desc, err)
+		}
+	}
+}
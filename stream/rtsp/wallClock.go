@@ -0,0 +1,213 @@
+package rtsp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// clockMapping rtp时间戳与绝对时间的对应关系
+type clockMapping struct {
+	rtp   uint32
+	time  time.Time
+	valid bool
+}
+
+// at 换算rtp时间戳对应的时间，时间戳差值按有符号数处理回绕
+func (m *clockMapping) at(ts uint32, clockRate int) time.Time {
+	return m.time.Add(timestampToDuration(int64(int32(ts-m.rtp)), clockRate))
+}
+
+// advance 时间戳超过对应点较多时前移对应点，使长时间运行后的差值不会超出int32范围
+func (m *clockMapping) advance(ts uint32, clockRate int) {
+	if m.valid && int32(ts-m.rtp) > 1<<30 {
+		m.time = m.at(ts, clockRate)
+		m.rtp = ts
+	}
+}
+
+// mediaClock 一路媒体的时钟
+type mediaClock struct {
+	clockRate int
+	ssrc      uint32
+	hasSSRC   bool
+	// 第一个包的到达时间，没有SR时用于估算
+	arrival clockMapping
+	// 最近的SR或ONVIF回放扩展，为发送端的采集时间
+	report clockMapping
+}
+
+// setSSRC 记录源，源发生变化时清除对应关系并返回true
+func (c *mediaClock) setSSRC(ssrc uint32) bool {
+	if !c.hasSSRC {
+		// 先于rtp包收到的SR仍然有效
+		c.ssrc = ssrc
+		c.hasSSRC = true
+		return false
+	}
+	if c.ssrc == ssrc {
+		return false
+	}
+	c.ssrc = ssrc
+	c.arrival = clockMapping{}
+	c.report = clockMapping{}
+	return true
+}
+
+// WallClock 由rtcp SR和ONVIF回放扩展换算各路媒体rtp时间戳对应的采集时间，并得到音视频同步的PTS
+// 没有收到SR的媒体以第一个包的到达时间估算
+type WallClock struct {
+	lock   sync.Mutex
+	clocks map[RTPType]*mediaClock
+	// 同步PTS的起点，分别对应由SR换算和由到达时间估算的时间
+	reportBase  time.Time
+	arrivalBase time.Time
+}
+
+// NewWallClock clockRates 为各路媒体(RTP_TYPE_AUDIO/RTP_TYPE_VIDEO)的时钟频率
+func NewWallClock(clockRates map[RTPType]int) *WallClock {
+	w := &WallClock{}
+	w.Reset(clockRates)
+	return w
+}
+
+// Reset 推流端变化后重新开始
+func (w *WallClock) Reset(clockRates map[RTPType]int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.clocks = make(map[RTPType]*mediaClock)
+	for t, rate := range clockRates {
+		if rate > 0 {
+			w.clocks[t] = &mediaClock{clockRate: rate}
+		}
+	}
+	w.reportBase = time.Time{}
+	w.arrivalBase = time.Time{}
+}
+
+// OnRTCP 记录SR中NTP时间与rtp时间戳的对应关系
+func (w *WallClock) OnRTCP(pack *RTPPack) error {
+	packets, err := rtcp.Unmarshal(pack.Buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	c := w.clocks[mediaType(pack.Type)]
+	if c == nil {
+		return nil
+	}
+	for _, pkt := range packets {
+		sr, ok := pkt.(*rtcp.SenderReport)
+		if !ok || (c.hasSSRC && sr.SSRC != c.ssrc) {
+			continue
+		}
+		c.report = clockMapping{rtp: sr.RTPTime, time: rtcp.TimeFromNTP(sr.NTPTime), valid: true}
+	}
+	return nil
+}
+
+// OnRTP 处理一个rtp包，ONVIF回放扩展中的时间优先于SR，返回该包的采集时间
+// 包可能已经交给其他协程，这里不修改包，由调用方在分发之前设置 CaptureTime
+func (w *WallClock) OnRTP(pack *RTPPack, arrival time.Time) (time.Time, bool) {
+	if isRTCP(pack.Type) {
+		return time.Time{}, false
+	}
+	pkt := &RTPPacket{}
+	if err := pkt.Unmarshal(pack.Buffer.Bytes()); err != nil {
+		return time.Time{}, false
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	c := w.clocks[pack.Type]
+	if c == nil {
+		return time.Time{}, false
+	}
+	if c.setSSRC(pkt.SSRC) {
+		w.reportBase = time.Time{}
+		w.arrivalBase = time.Time{}
+	}
+	if !c.arrival.valid {
+		c.arrival = clockMapping{rtp: pkt.Timestamp, time: arrival, valid: true}
+	}
+	if onvif, err := pkt.ONVIFReplay(); err == nil && onvif != nil {
+		c.report = clockMapping{rtp: pkt.Timestamp, time: onvif.Time(), valid: true}
+	}
+	c.arrival.advance(pkt.Timestamp, c.clockRate)
+	c.report.advance(pkt.Timestamp, c.clockRate)
+	t := c.arrival.at(pkt.Timestamp, c.clockRate)
+	if c.report.valid {
+		t = c.report.at(pkt.Timestamp, c.clockRate)
+	}
+	return t, true
+}
+
+// synced 每路媒体是否都有发送端的对应关系
+func (w *WallClock) synced() bool {
+	if len(w.clocks) == 0 {
+		return false
+	}
+	for _, c := range w.clocks {
+		if !c.report.valid {
+			return false
+		}
+	}
+	return true
+}
+
+// Synced 每路媒体是否都已由SR或ONVIF回放扩展得到采集时间，此时各路媒体的PTS同步
+func (w *WallClock) Synced() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.synced()
+}
+
+// Time rtp时间戳对应的采集时间，没有SR时为按到达时间估算的值，ok为false表示还没有收到该媒体的包
+func (w *WallClock) Time(t RTPType, ts uint32) (time.Time, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	c := w.clocks[t]
+	switch {
+	case c == nil:
+		return time.Time{}, false
+	case c.report.valid:
+		return c.report.at(ts, c.clockRate), true
+	case c.arrival.valid:
+		return c.arrival.at(ts, c.clockRate), true
+	}
+	return time.Time{}, false
+}
+
+// SyncPTS 各路媒体共用时间起点的PTS，可用于音视频同步
+// 所有媒体都有SR时按采集时间计算，否则按到达时间估算，切换时PTS会重新从0附近开始
+func (w *WallClock) SyncPTS(t RTPType, ts uint32) (time.Duration, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	c := w.clocks[t]
+	if c == nil || !c.arrival.valid {
+		return 0, false
+	}
+	if w.synced() {
+		at := c.report.at(ts, c.clockRate)
+		if w.reportBase.IsZero() {
+			w.reportBase = at
+		}
+		return at.Sub(w.reportBase), true
+	}
+	at := c.arrival.at(ts, c.clockRate)
+	if w.arrivalBase.IsZero() {
+		w.arrivalBase = at
+	}
+	return at.Sub(w.arrivalBase), true
+}
+
+// Stamp 填充访问单元的采集时间和同步PTS
+func (w *WallClock) Stamp(t RTPType, au *AccessUnit) {
+	if tm, ok := w.Time(t, au.Timestamp); ok {
+		au.CaptureTime = tm
+	}
+	if pts, ok := w.SyncPTS(t, au.Timestamp); ok {
+		au.SyncPTS = pts
+	}
+}
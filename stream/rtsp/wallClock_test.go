@@ -0,0 +1,205 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mrHChen/goutils/stream/rtcp"
+)
+
+// testSRPack 构造只包含SR的rtcp包
+func testSRPack(t *testing.T, typ RTPType, ssrc uint32, ntp time.Time, rtpTime uint32) *RTPPack {
+	t.Helper()
+	b, err := (&rtcp.SenderReport{SSRC: ssrc, NTPTime: rtcp.NTPTime(ntp), RTPTime: rtpTime}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RTPPack{Type: controlType(typ), Buffer: bytes.NewBuffer(b)}
+}
+
+func TestWallClockTime(t *testing.T) {
+	arrival := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	capture := time.Date(2024, 5, 1, 11, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		steps func(t *testing.T, w *WallClock) (time.Time, bool)
+		want  time.Time
+	}{
+		{
+			name: "estimated from arrival",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 90000), arrival)
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 2, 93000), arrival.Add(time.Second))
+			},
+			want: arrival.Add(33333333),
+		},
+		{
+			name: "sender report",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 90000), arrival)
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 90000)); err != nil {
+					t.Fatal(err)
+				}
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 2, 180000), arrival)
+			},
+			want: capture.Add(time.Second),
+		},
+		{
+			name: "sender report before rtp",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 0)); err != nil {
+					t.Fatal(err)
+				}
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 45000), arrival)
+			},
+			want: capture.Add(500 * time.Millisecond),
+		},
+		{
+			name: "sender report of other ssrc ignored",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 0), arrival)
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 2, capture, 0)); err != nil {
+					t.Fatal(err)
+				}
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 2, 0), arrival)
+			},
+			want: arrival,
+		},
+		{
+			name: "timestamp wraparound",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 0xFFFFFFFF-44999)); err != nil {
+					t.Fatal(err)
+				}
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 45000), arrival)
+			},
+			want: capture.Add(time.Second),
+		},
+		{
+			name: "onvif replay preferred",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 0)); err != nil {
+					t.Fatal(err)
+				}
+				ext := &ONVIFReplayExtension{}
+				ext.SetTime(capture.Add(time.Hour))
+				pkt := NewRTPPacket(96, 1, 9000, 1, false, []byte{0x01})
+				if err := pkt.SetONVIFReplay(ext); err != nil {
+					t.Fatal(err)
+				}
+				b, _ := pkt.Marshal()
+				return w.OnRTP(&RTPPack{Type: RTP_TYPE_VIDEO, Buffer: bytes.NewBuffer(b)}, arrival)
+			},
+			want: capture.Add(time.Hour),
+		},
+		{
+			name: "ssrc change discards mapping",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 0), arrival)
+				if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 0)); err != nil {
+					t.Fatal(err)
+				}
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 2, 1, 90000), arrival.Add(time.Minute))
+			},
+			want: arrival.Add(time.Minute),
+		},
+		{
+			name: "unknown track",
+			steps: func(t *testing.T, w *WallClock) (time.Time, bool) {
+				return w.OnRTP(testRTPPack(t, RTP_TYPE_AUDIO, 1, 1, 0), arrival)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWallClock(map[RTPType]int{RTP_TYPE_VIDEO: 90000})
+			got, ok := tt.steps(t, w)
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Errorf("got %v %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestWallClockSyncPTS(t *testing.T) {
+	arrival := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	capture := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	w := NewWallClock(map[RTPType]int{RTP_TYPE_VIDEO: 90000, RTP_TYPE_AUDIO: 8000})
+
+	// 音频比视频晚到200ms，没有SR时按到达时间估算
+	w.OnRTP(testRTPPack(t, RTP_TYPE_VIDEO, 1, 1, 1000), arrival)
+	w.OnRTP(testRTPPack(t, RTP_TYPE_AUDIO, 2, 1, 5000), arrival.Add(200*time.Millisecond))
+	if w.Synced() {
+		t.Fatal("synced without sender reports")
+	}
+	if pts, ok := w.SyncPTS(RTP_TYPE_VIDEO, 1000); !ok || pts != 0 {
+		t.Errorf("video pts %v %v", pts, ok)
+	}
+	if pts, ok := w.SyncPTS(RTP_TYPE_AUDIO, 5800); !ok || pts != 300*time.Millisecond {
+		t.Errorf("audio pts %v %v", pts, ok)
+	}
+
+	// 两路的SR对应同一采集时间，之后按采集时间对齐
+	if err := w.OnRTCP(testSRPack(t, RTP_TYPE_VIDEO, 1, capture, 10000)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Synced() {
+		t.Fatal("synced with one sender report")
+	}
+	if err := w.OnRTCP(testSRPack(t, RTP_TYPE_AUDIO, 2, capture, 50000)); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Synced() {
+		t.Fatal("not synced with both sender reports")
+	}
+	tests := []struct {
+		typ  RTPType
+		ts   uint32
+		want time.Duration
+	}{
+		{RTP_TYPE_VIDEO, 10000, 0},
+		{RTP_TYPE_AUDIO, 50000, 0},
+		{RTP_TYPE_AUDIO, 50800, 100 * time.Millisecond},
+		{RTP_TYPE_VIDEO, 19000, 100 * time.Millisecond},
+		{RTP_TYPE_VIDEO, 1000, -100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if pts, ok := w.SyncPTS(tt.typ, tt.ts); !ok || pts != tt.want {
+			t.Errorf("type %d ts %d: got %v %v, want %v", tt.typ, tt.ts, pts, ok, tt.want)
+		}
+	}
+
+	au := &AccessUnit{Timestamp: 54000}
+	w.Stamp(RTP_TYPE_AUDIO, au)
+	if !au.CaptureTime.Equal(capture.Add(500*time.Millisecond)) || au.SyncPTS != 500*time.Millisecond {
+		t.Errorf("stamp got %v %v", au.CaptureTime, au.SyncPTS)
+	}
+
+	w.Reset(map[RTPType]int{RTP_TYPE_VIDEO: 90000})
+	if _, ok := w.Time(RTP_TYPE_VIDEO, 0); ok {
+		t.Errorf("time available after reset")
+	}
+	if _, ok := w.SyncPTS(RTP_TYPE_AUDIO, 0); ok {
+		t.Errorf("removed track still has pts")
+	}
+}
+
+func TestClockMappingAdvance(t *testing.T) {
+	base := time.Unix(0, 0)
+	m := clockMapping{rtp: 0, time: base, valid: true}
+	// 90kHz下约3.3小时后时间戳差值超过2^30
+	ts := uint32(1<<30 + 90000)
+	m.advance(ts, 90000)
+	if m.rtp != ts {
+		t.Fatalf("mapping not advanced")
+	}
+	// 相对最初的对应点差值超出int32，前移后仍能正确换算
+	later := ts + 1<<30 + 1<<29
+	want := base.Add(timestampToDuration(int64(ts)+1<<30+1<<29, 90000))
+	m.advance(later, 90000)
+	if got := m.at(later, 90000); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,423 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+)
+
+const (
+	// authKeyLength HMAC-SHA1的会话认证密钥长度
+	authKeyLength = 20
+	// replayWindowSize 防重放窗口大小(RFC 3711 3.3.2)
+	replayWindowSize = 64
+	// maxSRTCPIndex SRTCP索引为31位
+	maxSRTCPIndex = 0x7FFFFFFF
+	// srtcpEncryptedFlag SRTCP索引前的E标志
+	srtcpEncryptedFlag = 0x80000000
+)
+
+// replayWindow 已收到的最大索引及其之前窗口内的包
+type replayWindow struct {
+	initialized bool
+	max         uint64
+	bitmap      uint64
+}
+
+// check 索引是否重复或过旧
+func (w *replayWindow) check(index uint64) bool {
+	if !w.initialized || index > w.max {
+		return true
+	}
+	diff := w.max - index
+	return diff < replayWindowSize && w.bitmap&(1<<diff) == 0
+}
+
+// accept 认证通过后记录索引
+func (w *replayWindow) accept(index uint64) {
+	if !w.initialized {
+		w.initialized = true
+		w.max = index
+		w.bitmap = 1
+		return
+	}
+	if index > w.max {
+		diff := index - w.max
+		if diff >= replayWindowSize {
+			w.bitmap = 0
+		} else {
+			w.bitmap <<= diff
+		}
+		w.bitmap |= 1
+		w.max = index
+		return
+	}
+	w.bitmap |= 1 << (w.max - index)
+}
+
+// rtpState 一个源的SRTP状态
+type rtpState struct {
+	initialized bool
+	// roc 序号回绕次数，与序号组成48位索引
+	roc     uint32
+	lastSeq uint16
+	replay  replayWindow
+}
+
+// sendIndex 发送端的索引
+func (s *rtpState) sendIndex(seq uint16) (uint32, uint64) {
+	if !s.initialized {
+		s.initialized = true
+		s.lastSeq = seq
+	} else if diff := seq - s.lastSeq; diff < 0x8000 {
+		if seq < s.lastSeq {
+			s.roc++
+		}
+		s.lastSeq = seq
+	}
+	return s.roc, uint64(s.roc)<<16 | uint64(seq)
+}
+
+// estimateROC 接收端估计包的回绕次数(RFC 3711 附录A)
+func (s *rtpState) estimateROC(seq uint16) uint32 {
+	if !s.initialized {
+		return 0
+	}
+	if s.lastSeq < 0x8000 {
+		if seq > s.lastSeq && seq-s.lastSeq > 0x8000 && s.roc > 0 {
+			return s.roc - 1
+		}
+		return s.roc
+	}
+	if s.lastSeq-0x8000 > seq {
+		return s.roc + 1
+	}
+	return s.roc
+}
+
+// update 认证通过后更新回绕次数和最大序号
+func (s *rtpState) update(roc uint32, seq uint16) {
+	if !s.initialized {
+		s.initialized = true
+		s.roc, s.lastSeq = roc, seq
+		return
+	}
+	if roc > s.roc || roc == s.roc && seq > s.lastSeq {
+		s.roc, s.lastSeq = roc, seq
+	}
+}
+
+// rtcpState 一个源的SRTCP状态
+type rtcpState struct {
+	index  uint32
+	replay replayWindow
+}
+
+// sessionKeys 一个方向(rtp或rtcp)的会话密钥
+type sessionKeys struct {
+	block cipher.Block
+	aead  cipher.AEAD
+	salt  []byte
+	auth  hash.Hash
+}
+
+func newSessionKeys(profile ProtectionProfile, masterKey, masterSalt []byte, encLabel, authLabel, saltLabel byte) (*sessionKeys, error) {
+	key, err := deriveKey(encLabel, masterKey, masterSalt, profile.KeyLength())
+	if err != nil {
+		return nil, err
+	}
+	salt, err := deriveKey(saltLabel, masterKey, masterSalt, profile.SaltLength())
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	k := &sessionKeys{block: block, salt: salt}
+	if profile.aead() {
+		if k.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	authKey, err := deriveKey(authLabel, masterKey, masterSalt, authKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	k.auth = hmac.New(sha1.New, authKey)
+	return k, nil
+}
+
+// tag 计算HMAC-SHA1认证标签
+func (k *sessionKeys) tag(length int, parts ...[]byte) []byte {
+	k.auth.Reset()
+	for _, part := range parts {
+		k.auth.Write(part)
+	}
+	return k.auth.Sum(nil)[:length]
+}
+
+// Context SRTP/SRTCP的加解密上下文(RFC 3711)，同一个主密钥可用于两个方向，各源的状态分别保存
+type Context struct {
+	profile ProtectionProfile
+	rtp     *sessionKeys
+	rtcp    *sessionKeys
+
+	lock        sync.Mutex
+	encryptRTP  map[uint32]*rtpState
+	decryptRTP  map[uint32]*rtpState
+	encryptRTCP map[uint32]*rtcpState
+	decryptRTCP map[uint32]*rtcpState
+}
+
+// NewContext 由主密钥和主盐创建上下文
+func NewContext(profile ProtectionProfile, masterKey, masterSalt []byte) (*Context, error) {
+	if !profile.valid() {
+		return nil, fmt.Errorf("srtp protection profile %v not supported", profile)
+	}
+	if len(masterKey) != profile.KeyLength() || len(masterSalt) != profile.SaltLength() {
+		return nil, fmt.Errorf("srtp %v master key/salt length %d/%d invalid", profile, len(masterKey), len(masterSalt))
+	}
+	rtp, err := newSessionKeys(profile, masterKey, masterSalt, labelRTPEncryption, labelRTPAuth, labelRTPSalt)
+	if err != nil {
+		return nil, err
+	}
+	rtcp, err := newSessionKeys(profile, masterKey, masterSalt, labelRTCPEncryption, labelRTCPAuth, labelRTCPSalt)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{
+		profile:     profile,
+		rtp:         rtp,
+		rtcp:        rtcp,
+		encryptRTP:  make(map[uint32]*rtpState),
+		decryptRTP:  make(map[uint32]*rtpState),
+		encryptRTCP: make(map[uint32]*rtcpState),
+		decryptRTCP: make(map[uint32]*rtcpState),
+	}, nil
+}
+
+// Profile 保护方式
+func (c *Context) Profile() ProtectionProfile {
+	return c.profile
+}
+
+// rtpHeaderLength rtp头部长度，包括CSRC和头部扩展
+func rtpHeaderLength(b []byte) (int, error) {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return 0, fmt.Errorf("srtp invalid rtp packet")
+	}
+	n := 12 + 4*int(b[0]&0x0F)
+	if b[0]&0x10 != 0 {
+		if len(b) < n+4 {
+			return 0, fmt.Errorf("srtp rtp extension truncated")
+		}
+		n += 4 + 4*int(binary.BigEndian.Uint16(b[n+2:]))
+	}
+	if len(b) < n {
+		return 0, fmt.Errorf("srtp rtp header truncated")
+	}
+	return n, nil
+}
+
+// counterIV AES-CM的计数器初值：(salt<<16) ^ (ssrc<<64) ^ (index<<16)
+func (k *sessionKeys) counterIV(ssrc uint32, index uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, k.salt)
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], ssrc)
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= b[i]
+	}
+	binary.BigEndian.PutUint64(b[:], index<<16)
+	for i := 0; i < 8; i++ {
+		iv[8+i] ^= b[i]
+	}
+	return iv
+}
+
+// gcmIV AES-GCM的IV：(0x0000 || ssrc || hi32 || lo16) ^ salt(RFC 7714 8.1、9.1)
+func (k *sessionKeys) gcmIV(ssrc uint32, index uint64) []byte {
+	iv := make([]byte, 12)
+	binary.BigEndian.PutUint32(iv[2:], ssrc)
+	binary.BigEndian.PutUint32(iv[6:], uint32(index>>16))
+	binary.BigEndian.PutUint16(iv[10:], uint16(index))
+	for i := range iv {
+		iv[i] ^= k.salt[i]
+	}
+	return iv
+}
+
+// EncryptRTP 加密并认证一个rtp包，返回新的SRTP包
+func (c *Context) EncryptRTP(packet []byte) ([]byte, error) {
+	n, err := rtpHeaderLength(packet)
+	if err != nil {
+		return nil, err
+	}
+	ssrc := binary.BigEndian.Uint32(packet[8:])
+	seq := binary.BigEndian.Uint16(packet[2:])
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.encryptRTP[ssrc]
+	if state == nil {
+		state = &rtpState{}
+		c.encryptRTP[ssrc] = state
+	}
+	roc, index := state.sendIndex(seq)
+
+	if c.profile.aead() {
+		out := make([]byte, n, len(packet)+aeadTagLength)
+		copy(out, packet[:n])
+		return c.rtp.aead.Seal(out, c.rtp.gcmIV(ssrc, index), packet[n:], packet[:n]), nil
+	}
+	tagLength := c.profile.rtpAuthTagLength()
+	out := make([]byte, len(packet), len(packet)+tagLength)
+	copy(out, packet[:n])
+	cipher.NewCTR(c.rtp.block, c.rtp.counterIV(ssrc, index)).XORKeyStream(out[n:], packet[n:])
+	var rocBytes [4]byte
+	binary.BigEndian.PutUint32(rocBytes[:], roc)
+	return append(out, c.rtp.tag(tagLength, out, rocBytes[:])...), nil
+}
+
+// DecryptRTP 认证并解密一个SRTP包，返回新的rtp包，认证失败或重放的包返回错误
+func (c *Context) DecryptRTP(packet []byte) ([]byte, error) {
+	n, err := rtpHeaderLength(packet)
+	if err != nil {
+		return nil, err
+	}
+	tagLength := c.profile.rtpAuthTagLength()
+	if c.profile.aead() {
+		tagLength = aeadTagLength
+	}
+	if len(packet) < n+tagLength {
+		return nil, fmt.Errorf("srtp packet too short: %d", len(packet))
+	}
+	ssrc := binary.BigEndian.Uint32(packet[8:])
+	seq := binary.BigEndian.Uint16(packet[2:])
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.decryptRTP[ssrc]
+	if state == nil {
+		state = &rtpState{}
+		c.decryptRTP[ssrc] = state
+	}
+	roc := state.estimateROC(seq)
+	index := uint64(roc)<<16 | uint64(seq)
+	if !state.replay.check(index) {
+		return nil, fmt.Errorf("srtp ssrc %08X seq %d replayed", ssrc, seq)
+	}
+
+	var out []byte
+	if c.profile.aead() {
+		out = make([]byte, n, len(packet)-tagLength)
+		copy(out, packet[:n])
+		if out, err = c.rtp.aead.Open(out, c.rtp.gcmIV(ssrc, index), packet[n:], packet[:n]); err != nil {
+			return nil, fmt.Errorf("srtp ssrc %08X seq %d authentication failed", ssrc, seq)
+		}
+	} else {
+		body := packet[:len(packet)-tagLength]
+		var rocBytes [4]byte
+		binary.BigEndian.PutUint32(rocBytes[:], roc)
+		if subtle.ConstantTimeCompare(c.rtp.tag(tagLength, body, rocBytes[:]), packet[len(body):]) != 1 {
+			return nil, fmt.Errorf("srtp ssrc %08X seq %d authentication failed", ssrc, seq)
+		}
+		out = make([]byte, len(body))
+		copy(out, body[:n])
+		cipher.NewCTR(c.rtp.block, c.rtp.counterIV(ssrc, index)).XORKeyStream(out[n:], body[n:])
+	}
+	state.replay.accept(index)
+	state.update(roc, seq)
+	return out, nil
+}
+
+// EncryptRTCP 加密并认证一个rtcp复合包，返回新的SRTCP包
+func (c *Context) EncryptRTCP(packet []byte) ([]byte, error) {
+	if len(packet) < 8 {
+		return nil, fmt.Errorf("srtcp invalid rtcp packet")
+	}
+	ssrc := binary.BigEndian.Uint32(packet[4:])
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.encryptRTCP[ssrc]
+	if state == nil {
+		state = &rtcpState{}
+		c.encryptRTCP[ssrc] = state
+	}
+	index := state.index
+	state.index = (state.index + 1) & maxSRTCPIndex
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], srtcpEncryptedFlag|index)
+
+	if c.profile.aead() {
+		out := make([]byte, 8, len(packet)+aeadTagLength+4)
+		copy(out, packet[:8])
+		aad := append(append([]byte(nil), packet[:8]...), trailer[:]...)
+		out = c.rtcp.aead.Seal(out, c.rtcp.gcmIV(ssrc, uint64(index)), packet[8:], aad)
+		return append(out, trailer[:]...), nil
+	}
+	tagLength := c.profile.rtcpAuthTagLength()
+	out := make([]byte, len(packet), len(packet)+4+tagLength)
+	copy(out, packet[:8])
+	cipher.NewCTR(c.rtcp.block, c.rtcp.counterIV(ssrc, uint64(index))).XORKeyStream(out[8:], packet[8:])
+	out = append(out, trailer[:]...)
+	return append(out, c.rtcp.tag(tagLength, out)...), nil
+}
+
+// DecryptRTCP 认证并解密一个SRTCP包，返回新的rtcp复合包
+func (c *Context) DecryptRTCP(packet []byte) ([]byte, error) {
+	tagLength := c.profile.rtcpAuthTagLength()
+	if len(packet) < 8+4+tagLength {
+		return nil, fmt.Errorf("srtcp packet too short: %d", len(packet))
+	}
+	ssrc := binary.BigEndian.Uint32(packet[4:])
+	trailer := packet[len(packet)-tagLength-4 : len(packet)-tagLength]
+	flagIndex := binary.BigEndian.Uint32(trailer)
+	index := flagIndex & maxSRTCPIndex
+	encrypted := flagIndex&srtcpEncryptedFlag != 0
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.decryptRTCP[ssrc]
+	if state == nil {
+		state = &rtcpState{}
+		c.decryptRTCP[ssrc] = state
+	}
+	if !state.replay.check(uint64(index)) {
+		return nil, fmt.Errorf("srtcp ssrc %08X index %d replayed", ssrc, index)
+	}
+
+	body := packet[:len(packet)-tagLength-4]
+	var out []byte
+	if c.profile.aead() {
+		if !encrypted {
+			return nil, fmt.Errorf("srtcp unencrypted aead packet not supported")
+		}
+		if len(body) < 8+aeadTagLength {
+			return nil, fmt.Errorf("srtcp packet too short: %d", len(packet))
+		}
+		aad := append(append([]byte(nil), body[:8]...), trailer...)
+		out = make([]byte, 8, len(body)-aeadTagLength)
+		copy(out, body[:8])
+		var err error
+		if out, err = c.rtcp.aead.Open(out, c.rtcp.gcmIV(ssrc, uint64(index)), body[8:], aad); err != nil {
+			return nil, fmt.Errorf("srtcp ssrc %08X index %d authentication failed", ssrc, index)
+		}
+	} else {
+		if subtle.ConstantTimeCompare(c.rtcp.tag(tagLength, packet[:len(packet)-tagLength]), packet[len(packet)-tagLength:]) != 1 {
+			return nil, fmt.Errorf("srtcp ssrc %08X index %d authentication failed", ssrc, index)
+		}
+		out = make([]byte, len(body))
+		copy(out, body)
+		if encrypted {
+			cipher.NewCTR(c.rtcp.block, c.rtcp.counterIV(ssrc, uint64(index))).XORKeyStream(out[8:], body[8:])
+		}
+	}
+	state.replay.accept(uint64(index))
+	return out, nil
+}
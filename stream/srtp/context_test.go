@@ -0,0 +1,296 @@
+package srtp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"testing"
+)
+
+// TestCounterIV RFC 3711 附录B.2的AES-CM密钥流
+func TestCounterIV(t *testing.T) {
+	block, err := aes.NewCipher(mustHex(t, "2B7E151628AED2A6ABF7158809CF4F3C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &sessionKeys{block: block, salt: mustHex(t, "F0F1F2F3F4F5F6F7F8F9FAFBFCFD")}
+	iv := k.counterIV(0, 0)
+	if want := mustHex(t, "F0F1F2F3F4F5F6F7F8F9FAFBFCFD0000"); !bytes.Equal(iv, want) {
+		t.Fatalf("iv %X, want %X", iv, want)
+	}
+	keystream := make([]byte, 0x10000*aes.BlockSize)
+	cipher.NewCTR(block, iv).XORKeyStream(keystream, keystream)
+	tests := []struct {
+		counter int
+		want    string
+	}{
+		{0x0000, "E03EAD0935C95E80E166B16DD92B4EB4"},
+		{0x0001, "D23513162B02D0F72A43A2FE4A5F97AB"},
+		{0x0002, "41E95B3BB0A2E8DD477901E4FCA894C0"},
+		{0xFEFF, "EC8CDF7398607CB0F2D21675EA9EA1E4"},
+		{0xFF00, "362B7C3C6773516318A077D7FC5073AE"},
+		{0xFF01, "6A2CC3787889374FBEB4C81B17BA6C44"},
+	}
+	for _, tt := range tests {
+		if got := keystream[tt.counter*aes.BlockSize : (tt.counter+1)*aes.BlockSize]; !bytes.Equal(got, mustHex(t, tt.want)) {
+			t.Errorf("keystream %04X %X, want %s", tt.counter, got, tt.want)
+		}
+	}
+	// ssrc和索引异或在盐的对应位置
+	iv = k.counterIV(0x01020304, 0x0000AABBCCDD)
+	if want := mustHex(t, "F0F1F2F3F5F7F5F3F8F9504030200000"); !bytes.Equal(iv, want) {
+		t.Errorf("iv %X, want %X", iv, want)
+	}
+}
+
+// TestAEADVector RFC 7714 16.1.1的AEAD_AES_128_GCM加密示例，示例中直接给出会话密钥和盐
+func TestAEADVector(t *testing.T) {
+	block, err := aes.NewCipher(mustHex(t, "000102030405060708090a0b0c0d0e0f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &sessionKeys{block: block, aead: aead, salt: mustHex(t, "517569642070726f2071756f")}
+	c := &Context{
+		profile:    ProfileAEADAES128GCM,
+		rtp:        keys,
+		rtcp:       keys,
+		encryptRTP: make(map[uint32]*rtpState),
+		decryptRTP: make(map[uint32]*rtpState),
+	}
+	packet := mustHex(t, "8040f17b8041f8d35501a0b247616c6c696120657374206f6d6e69732064697669736120696e207061727465732074726573")
+	want := mustHex(t, "8040f17b8041f8d35501a0b2f24de3a3fb34de6cacba861c9d7e4bcabe633bd50d294e6f42a5f47a51c7d19b36de3adf8833899d7f27beb16a9152cf765ee4390cce")
+	if iv := keys.gcmIV(0x5501a0b2, 0xf17b); !bytes.Equal(iv, mustHex(t, "51753c6580c2726f20718414")) {
+		t.Errorf("iv %x", iv)
+	}
+	out, err := c.EncryptRTP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, want) {
+		t.Fatalf("srtp %x, want %x", out, want)
+	}
+	dec, err := c.DecryptRTP(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, packet) {
+		t.Errorf("decrypted %x", dec)
+	}
+}
+
+// testRTP 构造rtp包，csrc和头部扩展可选
+func testRTP(seq uint16, ssrc uint32, extension bool, payload []byte) []byte {
+	b := []byte{0x80, 96, 0, 0, 0, 0, 0x12, 0x34, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], seq)
+	binary.BigEndian.PutUint32(b[8:], ssrc)
+	if extension {
+		b[0] |= 0x10
+		b = append(b, 0xBE, 0xDE, 0x00, 0x01, 0x10, 0xAA, 0x00, 0x00)
+	}
+	return append(b, payload...)
+}
+
+// testContexts 同一个主密钥的发送端和接收端
+func testContexts(t *testing.T, profile ProtectionProfile) (*Context, *Context) {
+	t.Helper()
+	key := make([]byte, profile.KeyLength())
+	salt := make([]byte, profile.SaltLength())
+	for i := range key {
+		key[i] = byte(i)
+	}
+	for i := range salt {
+		salt[i] = byte(0xA0 + i)
+	}
+	sender, err := NewContext(profile, key, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewContext(profile, key, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender, receiver
+}
+
+var testProfiles = []ProtectionProfile{
+	ProfileAESCM128HMACSHA180,
+	ProfileAESCM128HMACSHA132,
+	ProfileAEADAES128GCM,
+	ProfileAEADAES256GCM,
+}
+
+func TestRTPRoundTrip(t *testing.T) {
+	overheads := map[ProtectionProfile]int{
+		ProfileAESCM128HMACSHA180: 10,
+		ProfileAESCM128HMACSHA132: 4,
+		ProfileAEADAES128GCM:      16,
+		ProfileAEADAES256GCM:      16,
+	}
+	for _, profile := range testProfiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			sender, receiver := testContexts(t, profile)
+			// 序号回绕后ROC加1
+			for i, seq := range []uint16{65533, 65534, 65535, 0, 1} {
+				packet := testRTP(seq, 0x11223344, i%2 == 0, bytes.Repeat([]byte{byte(i)}, 30))
+				out, err := sender.EncryptRTP(packet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(out) != len(packet)+overheads[profile] {
+					t.Errorf("srtp length %d", len(out))
+				}
+				n, _ := rtpHeaderLength(packet)
+				if !bytes.Equal(out[:n], packet[:n]) || bytes.Equal(out[n:len(packet)], packet[n:]) {
+					t.Errorf("header changed or payload not encrypted")
+				}
+				dec, err := receiver.DecryptRTP(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(dec, packet) {
+					t.Errorf("seq %d decrypted %x", seq, dec)
+				}
+				// 重放的包被拒绝
+				if _, err := receiver.DecryptRTP(out); err == nil {
+					t.Errorf("seq %d replay accepted", seq)
+				}
+			}
+			if state := receiver.decryptRTP[0x11223344]; state.roc != 1 || state.lastSeq != 1 {
+				t.Errorf("roc %d seq %d", state.roc, state.lastSeq)
+			}
+			out, _ := sender.EncryptRTP(testRTP(2, 0x11223344, false, []byte{1, 2, 3, 4}))
+			out[len(out)-1] ^= 1
+			if _, err := receiver.DecryptRTP(out); err == nil {
+				t.Errorf("tampered packet accepted")
+			}
+			// 认证失败的包不影响之后的包
+			out[len(out)-1] ^= 1
+			if _, err := receiver.DecryptRTP(out); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRTPReorder(t *testing.T) {
+	sender, receiver := testContexts(t, ProfileAESCM128HMACSHA180)
+	var packets [][]byte
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		out, _ := sender.EncryptRTP(testRTP(seq, 1, false, []byte{byte(seq)}))
+		packets = append(packets, out)
+	}
+	// 回绕后收到回绕前迟到的包，按上一个ROC解密
+	for _, i := range []int{0, 2, 1, 3} {
+		dec, err := receiver.DecryptRTP(packets[i])
+		if err != nil {
+			t.Fatalf("packet %d: %s", i, err)
+		}
+		if dec[12] != packets[i][3] {
+			t.Errorf("packet %d payload %x", i, dec[12])
+		}
+	}
+}
+
+func TestRTCPRoundTrip(t *testing.T) {
+	// 带一个接收报告块的RR
+	packet := []byte{
+		0x81, 201, 0x00, 0x07,
+		0x11, 0x22, 0x33, 0x44,
+		0x55, 0x66, 0x77, 0x88, 0x01, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x09,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	for _, profile := range testProfiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			sender, receiver := testContexts(t, profile)
+			for index := uint32(0); index < 3; index++ {
+				out, err := sender.EncryptRTCP(packet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tagLength := profile.rtcpAuthTagLength()
+				if flagIndex := binary.BigEndian.Uint32(out[len(out)-tagLength-4:]); flagIndex != srtcpEncryptedFlag|index {
+					t.Errorf("e flag and index %08X", flagIndex)
+				}
+				if !bytes.Equal(out[:8], packet[:8]) || bytes.Equal(out[8:len(packet)], packet[8:]) {
+					t.Errorf("header changed or body not encrypted")
+				}
+				dec, err := receiver.DecryptRTCP(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(dec, packet) {
+					t.Errorf("decrypted %x", dec)
+				}
+				if _, err := receiver.DecryptRTCP(out); err == nil {
+					t.Errorf("replay accepted")
+				}
+			}
+			out, _ := sender.EncryptRTCP(packet)
+			out[10] ^= 1
+			if _, err := receiver.DecryptRTCP(out); err == nil {
+				t.Errorf("tampered packet accepted")
+			}
+		})
+	}
+}
+
+// TestRTCPUnencrypted E标志为0的SRTCP包只认证不解密
+func TestRTCPUnencrypted(t *testing.T) {
+	_, receiver := testContexts(t, ProfileAESCM128HMACSHA180)
+	packet := []byte{0x80, 201, 0x00, 0x01, 0x11, 0x22, 0x33, 0x44}
+	out := append(append([]byte(nil), packet...), 0x00, 0x00, 0x00, 0x05)
+	out = append(out, receiver.rtcp.tag(10, out)...)
+	dec, err := receiver.DecryptRTCP(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, packet) {
+		t.Errorf("decrypted %x", dec)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted []uint64
+		index    uint64
+		ok       bool
+	}{
+		{"first", nil, 100, true},
+		{"newer", []uint64{100}, 101, true},
+		{"duplicate", []uint64{100}, 100, false},
+		{"older in window", []uint64{100}, 40, true},
+		{"older received", []uint64{40, 100}, 40, false},
+		{"too old", []uint64{100}, 36, false},
+		{"window shifted", []uint64{100, 200}, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &replayWindow{}
+			for _, index := range tt.accepted {
+				w.accept(index)
+			}
+			if ok := w.check(tt.index); ok != tt.ok {
+				t.Errorf("check %d = %v, want %v", tt.index, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewContextErrors(t *testing.T) {
+	if _, err := NewContext(ProtectionProfile(9), make([]byte, 16), make([]byte, 14)); err == nil {
+		t.Errorf("unknown profile accepted")
+	}
+	if _, err := NewContext(ProfileAEADAES256GCM, make([]byte, 16), make([]byte, 12)); err == nil {
+		t.Errorf("short key accepted")
+	}
+	if _, err := NewContext(ProfileAESCM128HMACSHA180, make([]byte, 16), make([]byte, 12)); err == nil {
+		t.Errorf("short salt accepted")
+	}
+}
@@ -0,0 +1,96 @@
+package srtp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Crypto sdp中的 a=crypto 属性(RFC 4568 SDES)，以明文携带主密钥，需在加密的信令通道(rtsps)中使用
+// a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:<base64(主密钥||主盐)>[|生存期]
+type Crypto struct {
+	Tag        int
+	Profile    ProtectionProfile
+	MasterKey  []byte
+	MasterSalt []byte
+	// Lifetime 主密钥的生存期，如2^31，为空时使用默认值
+	Lifetime string
+}
+
+// NewCrypto 生成随机的主密钥和主盐
+func NewCrypto(tag int, profile ProtectionProfile) (*Crypto, error) {
+	if !profile.valid() {
+		return nil, fmt.Errorf("srtp protection profile %v not supported", profile)
+	}
+	material := make([]byte, profile.KeyLength()+profile.SaltLength())
+	if _, err := rand.Read(material); err != nil {
+		return nil, err
+	}
+	return &Crypto{
+		Tag:        tag,
+		Profile:    profile,
+		MasterKey:  material[:profile.KeyLength()],
+		MasterSalt: material[profile.KeyLength():],
+	}, nil
+}
+
+// ParseCrypto 解析 a=crypto: 之后的值，只支持一个不带MKI的inline密钥
+func ParseCrypto(val string) (*Crypto, error) {
+	fields := strings.Fields(val)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("sdp crypto %q invalid", val)
+	}
+	tag, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("sdp crypto tag %q invalid", fields[0])
+	}
+	profile, err := ParseProtectionProfile(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	keyParams := strings.Split(fields[2], ";")[0]
+	if !strings.HasPrefix(strings.ToLower(keyParams), "inline:") {
+		return nil, fmt.Errorf("sdp crypto key method %q not supported", keyParams)
+	}
+	parts := strings.Split(keyParams[len("inline:"):], "|")
+	material, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		// 部分实现省略了base64的填充
+		if material, err = base64.RawStdEncoding.DecodeString(parts[0]); err != nil {
+			return nil, fmt.Errorf("sdp crypto key invalid: %s", err)
+		}
+	}
+	if len(material) != profile.KeyLength()+profile.SaltLength() {
+		return nil, fmt.Errorf("sdp crypto %v key length %d invalid", profile, len(material))
+	}
+	c := &Crypto{
+		Tag:        tag,
+		Profile:    profile,
+		MasterKey:  material[:profile.KeyLength()],
+		MasterSalt: material[profile.KeyLength():],
+	}
+	for _, part := range parts[1:] {
+		if strings.Contains(part, ":") {
+			return nil, fmt.Errorf("sdp crypto mki not supported")
+		}
+		c.Lifetime = part
+	}
+	return c, nil
+}
+
+// String a=crypto: 之后的值
+func (c *Crypto) String() string {
+	material := append(append([]byte(nil), c.MasterKey...), c.MasterSalt...)
+	s := fmt.Sprintf("%d %v inline:%s", c.Tag, c.Profile, base64.StdEncoding.EncodeToString(material))
+	if c.Lifetime != "" {
+		s += "|" + c.Lifetime
+	}
+	return s
+}
+
+// Context 由主密钥创建加解密上下文
+func (c *Crypto) Context() (*Context, error) {
+	return NewContext(c.Profile, c.MasterKey, c.MasterSalt)
+}
@@ -0,0 +1,77 @@
+package srtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCrypto(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      string
+		profile  ProtectionProfile
+		key      string
+		lifetime string
+		err      bool
+	}{
+		{"rfc 4568", "1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20 FEC_ORDER=FEC_SRTP",
+			ProfileAESCM128HMACSHA180, "59535f5f5f73656d63746c202829207b", "2^20", false},
+		{"sha1 32", "2 AES_CM_128_HMAC_SHA1_32 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz",
+			ProfileAESCM128HMACSHA132, "59535f5f5f73656d63746c202829207b", "", false},
+		{"gcm lowercase unpadded", "1 aead_aes_128_gcm inline:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGw",
+			ProfileAEADAES128GCM, "000102030405060708090a0b0c0d0e0f", "", false},
+		{"mki", "1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20|1:4", 0, "", "", true},
+		{"unknown suite", "1 F8_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz", 0, "", "", true},
+		{"key length", "1 AEAD_AES_256_GCM inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz", 0, "", "", true},
+		{"key method", "1 AES_CM_128_HMAC_SHA1_80 uri:https://example.com/key", 0, "", "", true},
+		{"tag", "x AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz", 0, "", "", true},
+		{"missing key", "1 AES_CM_128_HMAC_SHA1_80", 0, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCrypto(tt.val)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parsed %v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Profile != tt.profile || c.Lifetime != tt.lifetime || !bytes.Equal(c.MasterKey, mustHex(t, tt.key)) ||
+				len(c.MasterSalt) != tt.profile.SaltLength() {
+				t.Errorf("crypto %+v", c)
+			}
+			again, err := ParseCrypto(c.String())
+			if err != nil || again.String() != c.String() {
+				t.Errorf("string %q round trip %v", c.String(), err)
+			}
+			if _, err := c.Context(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewCrypto(t *testing.T) {
+	for _, profile := range testProfiles {
+		c, err := NewCrypto(1, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.MasterKey) != profile.KeyLength() || len(c.MasterSalt) != profile.SaltLength() {
+			t.Errorf("%v key/salt %d/%d", profile, len(c.MasterKey), len(c.MasterSalt))
+		}
+		parsed, err := ParseCrypto(c.String())
+		if err != nil || !bytes.Equal(parsed.MasterSalt, c.MasterSalt) {
+			t.Errorf("%v round trip %v", profile, err)
+		}
+		if p, err := ParseProtectionProfile(profile.String()); err != nil || p != profile {
+			t.Errorf("profile %v parsed %v", profile, p)
+		}
+	}
+	if _, err := NewCrypto(1, ProtectionProfile(0)); err == nil {
+		t.Errorf("invalid profile accepted")
+	}
+}
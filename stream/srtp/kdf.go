@@ -0,0 +1,34 @@
+package srtp
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+)
+
+// 会话密钥的派生标签(RFC 3711 4.3.2)
+const (
+	labelRTPEncryption  = 0x00
+	labelRTPAuth        = 0x01
+	labelRTPSalt        = 0x02
+	labelRTCPEncryption = 0x03
+	labelRTCPAuth       = 0x04
+	labelRTCPSalt       = 0x05
+)
+
+// deriveKey 由主密钥和主盐派生会话密钥，密钥派生率为0
+// 输入块为主盐与标签异或后以AES计数器模式加密(RFC 3711 4.3.3)，AES-GCM的12字节主盐在末尾补0(RFC 7714 11)
+func deriveKey(label byte, masterKey, masterSalt []byte, length int) ([]byte, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	in := make([]byte, aes.BlockSize)
+	copy(in, masterSalt)
+	in[7] ^= label
+	out := make([]byte, (length+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	for i := 0; i*aes.BlockSize < length; i++ {
+		binary.BigEndian.PutUint16(in[aes.BlockSize-2:], uint16(i))
+		block.Encrypt(out[i*aes.BlockSize:], in)
+	}
+	return out[:length], nil
+}
@@ -0,0 +1,47 @@
+package srtp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// mustHex 解析十六进制字符串，忽略空格
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(string(bytes.ReplaceAll([]byte(s), []byte(" "), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestDeriveKey RFC 3711 附录B.3的密钥派生向量
+func TestDeriveKey(t *testing.T) {
+	masterKey := mustHex(t, "E1F97A0D3E018BE0D64FA32C06DE4139")
+	masterSalt := mustHex(t, "0EC675AD498AFEEBB6960B3AABE6")
+	tests := []struct {
+		name   string
+		label  byte
+		length int
+		want   string
+	}{
+		{"cipher key", labelRTPEncryption, 16, "C61E7A93744F39EE10734AFE3FF7A087"},
+		{"cipher salt", labelRTPSalt, 14, "30CBBC08863D8C85D49DB34A9AE1"},
+		{"auth key", labelRTPAuth, 20, "CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := deriveKey(tt.label, masterKey, masterSalt, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustHex(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("key %X, want %X", got, want)
+			}
+		})
+	}
+	if _, err := deriveKey(labelRTPEncryption, masterKey[:15], masterSalt, 16); err == nil {
+		t.Errorf("invalid master key accepted")
+	}
+}
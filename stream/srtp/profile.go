@@ -0,0 +1,93 @@
+package srtp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProtectionProfile SRTP的加密和认证方式
+type ProtectionProfile int
+
+const (
+	ProfileAESCM128HMACSHA180 ProtectionProfile = iota + 1
+	ProfileAESCM128HMACSHA132
+	// ProfileAEADAES128GCM AES-GCM(RFC 7714)
+	ProfileAEADAES128GCM
+	ProfileAEADAES256GCM
+)
+
+// aeadTagLength AES-GCM的认证标签长度
+const aeadTagLength = 16
+
+// String 为sdp a=crypto中的名称(RFC 4568、RFC 7714)
+func (p ProtectionProfile) String() string {
+	switch p {
+	case ProfileAESCM128HMACSHA180:
+		return "AES_CM_128_HMAC_SHA1_80"
+	case ProfileAESCM128HMACSHA132:
+		return "AES_CM_128_HMAC_SHA1_32"
+	case ProfileAEADAES128GCM:
+		return "AEAD_AES_128_GCM"
+	case ProfileAEADAES256GCM:
+		return "AEAD_AES_256_GCM"
+	}
+	return fmt.Sprintf("profile(%d)", int(p))
+}
+
+// ParseProtectionProfile 由sdp a=crypto中的名称解析
+func ParseProtectionProfile(name string) (ProtectionProfile, error) {
+	for _, p := range []ProtectionProfile{
+		ProfileAESCM128HMACSHA180,
+		ProfileAESCM128HMACSHA132,
+		ProfileAEADAES128GCM,
+		ProfileAEADAES256GCM,
+	} {
+		if strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("srtp protection profile %s not supported", name)
+}
+
+// KeyLength 主密钥长度
+func (p ProtectionProfile) KeyLength() int {
+	if p == ProfileAEADAES256GCM {
+		return 32
+	}
+	return 16
+}
+
+// SaltLength 主盐长度
+func (p ProtectionProfile) SaltLength() int {
+	if p.aead() {
+		return 12
+	}
+	return 14
+}
+
+func (p ProtectionProfile) aead() bool {
+	return p == ProfileAEADAES128GCM || p == ProfileAEADAES256GCM
+}
+
+// rtpAuthTagLength SRTP的HMAC认证标签长度，AES-GCM为0
+func (p ProtectionProfile) rtpAuthTagLength() int {
+	switch p {
+	case ProfileAESCM128HMACSHA180:
+		return 10
+	case ProfileAESCM128HMACSHA132:
+		return 4
+	}
+	return 0
+}
+
+// rtcpAuthTagLength SRTCP的HMAC认证标签长度，两种HMAC方式都是80位(RFC 4568 6.2)
+func (p ProtectionProfile) rtcpAuthTagLength() int {
+	if p.aead() {
+		return 0
+	}
+	return 10
+}
+
+func (p ProtectionProfile) valid() bool {
+	return p >= ProfileAESCM128HMACSHA180 && p <= ProfileAEADAES256GCM
+}
@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 消息类型
+const (
+	OpText   = 0x1
+	OpBinary = 0x2
+	OpClose  = 0x8
+	OpPing   = 0x9
+	OpPong   = 0xA
+)
+
+// acceptGUID 计算 Sec-WebSocket-Accept 使用的固定值
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize 客户端消息的最大长度，超过时关闭连接
+const MaxMessageSize = 1 << 20
+
+// Conn 服务端的websocket连接，写入可以在多个协程中进行，读取只能在一个协程中进行
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock sync.Mutex
+	closed    bool
+	// Protocol 协商的子协议，客户端没有请求时为空
+	Protocol string
+}
+
+// IsUpgrade 请求是否为websocket握手
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade 响应websocket握手并接管连接，protocols 为支持的子协议，选择客户端请求中第一个支持的子协议
+func Upgrade(w http.ResponseWriter, r *http.Request, protocols ...string) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response does not support hijack")
+	}
+
+	var protocol string
+	for _, requested := range strings.Split(r.Header.Get("Sec-Websocket-Protocol"), ",") {
+		requested = strings.TrimSpace(requested)
+		for _, p := range protocols {
+			if protocol == "" && requested == p {
+				protocol = p
+			}
+		}
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+	if protocol != "" {
+		response += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	response += "\r\n"
+	// 握手之前的超时设置不再适用
+	conn.SetDeadline(time.Time{})
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: rw.Reader, Protocol: protocol}, nil
+}
+
+// headerContains 头中以逗号分隔的值是否包含 value，不区分大小写
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RemoteAddr 客户端地址
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetWriteDeadline 设置写入的超时时间
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// WriteMessage 写入一个完整的消息，服务端的消息不加掩码
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.writeFrame(opcode, data)
+}
+
+func (c *Conn) writeFrame(opcode int, data []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | byte(opcode)
+	switch {
+	case len(data) < 126:
+		header[1] = byte(len(data))
+	case len(data) <= 0xFFFF:
+		header[1] = 126
+		header = append(header, byte(len(data)>>8), byte(len(data)))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(len(data)))
+	}
+	buffers := net.Buffers{header, data}
+	_, err := buffers.WriteTo(c.conn)
+	return err
+}
+
+// ReadMessage 读取一个完整的消息，自动响应ping，收到close时回应并返回 io.EOF
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case OpPing:
+			if err := c.WriteMessage(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			c.writeLock.Lock()
+			if !c.closed {
+				// 回应原状态码
+				if len(payload) > 2 {
+					payload = payload[:2]
+				}
+				c.writeFrame(OpClose, payload)
+			}
+			c.writeLock.Unlock()
+			return 0, nil, io.EOF
+		case 0:
+			if opcode == 0 {
+				return 0, nil, errors.New("unexpected continuation frame")
+			}
+		default:
+			if opcode != 0 {
+				return 0, nil, errors.New("expected continuation frame")
+			}
+			opcode = op
+		}
+		if len(message)+len(payload) > MaxMessageSize {
+			return 0, nil, errors.New("message too large")
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame 读取一帧，客户端的帧必须带掩码
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("client frame is not masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.reader, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.reader, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, fmt.Errorf("frame too large:%d", length)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Close 发送close帧并关闭连接，可以重复调用
+func (c *Conn) Close() error {
+	c.writeLock.Lock()
+	if c.closed {
+		c.writeLock.Unlock()
+		return nil
+	}
+	c.closed = true
+	// 1000 正常关闭，对端可能已经断开，忽略写入错误
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(OpClose, []byte{0x03, 0xE8})
+	c.writeLock.Unlock()
+	return c.conn.Close()
+}
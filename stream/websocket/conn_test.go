@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConnPair 通过本地tcp连接创建服务端的Conn和客户端的连接
+func testConnPair(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	server.SetDeadline(time.Now().Add(2 * time.Second))
+	return &Conn{conn: server, reader: bufio.NewReader(server)}, client
+}
+
+// maskedFrame 客户端发送的带掩码的帧
+func maskedFrame(fin bool, opcode int, payload []byte) []byte {
+	b := []byte{byte(opcode), 0x80}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		b[1] |= byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		b[1] |= 126
+		b = append(b, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		b[1] |= 127
+		b = append(b, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(len(payload)))
+	}
+	mask := []byte{0x37, 0xFA, 0x21, 0x3D}
+	b = append(b, mask...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+	return b
+}
+
+func TestUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, "flv", "mse")
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(OpText, []byte(conn.Protocol))
+		conn.Close()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		header   string
+		status   int
+		accept   string
+		protocol string
+	}{
+		// RFC 6455 1.3 的示例
+		{"rfc example", "Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n",
+			http.StatusSwitchingProtocols, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", ""},
+		{"protocol", "Connection: Upgrade\r\nUpgrade: WebSocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat, mse, flv\r\n",
+			http.StatusSwitchingProtocols, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", "mse"},
+		{"not upgrade", "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n", http.StatusBadRequest, "", ""},
+		{"version", "Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n", http.StatusUpgradeRequired, "", ""},
+		{"missing key", "Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+			if _, err := conn.Write([]byte("GET /live/cam.flv HTTP/1.1\r\nHost: test\r\n" + tt.header + "\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			reader := bufio.NewReader(conn)
+			res, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", res.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusSwitchingProtocols {
+				return
+			}
+			if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != tt.accept {
+				t.Errorf("accept %s, want %s", accept, tt.accept)
+			}
+			if protocol := res.Header.Get("Sec-WebSocket-Protocol"); protocol != tt.protocol {
+				t.Errorf("protocol %s, want %s", protocol, tt.protocol)
+			}
+			// 协商的子协议作为文本消息返回，之后是close帧
+			frames, _ := io.ReadAll(reader)
+			want := append([]byte{0x81, byte(len(tt.protocol))}, tt.protocol...)
+			want = append(want, 0x88, 0x02, 0x03, 0xE8)
+			if !bytes.Equal(frames, want) {
+				t.Errorf("frames %x, want %x", frames, want)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode int
+		size   int
+		header string
+	}{
+		{"empty", OpBinary, 0, "8200"},
+		{"short", OpText, 125, "817d"},
+		{"16 bit length", OpBinary, 126, "827e007e"},
+		{"16 bit max", OpBinary, 0xFFFF, "827effff"},
+		{"64 bit length", OpBinary, 0x10000, "827f0000000000010000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client := testConnPair(t)
+			data := bytes.Repeat([]byte{0x5A}, tt.size)
+			go conn.WriteMessage(tt.opcode, data)
+			header, _ := hex.DecodeString(tt.header)
+			b := make([]byte, len(header)+tt.size)
+			if _, err := io.ReadFull(client, b); err != nil {
+				t.Fatal(err)
+			}
+			// 服务端的帧不加掩码
+			if !bytes.Equal(b[:len(header)], header) || !bytes.Equal(b[len(header):], data) {
+				t.Errorf("frame header %x, want %s", b[:len(header)], tt.header)
+			}
+		})
+	}
+
+	conn, _ := testConnPair(t)
+	conn.Close()
+	if err := conn.WriteMessage(OpBinary, []byte{1}); err != net.ErrClosed {
+		t.Errorf("write after close %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("second close %v", err)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		opcode int
+		data   []byte
+		reply  []byte
+		err    string
+	}{
+		// RFC 6455 5.7 的示例
+		{"rfc masked text", [][]byte{{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}}, OpText, []byte("Hello"), nil, ""},
+		{"fragmented", [][]byte{maskedFrame(false, OpText, []byte("Hel")), maskedFrame(true, 0, []byte("lo"))}, OpText, []byte("Hello"), nil, ""},
+		{"ping between fragments", [][]byte{maskedFrame(false, OpBinary, []byte{1}), maskedFrame(true, OpPing, []byte("hi")), maskedFrame(true, 0, []byte{2})},
+			OpBinary, []byte{1, 2}, []byte{0x8A, 0x02, 'h', 'i'}, ""},
+		{"pong ignored", [][]byte{maskedFrame(true, OpPong, nil), maskedFrame(true, OpBinary, []byte{3})}, OpBinary, []byte{3}, nil, ""},
+		{"16 bit length", [][]byte{maskedFrame(true, OpBinary, make([]byte, 300))}, OpBinary, make([]byte, 300), nil, ""},
+		{"64 bit length", [][]byte{maskedFrame(true, OpBinary, make([]byte, 70000))}, OpBinary, make([]byte, 70000), nil, ""},
+		// 回应close帧中的状态码
+		{"close", [][]byte{maskedFrame(true, OpClose, []byte{0x03, 0xE9, 'b', 'y', 'e'})}, 0, nil, []byte{0x88, 0x02, 0x03, 0xE9}, "EOF"},
+		{"unmasked", [][]byte{{0x82, 0x01, 0x00}}, 0, nil, nil, "client frame is not masked"},
+		{"unexpected continuation", [][]byte{maskedFrame(true, 0, []byte{1})}, 0, nil, nil, "unexpected continuation frame"},
+		{"expected continuation", [][]byte{maskedFrame(false, OpText, []byte{1}), maskedFrame(true, OpText, []byte{2})}, 0, nil, nil, "expected continuation frame"},
+		{"frame too large", [][]byte{{0x82, 0xFF, 0, 0, 0, 0, 0, 0x10, 0, 1}}, 0, nil, nil, "frame too large"},
+		{"message too large", [][]byte{maskedFrame(false, OpBinary, make([]byte, MaxMessageSize)), maskedFrame(true, 0, []byte{1})}, 0, nil, nil, "message too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client := testConnPair(t)
+			go func() {
+				for _, frame := range tt.frames {
+					client.Write(frame)
+				}
+			}()
+			opcode, data, err := conn.ReadMessage()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %s", err, tt.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if opcode != tt.opcode || !bytes.Equal(data, tt.data) {
+				t.Errorf("message %d %x", opcode, data)
+			}
+			if tt.reply != nil {
+				reply := make([]byte, len(tt.reply))
+				if _, err := io.ReadFull(client, reply); err != nil || !bytes.Equal(reply, tt.reply) {
+					t.Errorf("reply %x, want %x", reply, tt.reply)
+				}
+			}
+		})
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection string
+		upgrade    string
+		want       bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, upgrade", "WebSocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "h2c", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Connection", tt.connection)
+		r.Header.Set("Upgrade", tt.upgrade)
+		if got := IsUpgrade(r); got != tt.want {
+			t.Errorf("connection[%s] upgrade[%s] %v, want %v", tt.connection, tt.upgrade, got, tt.want)
+		}
+	}
+}